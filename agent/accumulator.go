@@ -9,6 +9,14 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+var (
+	// Number of metrics gathered by all inputs
+	metricsGathered = selfstat.Register("agent", "metrics_gathered", nil)
+	// Number of failed gathers of all inputs
+	gatherErrors = selfstat.Register("agent", "gather_errors", nil)
 )
 
 func NewAccumulator(
@@ -18,6 +26,8 @@ func NewAccumulator(
 	acc := accumulator{}
 	acc.metrics = metrics
 	acc.inputConfig = inputConfig
+	acc.gathered = selfstat.Register("gather", "metrics_gathered",
+		map[string]string{"input": inputConfig.Name})
 	return &acc
 }
 
@@ -27,12 +37,20 @@ type accumulator struct {
 	metrics chan telegraf.Metric
 
 	defaultTags map[string]string
+	// global tags of the agent, looked up at every metric as they can change
+	globalTags *globalTags
 
 	debug bool
 
 	inputConfig *internal_models.InputConfig
 
 	prefix string
+
+	// Number of metrics gathered by the input
+	gathered *selfstat.Stat
+
+	// tracer samples the gathered metrics, if set
+	tracer *internal_models.Tracer
 }
 
 func (ac *accumulator) Add(
@@ -56,6 +74,28 @@ func (ac *accumulator) AddFields(
 	fields map[string]interface{},
 	tags map[string]string,
 	t ...time.Time,
+) {
+	ac.addFields(nil, measurement, fields, tags, t...)
+}
+
+// AddFieldsWithSpan adds the fields like AddFields, the metric carrying the
+// span context span through the agent to the outputs.
+func (ac *accumulator) AddFieldsWithSpan(
+	span telegraf.SpanContext,
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	ac.addFields(&span, measurement, fields, tags, t...)
+}
+
+func (ac *accumulator) addFields(
+	span *telegraf.SpanContext,
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
 ) {
 	if len(fields) == 0 || len(measurement) == 0 {
 		return
@@ -96,6 +136,11 @@ func (ac *accumulator) AddFields(
 			tags[k] = v
 		}
 	}
+	for k, v := range ac.globalTags.get() {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
 
 	result := make(map[string]interface{})
 	for k, v := range fields {
@@ -151,9 +196,17 @@ func (ac *accumulator) AddFields(
 		log.Printf("Error adding point [%s]: %s\n", measurement, err.Error())
 		return
 	}
+	if span != nil {
+		m = telegraf.WithSpanContext(m, *span)
+	}
 	if ac.debug {
 		fmt.Println("> " + m.String())
 	}
+	if ac.gathered != nil {
+		ac.gathered.Incr(1)
+	}
+	metricsGathered.Incr(1)
+	ac.tracer.Gathered(ac.inputConfig.Name, m)
 	ac.metrics <- m
 }
 
@@ -165,10 +218,6 @@ func (ac *accumulator) SetDebug(debug bool) {
 	ac.debug = debug
 }
 
-func (ac *accumulator) setDefaultTags(tags map[string]string) {
-	ac.defaultTags = tags
-}
-
 func (ac *accumulator) addDefaultTag(key, value string) {
 	if ac.defaultTags == nil {
 		ac.defaultTags = make(map[string]string)
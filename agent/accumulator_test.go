@@ -38,6 +38,27 @@ func TestAdd(t *testing.T) {
 		actual)
 }
 
+func TestAddFieldsWithSpan(t *testing.T) {
+	a := accumulator{}
+	a.metrics = make(chan telegraf.Metric, 10)
+	defer close(a.metrics)
+	a.inputConfig = &internal_models.InputConfig{}
+
+	sc := telegraf.SpanContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+	}
+	telegraf.AddFieldsWithSpan(&a, sc, "acctest",
+		map[string]interface{}{"value": 101}, nil)
+	a.AddFields("acctest", map[string]interface{}{"value": 101}, nil)
+
+	got, ok := telegraf.SpanContextOf(<-a.metrics)
+	assert.True(t, ok)
+	assert.Equal(t, sc, got)
+	_, ok = telegraf.SpanContextOf(<-a.metrics)
+	assert.False(t, ok)
+}
+
 func TestAddDefaultTags(t *testing.T) {
 	a := accumulator{}
 	a.addDefaultTag("default", "tag")
@@ -1,30 +1,78 @@
 package agent
 
 import (
+	"context"
 	cryptorand "crypto/rand"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 	"math/rand"
 	"os"
+	"reflect"
 	"runtime"
+	"sort"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/logger"
 	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/selfstat"
 )
 
 // Agent runs telegraf and collects data based on the given config
 type Agent struct {
 	Config *config.Config
+
+	// channel shared between all input threads for accumulating metrics,
+	// kept across reloads as running service inputs write to it
+	metricC chan telegraf.Metric
+	// channels of the inputs of the named pipelines, kept likewise
+	pipelineCs map[string]chan telegraf.Metric
+
+	// service inputs that have been started and outputs that are connected,
+	// started is guarded by startedMu while running as the elections, the
+	// watchdog and the delayed starts start and stop the service inputs
+	startedMu sync.Mutex
+	started   map[*internal_models.RunningInput]bool
+	connected map[*internal_models.RunningOutput]bool
+
+	// pipelines of the running agent, Config.Outputs and connected are
+	// guarded by outputsMu while running as outputs are added and removed
+	// through the control API
+	outputsMu sync.RWMutex
+	pipelines []*pipeline
+
+	// time Run was called, the deadline of the first gathers
+	runStart time.Time
+
+	// tracer of the sampled metrics, nil if tracing is disabled
+	tracer *internal_models.Tracer
+
+	// tags added to all metrics
+	tags *globalTags
+
+	// membership of the agent in its cluster, nil without a cluster
+	cluster *clusterMember
+
+	// shard of the targets of the sharded inputs, nil without sharding
+	shard *internal_models.Shard
 }
 
 // NewAgent returns an Agent struct based off the given Config
 func NewAgent(config *config.Config) (*Agent, error) {
 	a := &Agent{
-		Config: config,
+		Config:     config,
+		metricC:    make(chan telegraf.Metric, 10000),
+		pipelineCs: make(map[string]chan telegraf.Metric),
+		started:    make(map[*internal_models.RunningInput]bool),
+		connected:  make(map[*internal_models.RunningOutput]bool),
+	}
+	for name := range config.Pipelines {
+		a.pipelineCs[name] = make(chan telegraf.Metric, 10000)
 	}
 
 	if !a.Config.Agent.OmitHostname {
@@ -40,6 +88,32 @@ func NewAgent(config *config.Config) (*Agent, error) {
 		config.Tags["host"] = a.Config.Agent.Hostname
 	}
 
+	tags, err := newGlobalTags(config.Tags, config.Agent.GlobalTagsFile)
+	if err != nil {
+		return nil, err
+	}
+	a.tags = tags
+
+	if config.Agent.ShardCount > 1 {
+		if config.Agent.ShardID < 0 ||
+			config.Agent.ShardID >= config.Agent.ShardCount {
+			return nil, fmt.Errorf("shard_id must be between 0 and %d, got %d",
+				config.Agent.ShardCount-1, config.Agent.ShardID)
+		}
+		a.shard = &internal_models.Shard{
+			ID:    config.Agent.ShardID,
+			Count: config.Agent.ShardCount,
+		}
+	}
+
+	if config.Agent.Cluster != "" {
+		m, err := newClusterMember(config.Agent)
+		if err != nil {
+			return nil, err
+		}
+		a.cluster = m
+	}
+
 	return a, nil
 }
 
@@ -47,71 +121,334 @@ func NewAgent(config *config.Config) (*Agent, error) {
 func (a *Agent) Connect() error {
 	for _, o := range a.Config.Outputs {
 		o.Quiet = a.Config.Agent.Quiet
-
-		switch ot := o.Output.(type) {
-		case telegraf.ServiceOutput:
-			if err := ot.Start(); err != nil {
-				log.Printf("Service for output %s failed to start, exiting\n%s\n",
-					o.Name, err.Error())
-				return err
-			}
-		}
-
-		if a.Config.Agent.Debug {
-			log.Printf("Attempting connection to output: %s\n", o.Name)
+		if a.connected[o] {
+			continue
 		}
-		err := o.Output.Connect()
-		if err != nil {
-			log.Printf("Failed to connect to output %s, retrying in 15s, "+
-				"error was '%s' \n", o.Name, err)
-			time.Sleep(15 * time.Second)
-			err = o.Output.Connect()
-			if err != nil {
-				return err
-			}
+		if err := connectOutput(o, 15*time.Second); err != nil {
+			return err
 		}
-		if a.Config.Agent.Debug {
-			log.Printf("Successfully connected to output: %s\n", o.Name)
+		a.connected[o] = true
+	}
+	return nil
+}
+
+// connectOutput opens the WAL of o, starts it if it is a service output and
+// connects it, trying again once after retry if positive.
+func connectOutput(o *internal_models.RunningOutput, retry time.Duration) error {
+	if err := o.OpenWAL(); err != nil {
+		return err
+	}
+
+	switch ot := o.Output.(type) {
+	case telegraf.ServiceOutput:
+		if err := ot.Start(); err != nil {
+			o.Log.Errorf("Service failed to start, exiting\n%s", err)
+			return err
 		}
 	}
+
+	o.Log.Debugf("Attempting connection")
+	err := o.Output.Connect()
+	if err != nil && retry > 0 {
+		o.Log.Errorf("Failed to connect, retrying in %s, error was '%s'",
+			retry, err)
+		time.Sleep(retry)
+		err = o.Output.Connect()
+	}
+	if err != nil {
+		return err
+	}
+	o.Log.Debugf("Successfully connected")
 	return nil
 }
 
-// Close closes the connection to all configured outputs
+// Close stops all service inputs, closes the inputs keeping connections and
+// closes the connection to all configured outputs, resigning the leadership of the cluster
 func (a *Agent) Close() error {
+	for _, input := range a.Config.Inputs {
+		a.stopInput(input)
+	}
+	if a.cluster != nil {
+		a.cluster.resign()
+	}
+
 	var err error
 	for _, o := range a.Config.Outputs {
-		err = o.Output.Close()
-		switch ot := o.Output.(type) {
-		case telegraf.ServiceOutput:
-			ot.Stop()
+		if e := a.closeOutput(o); e != nil {
+			err = e
 		}
 	}
 	return err
 }
 
+func (a *Agent) stopInput(input *internal_models.RunningInput) {
+	if a.started[input] {
+		input.Input.(telegraf.ServiceInput).Stop()
+		delete(a.started, input)
+	}
+	closeInput(input, input.Input)
+}
+
+// closeInput releases the resources kept by plugin, an instance of input
+// which is discarded.
+func closeInput(input *internal_models.RunningInput, plugin telegraf.Input) {
+	if c, ok := plugin.(telegraf.ClosingInput); ok {
+		if err := c.Close(); err != nil {
+			input.Log.Errorf("Error closing the input: %s", err)
+		}
+	}
+}
+
+func (a *Agent) closeOutput(o *internal_models.RunningOutput) error {
+	err := o.Output.Close()
+	switch ot := o.Output.(type) {
+	case telegraf.ServiceOutput:
+		ot.Stop()
+	}
+	if o.WAL != nil {
+		o.WAL.Close()
+	}
+	delete(a.connected, o)
+	return err
+}
+
+// Reload returns an agent running the config c in place of a, which must
+// not be running anymore. Inputs and outputs whose configuration did not
+// change are carried over as they are: service inputs keep running and
+// outputs keep their connection and cached metrics. The others are stopped
+// and closed, and the metrics cached by a closed output are handed to the
+// new output of the same name, if any.
+func (a *Agent) Reload(c *config.Config) (*Agent, error) {
+	n, err := NewAgent(c)
+	if err != nil {
+		return nil, err
+	}
+	n.metricC = a.metricC
+	for name, c := range a.pipelineCs {
+		if _, ok := n.pipelineCs[name]; ok {
+			n.pipelineCs[name] = c
+		}
+	}
+
+	// Inputs are only carried over when the global tags, which their
+	// accumulators were created with, are the same. The tags of the file
+	// then keep being refreshed for them.
+	keepInputs := reflect.DeepEqual(a.Config.Tags, n.Config.Tags) &&
+		a.Config.Agent.GlobalTagsFile == n.Config.Agent.GlobalTagsFile
+	if keepInputs {
+		n.tags = a.tags
+	}
+	// The leadership is kept if the cluster is the same, the singleton
+	// inputs are started or stopped by the first election of n otherwise
+	if n.cluster.sameCluster(a.cluster) {
+		n.cluster = a.cluster
+	} else if a.cluster != nil {
+		a.cluster.resign()
+	}
+	oldInputs := make(map[string][]*internal_models.RunningInput)
+	for _, input := range a.Config.Inputs {
+		if keepInputs && input.Fingerprint != "" {
+			oldInputs[input.Fingerprint] = append(
+				oldInputs[input.Fingerprint], input)
+		}
+	}
+	kept := make(map[*internal_models.RunningInput]bool)
+	for i, input := range n.Config.Inputs {
+		old := oldInputs[input.Fingerprint]
+		if len(old) == 0 {
+			continue
+		}
+		oldInputs[input.Fingerprint] = old[1:]
+		n.Config.Inputs[i] = old[0]
+		kept[old[0]] = true
+		if a.started[old[0]] {
+			n.started[old[0]] = true
+		}
+	}
+	for _, input := range a.Config.Inputs {
+		if !kept[input] {
+			a.stopInput(input)
+		}
+	}
+
+	oldOutputs := make(map[string][]*internal_models.RunningOutput)
+	for _, o := range a.Config.Outputs {
+		if o.Fingerprint != "" {
+			oldOutputs[o.Fingerprint] = append(oldOutputs[o.Fingerprint], o)
+		}
+	}
+	keptOutputs := make(map[*internal_models.RunningOutput]bool)
+	for i, o := range n.Config.Outputs {
+		old := oldOutputs[o.Fingerprint]
+		if len(old) == 0 {
+			continue
+		}
+		oldOutputs[o.Fingerprint] = old[1:]
+		// The agent settings of the new config still apply
+		old[0].MetricBufferLimit = o.MetricBufferLimit
+		old[0].FlushBufferWhenFull = o.FlushBufferWhenFull
+		n.Config.Outputs[i] = old[0]
+		keptOutputs[old[0]] = true
+		if a.connected[old[0]] {
+			n.connected[old[0]] = true
+		}
+	}
+	for _, o := range a.Config.Outputs {
+		if keptOutputs[o] {
+			continue
+		}
+		metrics := o.TakeMetrics()
+		// Closed first, so that a new output of the same wal_dir opens the
+		// WAL as the closed output left it
+		if err := a.closeOutput(o); err != nil {
+			o.Log.Errorf("Error closing output: %s", err)
+		}
+		for _, no := range n.Config.Outputs {
+			if no.Name == o.Name && !keptOutputs[no] {
+				if err := no.OpenWAL(); err != nil {
+					no.Log.Errorf("%s", err)
+				}
+				for _, m := range metrics {
+					no.AddMetric(m)
+				}
+				metrics = nil
+				break
+			}
+		}
+		if len(metrics) > 0 {
+			o.Log.Warnf("Dropping %d cached metrics of the removed output",
+				len(metrics))
+		}
+	}
+
+	return n, nil
+}
+
+// newAccumulator returns the accumulator of the metrics gathered by input,
+// sending them to the channel of its pipeline.
+func (a *Agent) newAccumulator(input *internal_models.RunningInput) *accumulator {
+	acc := NewAccumulator(input.Config, a.inputC(input))
+	acc.SetDebug(input.Log.Enabled(logger.LevelDebug))
+	acc.globalTags = a.tags
+	acc.tracer = a.tracer
+	return acc
+}
+
 func panicRecover(input *internal_models.RunningInput) {
 	if err := recover(); err != nil {
-		trace := make([]byte, 2048)
-		runtime.Stack(trace, true)
-		log.Printf("FATAL: Input [%s] panicked: %s, Stack:\n%s\n",
-			input.Name, err, trace)
-		log.Println("PLEASE REPORT THIS PANIC ON GITHUB with " +
-			"stack trace, configuration, and OS information: " +
-			"https://github.com/influxdata/telegraf/issues/new")
+		logPanic(input, err)
 	}
 }
 
+func logPanic(input *internal_models.RunningInput, err interface{}) {
+	trace := make([]byte, 2048)
+	runtime.Stack(trace, true)
+	input.Log.Errorf("FATAL: Input panicked: %s, Stack:\n%s", err, trace)
+	input.Log.Errorf("PLEASE REPORT THIS PANIC ON GITHUB with " +
+		"stack trace, configuration, and OS information: " +
+		"https://github.com/influxdata/telegraf/issues/new")
+}
+
+// gather gathers the metrics of the input, recording its gather time and
+// errors. A gather exceeding the gather timeout is abandoned and cancelled
+// if the input is a telegraf.ContextInput, the input is skipped until the
+// abandoned gather returns. Inputs failing repeatedly are restarted by the
+// watchdog.
+func (a *Agent) gather(
+	input *internal_models.RunningInput,
+	acc telegraf.Accumulator,
+) error {
+	tags := map[string]string{"input": input.Name}
+	if !input.StartGather() {
+		err := fmt.Errorf("skipped gather, the previous gather is still running")
+		input.Log.Errorf("Error in input: %s", err)
+		selfstat.Register("gather", "errors", tags).Incr(1)
+		gatherErrors.Incr(1)
+		input.AddError(time.Now(), err)
+		a.watch(input, true)
+		return err
+	}
+
+	timeout := a.gatherTimeout(input)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	var panicked bool
+	// The instance is replaced when the watchdog restarts the input
+	plugin, generation := input.Instance()
+	go func() {
+		defer input.EndGatherOf(generation)
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(input, r)
+				panicked = true
+				done <- fmt.Errorf("input panicked: %v", r)
+			}
+		}()
+		if ci, ok := plugin.(telegraf.ContextInput); ok {
+			done <- ci.GatherContext(ctx, acc)
+		} else {
+			done <- plugin.Gather(acc)
+		}
+	}()
+
+	var err error
+	failed := false
+	select {
+	case err = <-done:
+		failed = panicked
+	case <-ctx.Done():
+		err = fmt.Errorf("gather timed out after %s, abandoning it", timeout)
+		selfstat.Register("gather", "gather_timeouts", tags).Incr(1)
+		failed = true
+	}
+
+	now := time.Now()
+	input.SetLastGather(now)
+	selfstat.RegisterGauge("gather", "gather_time_ns", tags).Set(
+		now.Sub(start).Nanoseconds())
+	if err != nil {
+		input.Log.Errorf("Error in input: %s", err)
+		selfstat.Register("gather", "errors", tags).Incr(1)
+		gatherErrors.Incr(1)
+		input.AddError(now, err)
+	}
+	a.watch(input, failed)
+	return err
+}
+
+// gatherTimeout returns the deadline of the gathers of input: its own
+// gather timeout, the gather timeout of the agent or else its interval.
+func (a *Agent) gatherTimeout(input *internal_models.RunningInput) time.Duration {
+	if input.Config.GatherTimeout > 0 {
+		return input.Config.GatherTimeout
+	}
+	if a.Config.Agent.GatherTimeout.Duration > 0 {
+		return a.Config.Agent.GatherTimeout.Duration
+	}
+	if input.Config.Interval > 0 {
+		return input.Config.Interval
+	}
+	return a.Config.Agent.Interval.Duration
+}
+
 // gatherParallel runs the inputs that are using the same reporting interval
 // as the telegraf agent.
-func (a *Agent) gatherParallel(metricC chan telegraf.Metric) error {
+func (a *Agent) gatherParallel() error {
 	var wg sync.WaitGroup
 
 	start := time.Now()
 	counter := 0
-	jitter := a.Config.Agent.CollectionJitter.Duration.Nanoseconds()
 	for _, input := range a.Config.Inputs {
-		if input.Config.Interval != 0 {
+		if input.Config.Interval != 0 || input.Paused() || !a.runsHere(input) {
 			continue
 		}
 
@@ -121,25 +458,16 @@ func (a *Agent) gatherParallel(metricC chan telegraf.Metric) error {
 			defer panicRecover(input)
 			defer wg.Done()
 
-			acc := NewAccumulator(input.Config, metricC)
-			acc.SetDebug(a.Config.Agent.Debug)
-			acc.setDefaultTags(a.Config.Tags)
-
-			if jitter != 0 {
-				nanoSleep := rand.Int63n(jitter)
-				d, err := time.ParseDuration(fmt.Sprintf("%dns", nanoSleep))
-				if err != nil {
-					log.Printf("Jittering collection interval failed for plugin %s",
-						input.Name)
-				} else {
-					time.Sleep(d)
-				}
+			if !a.ready(input) {
+				return
 			}
+			acc := a.newAccumulator(input)
 
-			if err := input.Input.Gather(acc); err != nil {
-				log.Printf("Error in input [%s]: %s", input.Name, err)
+			if jitter := a.collectionJitter(input).Nanoseconds(); jitter != 0 {
+				time.Sleep(time.Duration(rand.Int63n(jitter)))
 			}
 
+			a.gather(input, acc)
 		}(input)
 	}
 
@@ -162,28 +490,43 @@ func (a *Agent) gatherParallel(metricC chan telegraf.Metric) error {
 func (a *Agent) gatherSeparate(
 	shutdown chan struct{},
 	input *internal_models.RunningInput,
-	metricC chan telegraf.Metric,
 ) error {
 	defer panicRecover(input)
 
+	// Round collection to the nearest multiple of the input's interval
+	if a.Config.Agent.RoundInterval {
+		i := int64(input.Config.Interval)
+		select {
+		case <-shutdown:
+			return nil
+		case <-time.After(time.Duration(i - (time.Now().UnixNano() % i))):
+		}
+	}
 	ticker := time.NewTicker(input.Config.Interval)
+	jitter := a.collectionJitter(input).Nanoseconds()
 
 	for {
+		if jitter != 0 {
+			select {
+			case <-shutdown:
+				return nil
+			case <-time.After(time.Duration(rand.Int63n(jitter))):
+			}
+		}
+
 		var outerr error
 		start := time.Now()
 
-		acc := NewAccumulator(input.Config, metricC)
-		acc.SetDebug(a.Config.Agent.Debug)
-		acc.setDefaultTags(a.Config.Tags)
+		if !input.Paused() && a.runsHere(input) && a.ready(input) {
+			acc := a.newAccumulator(input)
 
-		if err := input.Input.Gather(acc); err != nil {
-			log.Printf("Error in input [%s]: %s", input.Name, err)
-		}
+			a.gather(input, acc)
 
-		elapsed := time.Since(start)
-		if !a.Config.Agent.Quiet {
-			log.Printf("Gathered metrics, (separate %s interval), from %s in %s\n",
-				input.Config.Interval, input.Name, elapsed)
+			elapsed := time.Since(start)
+			if !a.Config.Agent.Quiet {
+				log.Printf("Gathered metrics, (separate %s interval), from %s in %s\n",
+					input.Config.Interval, input.Name, elapsed)
+			}
 		}
 
 		if outerr != nil {
@@ -199,96 +542,240 @@ func (a *Agent) gatherSeparate(
 	}
 }
 
-// Test verifies that we can 'Gather' from all inputs with their configured
-// Config struct
+// collectionJitter returns the collection jitter of the input, which
+// defaults to the one of the agent.
+func (a *Agent) collectionJitter(input *internal_models.RunningInput) time.Duration {
+	if input.Config.CollectionJitter != nil {
+		return *input.Config.CollectionJitter
+	}
+	return a.Config.Agent.CollectionJitter.Duration
+}
+
+// shardInputs restricts the sharded inputs to the targets of the shard of
+// the agent.
+func (a *Agent) shardInputs() {
+	var owns func(string) bool
+	if a.shard != nil {
+		owns = a.shard.Owns
+	}
+	for _, input := range a.Config.Inputs {
+		if s, ok := input.Input.(telegraf.ShardedInput); ok {
+			s.SetShard(owns)
+		}
+	}
+}
+
+// Test gathers the metrics of the inputs once and prints them to stdout,
+// without connecting or writing to the outputs.
 func (a *Agent) Test() error {
-	shutdown := make(chan struct{})
-	defer close(shutdown)
-	metricC := make(chan telegraf.Metric)
+	return a.test(os.Stdout)
+}
 
-	// dummy receiver for the point channel
+func (a *Agent) test(w io.Writer) error {
+	metricC := make(chan telegraf.Metric)
+	// A nil metric is sent after each collection, to wait for the metrics of
+	// the collection to be printed.
+	printed := make(chan struct{})
 	go func() {
-		for {
-			select {
-			case <-metricC:
-				// do nothing
-			case <-shutdown:
-				return
+		for m := range metricC {
+			if m == nil {
+				printed <- struct{}{}
+				continue
 			}
+			printMetric(w, m)
 		}
 	}()
+	defer close(metricC)
 
+	a.shardInputs()
 	for _, input := range a.Config.Inputs {
 		acc := NewAccumulator(input.Config, metricC)
-		acc.SetDebug(true)
-
-		fmt.Printf("* Plugin: %s, Collection 1\n", input.Name)
-		if input.Config.Interval != 0 {
-			fmt.Printf("* Internal: %s\n", input.Config.Interval)
-		}
+		acc.globalTags = a.tags
 
-		if err := input.Input.Gather(acc); err != nil {
-			return err
+		// Service inputs only collect metrics while they are running
+		if p, ok := input.Input.(telegraf.ServiceInput); ok {
+			if err := p.Start(acc); err != nil {
+				return fmt.Errorf("Service for input %s failed to start: %s",
+					input.Name, err)
+			}
+			defer p.Stop()
 		}
 
+		collections := 1
 		// Special instructions for some inputs. cpu, for example, needs to be
 		// run twice in order to return cpu usage percentages.
 		switch input.Name {
 		case "cpu", "mongodb", "procstat":
-			time.Sleep(500 * time.Millisecond)
-			fmt.Printf("* Plugin: %s, Collection 2\n", input.Name)
+			collections = 2
+		}
+
+		for i := 1; i <= collections; i++ {
+			if i > 1 {
+				time.Sleep(500 * time.Millisecond)
+			}
+			fmt.Fprintf(w, "* Plugin: %s, Collection %d\n", input.Name, i)
+			if i == 1 && input.Config.Interval != 0 {
+				fmt.Fprintf(w, "* Interval: %s\n", input.Config.Interval)
+			}
+
 			if err := input.Input.Gather(acc); err != nil {
 				return err
 			}
+			metricC <- nil
+			<-printed
 		}
-
 	}
 	return nil
 }
 
-// flush writes a list of metrics to all configured outputs
-func (a *Agent) flush() {
-	var wg sync.WaitGroup
+// printMetric prints the metric in line protocol, followed by its tags and
+// its fields with their types, sorted by key.
+func printMetric(w io.Writer, m telegraf.Metric) {
+	fmt.Fprintf(w, "> %s\n", m.String())
 
-	wg.Add(len(a.Config.Outputs))
-	for _, o := range a.Config.Outputs {
-		go func(output *internal_models.RunningOutput) {
-			defer wg.Done()
-			err := output.Write()
-			if err != nil {
-				log.Printf("Error writing to output [%s]: %s\n",
-					output.Name, err.Error())
-			}
-		}(o)
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "    time\t%s\n", m.Time().UTC().Format(time.RFC3339Nano))
+
+	tags := m.Tags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "    tag\t%s\t= %s\n", k, tags[k])
 	}
 
-	wg.Wait()
+	fields := m.Fields()
+	keys = keys[:0]
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "    field\t%s\t= %v\t(%T)\n", k, fields[k], fields[k])
+	}
+	tw.Flush()
 }
 
-// flusher monitors the metrics input channel and flushes on the minimum interval
-func (a *Agent) flusher(shutdown chan struct{}, metricC chan telegraf.Metric) error {
+// flusher routes the metrics of the channel of the pipeline to its outputs
+// and flushes them every flush interval of the pipeline.
+func (a *Agent) flusher(shutdown chan struct{}, p *pipeline) error {
 	// Inelegant, but this sleep is to allow the Gather threads to run, so that
 	// the flusher will flush after metrics are collected.
 	time.Sleep(time.Millisecond * 200)
 
-	ticker := time.NewTicker(a.Config.Agent.FlushInterval.Duration)
+	ticker := time.NewTicker(p.flushInterval)
+	var dedup *internal_models.Deduplicator
+	if a.Config.Agent.DedupWindow.Duration > 0 {
+		dedup = internal_models.NewDeduplicator(
+			a.Config.Agent.DedupWindow.Duration, a.Config.Agent.DedupFields)
+	}
+	route := func(m telegraf.Metric) {
+		if dedup.Duplicate(m) {
+			return
+		}
+		a.tracer.Routed(m)
+		p.route(m)
+	}
 
 	for {
+		// The inputs block once the channel is full while it isn't read
+		metricC := p.metricC
+		if p.blocked() {
+			metricC = nil
+		}
 		select {
 		case <-shutdown:
-			log.Println("Hang on, flushing any cached metrics before shutdown")
-			a.flush()
+			// Route the metrics gathered before the shutdown
+			for routed := false; !routed; {
+				select {
+				case m := <-p.metricC:
+					route(m)
+				default:
+					routed = true
+				}
+			}
+			if p.name == "" {
+				log.Println("Hang on, flushing any cached metrics before shutdown")
+			}
+			a.finalFlush(p, a.Config.Agent.ShutdownFlushTimeout.Duration)
 			return nil
 		case <-ticker.C:
-			a.flush()
+			p.flush()
 		case m := <-metricC:
-			for _, o := range a.Config.Outputs {
-				o.AddMetric(m)
+			route(m)
+			// A blocking output is written as soon as its buffer is full,
+			// then at each flush until it accepts the writes again
+			if p.blocked() {
+				p.flush()
 			}
 		}
 	}
 }
 
+// finalFlush flushes the outputs on shutdown, giving up after timeout if
+// positive so that a hanging output can't block the shutdown.
+func (a *Agent) finalFlush(p *pipeline, timeout time.Duration) {
+	if timeout <= 0 {
+		p.flush()
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		p.flush()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("WARNING: outputs did not flush within the "+
+			"shutdown_flush_timeout of %s, cached metrics may be lost\n", timeout)
+	}
+}
+
+// linkDeadLetters sets the outputs named by the dead_letter_output of the
+// outputs, in the same pipeline, as their dead letter.
+func (a *Agent) linkDeadLetters() error {
+	for _, o := range a.Config.Outputs {
+		if err := linkDeadLetter(o, a.Config.Outputs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkDeadLetter sets the output of outputs named by the dead_letter_output
+// of o, in the same pipeline, as its dead letter.
+func linkDeadLetter(
+	o *internal_models.RunningOutput,
+	outputs []*internal_models.RunningOutput,
+) error {
+	name := o.Config.DeadLetterOutput
+	if name == "" {
+		return nil
+	}
+	var dead *internal_models.RunningOutput
+	for _, d := range outputs {
+		if d != o && d.Name == name &&
+			d.Config.Pipeline == o.Config.Pipeline {
+			dead = d
+			break
+		}
+	}
+	if dead == nil {
+		return fmt.Errorf("dead_letter_output %s of output %s is not "+
+			"configured in its pipeline", name, o.Name)
+	}
+	// Outputs rejecting into each other could deadlock
+	if dead.Config.DeadLetterOutput != "" {
+		return fmt.Errorf("output %s is the dead_letter_output of %s and "+
+			"can't have a dead_letter_output itself", dead.Name, o.Name)
+	}
+	o.DeadLetter = dead
+	return nil
+}
+
 // jitterInterval applies the the interval jitter to the flush interval using
 // crypto/rand number generator
 func jitterInterval(ininterval, injitter time.Duration) time.Duration {
@@ -310,7 +797,9 @@ func jitterInterval(ininterval, injitter time.Duration) time.Duration {
 	return outinterval
 }
 
-// Run runs the agent daemon, gathering every Interval
+// Run runs the agent daemon, gathering every Interval. Service inputs keep
+// running when it returns, so that they can be carried over by Reload, until
+// Close is called.
 func (a *Agent) Run(shutdown chan struct{}) error {
 	var wg sync.WaitGroup
 
@@ -323,23 +812,57 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 		a.Config.Agent.Interval.Duration, a.Config.Agent.Debug, a.Config.Agent.Quiet,
 		a.Config.Agent.Hostname, a.Config.Agent.FlushInterval.Duration)
 
-	// channel shared between all input threads for accumulating metrics
-	metricC := make(chan telegraf.Metric, 10000)
+	if err := a.linkDeadLetters(); err != nil {
+		return err
+	}
+	pipelines := a.newPipelines()
+	a.outputsMu.Lock()
+	a.pipelines = pipelines
+	a.outputsMu.Unlock()
+	for _, p := range pipelines[1:] {
+		log.Printf("Pipeline %s: Flush Interval:%s, %d outputs\n", p.name,
+			p.flushInterval, len(p.outputs))
+	}
 
-	for _, input := range a.Config.Inputs {
-		// Start service of any ServicePlugins
-		switch p := input.Input.(type) {
-		case telegraf.ServiceInput:
-			acc := NewAccumulator(input.Config, metricC)
-			acc.SetDebug(a.Config.Agent.Debug)
-			acc.setDefaultTags(a.Config.Tags)
-			if err := p.Start(acc); err != nil {
-				log.Printf("Service for input %s failed to start, exiting\n%s\n",
-					input.Name, err.Error())
-				return err
-			}
-			defer p.Stop()
+	if a.Config.Agent.TraceSampleRate > 0 {
+		a.tracer = internal_models.NewTracer(a.Config.Agent.TraceSampleRate)
+	}
+	for _, o := range a.Config.Outputs {
+		o.Tracer = a.tracer
+	}
+
+	a.runStart = time.Now()
+	if a.Config.Agent.HealthAddress != "" {
+		l, err := a.serveHealth(a.Config.Agent.HealthAddress)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+	}
+	if a.Config.Agent.ControlAddress != "" {
+		l, err := listenControl(a.Config.Agent.ControlAddress)
+		if err != nil {
+			return fmt.Errorf("Could not serve control API on %s: %s",
+				a.Config.Agent.ControlAddress, err)
 		}
+		defer a.serveControl(l).Stop()
+	}
+
+	if a.shard != nil {
+		log.Printf("Gathering the targets of shard %d of %d\n", a.shard.ID,
+			a.shard.Count)
+	}
+	a.shardInputs()
+
+	// Singleton service inputs are started by the elections
+	if a.cluster != nil {
+		a.elect()
+	}
+	// Service inputs start before the first gathers, those waiting for
+	// their startup_delay or wait_for addresses are started once ready
+	if err := a.startServices(); err != nil {
+		log.Printf("Service failed to start, exiting: %s\n", err)
+		return err
 	}
 
 	// Round collection to nearest interval by sleeping
@@ -349,14 +872,43 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 	}
 	ticker := time.NewTicker(a.Config.Agent.Interval.Duration)
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := a.flusher(shutdown, metricC); err != nil {
-			log.Printf("Flusher routine failed, exiting: %s\n", err.Error())
-			close(shutdown)
-		}
-	}()
+	if a.Config.Agent.MaxMemory.Size > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.limitMemory(shutdown, a.Config.Agent.MaxMemory.Size)
+		}()
+	}
+
+	if a.cluster != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.campaign(shutdown)
+		}()
+	}
+
+	if a.Config.Agent.GlobalTagsFile != "" &&
+		a.Config.Agent.GlobalTagsRefreshInterval.Duration > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.tags.refresh(shutdown,
+				a.Config.Agent.GlobalTagsRefreshInterval.Duration)
+		}()
+	}
+
+	var failed sync.Once
+	for _, p := range pipelines {
+		wg.Add(1)
+		go func(p *pipeline) {
+			defer wg.Done()
+			if err := a.flusher(shutdown, p); err != nil {
+				log.Printf("Flusher routine failed, exiting: %s\n", err.Error())
+				failed.Do(func() { close(shutdown) })
+			}
+		}(p)
+	}
 
 	for _, input := range a.Config.Inputs {
 		// Special handling for inputs that have their own collection interval
@@ -365,7 +917,7 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 			wg.Add(1)
 			go func(input *internal_models.RunningInput) {
 				defer wg.Done()
-				if err := a.gatherSeparate(shutdown, input, metricC); err != nil {
+				if err := a.gatherSeparate(shutdown, input); err != nil {
 					log.Printf(err.Error())
 				}
 			}(input)
@@ -375,7 +927,8 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 	defer wg.Wait()
 
 	for {
-		if err := a.gatherParallel(metricC); err != nil {
+		a.startServices()
+		if err := a.gatherParallel(); err != nil {
 			log.Printf(err.Error())
 		}
 
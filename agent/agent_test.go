@@ -1,10 +1,22 @@
 package agent
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/logger"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/influxdata/telegraf/testutil"
 
 	// needing to load the plugins
 	_ "github.com/influxdata/telegraf/plugins/inputs/all"
@@ -182,3 +194,755 @@ func TestAgent_JitterMin(t *testing.T) {
 		}
 	}
 }
+
+func TestAgent_InputCollectionJitter(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.CollectionJitter.Duration = 5 * time.Second
+	a, _ := NewAgent(c)
+
+	input := &internal_models.RunningInput{
+		Config: &internal_models.InputConfig{},
+	}
+	assert.Equal(t, 5*time.Second, a.collectionJitter(input))
+
+	jitter := time.Duration(0)
+	input.Config.CollectionJitter = &jitter
+	assert.Equal(t, time.Duration(0), a.collectionJitter(input))
+}
+
+type reloadInput struct {
+	running bool
+}
+
+func (i *reloadInput) Description() string                 { return "" }
+func (i *reloadInput) SampleConfig() string                { return "" }
+func (i *reloadInput) Gather(_ telegraf.Accumulator) error { return nil }
+func (i *reloadInput) Start(_ telegraf.Accumulator) error  { i.running = true; return nil }
+func (i *reloadInput) Stop()                               { i.running = false }
+
+type reloadOutput struct {
+	closed bool
+}
+
+func (o *reloadOutput) Description() string             { return "" }
+func (o *reloadOutput) SampleConfig() string            { return "" }
+func (o *reloadOutput) Connect() error                  { return nil }
+func (o *reloadOutput) Close() error                    { o.closed = true; return nil }
+func (o *reloadOutput) Write(_ []telegraf.Metric) error { return nil }
+
+func reloadConfig(inputs map[string]*reloadInput, outputs map[string]*reloadOutput) *config.Config {
+	c := config.NewConfig()
+	c.Agent.OmitHostname = true
+	for fp, input := range inputs {
+		c.Inputs = append(c.Inputs, &internal_models.RunningInput{
+			Name:        "reload",
+			Input:       input,
+			Config:      &internal_models.InputConfig{Name: "reload"},
+			Fingerprint: fp,
+		})
+	}
+	for fp, output := range outputs {
+		ro := internal_models.NewRunningOutput("reload", output,
+			&internal_models.OutputConfig{Name: "reload"})
+		ro.Fingerprint = fp
+		c.Outputs = append(c.Outputs, ro)
+	}
+	return c
+}
+
+func TestAgent_Reload(t *testing.T) {
+	kept, changed := &reloadInput{}, &reloadInput{}
+	keptOut, changedOut := &reloadOutput{}, &reloadOutput{}
+	a, err := NewAgent(reloadConfig(
+		map[string]*reloadInput{"a": kept, "b": changed},
+		map[string]*reloadOutput{"x": keptOut, "y": changedOut}))
+	assert.NoError(t, err)
+	assert.NoError(t, a.Connect())
+
+	// Start the service inputs as Run does
+	for _, input := range a.Config.Inputs {
+		input.Input.(telegraf.ServiceInput).Start(nil)
+		a.started[input] = true
+	}
+	for _, o := range a.Config.Outputs {
+		o.AddMetric(testutil.TestMetric(1, "cached_"+o.Fingerprint))
+	}
+
+	newInput, newOut := &reloadInput{}, &reloadOutput{}
+	n, err := a.Reload(reloadConfig(
+		map[string]*reloadInput{"a": &reloadInput{}, "c": newInput},
+		map[string]*reloadOutput{"x": &reloadOutput{}, "z": newOut}))
+	assert.NoError(t, err)
+
+	// Unchanged plugins are carried over, the others are stopped and closed
+	assert.True(t, kept.running)
+	assert.False(t, changed.running)
+	assert.False(t, keptOut.closed)
+	assert.True(t, changedOut.closed)
+	for _, input := range n.Config.Inputs {
+		if input.Fingerprint == "a" {
+			assert.Equal(t, kept, input.Input)
+			assert.True(t, n.started[input])
+		} else {
+			assert.False(t, n.started[input])
+		}
+	}
+
+	// Metrics cached by outputs are kept across the reload
+	for _, o := range n.Config.Outputs {
+		metrics := o.TakeMetrics()
+		assert.Len(t, metrics, 1)
+		if o.Fingerprint == "x" {
+			assert.Equal(t, keptOut, o.Output)
+			assert.True(t, n.connected[o])
+			assert.Equal(t, "cached_x", metrics[0].Name())
+		} else {
+			assert.Equal(t, newOut, o.Output)
+			assert.False(t, n.connected[o])
+			assert.Equal(t, "cached_y", metrics[0].Name())
+		}
+	}
+}
+
+type testInput struct{}
+
+func (i *testInput) Description() string  { return "" }
+func (i *testInput) SampleConfig() string { return "" }
+func (i *testInput) Gather(acc telegraf.Accumulator) error {
+	acc.AddFields("test",
+		map[string]interface{}{"value": 1.5, "count": int64(2), "ok": true},
+		map[string]string{"region": "us"},
+		time.Unix(0, 0))
+	return nil
+}
+
+func TestAgent_Test(t *testing.T) {
+	out := &reloadOutput{}
+	c := reloadConfig(nil, map[string]*reloadOutput{"x": out})
+	c.Tags["host"] = "localhost"
+	c.Inputs = append(c.Inputs, &internal_models.RunningInput{
+		Name:   "test",
+		Input:  &testInput{},
+		Config: &internal_models.InputConfig{Name: "test"},
+	})
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, a.test(&buf))
+	assert.Equal(t, `* Plugin: test, Collection 1
+> test,host=localhost,region=us count=2i,ok=true,value=1.5 0
+    time  1970-01-01T00:00:00Z
+    tag   host   = localhost
+    tag   region = us
+    field count  = 2    (int64)
+    field ok     = true (bool)
+    field value  = 1.5  (float64)
+`, buf.String())
+
+	// The outputs are left alone
+	assert.Empty(t, c.Outputs[0].TakeMetrics())
+	assert.False(t, a.connected[c.Outputs[0]])
+}
+
+// hangingOutput blocks its writes until release is closed.
+type hangingOutput struct {
+	reloadOutput
+	release chan struct{}
+	written []telegraf.Metric
+}
+
+func (o *hangingOutput) Write(metrics []telegraf.Metric) error {
+	<-o.release
+	o.written = append(o.written, metrics...)
+	return nil
+}
+
+func TestAgent_ShutdownFlushTimeout(t *testing.T) {
+	out := &hangingOutput{release: make(chan struct{})}
+	defer close(out.release)
+	c := reloadConfig(nil, nil)
+	ro := internal_models.NewRunningOutput("hanging", out,
+		&internal_models.OutputConfig{Name: "hanging"})
+	ro.Quiet = true
+	ro.AddMetric(testutil.TestMetric(1, "cached"))
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	a.finalFlush(a.newPipelines()[0], 50*time.Millisecond)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestAgent_ShutdownRoutesQueuedMetrics(t *testing.T) {
+	out := &hangingOutput{release: make(chan struct{})}
+	close(out.release)
+	c := reloadConfig(nil, nil)
+	ro := internal_models.NewRunningOutput("queued", out,
+		&internal_models.OutputConfig{Name: "queued"})
+	ro.Quiet = true
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	a.metricC <- testutil.TestMetric(1, "queued1")
+	a.metricC <- testutil.TestMetric(2, "queued2")
+	shutdown := make(chan struct{})
+	close(shutdown)
+	assert.NoError(t, a.flusher(shutdown, a.newPipelines()[0]))
+	assert.Len(t, out.written, 2)
+}
+
+func TestAgent_PipelinesIsolated(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	c.Pipelines["isolated"] = &config.PipelineConfig{
+		Name:              "isolated",
+		MetricBufferLimit: 5,
+	}
+	outs := make(map[string]*hangingOutput)
+	for _, pipeline := range []string{"", "isolated"} {
+		out := &hangingOutput{release: make(chan struct{})}
+		close(out.release)
+		outs[pipeline] = out
+		ro := internal_models.NewRunningOutput("out", out,
+			&internal_models.OutputConfig{Name: "out", Pipeline: pipeline})
+		ro.Quiet = true
+		c.Outputs = append(c.Outputs, ro)
+	}
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	pipelines := a.newPipelines()
+	assert.Len(t, pipelines, 2)
+	assert.Equal(t, "isolated", pipelines[1].name)
+	assert.Equal(t, 5, c.Outputs[1].MetricBufferLimit)
+
+	acc := a.newAccumulator(&internal_models.RunningInput{
+		Name:   "in",
+		Config: &internal_models.InputConfig{Name: "in", Pipeline: "isolated"},
+	})
+	acc.AddFields("isolated", map[string]interface{}{"value": 1}, nil)
+	a.metricC <- testutil.TestMetric(1, "default")
+
+	shutdown := make(chan struct{})
+	close(shutdown)
+	for _, p := range pipelines {
+		assert.NoError(t, a.flusher(shutdown, p))
+	}
+	assert.Len(t, outs[""].written, 1)
+	assert.Equal(t, "default", outs[""].written[0].Name())
+	assert.Len(t, outs["isolated"].written, 1)
+	assert.Equal(t, "isolated", outs["isolated"].written[0].Name())
+}
+
+// hangingInput gathers until release is closed, or its context is done if
+// it implements telegraf.ContextInput.
+type hangingInput struct {
+	release chan struct{}
+}
+
+func (i *hangingInput) SampleConfig() string { return "" }
+func (i *hangingInput) Description() string  { return "" }
+
+func (i *hangingInput) Gather(acc telegraf.Accumulator) error {
+	<-i.release
+	return nil
+}
+
+type hangingContextInput struct {
+	hangingInput
+}
+
+func (i *hangingContextInput) GatherContext(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+) error {
+	select {
+	case <-i.release:
+	case <-ctx.Done():
+	}
+	return ctx.Err()
+}
+
+func TestAgent_GatherTimeout(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	c.Agent.GatherTimeout.Duration = 20 * time.Millisecond
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	in := &hangingInput{release: make(chan struct{})}
+	input := &internal_models.RunningInput{
+		Name:   "hanging",
+		Input:  in,
+		Config: &internal_models.InputConfig{Name: "hanging"},
+	}
+	acc := a.newAccumulator(input)
+	assert.Error(t, a.gather(input, acc))
+
+	// The abandoned gather is still running, the input is skipped
+	err = a.gather(input, acc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "still running")
+
+	close(in.release)
+	for !input.StartGather() {
+		time.Sleep(time.Millisecond)
+	}
+	input.EndGather()
+	assert.NoError(t, a.gather(input, acc))
+}
+
+func TestAgent_GatherTimeoutCancels(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	c.Agent.GatherTimeout.Duration = 20 * time.Millisecond
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	in := &hangingContextInput{hangingInput{release: make(chan struct{})}}
+	defer close(in.release)
+	input := &internal_models.RunningInput{
+		Name:   "hanging_context",
+		Input:  in,
+		Config: &internal_models.InputConfig{Name: "hanging_context"},
+	}
+	acc := a.newAccumulator(input)
+	assert.Error(t, a.gather(input, acc))
+
+	// The cancelled gather returns, the next gather runs
+	for !input.StartGather() {
+		time.Sleep(time.Millisecond)
+	}
+	input.EndGather()
+	assert.Error(t, a.gather(input, acc))
+}
+
+func TestAgent_InputGatherTimeout(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	c.Agent.Interval.Duration = time.Minute
+	c.Agent.GatherTimeout.Duration = 20 * time.Second
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	input := &internal_models.RunningInput{
+		Config: &internal_models.InputConfig{Interval: 30 * time.Second},
+	}
+	assert.Equal(t, 20*time.Second, a.gatherTimeout(input))
+
+	// The gather timeout of the input overrides the one of the agent
+	input.Config.GatherTimeout = 5 * time.Second
+	assert.Equal(t, 5*time.Second, a.gatherTimeout(input))
+
+	c.Agent.GatherTimeout.Duration = 0
+	input.Config.GatherTimeout = 0
+	assert.Equal(t, 30*time.Second, a.gatherTimeout(input))
+}
+
+func TestAgent_GlobalTagsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegraf")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tags.json")
+	assert.NoError(t, ioutil.WriteFile(path,
+		[]byte(`{"rack": "1a", "dc": "file"}`), 0644))
+
+	c := reloadConfig(nil, nil)
+	c.Agent.OmitHostname = true
+	c.Tags["dc"] = "us-east-1"
+	c.Tags["env"] = "prod"
+	c.Agent.GlobalTagsFile = path
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		map[string]string{"dc": "file", "env": "prod", "rack": "1a"},
+		a.tags.get())
+
+	metricC := a.metricC
+	input := &internal_models.RunningInput{
+		Name:   "tagged",
+		Config: &internal_models.InputConfig{Name: "tagged"},
+	}
+	acc := a.newAccumulator(input)
+	acc.AddFields("cpu", map[string]interface{}{"value": 1}, nil)
+	assert.Equal(t, "1a", (<-metricC).Tags()["rack"])
+
+	// The refreshed tags apply to the existing accumulators
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"rack": "2b"}`), 0644))
+	assert.NoError(t, a.tags.load())
+	acc.AddFields("cpu", map[string]interface{}{"value": 1}, nil)
+	m := <-metricC
+	assert.Equal(t, "2b", m.Tags()["rack"])
+	assert.Equal(t, "us-east-1", m.Tags()["dc"])
+
+	// An unreadable file keeps the previous tags
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{`), 0644))
+	assert.Error(t, a.tags.load())
+	assert.Equal(t, "2b", a.tags.get()["rack"])
+}
+
+type shardedInput struct {
+	reloadInput
+	owns func(string) bool
+}
+
+func (i *shardedInput) SetShard(owns func(string) bool) { i.owns = owns }
+
+func TestAgent_Shard(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.ShardID, c.Agent.ShardCount = 2, 2
+	_, err := NewAgent(c)
+	assert.Error(t, err)
+
+	input := &shardedInput{}
+	c.Agent.ShardID = 1
+	c.Inputs = append(c.Inputs, &internal_models.RunningInput{
+		Name:   "sharded",
+		Input:  input,
+		Config: &internal_models.InputConfig{Name: "sharded"},
+	})
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+	a.shardInputs()
+	owned := 0
+	for i := 0; i < 100; i++ {
+		target := fmt.Sprintf("target-%d", i)
+		assert.Equal(t, a.shard.Owns(target), input.owns(target))
+		if input.owns(target) {
+			owned++
+		}
+	}
+	assert.True(t, owned > 0 && owned < 100)
+}
+
+// panickingInput panics when gathering, restarted counts its starts.
+type panickingInput struct {
+	reloadInput
+	starts int
+}
+
+func (i *panickingInput) Gather(_ telegraf.Accumulator) error { panic("boom") }
+
+func (i *panickingInput) Start(acc telegraf.Accumulator) error {
+	i.starts++
+	return i.reloadInput.Start(acc)
+}
+
+func TestAgent_WatchdogRestartsInput(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	c.Agent.GatherTimeout.Duration = 20 * time.Millisecond
+	c.Agent.WatchdogFailures = 2
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	in := &hangingInput{release: make(chan struct{})}
+	defer close(in.release)
+	fresh := &reloadInput{}
+	input := &internal_models.RunningInput{
+		Name:   "watched",
+		Input:  in,
+		Config: &internal_models.InputConfig{Name: "watched"},
+		New:    func() (telegraf.Input, error) { return fresh, nil },
+	}
+	restarts := selfstat.Register("gather", "restarts",
+		map[string]string{"input": "watched"})
+	before := restarts.Get()
+	acc := a.newAccumulator(input)
+
+	// The gather times out, then is skipped while the abandoned gather runs
+	assert.Error(t, a.gather(input, acc))
+	assert.Equal(t, in, input.Input)
+	assert.Error(t, a.gather(input, acc))
+	assert.Equal(t, fresh, input.Input)
+	assert.Equal(t, before+1, restarts.Get())
+
+	// The fresh instance gathers despite the abandoned gather
+	assert.NoError(t, a.gather(input, acc))
+	assert.NoError(t, a.gather(input, acc))
+}
+
+func TestAgent_WatchdogRestartsServiceInput(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	c.Agent.WatchdogFailures = 2
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	in := &panickingInput{}
+	input := &internal_models.RunningInput{
+		Name:   "panicking",
+		Input:  in,
+		Config: &internal_models.InputConfig{Name: "panicking"},
+	}
+	acc := a.newAccumulator(input)
+	assert.NoError(t, in.Start(acc))
+	a.started[input] = true
+
+	for i := 0; i < 4; i++ {
+		assert.Error(t, a.gather(input, acc))
+	}
+	assert.Equal(t, in, input.Input)
+	assert.Equal(t, 3, in.starts)
+	assert.True(t, in.running)
+}
+
+// closingInput gathers like hangingInput, closes counts its closes.
+type closingInput struct {
+	hangingInput
+	closes int
+}
+
+func (i *closingInput) Close() error { i.closes++; return nil }
+
+func closingConfig(inputs map[string]*closingInput) *config.Config {
+	c := reloadConfig(nil, nil)
+	for fp, input := range inputs {
+		c.Inputs = append(c.Inputs, &internal_models.RunningInput{
+			Name:        "closing",
+			Input:       input,
+			Config:      &internal_models.InputConfig{Name: "closing"},
+			Fingerprint: fp,
+		})
+	}
+	return c
+}
+
+func TestAgent_ClosesDiscardedInputs(t *testing.T) {
+	c := closingConfig(nil)
+	c.Agent.GatherTimeout.Duration = 20 * time.Millisecond
+	c.Agent.WatchdogFailures = 1
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	// The instance replaced by the watchdog is closed
+	in := &closingInput{hangingInput: hangingInput{release: make(chan struct{})}}
+	defer close(in.release)
+	fresh := &closingInput{}
+	input := &internal_models.RunningInput{
+		Name:   "closing",
+		Input:  in,
+		Config: &internal_models.InputConfig{Name: "closing"},
+		New:    func() (telegraf.Input, error) { return fresh, nil },
+	}
+	assert.Error(t, a.gather(input, a.newAccumulator(input)))
+	assert.Equal(t, fresh, input.Input)
+	assert.Equal(t, 1, in.closes)
+	assert.Equal(t, 0, fresh.closes)
+
+	// So are the inputs removed by a reload, and the kept ones when the
+	// agent exits
+	kept, removed := &closingInput{}, &closingInput{}
+	a, err = NewAgent(closingConfig(
+		map[string]*closingInput{"a": kept, "b": removed}))
+	assert.NoError(t, err)
+	n, err := a.Reload(closingConfig(
+		map[string]*closingInput{"a": &closingInput{}}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, kept.closes)
+	assert.Equal(t, 1, removed.closes)
+
+	assert.NoError(t, n.Close())
+	assert.Equal(t, 1, kept.closes)
+	assert.Equal(t, 1, removed.closes)
+}
+
+func TestAgent_StartupDelay(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+	a.runStart = time.Now()
+
+	input := &internal_models.RunningInput{
+		Name:  "delayed",
+		Input: &reloadInput{},
+		Config: &internal_models.InputConfig{
+			Name:         "delayed",
+			StartupDelay: 30 * time.Millisecond,
+		},
+		Log: logger.New("inputs.delayed", logger.LevelUnset),
+	}
+	a.Config.Inputs = []*internal_models.RunningInput{input}
+	assert.NoError(t, a.startServices())
+	assert.False(t, a.started[input])
+
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, a.startServices())
+	assert.True(t, a.started[input])
+	assert.True(t, input.Input.(*reloadInput).running)
+}
+
+func TestAgent_WaitFor(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	a, err := NewAgent(reloadConfig(nil, nil))
+	assert.NoError(t, err)
+	input := &internal_models.RunningInput{
+		Name:  "waiting",
+		Input: &reloadInput{},
+		Config: &internal_models.InputConfig{
+			Name:    "waiting",
+			WaitFor: []string{"tcp://" + address},
+		},
+		Log: logger.New("inputs.waiting", logger.LevelUnset),
+	}
+	assert.False(t, a.ready(input))
+
+	l, err = net.Listen("tcp", address)
+	assert.NoError(t, err)
+	assert.True(t, a.ready(input))
+	// The input stays ready once the address accepted a connection
+	assert.NoError(t, l.Close())
+	assert.True(t, a.ready(input))
+
+	for _, invalid := range []string{"udp://localhost:8125", "localhost"} {
+		_, _, err := internal_models.ParseWaitFor(invalid)
+		assert.Error(t, err, invalid)
+	}
+	network, addr, err := internal_models.ParseWaitFor("unix:///run/x.sock")
+	assert.NoError(t, err)
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "/run/x.sock", addr)
+}
+
+func TestAgent_BufferFullBlocks(t *testing.T) {
+	out := &hangingOutput{release: make(chan struct{})}
+	c := reloadConfig(nil, nil)
+	ro := internal_models.NewRunningOutput("blocking", out,
+		&internal_models.OutputConfig{
+			Name:               "blocking",
+			BufferFullStrategy: internal_models.BufferBlock,
+		})
+	ro.Quiet = true
+	ro.MetricBufferLimit = 2
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		a.metricC <- testutil.TestMetric(i, "blocked")
+	}
+
+	shutdown := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- a.flusher(shutdown, a.newPipelines()[0])
+	}()
+
+	// The full buffer is being written, the other metrics stay queued
+	time.Sleep(300 * time.Millisecond)
+	assert.Len(t, a.metricC, 3)
+
+	close(out.release)
+	for len(a.metricC) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(shutdown)
+	assert.NoError(t, <-done)
+	assert.Len(t, out.written, 5)
+}
+
+func TestAgent_PipelineBlocked(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	ro := internal_models.NewRunningOutput("blocking", &reloadOutput{},
+		&internal_models.OutputConfig{
+			Name:               "blocking",
+			BufferFullStrategy: internal_models.BufferBlock,
+		})
+	ro.MetricBufferLimit = 1
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	assert.False(t, a.pipelineBlocked(""))
+	ro.AddMetric(testutil.TestMetric(1, "blocked"))
+	assert.True(t, a.pipelineBlocked(""))
+	assert.False(t, a.pipelineBlocked("other"))
+}
+
+func TestAgent_ReloadWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegraf")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	newOutput := func(fingerprint string) (*internal_models.RunningOutput, *hangingOutput) {
+		out := &hangingOutput{release: make(chan struct{})}
+		close(out.release)
+		ro := internal_models.NewRunningOutput("wal", out,
+			&internal_models.OutputConfig{Name: "wal", WALDir: dir})
+		ro.Fingerprint = fingerprint
+		ro.Quiet = true
+		ro.MetricBufferLimit = 1
+		return ro, out
+	}
+
+	c := reloadConfig(nil, nil)
+	old, _ := newOutput("old")
+	c.Outputs = append(c.Outputs, old)
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+	assert.NoError(t, a.Connect())
+	for i := 0; i < 3; i++ {
+		old.AddMetric(testutil.TestMetric(i, "spooled"))
+	}
+	assert.True(t, old.WAL.Size() > 0)
+
+	// The WAL of the changed output is opened once the old one is closed
+	c = reloadConfig(nil, nil)
+	changed, out := newOutput("changed")
+	c.Outputs = append(c.Outputs, changed)
+	assert.Nil(t, changed.WAL)
+	n, err := a.Reload(c)
+	assert.NoError(t, err)
+	assert.NotNil(t, changed.WAL)
+	assert.NoError(t, n.Connect())
+
+	assert.NoError(t, changed.Write())
+	assert.Len(t, out.written, 3)
+	assert.Equal(t, int64(0), changed.WAL.Size())
+}
+
+// hangingServiceInput is a service input whose gathers hang until release
+// is closed.
+type hangingServiceInput struct {
+	hangingInput
+	starts int
+}
+
+func (i *hangingServiceInput) Start(_ telegraf.Accumulator) error {
+	i.starts++
+	return nil
+}
+
+func (i *hangingServiceInput) Stop() {}
+
+func TestAgent_WatchdogRestartsStuckServiceInput(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	c.Agent.GatherTimeout.Duration = 20 * time.Millisecond
+	c.Agent.WatchdogFailures = 2
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	in := &hangingServiceInput{hangingInput: hangingInput{
+		release: make(chan struct{}),
+	}}
+	defer close(in.release)
+	input := &internal_models.RunningInput{
+		Name:   "stuck",
+		Input:  in,
+		Config: &internal_models.InputConfig{Name: "stuck"},
+	}
+	acc := a.newAccumulator(input)
+	assert.NoError(t, in.Start(acc))
+	a.started[input] = true
+
+	assert.Error(t, a.gather(input, acc))
+	err = a.gather(input, acc)
+	assert.Contains(t, err.Error(), "still running")
+	assert.Equal(t, 2, in.starts)
+
+	// The restarted input gathers again instead of being skipped
+	err = a.gather(input, acc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/cluster"
+	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// 1 while the agent is the leader of its cluster, 0 otherwise
+var clusterLeader = selfstat.RegisterGauge("agent", "cluster_leader", nil)
+
+// clusterMember is the membership of the agent in the cluster of the agents
+// sharing its cluster lock, of which only the leader runs the singleton
+// inputs. It is kept across reloads, like the leadership.
+type clusterMember struct {
+	url     string
+	id      string
+	ttl     time.Duration
+	elector cluster.Elector
+
+	mu     sync.Mutex
+	leader bool
+}
+
+func newClusterMember(c *config.AgentConfig) (*clusterMember, error) {
+	id := c.ClusterNodeID
+	if id == "" {
+		id = c.Hostname
+	}
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		id = hostname
+	}
+	elector, err := cluster.NewElector(c.Cluster, id, c.ClusterTTL.Duration)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterMember{
+		url:     c.Cluster,
+		id:      id,
+		ttl:     c.ClusterTTL.Duration,
+		elector: elector,
+	}, nil
+}
+
+// isLeader returns whether the agent is the leader, which it always is
+// without a cluster.
+func (m *clusterMember) isLeader() bool {
+	if m == nil {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leader
+}
+
+// sameCluster returns whether m is the membership of the same cluster as o.
+func (m *clusterMember) sameCluster(o *clusterMember) bool {
+	return m != nil && o != nil &&
+		m.url == o.url && m.id == o.id && m.ttl == o.ttl
+}
+
+// campaign campaigns for the leadership, stepping down if the lock can't be
+// reached since another agent may take it over once it expires.
+func (m *clusterMember) campaign() {
+	leader, err := m.elector.Campaign()
+	if err != nil {
+		log.Printf("Error campaigning for the leadership of cluster %s: %s\n",
+			m.url, err)
+		leader = false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case leader && !m.leader:
+		log.Printf("Elected leader of cluster %s as %s, running the singleton "+
+			"inputs\n", m.url, m.id)
+		clusterLeader.Set(1)
+	case !leader && m.leader:
+		log.Printf("WARNING: no longer the leader of cluster %s, stopping the "+
+			"singleton inputs\n", m.url)
+		clusterLeader.Set(0)
+	}
+	m.leader = leader
+}
+
+// resign releases the leadership, letting another agent take over without
+// waiting for the lock to expire.
+func (m *clusterMember) resign() {
+	if err := m.elector.Resign(); err != nil {
+		log.Printf("Error resigning the leadership of cluster %s: %s\n",
+			m.url, err)
+	}
+	m.mu.Lock()
+	m.leader = false
+	m.mu.Unlock()
+	clusterLeader.Set(0)
+}
+
+// runsHere returns whether input runs on this agent, singleton inputs only
+// run on the leader.
+func (a *Agent) runsHere(input *internal_models.RunningInput) bool {
+	return !input.Config.Singleton || a.cluster.isLeader()
+}
+
+// elect campaigns for the leadership, then starts the singleton service
+// inputs if the agent is the leader and stops them otherwise.
+func (a *Agent) elect() {
+	a.cluster.campaign()
+	a.startedMu.Lock()
+	defer a.startedMu.Unlock()
+	for _, input := range a.Config.Inputs {
+		p, ok := input.Input.(telegraf.ServiceInput)
+		if !ok || !input.Config.Singleton {
+			continue
+		}
+		switch {
+		case a.runsHere(input) && !a.started[input] && a.ready(input):
+			if err := p.Start(a.newAccumulator(input)); err != nil {
+				input.Log.Errorf("Service failed to start: %s", err)
+				continue
+			}
+			a.started[input] = true
+		case !a.runsHere(input) && a.started[input]:
+			a.stopInput(input)
+		}
+	}
+}
+
+// campaign renews the leadership, or campaigns for it, three times per
+// cluster_ttl until shutdown is closed.
+func (a *Agent) campaign(shutdown chan struct{}) {
+	ticker := time.NewTicker(a.cluster.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+			a.elect()
+		}
+	}
+}
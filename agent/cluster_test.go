@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeElector struct {
+	leader   bool
+	err      error
+	resigned bool
+}
+
+func (e *fakeElector) Campaign() (bool, error) { return e.leader, e.err }
+func (e *fakeElector) Resign() error           { e.resigned = true; return nil }
+
+func TestAgent_Singleton(t *testing.T) {
+	singleton, other := &reloadInput{}, &reloadInput{}
+	c := reloadConfig(
+		map[string]*reloadInput{"a": singleton, "b": other}, nil)
+	var input *internal_models.RunningInput
+	for _, i := range c.Inputs {
+		if i.Input == singleton {
+			i.Config.Singleton = true
+			input = i
+		}
+	}
+	a, err := NewAgent(c)
+	assert.NoError(t, err)
+
+	// Without a cluster the agent is the leader
+	assert.True(t, a.runsHere(input))
+
+	e := &fakeElector{}
+	a.cluster = &clusterMember{url: "fake://", elector: e}
+	a.elect()
+	assert.False(t, a.runsHere(input))
+	assert.False(t, singleton.running)
+
+	e.leader = true
+	a.elect()
+	assert.True(t, a.runsHere(input))
+	assert.True(t, singleton.running)
+	assert.False(t, other.running)
+
+	// The agent steps down when the lock can't be reached
+	e.err = fmt.Errorf("connection refused")
+	a.elect()
+	assert.False(t, a.runsHere(input))
+	assert.False(t, singleton.running)
+
+	// A reload leaving the cluster resigns the leadership
+	e.err = nil
+	a.elect()
+	assert.True(t, a.cluster.isLeader())
+	n, err := a.Reload(reloadConfig(nil, nil))
+	assert.NoError(t, err)
+	assert.Nil(t, n.cluster)
+	assert.True(t, e.resigned)
+	assert.False(t, a.cluster.isLeader())
+}
@@ -0,0 +1,295 @@
+package agent
+
+//go:generate protoc --go_out=plugins=grpc:control -Icontrol control/control.proto
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/influxdata/telegraf/agent/control"
+	"github.com/influxdata/telegraf/internal/models"
+)
+
+// controlServer implements the control API of the agent.
+type controlServer struct {
+	agent *Agent
+}
+
+// controlPlugin is a plugin selected by a control request.
+type controlPlugin struct {
+	id     string
+	input  *internal_models.RunningInput
+	output *internal_models.RunningOutput
+}
+
+func (p controlPlugin) state() *internal_models.PluginState {
+	if p.input != nil {
+		return &p.input.PluginState
+	}
+	return &p.output.PluginState
+}
+
+// listenControl listens on address for the control API, a unix socket as
+// "unix:///var/run/telegraf/control.sock" or a loopback address: the API has
+// no authentication.
+func listenControl(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, "unix://") {
+		path := strings.TrimPrefix(address, "unix://")
+		// The socket left by an agent which did not stop
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("%s is neither a loopback address nor a unix "+
+			"socket, the control API has no authentication", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// serveControl serves the control API on l until the returned server is
+// stopped.
+func (a *Agent) serveControl(l net.Listener) *grpc.Server {
+	s := grpc.NewServer()
+	control.RegisterControlServer(s, &controlServer{agent: a})
+	go func() {
+		// Serve returns once the server is stopped
+		s.Serve(l)
+	}()
+	log.Printf("Serving control API on %s\n", l.Addr())
+	return s
+}
+
+// plugins returns the inputs and outputs of the agent, identified by kind,
+// name and index among the plugins of the same name.
+func (c *controlServer) plugins() []controlPlugin {
+	var plugins []controlPlugin
+	seen := make(map[string]int)
+	id := func(kind, name string) string {
+		prefix := kind + "." + name
+		n := seen[prefix]
+		seen[prefix]++
+		return fmt.Sprintf("%s#%d", prefix, n)
+	}
+	for _, input := range c.agent.Config.Inputs {
+		plugins = append(plugins, controlPlugin{
+			id:    id("inputs", input.Name),
+			input: input,
+		})
+	}
+	for _, o := range c.agent.outputs() {
+		plugins = append(plugins, controlPlugin{
+			id:     id("outputs", o.Name),
+			output: o,
+		})
+	}
+	return plugins
+}
+
+// selectPlugins returns the plugins with the identifier id, or all of the
+// plugins of that kind and name if id has no index. All the plugins are
+// returned if id is empty and all is set.
+func (c *controlServer) selectPlugins(id string, all bool) ([]controlPlugin, error) {
+	if id == "" && !all {
+		return nil, status.Errorf(codes.InvalidArgument, "no plugin id given")
+	}
+
+	var selected []controlPlugin
+	for _, p := range c.plugins() {
+		if id == "" || p.id == id || strings.HasPrefix(p.id, id+"#") {
+			selected = append(selected, p)
+		}
+	}
+	if len(selected) == 0 && id != "" {
+		return nil, status.Errorf(codes.NotFound, "no plugin %s", id)
+	}
+	return selected, nil
+}
+
+func (c *controlServer) ListPlugins(
+	ctx context.Context,
+	req *control.ListPluginsRequest,
+) (*control.ListPluginsResponse, error) {
+	resp := &control.ListPluginsResponse{}
+	for _, p := range c.plugins() {
+		plugin := &control.Plugin{
+			Id:     p.id,
+			Paused: p.state().Paused(),
+		}
+		if p.input != nil {
+			plugin.Kind = "inputs"
+			plugin.Name = p.input.Name
+			if last := p.input.LastGather(); !last.IsZero() {
+				plugin.LastGather = last.UnixNano()
+			}
+		} else {
+			plugin.Kind = "outputs"
+			plugin.Name = p.output.Name
+			plugin.FailedWrites = int64(p.output.FailedWrites())
+		}
+		resp.Plugins = append(resp.Plugins, plugin)
+	}
+	return resp, nil
+}
+
+func (c *controlServer) Gather(
+	ctx context.Context,
+	req *control.PluginRequest,
+) (*control.GatherResponse, error) {
+	plugins, err := c.selectPlugins(req.Id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &control.GatherResponse{}
+	for _, p := range plugins {
+		if p.input == nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"%s is not an input", p.id)
+		}
+	}
+	for _, p := range plugins {
+		resp.Ids = append(resp.Ids, p.id)
+		if err := c.agent.gatherNow(p.input); err != nil {
+			resp.Errors = append(resp.Errors, &control.PluginError{
+				Id:      p.id,
+				Time:    p.input.LastGather().UnixNano(),
+				Message: err.Error(),
+			})
+		}
+	}
+	return resp, nil
+}
+
+func (c *controlServer) Pause(
+	ctx context.Context,
+	req *control.PluginRequest,
+) (*control.PluginResponse, error) {
+	return c.setPaused(req.Id, true)
+}
+
+func (c *controlServer) Resume(
+	ctx context.Context,
+	req *control.PluginRequest,
+) (*control.PluginResponse, error) {
+	return c.setPaused(req.Id, false)
+}
+
+func (c *controlServer) setPaused(id string, paused bool) (*control.PluginResponse, error) {
+	plugins, err := c.selectPlugins(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &control.PluginResponse{}
+	for _, p := range plugins {
+		p.state().SetPaused(paused)
+		resp.Ids = append(resp.Ids, p.id)
+	}
+	return resp, nil
+}
+
+func (c *controlServer) Errors(
+	ctx context.Context,
+	req *control.PluginRequest,
+) (*control.ErrorsResponse, error) {
+	plugins, err := c.selectPlugins(req.Id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &control.ErrorsResponse{}
+	for _, p := range plugins {
+		for _, e := range p.state().RecentErrors() {
+			resp.Errors = append(resp.Errors, &control.PluginError{
+				Id:      p.id,
+				Time:    e.Time.UnixNano(),
+				Message: e.Message,
+			})
+		}
+	}
+	return resp, nil
+}
+
+func (c *controlServer) AddOutput(
+	ctx context.Context,
+	req *control.AddOutputRequest,
+) (*control.PluginResponse, error) {
+	if !c.agent.Config.Agent.ControlOutputs {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"adding outputs is not allowed, see control_outputs")
+	}
+	outputs, err := c.agent.Config.LoadOutputs([]byte(req.Config))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if len(outputs) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "no outputs given")
+	}
+
+	added := make(map[*internal_models.RunningOutput]bool)
+	for _, o := range outputs {
+		if err := c.agent.AddOutput(o); err != nil {
+			// The outputs are added all together or not at all
+			for o := range added {
+				c.agent.RemoveOutput(o)
+			}
+			return nil, status.Errorf(codes.FailedPrecondition, "%s", err)
+		}
+		added[o] = true
+	}
+
+	resp := &control.PluginResponse{}
+	for _, p := range c.plugins() {
+		if added[p.output] {
+			resp.Ids = append(resp.Ids, p.id)
+		}
+	}
+	return resp, nil
+}
+
+func (c *controlServer) RemoveOutput(
+	ctx context.Context,
+	req *control.PluginRequest,
+) (*control.PluginResponse, error) {
+	plugins, err := c.selectPlugins(req.Id, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range plugins {
+		if p.output == nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"%s is not an output", p.id)
+		}
+	}
+
+	resp := &control.PluginResponse{}
+	for _, p := range plugins {
+		if err := c.agent.RemoveOutput(p.output); err != nil {
+			return resp, status.Errorf(codes.FailedPrecondition, "%s", err)
+		}
+		resp.Ids = append(resp.Ids, p.id)
+	}
+	return resp, nil
+}
+
+// gatherNow gathers input once, outside of its schedule.
+func (a *Agent) gatherNow(input *internal_models.RunningInput) error {
+	defer panicRecover(input)
+
+	acc := a.newAccumulator(input)
+	return a.gather(input, acc)
+}
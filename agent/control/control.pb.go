@@ -0,0 +1,812 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: control.proto
+
+package control
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Plugin struct {
+	// Identifier of the plugin, like "inputs.cpu#0", the index counting the
+	// plugins with the same name
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// "inputs" or "outputs"
+	Kind   string `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Name   string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Paused bool   `protobuf:"varint,4,opt,name=paused,proto3" json:"paused,omitempty"`
+	// Time the input last finished gathering in unix nanoseconds, 0 if never
+	LastGather int64 `protobuf:"varint,5,opt,name=last_gather,json=lastGather,proto3" json:"last_gather,omitempty"`
+	// Number of writes of the output failed since the last successful one
+	FailedWrites         int64    `protobuf:"varint,6,opt,name=failed_writes,json=failedWrites,proto3" json:"failed_writes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Plugin) Reset()         { *m = Plugin{} }
+func (m *Plugin) String() string { return proto.CompactTextString(m) }
+func (*Plugin) ProtoMessage()    {}
+func (*Plugin) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{0}
+}
+
+func (m *Plugin) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Plugin.Unmarshal(m, b)
+}
+func (m *Plugin) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Plugin.Marshal(b, m, deterministic)
+}
+func (m *Plugin) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Plugin.Merge(m, src)
+}
+func (m *Plugin) XXX_Size() int {
+	return xxx_messageInfo_Plugin.Size(m)
+}
+func (m *Plugin) XXX_DiscardUnknown() {
+	xxx_messageInfo_Plugin.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Plugin proto.InternalMessageInfo
+
+func (m *Plugin) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Plugin) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *Plugin) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Plugin) GetPaused() bool {
+	if m != nil {
+		return m.Paused
+	}
+	return false
+}
+
+func (m *Plugin) GetLastGather() int64 {
+	if m != nil {
+		return m.LastGather
+	}
+	return 0
+}
+
+func (m *Plugin) GetFailedWrites() int64 {
+	if m != nil {
+		return m.FailedWrites
+	}
+	return 0
+}
+
+type PluginError struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Time of the error in unix nanoseconds
+	Time                 int64    `protobuf:"varint,2,opt,name=time,proto3" json:"time,omitempty"`
+	Message              string   `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PluginError) Reset()         { *m = PluginError{} }
+func (m *PluginError) String() string { return proto.CompactTextString(m) }
+func (*PluginError) ProtoMessage()    {}
+func (*PluginError) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{1}
+}
+
+func (m *PluginError) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PluginError.Unmarshal(m, b)
+}
+func (m *PluginError) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PluginError.Marshal(b, m, deterministic)
+}
+func (m *PluginError) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PluginError.Merge(m, src)
+}
+func (m *PluginError) XXX_Size() int {
+	return xxx_messageInfo_PluginError.Size(m)
+}
+func (m *PluginError) XXX_DiscardUnknown() {
+	xxx_messageInfo_PluginError.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PluginError proto.InternalMessageInfo
+
+func (m *PluginError) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *PluginError) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *PluginError) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type ListPluginsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListPluginsRequest) Reset()         { *m = ListPluginsRequest{} }
+func (m *ListPluginsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListPluginsRequest) ProtoMessage()    {}
+func (*ListPluginsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{2}
+}
+
+func (m *ListPluginsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPluginsRequest.Unmarshal(m, b)
+}
+func (m *ListPluginsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPluginsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListPluginsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPluginsRequest.Merge(m, src)
+}
+func (m *ListPluginsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListPluginsRequest.Size(m)
+}
+func (m *ListPluginsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPluginsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPluginsRequest proto.InternalMessageInfo
+
+type ListPluginsResponse struct {
+	Plugins              []*Plugin `protobuf:"bytes,1,rep,name=plugins,proto3" json:"plugins,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListPluginsResponse) Reset()         { *m = ListPluginsResponse{} }
+func (m *ListPluginsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListPluginsResponse) ProtoMessage()    {}
+func (*ListPluginsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{3}
+}
+
+func (m *ListPluginsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPluginsResponse.Unmarshal(m, b)
+}
+func (m *ListPluginsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPluginsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListPluginsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPluginsResponse.Merge(m, src)
+}
+func (m *ListPluginsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListPluginsResponse.Size(m)
+}
+func (m *ListPluginsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPluginsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPluginsResponse proto.InternalMessageInfo
+
+func (m *ListPluginsResponse) GetPlugins() []*Plugin {
+	if m != nil {
+		return m.Plugins
+	}
+	return nil
+}
+
+type PluginRequest struct {
+	// Identifier of a plugin, or "<kind>.<name>" to select all the plugins
+	// with that name
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PluginRequest) Reset()         { *m = PluginRequest{} }
+func (m *PluginRequest) String() string { return proto.CompactTextString(m) }
+func (*PluginRequest) ProtoMessage()    {}
+func (*PluginRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{4}
+}
+
+func (m *PluginRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PluginRequest.Unmarshal(m, b)
+}
+func (m *PluginRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PluginRequest.Marshal(b, m, deterministic)
+}
+func (m *PluginRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PluginRequest.Merge(m, src)
+}
+func (m *PluginRequest) XXX_Size() int {
+	return xxx_messageInfo_PluginRequest.Size(m)
+}
+func (m *PluginRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PluginRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PluginRequest proto.InternalMessageInfo
+
+func (m *PluginRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type PluginResponse struct {
+	// Identifiers of the selected plugins
+	Ids                  []string `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PluginResponse) Reset()         { *m = PluginResponse{} }
+func (m *PluginResponse) String() string { return proto.CompactTextString(m) }
+func (*PluginResponse) ProtoMessage()    {}
+func (*PluginResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{5}
+}
+
+func (m *PluginResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PluginResponse.Unmarshal(m, b)
+}
+func (m *PluginResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PluginResponse.Marshal(b, m, deterministic)
+}
+func (m *PluginResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PluginResponse.Merge(m, src)
+}
+func (m *PluginResponse) XXX_Size() int {
+	return xxx_messageInfo_PluginResponse.Size(m)
+}
+func (m *PluginResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PluginResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PluginResponse proto.InternalMessageInfo
+
+func (m *PluginResponse) GetIds() []string {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+type GatherResponse struct {
+	Ids                  []string       `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	Errors               []*PluginError `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *GatherResponse) Reset()         { *m = GatherResponse{} }
+func (m *GatherResponse) String() string { return proto.CompactTextString(m) }
+func (*GatherResponse) ProtoMessage()    {}
+func (*GatherResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{6}
+}
+
+func (m *GatherResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GatherResponse.Unmarshal(m, b)
+}
+func (m *GatherResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GatherResponse.Marshal(b, m, deterministic)
+}
+func (m *GatherResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GatherResponse.Merge(m, src)
+}
+func (m *GatherResponse) XXX_Size() int {
+	return xxx_messageInfo_GatherResponse.Size(m)
+}
+func (m *GatherResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GatherResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GatherResponse proto.InternalMessageInfo
+
+func (m *GatherResponse) GetIds() []string {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+func (m *GatherResponse) GetErrors() []*PluginError {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+type ErrorsResponse struct {
+	Errors               []*PluginError `protobuf:"bytes,1,rep,name=errors,proto3" json:"errors,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ErrorsResponse) Reset()         { *m = ErrorsResponse{} }
+func (m *ErrorsResponse) String() string { return proto.CompactTextString(m) }
+func (*ErrorsResponse) ProtoMessage()    {}
+func (*ErrorsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{7}
+}
+
+func (m *ErrorsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ErrorsResponse.Unmarshal(m, b)
+}
+func (m *ErrorsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ErrorsResponse.Marshal(b, m, deterministic)
+}
+func (m *ErrorsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ErrorsResponse.Merge(m, src)
+}
+func (m *ErrorsResponse) XXX_Size() int {
+	return xxx_messageInfo_ErrorsResponse.Size(m)
+}
+func (m *ErrorsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ErrorsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ErrorsResponse proto.InternalMessageInfo
+
+func (m *ErrorsResponse) GetErrors() []*PluginError {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+type AddOutputRequest struct {
+	// TOML config of the outputs
+	Config               string   `protobuf:"bytes,1,opt,name=config,proto3" json:"config,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AddOutputRequest) Reset()         { *m = AddOutputRequest{} }
+func (m *AddOutputRequest) String() string { return proto.CompactTextString(m) }
+func (*AddOutputRequest) ProtoMessage()    {}
+func (*AddOutputRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c5120591600887d, []int{8}
+}
+
+func (m *AddOutputRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AddOutputRequest.Unmarshal(m, b)
+}
+func (m *AddOutputRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AddOutputRequest.Marshal(b, m, deterministic)
+}
+func (m *AddOutputRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AddOutputRequest.Merge(m, src)
+}
+func (m *AddOutputRequest) XXX_Size() int {
+	return xxx_messageInfo_AddOutputRequest.Size(m)
+}
+func (m *AddOutputRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AddOutputRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AddOutputRequest proto.InternalMessageInfo
+
+func (m *AddOutputRequest) GetConfig() string {
+	if m != nil {
+		return m.Config
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*Plugin)(nil), "control.Plugin")
+	proto.RegisterType((*PluginError)(nil), "control.PluginError")
+	proto.RegisterType((*ListPluginsRequest)(nil), "control.ListPluginsRequest")
+	proto.RegisterType((*ListPluginsResponse)(nil), "control.ListPluginsResponse")
+	proto.RegisterType((*PluginRequest)(nil), "control.PluginRequest")
+	proto.RegisterType((*PluginResponse)(nil), "control.PluginResponse")
+	proto.RegisterType((*GatherResponse)(nil), "control.GatherResponse")
+	proto.RegisterType((*ErrorsResponse)(nil), "control.ErrorsResponse")
+	proto.RegisterType((*AddOutputRequest)(nil), "control.AddOutputRequest")
+}
+
+func init() {
+	proto.RegisterFile("control.proto", fileDescriptor_0c5120591600887d)
+}
+
+var fileDescriptor_0c5120591600887d = []byte{
+	// 440 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0x5d, 0x6f, 0xd3, 0x30,
+	0x14, 0x6d, 0x9a, 0x2d, 0xa5, 0xb7, 0x6b, 0x99, 0x2e, 0x53, 0x31, 0x1f, 0xd2, 0x22, 0xf3, 0x12,
+	0x10, 0xda, 0xc3, 0x78, 0x03, 0x09, 0x51, 0x21, 0x84, 0x04, 0x48, 0x54, 0x7e, 0xe1, 0x71, 0x0a,
+	0xb3, 0x17, 0x2c, 0x92, 0x38, 0xc4, 0x0e, 0xfc, 0x1b, 0x7e, 0x12, 0xbf, 0x09, 0xc5, 0x76, 0x32,
+	0x12, 0x0a, 0x2a, 0xbc, 0xdd, 0x7b, 0x72, 0xee, 0xf1, 0xb9, 0xc7, 0x56, 0x60, 0x79, 0xa9, 0x4a,
+	0x53, 0xab, 0xfc, 0xac, 0xaa, 0x95, 0x51, 0x38, 0xf3, 0x2d, 0xfd, 0x1e, 0x40, 0xb4, 0xcd, 0x9b,
+	0x4c, 0x96, 0xb8, 0x82, 0xa9, 0xe4, 0x24, 0x88, 0x83, 0x64, 0xce, 0xa6, 0x92, 0x23, 0xc2, 0xc1,
+	0x67, 0x59, 0x72, 0x32, 0xb5, 0x88, 0xad, 0x5b, 0xac, 0x4c, 0x0b, 0x41, 0x42, 0x87, 0xb5, 0x35,
+	0xae, 0x21, 0xaa, 0xd2, 0x46, 0x0b, 0x4e, 0x0e, 0xe2, 0x20, 0xb9, 0xc1, 0x7c, 0x87, 0xa7, 0xb0,
+	0xc8, 0x53, 0x6d, 0x2e, 0xb2, 0xd4, 0x7c, 0x12, 0x35, 0x39, 0x8c, 0x83, 0x24, 0x64, 0xd0, 0x42,
+	0xaf, 0x2d, 0x82, 0x0f, 0x60, 0x79, 0x95, 0xca, 0x5c, 0xf0, 0x8b, 0x6f, 0xb5, 0x34, 0x42, 0x93,
+	0xc8, 0x52, 0x8e, 0x1c, 0xf8, 0xc1, 0x62, 0xf4, 0x2d, 0x2c, 0x9c, 0xbf, 0x57, 0x75, 0xad, 0xea,
+	0x5d, 0x26, 0x8d, 0x2c, 0x84, 0x35, 0x19, 0x32, 0x5b, 0x23, 0x81, 0x59, 0x21, 0xb4, 0x4e, 0xb3,
+	0xce, 0x67, 0xd7, 0xd2, 0x13, 0xc0, 0x77, 0x52, 0x1b, 0x27, 0xa8, 0x99, 0xf8, 0xd2, 0x08, 0x6d,
+	0xe8, 0x0b, 0xb8, 0x35, 0x40, 0x75, 0xa5, 0x4a, 0x2d, 0xf0, 0x21, 0xcc, 0x2a, 0x07, 0x91, 0x20,
+	0x0e, 0x93, 0xc5, 0xf9, 0xcd, 0xb3, 0x2e, 0x44, 0x47, 0x65, 0xdd, 0x77, 0x7a, 0x0a, 0x4b, 0x0f,
+	0x39, 0xc9, 0xb1, 0x4d, 0x4a, 0x61, 0xd5, 0x11, 0xbc, 0xfa, 0x31, 0x84, 0x92, 0x3b, 0xe5, 0x39,
+	0x6b, 0x4b, 0xba, 0x85, 0x95, 0x0b, 0xe6, 0xcf, 0x1c, 0x7c, 0x0c, 0x91, 0x68, 0x73, 0xd0, 0x64,
+	0x6a, 0x2d, 0x9d, 0x8c, 0x2c, 0xd9, 0x90, 0x98, 0xe7, 0xd0, 0xe7, 0xb0, 0xb2, 0xc0, 0xf5, 0x4e,
+	0xd7, 0xf3, 0xc1, 0x1e, 0xf3, 0x8f, 0xe0, 0x78, 0xc3, 0xf9, 0xfb, 0xc6, 0x54, 0x8d, 0xe9, 0x36,
+	0x5b, 0x43, 0x74, 0xa9, 0xca, 0x2b, 0x99, 0xf9, 0xed, 0x7c, 0x77, 0xfe, 0x23, 0x84, 0xd9, 0x4b,
+	0xa7, 0x85, 0x6f, 0x60, 0xf1, 0x4b, 0xa0, 0x78, 0xaf, 0x3f, 0xe4, 0xf7, 0xf0, 0xef, 0xde, 0xdf,
+	0xfd, 0xd1, 0xf9, 0xa5, 0x13, 0x7c, 0x06, 0x91, 0x7f, 0x2e, 0xeb, 0x71, 0xfc, 0x5e, 0xe1, 0x76,
+	0x8f, 0x0f, 0xe3, 0xa3, 0x13, 0x7c, 0x0a, 0x87, 0xdb, 0xf6, 0x31, 0xee, 0x31, 0x3b, 0xbc, 0x1e,
+	0x77, 0x30, 0x13, 0xba, 0x29, 0xfe, 0x77, 0xd8, 0x25, 0xbf, 0xc7, 0xf0, 0xf0, 0x8a, 0xe8, 0x04,
+	0x37, 0x30, 0xef, 0x63, 0xc7, 0x3b, 0x3d, 0x6f, 0x7c, 0x15, 0x7f, 0x3b, 0x7f, 0x03, 0x47, 0x4c,
+	0x14, 0xea, 0xab, 0xf0, 0x2a, 0xff, 0xbe, 0xc2, 0xc7, 0xc8, 0xfe, 0x29, 0x9e, 0xfc, 0x1c, 0x00,
+	0x2b, 0xcb, 0xe0, 0x5d, 0x3a, 0x04, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// ControlClient is the client API for Control service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ControlClient interface {
+	// ListPlugins lists the running inputs and outputs.
+	ListPlugins(ctx context.Context, in *ListPluginsRequest, opts ...grpc.CallOption) (*ListPluginsResponse, error)
+	// Gather gathers the selected inputs immediately, even when paused.
+	Gather(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*GatherResponse, error)
+	// Pause stops the selected inputs from gathering and the selected outputs
+	// from writing, outputs keep buffering their metrics.
+	Pause(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*PluginResponse, error)
+	// Resume resumes paused plugins.
+	Resume(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*PluginResponse, error)
+	// Errors returns the recent errors of the selected plugins, of all of them
+	// if no id is given.
+	Errors(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*ErrorsResponse, error)
+	// AddOutput connects the outputs of a config holding [[outputs.<name>]]
+	// sections and routes the metrics of their pipelines to them, alongside
+	// the running outputs. They are not written to the config files, a reload
+	// applies the config files again.
+	AddOutput(ctx context.Context, in *AddOutputRequest, opts ...grpc.CallOption) (*PluginResponse, error)
+	// RemoveOutput writes the cached metrics of the selected outputs and
+	// closes them, the other plugins keep running.
+	RemoveOutput(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*PluginResponse, error)
+}
+
+type controlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlClient(cc grpc.ClientConnInterface) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) ListPlugins(ctx context.Context, in *ListPluginsRequest, opts ...grpc.CallOption) (*ListPluginsResponse, error) {
+	out := new(ListPluginsResponse)
+	err := c.cc.Invoke(ctx, "/control.Control/ListPlugins", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Gather(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*GatherResponse, error) {
+	out := new(GatherResponse)
+	err := c.cc.Invoke(ctx, "/control.Control/Gather", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Pause(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*PluginResponse, error) {
+	out := new(PluginResponse)
+	err := c.cc.Invoke(ctx, "/control.Control/Pause", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Resume(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*PluginResponse, error) {
+	out := new(PluginResponse)
+	err := c.cc.Invoke(ctx, "/control.Control/Resume", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Errors(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*ErrorsResponse, error) {
+	out := new(ErrorsResponse)
+	err := c.cc.Invoke(ctx, "/control.Control/Errors", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) AddOutput(ctx context.Context, in *AddOutputRequest, opts ...grpc.CallOption) (*PluginResponse, error) {
+	out := new(PluginResponse)
+	err := c.cc.Invoke(ctx, "/control.Control/AddOutput", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) RemoveOutput(ctx context.Context, in *PluginRequest, opts ...grpc.CallOption) (*PluginResponse, error) {
+	out := new(PluginResponse)
+	err := c.cc.Invoke(ctx, "/control.Control/RemoveOutput", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ControlServer is the server API for Control service.
+type ControlServer interface {
+	// ListPlugins lists the running inputs and outputs.
+	ListPlugins(context.Context, *ListPluginsRequest) (*ListPluginsResponse, error)
+	// Gather gathers the selected inputs immediately, even when paused.
+	Gather(context.Context, *PluginRequest) (*GatherResponse, error)
+	// Pause stops the selected inputs from gathering and the selected outputs
+	// from writing, outputs keep buffering their metrics.
+	Pause(context.Context, *PluginRequest) (*PluginResponse, error)
+	// Resume resumes paused plugins.
+	Resume(context.Context, *PluginRequest) (*PluginResponse, error)
+	// Errors returns the recent errors of the selected plugins, of all of them
+	// if no id is given.
+	Errors(context.Context, *PluginRequest) (*ErrorsResponse, error)
+	// AddOutput connects the outputs of a config holding [[outputs.<name>]]
+	// sections and routes the metrics of their pipelines to them, alongside
+	// the running outputs. They are not written to the config files, a reload
+	// applies the config files again.
+	AddOutput(context.Context, *AddOutputRequest) (*PluginResponse, error)
+	// RemoveOutput writes the cached metrics of the selected outputs and
+	// closes them, the other plugins keep running.
+	RemoveOutput(context.Context, *PluginRequest) (*PluginResponse, error)
+}
+
+// UnimplementedControlServer can be embedded to have forward compatible implementations.
+type UnimplementedControlServer struct {
+}
+
+func (*UnimplementedControlServer) ListPlugins(ctx context.Context, req *ListPluginsRequest) (*ListPluginsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPlugins not implemented")
+}
+func (*UnimplementedControlServer) Gather(ctx context.Context, req *PluginRequest) (*GatherResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Gather not implemented")
+}
+func (*UnimplementedControlServer) Pause(ctx context.Context, req *PluginRequest) (*PluginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (*UnimplementedControlServer) Resume(ctx context.Context, req *PluginRequest) (*PluginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (*UnimplementedControlServer) Errors(ctx context.Context, req *PluginRequest) (*ErrorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Errors not implemented")
+}
+func (*UnimplementedControlServer) AddOutput(ctx context.Context, req *AddOutputRequest) (*PluginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddOutput not implemented")
+}
+func (*UnimplementedControlServer) RemoveOutput(ctx context.Context, req *PluginRequest) (*PluginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveOutput not implemented")
+}
+
+func RegisterControlServer(s *grpc.Server, srv ControlServer) {
+	s.RegisterService(&_Control_serviceDesc, srv)
+}
+
+func _Control_ListPlugins_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPluginsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ListPlugins(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/control.Control/ListPlugins",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ListPlugins(ctx, req.(*ListPluginsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Gather_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Gather(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/control.Control/Gather",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Gather(ctx, req.(*PluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/control.Control/Pause",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Pause(ctx, req.(*PluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/control.Control/Resume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Resume(ctx, req.(*PluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Errors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Errors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/control.Control/Errors",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Errors(ctx, req.(*PluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_AddOutput_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddOutputRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).AddOutput(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/control.Control/AddOutput",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).AddOutput(ctx, req.(*AddOutputRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_RemoveOutput_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).RemoveOutput(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/control.Control/RemoveOutput",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).RemoveOutput(ctx, req.(*PluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Control_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "control.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPlugins",
+			Handler:    _Control_ListPlugins_Handler,
+		},
+		{
+			MethodName: "Gather",
+			Handler:    _Control_Gather_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Control_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Control_Resume_Handler,
+		},
+		{
+			MethodName: "Errors",
+			Handler:    _Control_Errors_Handler,
+		},
+		{
+			MethodName: "AddOutput",
+			Handler:    _Control_AddOutput_Handler,
+		},
+		{
+			MethodName: "RemoveOutput",
+			Handler:    _Control_RemoveOutput_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "control.proto",
+}
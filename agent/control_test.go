@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/agent/control"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type controlInput struct {
+	fail bool
+}
+
+func (i *controlInput) Description() string  { return "" }
+func (i *controlInput) SampleConfig() string { return "" }
+func (i *controlInput) Gather(acc telegraf.Accumulator) error {
+	if i.fail {
+		return errors.New("gather failed")
+	}
+	acc.Add("control", 1, nil)
+	return nil
+}
+
+func controlClient(t *testing.T, a *Agent) (control.ControlClient, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := a.serveControl(l)
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	return control.NewControlClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestAgent_Control(t *testing.T) {
+	output := &healthOutput{}
+	a := healthAgent(t, output)
+	input := &controlInput{}
+	a.Config.Inputs = append(a.Config.Inputs, &internal_models.RunningInput{
+		Name:   "control",
+		Input:  input,
+		Config: &internal_models.InputConfig{Name: "control"},
+	})
+	c := &controlServer{agent: a}
+	ctx := context.Background()
+
+	list, err := c.ListPlugins(ctx, &control.ListPluginsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Plugins, 3)
+	assert.Equal(t, "inputs.health#0", list.Plugins[0].Id)
+	assert.Equal(t, "inputs.control#0", list.Plugins[1].Id)
+	assert.Equal(t, "outputs.health#0", list.Plugins[2].Id)
+	assert.Equal(t, "outputs", list.Plugins[2].Kind)
+
+	// Gathering an input sends its metrics to the agent
+	gathered, err := c.Gather(ctx, &control.PluginRequest{Id: "inputs.control"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"inputs.control#0"}, gathered.Ids)
+	assert.Empty(t, gathered.Errors)
+	m := <-a.metricC
+	assert.Equal(t, "control", m.Name())
+
+	input.fail = true
+	gathered, err = c.Gather(ctx, &control.PluginRequest{Id: "inputs.control#0"})
+	require.NoError(t, err)
+	require.Len(t, gathered.Errors, 1)
+	assert.Equal(t, "gather failed", gathered.Errors[0].Message)
+
+	_, err = c.Gather(ctx, &control.PluginRequest{Id: "outputs.health"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.Pause(ctx, &control.PluginRequest{Id: "inputs.missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	errs, err := c.Errors(ctx, &control.PluginRequest{})
+	require.NoError(t, err)
+	require.Len(t, errs.Errors, 1)
+	assert.Equal(t, "inputs.control#0", errs.Errors[0].Id)
+}
+
+func TestAgent_ControlPause(t *testing.T) {
+	output := &healthOutput{}
+	a := healthAgent(t, output)
+	input, ro := a.Config.Inputs[0], a.Config.Outputs[0]
+	client, stop := controlClient(t, a)
+	defer stop()
+	ctx := context.Background()
+
+	paused, err := client.Pause(ctx, &control.PluginRequest{Id: "outputs.health"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outputs.health#0"}, paused.Ids)
+	_, err = client.Pause(ctx, &control.PluginRequest{Id: "inputs.health#0"})
+	require.NoError(t, err)
+	assert.True(t, input.Paused())
+
+	// A paused output keeps its metrics until resumed
+	output.fail = true
+	ro.AddMetric(testutil.TestMetric(1, "control"))
+	require.NoError(t, ro.Write())
+	assert.Equal(t, 0, ro.FailedWrites())
+
+	list, err := client.ListPlugins(ctx, &control.ListPluginsRequest{})
+	require.NoError(t, err)
+	assert.True(t, list.Plugins[0].Paused)
+	assert.True(t, list.Plugins[1].Paused)
+
+	_, err = client.Resume(ctx, &control.PluginRequest{Id: "outputs.health"})
+	require.NoError(t, err)
+	require.Error(t, ro.Write())
+
+	errs, err := client.Errors(ctx, &control.PluginRequest{Id: "outputs.health"})
+	require.NoError(t, err)
+	require.Len(t, errs.Errors, 1)
+	assert.Equal(t, "write failed", errs.Errors[0].Message)
+	assert.InDelta(t, time.Now().UnixNano(), errs.Errors[0].Time,
+		float64(time.Minute))
+}
+
+func TestListenControl(t *testing.T) {
+	for _, address := range []string{"0.0.0.0:0", ":0", "192.0.2.1:7070"} {
+		_, err := listenControl(address)
+		assert.Error(t, err, address)
+	}
+
+	l, err := listenControl("127.0.0.1:0")
+	require.NoError(t, err)
+	l.Close()
+
+	dir, err := ioutil.TempDir("", "control")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "control.sock")
+	l, err = listenControl("unix://" + socket)
+	require.NoError(t, err)
+	defer l.Close()
+	// The socket of an agent which did not stop is replaced
+	l, err = listenControl("unix://" + socket)
+	require.NoError(t, err)
+	l.Close()
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// health is the body of the /healthz and /readyz responses.
+type health struct {
+	Healthy bool     `json:"healthy"`
+	Failing []string `json:"failing,omitempty"`
+}
+
+// serveHealth serves the health and the statistics of the agent on address
+// until the returned listener is closed.
+func (a *Agent) serveHealth(address string) (net.Listener, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Could not serve health on %s: %s", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, a.checkHealth(time.Now()))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, a.checkReady())
+	})
+	mux.HandleFunc("/metrics", servePrometheus)
+	go func() {
+		// Serve returns once the listener is closed
+		http.Serve(l, mux)
+	}()
+	log.Printf("Serving health on http://%s/healthz\n", l.Addr())
+	return l, nil
+}
+
+func writeHealth(w http.ResponseWriter, failing []string) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(failing) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health{
+		Healthy: len(failing) == 0,
+		Failing: failing,
+	})
+}
+
+// checkHealth returns the reasons the agent is unhealthy at now: outputs
+// whose last write failed and inputs which did not finish gathering within
+// two intervals, plus the collection jitter.
+func (a *Agent) checkHealth(now time.Time) []string {
+	var failing []string
+	for _, o := range a.outputs() {
+		if n := o.FailedWrites(); n > 0 {
+			failing = append(failing,
+				fmt.Sprintf("output %s: %d failed writes", o.Name, n))
+		}
+	}
+
+	for _, input := range a.Config.Inputs {
+		// Singleton inputs run on the leader of the cluster only
+		if !a.runsHere(input) {
+			continue
+		}
+		interval := input.Config.Interval
+		if interval == 0 {
+			interval = a.Config.Agent.Interval.Duration
+		}
+		deadline := 2*interval + a.collectionJitter(input)
+
+		last := input.LastGather()
+		if last.IsZero() {
+			last = a.runStart
+		}
+		if late := now.Sub(last); late > deadline {
+			failing = append(failing, fmt.Sprintf(
+				"input %s: no gather for %s", input.Name, late))
+		}
+	}
+	return failing
+}
+
+// checkReady returns the inputs which did not gather yet.
+func (a *Agent) checkReady() []string {
+	var failing []string
+	for _, input := range a.Config.Inputs {
+		if a.runsHere(input) && input.LastGather().IsZero() {
+			failing = append(failing,
+				fmt.Sprintf("input %s: no gather yet", input.Name))
+		}
+	}
+	return failing
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type healthOutput struct {
+	fail bool
+}
+
+func (o *healthOutput) Description() string  { return "" }
+func (o *healthOutput) SampleConfig() string { return "" }
+func (o *healthOutput) Connect() error       { return nil }
+func (o *healthOutput) Close() error         { return nil }
+func (o *healthOutput) Write(_ []telegraf.Metric) error {
+	if o.fail {
+		return errors.New("write failed")
+	}
+	return nil
+}
+
+func healthAgent(t *testing.T, output *healthOutput) *Agent {
+	c := config.NewConfig()
+	c.Agent.Interval.Duration = 10 * time.Second
+	c.Inputs = append(c.Inputs, &internal_models.RunningInput{
+		Name:   "health",
+		Input:  &reloadInput{},
+		Config: &internal_models.InputConfig{Name: "health"},
+	})
+	ro := internal_models.NewRunningOutput("health", output,
+		&internal_models.OutputConfig{Name: "health"})
+	ro.Quiet = true
+	c.Outputs = append(c.Outputs, ro)
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	a.runStart = time.Now()
+	return a
+}
+
+func TestAgent_CheckHealth(t *testing.T) {
+	output := &healthOutput{}
+	a := healthAgent(t, output)
+	input, ro := a.Config.Inputs[0], a.Config.Outputs[0]
+	now := a.runStart
+
+	assert.Empty(t, a.checkHealth(now))
+	assert.Len(t, a.checkReady(), 1)
+
+	// The input is late once two intervals passed without a gather
+	assert.Len(t, a.checkHealth(now.Add(21*time.Second)), 1)
+	input.SetLastGather(now.Add(15 * time.Second))
+	assert.Empty(t, a.checkHealth(now.Add(21*time.Second)))
+	assert.Empty(t, a.checkReady())
+
+	// The output fails until it writes again
+	output.fail = true
+	ro.AddMetric(testutil.TestMetric(1))
+	assert.Error(t, ro.Write())
+	assert.Equal(t, []string{"output health: 1 failed writes"},
+		a.checkHealth(now.Add(21*time.Second)))
+	output.fail = false
+	assert.NoError(t, ro.Write())
+	assert.Empty(t, a.checkHealth(now.Add(21*time.Second)))
+}
+
+func TestAgent_ServeHealth(t *testing.T) {
+	output := &healthOutput{}
+	a := healthAgent(t, output)
+	l, err := a.serveHealth("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/healthz")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var h health
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&h))
+	assert.True(t, h.Healthy)
+
+	resp, err = http.Get("http://" + l.Addr().String() + "/readyz")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&h))
+	assert.False(t, h.Healthy)
+	assert.Equal(t, []string{"input health: no gather yet"}, h.Failing)
+
+	resp, err = http.Get("http://" + l.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body),
+		"# TYPE telegraf_write_buffer_size gauge\n")
+}
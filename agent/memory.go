@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+const (
+	// Fractions of max_memory above which the agent sheds memory, and below
+	// which it goes back to normal.
+	MEMORY_HIGH_WATERMARK = 0.9
+	MEMORY_LOW_WATERMARK  = 0.75
+
+	// Interval of the memory checks.
+	MEMORY_CHECK_INTERVAL = time.Second
+)
+
+var (
+	// Memory obtained from the OS by the agent, in bytes
+	memoryUsage = selfstat.RegisterGauge("agent", "memory_bytes", nil)
+	// 1 while the agent is short of memory, 0 otherwise
+	memoryPressure = selfstat.RegisterGauge("agent", "memory_pressure", nil)
+)
+
+// readMemory returns the memory obtained from the OS by the agent and not
+// released to it.
+var readMemory = func() int64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.Sys - ms.HeapReleased)
+}
+
+// memoryLimiter keeps the memory of the agent below max_memory. Above the
+// high watermark the buffers of the outputs are halved, at every check until
+// the memory goes down, and the backpressure inputs are paused. Below the
+// low watermark the buffers and the inputs are restored.
+type memoryLimiter struct {
+	a   *Agent
+	max int64
+
+	// buffer limits of the outputs before they were shrunk, nil if the
+	// agent is not short of memory
+	limits map[*internal_models.RunningOutput]int
+	paused []telegraf.BackpressureInput
+}
+
+func (a *Agent) limitMemory(shutdown chan struct{}, max int64) {
+	l := &memoryLimiter{a: a, max: max}
+	defer l.restore()
+
+	ticker := time.NewTicker(MEMORY_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+			l.check()
+		}
+	}
+}
+
+func (l *memoryLimiter) check() {
+	usage := readMemory()
+	memoryUsage.Set(usage)
+	switch {
+	case usage >= int64(float64(l.max)*MEMORY_HIGH_WATERMARK):
+		l.shed(usage)
+	case usage < int64(float64(l.max)*MEMORY_LOW_WATERMARK) && l.limits != nil:
+		log.Printf("Memory usage of %d bytes is back below max_memory, "+
+			"restoring the output buffers and resuming the inputs\n", usage)
+		l.restore()
+	}
+}
+
+// shed halves the buffers of the outputs and pauses the backpressure
+// inputs.
+func (l *memoryLimiter) shed(usage int64) {
+	if l.limits == nil {
+		log.Printf("WARNING: memory usage of %d bytes is close to the "+
+			"max_memory of %d bytes, shrinking the output buffers and "+
+			"pausing the inputs supporting backpressure\n", usage, l.max)
+		memoryPressure.Set(1)
+		l.limits = make(map[*internal_models.RunningOutput]int)
+		for _, o := range l.a.outputs() {
+			l.limits[o] = o.MetricBufferLimit
+		}
+		for _, input := range l.a.Config.Inputs {
+			if p, ok := input.Input.(telegraf.BackpressureInput); ok {
+				p.Pause()
+				l.paused = append(l.paused, p)
+			}
+		}
+	}
+
+	dropped := 0
+	for _, o := range l.a.outputs() {
+		limit := o.MetricBufferLimit / 2
+		if limit < 1 {
+			limit = 1
+		}
+		dropped += o.Shrink(limit)
+	}
+	if dropped > 0 {
+		log.Printf("WARNING: dropped %d buffered metrics to stay below "+
+			"max_memory\n", dropped)
+	}
+	debug.FreeOSMemory()
+}
+
+func (l *memoryLimiter) restore() {
+	if l.limits == nil {
+		return
+	}
+	for o, limit := range l.limits {
+		o.SetMetricBufferLimit(limit)
+	}
+	for _, p := range l.paused {
+		p.Resume()
+	}
+	l.limits = nil
+	l.paused = nil
+	memoryPressure.Set(0)
+}
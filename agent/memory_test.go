@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backpressureInput struct {
+	hangingInput
+	paused bool
+}
+
+func (i *backpressureInput) Start(telegraf.Accumulator) error { return nil }
+func (i *backpressureInput) Stop()                            {}
+func (i *backpressureInput) Pause()                           { i.paused = true }
+func (i *backpressureInput) Resume()                          { i.paused = false }
+
+func TestMemoryLimiter(t *testing.T) {
+	usage := int64(0)
+	defer func(f func() int64) { readMemory = f }(readMemory)
+	readMemory = func() int64 { return usage }
+
+	c := reloadConfig(nil, nil)
+	in := &backpressureInput{}
+	c.Inputs = append(c.Inputs, &internal_models.RunningInput{
+		Name:   "listener",
+		Input:  in,
+		Config: &internal_models.InputConfig{Name: "listener"},
+	})
+	ro := internal_models.NewRunningOutput("buffered", &hangingOutput{},
+		&internal_models.OutputConfig{Name: "buffered"})
+	ro.Quiet = true
+	ro.MetricBufferLimit = 8
+	for i := 0; i < 8; i++ {
+		ro.AddMetric(testutil.TestMetric(i, "buffered"))
+	}
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	l := &memoryLimiter{a: a, max: 100}
+
+	usage = 50
+	l.check()
+	assert.False(t, in.paused)
+	assert.Equal(t, 8, ro.MetricBufferLimit)
+
+	// Above the high watermark the buffers are halved at every check
+	usage = 95
+	l.check()
+	assert.True(t, in.paused)
+	assert.Equal(t, 4, ro.MetricBufferLimit)
+	l.check()
+	assert.Equal(t, 2, ro.MetricBufferLimit)
+	assert.Len(t, ro.TakeMetrics(), 2)
+
+	// Between the watermarks nothing changes
+	usage = 80
+	l.check()
+	assert.True(t, in.paused)
+	assert.Equal(t, 2, ro.MetricBufferLimit)
+
+	usage = 70
+	l.check()
+	assert.False(t, in.paused)
+	assert.Equal(t, 8, ro.MetricBufferLimit)
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/influxdata/telegraf/internal/models"
+)
+
+// outputs returns the outputs of the agent.
+func (a *Agent) outputs() []*internal_models.RunningOutput {
+	a.outputsMu.RLock()
+	defer a.outputsMu.RUnlock()
+	return a.Config.Outputs
+}
+
+// pipeline returns the pipeline named name of the running agent, nil if
+// there is none.
+func (a *Agent) pipeline(name string) *pipeline {
+	for _, p := range a.pipelines {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// AddOutput connects o and routes the metrics of its pipeline to it from
+// now on, alongside the outputs of the running agent. The outputs of
+// failover groups can only be changed by reloading the config.
+func (a *Agent) AddOutput(o *internal_models.RunningOutput) error {
+	a.outputsMu.RLock()
+	running := a.pipelines != nil
+	p := a.pipeline(o.Config.Pipeline)
+	a.outputsMu.RUnlock()
+	if !running {
+		return fmt.Errorf("the agent is not running")
+	}
+	if p == nil {
+		return fmt.Errorf("output %s is in the undefined pipeline %s",
+			o.Name, o.Config.Pipeline)
+	}
+	if o.Config.FailoverGroup != "" {
+		return fmt.Errorf("output %s is in the failover group %s, reload the "+
+			"config to change failover groups", o.Name, o.Config.FailoverGroup)
+	}
+	if err := linkDeadLetter(o, a.outputs()); err != nil {
+		return err
+	}
+
+	o.Quiet = a.Config.Agent.Quiet
+	o.Tracer = a.tracer
+	if p.bufferLimit > 0 {
+		o.SetMetricBufferLimit(p.bufferLimit)
+	}
+	if err := connectOutput(o, 0); err != nil {
+		a.outputsMu.Lock()
+		a.closeOutput(o)
+		a.outputsMu.Unlock()
+		return err
+	}
+
+	a.outputsMu.Lock()
+	defer a.outputsMu.Unlock()
+	a.connected[o] = true
+	a.Config.Outputs = append(a.Config.Outputs, o)
+	outputs, _ := p.current()
+	p.setOutputs(append(outputs, o))
+	o.Log.Infof("Added output")
+	return nil
+}
+
+// RemoveOutput stops routing metrics to o, writes the metrics it cached and
+// closes it. The outputs of failover groups and the dead letter outputs of
+// other outputs can only be removed by reloading the config.
+func (a *Agent) RemoveOutput(o *internal_models.RunningOutput) error {
+	a.outputsMu.Lock()
+	p := a.pipeline(o.Config.Pipeline)
+	if err := a.removable(o); err != nil {
+		a.outputsMu.Unlock()
+		return err
+	}
+	var kept []*internal_models.RunningOutput
+	for _, other := range a.Config.Outputs {
+		if other != o {
+			kept = append(kept, other)
+		}
+	}
+	a.Config.Outputs = kept
+	outputs, _ := p.current()
+	kept = nil
+	for _, other := range outputs {
+		if other != o {
+			kept = append(kept, other)
+		}
+	}
+	p.setOutputs(kept)
+	a.outputsMu.Unlock()
+
+	// The flushes of the pipeline started before the removal may still
+	// write to o, it is closed once they are done
+	p.flushMu.Lock()
+	p.flushMu.Unlock()
+	if err := o.Write(); err != nil {
+		o.Log.Errorf("Error writing to output: %s", err)
+	}
+	if metrics := o.TakeMetrics(); len(metrics) > 0 {
+		o.Log.Warnf("Dropping %d cached metrics of the removed output",
+			len(metrics))
+	}
+
+	a.outputsMu.Lock()
+	defer a.outputsMu.Unlock()
+	if err := a.closeOutput(o); err != nil {
+		o.Log.Errorf("Error closing output: %s", err)
+	}
+	o.Log.Infof("Removed output")
+	return nil
+}
+
+// removable returns an error if o can't be removed from the running agent.
+func (a *Agent) removable(o *internal_models.RunningOutput) error {
+	found := false
+	for _, other := range a.Config.Outputs {
+		if other == o {
+			found = true
+		} else if other.DeadLetter == o {
+			return fmt.Errorf("output %s is the dead_letter_output of %s, "+
+				"reload the config to remove it", o.Name, other.Name)
+		}
+	}
+	if !found || a.pipeline(o.Config.Pipeline) == nil {
+		return fmt.Errorf("output %s is not running", o.Name)
+	}
+	if o.Config.FailoverGroup != "" {
+		return fmt.Errorf("output %s is in the failover group %s, reload the "+
+			"config to change failover groups", o.Name, o.Config.FailoverGroup)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/influxdata/telegraf/agent/control"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_AddRemoveOutput(t *testing.T) {
+	old := &hangingOutput{release: make(chan struct{})}
+	close(old.release)
+	c := reloadConfig(nil, nil)
+	ro := internal_models.NewRunningOutput("old", old,
+		&internal_models.OutputConfig{Name: "old"})
+	ro.Quiet = true
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	// Outputs are only added to a running agent
+	out := &hangingOutput{release: make(chan struct{})}
+	close(out.release)
+	no := internal_models.NewRunningOutput("new", out,
+		&internal_models.OutputConfig{Name: "new"})
+	assert.Error(t, a.AddOutput(no))
+	a.pipelines = a.newPipelines()
+
+	missing := internal_models.NewRunningOutput("new", out,
+		&internal_models.OutputConfig{Name: "new", Pipeline: "missing"})
+	assert.Error(t, a.AddOutput(missing))
+
+	// Both outputs receive the metrics during the dual-write period
+	require.NoError(t, a.AddOutput(no))
+	assert.Len(t, a.outputs(), 2)
+	a.pipelines[0].route(testutil.TestMetric(1, "both"))
+	require.NoError(t, a.RemoveOutput(ro))
+	assert.True(t, old.closed)
+	assert.Len(t, old.written, 1)
+	assert.Equal(t, []*internal_models.RunningOutput{no}, a.outputs())
+
+	a.pipelines[0].route(testutil.TestMetric(2, "new"))
+	assert.Len(t, old.written, 1)
+	a.pipelines[0].flush()
+	assert.Len(t, out.written, 2)
+	assert.Error(t, a.RemoveOutput(ro))
+}
+
+func TestAgent_RemoveDeadLetterOutput(t *testing.T) {
+	c := reloadConfig(nil, nil)
+	dead := internal_models.NewRunningOutput("dead", &reloadOutput{},
+		&internal_models.OutputConfig{Name: "dead"})
+	o := internal_models.NewRunningOutput("out", &reloadOutput{},
+		&internal_models.OutputConfig{Name: "out", DeadLetterOutput: "dead"})
+	c.Outputs = append(c.Outputs, dead, o)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	require.NoError(t, a.linkDeadLetters())
+	a.pipelines = a.newPipelines()
+
+	// The dead letter output of a running output is kept
+	assert.Error(t, a.RemoveOutput(dead))
+	require.NoError(t, a.RemoveOutput(o))
+	require.NoError(t, a.RemoveOutput(dead))
+	assert.Empty(t, a.outputs())
+}
+
+func TestAgent_ControlOutputs(t *testing.T) {
+	output := &healthOutput{}
+	a := healthAgent(t, output)
+	a.pipelines = a.newPipelines()
+	c := &controlServer{agent: a}
+	ctx := context.Background()
+
+	// Adding outputs must be allowed
+	_, err := c.AddOutput(ctx, &control.AddOutputRequest{Config: "[agent]"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	a.Config.Agent.ControlOutputs = true
+	_, err = c.AddOutput(ctx, &control.AddOutputRequest{Config: "[agent]"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.AddOutput(ctx, &control.AddOutputRequest{
+		Config: "[[outputs.health]]\n  password = \"${HOME}\"",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.RemoveOutput(ctx, &control.PluginRequest{Id: "inputs.health"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	removed, err := c.RemoveOutput(ctx, &control.PluginRequest{Id: "outputs.health"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outputs.health#0"}, removed.Ids)
+	_, err = c.RemoveOutput(ctx, &control.PluginRequest{Id: "outputs.health"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/models"
+)
+
+// pipeline is the outputs receiving the metrics of the inputs of a
+// pipeline from its channel, flushed on the schedule of the pipeline. The
+// default pipeline, named "", holds the plugins without a pipeline option.
+type pipeline struct {
+	name          string
+	metricC       chan telegraf.Metric
+	flushInterval time.Duration
+	bufferLimit   int
+
+	// outputs, their failover groups and the router of the metrics to them
+	// are guarded by mu, as outputs are added and removed while running
+	mu      sync.Mutex
+	outputs []*internal_models.RunningOutput
+	groups  []*internal_models.FailoverGroup
+	router  *internal_models.Router
+
+	// flushMu is held while flushing
+	flushMu sync.Mutex
+}
+
+// newPipelines returns the pipelines of the outputs, the default pipeline
+// first, applying the buffer limits of the pipelines to their outputs.
+func (a *Agent) newPipelines() []*pipeline {
+	names := []string{""}
+	for name := range a.Config.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	var pipelines []*pipeline
+	for _, name := range names {
+		p := &pipeline{
+			name:          name,
+			metricC:       a.pipelineC(name),
+			flushInterval: a.Config.Agent.FlushInterval.Duration,
+		}
+		// The flush interval of the agent was jittered by Run already
+		pc := a.Config.Pipelines[name]
+		if pc != nil && (pc.FlushInterval.Duration > 0 ||
+			pc.FlushJitter.Duration > 0) {
+			flushInterval := pc.FlushInterval.Duration
+			if flushInterval == 0 {
+				flushInterval = a.Config.Agent.FlushInterval.Duration
+			}
+			flushJitter := pc.FlushJitter.Duration
+			if flushJitter == 0 {
+				flushJitter = a.Config.Agent.FlushJitter.Duration
+			}
+			p.flushInterval = jitterInterval(flushInterval, flushJitter)
+		}
+		if pc != nil {
+			p.bufferLimit = pc.MetricBufferLimit
+		}
+		var outputs []*internal_models.RunningOutput
+		for _, o := range a.Config.Outputs {
+			if o.Config.Pipeline != name {
+				continue
+			}
+			if p.bufferLimit > 0 {
+				o.SetMetricBufferLimit(p.bufferLimit)
+			}
+			outputs = append(outputs, o)
+		}
+		p.setOutputs(outputs)
+		pipelines = append(pipelines, p)
+	}
+	return pipelines
+}
+
+// pipelineC returns the channel of the pipeline name.
+func (a *Agent) pipelineC(name string) chan telegraf.Metric {
+	if c, ok := a.pipelineCs[name]; ok {
+		return c
+	}
+	return a.metricC
+}
+
+// inputC returns the channel of the pipeline of input.
+func (a *Agent) inputC(input *internal_models.RunningInput) chan telegraf.Metric {
+	return a.pipelineC(input.Config.Pipeline)
+}
+
+// setOutputs sets the outputs of the pipeline, grouping them by failover
+// group.
+func (p *pipeline) setOutputs(outputs []*internal_models.RunningOutput) {
+	groups := internal_models.NewFailoverGroups(outputs)
+	router := internal_models.NewRouter(outputs, groups)
+	p.mu.Lock()
+	p.outputs = outputs
+	p.groups = groups
+	p.router = router
+	p.mu.Unlock()
+}
+
+// current returns the outputs and failover groups of the pipeline.
+func (p *pipeline) current() (
+	[]*internal_models.RunningOutput,
+	[]*internal_models.FailoverGroup,
+) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.outputs, p.groups
+}
+
+// route routes m to the outputs of the pipeline.
+func (p *pipeline) route(m telegraf.Metric) {
+	p.mu.Lock()
+	router := p.router
+	p.mu.Unlock()
+	router.Route(m)
+}
+
+// flush writes the cached metrics of the pipeline to its outputs.
+func (p *pipeline) flush() {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+	var wg sync.WaitGroup
+
+	outputs, groups := p.current()
+	grouped := make(map[*internal_models.RunningOutput]bool)
+	for _, g := range groups {
+		for _, o := range g.Outputs {
+			grouped[o] = true
+		}
+		wg.Add(1)
+		go func(g *internal_models.FailoverGroup) {
+			defer wg.Done()
+			if err := g.Write(); err != nil {
+				log.Printf("Error writing to failover group [%s]: %s\n",
+					g.Name, err.Error())
+			}
+		}(g)
+	}
+
+	for _, o := range outputs {
+		if grouped[o] {
+			continue
+		}
+		wg.Add(1)
+		go func(output *internal_models.RunningOutput) {
+			defer wg.Done()
+			err := output.Write()
+			if err != nil {
+				output.Log.Errorf("Error writing to output: %s", err)
+			}
+		}(o)
+	}
+
+	wg.Wait()
+}
+
+// blocked returns whether an output of the pipeline blocks its inputs, by
+// having a full buffer with the block buffer_full_strategy.
+func (p *pipeline) blocked() bool {
+	outputs, _ := p.current()
+	for _, o := range outputs {
+		if o.Blocking() && o.Full() {
+			return true
+		}
+	}
+	return false
+}
+
+// pipelineBlocked returns whether the pipeline named name blocks its inputs.
+func (a *Agent) pipelineBlocked(name string) bool {
+	for _, o := range a.outputs() {
+		if o.Config.Pipeline == name && o.Blocking() && o.Full() {
+			return true
+		}
+	}
+	return false
+}
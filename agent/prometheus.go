@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+var (
+	// invalidNameRe matches the characters invalid in Prometheus names
+	invalidNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// servePrometheus serves the statistics of the agent in the Prometheus text
+// format.
+func servePrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writePrometheus(w, selfstat.Stats())
+}
+
+// writePrometheus writes stats in the Prometheus text format. The
+// internal_write metrics_written stat becomes telegraf_write_metrics_written
+// for instance, with a _total suffix for counters.
+func writePrometheus(w io.Writer, stats []*selfstat.Stat) {
+	types := make(map[string]string)
+	samples := make(map[string][]string)
+	for _, s := range stats {
+		name := "telegraf_" + strings.TrimPrefix(s.Measurement(), "internal_") +
+			"_" + s.Field()
+		name = invalidNameRe.ReplaceAllString(name, "_")
+		typ := "gauge"
+		if !s.IsGauge() {
+			name += "_total"
+			typ = "counter"
+		}
+		types[name] = typ
+		samples[name] = append(samples[name],
+			fmt.Sprintf("%s%s %d", name, labels(s.Tags()), s.Get()))
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, types[name])
+		for _, sample := range samples[name] {
+			fmt.Fprintln(w, sample)
+		}
+	}
+}
+
+// labels returns the Prometheus labels of tags, sorted by name.
+func labels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`,
+			invalidNameRe.ReplaceAllString(k, "_"),
+			labelValueEscaper.Replace(v)))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
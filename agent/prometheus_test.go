@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/influxdata/telegraf/selfstat"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	written := selfstat.Register("prom_test", "metrics_written",
+		map[string]string{"output": "influxdb"})
+	written.Incr(10)
+	other := selfstat.Register("prom_test", "metrics_written",
+		map[string]string{"output": `a"b`})
+	other.Incr(1)
+	size := selfstat.RegisterGauge("prom_test", "buffer_size", nil)
+	size.Set(3)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, []*selfstat.Stat{written, size, other})
+	assert.Equal(t, `# TYPE telegraf_prom_test_buffer_size gauge
+telegraf_prom_test_buffer_size 3
+# TYPE telegraf_prom_test_metrics_written_total counter
+telegraf_prom_test_metrics_written_total{output="influxdb"} 10
+telegraf_prom_test_metrics_written_total{output="a\"b"} 1
+`, buf.String())
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"net"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/models"
+)
+
+// Timeout of the connections checking the wait_for addresses.
+const waitForTimeout = time.Second
+
+// ready returns whether input may gather or start: once its startup_delay
+// passed since the agent started and its wait_for addresses accept
+// connections. An input stays ready once it is.
+func (a *Agent) ready(input *internal_models.RunningInput) bool {
+	if input.Ready() {
+		return true
+	}
+	if time.Since(a.runStart) < input.Config.StartupDelay {
+		return false
+	}
+	for _, address := range input.Config.WaitFor {
+		network, addr, err := internal_models.ParseWaitFor(address)
+		if err == nil {
+			var conn net.Conn
+			if conn, err = net.DialTimeout(network, addr, waitForTimeout); err == nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			input.Log.Debugf("Waiting for %s: %s", address, err)
+			return false
+		}
+	}
+	input.SetReady()
+	return true
+}
+
+// startServices starts the service inputs which are ready and run on this
+// agent, unless they kept running through a reload. It returns the first
+// error, after starting the other inputs.
+func (a *Agent) startServices() error {
+	a.startedMu.Lock()
+	defer a.startedMu.Unlock()
+	var err error
+	for _, input := range a.Config.Inputs {
+		p, ok := input.Input.(telegraf.ServiceInput)
+		if !ok || a.started[input] || !a.runsHere(input) || !a.ready(input) {
+			continue
+		}
+		if e := p.Start(a.newAccumulator(input)); e != nil {
+			input.Log.Errorf("Service failed to start: %s", e)
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		a.started[input] = true
+	}
+	return err
+}
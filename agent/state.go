@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/influxdata/telegraf"
+)
+
+// statefulPlugins returns the stateful inputs and outputs, by the key of
+// their state. Plugins are identified by the fingerprint of their config,
+// followed by their rank among the plugins with the same config.
+func (a *Agent) statefulPlugins() map[string]telegraf.StatefulPlugin {
+	plugins := make(map[string]telegraf.StatefulPlugin)
+	seen := make(map[string]int)
+	add := func(fingerprint string, plugin interface{}) {
+		p, ok := plugin.(telegraf.StatefulPlugin)
+		if !ok || fingerprint == "" {
+			return
+		}
+		plugins[fmt.Sprintf("%s#%d", fingerprint, seen[fingerprint])] = p
+		seen[fingerprint]++
+	}
+	for _, input := range a.Config.Inputs {
+		add(input.Fingerprint, input.Input)
+	}
+	for _, o := range a.outputs() {
+		add(o.Fingerprint, o.Output)
+	}
+	return plugins
+}
+
+// LoadState restores the state of the stateful plugins from the statefile.
+// Plugins whose config changed since the state was saved start afresh.
+func (a *Agent) LoadState() error {
+	path := a.Config.Agent.Statefile
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var states map[string]json.RawMessage
+	if err := json.Unmarshal(data, &states); err != nil {
+		return fmt.Errorf("Could not decode statefile %s: %s", path, err)
+	}
+
+	for key, p := range a.statefulPlugins() {
+		state, ok := states[key]
+		if !ok {
+			continue
+		}
+		if err := restoreState(p, state); err != nil {
+			log.Printf("Could not restore state of plugin %T: %s\n", p, err)
+		}
+	}
+	return nil
+}
+
+func restoreState(p telegraf.StatefulPlugin, state json.RawMessage) error {
+	t := reflect.TypeOf(p.GetState())
+	if t == nil {
+		return fmt.Errorf("plugin has no state type")
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(state, v.Interface()); err != nil {
+		return err
+	}
+	return p.SetState(v.Elem().Interface())
+}
+
+// SaveState stores the state of the stateful plugins in the statefile.
+func (a *Agent) SaveState() error {
+	path := a.Config.Agent.Statefile
+	if path == "" {
+		return nil
+	}
+	states := make(map[string]interface{})
+	for key, p := range a.statefulPlugins() {
+		states[key] = p.GetState()
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+
+	// Replace the statefile at once so a crash can't leave half of it
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".telegraf-state")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
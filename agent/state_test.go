@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/influxdata/telegraf/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stateInput struct {
+	reloadInput
+	offsets map[string]int
+}
+
+func (i *stateInput) GetState() interface{} {
+	return i.offsets
+}
+
+func (i *stateInput) SetState(state interface{}) error {
+	i.offsets = state.(map[string]int)
+	return nil
+}
+
+func stateAgent(t *testing.T, statefile string, inputs ...*stateInput) *Agent {
+	a, err := NewAgent(reloadConfig(nil, nil))
+	require.NoError(t, err)
+	a.Config.Agent.Statefile = statefile
+	for _, input := range inputs {
+		a.Config.Inputs = append(a.Config.Inputs, &internal_models.RunningInput{
+			Name:        "state",
+			Input:       input,
+			Config:      &internal_models.InputConfig{Name: "state"},
+			Fingerprint: "fp",
+		})
+	}
+	return a
+}
+
+func TestAgent_State(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	statefile := filepath.Join(dir, "state.json")
+
+	// Nothing to restore before the first save
+	first := &stateInput{offsets: map[string]int{}}
+	require.NoError(t, stateAgent(t, statefile, first).LoadState())
+	assert.Empty(t, first.offsets)
+
+	// Identically configured inputs keep their own state
+	a := stateAgent(t, statefile,
+		&stateInput{offsets: map[string]int{"a.log": 10}},
+		&stateInput{offsets: map[string]int{"b.log": 20}})
+	require.NoError(t, a.SaveState())
+
+	restored := []*stateInput{
+		{offsets: map[string]int{}},
+		{offsets: map[string]int{}},
+	}
+	require.NoError(t, stateAgent(t, statefile, restored...).LoadState())
+	assert.Equal(t, map[string]int{"a.log": 10}, restored[0].offsets)
+	assert.Equal(t, map[string]int{"b.log": 20}, restored[1].offsets)
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf/internal/config"
+)
+
+// globalTags are the tags added to all metrics: the [global_tags] of the
+// config, overridden by the tags of the global_tags_file if any. The
+// accumulators look them up at every metric, so that the tags read from the
+// file apply to the running service inputs too.
+type globalTags struct {
+	// path of the global_tags_file, if any
+	path   string
+	static map[string]string
+
+	mu   sync.RWMutex
+	tags map[string]string
+}
+
+func newGlobalTags(static map[string]string, path string) (*globalTags, error) {
+	g := &globalTags{path: path, static: static, tags: static}
+	if path != "" {
+		if err := g.load(); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// get returns the tags, which must not be modified.
+func (g *globalTags) get() map[string]string {
+	if g == nil {
+		return nil
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.tags
+}
+
+// load reads the tags of the file again.
+func (g *globalTags) load() error {
+	fileTags, err := config.ReadTagsFile(g.path)
+	if err != nil {
+		return err
+	}
+	tags := make(map[string]string, len(g.static)+len(fileTags))
+	for k, v := range g.static {
+		tags[k] = v
+	}
+	for k, v := range fileTags {
+		tags[k] = v
+	}
+	g.mu.Lock()
+	g.tags = tags
+	g.mu.Unlock()
+	return nil
+}
+
+// refresh reads the tags of the file every interval until shutdown is
+// closed, keeping the previous tags when it can't be read.
+func (g *globalTags) refresh(shutdown chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+		}
+		if err := g.load(); err != nil {
+			log.Printf("Error refreshing the global tags of %s: %s\n", g.path, err)
+		}
+	}
+}
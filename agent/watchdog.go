@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// watch records whether a gather of input failed by timing out, panicking
+// or being skipped after a stuck gather, restarting the input once
+// watchdog_failures gathers in a row failed. The gathers blocked by a full
+// output of the pipeline of the input are not failures of the input.
+func (a *Agent) watch(input *internal_models.RunningInput, failed bool) {
+	if failed && a.pipelineBlocked(input.Config.Pipeline) {
+		return
+	}
+	max := a.Config.Agent.WatchdogFailures
+	if n := input.RecordGather(failed); max <= 0 || n < max {
+		return
+	}
+	input.Log.Warnf("Restarting the input after %d consecutive gathers "+
+		"timing out or panicking", max)
+	if err := a.restartInput(input); err != nil {
+		input.Log.Errorf("Error restarting the input: %s", err)
+		return
+	}
+	selfstat.Register("gather", "restarts",
+		map[string]string{"input": input.Name}).Incr(1)
+}
+
+// restartInput stops and starts a service input again, and replaces the
+// instance of other inputs by a fresh one carrying over their state, closing
+// the replaced instance. The gathers of the stopped or replaced instance are
+// abandoned.
+func (a *Agent) restartInput(input *internal_models.RunningInput) error {
+	if p, ok := input.Input.(telegraf.ServiceInput); ok {
+		a.startedMu.Lock()
+		defer a.startedMu.Unlock()
+		// The stuck gathers of the stopped instance are abandoned like the
+		// ones of a replaced instance, so that the input gathers again
+		defer input.Replace(p)
+		if !a.started[input] {
+			return nil
+		}
+		p.Stop()
+		return p.Start(a.newAccumulator(input))
+	}
+
+	if input.New == nil {
+		input.RecordGather(false)
+		return nil
+	}
+	plugin, err := input.New()
+	if err != nil {
+		return err
+	}
+	if old, ok := input.Input.(telegraf.StatefulPlugin); ok {
+		if err := plugin.(telegraf.StatefulPlugin).SetState(
+			old.GetState()); err != nil {
+			return err
+		}
+	}
+	if s, ok := plugin.(telegraf.ShardedInput); ok && a.shard != nil {
+		s.SetShard(a.shard.Owns)
+	}
+	replaced := input.Input
+	input.Replace(plugin)
+	closeInput(input, replaced)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+)
+
+// servePprof serves the profiles of net/http/pprof on /debug/pprof/ and the
+// expvar variables on /debug/vars at address, for the life of the process.
+// The endpoints require basic authentication when the
+// TELEGRAF_PPROF_USERNAME and TELEGRAF_PPROF_PASSWORD environment variables
+// are set.
+func servePprof(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	var handler http.Handler = mux
+	username := os.Getenv("TELEGRAF_PPROF_USERNAME")
+	password := os.Getenv("TELEGRAF_PPROF_PASSWORD")
+	if username != "" || password != "" {
+		handler = basicAuth(mux, username, password)
+	} else {
+		log.Printf("WARNING: serving pprof on %s without authentication\n",
+			l.Addr())
+	}
+
+	go func() {
+		if err := http.Serve(l, handler); err != nil {
+			log.Printf("Error serving pprof: %s\n", err)
+		}
+	}()
+	log.Printf("Serving pprof on http://%s/debug/pprof/\n", l.Addr())
+	return nil
+}
+
+// basicAuth requires the requests to h to authenticate with username and
+// password.
+func basicAuth(h http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="telegraf"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
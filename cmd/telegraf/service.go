@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "log"
+
+// handleService returns whether telegraf was run to manage the service,
+// which only exists on Windows.
+func handleService() bool {
+	if *fService != "" {
+		log.Fatalf("Error: -service is only supported on Windows")
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/logger"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceDescription = "Collects data using a series of plugins and " +
+	"publishes it to another series of plugins."
+
+// Number of restarts after failures before the service is left stopped,
+// until it runs for a day without failing.
+const (
+	serviceRestarts    = 3
+	serviceResetPeriod = 24 * time.Hour
+)
+
+// Time waited for the service to stop
+const serviceStopTimeout = 30 * time.Second
+
+// handleService runs the -service command, or telegraf as the service when
+// started by the service control manager. It returns whether telegraf was
+// run to manage the service.
+func handleService() bool {
+	if *fService != "" {
+		if err := controlService(*fService); err != nil {
+			log.Fatal(err)
+		}
+		return true
+	}
+
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !isService {
+		return false
+	}
+
+	elog, err := eventlog.Open(*fServiceName)
+	if err == nil {
+		defer elog.Close()
+		// The event log has its own timestamps
+		log.SetFlags(0)
+		log.SetOutput(&eventLogWriter{elog})
+		logWriter = &eventLogWriter{elog}
+	}
+	if err := svc.Run(*fServiceName, &service{}); err != nil {
+		log.Fatalf("Error running the %s service: %s", *fServiceName, err)
+	}
+	return true
+}
+
+// service runs telegraf until the service control manager stops it.
+type service struct{}
+
+func (s *service) Execute(
+	args []string,
+	requests <-chan svc.ChangeRequest,
+	changes chan<- svc.Status,
+) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		run(stopped)
+		close(done)
+	}()
+
+	changes <- svc.Status{
+		State:   svc.Running,
+		Accepts: svc.AcceptStop | svc.AcceptShutdown,
+	}
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{
+					State:    svc.StopPending,
+					WaitHint: uint32(serviceStopTimeout / time.Millisecond),
+				}
+				close(stopped)
+				<-done
+				return false, 0
+			}
+		case <-done:
+			// Stopping without being asked to is a failure, for the
+			// recovery actions to restart the service
+			return true, 1
+		}
+	}
+}
+
+func controlService(command string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Could not connect to the service manager: %s", err)
+	}
+	defer m.Disconnect()
+
+	switch command {
+	case "install":
+		return installService(m)
+	case "uninstall":
+		return uninstallService(m)
+	case "start", "stop":
+		s, err := m.OpenService(*fServiceName)
+		if err != nil {
+			return fmt.Errorf("Could not open the %s service: %s",
+				*fServiceName, err)
+		}
+		defer s.Close()
+		if command == "start" {
+			return s.Start()
+		}
+		return stopService(s)
+	}
+	return fmt.Errorf("Error: unknown -service %s, it can be install, "+
+		"uninstall, start or stop", command)
+}
+
+func installService(m *mgr.Mgr) error {
+	if *fConfig == "" {
+		return fmt.Errorf("Error: -service install requires a -config")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args, err := serviceArgs()
+	if err != nil {
+		return err
+	}
+
+	s, err := m.CreateService(*fServiceName, exe, mgr.Config{
+		DisplayName:      *fServiceDisplayName,
+		Description:      serviceDescription,
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: *fServiceDelayedStart,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("Could not install the %s service: %s",
+			*fServiceName, err)
+	}
+	defer s.Close()
+
+	if err := setRecoveryActions(s); err != nil {
+		s.Delete()
+		return fmt.Errorf("Could not set the recovery actions of the %s "+
+			"service: %s", *fServiceName, err)
+	}
+	err = eventlog.InstallAsEventCreate(*fServiceName,
+		eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		s.Delete()
+		return fmt.Errorf("Could not install the event log source of the %s "+
+			"service: %s", *fServiceName, err)
+	}
+	return nil
+}
+
+// setRecoveryActions has the service restarted after -service-restart-delay
+// when it fails, either crashing or exiting with an error.
+func setRecoveryActions(s *mgr.Service) error {
+	if *fServiceRestartDelay <= 0 {
+		return nil
+	}
+	actions := make([]mgr.RecoveryAction, serviceRestarts)
+	for i := range actions {
+		actions[i] = mgr.RecoveryAction{
+			Type:  mgr.ServiceRestart,
+			Delay: *fServiceRestartDelay,
+		}
+	}
+	err := s.SetRecoveryActions(actions, uint32(serviceResetPeriod/time.Second))
+	if err != nil {
+		return err
+	}
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
+
+func uninstallService(m *mgr.Mgr) error {
+	s, err := m.OpenService(*fServiceName)
+	if err != nil {
+		return fmt.Errorf("Could not open the %s service: %s",
+			*fServiceName, err)
+	}
+	defer s.Close()
+
+	if status, err := s.Query(); err == nil && status.State != svc.Stopped {
+		if err := stopService(s); err != nil {
+			return err
+		}
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("Could not uninstall the %s service: %s",
+			*fServiceName, err)
+	}
+	return eventlog.Remove(*fServiceName)
+}
+
+// stopService stops the service and waits for it to be stopped.
+func stopService(s *mgr.Service) error {
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("Could not stop the %s service: %s",
+			*fServiceName, err)
+	}
+	deadline := time.Now().Add(serviceStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for the %s service to stop",
+				*fServiceName)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceArgs returns the flags the service runs telegraf with: the flags
+// given to -service install, with the paths made absolute as services run
+// in the system directory.
+func serviceArgs() ([]string, error) {
+	var args []string
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "service", "service-display-name", "service-delayed-start",
+			"service-restart-delay":
+			return
+		}
+		value := f.Value.String()
+		switch f.Name {
+		case "config", "config-directory", "configdirectory",
+			"config-cache-directory", "pidfile":
+			if !config.IsRemote(value) {
+				abs, absErr := filepath.Abs(value)
+				if absErr != nil {
+					err = absErr
+				}
+				value = abs
+			}
+		}
+		args = append(args, "-"+f.Name+"="+value)
+	})
+	return args, err
+}
+
+// eventLogWriter writes the log lines to the Windows event log, as the
+// output of a service is discarded.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+// Write logs the lines logged before the logger is set up, at the level
+// given by their prefix
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.ToUpper(string(p))
+	level := logger.LevelInfo
+	switch {
+	case strings.HasPrefix(msg, "ERROR"):
+		level = logger.LevelError
+	case strings.HasPrefix(msg, "WARNING"):
+		level = logger.LevelWarn
+	}
+	return w.WriteLevel(level, p)
+}
+
+func (w *eventLogWriter) WriteLevel(level logger.Level, p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	switch level {
+	case logger.LevelError:
+		err = w.elog.Error(1, msg)
+	case logger.LevelWarn:
+		err = w.elog.Warning(1, msg)
+	default:
+		err = w.elog.Info(1, msg)
+	}
+	return len(p), err
+}
@@ -3,18 +3,25 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/influxdata/telegraf/agent"
 	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/logger"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	_ "github.com/influxdata/telegraf/plugins/inputs/all"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	_ "github.com/influxdata/telegraf/plugins/outputs/all"
+	_ "github.com/influxdata/telegraf/plugins/secretstores/all"
+	"github.com/influxdata/telegraf/plugins/secretstores/file"
 )
 
 var fDebug = flag.Bool("debug", false,
@@ -25,10 +32,22 @@ var fTest = flag.Bool("test", false, "gather metrics, print them out, and exit")
 var fConfig = flag.String("config", "", "configuration file to load")
 var fConfigDirectory = flag.String("config-directory", "",
 	"directory containing additional *.conf files")
+var fConfigRefreshInterval = flag.Duration("config-refresh-interval",
+	5*time.Minute, "interval at which a remote config is fetched again, 0 to disable")
+var fConfigCacheDirectory = flag.String("config-cache-directory", "",
+	"directory caching the remote configs")
+var fConfigKeyFile = flag.String("config-key-file", "",
+	"file of the hex encoded key decrypting the ENC[...] config values")
+var fWatchConfigDirectory = flag.Bool("watch-config-directory", false,
+	"reload the config when the files of the config directory change")
+var fWatchInterval = flag.Duration("watch-interval", 5*time.Second,
+	"interval at which the config directory is checked for changes")
 var fVersion = flag.Bool("version", false, "display the version")
 var fSampleConfig = flag.Bool("sample-config", false,
 	"print out full sample configuration")
 var fPidfile = flag.String("pidfile", "", "file to write our pid to")
+var fPprofAddr = flag.String("pprof-addr", "",
+	"serve pprof profiles and expvar variables on this address")
 var fInputFilters = flag.String("input-filter", "",
 	"filter the inputs to enable, separator is :")
 var fInputList = flag.Bool("input-list", false,
@@ -37,16 +56,35 @@ var fOutputFilters = flag.String("output-filter", "",
 	"filter the outputs to enable, separator is :")
 var fOutputList = flag.Bool("output-list", false,
 	"print available output plugins.")
+var fSectionFilters = flag.String("section-filter", "",
+	"filter the sections of the sample config to print, separator is :")
 var fUsage = flag.String("usage", "",
 	"print usage for a plugin, ie, 'telegraf -usage mysql'")
+var fEncryptSecrets = flag.String("encrypt-secrets", "",
+	"encrypt stdin for the file secret store with the given key file")
 var fInputFiltersLegacy = flag.String("filter", "",
 	"filter the inputs to enable, separator is :")
 var fOutputFiltersLegacy = flag.String("outputfilter", "",
 	"filter the outputs to enable, separator is :")
 var fConfigDirectoryLegacy = flag.String("configdirectory", "",
 	"directory containing additional *.conf files")
+var fService = flag.String("service", "",
+	"operate on the Windows service: install, uninstall, start or stop")
+var fServiceName = flag.String("service-name", "telegraf",
+	"name of the Windows service")
+var fServiceDisplayName = flag.String("service-display-name",
+	"Telegraf Data Collector Service", "display name of the Windows service")
+var fServiceDelayedStart = flag.Bool("service-delayed-start", false,
+	"start the Windows service after the other automatic services")
+var fServiceRestartDelay = flag.Duration("service-restart-delay", time.Minute,
+	"delay before the Windows service is restarted after a failure, 0 to disable")
+
+// logWriter receives the logs, the event log when running as a Windows
+// service
+var logWriter io.Writer = os.Stderr
 
 // Telegraf version
+//
 //	-ldflags "-X main.Version=`git describe --always --tags`"
 var Version string
 
@@ -54,22 +92,53 @@ const usage = `Telegraf, The plugin-driven server agent for collecting and repor
 
 Usage:
 
-  telegraf <flags>
-
-The flags are:
-
-  -config <file>     configuration file to load
-  -test              gather metrics once, print them to stdout, and exit
+  telegraf [commands|flags]
+
+The commands & flags are:
+
+  config             print out full sample configuration to stdout
+  config encrypt     encrypt stdin as an ENC[...] config value with the key of
+                     -config-key-file
+  plugins list       print the available inputs and outputs with their
+                     descriptions
+  version            print the version to stdout
+
+  -config <file>     configuration file to load, or url of a remote config:
+                     http(s)://..., s3://bucket/key or etcd://host:port/key
+  -config-refresh-interval  interval at which a remote config is fetched
+                     again and reloaded if it changed, default 5m
+  -config-cache-directory  directory caching the remote configs, used when
+                     they can't be fetched
+  -config-key-file   file of the hex encoded key decrypting the ENC[...]
+                     config values, default $TELEGRAF_CONFIG_KEY_FILE
+  -test              gather metrics once, print them to stdout with their
+                     tags and fields, and exit without writing to the outputs
   -sample-config     print out full sample configuration to stdout
   -config-directory  directory containing additional *.conf files
+  -watch-config-directory  reload the config when the files of the
+                     config directory are added, changed or removed
+  -watch-interval    interval of the config directory checks, default 5s
+  -section-filter    filter the sections of the sample config to print:
+                     global_tags, agent, outputs or inputs, separator is :
   -input-filter      filter the input plugins to enable, separator is :
   -input-list        print all the plugins inputs
   -output-filter     filter the output plugins to enable, separator is :
   -output-list       print all the available outputs
   -usage             print usage for a plugin, ie, 'telegraf -usage mysql'
+  -encrypt-secrets   encrypt stdin for the file secret store with a key file
+  -pprof-addr        serve the pprof profiles and the expvar variables on
+                     this address, ie localhost:6060, with basic auth if
+                     TELEGRAF_PPROF_USERNAME and TELEGRAF_PPROF_PASSWORD are set
   -debug             print metrics as they're generated to stdout
   -quiet             run in quiet mode
   -version           print the version to stdout
+  -service           install, uninstall, start or stop the Windows service
+  -service-name      name of the Windows service, default telegraf
+  -service-display-name  display name of the Windows service
+  -service-delayed-start  start the Windows service after the other
+                     automatic services
+  -service-restart-delay  delay before the Windows service is restarted
+                     after a failure, default 1m, 0 disables the restarts
 
 Examples:
 
@@ -79,24 +148,71 @@ Examples:
   # generate config with only cpu input & influxdb output plugins defined
   telegraf -sample-config -input-filter cpu -output-filter influxdb
 
+  # list the available plugins
+  telegraf plugins list
+
+  # print the config block of the uwsgi input, to paste into a config
+  telegraf config -section-filter inputs -input-filter uwsgi
+
   # run a single telegraf collection, outputing metrics to stdout
   telegraf -config telegraf.conf -test
 
+  # test the uwsgi input of the config, without running the other plugins
+  telegraf -config telegraf.conf -test -input-filter uwsgi
+
   # run telegraf with all plugins defined in config file
   telegraf -config telegraf.conf
 
+  # run telegraf with a config distributed over http
+  telegraf -config https://config.example.com/telegraf.conf
+
+  # run telegraf, applying the changes of the plugin configs of conf.d
+  telegraf -config telegraf.conf -config-directory conf.d -watch-config-directory
+
   # run telegraf, enabling the cpu & memory input, and influxdb output plugins
   telegraf -config telegraf.conf -input-filter cpu:mem -output-filter influxdb
+
+  # encrypt a password to write as an ENC[...] value in the config
+  echo -n "secret" | telegraf config encrypt -config-key-file config.key
+
+  # encrypt a JSON object of secrets for the file secret store
+  telegraf -encrypt-secrets secrets.key < secrets.json > secrets.enc
+
+  # install telegraf as a Windows service, run with the given config
+  telegraf -service install -config "C:\Program Files\Telegraf\telegraf.conf"
 `
 
+// The subcommand, like "config" or "plugins list"
+var command []string
+
 func main() {
+	flag.Usage = func() { usageExit(0) }
+	flag.Parse()
+	// Flags may follow the subcommand, as in 'telegraf config -input-filter cpu'
+	for flag.NArg() > 0 {
+		command = append(command, flag.Arg(0))
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
+	// Install or control the Windows service, or run as the service
+	if handleService() {
+		return
+	}
+	run(nil)
+}
+
+// run runs telegraf until it is interrupted, or stopped is closed
+func run(stopped <-chan struct{}) {
+	// The agent of the previous run, reloaded when SIGHUP is received
+	var ag *agent.Agent
+	// The config loaded by a watcher to reload, loaded again if nil
+	var pending *config.Config
+
 	reload := make(chan bool, 1)
 	reload <- true
 	for <-reload {
 		reload <- false
-		flag.Usage = func() { usageExit(0) }
-		flag.Parse()
-		args := flag.Args()
+		args := command
 
 		if flag.NFlag() == 0 && len(args) == 0 {
 			usageExit(0)
@@ -112,6 +228,12 @@ func main() {
 			inputFilters = strings.Split(":"+inputFilter+":", ":")
 		}
 
+		var sectionFilters []string
+		if *fSectionFilters != "" {
+			sectionFilter := strings.TrimSpace(*fSectionFilters)
+			sectionFilters = strings.Split(":"+sectionFilter+":", ":")
+		}
+
 		var outputFilters []string
 		if *fOutputFiltersLegacy != "" {
 			outputFilter := strings.TrimSpace(*fOutputFiltersLegacy)
@@ -129,7 +251,22 @@ func main() {
 				fmt.Println(v)
 				return
 			case "config":
-				config.PrintSampleConfig(inputFilters, outputFilters)
+				if len(args) > 1 && args[1] == "encrypt" {
+					encryptValue()
+					return
+				}
+				err := config.PrintSampleConfig(sectionFilters, inputFilters,
+					outputFilters)
+				if err != nil {
+					log.Fatal(err)
+				}
+				return
+			case "plugins":
+				if len(args) < 2 || args[1] != "list" {
+					fmt.Println("Unknown plugins command. See telegraf --help")
+					os.Exit(1)
+				}
+				config.PrintPlugins(sectionFilters)
 				return
 			}
 		}
@@ -157,7 +294,28 @@ func main() {
 		}
 
 		if *fSampleConfig {
-			config.PrintSampleConfig(inputFilters, outputFilters)
+			err := config.PrintSampleConfig(sectionFilters, inputFilters,
+				outputFilters)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if *fEncryptSecrets != "" {
+			key, err := file.ReadKey(*fEncryptSecrets)
+			if err != nil {
+				log.Fatal(err)
+			}
+			plaintext, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatal(err)
+			}
+			data, err := file.Encrypt(key, plaintext)
+			if err != nil {
+				log.Fatal(err)
+			}
+			os.Stdout.Write(data)
 			return
 		}
 
@@ -170,90 +328,132 @@ func main() {
 			return
 		}
 
-		var (
-			c   *config.Config
-			err error
-		)
-
-		if *fConfig != "" {
-			c = config.NewConfig()
-			c.OutputFilters = outputFilters
-			c.InputFilters = inputFilters
-			err = c.LoadConfig(*fConfig)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
+		if *fConfig == "" {
 			fmt.Println("You must specify a config file. See telegraf --help")
 			os.Exit(1)
 		}
+		// The profiling server lives across the reloads
+		if *fPprofAddr != "" && ag == nil {
+			if err := servePprof(*fPprofAddr); err != nil {
+				log.Fatalf("Could not serve pprof on %s: %s", *fPprofAddr, err)
+			}
+		}
 
-		if *fConfigDirectoryLegacy != "" {
-			err = c.LoadDirectory(*fConfigDirectoryLegacy)
-			if err != nil {
-				log.Fatal(err)
+		// A watcher hands over the config it loaded to check it
+		load := func() (*config.Config, error) {
+			if c := pending; c != nil {
+				pending = nil
+				return c, nil
 			}
+			return loadConfig(inputFilters, outputFilters)
 		}
 
-		if *fConfigDirectory != "" {
-			err = c.LoadDirectory(*fConfigDirectory)
+		if ag == nil {
+			c, err := load()
 			if err != nil {
 				log.Fatal(err)
 			}
-		}
-		if len(c.Outputs) == 0 {
-			log.Fatalf("Error: no outputs found, did you provide a valid config file?")
-		}
-		if len(c.Inputs) == 0 {
-			log.Fatalf("Error: no inputs found, did you provide a valid config file?")
-		}
-
-		ag, err := agent.NewAgent(c)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if *fDebug {
-			ag.Config.Agent.Debug = true
-		}
-
-		if *fQuiet {
-			ag.Config.Agent.Quiet = true
-		}
-
-		if *fTest {
-			err = ag.Test()
+			ag, err = agent.NewAgent(c)
 			if err != nil {
 				log.Fatal(err)
 			}
-			return
-		}
+			applyFlags(ag)
+			if err := setupLogger(ag); err != nil {
+				log.Fatal(err)
+			}
+
+			if *fTest {
+				err = ag.Test()
+				if err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
 
-		err = ag.Connect()
-		if err != nil {
-			log.Fatal(err)
+			// Restore the state the plugins had when telegraf stopped
+			if err := ag.LoadState(); err != nil {
+				log.Printf("Error loading the plugin state: %s\n", err)
+			}
+			if err := ag.Connect(); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			ag = reloadAgent(ag, load)
 		}
 
 		shutdown := make(chan struct{})
+		var stopOnce sync.Once
+		// stop stops the agent, to be reloaded with the config c if set
+		stop := func(reloading bool, c *config.Config) {
+			stopOnce.Do(func() {
+				if reloading {
+					pending = c
+					<-reload
+					reload <- true
+				}
+				close(shutdown)
+			})
+		}
 		signals := make(chan os.Signal)
-		signal.Notify(signals, os.Interrupt, syscall.SIGHUP)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 		go func() {
-			sig := <-signals
-			if sig == os.Interrupt {
-				close(shutdown)
-			}
-			if sig == syscall.SIGHUP {
-				log.Printf("Reloading Telegraf config\n")
-				<-reload
-				reload <- true
-				close(shutdown)
+			select {
+			case sig := <-signals:
+				if sig == os.Interrupt || sig == syscall.SIGTERM {
+					stop(false, nil)
+				}
+				if sig == syscall.SIGHUP {
+					log.Printf("Reloading Telegraf config\n")
+					stop(true, nil)
+				}
+			case <-stopped:
+				stop(false, nil)
+			case <-shutdown:
+				// Stopped by a config watcher
+				signal.Stop(signals)
 			}
 		}()
 
+		// Reload when the watched configs change, unless the new config is
+		// broken. The loaded config is the one reloaded.
+		reloadChanged := func(w *config.Watcher) func() {
+			return func() {
+				c, err := loadConfig(inputFilters, outputFilters)
+				if err != nil {
+					log.Printf("Not reloading the changed config %s: %s\n",
+						w.Name, err)
+					return
+				}
+				log.Printf("Config %s changed, reloading Telegraf config\n",
+					w.Name)
+				stop(true, c)
+			}
+		}
+		if *fWatchConfigDirectory {
+			dir := *fConfigDirectory
+			if dir == "" {
+				dir = *fConfigDirectoryLegacy
+			}
+			if dir == "" {
+				log.Fatalf("Error: -watch-config-directory requires a -config-directory")
+			}
+			w, err := config.NewDirectoryWatcher(dir, *fWatchInterval)
+			if err != nil {
+				log.Fatal(err)
+			}
+			go w.Watch(shutdown, reloadChanged(w))
+		}
+		if config.IsRemote(*fConfig) && *fConfigRefreshInterval > 0 {
+			w := config.NewRemoteWatcher(*fConfig, *fConfigRefreshInterval)
+			go w.Watch(shutdown, reloadChanged(w))
+		}
+
 		log.Printf("Starting Telegraf (version %s)\n", Version)
-		log.Printf("Loaded outputs: %s", strings.Join(c.OutputNames(), " "))
-		log.Printf("Loaded inputs: %s", strings.Join(c.InputNames(), " "))
-		log.Printf("Tags enabled: %s", c.ListTags())
+		log.Printf("Loaded outputs: %s",
+			strings.Join(ag.Config.OutputNames(), " "))
+		log.Printf("Loaded inputs: %s",
+			strings.Join(ag.Config.InputNames(), " "))
+		log.Printf("Tags enabled: %s", ag.Config.ListTags())
 
 		if *fPidfile != "" {
 			f, err := os.Create(*fPidfile)
@@ -268,9 +468,169 @@ func main() {
 
 		ag.Run(shutdown)
 	}
+
+	if ag != nil {
+		ag.Close()
+		if err := ag.SaveState(); err != nil {
+			log.Printf("Error saving the plugin state: %s\n", err)
+		}
+	}
+}
+
+// reloadAgent returns the agent running the config returned by load in
+// place of ag, which is not running anymore. A config which can't be loaded
+// keeps ag running its current config, so that a broken edit of a live
+// config doesn't stop telegraf.
+func reloadAgent(
+	ag *agent.Agent,
+	load func() (*config.Config, error),
+) *agent.Agent {
+	c, err := load()
+	if err != nil {
+		log.Printf("Error reloading the config, keeping the current one: %s\n",
+			err)
+		return ag
+	}
+	// Keep the plugins whose config did not change, as well as the metrics
+	// cached by the outputs.
+	n, err := ag.Reload(c)
+	if err != nil {
+		log.Printf("Error reloading the config, keeping the current one: %s\n",
+			err)
+		return ag
+	}
+	applyFlags(n)
+	if err := setupLogger(n); err != nil {
+		log.Printf("Error setting up the logs of the reloaded config: %s\n",
+			err)
+	}
+	// The outputs which failed to connect are connected again by the next
+	// reload
+	if err := n.Connect(); err != nil {
+		log.Printf("Error connecting the outputs of the reloaded config: %s\n",
+			err)
+	}
+	return n
+}
+
+// applyFlags applies the flags overriding the agent config.
+func applyFlags(ag *agent.Agent) {
+	if *fDebug {
+		ag.Config.Agent.Debug = true
+	}
+	if *fQuiet {
+		ag.Config.Agent.Quiet = true
+	}
+}
+
+// setupLogger sets up the logs as configured for the agent.
+func setupLogger(ag *agent.Agent) error {
+	logLevel := logger.LevelInfo
+	if ag.Config.Agent.Debug {
+		logLevel = logger.LevelDebug
+	}
+	return logger.Setup(logger.Config{
+		Format: ag.Config.Agent.LogFormat,
+		Level:  logLevel,
+		Writer: logWriter,
+
+		Logfile:             ag.Config.Agent.Logfile,
+		RotationInterval:    ag.Config.Agent.LogfileRotationInterval.Duration,
+		RotationMaxSize:     ag.Config.Agent.LogfileRotationMaxSize.Size,
+		RotationMaxArchives: ag.Config.Agent.LogfileRotationMaxArchives,
+	})
+}
+
+// configKeyFile returns the key file of the ENC[...] config values, given by
+// -config-key-file or else $TELEGRAF_CONFIG_KEY_FILE.
+func configKeyFile() string {
+	if *fConfigKeyFile != "" {
+		return *fConfigKeyFile
+	}
+	return os.Getenv("TELEGRAF_CONFIG_KEY_FILE")
+}
+
+// encryptValue prints stdin encrypted as an ENC[...] config value.
+func encryptValue() {
+	if configKeyFile() == "" {
+		log.Fatal("telegraf config encrypt requires -config-key-file")
+	}
+	key, err := file.ReadKey(configKeyFile())
+	if err != nil {
+		log.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	value, err := config.EncryptValue(key, plaintext)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(value)
+}
+
+// loadConfig loads the config file and the config directories given by the
+// flags.
+func loadConfig(inputFilters, outputFilters []string) (*config.Config, error) {
+	c := config.NewConfig()
+	c.OutputFilters = outputFilters
+	c.InputFilters = inputFilters
+	c.RemoteCacheDir = *fConfigCacheDirectory
+	c.ConfigKeyFile = configKeyFile()
+	if err := c.LoadConfig(*fConfig); err != nil {
+		return nil, err
+	}
+
+	if *fConfigDirectoryLegacy != "" {
+		if err := c.LoadDirectory(*fConfigDirectoryLegacy); err != nil {
+			return nil, err
+		}
+	}
+
+	if *fConfigDirectory != "" {
+		if err := c.LoadDirectory(*fConfigDirectory); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.CheckPipelines(); err != nil {
+		return nil, err
+	}
+	// The outputs are not used to test the inputs
+	if len(c.Outputs) == 0 && !*fTest {
+		return nil, fmt.Errorf("Error: no outputs found, did you provide a " +
+			"valid config file?")
+	}
+	if len(c.Inputs) == 0 {
+		return nil, fmt.Errorf("Error: no inputs found, did you provide a " +
+			"valid config file?")
+	}
+	if *fTest {
+		// The filters are split with an empty name at each end
+		for _, name := range inputFilters {
+			if name != "" && !hasInput(c, name) {
+				return nil, fmt.Errorf("Error: input %s is not in the config",
+					name)
+			}
+		}
+	}
+	return c, nil
 }
 
 func usageExit(rc int) {
 	fmt.Println(usage)
 	os.Exit(rc)
 }
+
+func hasInput(c *config.Config, name string) bool {
+	// Legacy support renaming io input to diskio
+	if name == "io" {
+		name = "diskio"
+	}
+	for _, input := range c.Inputs {
+		if input.Name == name {
+			return true
+		}
+	}
+	return false
+}
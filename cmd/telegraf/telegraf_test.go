@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/agent"
+	"github.com/influxdata/telegraf/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadAgent_BrokenConfig(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.OmitHostname = true
+	ag, err := agent.NewAgent(c)
+	require.NoError(t, err)
+
+	// A config failing to load keeps the running agent
+	broken := func() (*config.Config, error) {
+		return nil, errors.New("broken config")
+	}
+	assert.True(t, ag == reloadAgent(ag, broken))
+
+	// So does a config the agent can't run
+	invalid := func() (*config.Config, error) {
+		c := config.NewConfig()
+		c.Agent.OmitHostname = true
+		c.Agent.ShardID, c.Agent.ShardCount = 3, 2
+		return c, nil
+	}
+	assert.True(t, ag == reloadAgent(ag, invalid))
+
+	valid := func() (*config.Config, error) {
+		c := config.NewConfig()
+		c.Agent.OmitHostname = true
+		return c, nil
+	}
+	n := reloadAgent(ag, valid)
+	assert.False(t, ag == n)
+	assert.NotNil(t, n)
+}
+
+func TestLoadConfig_TestInputFilter(t *testing.T) {
+	f, err := ioutil.TempFile("", "telegraf")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("[[inputs.uwsgi]]\n  urls = [\"tcp://127.0.0.1:1717\"]\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	defer func(config string, test bool) {
+		*fConfig, *fTest = config, test
+	}(*fConfig, *fTest)
+	*fConfig, *fTest = f.Name(), true
+
+	// As -test -input-filter uwsgi splits the filters
+	c, err := loadConfig(strings.Split(":uwsgi:", ":"), nil)
+	require.NoError(t, err)
+	assert.Len(t, c.Inputs, 1)
+
+	_, err = loadConfig(strings.Split(":uwsgi:cpu:", ":"), nil)
+	require.Error(t, err)
+	assert.Equal(t, "Error: input cpu is not in the config", err.Error())
+}
@@ -1,5 +1,7 @@
 package telegraf
 
+import "context"
+
 type Input interface {
 	// SampleConfig returns the default configuration of the Input
 	SampleConfig() string
@@ -29,3 +31,46 @@ type ServiceInput interface {
 	// Stop stops the services and closes any necessary channels and connections
 	Stop()
 }
+
+// ContextInput is an Input that can abandon a gather. The agent calls
+// GatherContext instead of Gather, with a context that is cancelled when the
+// gather exceeds its timeout.
+type ContextInput interface {
+	Input
+
+	// GatherContext gathers like Gather, returning early once ctx is done
+	GatherContext(ctx context.Context, acc Accumulator) error
+}
+
+// BackpressureInput is a ServiceInput which can stop accepting metrics, as
+// a listener stops reading from its senders, while the agent is short of
+// memory.
+type BackpressureInput interface {
+	ServiceInput
+
+	// Pause stops accepting metrics until Resume is called
+	Pause()
+
+	// Resume accepts metrics again
+	Resume()
+}
+
+// ShardedInput is an Input gathering a list of targets, like urls or hosts,
+// which the agents of a shard group split between them.
+type ShardedInput interface {
+	Input
+
+	// SetShard restricts the gathers to the targets for which owns returns
+	// true, or to all targets again if owns is nil
+	SetShard(owns func(target string) bool)
+}
+
+// ClosingInput is an Input keeping resources, like connections, open between
+// its gathers. The agent calls Close on the instances it discards, when the
+// input is removed by a reload, restarted by the watchdog or the agent exits.
+type ClosingInput interface {
+	Input
+
+	// Close releases the resources kept by the Input
+	Close() error
+}
@@ -0,0 +1,95 @@
+// Package cluster elects a leader among the agents sharing a lock in etcd,
+// consul or a Kubernetes lease, so that the inputs polling a shared service
+// run on a single agent of the cluster.
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Timeout of the requests to the lock.
+const requestTimeout = 5 * time.Second
+
+// Elector campaigns for the leadership of a cluster.
+type Elector interface {
+	// Campaign acquires the lock if it is free, or renews it if it is held
+	// by this agent, returning whether this agent is the leader.
+	Campaign() (bool, error)
+
+	// Resign releases the lock if it is held by this agent.
+	Resign() error
+}
+
+// NewElector returns the elector of the lock of rawurl, held by id for ttl
+// unless renewed:
+//
+//	etcd://host:port/key, the key with the etcd v2 keys API
+//	consul://host:port/key, the key locked by a consul session
+//	k8s://namespace/name, the Kubernetes lease, from inside the cluster
+//
+// The etcd and consul urls are requested over https if their tls parameter
+// is true.
+func NewElector(rawurl, id string, ttl time.Duration) (Elector, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if ttl < time.Second {
+		return nil, fmt.Errorf("cluster_ttl must be at least 1s, got %s", ttl)
+	}
+	switch u.Scheme {
+	case "etcd":
+		return newEtcdElector(u, id, ttl), nil
+	case "consul":
+		return newConsulElector(u, id, ttl), nil
+	case "k8s":
+		return newLeaseElector(u, id, ttl)
+	}
+	return nil, fmt.Errorf("unsupported cluster url %s", rawurl)
+}
+
+// baseURL returns the http(s) url of the host of u.
+func baseURL(u *url.URL) string {
+	if u.Query().Get("tls") == "true" {
+		return "https://" + u.Host
+	}
+	return "http://" + u.Host
+}
+
+// do sends the request, returning the status and body of the response.
+func do(
+	client *http.Client,
+	method, rawurl, contentType string,
+	body io.Reader,
+	header http.Header,
+) (int, []byte, error) {
+	req, err := http.NewRequest(method, rawurl, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	contents, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, contents, err
+}
+
+// unexpected returns the error of an unexpected response to a request of
+// rawurl.
+func unexpected(method, rawurl string, status int, body []byte) error {
+	return fmt.Errorf("%s %s returned HTTP status %d: %s", method, rawurl,
+		status, body)
+}
@@ -0,0 +1,238 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testElection checks that a of two electors sharing a lock is elected,
+// and b once a resigns.
+func testElection(t *testing.T, a, b Elector) {
+	leader, err := a.Campaign()
+	require.NoError(t, err)
+	assert.True(t, leader)
+	leader, err = b.Campaign()
+	require.NoError(t, err)
+	assert.False(t, leader)
+
+	// Renewing keeps the leadership
+	leader, err = a.Campaign()
+	require.NoError(t, err)
+	assert.True(t, leader)
+
+	require.NoError(t, a.Resign())
+	leader, err = b.Campaign()
+	require.NoError(t, err)
+	assert.True(t, leader)
+	leader, err = a.Campaign()
+	require.NoError(t, err)
+	assert.False(t, leader)
+}
+
+func TestNewElector(t *testing.T) {
+	e, err := NewElector("etcd://localhost:2379/telegraf/leader", "a", 15*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:2379/v2/keys/telegraf/leader",
+		e.(*etcdElector).key)
+
+	e, err = NewElector("consul://localhost:8500/telegraf/leader?tls=true", "a",
+		15*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "https://localhost:8500", e.(*consulElector).addr)
+	assert.Equal(t, "telegraf/leader", e.(*consulElector).key)
+
+	_, err = NewElector("zookeeper://localhost:2181/telegraf", "a", 15*time.Second)
+	assert.Error(t, err)
+	_, err = NewElector("etcd://localhost:2379/telegraf", "a", time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestEtcdElector(t *testing.T) {
+	var mu sync.Mutex
+	var value *string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, "/v2/keys/telegraf/leader", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		if prev, ok := r.Form["prevValue"]; ok {
+			if value == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if *value != prev[0] {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			if r.Method == "DELETE" {
+				value = nil
+			}
+			return
+		}
+		require.Equal(t, "false", r.Form.Get("prevExist"))
+		if value != nil {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		assert.Equal(t, "15", r.Form.Get("ttl"))
+		v := r.Form.Get("value")
+		value = &v
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(strings.Replace(ts.URL, "http", "etcd", 1) +
+		"/telegraf/leader")
+	require.NoError(t, err)
+	testElection(t, newEtcdElector(u, "a", 15*time.Second),
+		newEtcdElector(u, "b", 15*time.Second))
+}
+
+func TestConsulElector(t *testing.T) {
+	var mu sync.Mutex
+	sessions := 0
+	holder := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1/session/create":
+			var req map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "15s", req["TTL"])
+			assert.Equal(t, "delete", req["Behavior"])
+			sessions++
+			fmt.Fprintf(w, `{"ID":"session-%d"}`, sessions)
+		case strings.HasPrefix(r.URL.Path, "/v1/session/"):
+		case r.URL.Path == "/v1/kv/telegraf/leader":
+			if session := r.URL.Query().Get("acquire"); session != "" {
+				if holder == "" || holder == session {
+					holder = session
+					fmt.Fprint(w, "true")
+				} else {
+					fmt.Fprint(w, "false")
+				}
+				return
+			}
+			if holder == r.URL.Query().Get("release") {
+				holder = ""
+			}
+			fmt.Fprint(w, "true")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(strings.Replace(ts.URL, "http", "consul", 1) +
+		"/telegraf/leader")
+	require.NoError(t, err)
+	testElection(t, newConsulElector(u, "a", 15*time.Second),
+		newConsulElector(u, "b", 15*time.Second))
+}
+
+func TestLeaseElector(t *testing.T) {
+	var mu sync.Mutex
+	var current *lease
+	version := 0
+	token := "token"
+	update := func(w http.ResponseWriter, r *http.Request) {
+		var l lease
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&l))
+		if current != nil && l.Metadata.ResourceVersion != current.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		version++
+		l.Metadata.ResourceVersion = strconv.Itoa(version)
+		current = &l
+		json.NewEncoder(w).Encode(current)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, "Bearer "+token, r.Header.Get("Authorization"))
+		leases := "/apis/coordination.k8s.io/v1/namespaces/monitoring/leases"
+		switch {
+		case r.Method == "POST" && r.URL.Path == leases:
+			if current != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			update(w, r)
+		case r.URL.Path == leases+"/telegraf":
+			if current == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method == "PUT" {
+				update(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(current)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "token")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("token\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	newElector := func(id string) *leaseElector {
+		return &leaseElector{
+			client:    ts.Client(),
+			tokenFile: f.Name(),
+			lease:     ts.URL + "/apis/coordination.k8s.io/v1/namespaces/monitoring/leases",
+			id:        id,
+			ttl:       15 * time.Second,
+			namespace: "monitoring",
+			name:      "telegraf",
+		}
+	}
+	a, b := newElector("a"), newElector("b")
+	testElection(t, a, b)
+	assert.Equal(t, 2, current.Spec.LeaseTransitions)
+
+	// An expired lease is taken over
+	current.Spec.RenewTime = time.Now().Add(-time.Minute).UTC().Format(microTime)
+	leader, err := a.Campaign()
+	require.NoError(t, err)
+	assert.True(t, leader)
+	assert.Equal(t, "a", current.Spec.HolderIdentity)
+
+	// The rotated token is sent by the next requests
+	mu.Lock()
+	token = "rotated"
+	mu.Unlock()
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte("rotated\n"), 0600))
+	leader, err = a.Campaign()
+	require.NoError(t, err)
+	assert.True(t, leader)
+}
+
+func TestLeaseElectorURL(t *testing.T) {
+	for _, rawurl := range []string{"k8s://monitoring", "k8s://monitoring/a/b"} {
+		u, err := url.Parse(rawurl)
+		require.NoError(t, err)
+		_, err = newLeaseElector(u, "a", 15*time.Second)
+		assert.Error(t, err)
+	}
+}
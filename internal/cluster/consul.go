@@ -0,0 +1,126 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// consulElector holds the lock by acquiring the key with a session, which
+// is invalidated and releases the key when it isn't renewed within its ttl.
+type consulElector struct {
+	client *http.Client
+	addr   string
+	key    string
+	id     string
+	ttl    time.Duration
+
+	// session is the ID of the consul session, empty if it expired
+	session string
+}
+
+func newConsulElector(u *url.URL, id string, ttl time.Duration) *consulElector {
+	return &consulElector{
+		client: &http.Client{Timeout: requestTimeout},
+		addr:   baseURL(u),
+		key:    strings.TrimPrefix(u.Path, "/"),
+		id:     id,
+		ttl:    ttl,
+	}
+}
+
+func (c *consulElector) Campaign() (bool, error) {
+	if c.session != "" {
+		rawurl := c.addr + "/v1/session/renew/" + c.session
+		status, body, err := do(c.client, "PUT", rawurl, "", nil, nil)
+		if err != nil {
+			return false, err
+		}
+		switch status {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			// The session expired and released the key
+			c.session = ""
+		default:
+			return false, unexpected("PUT", rawurl, status, body)
+		}
+	}
+	if c.session == "" {
+		if err := c.createSession(); err != nil {
+			return false, err
+		}
+	}
+
+	// Acquiring a key already held by the session succeeds
+	rawurl := c.addr + "/v1/kv/" + c.key + "?acquire=" + c.session
+	status, body, err := do(c.client, "PUT", rawurl, "",
+		strings.NewReader(c.id), nil)
+	if err != nil {
+		return false, err
+	}
+	if status != http.StatusOK {
+		return false, unexpected("PUT", rawurl, status, body)
+	}
+	return strings.TrimSpace(string(body)) == "true", nil
+}
+
+func (c *consulElector) Resign() error {
+	if c.session == "" {
+		return nil
+	}
+	rawurl := c.addr + "/v1/kv/" + c.key + "?release=" + c.session
+	status, body, err := do(c.client, "PUT", rawurl, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return unexpected("PUT", rawurl, status, body)
+	}
+
+	rawurl = c.addr + "/v1/session/destroy/" + c.session
+	status, body, err = do(c.client, "PUT", rawurl, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return unexpected("PUT", rawurl, status, body)
+	}
+	c.session = ""
+	return nil
+}
+
+// createSession creates a session deleting the keys it holds when it
+// expires.
+func (c *consulElector) createSession() error {
+	req, err := json.Marshal(map[string]string{
+		"Name":      "telegraf " + c.id,
+		"TTL":       c.ttl.String(),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	})
+	if err != nil {
+		return err
+	}
+	rawurl := c.addr + "/v1/session/create"
+	status, body, err := do(c.client, "PUT", rawurl, "application/json",
+		bytes.NewReader(req), nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return unexpected("PUT", rawurl, status, body)
+	}
+
+	var resp struct {
+		ID string
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("Could not decode consul session of %s: %s", rawurl, err)
+	}
+	c.session = resp.ID
+	return nil
+}
@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etcdElector holds the lock by setting the key to its id with a ttl, only
+// if the key doesn't exist or already holds its id.
+type etcdElector struct {
+	client *http.Client
+	key    string
+	id     string
+	ttl    time.Duration
+}
+
+func newEtcdElector(u *url.URL, id string, ttl time.Duration) *etcdElector {
+	return &etcdElector{
+		client: &http.Client{Timeout: requestTimeout},
+		key:    baseURL(u) + "/v2/keys" + u.Path,
+		id:     id,
+		ttl:    ttl,
+	}
+}
+
+func (e *etcdElector) Campaign() (bool, error) {
+	// Renew the key if it holds our id
+	status, body, err := e.set(url.Values{"prevValue": {e.id}})
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound, http.StatusPreconditionFailed:
+	default:
+		return false, unexpected("PUT", e.key, status, body)
+	}
+
+	// Else create it if nobody holds it
+	status, body, err = e.set(url.Values{"prevExist": {"false"}})
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusPreconditionFailed:
+		return false, nil
+	}
+	return false, unexpected("PUT", e.key, status, body)
+}
+
+func (e *etcdElector) Resign() error {
+	rawurl := e.key + "?" + url.Values{"prevValue": {e.id}}.Encode()
+	status, body, err := do(e.client, "DELETE", rawurl, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK, http.StatusNotFound, http.StatusPreconditionFailed:
+		return nil
+	}
+	return unexpected("DELETE", e.key, status, body)
+}
+
+// set sets the key to the id for the ttl if the conditions hold.
+func (e *etcdElector) set(conditions url.Values) (int, []byte, error) {
+	form := url.Values{
+		"value": {e.id},
+		"ttl":   {strconv.Itoa(int(e.ttl / time.Second))},
+	}
+	for k, v := range conditions {
+		form[k] = v
+	}
+	return do(e.client, "PUT", e.key, "application/x-www-form-urlencoded",
+		strings.NewReader(form.Encode()), nil)
+}
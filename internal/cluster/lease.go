@@ -0,0 +1,222 @@
+package cluster
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Credentials of the service account of the pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Format of the times of a lease.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// leaseElector holds the lock by being the holder of a Kubernetes lease it
+// renews, and takes over the leases held by others once they expire. The
+// updates are conditional on the resourceVersion of the lease, so that only
+// one of the agents racing for it wins.
+type leaseElector struct {
+	client *http.Client
+	// tokenFile is read again for each request, the kubelet rotating the
+	// token of the service account
+	tokenFile string
+	lease     string
+	id        string
+	ttl       time.Duration
+
+	namespace string
+	name      string
+}
+
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions"`
+}
+
+// newLeaseElector returns the elector of the lease of k8s://namespace/name,
+// authenticated with the service account of the pod.
+func newLeaseElector(u *url.URL, id string, ttl time.Duration) (*leaseElector, error) {
+	namespace := u.Host
+	name := strings.Trim(u.Path, "/")
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("cluster url %s must be k8s://namespace/name", u)
+	}
+
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("cluster url %s requires running in Kubernetes, "+
+			"KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set", u)
+	}
+	tokenFile := serviceAccountDir + "/token"
+	if _, err := ioutil.ReadFile(tokenFile); err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("Could not parse the certificates of %s/ca.crt",
+			serviceAccountDir)
+	}
+
+	server := "https://" + net.JoinHostPort(host, port)
+	client := &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+	return &leaseElector{
+		client:    client,
+		tokenFile: tokenFile,
+		lease: server + "/apis/coordination.k8s.io/v1/namespaces/" +
+			namespace + "/leases",
+		id:        id,
+		ttl:       ttl,
+		namespace: namespace,
+		name:      name,
+	}, nil
+}
+
+func (l *leaseElector) Campaign() (bool, error) {
+	current, err := l.get()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if current == nil {
+		current = &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: l.name, Namespace: l.namespace},
+		}
+	} else if current.Spec.HolderIdentity != l.id &&
+		current.Spec.HolderIdentity != "" && !expired(current, now) {
+		return false, nil
+	}
+
+	if current.Spec.HolderIdentity != l.id {
+		current.Spec.HolderIdentity = l.id
+		current.Spec.AcquireTime = now.UTC().Format(microTime)
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.LeaseDurationSeconds = int(l.ttl / time.Second)
+	current.Spec.RenewTime = now.UTC().Format(microTime)
+	return l.put(current)
+}
+
+func (l *leaseElector) Resign() error {
+	current, err := l.get()
+	if err != nil || current == nil || current.Spec.HolderIdentity != l.id {
+		return err
+	}
+	current.Spec.HolderIdentity = ""
+	_, err = l.put(current)
+	return err
+}
+
+// get returns the lease, nil if it doesn't exist.
+func (l *leaseElector) get() (*lease, error) {
+	rawurl := l.lease + "/" + l.name
+	header, err := l.header()
+	if err != nil {
+		return nil, err
+	}
+	status, body, err := do(l.client, "GET", rawurl, "", nil, header)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, unexpected("GET", rawurl, status, body)
+	}
+
+	current := &lease{}
+	if err := json.Unmarshal(body, current); err != nil {
+		return nil, fmt.Errorf("Could not decode lease of %s: %s", rawurl, err)
+	}
+	return current, nil
+}
+
+// put creates the lease, or updates it if it has a resourceVersion,
+// returning false if it was modified concurrently.
+func (l *leaseElector) put(update *lease) (bool, error) {
+	contents, err := json.Marshal(update)
+	if err != nil {
+		return false, err
+	}
+	method, rawurl := "POST", l.lease
+	if update.Metadata.ResourceVersion != "" {
+		method, rawurl = "PUT", l.lease+"/"+l.name
+	}
+	header, err := l.header()
+	if err != nil {
+		return false, err
+	}
+	status, body, err := do(l.client, method, rawurl, "application/json",
+		bytes.NewReader(contents), header)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	}
+	return false, unexpected(method, rawurl, status, body)
+}
+
+// header returns the header authenticating a request with the current token
+// of the service account.
+func (l *leaseElector) header() (http.Header, error) {
+	token, err := ioutil.ReadFile(l.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return http.Header{"Authorization": {
+		"Bearer " + strings.TrimSpace(string(token))}}, nil
+}
+
+// expired returns whether the holder of the lease didn't renew it within
+// its duration.
+func expired(current *lease, now time.Time) bool {
+	renewed, err := time.Parse(time.RFC3339Nano, current.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	duration := time.Duration(current.Spec.LeaseDurationSeconds) * time.Second
+	return now.After(renewed.Add(duration))
+}
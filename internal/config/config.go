@@ -2,23 +2,30 @@ package config
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/logger"
 	"github.com/influxdata/telegraf/internal/models"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/plugins/secretstores"
 	"github.com/influxdata/telegraf/plugins/serializers"
 
 	"github.com/influxdata/config"
@@ -36,6 +43,13 @@ var (
 
 	// envVarRe is a regex to find environment variables in the config file
 	envVarRe = regexp.MustCompile(`\$\w+`)
+
+	// bracedEnvVarRe is a regex to find the ${VAR}, ${VAR:-default} and
+	// ${VAR:?message} environment variables
+	bracedEnvVarRe = regexp.MustCompile(`\$\{(\w+)(?::([-?])([^}]*))?\}`)
+
+	// secretRe is a regex to find the @{store:key} secret references
+	secretRe = regexp.MustCompile(`@\{([^:}]+):([^}]+)\}`)
 )
 
 // Config specifies the URL/user/password for the database that telegraf
@@ -49,6 +63,22 @@ type Config struct {
 	Agent   *AgentConfig
 	Inputs  []*internal_models.RunningInput
 	Outputs []*internal_models.RunningOutput
+
+	// Pipelines by name, besides the default pipeline of the plugins
+	// without a pipeline option
+	Pipelines map[string]*PipelineConfig
+
+	// SecretStores resolving the @{store:key} references, by id
+	SecretStores map[string]telegraf.SecretStore
+
+	// RemoteCacheDir is the directory caching the remote configs, see
+	// ReadRemote
+	RemoteCacheDir string
+
+	// ConfigKeyFile is the file of the hex encoded key decrypting the
+	// ENC[...] values
+	ConfigKeyFile  string
+	configKeyCache []byte
 }
 
 func NewConfig() *Config {
@@ -59,6 +89,13 @@ func NewConfig() *Config {
 			RoundInterval: true,
 			FlushInterval: internal.Duration{Duration: 10 * time.Second},
 			FlushJitter:   internal.Duration{Duration: 5 * time.Second},
+
+			ShutdownFlushTimeout:      internal.Duration{Duration: 5 * time.Second},
+			GlobalTagsRefreshInterval: internal.Duration{Duration: time.Minute},
+			ClusterTTL:                internal.Duration{Duration: 15 * time.Second},
+
+			LogfileRotationMaxArchives: 5,
+			WatchdogFailures:           3,
 		},
 
 		Tags:          make(map[string]string),
@@ -66,10 +103,44 @@ func NewConfig() *Config {
 		Outputs:       make([]*internal_models.RunningOutput, 0),
 		InputFilters:  make([]string, 0),
 		OutputFilters: make([]string, 0),
+		SecretStores:  make(map[string]telegraf.SecretStore),
+		Pipelines:     make(map[string]*PipelineConfig),
 	}
 	return c
 }
 
+// PipelineConfig is a [pipelines.name] section: the inputs and outputs with
+// pipeline = "name" are isolated from the other plugins, the metrics of the
+// inputs only reach the outputs of the pipeline, which are flushed on its
+// own schedule. The settings of the agent apply when a setting is 0.
+type PipelineConfig struct {
+	Name string
+
+	FlushInterval     internal.Duration
+	FlushJitter       internal.Duration
+	MetricBufferLimit int
+}
+
+// CheckPipelines returns an error if a plugin is in a pipeline which has no
+// [pipelines] section.
+func (c *Config) CheckPipelines() error {
+	for _, input := range c.Inputs {
+		name := input.Config.Pipeline
+		if _, ok := c.Pipelines[name]; name != "" && !ok {
+			return fmt.Errorf("Error: input %s is in the undefined pipeline %s",
+				input.Name, name)
+		}
+	}
+	for _, o := range c.Outputs {
+		name := o.Config.Pipeline
+		if _, ok := c.Pipelines[name]; name != "" && !ok {
+			return fmt.Errorf("Error: output %s is in the undefined pipeline %s",
+				o.Name, name)
+		}
+	}
+	return nil
+}
+
 type AgentConfig struct {
 	// Interval at which to gather information
 	Interval internal.Duration
@@ -84,6 +155,15 @@ type AgentConfig struct {
 	// same time, which can have a measurable effect on the system.
 	CollectionJitter internal.Duration
 
+	// GatherTimeout is the deadline of the gathers of the inputs, their
+	// interval if 0
+	GatherTimeout internal.Duration
+
+	// WatchdogFailures is the number of consecutive gathers of an input
+	// timing out or panicking after which the input is restarted, 0 never
+	// restarts the inputs
+	WatchdogFailures int
+
 	// FlushInterval is the Interval at which to flush data
 	FlushInterval internal.Duration
 
@@ -98,6 +178,15 @@ type AgentConfig struct {
 	// full, the oldest metrics will be overwritten.
 	MetricBufferLimit int
 
+	// MaxMemory is the memory the agent keeps below by shrinking the
+	// buffers of the outputs and pausing the backpressure inputs, no limit
+	// if 0
+	MaxMemory internal.Size
+
+	// ShutdownFlushTimeout bounds the flush of the cached metrics when
+	// telegraf stops, unbounded if 0
+	ShutdownFlushTimeout internal.Duration
+
 	// FlushBufferWhenFull tells Telegraf to flush the metric buffer whenever
 	// it fills up, regardless of FlushInterval. Setting this option to true
 	// does _not_ deactivate FlushInterval.
@@ -113,9 +202,67 @@ type AgentConfig struct {
 	Debug bool
 
 	// Quiet is the option for running in quiet mode
-	Quiet        bool
+	Quiet bool
+
+	// LogFormat is the format of the logs, "text" or "json"
+	LogFormat string
+
+	// Logfile is the file receiving the logs instead of stderr if set,
+	// rotated once older than LogfileRotationInterval or larger than
+	// LogfileRotationMaxSize, either disabled if 0. Only the
+	// LogfileRotationMaxArchives newest rotated files are kept, all of them
+	// if -1.
+	Logfile                    string
+	LogfileRotationInterval    internal.Duration
+	LogfileRotationMaxSize     internal.Size
+	LogfileRotationMaxArchives int
+
 	Hostname     string
 	OmitHostname bool
+
+	// GlobalTagsFile is a file of global tags, overriding the [global_tags]
+	// of the config, read again every GlobalTagsRefreshInterval if not 0
+	GlobalTagsFile            string
+	GlobalTagsRefreshInterval internal.Duration
+
+	// HealthAddress is the address of the HTTP server of the /healthz and
+	// /metrics endpoints, disabled if empty
+	HealthAddress string
+
+	// Statefile is the file keeping the state of the plugins across
+	// restarts, none if empty
+	Statefile string
+
+	// ControlAddress is the address of the gRPC control API, a unix socket
+	// or a loopback address, disabled if empty
+	ControlAddress string
+	// ControlOutputs allows adding outputs through the control API
+	ControlOutputs bool
+
+	// TraceSampleRate is the fraction of the gathered metrics traced
+	// through the agent, tracing is disabled if 0
+	TraceSampleRate float64
+
+	// DedupWindow is the window in which the metrics of a series and
+	// timestamp already routed to the outputs are dropped, disabled if 0
+	DedupWindow internal.Duration
+	// DedupFields adds the fields of the metrics to their series, so that
+	// only identical metrics are dropped
+	DedupFields bool
+
+	// Cluster is the url of the lock electing the agent running the
+	// singleton inputs among the agents sharing it, held for ClusterTTL
+	// unless renewed. ClusterNodeID identifies the agent in the cluster, its
+	// hostname if empty.
+	Cluster       string
+	ClusterTTL    internal.Duration
+	ClusterNodeID string
+
+	// ShardID is the shard, from 0 to ShardCount-1, of the targets of the
+	// sharded inputs gathered by the agent, all targets if ShardCount is 0
+	// or 1
+	ShardID    int
+	ShardCount int
 }
 
 // Inputs returns a list of strings of the configured inputs.
@@ -164,7 +311,9 @@ var header = `# Telegraf Configuration
 # Environment variables can be used anywhere in this config file, simply prepend
 # them with $. For strings the variable must be within quotes (ie, "$STR_VAR"),
 # for numbers and booleans they should be plain (ie, $INT_VAR, $BOOL_VAR)
+`
 
+var globalTagsConfig = `
 
 # Global tags can be specified here in key="value" format.
 [global_tags]
@@ -172,7 +321,9 @@ var header = `# Telegraf Configuration
   # rack = "1a"
   ## Environment variables can be used as tags, and throughout the config file
   # user = "$USER"
+`
 
+var agentConfig = `
 
 # Configuration for telegraf agent
 [agent]
@@ -187,12 +338,23 @@ var header = `# Telegraf Configuration
   metric_buffer_limit = 1000
   ## Flush the buffer whenever full, regardless of flush_interval.
   flush_buffer_when_full = true
+  ## Shrink the buffers of the outputs and pause the inputs supporting
+  ## backpressure when the memory of telegraf approaches this size, instead
+  ## of being killed for running out of memory.
+  # max_memory = "256MB"
 
   ## Collection jitter is used to jitter the collection by a random amount.
   ## Each plugin will sleep for a random time within jitter before collecting.
   ## This can be used to avoid many plugins querying things like sysfs at the
   ## same time, which can have a measurable effect on the system.
   collection_jitter = "0s"
+  ## Abandon the gathers of the inputs exceeding this timeout, so that a stuck
+  ## input can't delay the others. Defaults to the interval of the input.
+  # gather_timeout = "10s"
+
+  ## Restart the inputs whose gathers time out or panic this many times in a
+  ## row, service inputs are stopped and started again. 0 never restarts them.
+  watchdog_failures = 3
 
   ## Default flushing interval for all outputs. You shouldn't set this below
   ## interval. Maximum flush_interval will be flush_interval + flush_jitter
@@ -201,16 +363,77 @@ var header = `# Telegraf Configuration
   ## large write spikes for users running a large number of telegraf instances.
   ## ie, a jitter of 5s and interval 10s means flushes will happen every 10-15s
   flush_jitter = "0s"
+  ## Give up flushing the cached metrics when telegraf stops after this
+  ## timeout, so that an unreachable output can't block the shutdown, 0 waits
+  ## for the outputs
+  shutdown_flush_timeout = "5s"
 
   ## Run telegraf in debug mode
   debug = false
   ## Run telegraf in quiet mode
   quiet = false
+  ## Format of the logs, "text" or "json". The log level of a plugin can be
+  ## raised to debug with log_level = "debug" in its section.
+  # log_format = "text"
+  ## Log to this file instead of stderr
+  # logfile = "/var/log/telegraf/telegraf.log"
+  ## Rotate the logfile once it is older than the interval or larger than the
+  ## size, 0 disables either, keeping the given number of rotated files, or
+  ## all of them with -1
+  # logfile_rotation_interval = "24h"
+  # logfile_rotation_max_size = "10MB"
+  # logfile_rotation_max_archives = 5
   ## Override default hostname, if empty use os.Hostname()
   hostname = ""
   ## If set to true, do no set the "host" tag in the telegraf agent.
   omit_hostname = false
+  ## Add the tags of this file to all metrics, overriding the [global_tags],
+  ## as key = "value" pairs or a JSON object if it ends in .json. The file
+  ## is read again every global_tags_refresh_interval, 0 reads it once.
+  # global_tags_file = "/etc/telegraf/tags.toml"
+  # global_tags_refresh_interval = "1m"
+  ## Serve the health of telegraf on http://<health_address>/healthz, which
+  ## fails when outputs can't write or inputs are late to gather, and its
+  ## statistics in the Prometheus format on /metrics
+  # health_address = ":8080"
+  ## Keep the state of plugins across restarts in this file, like the
+  ## baselines of the uwsgi delta fields
+  # statefile = "/var/lib/telegraf/state.json"
+  ## Serve the gRPC control API on this address, to list the plugins,
+  ## pause, resume or trigger them and fetch their recent errors. The API
+  ## has no authentication, only unix sockets and loopback addresses are
+  ## allowed: anyone able to connect controls the plugins.
+  # control_address = "localhost:7070"
+  # control_address = "unix:///var/run/telegraf/control.sock"
+  ## Allow adding outputs through the control API. Anyone able to connect
+  ## can then run commands as telegraf, with the execd output, and send the
+  ## metrics anywhere. The configs sent can't use environment variables,
+  ## secrets or encrypted values.
+  # control_outputs = false
+  ## Trace this fraction of the gathered metrics through the agent, reporting
+  ## the time they spent queued, buffered by each output and written in the
+  ## trace measurement of the internal input
+  # trace_sample_rate = 0.001
+  ## Drop the metrics of the same name, tags and timestamp as a metric
+  ## received within this window, as reported by redundant inputs or agents.
+  ## With dedup_fields the fields must match too.
+  # dedup_window = "0s"
+  # dedup_fields = false
+  ## Elect a leader among the agents sharing this lock, which alone runs the
+  ## inputs with singleton = true, as an etcd://host:2379/key,
+  ## consul://host:8500/key or k8s://namespace/lease url. The leader is
+  ## replaced when it hasn't renewed the lock for cluster_ttl.
+  # cluster = "consul://localhost:8500/telegraf/leader"
+  # cluster_ttl = "15s"
+  # cluster_node_id = ""
+  ## Split the targets of the inputs supporting sharding, like the urls of
+  ## the uwsgi input, between shard_count agents with the same config, each
+  ## gathering the targets of its shard_id, from 0 to shard_count - 1.
+  # shard_id = 0
+  # shard_count = 1
+`
 
+var outputHeader = `
 
 ###############################################################################
 #                            OUTPUT PLUGINS                                   #
@@ -231,10 +454,59 @@ var serviceInputHeader = `
 ###############################################################################
 `
 
-// PrintSampleConfig prints the sample config
-func PrintSampleConfig(inputFilters []string, outputFilters []string) {
-	fmt.Printf(header)
+// Sections of the sample config, in order.
+var sections = []string{"global_tags", "agent", "outputs", "inputs"}
+
+// PrintSampleConfig prints the sample config, restricted to the sections of
+// sectionFilters if any, like "agent" or "inputs". The plugins are
+// restricted to the inputs of inputFilters and the outputs of outputFilters,
+// else the default plugins are printed and the others commented out.
+func PrintSampleConfig(
+	sectionFilters []string,
+	inputFilters []string,
+	outputFilters []string,
+) error {
+	for _, section := range sectionFilters {
+		if section != "" && !sliceContains(section, sections) {
+			return fmt.Errorf("Unknown config section %s, the sections are %s",
+				section, strings.Join(sections, ", "))
+		}
+	}
+	printAll := true
+	for _, section := range sectionFilters {
+		if section != "" {
+			printAll = false
+		}
+	}
+	printSection := func(section string) bool {
+		return printAll || sliceContains(section, sectionFilters)
+	}
+
+	if printAll {
+		fmt.Printf(header)
+	}
+	if printSection("global_tags") {
+		fmt.Printf(globalTagsConfig)
+	}
+	if printSection("agent") {
+		fmt.Printf(agentConfig)
+	}
+	if printSection("outputs") {
+		if printAll {
+			fmt.Printf(outputHeader)
+		}
+		printOutputs(outputFilters)
+	}
+	if printSection("inputs") {
+		if printAll {
+			fmt.Printf(inputHeader)
+		}
+		printInputs(inputFilters)
+	}
+	return nil
+}
 
+func printOutputs(outputFilters []string) {
 	if len(outputFilters) != 0 {
 		printFilteredOutputs(outputFilters, false)
 	} else {
@@ -249,8 +521,9 @@ func PrintSampleConfig(inputFilters []string, outputFilters []string) {
 		sort.Strings(pnames)
 		printFilteredOutputs(pnames, true)
 	}
+}
 
-	fmt.Printf(inputHeader)
+func printInputs(inputFilters []string) {
 	if len(inputFilters) != 0 {
 		printFilteredInputs(inputFilters, false)
 	} else {
@@ -363,6 +636,49 @@ func sliceContains(name string, list []string) bool {
 	return false
 }
 
+// PrintPlugins prints the registered inputs and outputs with their
+// descriptions, restricted to the "inputs" or "outputs" of sectionFilters
+// if any.
+func PrintPlugins(sectionFilters []string) {
+	printAll := true
+	for _, section := range sectionFilters {
+		if section != "" {
+			printAll = false
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if printAll || sliceContains("inputs", sectionFilters) {
+		var names []string
+		for name := range inputs.Inputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintln(w, "Inputs:")
+		for _, name := range names {
+			input := inputs.Inputs[name]()
+			kind := ""
+			if _, ok := input.(telegraf.ServiceInput); ok {
+				kind = " (service)"
+			}
+			fmt.Fprintf(w, "  %s%s\t%s\n", name, kind, input.Description())
+		}
+	}
+	if printAll || sliceContains("outputs", sectionFilters) {
+		var names []string
+		for name := range outputs.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintln(w, "Outputs:")
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s\t%s\n", name,
+				outputs.Outputs[name]().Description())
+		}
+	}
+	w.Flush()
+}
+
 // PrintInputConfig prints the config usage of a single input.
 func PrintInputConfig(name string) error {
 	if creator, ok := inputs.Inputs[name]; ok {
@@ -406,11 +722,51 @@ func (c *Config) LoadDirectory(path string) error {
 
 // LoadConfig loads the given config file and applies it to c
 func (c *Config) LoadConfig(path string) error {
-	tbl, err := parseFile(path)
+	var tbl *ast.Table
+	var err error
+	if IsRemote(path) {
+		var contents []byte
+		contents, err = ReadRemote(path, c.RemoteCacheDir)
+		if err == nil {
+			tbl, err = parseConfig(contents)
+		}
+	} else {
+		tbl, err = parseFile(path)
+	}
 	if err != nil {
 		return fmt.Errorf("Error parsing %s, %s", path, err)
 	}
 
+	// The secret stores are set up first, as the rest of the file and the
+	// files loaded after it can reference their secrets.
+	if val, ok := tbl.Fields["secretstores"]; ok {
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			return fmt.Errorf("%s: invalid configuration", path)
+		}
+		for storeName, storeVal := range subTable.Fields {
+			switch storeSubTable := storeVal.(type) {
+			case *ast.Table:
+				if err = c.addSecretStore(storeName, storeSubTable); err != nil {
+					return fmt.Errorf("Error parsing %s, %s", path, err)
+				}
+			case []*ast.Table:
+				for _, t := range storeSubTable {
+					if err = c.addSecretStore(storeName, t); err != nil {
+						return fmt.Errorf("Error parsing %s, %s", path, err)
+					}
+				}
+			default:
+				return fmt.Errorf("Unsupported config format: %s, file %s",
+					storeName, path)
+			}
+		}
+		delete(tbl.Fields, "secretstores")
+	}
+	if err = c.resolveSecrets(tbl); err != nil {
+		return fmt.Errorf("Error parsing %s, %s", path, err)
+	}
+
 	for name, val := range tbl.Fields {
 		subTable, ok := val.(*ast.Table)
 		if !ok {
@@ -423,28 +779,43 @@ func (c *Config) LoadConfig(path string) error {
 				log.Printf("Could not parse [agent] config\n")
 				return fmt.Errorf("Error parsing %s, %s", path, err)
 			}
+			if c.Agent.TraceSampleRate < 0 || c.Agent.TraceSampleRate > 1 {
+				return fmt.Errorf("Error parsing %s, trace_sample_rate must "+
+					"be between 0 and 1, got %v", path, c.Agent.TraceSampleRate)
+			}
+			if c.Agent.LogfileRotationMaxArchives < -1 {
+				return fmt.Errorf("Error parsing %s, "+
+					"logfile_rotation_max_archives must be -1 or more, got %d",
+					path, c.Agent.LogfileRotationMaxArchives)
+			}
+			switch c.Agent.LogFormat {
+			case "", "text", "json":
+			default:
+				return fmt.Errorf("Error parsing %s, log_format must be text "+
+					"or json, got %q", path, c.Agent.LogFormat)
+			}
+		case "pipelines":
+			for pipelineName, pipelineVal := range subTable.Fields {
+				pipelineTable, ok := pipelineVal.(*ast.Table)
+				if !ok {
+					return fmt.Errorf("Unsupported config format: pipeline %s, "+
+						"file %s", pipelineName, path)
+				}
+				pc := &PipelineConfig{Name: pipelineName}
+				if err = config.UnmarshalTable(pipelineTable, pc); err != nil {
+					return fmt.Errorf("Error parsing %s, pipeline %s: %s", path,
+						pipelineName, err)
+				}
+				c.Pipelines[pipelineName] = pc
+			}
 		case "global_tags", "tags":
 			if err = config.UnmarshalTable(subTable, c.Tags); err != nil {
 				log.Printf("Could not parse [global_tags] config\n")
 				return fmt.Errorf("Error parsing %s, %s", path, err)
 			}
 		case "outputs":
-			for pluginName, pluginVal := range subTable.Fields {
-				switch pluginSubTable := pluginVal.(type) {
-				case *ast.Table:
-					if err = c.addOutput(pluginName, pluginSubTable); err != nil {
-						return fmt.Errorf("Error parsing %s, %s", path, err)
-					}
-				case []*ast.Table:
-					for _, t := range pluginSubTable {
-						if err = c.addOutput(pluginName, t); err != nil {
-							return fmt.Errorf("Error parsing %s, %s", path, err)
-						}
-					}
-				default:
-					return fmt.Errorf("Unsupported config format: %s, file %s",
-						pluginName, path)
-				}
+			if err = c.addOutputs(subTable, path); err != nil {
+				return err
 			}
 		case "inputs", "plugins":
 			for pluginName, pluginVal := range subTable.Fields {
@@ -475,6 +846,61 @@ func (c *Config) LoadConfig(path string) error {
 	return nil
 }
 
+// addOutputs adds the outputs of the [outputs] table of the config at path.
+func (c *Config) addOutputs(tbl *ast.Table, path string) error {
+	for pluginName, pluginVal := range tbl.Fields {
+		switch pluginSubTable := pluginVal.(type) {
+		case *ast.Table:
+			if err := c.addOutput(pluginName, pluginSubTable); err != nil {
+				return fmt.Errorf("Error parsing %s, %s", path, err)
+			}
+		case []*ast.Table:
+			for _, t := range pluginSubTable {
+				if err := c.addOutput(pluginName, t); err != nil {
+					return fmt.Errorf("Error parsing %s, %s", path, err)
+				}
+			}
+		default:
+			return fmt.Errorf("Unsupported config format: %s, file %s",
+				pluginName, path)
+		}
+	}
+	return nil
+}
+
+// LoadOutputs returns the outputs of contents, a config holding only
+// [[outputs.x]] sections, built with the agent settings of c. They are not
+// added to c. The configs come from the control API, their references to
+// the environment variables, secrets and encrypted values are refused for
+// them not to be sent to the outputs.
+func (c *Config) LoadOutputs(contents []byte) ([]*internal_models.RunningOutput, error) {
+	for _, re := range []*regexp.Regexp{bracedEnvVarRe, envVarRe, secretRe, encryptedRe} {
+		if ref := re.Find(contents); ref != nil {
+			return nil, fmt.Errorf("Error parsing outputs, %s: environment "+
+				"variables, secrets and encrypted values are not allowed", ref)
+		}
+	}
+	tbl, err := toml.Parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing outputs, %s", err)
+	}
+
+	outputs := *c
+	outputs.Outputs = nil
+	outputs.OutputFilters = nil
+	for name, val := range tbl.Fields {
+		subTable, ok := val.(*ast.Table)
+		if !ok || name != "outputs" {
+			return nil, fmt.Errorf("Error parsing outputs, only " +
+				"[[outputs.x]] sections are supported")
+		}
+		if err := outputs.addOutputs(subTable, "outputs"); err != nil {
+			return nil, err
+		}
+	}
+	return outputs.Outputs, nil
+}
+
 // parseFile loads a TOML configuration from a provided path and
 // returns the AST produced from the TOML parser. When loading the file, it
 // will find environment variables and replace them.
@@ -483,6 +909,16 @@ func parseFile(fpath string) (*ast.Table, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseConfig(contents)
+}
+
+// parseConfig replaces the environment variables of the config contents and
+// parses them.
+func parseConfig(contents []byte) (*ast.Table, error) {
+	contents, err := substituteBracedEnvVars(contents)
+	if err != nil {
+		return nil, err
+	}
 
 	env_vars := envVarRe.FindAll(contents, -1)
 	for _, env_var := range env_vars {
@@ -495,6 +931,128 @@ func parseFile(fpath string) (*ast.Table, error) {
 	return toml.Parse(contents)
 }
 
+// substituteBracedEnvVars replaces the ${VAR} environment variables of the
+// lines which are not comments. ${VAR:-default} is replaced by default if VAR
+// is unset or empty. An error lists the variables which are unset or empty
+// without a default, using the message of ${VAR:?message} if given.
+func substituteBracedEnvVars(contents []byte) ([]byte, error) {
+	var missing []string
+	lines := bytes.Split(contents, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) {
+			continue
+		}
+		lines[i] = bracedEnvVarRe.ReplaceAllFunc(line, func(v []byte) []byte {
+			m := bracedEnvVarRe.FindSubmatch(v)
+			name, op, arg := string(m[1]), string(m[2]), string(m[3])
+			if val := os.Getenv(name); val != "" {
+				return []byte(val)
+			}
+			switch op {
+			case "-":
+				return []byte(arg)
+			case "?":
+				if arg != "" {
+					missing = append(missing, name+" ("+arg+")")
+					return v
+				}
+			}
+			missing = append(missing, name)
+			return v
+		})
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required environment variables: %s",
+			strings.Join(missing, ", "))
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+func (c *Config) addSecretStore(name string, table *ast.Table) error {
+	creator, ok := secretstores.SecretStores[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested secret store: %s", name)
+	}
+	store := creator()
+
+	// Stores are referenced by their id, which defaults to their name
+	id := name
+	if node, ok := table.Fields["id"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				id = str.Value
+			}
+		}
+	}
+	delete(table.Fields, "id")
+
+	if err := config.UnmarshalTable(table, store); err != nil {
+		return err
+	}
+	if _, ok := c.SecretStores[id]; ok {
+		return fmt.Errorf("Duplicate secret store id: %s", id)
+	}
+	c.SecretStores[id] = store
+	return nil
+}
+
+// resolveSecrets decrypts the ENC[...] values and replaces the @{store:key}
+// references in the string values of the table and its subtables with the
+// secrets.
+func (c *Config) resolveSecrets(tbl *ast.Table) error {
+	for _, val := range tbl.Fields {
+		var err error
+		switch v := val.(type) {
+		case *ast.Table:
+			err = c.resolveSecrets(v)
+		case []*ast.Table:
+			for _, t := range v {
+				if err = c.resolveSecrets(t); err != nil {
+					break
+				}
+			}
+		case *ast.KeyValue:
+			err = c.resolveValue(v.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) resolveValue(val ast.Value) error {
+	switch v := val.(type) {
+	case *ast.String:
+		var err error
+		if v.Value, err = c.decryptValues(v.Value); err != nil {
+			return err
+		}
+		v.Value = secretRe.ReplaceAllStringFunc(v.Value, func(ref string) string {
+			m := secretRe.FindStringSubmatch(ref)
+			store, ok := c.SecretStores[m[1]]
+			if !ok {
+				err = fmt.Errorf("Undefined secret store in %s", ref)
+				return ref
+			}
+			secret, e := store.Get(m[2])
+			if e != nil {
+				err = fmt.Errorf("Could not resolve %s, %s", ref, e)
+				return ref
+			}
+			return secret
+		})
+		return err
+	case *ast.Array:
+		for _, elem := range v.Value {
+			if err := c.resolveValue(elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *Config) addOutput(name string, table *ast.Table) error {
 	if len(c.OutputFilters) > 0 && !sliceContains(name, c.OutputFilters) {
 		return nil
@@ -504,6 +1062,7 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 		return fmt.Errorf("Undefined but requested output: %s", name)
 	}
 	output := creator()
+	fp := fingerprint(name, table)
 
 	// If the output has a SetSerializer function, then this means it can write
 	// arbitrary types of output, so build the serializer and set it.
@@ -526,10 +1085,17 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 	}
 
 	ro := internal_models.NewRunningOutput(name, output, outputConfig)
+	ro.Fingerprint = fp
+	setLogger(output, ro.Log)
 	if c.Agent.MetricBufferLimit > 0 {
 		ro.MetricBufferLimit = c.Agent.MetricBufferLimit
 	}
 	ro.FlushBufferWhenFull = c.Agent.FlushBufferWhenFull
+	if outputConfig.DeadLetterFile != "" {
+		ro.DeadLetter = &internal_models.DeadLetterFile{
+			Path: outputConfig.DeadLetterFile,
+		}
+	}
 	c.Outputs = append(c.Outputs, ro)
 	return nil
 }
@@ -547,17 +1113,13 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 	if !ok {
 		return fmt.Errorf("Undefined but requested input: %s", name)
 	}
-	input := creator()
+	fp := fingerprint(name, table)
 
 	// If the input has a SetParser function, then this means it can accept
 	// arbitrary types of input, so build the parser and set it.
-	switch t := input.(type) {
-	case parsers.ParserInput:
-		parser, err := buildParser(name, table)
-		if err != nil {
-			return err
-		}
-		t.SetParser(parser)
+	var parserConfig *parsers.Config
+	if _, ok := creator().(parsers.ParserInput); ok {
+		parserConfig = buildParserConfig(name, table)
 	}
 
 	pluginConfig, err := buildInput(name, table)
@@ -565,19 +1127,101 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 		return err
 	}
 
-	if err := config.UnmarshalTable(table, input); err != nil {
+	l := logger.New("inputs."+name, pluginConfig.LogLevel)
+	// newInput creates an instance of the input, again when it is restarted
+	newInput := func() (telegraf.Input, error) {
+		input := creator()
+		if t, ok := input.(parsers.ParserInput); ok {
+			parser, err := parsers.NewParser(parserConfig)
+			if err != nil {
+				return nil, err
+			}
+			t.SetParser(parser)
+		}
+		if err := config.UnmarshalTable(table, input); err != nil {
+			return nil, err
+		}
+		setLogger(input, l)
+		return input, nil
+	}
+	input, err := newInput()
+	if err != nil {
 		return err
 	}
 
 	rp := &internal_models.RunningInput{
-		Name:   name,
-		Input:  input,
-		Config: pluginConfig,
+		Name:        name,
+		Input:       input,
+		Config:      pluginConfig,
+		Fingerprint: fp,
+		Log:         l,
+		New:         newInput,
 	}
 	c.Inputs = append(c.Inputs, rp)
 	return nil
 }
 
+// setLogger sets the Log field of the plugin to its logger, if it has one.
+func setLogger(plugin interface{}, l telegraf.Logger) {
+	v := reflect.ValueOf(plugin)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	field := v.Elem().FieldByName("Log")
+	if field.IsValid() && field.CanSet() &&
+		field.Type() == reflect.TypeOf((*telegraf.Logger)(nil)).Elem() {
+		field.Set(reflect.ValueOf(l))
+	}
+}
+
+// fingerprint returns a checksum of the configuration of a plugin, which
+// only changes when one of its settings does.
+func fingerprint(name string, table *ast.Table) string {
+	b, err := json.Marshal([]interface{}{name, tableValues(table)})
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha1.Sum(b))
+}
+
+// tableValues returns the values of a TOML node as plain Go values,
+// dropping their position in the file.
+func tableValues(node interface{}) interface{} {
+	switch n := node.(type) {
+	case *ast.Table:
+		fields := make(map[string]interface{}, len(n.Fields))
+		for k, v := range n.Fields {
+			fields[k] = tableValues(v)
+		}
+		return fields
+	case []*ast.Table:
+		tables := make([]interface{}, len(n))
+		for i, t := range n {
+			tables[i] = tableValues(t)
+		}
+		return tables
+	case *ast.KeyValue:
+		return tableValues(n.Value)
+	case *ast.Array:
+		values := make([]interface{}, len(n.Value))
+		for i, v := range n.Value {
+			values[i] = tableValues(v)
+		}
+		return values
+	case *ast.String:
+		return n.Value
+	case *ast.Integer:
+		return n.Value
+	case *ast.Float:
+		return n.Value
+	case *ast.Boolean:
+		return n.Value
+	case *ast.Datetime:
+		return n.Value
+	}
+	return nil
+}
+
 // buildFilter builds a Filter
 // (tagpass/tagdrop/namepass/namedrop/fieldpass/fielddrop) to
 // be inserted into the internal_models.OutputConfig/internal_models.InputConfig to be used for prefix
@@ -704,12 +1348,33 @@ func buildInput(name string, tbl *ast.Table) (*internal_models.InputConfig, erro
 				if err != nil {
 					return nil, err
 				}
+				if dur < 0 {
+					return nil, fmt.Errorf("interval of input %s must not be "+
+						"negative, got %s", name, str.Value)
+				}
 
 				cp.Interval = dur
 			}
 		}
 	}
 
+	if node, ok := tbl.Fields["collection_jitter"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+				if dur < 0 {
+					return nil, fmt.Errorf("collection_jitter of input %s must "+
+						"not be negative, got %s", name, str.Value)
+				}
+
+				cp.CollectionJitter = &dur
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["name_prefix"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if str, ok := kv.Value.(*ast.String); ok {
@@ -734,6 +1399,86 @@ func buildInput(name string, tbl *ast.Table) (*internal_models.InputConfig, erro
 		}
 	}
 
+	if node, ok := tbl.Fields["log_level"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				level, err := logger.ParseLevel(str.Value)
+				if err != nil {
+					return nil, fmt.Errorf("log_level of input %s: %s", name,
+						err)
+				}
+				cp.LogLevel = level
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["pipeline"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				cp.Pipeline = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["singleton"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if b, ok := kv.Value.(*ast.Boolean); ok {
+				cp.Singleton, _ = b.Boolean()
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["gather_timeout"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+				if dur < 0 {
+					return nil, fmt.Errorf("gather_timeout of input %s must "+
+						"not be negative, got %s", name, str.Value)
+				}
+
+				cp.GatherTimeout = dur
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["startup_delay"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+				if dur < 0 {
+					return nil, fmt.Errorf("startup_delay of input %s must "+
+						"not be negative, got %s", name, str.Value)
+				}
+
+				cp.StartupDelay = dur
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["wait_for"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						if _, _, err := internal_models.ParseWaitFor(
+							str.Value); err != nil {
+							return nil, fmt.Errorf("wait_for of input %s: %s",
+								name, err)
+						}
+						cp.WaitFor = append(cp.WaitFor, str.Value)
+					}
+				}
+			}
+		}
+	}
+
 	cp.Tags = make(map[string]string)
 	if node, ok := tbl.Fields["tags"]; ok {
 		if subtbl, ok := node.(*ast.Table); ok {
@@ -747,15 +1492,22 @@ func buildInput(name string, tbl *ast.Table) (*internal_models.InputConfig, erro
 	delete(tbl.Fields, "name_suffix")
 	delete(tbl.Fields, "name_override")
 	delete(tbl.Fields, "interval")
+	delete(tbl.Fields, "collection_jitter")
+	delete(tbl.Fields, "log_level")
+	delete(tbl.Fields, "pipeline")
+	delete(tbl.Fields, "singleton")
+	delete(tbl.Fields, "gather_timeout")
+	delete(tbl.Fields, "startup_delay")
+	delete(tbl.Fields, "wait_for")
 	delete(tbl.Fields, "tags")
 	cp.Filter = buildFilter(tbl)
 	return cp, nil
 }
 
-// buildParser grabs the necessary entries from the ast.Table for creating
-// a parsers.Parser object, and creates it, which can then be added onto
-// an Input object.
-func buildParser(name string, tbl *ast.Table) (parsers.Parser, error) {
+// buildParserConfig grabs the necessary entries from the ast.Table for
+// creating a parsers.Parser object, which can then be added onto an Input
+// object.
+func buildParserConfig(name string, tbl *ast.Table) *parsers.Config {
 	c := &parsers.Config{}
 
 	if node, ok := tbl.Fields["data_format"]; ok {
@@ -821,7 +1573,7 @@ func buildParser(name string, tbl *ast.Table) (parsers.Parser, error) {
 	delete(tbl.Fields, "tag_keys")
 	delete(tbl.Fields, "data_type")
 
-	return parsers.NewParser(c)
+	return c
 }
 
 // buildSerializer grabs the necessary entries from the ast.Table for creating
@@ -859,10 +1611,199 @@ func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error
 // internal_models.OutputConfig to be inserted into internal_models.RunningInput
 // Note: error exists in the return for future calls that might require error
 func buildOutput(name string, tbl *ast.Table) (*internal_models.OutputConfig, error) {
-	oc := &internal_models.OutputConfig{
-		Name:   name,
-		Filter: buildFilter(tbl),
+	oc := &internal_models.OutputConfig{Name: name}
+	if node, ok := tbl.Fields["wal_dir"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.WALDir = str.Value
+			}
+		}
 	}
+
+	if node, ok := tbl.Fields["wal_max_bytes"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if integer, ok := kv.Value.(*ast.Integer); ok {
+				n, err := strconv.ParseInt(integer.Value, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				oc.WALMaxBytes = n
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["route"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				route, err := internal_models.ParseRoute(str.Value)
+				if err != nil {
+					return nil, err
+				}
+				oc.Route = route
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["failover_group"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.FailoverGroup = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["failback_interval"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+				if dur < 0 {
+					return nil, fmt.Errorf("failback_interval of output %s "+
+						"must not be negative, got %s", name, str.Value)
+				}
+				oc.FailbackInterval = dur
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["rate_limit"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			switch v := kv.Value.(type) {
+			case *ast.Integer:
+				rate, err := strconv.ParseInt(v.Value, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				if rate <= 0 {
+					return nil, fmt.Errorf("rate_limit of output %s must be "+
+						"positive, got %d", name, rate)
+				}
+				oc.RateLimit = internal_models.RateLimit{Rate: float64(rate)}
+			case *ast.String:
+				limit, err := internal_models.ParseRateLimit(v.Value)
+				if err != nil {
+					return nil, err
+				}
+				oc.RateLimit = limit
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["dead_letter_file"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.DeadLetterFile = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["dead_letter_output"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.DeadLetterOutput = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["timestamp_precision"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+				if dur < 0 {
+					return nil, fmt.Errorf("timestamp_precision of output %s "+
+						"must not be negative, got %s", name, str.Value)
+				}
+				oc.Timestamps.Precision = dur
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["timestamp_rounding"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				switch str.Value {
+				case internal_models.TimestampTruncate,
+					internal_models.TimestampRound:
+				default:
+					return nil, fmt.Errorf("timestamp_rounding of output %s "+
+						"must be truncate or round, got %q", name, str.Value)
+				}
+				oc.Timestamps.Rounding = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["span_context_tags"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if b, ok := kv.Value.(*ast.Boolean); ok {
+				oc.SpanContextTags, _ = b.Boolean()
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["buffer_full_strategy"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				switch str.Value {
+				case internal_models.BufferDropOldest,
+					internal_models.BufferDropNewest,
+					internal_models.BufferBlock:
+				default:
+					return nil, fmt.Errorf("buffer_full_strategy of output %s "+
+						"must be drop_oldest, drop_newest or block, got %q",
+						name, str.Value)
+				}
+				oc.BufferFullStrategy = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["log_level"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				level, err := logger.ParseLevel(str.Value)
+				if err != nil {
+					return nil, fmt.Errorf("log_level of output %s: %s", name,
+						err)
+				}
+				oc.LogLevel = level
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["pipeline"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.Pipeline = str.Value
+			}
+		}
+	}
+
+	if oc.DeadLetterFile != "" && oc.DeadLetterOutput != "" {
+		return nil, fmt.Errorf("output %s can't have both a dead_letter_file "+
+			"and a dead_letter_output", name)
+	}
+
+	delete(tbl.Fields, "wal_dir")
+	delete(tbl.Fields, "wal_max_bytes")
+	delete(tbl.Fields, "route")
+	delete(tbl.Fields, "failover_group")
+	delete(tbl.Fields, "failback_interval")
+	delete(tbl.Fields, "rate_limit")
+	delete(tbl.Fields, "timestamp_precision")
+	delete(tbl.Fields, "timestamp_rounding")
+	delete(tbl.Fields, "span_context_tags")
+	delete(tbl.Fields, "buffer_full_strategy")
+	delete(tbl.Fields, "dead_letter_file")
+	delete(tbl.Fields, "dead_letter_output")
+	delete(tbl.Fields, "log_level")
+	delete(tbl.Fields, "pipeline")
+	oc.Filter = buildFilter(tbl)
 	// Outputs don't support FieldDrop/FieldPass, so set to NameDrop/NamePass
 	if len(oc.Filter.FieldDrop) > 0 {
 		oc.Filter.NameDrop = oc.Filter.FieldDrop
@@ -5,14 +5,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/logger"
 	"github.com/influxdata/telegraf/internal/models"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/inputs/exec"
 	"github.com/influxdata/telegraf/plugins/inputs/memcached"
 	"github.com/influxdata/telegraf/plugins/inputs/procstat"
+	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
+	_ "github.com/influxdata/telegraf/plugins/secretstores/env"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfig_LoadSingleInputWithEnvVars(t *testing.T) {
@@ -57,6 +62,27 @@ func TestConfig_LoadSingleInputWithEnvVars(t *testing.T) {
 		"Testdata did not produce correct memcached metadata.")
 }
 
+func TestConfig_LoadSingleInputWithSecrets(t *testing.T) {
+	c := NewConfig()
+	err := os.Setenv("MY_TEST_SERVER", "192.168.1.1")
+	assert.NoError(t, err)
+	err = os.Setenv("MY_TEST_INTERVAL", "10s")
+	assert.NoError(t, err)
+	err = c.LoadConfig("./testdata/single_plugin_secrets.toml")
+	assert.NoError(t, err)
+
+	memcached := inputs.Inputs["memcached"]().(*memcached.Memcached)
+	memcached.Servers = []string{"192.168.1.1:11211"}
+
+	assert.Equal(t, memcached, c.Inputs[0].Input,
+		"Testdata did not produce a correct memcached struct.")
+	assert.Equal(t, 10*time.Second, c.Inputs[0].Config.Interval)
+
+	os.Unsetenv("MY_TEST_SERVER")
+	err = NewConfig().LoadConfig("./testdata/single_plugin_secrets.toml")
+	assert.Error(t, err)
+}
+
 func TestConfig_LoadSingleInput(t *testing.T) {
 	c := NewConfig()
 	c.LoadConfig("./testdata/single_plugin.toml")
@@ -171,3 +197,83 @@ func TestConfig_LoadDirectory(t *testing.T) {
 	assert.Equal(t, pConfig, c.Inputs[3].Config,
 		"Merged Testdata did not produce correct procstat metadata.")
 }
+
+func TestConfig_SubstituteBracedEnvVars(t *testing.T) {
+	require.NoError(t, os.Setenv("MY_TEST_SERVER", "192.168.1.1"))
+	require.NoError(t, os.Unsetenv("MY_TEST_UNSET"))
+	require.NoError(t, os.Unsetenv("MY_TEST_PASSWORD"))
+
+	contents, err := substituteBracedEnvVars([]byte(`servers = ["${MY_TEST_SERVER}"]
+port = "${MY_TEST_UNSET:-11211}"
+# commented = "${MY_TEST_UNSET}"
+path = "${MY_TEST_UNSET:-}"`))
+	require.NoError(t, err)
+	assert.Equal(t, `servers = ["192.168.1.1"]
+port = "11211"
+# commented = "${MY_TEST_UNSET}"
+path = ""`, string(contents))
+
+	_, err = substituteBracedEnvVars([]byte(`server = "${MY_TEST_UNSET}"
+password = "${MY_TEST_PASSWORD:?set it to the database password}"`))
+	require.Error(t, err)
+	assert.Equal(t, "missing required environment variables: MY_TEST_UNSET, "+
+		"MY_TEST_PASSWORD (set it to the database password)", err.Error())
+}
+
+type loadOutput struct {
+	URL string
+}
+
+func (o *loadOutput) Connect() error                        { return nil }
+func (o *loadOutput) Close() error                          { return nil }
+func (o *loadOutput) Description() string                   { return "" }
+func (o *loadOutput) SampleConfig() string                  { return "" }
+func (o *loadOutput) Write(metrics []telegraf.Metric) error { return nil }
+
+func TestConfig_LoadOutputs(t *testing.T) {
+	outputs.Add("load_test", func() telegraf.Output { return &loadOutput{} })
+	require.NoError(t, os.Setenv("MY_TEST_PASSWORD", "secret"))
+	c := NewConfig()
+
+	loaded, err := c.LoadOutputs([]byte(`[[outputs.load_test]]
+  url = "http://localhost:8086"`))
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, "http://localhost:8086", loaded[0].Output.(*loadOutput).URL)
+	assert.Empty(t, c.Outputs)
+
+	// The environment, secrets and encrypted values of the agent are not
+	// given to the outputs of the control API
+	for _, url := range []string{
+		"http://${MY_TEST_PASSWORD}@localhost",
+		"http://$MY_TEST_PASSWORD@localhost",
+		"http://@{test:PASSWORD}@localhost",
+		"http://ENC[aGVsbG8=]@localhost",
+	} {
+		_, err := c.LoadOutputs([]byte("[[outputs.load_test]]\n  url = \"" + url + "\""))
+		require.Error(t, err, url)
+		assert.Contains(t, err.Error(), "are not allowed")
+	}
+
+	_, err = c.LoadOutputs([]byte("[[inputs.cpu]]"))
+	assert.Error(t, err)
+}
+
+type loggingInput struct {
+	memcached.Memcached
+	Log telegraf.Logger `toml:"-"`
+}
+
+func TestConfig_LogLevel(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/log_level.toml"))
+	assert.Equal(t, "json", c.Agent.LogFormat)
+	require.Len(t, c.Inputs, 1)
+	assert.Equal(t, logger.LevelDebug, c.Inputs[0].Config.LogLevel)
+	assert.Equal(t, logger.New("inputs.memcached", logger.LevelDebug),
+		c.Inputs[0].Log)
+
+	input := &loggingInput{}
+	setLogger(input, c.Inputs[0].Log)
+	assert.Equal(t, c.Inputs[0].Log, input.Log)
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/influxdata/telegraf/plugins/secretstores/file"
+)
+
+// encryptedRe is a regex to find the ENC[...] encrypted values
+var encryptedRe = regexp.MustCompile(`ENC\[([^\]]+)\]`)
+
+// Prefix of the encrypted values decrypted by AWS KMS.
+const kmsPrefix = "kms:"
+
+// EncryptValue returns the ENC[...] value of plaintext encrypted with key,
+// to paste into a config.
+func EncryptValue(key, plaintext []byte) (string, error) {
+	data, err := file.Encrypt(key, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return "ENC[" + strings.TrimSpace(string(data)) + "]", nil
+}
+
+// decryptValues replaces the ENC[...] values of s with their plaintext:
+// ENC[kms:<ciphertext>] values are decrypted with AWS KMS, the others with
+// the config key.
+func (c *Config) decryptValues(s string) (string, error) {
+	var err error
+	s = encryptedRe.ReplaceAllStringFunc(s, func(value string) string {
+		if err != nil {
+			return value
+		}
+		ciphertext := encryptedRe.FindStringSubmatch(value)[1]
+		var plaintext []byte
+		if strings.HasPrefix(ciphertext, kmsPrefix) {
+			plaintext, err = decryptKMS(strings.TrimPrefix(ciphertext, kmsPrefix))
+		} else {
+			var key []byte
+			if key, err = c.configKey(); err == nil {
+				plaintext, err = file.Decrypt(key, []byte(ciphertext))
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("Could not decrypt an ENC[...] value, %s", err)
+			return value
+		}
+		return string(plaintext)
+	})
+	return s, err
+}
+
+// configKey returns the key of the encrypted values, read from
+// ConfigKeyFile or else the hex encoded TELEGRAF_CONFIG_KEY environment
+// variable.
+func (c *Config) configKey() ([]byte, error) {
+	if c.configKeyCache != nil {
+		return c.configKeyCache, nil
+	}
+	var key []byte
+	var err error
+	switch {
+	case c.ConfigKeyFile != "":
+		key, err = file.ReadKey(c.ConfigKeyFile)
+	case os.Getenv("TELEGRAF_CONFIG_KEY") != "":
+		key, err = hex.DecodeString(os.Getenv("TELEGRAF_CONFIG_KEY"))
+		if err == nil && len(key) != 32 {
+			err = fmt.Errorf("TELEGRAF_CONFIG_KEY has %d bytes, expected 32",
+				len(key))
+		}
+	default:
+		err = fmt.Errorf("no config key, set -config-key-file or " +
+			"TELEGRAF_CONFIG_KEY")
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.configKeyCache = key
+	return key, nil
+}
+
+// decryptKMS decrypts the base64 encoded ciphertext blob with AWS KMS, in
+// the region of the AWS_REGION environment variable.
+func decryptKMS(ciphertext string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	svc := kms.New(session.New(&aws.Config{
+		Region:     aws.String(os.Getenv("AWS_REGION")),
+		HTTPClient: &http.Client{Timeout: remoteTimeout},
+	}))
+	out, err := svc.Decrypt(&kms.DecryptInput{CiphertextBlob: blob})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Timeout of the requests fetching remote configs.
+const remoteTimeout = 10 * time.Second
+
+// IsRemote returns whether the config at path is fetched remotely, from an
+// http(s)://, s3://bucket/key or etcd://host:port/key url.
+func IsRemote(path string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://", "etcd://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadRemote fetches the remote config at rawurl and caches it in cacheDir,
+// the temporary directory if empty. The cached config is returned when the
+// config can't be fetched, so that telegraf can start while the config
+// server is down.
+func ReadRemote(rawurl, cacheDir string) ([]byte, error) {
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "telegraf")
+	}
+	sum := sha256.Sum256([]byte(rawurl))
+	cache := filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".conf")
+
+	contents, err := fetchRemote(rawurl)
+	if err != nil {
+		cached, cacheErr := ioutil.ReadFile(cache)
+		if cacheErr != nil {
+			return nil, err
+		}
+		log.Printf("WARNING: could not fetch config %s, using the cached "+
+			"config: %s\n", rawurl, err)
+		return cached, nil
+	}
+
+	if err := writeCache(cache, contents); err != nil {
+		log.Printf("WARNING: could not cache config %s: %s\n", rawurl, err)
+	}
+	return contents, nil
+}
+
+// writeCache writes the cache file atomically, so that a crash does not
+// leave a partial config behind.
+func writeCache(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fetchRemote(rawurl string) ([]byte, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return fetchHTTP(rawurl)
+	case "s3":
+		return fetchS3(u)
+	case "etcd":
+		return fetchEtcd(u)
+	}
+	return nil, fmt.Errorf("unsupported config url %s", rawurl)
+}
+
+func fetchHTTP(rawurl string) ([]byte, error) {
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP status %s", rawurl, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// fetchS3 gets the object of s3://bucket/key, the region defaults to the
+// AWS_REGION environment variable and can be set with a region parameter.
+func fetchS3(u *url.URL) ([]byte, error) {
+	region := u.Query().Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	svc := s3.New(session.New(&aws.Config{
+		Region: aws.String(region),
+		Credentials: credentials.NewChainCredentials(
+			[]credentials.Provider{
+				&ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(session.New())},
+				&credentials.EnvProvider{},
+				&credentials.SharedCredentialsProvider{},
+			}),
+		HTTPClient: &http.Client{Timeout: remoteTimeout},
+	}))
+
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get s3://%s%s: %s", u.Host, u.Path, err)
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// fetchEtcd gets the value of the key of etcd://host:port/key with the etcd
+// v2 keys API, over https if the tls parameter is true.
+func fetchEtcd(u *url.URL) ([]byte, error) {
+	scheme := "http"
+	if u.Query().Get("tls") == "true" {
+		scheme = "https"
+	}
+	addr := scheme + "://" + u.Host + "/v2/keys" + u.Path
+	body, err := fetchHTTP(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Node struct {
+			Value string `json:"value"`
+		} `json:"node"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("Could not decode etcd response of %s: %s", addr, err)
+	}
+	return []byte(resp.Node.Value), nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRemote(t *testing.T) {
+	assert.True(t, IsRemote("http://localhost/telegraf.conf"))
+	assert.True(t, IsRemote("https://localhost/telegraf.conf"))
+	assert.True(t, IsRemote("s3://bucket/telegraf.conf"))
+	assert.True(t, IsRemote("etcd://localhost:2379/telegraf"))
+	assert.False(t, IsRemote("/etc/telegraf/telegraf.conf"))
+	assert.False(t, IsRemote("telegraf.conf"))
+}
+
+func TestReadRemoteCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	up := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "[[inputs.cpu]]\n")
+	}))
+	defer ts.Close()
+
+	contents, err := ReadRemote(ts.URL+"/telegraf.conf", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "[[inputs.cpu]]\n", string(contents))
+
+	// The cached config is used while the server is down
+	up = false
+	contents, err = ReadRemote(ts.URL+"/telegraf.conf", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "[[inputs.cpu]]\n", string(contents))
+
+	_, err = ReadRemote(ts.URL+"/other.conf", dir)
+	assert.Error(t, err)
+}
+
+func TestReadRemoteEtcd(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/keys/telegraf/config", r.URL.Path)
+		fmt.Fprint(w, `{"action":"get","node":{"key":"/telegraf/config",`+
+			`"value":"[[inputs.mem]]\n"}}`)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "remote")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	contents, err := ReadRemote("etcd://"+ts.Listener.Addr().String()+
+		"/telegraf/config", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "[[inputs.mem]]\n", string(contents))
+}
+
+func TestRemoteWatcher(t *testing.T) {
+	config := "[[inputs.cpu]]\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, config)
+	}))
+	defer ts.Close()
+
+	w := NewRemoteWatcher(ts.URL, 10*time.Millisecond)
+	done := make(chan struct{})
+	defer close(done)
+	changed := make(chan struct{}, 10)
+	go w.Watch(done, func() { changed <- struct{}{} })
+
+	select {
+	case <-changed:
+		t.Fatal("unexpected change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	config = "[[inputs.mem]]\n"
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change not detected")
+	}
+}
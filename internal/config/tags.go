@@ -0,0 +1,37 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/influxdata/config"
+	"github.com/influxdata/toml"
+)
+
+// ReadTagsFile reads the global tags of the file at path: a JSON object of
+// strings if its extension is .json, else TOML key = "value" pairs.
+func ReadTagsFile(path string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	if filepath.Ext(path) == ".json" {
+		if err := json.Unmarshal(contents, &tags); err != nil {
+			return nil, fmt.Errorf("Could not parse tags file %s: %s", path, err)
+		}
+		return tags, nil
+	}
+
+	tbl, err := toml.Parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse tags file %s: %s", path, err)
+	}
+	if err := config.UnmarshalTable(tbl, tags); err != nil {
+		return nil, fmt.Errorf("Could not parse tags file %s: %s", path, err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Watcher polls config files for changes: the *.conf files of a config
+// directory being added, changed or removed, or a remote config changing.
+type Watcher struct {
+	// Name is the directory or url watched
+	Name     string
+	Interval time.Duration
+
+	// scan returns the hashes of the contents of the files by name
+	scan  func() (map[string][sha256.Size]byte, error)
+	files map[string][sha256.Size]byte
+}
+
+// NewDirectoryWatcher returns a watcher of the config directory path,
+// comparing the files to their current contents.
+func NewDirectoryWatcher(path string, interval time.Duration) (*Watcher, error) {
+	w := &Watcher{
+		Name:     path,
+		Interval: interval,
+		scan: func() (map[string][sha256.Size]byte, error) {
+			return scanDirectory(path)
+		},
+	}
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.files = files
+	return w, nil
+}
+
+// NewRemoteWatcher returns a watcher of the remote config at rawurl,
+// comparing it to its current contents. If it can't be fetched, as when
+// telegraf started with the cached config, the first successful fetch is a
+// change.
+func NewRemoteWatcher(rawurl string, interval time.Duration) *Watcher {
+	w := &Watcher{
+		Name:     rawurl,
+		Interval: interval,
+		scan: func() (map[string][sha256.Size]byte, error) {
+			contents, err := fetchRemote(rawurl)
+			if err != nil {
+				return nil, err
+			}
+			return map[string][sha256.Size]byte{
+				rawurl: sha256.Sum256(contents),
+			}, nil
+		},
+	}
+	if files, err := w.scan(); err == nil {
+		w.files = files
+	}
+	return w
+}
+
+// Watch calls changed every time the watched files changed, until done is
+// closed.
+func (w *Watcher) Watch(done chan struct{}, changed func()) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		files, err := w.scan()
+		if err != nil {
+			log.Printf("Error watching config %s: %s\n", w.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(files, w.files) {
+			w.files = files
+			changed()
+		}
+	}
+}
+
+// scanDirectory hashes the *.conf files of the directory, as LoadDirectory
+// loads them.
+func scanDirectory(path string) (map[string][sha256.Size]byte, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][sha256.Size]byte)
+	for _, entry := range entries {
+		if entry.IsDir() || len(entry.Name()) < 6 ||
+			!strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = sha256.Sum256(data)
+	}
+	return files, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name),
+			[]byte(content), 0600))
+	}
+	write("cpu.conf", "[[inputs.cpu]]\n")
+
+	w, err := NewDirectoryWatcher(dir, 10*time.Millisecond)
+	require.NoError(t, err)
+	done := make(chan struct{})
+	defer close(done)
+	changed := make(chan struct{}, 10)
+	go w.Watch(done, func() { changed <- struct{}{} })
+
+	expectChange := func(change bool) {
+		select {
+		case <-changed:
+			assert.True(t, change, "unexpected change")
+		case <-time.After(100 * time.Millisecond):
+			assert.False(t, change, "change not detected")
+		}
+	}
+
+	// Files which are not loaded are ignored
+	write("notes.txt", "ignored")
+	expectChange(false)
+
+	write("mem.conf", "[[inputs.mem]]\n")
+	expectChange(true)
+	write("cpu.conf", "[[inputs.cpu]]\n  percpu = false\n")
+	expectChange(true)
+	require.NoError(t, os.Remove(filepath.Join(dir, "mem.conf")))
+	expectChange(true)
+	expectChange(false)
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -33,6 +34,45 @@ func (d *Duration) UnmarshalTOML(b []byte) error {
 	return nil
 }
 
+// Size is a number of bytes
+type Size struct {
+	Size int64
+}
+
+// UnmarshalTOML parses the size from the TOML config file, an integer or a
+// string with a B, KB, MB or GB unit
+func (s *Size) UnmarshalTOML(b []byte) error {
+	str := strings.Trim(string(b), `"'`)
+	size, err := ParseSize(str)
+	if err != nil {
+		return err
+	}
+	s.Size = size
+	return nil
+}
+
+// ParseSize parses a number of bytes like "1024", "512KB" or "10MB".
+func ParseSize(size string) (int64, error) {
+	str := strings.TrimSpace(size)
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(strings.ToUpper(str), unit.suffix) {
+			str = strings.TrimSpace(str[:len(str)-len(unit.suffix)])
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes "+
+			"with an optional B, KB, MB or GB unit", size)
+	}
+	return n * multiplier, nil
+}
+
 var NotImplementedError = errors.New("not implemented yet")
 
 // ReadLines reads contents from a file and splits them by new lines.
@@ -44,8 +84,9 @@ func ReadLines(filename string) ([]string, error) {
 // ReadLines reads contents from file and splits them by new line.
 // The offset tells at which line number to start.
 // The count determines the number of lines to read (starting from offset):
-//   n >= 0: at most n lines
-//   n < 0: whole file
+//
+//	n >= 0: at most n lines
+//	n < 0: whole file
 func ReadLinesOffsetN(filename string, offset uint, n int) ([]string, error) {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -71,3 +71,30 @@ func TestSnakeCase(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	for str, size := range map[string]int64{
+		"1024":    1024,
+		"512B":    512,
+		"8KB":     8 << 10,
+		"10 MB":   10 << 20,
+		"2gb":     2 << 30,
+		"\"1MB\"": -1,
+		"-1":      -1,
+		"MB":      -1,
+	} {
+		n, err := ParseSize(str)
+		if size < 0 {
+			if err == nil {
+				t.Errorf("ParseSize(%q) did not fail", str)
+			}
+		} else if err != nil || n != size {
+			t.Errorf("ParseSize(%q) = %d, %v, wanted %d", str, n, err, size)
+		}
+	}
+
+	var s Size
+	if err := s.UnmarshalTOML([]byte(`"10MB"`)); err != nil || s.Size != 10<<20 {
+		t.Errorf("UnmarshalTOML(\"10MB\") = %d, %v", s.Size, err)
+	}
+}
@@ -0,0 +1,250 @@
+// Package logger writes the logs of telegraf as text lines or JSON objects,
+// through loggers scoped to a plugin, which can have their own level.
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	// LevelUnset is the level of the loggers using the level of the agent
+	LevelUnset Level = iota
+	LevelError
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = map[Level]string{
+	LevelError: "error",
+	LevelWarn:  "warn",
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+}
+
+// Prefixes of the levels in the text format, also recognized in the
+// messages of the log package
+var levelPrefixes = map[Level]string{
+	LevelError: "E!",
+	LevelWarn:  "W!",
+	LevelInfo:  "I!",
+	LevelDebug: "D!",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses "error", "warn", "info" or "debug".
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.ToLower(s) == name {
+			return level, nil
+		}
+	}
+	if strings.ToLower(s) == "warning" {
+		return LevelWarn, nil
+	}
+	return LevelUnset, fmt.Errorf("unknown log level %q, it can be error, "+
+		"warn, info or debug", s)
+}
+
+// Config of the logs of the agent.
+type Config struct {
+	// Format of the entries, "text" (default) or "json"
+	Format string
+	// Level of the loggers without their own, info if unset
+	Level Level
+	// Writer receives the entries, os.Stderr if nil
+	Writer io.Writer
+
+	// Logfile receives the entries instead of Writer if set, rotated as
+	// configured, see RotatingFile
+	Logfile             string
+	RotationInterval    time.Duration
+	RotationMaxSize     int64
+	RotationMaxArchives int
+}
+
+// LevelWriter is implemented by the writers handling the level of the
+// entries themselves, like the Windows event log.
+type LevelWriter interface {
+	WriteLevel(level Level, p []byte) (int, error)
+}
+
+var (
+	mu              sync.Mutex
+	format                    = "text"
+	level                     = LevelInfo
+	writer          io.Writer = os.Stderr
+	logfile         *RotatingFile
+	redirectStdOnce sync.Once
+)
+
+// Setup configures the logs, and has the messages of the log package written
+// as entries at the level given by their prefix. It can be called again to
+// change the configuration, closing the previous logfile.
+func Setup(c Config) error {
+	switch c.Format {
+	case "":
+		c.Format = "text"
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown log format %q, it can be text or json",
+			c.Format)
+	}
+	if c.Level == LevelUnset {
+		c.Level = LevelInfo
+	}
+	if c.Writer == nil {
+		c.Writer = os.Stderr
+	}
+	var file *RotatingFile
+	if c.Logfile != "" {
+		var err error
+		file, err = OpenRotatingFile(c.Logfile, c.RotationInterval,
+			c.RotationMaxSize, c.RotationMaxArchives)
+		if err != nil {
+			return fmt.Errorf("could not open the logfile: %s", err)
+		}
+		c.Writer = file
+	}
+
+	mu.Lock()
+	format, level, writer = c.Format, c.Level, c.Writer
+	previous := logfile
+	logfile = file
+	mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+
+	redirectStdOnce.Do(func() {
+		log.SetFlags(0)
+		log.SetPrefix("")
+		log.SetOutput(stdWriter{})
+	})
+	return nil
+}
+
+// Logger logs the messages of a plugin, named like "inputs.cpu", at the
+// level of the plugin or else of the agent. A nil Logger logs messages which
+// are not about a plugin.
+type Logger struct {
+	Plugin string
+	Level  Level
+}
+
+func New(plugin string, level Level) *Logger {
+	return &Logger{Plugin: plugin, Level: level}
+}
+
+// Enabled returns whether the messages at level are logged.
+func (l *Logger) Enabled(lvl Level) bool {
+	max := LevelUnset
+	if l != nil {
+		max = l.Level
+	}
+	if max == LevelUnset {
+		mu.Lock()
+		max = level
+		mu.Unlock()
+	}
+	return lvl <= max
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, format, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args...)
+}
+
+func (l *Logger) logf(lvl Level, format string, args ...interface{}) {
+	if !l.Enabled(lvl) {
+		return
+	}
+	var plugin string
+	if l != nil {
+		plugin = l.Plugin
+	}
+	write(time.Now(), lvl, plugin, fmt.Sprintf(format, args...))
+}
+
+// entry is the JSON format of the entries
+type entry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Plugin  string `json:"plugin,omitempty"`
+	Message string `json:"msg"`
+}
+
+func write(t time.Time, lvl Level, plugin, msg string) {
+	msg = strings.TrimRight(msg, "\n")
+	ts := t.UTC().Format(time.RFC3339)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var line []byte
+	if format == "json" {
+		line, _ = json.Marshal(entry{ts, lvl.String(), plugin, msg})
+	} else {
+		scope := ""
+		if plugin != "" {
+			scope = "[" + plugin + "] "
+		}
+		line = []byte(ts + " " + levelPrefixes[lvl] + " " + scope + msg)
+	}
+	line = append(line, '\n')
+
+	if lw, ok := writer.(LevelWriter); ok {
+		lw.WriteLevel(lvl, line)
+	} else {
+		writer.Write(line)
+	}
+}
+
+// stdWriter writes the messages of the log package, which are not about a
+// plugin, at the level of their "E!", "W!", "I!" or "D!" prefix, or error and
+// warn for messages starting with "Error" and "WARNING".
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	msg := string(p)
+	lvl := LevelInfo
+	for l, prefix := range levelPrefixes {
+		if strings.HasPrefix(msg, prefix+" ") {
+			lvl = l
+			msg = msg[len(prefix)+1:]
+		}
+	}
+	upper := strings.ToUpper(msg)
+	switch {
+	case strings.HasPrefix(upper, "ERROR") || strings.HasPrefix(upper, "FATAL"):
+		lvl = LevelError
+	case strings.HasPrefix(upper, "WARNING"):
+		lvl = LevelWarn
+	}
+
+	var l *Logger
+	l.logf(lvl, "%s", msg)
+	return len(p), nil
+}
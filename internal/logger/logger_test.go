@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T, format string, level Level) *bytes.Buffer {
+	var buf bytes.Buffer
+	require.NoError(t, Setup(Config{Format: format, Level: level, Writer: &buf}))
+	return &buf
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("DEBUG")
+	require.NoError(t, err)
+	assert.Equal(t, LevelDebug, level)
+	level, err = ParseLevel("warning")
+	require.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestLoggerLevels(t *testing.T) {
+	buf := setup(t, "text", LevelInfo)
+
+	// Loggers without a level use the level of the agent
+	l := New("inputs.cpu", LevelUnset)
+	l.Debugf("hidden")
+	l.Infof("shown %d", 1)
+
+	// The level of a plugin can be raised to debug
+	d := New("inputs.uwsgi", LevelDebug)
+	d.Debugf("details")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], " I! [inputs.cpu] shown 1"))
+	assert.True(t, strings.HasSuffix(lines[1], " D! [inputs.uwsgi] details"))
+}
+
+func TestLoggerJSON(t *testing.T) {
+	buf := setup(t, "json", LevelInfo)
+	defer setup(t, "text", LevelInfo)
+
+	New("outputs.influxdb", LevelUnset).Errorf("write failed")
+	var e entry
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &e))
+	assert.Equal(t, "error", e.Level)
+	assert.Equal(t, "outputs.influxdb", e.Plugin)
+	assert.Equal(t, "write failed", e.Message)
+	assert.NotEmpty(t, e.Time)
+}
+
+func TestStdLog(t *testing.T) {
+	buf := setup(t, "text", LevelInfo)
+
+	log.Printf("Error in input [cpu]: failed\n")
+	log.Printf("D! hidden")
+	log.Printf("W! careful")
+	var nilLogger *Logger
+	nilLogger.Infof("unscoped")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasSuffix(lines[0], " E! Error in input [cpu]: failed"))
+	assert.True(t, strings.HasSuffix(lines[1], " W! careful"))
+	assert.True(t, strings.HasSuffix(lines[2], " I! unscoped"))
+}
+
+func TestSetupFormat(t *testing.T) {
+	assert.Error(t, Setup(Config{Format: "xml"}))
+}
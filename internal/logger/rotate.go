@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Layout of the time suffix of the rotated log files
+const archiveLayout = "2006-01-02T15-04-05.000000000"
+
+// RotatingFile is a log file which is rotated once it is older than Interval
+// or would grow larger than MaxSize, either disabled if 0. The rotated files
+// are renamed with the time of the rotation as suffix, like
+// telegraf.log.2016-06-01T10-00-00.000000000, and only the MaxArchives newest
+// ones are kept, all of them if negative.
+type RotatingFile struct {
+	Path        string
+	Interval    time.Duration
+	MaxSize     int64
+	MaxArchives int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// OpenRotatingFile opens the log file at path for appending. Its age counts
+// from when it is opened.
+func OpenRotatingFile(
+	path string,
+	interval time.Duration,
+	maxSize int64,
+	maxArchives int,
+) (*RotatingFile, error) {
+	f := &RotatingFile{
+		Path:        path,
+		Interval:    interval,
+		MaxSize:     maxSize,
+		MaxArchives: maxArchives,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if (f.Interval > 0 && time.Since(f.opened) >= f.Interval) ||
+		(f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the log file to an archive, opens a new one and removes
+// the oldest archives.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	archive := f.Path + "." + time.Now().Format(archiveLayout)
+	if err := os.Rename(f.Path, archive); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.purge()
+}
+
+func (f *RotatingFile) purge() error {
+	if f.MaxArchives < 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return err
+	}
+	var archives []string
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, f.Path+".")
+		if _, err := time.Parse(archiveLayout, suffix); err == nil {
+			archives = append(archives, m)
+		}
+	}
+	// The time suffixes sort in the order of the rotations
+	sort.Strings(archives)
+	for len(archives) > f.MaxArchives {
+		if err := os.Remove(archives[0]); err != nil {
+			return err
+		}
+		archives = archives[1:]
+	}
+	return nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
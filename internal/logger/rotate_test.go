@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func archives(t *testing.T, path string) []string {
+	matches, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	return matches
+}
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "telegraf.log")
+
+	f, err := OpenRotatingFile(path, 0, 10, 2)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// A line larger than the max size is not split
+	_, err = f.Write([]byte("first line\n"))
+	require.NoError(t, err)
+	assert.Empty(t, archives(t, path))
+
+	for _, line := range []string{"second\n", "third\n", "fourth\n"} {
+		_, err = f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	// The oldest archive is removed
+	rotated := archives(t, path)
+	require.Len(t, rotated, 2)
+	data, err := ioutil.ReadFile(rotated[0])
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(data))
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(data))
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "telegraf.log")
+	// Files which are not archives are left alone
+	require.NoError(t, ioutil.WriteFile(path+".bak", nil, 0644))
+
+	f, err := OpenRotatingFile(path, time.Hour, 0, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("old\n"))
+	require.NoError(t, err)
+	f.opened = f.opened.Add(-time.Hour)
+	_, err = f.Write([]byte("new\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{path + ".bak"}, archives(t, path))
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", string(data))
+}
+
+func TestSetupLogfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "telegraf.log")
+
+	require.NoError(t, Setup(Config{Logfile: path}))
+	New("inputs.cpu", LevelUnset).Infof("to the file")
+	require.NoError(t, Setup(Config{}))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), " I! [inputs.cpu] to the file\n")
+}
@@ -0,0 +1,76 @@
+package internal_models
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// DeadLetter receives the metrics rejected by an output, see
+// telegraf.RejectedError.
+type DeadLetter interface {
+	Reject(output string, metrics []telegraf.Metric, reason string) error
+}
+
+// DeadLetterFile appends the rejected metrics to a file in line protocol,
+// each write preceded by a comment with the output and the reason of the
+// rejection. The comments are skipped when the file is parsed again to
+// replay the metrics.
+type DeadLetterFile struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *DeadLetterFile) Reject(
+	output string,
+	metrics []telegraf.Metric,
+	reason string,
+) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %d metrics rejected by output %s at %s: %s\n",
+		len(metrics), output, time.Now().UTC().Format(time.RFC3339), reason)
+	for _, m := range metrics {
+		buf.WriteString(m.String())
+		buf.WriteByte('\n')
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Reject adds the metrics rejected by another output to the output, tagged
+// with the rejecting output and the reason of the rejection.
+func (ro *RunningOutput) Reject(
+	output string,
+	metrics []telegraf.Metric,
+	reason string,
+) error {
+	for _, m := range metrics {
+		tags := make(map[string]string)
+		for k, v := range m.Tags() {
+			tags[k] = v
+		}
+		tags["rejected_by"] = output
+		tags["rejection_reason"] = reason
+		rejected, err := telegraf.NewMetric(m.Name(), tags, m.Fields(), m.Time())
+		if err != nil {
+			return err
+		}
+		ro.AddMetric(keepSpan(m, rejected))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package internal_models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rejectOutput rejects the metrics named "rejected".
+type rejectOutput struct {
+	mockOutput
+}
+
+func (o *rejectOutput) Write(metrics []telegraf.Metric) error {
+	var rejected, written []telegraf.Metric
+	for _, m := range metrics {
+		if m.Name() == "rejected" {
+			rejected = append(rejected, m)
+		} else {
+			written = append(written, m)
+		}
+	}
+	o.mockOutput.Write(written)
+	if len(rejected) > 0 {
+		return &telegraf.RejectedError{Metrics: rejected, Reason: "bad metric"}
+	}
+	return nil
+}
+
+func rejectingOutput() (*RunningOutput, *rejectOutput) {
+	o := &rejectOutput{}
+	ro := NewRunningOutput("reject", o, &OutputConfig{})
+	ro.Quiet = true
+	ro.AddMetric(first5[0])
+	ro.AddMetric(taggedMetric("rejected"))
+	return ro, o
+}
+
+func taggedMetric(name string) telegraf.Metric {
+	m, _ := telegraf.NewMetric(name, map[string]string{"tag1": "value1"},
+		map[string]interface{}{"value": 1}, first5[0].Time())
+	return m
+}
+
+func TestRunningOutputDeadLetterFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dead_letter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rejected.out")
+
+	ro, o := rejectingOutput()
+	ro.DeadLetter = &DeadLetterFile{Path: path}
+
+	// Rejected metrics are not retried
+	require.NoError(t, ro.Write())
+	require.NoError(t, ro.Write())
+	assert.Equal(t, []telegraf.Metric{first5[0]}, o.Metrics())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0],
+		"# 1 metrics rejected by output reject at "))
+	assert.True(t, strings.HasSuffix(lines[0], ": bad metric"))
+	assert.Equal(t, taggedMetric("rejected").String(), lines[1])
+}
+
+func TestRunningOutputDeadLetterOutput(t *testing.T) {
+	ro, _ := rejectingOutput()
+	m := &mockOutput{}
+	dead := NewRunningOutput("dead", m, &OutputConfig{})
+	dead.Quiet = true
+	ro.DeadLetter = dead
+
+	require.NoError(t, ro.Write())
+	require.NoError(t, dead.Write())
+	require.Len(t, m.Metrics(), 1)
+	assert.Equal(t, map[string]string{
+		"tag1":             "value1",
+		"rejected_by":      "reject",
+		"rejection_reason": "bad metric",
+	}, m.Metrics()[0].Tags())
+
+	// The dead letter output only receives rejected metrics
+	router := NewRouter([]*RunningOutput{ro, dead}, nil)
+	router.Route(first5[1])
+	require.NoError(t, dead.Write())
+	assert.Len(t, m.Metrics(), 1)
+}
+
+func TestRunningOutputRejectedDropped(t *testing.T) {
+	ro, o := rejectingOutput()
+	// The statistics are shared by the outputs of the same name
+	rejected := ro.metricsRejected.Get()
+	require.NoError(t, ro.Write())
+	assert.Equal(t, []telegraf.Metric{first5[0]}, o.Metrics())
+	assert.Equal(t, rejected+1, ro.metricsRejected.Get())
+}
@@ -0,0 +1,100 @@
+package internal_models
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Deduplicator drops the metrics of a series and timestamp already seen in
+// the window, as when redundant inputs or agents report the same points. The
+// series is the name and tags of the metric, and its fields if Fields is set
+// so that inputs completing each other's fields are kept. A nil
+// Deduplicator drops nothing.
+type Deduplicator struct {
+	Window time.Duration
+	Fields bool
+
+	// time each metric hash was first seen
+	seen  map[uint64]time.Time
+	swept time.Time
+	now   func() time.Time
+
+	dropped *selfstat.Stat
+}
+
+func NewDeduplicator(window time.Duration, fields bool) *Deduplicator {
+	return &Deduplicator{
+		Window:  window,
+		Fields:  fields,
+		seen:    make(map[uint64]time.Time),
+		now:     time.Now,
+		dropped: selfstat.Register("agent", "metrics_deduplicated", nil),
+	}
+}
+
+// Duplicate returns whether m was seen within the window, recording it
+// otherwise.
+func (d *Deduplicator) Duplicate(m telegraf.Metric) bool {
+	if d == nil {
+		return false
+	}
+	now := d.now()
+	if now.Sub(d.swept) >= d.Window {
+		for h, t := range d.seen {
+			if now.Sub(t) >= d.Window {
+				delete(d.seen, h)
+			}
+		}
+		d.swept = now
+	}
+
+	h := d.hash(m)
+	if t, ok := d.seen[h]; ok && now.Sub(t) < d.Window {
+		d.dropped.Incr(1)
+		return true
+	}
+	d.seen[h] = now
+	return false
+}
+
+func (d *Deduplicator) hash(m telegraf.Metric) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(m.Name()))
+	h.Write([]byte{0})
+
+	tags := m.Tags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(tags[k]))
+		h.Write([]byte{0})
+	}
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(m.UnixNano()))
+	h.Write(ts[:])
+
+	if d.Fields {
+		fields := m.Fields()
+		keys = keys[:0]
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(h, "%s\x00%T\x00%v\x00", k, fields[k], fields[k])
+		}
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,56 @@
+package internal_models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator(t *testing.T) {
+	d := NewDeduplicator(time.Minute, false)
+	clock := time.Unix(1000, 0)
+	d.now = func() time.Time { return clock }
+
+	ts := time.Unix(900, 0)
+	newMetric := func(host string, value float64, at time.Time) telegraf.Metric {
+		m, err := telegraf.NewMetric("cpu",
+			map[string]string{"host": host},
+			map[string]interface{}{"value": value}, at)
+		require.NoError(t, err)
+		return m
+	}
+
+	assert.False(t, d.Duplicate(newMetric("a", 1, ts)))
+	assert.True(t, d.Duplicate(newMetric("a", 2, ts)))
+	assert.False(t, d.Duplicate(newMetric("b", 1, ts)))
+	assert.False(t, d.Duplicate(newMetric("a", 1, ts.Add(time.Second))))
+
+	// Out of the window the series is seen anew
+	clock = clock.Add(time.Minute)
+	assert.False(t, d.Duplicate(newMetric("a", 1, ts)))
+	assert.Len(t, d.seen, 1)
+}
+
+func TestDeduplicatorFields(t *testing.T) {
+	d := NewDeduplicator(time.Minute, true)
+	ts := time.Unix(900, 0)
+	newMetric := func(fields map[string]interface{}) telegraf.Metric {
+		m, err := telegraf.NewMetric("cpu", map[string]string{"host": "a"},
+			fields, ts)
+		require.NoError(t, err)
+		return m
+	}
+
+	assert.False(t, d.Duplicate(newMetric(map[string]interface{}{"user": 1.0})))
+	assert.False(t, d.Duplicate(newMetric(map[string]interface{}{"idle": 1.0})))
+	assert.True(t, d.Duplicate(newMetric(map[string]interface{}{"user": 1.0})))
+}
+
+func TestDeduplicatorNil(t *testing.T) {
+	var d *Deduplicator
+	assert.False(t, d.Duplicate(first5[0]))
+}
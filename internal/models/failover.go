@@ -0,0 +1,103 @@
+package internal_models
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Default time after which a failover group tries its primary output again.
+const DEFAULT_FAILBACK_INTERVAL = time.Minute
+
+// FailoverGroup is a set of outputs of which only the active one receives
+// metrics. The primary output is active until a write fails, the metrics it
+// buffered are then handed to the next output of the group which becomes
+// active. Once the failback interval of the primary elapsed, the group
+// fails back to it, failing over again if it still can't write.
+type FailoverGroup struct {
+	Name string
+	// Outputs of the group by priority, the first one is the primary
+	Outputs []*RunningOutput
+
+	mu       sync.Mutex
+	active   int
+	switched time.Time
+}
+
+// NewFailoverGroups groups the outputs by their failover group, in the
+// order of the outputs.
+func NewFailoverGroups(outputs []*RunningOutput) []*FailoverGroup {
+	var groups []*FailoverGroup
+	index := make(map[string]*FailoverGroup)
+	for _, o := range outputs {
+		name := o.Config.FailoverGroup
+		if name == "" {
+			continue
+		}
+		g, ok := index[name]
+		if !ok {
+			g = &FailoverGroup{Name: name}
+			index[name] = g
+			groups = append(groups, g)
+		}
+		g.Outputs = append(g.Outputs, o)
+	}
+	return groups
+}
+
+// Active returns the output receiving the metrics of the group.
+func (g *FailoverGroup) Active() *RunningOutput {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Outputs[g.active]
+}
+
+// AddMetric adds the metric to the active output.
+func (g *FailoverGroup) AddMetric(metric telegraf.Metric) {
+	g.Active().AddMetric(metric)
+}
+
+// Write writes the metrics cached by the active output, failing over to the
+// next outputs of the group while writes fail. An error is returned if the
+// last output of the group failed too, which keeps the metrics.
+func (g *FailoverGroup) Write() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	primary := g.Outputs[0]
+	if g.active > 0 && time.Since(g.switched) >= g.failbackInterval() {
+		log.Printf("Failover group %s: failing back to output %s\n",
+			g.Name, primary.Name)
+		g.switchTo(0)
+	}
+
+	for {
+		err := g.Outputs[g.active].Write()
+		if err == nil || g.active == len(g.Outputs)-1 {
+			return err
+		}
+		log.Printf("Failover group %s: output %s failed to write, failing "+
+			"over to output %s, error was '%s'\n", g.Name,
+			g.Outputs[g.active].Name, g.Outputs[g.active+1].Name, err)
+		g.switchTo(g.active + 1)
+	}
+}
+
+// switchTo makes the output i active, handing it the metrics cached by the
+// output active before.
+func (g *FailoverGroup) switchTo(i int) {
+	for _, m := range g.Outputs[g.active].TakeMetrics() {
+		g.Outputs[i].AddMetric(m)
+	}
+	g.active = i
+	g.switched = time.Now()
+}
+
+func (g *FailoverGroup) failbackInterval() time.Duration {
+	if interval := g.Outputs[0].Config.FailbackInterval; interval > 0 {
+		return interval
+	}
+	return DEFAULT_FAILBACK_INTERVAL
+}
@@ -0,0 +1,100 @@
+package internal_models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func failoverOutput(group string, failback time.Duration) (*RunningOutput, *mockOutput) {
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, &OutputConfig{
+		FailoverGroup:    group,
+		FailbackInterval: failback,
+	})
+	ro.Quiet = true
+	return ro, m
+}
+
+func TestNewFailoverGroups(t *testing.T) {
+	a, _ := failoverOutput("a", 0)
+	b, _ := failoverOutput("b", 0)
+	a2, _ := failoverOutput("a", 0)
+	none, _ := failoverOutput("", 0)
+
+	groups := NewFailoverGroups([]*RunningOutput{a, b, none, a2})
+	require.Len(t, groups, 2)
+	assert.Equal(t, "a", groups[0].Name)
+	assert.Equal(t, []*RunningOutput{a, a2}, groups[0].Outputs)
+	assert.Equal(t, []*RunningOutput{b}, groups[1].Outputs)
+}
+
+func TestFailoverGroup(t *testing.T) {
+	primary, mprimary := failoverOutput("influxdb", time.Hour)
+	secondary, msecondary := failoverOutput("influxdb", 0)
+	g := NewFailoverGroups([]*RunningOutput{primary, secondary})[0]
+
+	for _, m := range first5 {
+		g.AddMetric(m)
+	}
+	require.NoError(t, g.Write())
+	assert.Len(t, mprimary.Metrics(), 5)
+
+	// The metrics of the failed primary are written by the secondary
+	mprimary.failWrite = true
+	for _, m := range next5 {
+		g.AddMetric(m)
+	}
+	require.NoError(t, g.Write())
+	assert.Equal(t, next5, msecondary.Metrics())
+	assert.Equal(t, secondary, g.Active())
+
+	// No failback before the failback interval
+	mprimary.failWrite = false
+	g.AddMetric(first5[0])
+	require.NoError(t, g.Write())
+	assert.Len(t, mprimary.Metrics(), 5)
+	assert.Len(t, msecondary.Metrics(), 6)
+
+	g.switched = time.Now().Add(-time.Hour)
+	g.AddMetric(first5[1])
+	require.NoError(t, g.Write())
+	assert.Equal(t, primary, g.Active())
+	assert.Len(t, mprimary.Metrics(), 6)
+}
+
+func TestFailoverGroupAllFailed(t *testing.T) {
+	primary, mprimary := failoverOutput("influxdb", 0)
+	secondary, msecondary := failoverOutput("influxdb", 0)
+	g := NewFailoverGroups([]*RunningOutput{primary, secondary})[0]
+	mprimary.failWrite = true
+	msecondary.failWrite = true
+
+	for _, m := range first5 {
+		g.AddMetric(m)
+	}
+	require.Error(t, g.Write())
+
+	// The last output keeps the metrics until it can write them
+	msecondary.failWrite = false
+	require.NoError(t, g.Write())
+	assert.Equal(t, first5, msecondary.Metrics())
+}
+
+func TestRouterFailoverGroup(t *testing.T) {
+	primary, mprimary := failoverOutput("influxdb", 0)
+	secondary, msecondary := failoverOutput("influxdb", 0)
+	other, mother := failoverOutput("", 0)
+	outputs := []*RunningOutput{primary, other, secondary}
+	router := NewRouter(outputs, NewFailoverGroups(outputs))
+
+	router.Route(first5[0])
+	for _, o := range outputs {
+		require.NoError(t, o.Write())
+	}
+	assert.Len(t, mprimary.Metrics(), 1)
+	assert.Len(t, msecondary.Metrics(), 0)
+	assert.Len(t, mother.Metrics(), 1)
+}
@@ -0,0 +1,57 @@
+package internal_models
+
+import (
+	"sync"
+	"time"
+)
+
+// Number of recent errors kept per plugin.
+const RECENT_ERRORS_LIMIT = 10
+
+// PluginError is an error returned by a plugin.
+type PluginError struct {
+	Time    time.Time
+	Message string
+}
+
+// PluginState is the runtime state of a plugin managed through the control
+// API of the agent: whether it is paused and its recent errors.
+type PluginState struct {
+	mu     sync.Mutex
+	paused bool
+	errors []PluginError
+}
+
+// SetPaused pauses or resumes the plugin.
+func (s *PluginState) SetPaused(paused bool) {
+	s.mu.Lock()
+	s.paused = paused
+	s.mu.Unlock()
+}
+
+// Paused returns whether the plugin is paused.
+func (s *PluginState) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// AddError records an error of the plugin, dropping the oldest one past
+// RECENT_ERRORS_LIMIT.
+func (s *PluginState) AddError(t time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errors) == RECENT_ERRORS_LIMIT {
+		s.errors = s.errors[1:]
+	}
+	s.errors = append(s.errors, PluginError{Time: t, Message: err.Error()})
+}
+
+// RecentErrors returns the recent errors of the plugin, oldest first.
+func (s *PluginState) RecentErrors() []PluginError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errors := make([]PluginError, len(s.errors))
+	copy(errors, s.errors)
+	return errors
+}
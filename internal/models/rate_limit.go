@@ -0,0 +1,101 @@
+package internal_models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// RateLimit is the write rate limit of an output, in metrics or bytes of
+// line protocol per second.
+type RateLimit struct {
+	Rate  float64
+	Bytes bool
+}
+
+// ParseRateLimit parses a rate limit like "1000/s" in metrics per second,
+// or "512KB/s" in bytes per second, with the B, KB, MB and GB units.
+func ParseRateLimit(s string) (RateLimit, error) {
+	invalid := fmt.Errorf("invalid rate_limit %q, expected like "+
+		"\"1000/s\" or \"1MB/s\"", s)
+	str := strings.TrimSpace(s)
+	if !strings.HasSuffix(str, "/s") {
+		return RateLimit{}, invalid
+	}
+	str = strings.TrimSpace(strings.TrimSuffix(str, "/s"))
+
+	limit := RateLimit{}
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		size   float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit.suffix))
+			multiplier = unit.size
+			limit.Bytes = true
+			break
+		}
+	}
+
+	rate, err := strconv.ParseFloat(str, 64)
+	if err != nil || rate <= 0 {
+		return RateLimit{}, invalid
+	}
+	limit.Rate = rate * multiplier
+	return limit, nil
+}
+
+// rateLimiter is a token bucket holding up to a second of writes. A write
+// larger than the available tokens waits for the missing ones, so that
+// writes never exceed the rate on average.
+type rateLimiter struct {
+	limit RateLimit
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// sleep is time.Sleep, replaced by tests
+	sleep func(time.Duration)
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		tokens: limit.Rate,
+		last:   time.Now(),
+		sleep:  time.Sleep,
+	}
+}
+
+// wait blocks until metrics can be written.
+func (l *rateLimiter) wait(metrics []telegraf.Metric) {
+	cost := float64(len(metrics))
+	if l.limit.Bytes {
+		cost = 0
+		for _, m := range metrics {
+			cost += float64(len(m.String()) + 1)
+		}
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+	if l.tokens > l.limit.Rate {
+		l.tokens = l.limit.Rate
+	}
+	l.last = now
+	// Tokens go negative for the write, the deficit is slept off
+	l.tokens -= cost
+	deficit := l.tokens
+	l.mu.Unlock()
+
+	if deficit < 0 {
+		l.sleep(time.Duration(-deficit / l.limit.Rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,77 @@
+package internal_models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for s, expected := range map[string]RateLimit{
+		"1000/s":  {Rate: 1000},
+		"0.5/s":   {Rate: 0.5},
+		"100B/s":  {Rate: 100, Bytes: true},
+		"512KB/s": {Rate: 512 << 10, Bytes: true},
+		"1 MB/s":  {Rate: 1 << 20, Bytes: true},
+		"2GB/s":   {Rate: 2 << 30, Bytes: true},
+	} {
+		limit, err := ParseRateLimit(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, limit, s)
+	}
+
+	for _, s := range []string{"", "1000", "/s", "0/s", "-1/s", "1TB/s"} {
+		_, err := ParseRateLimit(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	var slept time.Duration
+	l := newRateLimiter(RateLimit{Rate: 5})
+	l.sleep = func(d time.Duration) { slept += d }
+
+	// A second of writes passes right away
+	l.wait(first5)
+	assert.Equal(t, time.Duration(0), slept)
+
+	// The next ones wait for the tokens they lack
+	l.wait(next5)
+	assert.InDelta(t, float64(time.Second), float64(slept),
+		float64(100*time.Millisecond))
+}
+
+func TestRateLimiterBytes(t *testing.T) {
+	var slept time.Duration
+	l := newRateLimiter(RateLimit{Rate: 10, Bytes: true})
+	l.sleep = func(d time.Duration) { slept += d }
+
+	size := len(first5[0].String()) + 1
+	l.wait(first5[:1])
+	assert.InDelta(t, float64(size-10)/10*float64(time.Second), float64(slept),
+		float64(100*time.Millisecond))
+}
+
+func TestRunningOutputRateLimit(t *testing.T) {
+	conf := &OutputConfig{RateLimit: RateLimit{Rate: 5}}
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, conf)
+	ro.Quiet = true
+	var slept time.Duration
+	ro.rateLimiter.sleep = func(d time.Duration) { slept += d }
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	for _, metric := range next5 {
+		ro.AddMetric(metric)
+	}
+	require.NoError(t, ro.Write())
+
+	// The writes are delayed, no metric is dropped
+	assert.Len(t, m.Metrics(), 10)
+	assert.InDelta(t, float64(time.Second), float64(slept),
+		float64(100*time.Millisecond))
+}
@@ -0,0 +1,141 @@
+package internal_models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+)
+
+// Route is a tag expression selecting the metrics sent to an output, like
+// "env=prod,region!=eu-*". Its terms are AND'ed: "key=pattern" matches the
+// metrics with the tag key matching the glob pattern, "key!=pattern" the
+// metrics without such a tag.
+type Route struct {
+	// Expr is the expression the route was parsed from
+	Expr  string
+	terms []routeTerm
+}
+
+type routeTerm struct {
+	key     string
+	pattern string
+	negate  bool
+}
+
+// ParseRoute parses the route expression expr.
+func ParseRoute(expr string) (*Route, error) {
+	r := &Route{Expr: expr}
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		i := strings.Index(term, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid route %q: expected key=pattern "+
+				"or key!=pattern, got %q", expr, term)
+		}
+		t := routeTerm{
+			key:     strings.TrimSpace(term[:i]),
+			pattern: strings.TrimSpace(term[i+1:]),
+		}
+		if strings.HasSuffix(t.key, "!") {
+			t.key = strings.TrimSpace(strings.TrimSuffix(t.key, "!"))
+			t.negate = true
+		}
+		if t.key == "" {
+			return nil, fmt.Errorf("invalid route %q: missing tag key in %q",
+				expr, term)
+		}
+		r.terms = append(r.terms, t)
+	}
+	return r, nil
+}
+
+// Match returns whether the tags match all the terms of the route.
+func (r *Route) Match(tags map[string]string) bool {
+	for _, t := range r.terms {
+		value, ok := tags[t.key]
+		matched := ok && internal.Glob(t.pattern, value)
+		if matched == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Router sends metrics to the outputs whose route they match, and to every
+// output without a route. Outputs sharing a route expression share its
+// evaluation, so each distinct route is evaluated once per metric. The
+// outputs of a failover group are routed as one by the route of its primary,
+// and outputs used as dead letter of others only receive rejected metrics.
+type Router struct {
+	routes   []*Route
+	routed   [][]metricSink
+	unrouted []metricSink
+}
+
+// metricSink is an output or failover group metrics are routed to.
+type metricSink interface {
+	AddMetric(metric telegraf.Metric)
+}
+
+// NewRouter returns the Router of outputs and their failover groups.
+func NewRouter(outputs []*RunningOutput, groups []*FailoverGroup) *Router {
+	primaries := make(map[*RunningOutput]*FailoverGroup)
+	members := make(map[*RunningOutput]bool)
+	for _, g := range groups {
+		primaries[g.Outputs[0]] = g
+		for _, o := range g.Outputs {
+			members[o] = true
+		}
+	}
+
+	for _, o := range outputs {
+		if d, ok := o.DeadLetter.(*RunningOutput); ok {
+			members[d] = true
+		}
+	}
+
+	r := &Router{}
+	index := make(map[string]int)
+	for _, o := range outputs {
+		var sink metricSink = o
+		if g, ok := primaries[o]; ok {
+			sink = g
+		} else if members[o] {
+			continue
+		}
+
+		if o.Config.Route == nil {
+			r.unrouted = append(r.unrouted, sink)
+			continue
+		}
+		i, ok := index[o.Config.Route.Expr]
+		if !ok {
+			i = len(r.routes)
+			index[o.Config.Route.Expr] = i
+			r.routes = append(r.routes, o.Config.Route)
+			r.routed = append(r.routed, nil)
+		}
+		r.routed[i] = append(r.routed[i], sink)
+	}
+	return r
+}
+
+// Route adds the metric to the outputs it is routed to.
+func (r *Router) Route(metric telegraf.Metric) {
+	for _, sink := range r.unrouted {
+		sink.AddMetric(metric)
+	}
+	if len(r.routes) == 0 {
+		return
+	}
+	tags := metric.Tags()
+	for i, route := range r.routes {
+		if route.Match(tags) {
+			for _, sink := range r.routed[i] {
+				sink.AddMetric(metric)
+			}
+		}
+	}
+}
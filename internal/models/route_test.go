@@ -0,0 +1,66 @@
+package internal_models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteMatch(t *testing.T) {
+	route, err := ParseRoute("env=prod, region!=eu-*")
+	require.NoError(t, err)
+
+	assert.True(t, route.Match(map[string]string{"env": "prod"}))
+	assert.True(t, route.Match(map[string]string{"env": "prod", "region": "us-1"}))
+	assert.False(t, route.Match(map[string]string{"env": "prod", "region": "eu-1"}))
+	assert.False(t, route.Match(map[string]string{"env": "dev"}))
+	assert.False(t, route.Match(map[string]string{}))
+}
+
+func TestParseRouteInvalid(t *testing.T) {
+	for _, expr := range []string{"", "env", "=prod", "env=prod,", "!=prod"} {
+		_, err := ParseRoute(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	newOutput := func(expr string) (*RunningOutput, *mockOutput) {
+		conf := &OutputConfig{}
+		if expr != "" {
+			route, err := ParseRoute(expr)
+			require.NoError(t, err)
+			conf.Route = route
+		}
+		m := &mockOutput{}
+		ro := NewRunningOutput("test", m, conf)
+		ro.Quiet = true
+		return ro, m
+	}
+	prod, mprod := newOutput("env=prod")
+	prod2, mprod2 := newOutput("env=prod")
+	dev, mdev := newOutput("env=dev")
+	all, mall := newOutput("")
+
+	router := NewRouter([]*RunningOutput{prod, prod2, dev, all}, nil)
+	assert.Len(t, router.routes, 2)
+
+	pm, _ := telegraf.NewMetric("cpu", map[string]string{"env": "prod"},
+		map[string]interface{}{"value": 1}, time.Now())
+	dm, _ := telegraf.NewMetric("cpu", map[string]string{"env": "dev"},
+		map[string]interface{}{"value": 1}, time.Now())
+	router.Route(pm)
+	router.Route(dm)
+	for _, ro := range []*RunningOutput{prod, prod2, dev, all} {
+		require.NoError(t, ro.Write())
+	}
+
+	assert.Equal(t, []telegraf.Metric{pm}, mprod.Metrics())
+	assert.Equal(t, []telegraf.Metric{pm}, mprod2.Metrics())
+	assert.Equal(t, []telegraf.Metric{dm}, mdev.Metrics())
+	assert.Equal(t, []telegraf.Metric{pm, dm}, mall.Metrics())
+}
@@ -1,15 +1,136 @@
 package internal_models
 
 import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/logger"
 )
 
 type RunningInput struct {
 	Name   string
 	Input  telegraf.Input
 	Config *InputConfig
+
+	// Fingerprint identifies the configuration of the input, inputs with
+	// the same fingerprint are configured identically.
+	Fingerprint string
+
+	// Pause and error state of the control API
+	PluginState
+
+	// Log logs the messages about the input
+	Log *logger.Logger
+
+	// New creates a fresh instance of the input from its configuration, to
+	// restart it, nil if the input can't be restarted
+	New func() (telegraf.Input, error)
+
+	lastGatherMu sync.Mutex
+	lastGather   time.Time
+	gathering    bool
+	// generation of the instance, incremented by Replace
+	generation int
+	// consecutive gathers which timed out or panicked
+	failures int
+	// whether the startup delay passed and the wait_for addresses accepted
+	// connections, see SetReady
+	ready bool
+}
+
+// StartGather marks the input as gathering, it returns false if the input
+// is still gathering, as when its previous gather timed out.
+func (ri *RunningInput) StartGather() bool {
+	ri.lastGatherMu.Lock()
+	defer ri.lastGatherMu.Unlock()
+	if ri.gathering {
+		return false
+	}
+	ri.gathering = true
+	return true
+}
+
+// EndGather marks the gather of the input as finished.
+func (ri *RunningInput) EndGather() {
+	ri.lastGatherMu.Lock()
+	ri.gathering = false
+	ri.lastGatherMu.Unlock()
+}
+
+// Instance returns the instance of the input and its generation, to end
+// its gather with EndGatherOf.
+func (ri *RunningInput) Instance() (telegraf.Input, int) {
+	ri.lastGatherMu.Lock()
+	defer ri.lastGatherMu.Unlock()
+	return ri.Input, ri.generation
+}
+
+// EndGatherOf marks the gather of the instance of the given generation as
+// finished, the gathers of replaced instances are ignored.
+func (ri *RunningInput) EndGatherOf(generation int) {
+	ri.lastGatherMu.Lock()
+	if generation == ri.generation {
+		ri.gathering = false
+	}
+	ri.lastGatherMu.Unlock()
+}
+
+// Replace replaces the instance of the input by plugin, which may gather
+// while a gather of the replaced instance is still running.
+func (ri *RunningInput) Replace(plugin telegraf.Input) {
+	ri.lastGatherMu.Lock()
+	defer ri.lastGatherMu.Unlock()
+	ri.Input = plugin
+	ri.generation++
+	ri.gathering = false
+	ri.failures = 0
+}
+
+// RecordGather records whether a gather of the input failed by timing out
+// or panicking, returning the number of consecutive failed gathers.
+func (ri *RunningInput) RecordGather(failed bool) int {
+	ri.lastGatherMu.Lock()
+	defer ri.lastGatherMu.Unlock()
+	if failed {
+		ri.failures++
+	} else {
+		ri.failures = 0
+	}
+	return ri.failures
+}
+
+// SetLastGather records the time the input finished gathering.
+func (ri *RunningInput) SetLastGather(t time.Time) {
+	ri.lastGatherMu.Lock()
+	ri.lastGather = t
+	ri.lastGatherMu.Unlock()
+}
+
+// Ready returns whether the input was marked ready by SetReady.
+func (ri *RunningInput) Ready() bool {
+	ri.lastGatherMu.Lock()
+	defer ri.lastGatherMu.Unlock()
+	return ri.ready
+}
+
+// SetReady marks the input as ready to gather or start, it stays ready
+// across reloads.
+func (ri *RunningInput) SetReady() {
+	ri.lastGatherMu.Lock()
+	ri.ready = true
+	ri.lastGatherMu.Unlock()
+}
+
+// LastGather returns the time the input last finished gathering, the zero
+// time if it never did.
+func (ri *RunningInput) LastGather() time.Time {
+	ri.lastGatherMu.Lock()
+	defer ri.lastGatherMu.Unlock()
+	return ri.lastGather
 }
 
 // InputConfig containing a name, interval, and filter
@@ -21,4 +142,49 @@ type InputConfig struct {
 	Tags              map[string]string
 	Filter            Filter
 	Interval          time.Duration
+
+	// CollectionJitter overrides the collection jitter of the agent if set
+	CollectionJitter *time.Duration
+
+	// LogLevel is the level of the logs of the input, the level of the agent
+	// if unset
+	LogLevel logger.Level
+
+	// Pipeline is the name of the pipeline of the input, the default
+	// pipeline if empty
+	Pipeline string
+
+	// Singleton inputs only run on the leader of the cluster of the agent
+	Singleton bool
+
+	// GatherTimeout is the deadline of the gathers of the input, overriding
+	// the gather timeout of the agent
+	GatherTimeout time.Duration
+
+	// StartupDelay delays the first gather, or the start of a service input,
+	// after the agent starts
+	StartupDelay time.Duration
+
+	// WaitFor are the addresses, like "tcp://localhost:8086" or
+	// "unix:///var/run/docker.sock", accepting connections before the input
+	// first gathers or starts
+	WaitFor []string
+}
+
+// ParseWaitFor returns the network and address of a wait_for address,
+// tcp://host:port, unix:///path or host:port for tcp.
+func ParseWaitFor(address string) (string, string, error) {
+	if strings.HasPrefix(address, "unix://") {
+		return "unix", strings.TrimPrefix(address, "unix://"), nil
+	}
+	if strings.Contains(address, "://") &&
+		!strings.HasPrefix(address, "tcp://") {
+		return "", "", fmt.Errorf("unsupported address %s, expected "+
+			"tcp://host:port or unix:///path", address)
+	}
+	hostport := strings.TrimPrefix(address, "tcp://")
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		return "", "", fmt.Errorf("invalid address %s, %s", address, err)
+	}
+	return "tcp", hostport, nil
 }
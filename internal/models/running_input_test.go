@@ -0,0 +1,34 @@
+package internal_models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWaitFor(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		addr    string
+		err     bool
+	}{
+		{"tcp://localhost:8086", "tcp", "localhost:8086", false},
+		{"unix:///var/run/docker.sock", "unix", "/var/run/docker.sock", false},
+		{"localhost:8086", "tcp", "localhost:8086", false},
+		{"[::1]:8086", "tcp", "[::1]:8086", false},
+		{"tcp://localhost", "", "", true},
+		{"localhost", "", "", true},
+		{"udp://localhost:53", "", "", true},
+	}
+	for _, tt := range tests {
+		network, addr, err := ParseWaitFor(tt.address)
+		if tt.err {
+			assert.Error(t, err, tt.address)
+			continue
+		}
+		assert.NoError(t, err, tt.address)
+		assert.Equal(t, tt.network, network, tt.address)
+		assert.Equal(t, tt.addr, addr, tt.address)
+	}
+}
@@ -1,11 +1,13 @@
 package internal_models
 
 import (
-	"log"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/logger"
+	"github.com/influxdata/telegraf/selfstat"
 )
 
 const (
@@ -16,6 +18,13 @@ const (
 	FULL_METRIC_BUFFERS_LIMIT = 100
 )
 
+var (
+	// Number of metrics written by all outputs
+	metricsWritten = selfstat.Register("agent", "metrics_written", nil)
+	// Number of metrics dropped by all outputs
+	metricsDropped = selfstat.Register("agent", "metrics_dropped", nil)
+)
+
 type RunningOutput struct {
 	Name                string
 	Output              telegraf.Output
@@ -24,10 +33,51 @@ type RunningOutput struct {
 	MetricBufferLimit   int
 	FlushBufferWhenFull bool
 
+	// Fingerprint identifies the configuration of the output, outputs with
+	// the same fingerprint are configured identically.
+	Fingerprint string
+
+	// WAL spools the metrics that don't fit in the buffers to disk, if set,
+	// see OpenWAL
+	WAL *WAL
+
+	// DeadLetter receives the metrics rejected by the output, which are
+	// dropped if nil
+	DeadLetter DeadLetter
+
+	// Pause and error state of the control API, a paused output keeps
+	// buffering metrics without writing them
+	PluginState
+
+	// Log logs the messages about the output
+	Log *logger.Logger
+
+	// Tracer times the writes of the traced metrics, if set
+	Tracer *Tracer
+
 	metrics    []telegraf.Metric
 	tmpmetrics map[int][]telegraf.Metric
 	overwriteI int
 	mapI       int
+	// whether metrics were dropped since the last write, with the
+	// BufferDropNewest strategy
+	droppingNewest bool
+
+	// Statistics reported by the internal input
+	metricsWritten  *selfstat.Stat
+	metricsDropped  *selfstat.Stat
+	metricsRejected *selfstat.Stat
+	writeTime       *selfstat.Stat
+	writeErrors     *selfstat.Stat
+	bufferSize      *selfstat.Stat
+	bufferLimit     *selfstat.Stat
+
+	// rateLimiter delays the writes exceeding the rate limit, if set
+	rateLimiter *rateLimiter
+
+	// Number of writes failed since the last successful one
+	failedWritesMu sync.Mutex
+	failedWrites   int
 
 	sync.Mutex
 }
@@ -44,7 +94,19 @@ func NewRunningOutput(
 		Output:            output,
 		Config:            conf,
 		MetricBufferLimit: DEFAULT_METRIC_BUFFER_LIMIT,
+		Log:               logger.New("outputs."+name, conf.LogLevel),
 	}
+	if conf.RateLimit.Rate > 0 {
+		ro.rateLimiter = newRateLimiter(conf.RateLimit)
+	}
+	tags := map[string]string{"output": name}
+	ro.metricsWritten = selfstat.Register("write", "metrics_written", tags)
+	ro.metricsDropped = selfstat.Register("write", "metrics_dropped", tags)
+	ro.writeTime = selfstat.RegisterGauge("write", "write_time_ns", tags)
+	ro.writeErrors = selfstat.Register("write", "errors", tags)
+	ro.bufferSize = selfstat.RegisterGauge("write", "buffer_size", tags)
+	ro.bufferLimit = selfstat.RegisterGauge("write", "buffer_limit", tags)
+	ro.metricsRejected = selfstat.Register("write", "metrics_rejected", tags)
 	return ro
 }
 
@@ -58,21 +120,24 @@ func (ro *RunningOutput) AddMetric(metric telegraf.Metric) {
 	}
 	ro.Lock()
 	defer ro.Unlock()
+	defer ro.updateBufferStats()
 
 	if len(ro.metrics) < ro.MetricBufferLimit {
 		ro.metrics = append(ro.metrics, metric)
 	} else {
-		if ro.FlushBufferWhenFull {
+		if ro.FlushBufferWhenFull && !ro.Paused() {
 			ro.metrics = append(ro.metrics, metric)
 			tmpmetrics := make([]telegraf.Metric, len(ro.metrics))
 			copy(tmpmetrics, ro.metrics)
 			ro.metrics = make([]telegraf.Metric, 0)
 			err := ro.write(tmpmetrics)
 			if err != nil {
-				log.Printf("ERROR writing full metric buffer to output %s, %s",
-					ro.Name, err)
-				if len(ro.tmpmetrics) == FULL_METRIC_BUFFERS_LIMIT {
+				ro.Log.Errorf("Could not write the full metric buffer: %s", err)
+				if len(ro.tmpmetrics) == FULL_METRIC_BUFFERS_LIMIT && ro.WAL != nil {
+					ro.spool(tmpmetrics)
+				} else if len(ro.tmpmetrics) == FULL_METRIC_BUFFERS_LIMIT {
 					ro.mapI = 0
+					ro.dropped(len(ro.tmpmetrics[ro.mapI]))
 					// overwrite one
 					ro.tmpmetrics[ro.mapI] = tmpmetrics
 					ro.mapI++
@@ -81,31 +146,71 @@ func (ro *RunningOutput) AddMetric(metric telegraf.Metric) {
 					ro.mapI++
 				}
 			}
+		} else if ro.WAL != nil {
+			// Spool the full buffer instead of overwriting it
+			ro.spool(ro.metrics)
+			ro.metrics = []telegraf.Metric{metric}
+		} else if ro.Config.BufferFullStrategy == BufferBlock {
+			// The agent stops routing metrics to the full buffer, only
+			// handed over and dead letter metrics exceed its limit
+			ro.metrics = append(ro.metrics, metric)
+		} else if ro.Config.BufferFullStrategy == BufferDropNewest {
+			if !ro.droppingNewest {
+				ro.Log.Warnf("Dropping new metrics, the buffer is full, you " +
+					"may want to increase the metric_buffer_limit setting in " +
+					"your [agent] config if you do not wish to drop metrics.")
+				ro.droppingNewest = true
+			}
+			ro.dropped(1)
 		} else {
 			if ro.overwriteI == 0 {
-				log.Printf("WARNING: overwriting cached metrics, you may want to " +
+				ro.Log.Warnf("Overwriting cached metrics, you may want to " +
 					"increase the metric_buffer_limit setting in your [agent] " +
-					"config if you do not wish to overwrite metrics.\n")
+					"config if you do not wish to overwrite metrics.")
 			}
 			if ro.overwriteI == len(ro.metrics) {
 				ro.overwriteI = 0
 			}
+			ro.dropped(1)
 			ro.metrics[ro.overwriteI] = metric
 			ro.overwriteI++
 		}
 	}
 }
 
+// OpenWAL opens the WAL in the WALDir of the config of the output, unless
+// it has none or it is open. It is opened when the output starts rather than
+// when its config is loaded, once the output it replaces closed its own WAL
+// of the same directory.
+func (ro *RunningOutput) OpenWAL() error {
+	ro.Lock()
+	defer ro.Unlock()
+	if ro.WAL != nil || ro.Config.WALDir == "" {
+		return nil
+	}
+	wal, err := NewWAL(ro.Config.WALDir, ro.Config.WALMaxBytes)
+	if err != nil {
+		return fmt.Errorf("Could not open WAL of output %s, %s", ro.Name, err)
+	}
+	ro.WAL = wal
+	return nil
+}
+
 // Write writes all cached points to this output.
 func (ro *RunningOutput) Write() error {
 	ro.Lock()
 	defer ro.Unlock()
+	defer ro.updateBufferStats()
+	if ro.Paused() {
+		return nil
+	}
 	err := ro.write(ro.metrics)
 	if err != nil {
 		return err
 	} else {
 		ro.metrics = make([]telegraf.Metric, 0)
 		ro.overwriteI = 0
+		ro.droppingNewest = false
 	}
 
 	// Write any cached metric buffers that failed previously
@@ -117,27 +222,319 @@ func (ro *RunningOutput) Write() error {
 		}
 	}
 
+	// The output accepts writes again, replay the metrics spooled to disk
+	if ro.WAL != nil {
+		return ro.WAL.Replay(ro.write)
+	}
 	return nil
 }
 
+// TakeMetrics removes and returns all cached points of this output,
+// including the buffers that failed to be written.
+func (ro *RunningOutput) TakeMetrics() []telegraf.Metric {
+	ro.Lock()
+	defer ro.Unlock()
+
+	metrics := ro.metrics
+	for _, tmpmetrics := range ro.tmpmetrics {
+		metrics = append(metrics, tmpmetrics...)
+	}
+	ro.metrics = make([]telegraf.Metric, 0)
+	ro.tmpmetrics = make(map[int][]telegraf.Metric)
+	ro.overwriteI = 0
+	ro.mapI = 0
+	ro.updateBufferStats()
+	return metrics
+}
+
+// Shrink lowers the buffer limit of the output to limit metrics, when the
+// agent is short of memory. The full buffers of failed writes are spooled to
+// the WAL, or dropped without one, as are the oldest metrics beyond the
+// limit. It returns the number of dropped metrics.
+func (ro *RunningOutput) Shrink(limit int) int {
+	ro.Lock()
+	defer ro.Unlock()
+	defer ro.updateBufferStats()
+
+	dropped := 0
+	for i, tmpmetrics := range ro.tmpmetrics {
+		if ro.WAL != nil {
+			ro.spool(tmpmetrics)
+		} else {
+			ro.dropped(len(tmpmetrics))
+			dropped += len(tmpmetrics)
+		}
+		delete(ro.tmpmetrics, i)
+	}
+	ro.mapI = 0
+
+	if n := len(ro.metrics) - limit; n > 0 {
+		// Put the metrics back in order when they were being overwritten
+		metrics := make([]telegraf.Metric, 0, len(ro.metrics))
+		metrics = append(metrics, ro.metrics[ro.overwriteI:]...)
+		metrics = append(metrics, ro.metrics[:ro.overwriteI]...)
+		// Copied so that the dropped metrics can be garbage collected
+		ro.metrics = append(make([]telegraf.Metric, 0, limit), metrics[n:]...)
+		ro.overwriteI = 0
+		ro.dropped(n)
+		dropped += n
+	}
+	ro.MetricBufferLimit = limit
+	return dropped
+}
+
+// Blocking returns whether the output blocks the inputs of its pipeline
+// while its buffer is full, rather than dropping metrics.
+func (ro *RunningOutput) Blocking() bool {
+	return ro.Config.BufferFullStrategy == BufferBlock && ro.WAL == nil &&
+		!ro.FlushBufferWhenFull
+}
+
+// Full returns whether the buffer of the output holds metric_buffer_limit
+// metrics.
+func (ro *RunningOutput) Full() bool {
+	ro.Lock()
+	defer ro.Unlock()
+	return len(ro.metrics) >= ro.MetricBufferLimit
+}
+
+// SetMetricBufferLimit sets the buffer limit of the output, as when
+// restoring it after a Shrink.
+func (ro *RunningOutput) SetMetricBufferLimit(limit int) {
+	ro.Lock()
+	ro.MetricBufferLimit = limit
+	ro.updateBufferStats()
+	ro.Unlock()
+}
+
+// FailedWrites returns the number of writes which failed since the last
+// successful one.
+func (ro *RunningOutput) FailedWrites() int {
+	ro.failedWritesMu.Lock()
+	defer ro.failedWritesMu.Unlock()
+	return ro.failedWrites
+}
+
+// spool appends metrics to the WAL.
+func (ro *RunningOutput) spool(metrics []telegraf.Metric) {
+	if err := ro.WAL.Append(metrics); err != nil {
+		ro.Log.Errorf("Could not spool metrics to disk: %s", err)
+		ro.dropped(len(metrics))
+	}
+}
+
+// reject hands the metrics rejected by the output to the dead letter, and
+// returns their number.
+func (ro *RunningOutput) reject(
+	metrics []telegraf.Metric,
+	rejected *telegraf.RejectedError,
+) int {
+	if rejected.Metrics != nil {
+		metrics = rejected.Metrics
+	}
+	n := len(metrics)
+	ro.metricsRejected.Incr(int64(n))
+	if ro.DeadLetter == nil {
+		ro.Log.Errorf("Rejected %d metrics, dropping them: %s", n,
+			rejected.Reason)
+		ro.dropped(n)
+		return n
+	}
+	if err := ro.DeadLetter.Reject(ro.Name, metrics, rejected.Reason); err != nil {
+		ro.Log.Errorf("Could not keep %d rejected metrics, dropping them: %s",
+			n, err)
+		ro.dropped(n)
+	}
+	return n
+}
+
+func (ro *RunningOutput) dropped(n int) {
+	ro.metricsDropped.Incr(int64(n))
+	metricsDropped.Incr(int64(n))
+}
+
+// updateBufferStats records the number of metrics in the buffers.
+func (ro *RunningOutput) updateBufferStats() {
+	n := len(ro.metrics)
+	for _, tmpmetrics := range ro.tmpmetrics {
+		n += len(tmpmetrics)
+	}
+	ro.bufferSize.Set(int64(n))
+	ro.bufferLimit.Set(int64(ro.MetricBufferLimit))
+}
+
 func (ro *RunningOutput) write(metrics []telegraf.Metric) error {
 	if len(metrics) == 0 {
 		return nil
 	}
+	if ro.rateLimiter != nil {
+		ro.rateLimiter.wait(metrics)
+	}
 	start := time.Now()
-	err := ro.Output.Write(metrics)
+	out := metrics
+	if ro.Config.SpanContextTags {
+		out = addSpanTags(out)
+	}
+	err := ro.Output.Write(ro.Config.Timestamps.apply(out))
 	elapsed := time.Since(start)
-	if err == nil {
+	written := len(metrics)
+	if rejected, ok := err.(*telegraf.RejectedError); ok {
+		// Rejected metrics are not retried, the write is done
+		written -= ro.reject(metrics, rejected)
+		ro.AddError(time.Now(), err)
+		err = nil
+	}
+	ro.writeTime.Set(elapsed.Nanoseconds())
+	ro.failedWritesMu.Lock()
+	if err != nil {
+		ro.failedWrites++
+	} else {
+		ro.failedWrites = 0
+	}
+	ro.failedWritesMu.Unlock()
+	if err != nil {
+		ro.writeErrors.Incr(1)
+		ro.AddError(time.Now(), err)
+	} else {
+		ro.metricsWritten.Incr(int64(written))
+		metricsWritten.Incr(int64(written))
+		ro.Tracer.Written(ro.Name, metrics, start, elapsed)
 		if !ro.Quiet {
-			log.Printf("Wrote %d metrics to output %s in %s\n",
-				len(metrics), ro.Name, elapsed)
+			ro.Log.Infof("Wrote %d metrics in %s", written, elapsed)
 		}
 	}
 	return err
 }
 
-// OutputConfig containing name and filter
+// OutputConfig containing name, filter, route, failover, rate limit, dead
+// letter, timestamp precision and the WAL settings
 type OutputConfig struct {
 	Name   string
 	Filter Filter
+
+	// Route selects the metrics sent to the output, all of them if nil
+	Route *Route
+
+	// FailoverGroup is the name of the failover group of the output, none
+	// if empty
+	FailoverGroup string
+	// FailbackInterval is the time after which the group of a primary
+	// output fails back to it
+	FailbackInterval time.Duration
+
+	// RateLimit limits the writes of the output, which block the flushes
+	// instead of dropping metrics. No limit if its rate is 0.
+	RateLimit RateLimit
+
+	// DeadLetterFile is the file receiving the metrics rejected by the
+	// output, and DeadLetterOutput the name of the output receiving them
+	DeadLetterFile   string
+	DeadLetterOutput string
+
+	// WALDir is the directory of the WAL of the output, none if empty
+	WALDir      string
+	WALMaxBytes int64
+
+	// Timestamps is the precision of the timestamps written by the output
+	Timestamps TimestampPrecision
+
+	// SpanContextTags adds the span context of the metrics carrying one as
+	// the trace_id and span_id tags of the metrics written by the output
+	SpanContextTags bool
+
+	// BufferFullStrategy is what happens to the metrics added to the full
+	// buffer, BufferDropOldest if empty
+	BufferFullStrategy string
+
+	// LogLevel is the level of the logs of the output, the level of the
+	// agent if unset
+	LogLevel logger.Level
+
+	// Pipeline is the name of the pipeline of the output, the default
+	// pipeline if empty
+	Pipeline string
+}
+
+// The strategies of an output whose buffer is full: overwriting its oldest
+// metrics, dropping the added metrics, or blocking the inputs of its
+// pipeline until the buffer is written.
+const (
+	BufferDropOldest = "drop_oldest"
+	BufferDropNewest = "drop_newest"
+	BufferBlock      = "block"
+)
+
+// The roundings of the timestamps of a TimestampPrecision.
+const (
+	TimestampTruncate = "truncate"
+	TimestampRound    = "round"
+)
+
+// TimestampPrecision sets the precision of the timestamps of the metrics
+// written by an output. The written metrics are copies, so that the other
+// outputs keep the full precision.
+type TimestampPrecision struct {
+	// Precision of the timestamps, kept as they are if 0
+	Precision time.Duration
+	// Rounding of the timestamps to the precision, TimestampTruncate if
+	// empty or TimestampRound
+	Rounding string
+}
+
+func (p TimestampPrecision) apply(metrics []telegraf.Metric) []telegraf.Metric {
+	if p.Precision <= 0 {
+		return metrics
+	}
+	out := make([]telegraf.Metric, len(metrics))
+	for i, m := range metrics {
+		t := m.Time().Truncate(p.Precision)
+		if p.Rounding == TimestampRound {
+			t = m.Time().Round(p.Precision)
+		}
+		if t.Equal(m.Time()) {
+			out[i] = m
+			continue
+		}
+		nm, err := telegraf.NewMetric(m.Name(), m.Tags(), m.Fields(), t)
+		if err != nil {
+			out[i] = m
+			continue
+		}
+		out[i] = keepSpan(m, nm)
+	}
+	return out
+}
+
+// addSpanTags returns copies of the metrics carrying a span context, tagged
+// with its trace_id and span_id.
+func addSpanTags(metrics []telegraf.Metric) []telegraf.Metric {
+	out := make([]telegraf.Metric, len(metrics))
+	for i, m := range metrics {
+		out[i] = m
+		sc, ok := telegraf.SpanContextOf(m)
+		if !ok {
+			continue
+		}
+		tags := make(map[string]string, len(m.Tags())+2)
+		for k, v := range m.Tags() {
+			tags[k] = v
+		}
+		tags["trace_id"] = sc.TraceID
+		tags["span_id"] = sc.SpanID
+		nm, err := telegraf.NewMetric(m.Name(), tags, m.Fields(), m.Time())
+		if err != nil {
+			continue
+		}
+		out[i] = telegraf.WithSpanContext(nm, sc)
+	}
+	return out
+}
+
+// keepSpan returns to, a copy of from, carrying the span context of from if
+// any.
+func keepSpan(from, to telegraf.Metric) telegraf.Metric {
+	if sc, ok := telegraf.SpanContextOf(from); ok {
+		return telegraf.WithSpanContext(to, sc)
+	}
+	return to
 }
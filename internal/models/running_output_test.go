@@ -2,9 +2,12 @@ package internal_models
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/testutil"
@@ -86,6 +89,49 @@ func TestRunningOutputOverwrite(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+// Test that the added metrics are dropped with the drop_newest strategy.
+func TestRunningOutputDropNewest(t *testing.T) {
+	conf := &OutputConfig{
+		BufferFullStrategy: BufferDropNewest,
+	}
+
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, conf)
+	ro.MetricBufferLimit = 4
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	assert.True(t, ro.Full())
+	assert.False(t, ro.Blocking())
+
+	require.NoError(t, ro.Write())
+	require.Len(t, m.Metrics(), 4)
+	for i, exp := range first5[:4] {
+		assert.Equal(t, exp.String(), m.Metrics()[i].String())
+	}
+}
+
+// Test that a blocking output keeps the metrics exceeding its limit.
+func TestRunningOutputBlock(t *testing.T) {
+	conf := &OutputConfig{
+		BufferFullStrategy: BufferBlock,
+	}
+
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, conf)
+	ro.MetricBufferLimit = 4
+	assert.True(t, ro.Blocking())
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	assert.True(t, ro.Full())
+	require.NoError(t, ro.Write())
+	require.Len(t, m.Metrics(), 5)
+	assert.False(t, ro.Full())
+}
+
 // Test that multiple buffer overflows are handled properly.
 func TestRunningOutputMultiOverwrite(t *testing.T) {
 	conf := &OutputConfig{
@@ -216,6 +262,177 @@ func TestRunningOutputWriteFail(t *testing.T) {
 	assert.Len(t, m.Metrics(), 10)
 }
 
+func TestRunningOutputTakeMetrics(t *testing.T) {
+	conf := &OutputConfig{
+		Filter: Filter{
+			IsActive: false,
+		},
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro := NewRunningOutput("test", m, conf)
+	ro.FlushBufferWhenFull = true
+	ro.MetricBufferLimit = 4
+
+	// one failed full buffer and one partial buffer
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	for _, metric := range next5[:2] {
+		ro.AddMetric(metric)
+	}
+
+	metrics := ro.TakeMetrics()
+	assert.Len(t, metrics, 7)
+
+	// nothing is left to write
+	m.failWrite = false
+	err := ro.Write()
+	require.NoError(t, err)
+	assert.Len(t, m.Metrics(), 0)
+}
+
+// Test that the metrics overflowing the buffer are spooled to the WAL and
+// written once the output recovers.
+func TestRunningOutputWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &OutputConfig{
+		Filter: Filter{
+			IsActive: false,
+		},
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro := NewRunningOutput("test", m, conf)
+	ro.MetricBufferLimit = 4
+	ro.WAL, err = NewWAL(dir, 0)
+	require.NoError(t, err)
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	for _, metric := range next5 {
+		ro.AddMetric(metric)
+	}
+	assert.True(t, ro.WAL.Size() > 0)
+
+	err = ro.Write()
+	require.Error(t, err)
+	assert.Len(t, m.Metrics(), 0)
+
+	m.failWrite = false
+	err = ro.Write()
+	require.NoError(t, err)
+	assert.Len(t, m.Metrics(), 10)
+	assert.Equal(t, int64(0), ro.WAL.Size())
+}
+
+// Test that the timestamps written by an output with a precision are
+// truncated or rounded, leaving the buffered metrics as they are.
+func TestRunningOutputTimestampPrecision(t *testing.T) {
+	ts := time.Unix(100, 600*int64(time.Millisecond))
+	metric, err := telegraf.NewMetric("cpu", map[string]string{"host": "a"},
+		map[string]interface{}{"value": 1.0}, ts)
+	require.NoError(t, err)
+
+	tests := []struct {
+		rounding string
+		expected time.Time
+	}{
+		{"", time.Unix(100, 0)},
+		{TimestampRound, time.Unix(101, 0)},
+	}
+	for _, tt := range tests {
+		m := &mockOutput{}
+		ro := NewRunningOutput("test", m, &OutputConfig{
+			Timestamps: TimestampPrecision{
+				Precision: time.Second,
+				Rounding:  tt.rounding,
+			},
+		})
+		ro.Quiet = true
+		ro.AddMetric(metric)
+		require.NoError(t, ro.Write())
+		require.Len(t, m.Metrics(), 1)
+		assert.Equal(t, tt.expected.UnixNano(), m.Metrics()[0].UnixNano())
+		assert.Equal(t, metric.Fields(), m.Metrics()[0].Fields())
+		assert.Equal(t, ts.UnixNano(), metric.UnixNano())
+	}
+}
+
+func TestRunningOutputSpanContextTags(t *testing.T) {
+	sc := telegraf.SpanContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+	}
+	traced, err := telegraf.NewMetric("cpu", map[string]string{"host": "a"},
+		map[string]interface{}{"value": 1.0},
+		time.Unix(100, 600*int64(time.Millisecond)))
+	require.NoError(t, err)
+	traced = telegraf.WithSpanContext(traced, sc)
+	untraced, err := telegraf.NewMetric("mem", map[string]string{"host": "a"},
+		map[string]interface{}{"value": 1.0}, time.Unix(100, 0))
+	require.NoError(t, err)
+
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, &OutputConfig{
+		SpanContextTags: true,
+		Timestamps:      TimestampPrecision{Precision: time.Second},
+	})
+	ro.Quiet = true
+	ro.AddMetric(traced)
+	ro.AddMetric(untraced)
+	require.NoError(t, ro.Write())
+	require.Len(t, m.Metrics(), 2)
+
+	written := m.Metrics()[0]
+	assert.Equal(t, map[string]string{"host": "a",
+		"trace_id": sc.TraceID, "span_id": sc.SpanID}, written.Tags())
+	assert.Equal(t, time.Unix(100, 0).UnixNano(), written.UnixNano())
+	// The span context is kept by the copies
+	got, ok := telegraf.SpanContextOf(written)
+	assert.True(t, ok)
+	assert.Equal(t, sc, got)
+	assert.Equal(t, map[string]string{"host": "a"}, traced.Tags())
+
+	assert.Equal(t, untraced, m.Metrics()[1])
+}
+
+// Test that shrinking the buffer drops the full buffers and the oldest
+// metrics beyond the new limit.
+func TestRunningOutputShrink(t *testing.T) {
+	m := &mockOutput{}
+	m.failWrite = true
+	ro := NewRunningOutput("test", m, &OutputConfig{})
+	ro.Quiet = true
+	ro.MetricBufferLimit = 4
+	ro.FlushBufferWhenFull = true
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	for _, metric := range next5[:3] {
+		ro.AddMetric(metric)
+	}
+	require.Len(t, ro.tmpmetrics, 1)
+
+	assert.Equal(t, 5+1, ro.Shrink(2))
+	assert.Len(t, ro.tmpmetrics, 0)
+	assert.Equal(t, 2, ro.MetricBufferLimit)
+
+	m.failWrite = false
+	require.NoError(t, ro.Write())
+	assert.Equal(t, next5[1:3], m.Metrics())
+
+	ro.SetMetricBufferLimit(4)
+	assert.Equal(t, 4, ro.MetricBufferLimit)
+}
+
 type mockOutput struct {
 	sync.Mutex
 
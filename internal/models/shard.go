@@ -0,0 +1,49 @@
+package internal_models
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Shard is the shard ID of Count shards gathered by an agent. A target
+// belongs to the shard of the highest hash of the target and shard, so that
+// the agents split the targets without coordinating, and adding a shard
+// only moves the targets which then belong to the new shard. A nil Shard
+// owns all targets.
+type Shard struct {
+	ID    int
+	Count int
+}
+
+// Owns returns whether target belongs to the shard.
+func (s *Shard) Owns(target string) bool {
+	if s == nil || s.Count <= 1 {
+		return true
+	}
+	var best uint64
+	owner := 0
+	for i := 0; i < s.Count; i++ {
+		if w := shardWeight(i, target); i == 0 || w > best {
+			best, owner = w, i
+		}
+	}
+	return owner == s.ID
+}
+
+// shardWeight returns the hash of the target for the shard id.
+func shardWeight(id int, target string) uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(id))
+	h.Write(b[:])
+	h.Write([]byte(target))
+
+	// Mix the bits, fnv alone spreads close targets poorly
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
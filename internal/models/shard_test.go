@@ -0,0 +1,46 @@
+package internal_models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardOwns(t *testing.T) {
+	var targets []string
+	for i := 0; i < 1000; i++ {
+		targets = append(targets, fmt.Sprintf("http://uwsgi-%d:1717", i))
+	}
+	owner := func(count int, target string) int {
+		owners := 0
+		id := -1
+		for i := 0; i < count; i++ {
+			if (&Shard{ID: i, Count: count}).Owns(target) {
+				owners++
+				id = i
+			}
+		}
+		assert.Equal(t, 1, owners, target)
+		return id
+	}
+
+	sizes := make([]int, 4)
+	for _, target := range targets {
+		sizes[owner(4, target)]++
+	}
+	for _, size := range sizes {
+		assert.InDelta(t, 250, size, 75)
+	}
+
+	// A fifth shard only takes targets over
+	for _, target := range targets {
+		if before, after := owner(4, target), owner(5, target); before != after {
+			assert.Equal(t, 4, after, target)
+		}
+	}
+
+	var s *Shard
+	assert.True(t, s.Owns(targets[0]))
+	assert.True(t, (&Shard{ID: 0, Count: 1}).Owns(targets[0]))
+}
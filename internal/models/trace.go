@@ -0,0 +1,146 @@
+package internal_models
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/logger"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+const (
+	// Time after which the trace of a metric which was not written, being
+	// filtered or dropped, is discarded.
+	TRACE_TIMEOUT = 10 * time.Minute
+
+	// Limit of the metrics traced at once, no more metrics are sampled
+	// until traces complete or time out.
+	TRACES_LIMIT = 10000
+)
+
+// Tracer samples metrics to time their way through the agent: from the
+// gather until the flusher routes them, the queue, then in the buffer of each
+// output until it writes them and the write itself. The timings of the last
+// traced metric of each input and output are reported by the internal input
+// as the trace measurement, and logged at debug level. A nil Tracer traces
+// nothing.
+type Tracer struct {
+	// SampleRate is the fraction of the gathered metrics traced
+	SampleRate float64
+
+	mu     sync.Mutex
+	traces map[telegraf.Metric]*trace
+	random func() float64
+	now    func() time.Time
+}
+
+type trace struct {
+	input    string
+	gathered time.Time
+	routed   time.Time
+	// outputs which wrote the metric
+	written map[string]bool
+}
+
+func NewTracer(sampleRate float64) *Tracer {
+	return &Tracer{
+		SampleRate: sampleRate,
+		traces:     make(map[telegraf.Metric]*trace),
+		random:     rand.Float64,
+		now:        time.Now,
+	}
+}
+
+// Gathered samples the metric gathered by input.
+func (t *Tracer) Gathered(input string, m telegraf.Metric) {
+	if t == nil || t.random() >= t.SampleRate {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if len(t.traces) >= TRACES_LIMIT {
+		for tm, tr := range t.traces {
+			if now.Sub(tr.gathered) >= TRACE_TIMEOUT {
+				delete(t.traces, tm)
+			}
+		}
+		if len(t.traces) >= TRACES_LIMIT {
+			return
+		}
+	}
+	t.traces[m] = &trace{
+		input:    input,
+		gathered: now,
+		written:  make(map[string]bool),
+	}
+}
+
+// Routed records the flusher routing the metric to the outputs.
+func (t *Tracer) Routed(m telegraf.Metric) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.traces[m]; ok {
+		tr.routed = t.now()
+	}
+}
+
+// Written records the output writing the metrics, in a write which started
+// at start and took elapsed.
+func (t *Tracer) Written(
+	output string,
+	metrics []telegraf.Metric,
+	start time.Time,
+	elapsed time.Duration,
+) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range metrics {
+		tr, ok := t.traces[m]
+		if !ok || tr.written[output] || tr.routed.IsZero() {
+			continue
+		}
+		tr.written[output] = true
+		t.report(m, tr, output, start, elapsed)
+	}
+	// Traces are dropped when they time out, as the number of outputs a
+	// metric is written to is not known
+	now := t.now()
+	for m, tr := range t.traces {
+		if now.Sub(tr.gathered) >= TRACE_TIMEOUT {
+			delete(t.traces, m)
+		}
+	}
+}
+
+func (t *Tracer) report(
+	m telegraf.Metric,
+	tr *trace,
+	output string,
+	start time.Time,
+	elapsed time.Duration,
+) {
+	queue := tr.routed.Sub(tr.gathered)
+	buffer := start.Sub(tr.routed)
+	total := start.Add(elapsed).Sub(tr.gathered)
+
+	tags := map[string]string{"input": tr.input, "output": output}
+	selfstat.Register("trace", "metrics_traced", tags).Incr(1)
+	selfstat.RegisterGauge("trace", "queue_time_ns", tags).Set(queue.Nanoseconds())
+	selfstat.RegisterGauge("trace", "buffer_time_ns", tags).Set(buffer.Nanoseconds())
+	selfstat.RegisterGauge("trace", "write_time_ns", tags).Set(elapsed.Nanoseconds())
+	selfstat.RegisterGauge("trace", "total_time_ns", tags).Set(total.Nanoseconds())
+
+	var l *logger.Logger
+	l.Debugf("Trace of metric %s from input %s to output %s: queue %s, "+
+		"buffer %s, write %s, total %s", m.Name(), tr.input, output, queue,
+		buffer, elapsed, total)
+}
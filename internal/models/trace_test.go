@@ -0,0 +1,63 @@
+package internal_models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/selfstat"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	tracer := NewTracer(0.5)
+	clock := time.Unix(1000, 0)
+	tracer.now = func() time.Time { return clock }
+	sample := 0.1
+	tracer.random = func() float64 { return sample }
+
+	ro := NewRunningOutput("traced", &mockOutput{}, &OutputConfig{})
+	ro.Quiet = true
+	ro.Tracer = tracer
+
+	tracer.Gathered("cpu", first5[0])
+	sample = 0.9
+	tracer.Gathered("cpu", first5[1])
+	require.Len(t, tracer.traces, 1)
+
+	clock = clock.Add(time.Second)
+	tracer.Routed(first5[0])
+	tracer.Routed(first5[1])
+	ro.AddMetric(first5[0])
+	ro.AddMetric(first5[1])
+
+	tracer.Written("traced", ro.TakeMetrics(), clock.Add(2*time.Second),
+		500*time.Millisecond)
+
+	tags := map[string]string{"input": "cpu", "output": "traced"}
+	stat := func(field string) int64 {
+		return selfstat.RegisterGauge("trace", field, tags).Get()
+	}
+	assert.Equal(t, int64(time.Second), stat("queue_time_ns"))
+	assert.Equal(t, int64(2*time.Second), stat("buffer_time_ns"))
+	assert.Equal(t, int64(500*time.Millisecond), stat("write_time_ns"))
+	assert.Equal(t, int64(3500*time.Millisecond), stat("total_time_ns"))
+	assert.Equal(t, int64(1),
+		selfstat.Register("trace", "metrics_traced", tags).Get())
+
+	// A metric is traced once per output, until its trace times out
+	tracer.Written("traced", first5[:1], clock, 0)
+	assert.Equal(t, int64(1),
+		selfstat.Register("trace", "metrics_traced", tags).Get())
+	clock = clock.Add(TRACE_TIMEOUT)
+	tracer.Written("other", nil, clock, 0)
+	assert.Empty(t, tracer.traces)
+}
+
+func TestTracerNil(t *testing.T) {
+	var tracer *Tracer
+	tracer.Gathered("cpu", first5[0])
+	tracer.Routed(first5[0])
+	tracer.Written("traced", first5, time.Now(), 0)
+}
@@ -0,0 +1,200 @@
+package internal_models
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+)
+
+// Size of the WAL segment files, a new segment is started once the current
+// one is larger.
+const WAL_SEGMENT_BYTES = 1 << 20
+
+// WAL is a write-ahead log spooling the metrics an output could not keep in
+// memory to disk, so they can be written once the output recovers. Metrics
+// are stored in line protocol in numbered segment files of its directory,
+// and survive restarts of the agent.
+//
+// A WAL is not safe for concurrent use, the RunningOutput owning it
+// serializes the access.
+type WAL struct {
+	Dir string
+	// MaxBytes is the maximum disk usage of the segments, the oldest
+	// segments are dropped to stay below. No limit if 0.
+	MaxBytes int64
+
+	segments []walSegment
+	size     int64
+	current  *os.File
+	next     int64
+}
+
+type walSegment struct {
+	seq  int64
+	size int64
+}
+
+// NewWAL returns the WAL stored in dir, creating dir if needed. Segments
+// left by a previous run are kept to be replayed.
+func NewWAL(dir string, maxBytes int64) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WAL{Dir: dir, MaxBytes: maxBytes}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".wal") {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), ".wal"), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, walSegment{seq: seq, size: f.Size()})
+		w.size += f.Size()
+	}
+	sort.Sort(bySeq(w.segments))
+	if len(w.segments) > 0 {
+		w.next = w.segments[len(w.segments)-1].seq + 1
+	}
+	return w, nil
+}
+
+// Size returns the disk usage of the segments in bytes.
+func (w *WAL) Size() int64 {
+	return w.size
+}
+
+// Append spools metrics to the WAL. The oldest segments are dropped if the
+// WAL would grow larger than MaxBytes.
+func (w *WAL) Append(metrics []telegraf.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		buf.WriteString(m.String())
+		buf.WriteByte('\n')
+	}
+
+	if w.MaxBytes > 0 {
+		if int64(buf.Len()) > w.MaxBytes {
+			return fmt.Errorf("dropping %d metrics larger than the WAL limit "+
+				"of %d bytes", len(metrics), w.MaxBytes)
+		}
+		for len(w.segments) > 0 && w.size+int64(buf.Len()) > w.MaxBytes {
+			log.Printf("WARNING: WAL %s is full, dropping oldest %d bytes of "+
+				"metrics\n", w.Dir, w.segments[0].size)
+			if err := w.remove(); err != nil {
+				return err
+			}
+		}
+	}
+
+	last := len(w.segments) - 1
+	if w.current == nil || w.segments[last].size >= WAL_SEGMENT_BYTES {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+		last = len(w.segments) - 1
+	}
+
+	n, err := w.current.Write(buf.Bytes())
+	w.segments[last].size += int64(n)
+	w.size += int64(n)
+	return err
+}
+
+// Replay writes the spooled metrics, oldest first, and removes each segment
+// once written. It stops at the first failed write, keeping the remaining
+// segments.
+func (w *WAL) Replay(write func([]telegraf.Metric) error) error {
+	parser := &influx.InfluxParser{}
+	for len(w.segments) > 0 {
+		if w.current != nil && len(w.segments) == 1 {
+			w.current.Close()
+			w.current = nil
+		}
+
+		data, err := ioutil.ReadFile(w.path(w.segments[0].seq))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		metrics, err := parser.Parse(data)
+		if err != nil {
+			// A segment can end with a partial line if the agent crashed
+			log.Printf("ERROR parsing WAL segment %s: %s\n",
+				w.path(w.segments[0].seq), err)
+		}
+		if err := write(metrics); err != nil {
+			return err
+		}
+		if err := w.remove(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the segment being written.
+func (w *WAL) Close() error {
+	if w.current == nil {
+		return nil
+	}
+	err := w.current.Close()
+	w.current = nil
+	return err
+}
+
+// rotate starts a new segment.
+func (w *WAL) rotate() error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path(w.next),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	w.current = f
+	w.segments = append(w.segments, walSegment{seq: w.next})
+	w.next++
+	return nil
+}
+
+// remove deletes the oldest segment.
+func (w *WAL) remove() error {
+	if len(w.segments) == 1 {
+		w.Close()
+	}
+	seg := w.segments[0]
+	if err := os.Remove(w.path(seg.seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w.segments = w.segments[1:]
+	w.size -= seg.size
+	return nil
+}
+
+func (w *WAL) path(seq int64) string {
+	return filepath.Join(w.Dir, fmt.Sprintf("%020d.wal", seq))
+}
+
+type bySeq []walSegment
+
+func (s bySeq) Len() int           { return len(s) }
+func (s bySeq) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bySeq) Less(i, j int) bool { return s[i].seq < s[j].seq }
@@ -0,0 +1,91 @@
+package internal_models
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/influxdata/telegraf"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWAL(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(first5))
+	require.NoError(t, w.Close())
+
+	// The metrics are still there after a restart
+	w, err = NewWAL(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(next5))
+
+	var written []telegraf.Metric
+	err = w.Replay(func(metrics []telegraf.Metric) error {
+		written = append(written, metrics...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, written, 10)
+	assert.Equal(t, first5[0].String(), written[0].String())
+	assert.Equal(t, next5[4].String(), written[9].String())
+	assert.Equal(t, int64(0), w.Size())
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 0)
+}
+
+func TestWALReplayFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWAL(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(first5))
+	size := w.Size()
+
+	err = w.Replay(func(metrics []telegraf.Metric) error {
+		return os.ErrInvalid
+	})
+	require.Error(t, err)
+	assert.Equal(t, size, w.Size())
+}
+
+func TestWALMaxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWAL(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(first5))
+	size := w.Size()
+	require.NoError(t, w.Close())
+
+	// The reopened WAL starts a new segment, the old one gets dropped
+	w, err = NewWAL(dir, size+size/2)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(next5))
+	assert.True(t, w.Size() <= w.MaxBytes)
+
+	var written []telegraf.Metric
+	err = w.Replay(func(metrics []telegraf.Metric) error {
+		written = append(written, metrics...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, written, 5)
+	assert.Equal(t, next5[0].String(), written[0].String())
+
+	// Metrics larger than the limit are refused
+	w.MaxBytes = 10
+	require.Error(t, w.Append(first5))
+}
@@ -0,0 +1,199 @@
+// Package process runs an external command for the plugins talking to it
+// over its stdin and stdout, and restarts it when it exits.
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Time given to the process to exit once its stdin is closed by Stop
+const stopTimeout = 5 * time.Second
+
+type Process struct {
+	// Delay before restarting the process once it exited
+	RestartDelay time.Duration
+
+	// ReadStdout reads the stdout of each run of the process, until EOF.
+	// The output is discarded if nil.
+	ReadStdout func(io.Reader)
+	// ReadStderr reads the stderr of each run of the process, until EOF.
+	// Each line is logged if nil.
+	ReadStderr func(io.Reader)
+
+	name string
+	args []string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stopped bool
+
+	readers sync.WaitGroup
+	wg      sync.WaitGroup
+	done    chan struct{}
+}
+
+// New returns the process of command, the name of the program followed by
+// its arguments.
+func New(command []string) (*Process, error) {
+	if len(command) == 0 {
+		return nil, errors.New("no command given")
+	}
+	return &Process{
+		RestartDelay: 10 * time.Second,
+		name:         command[0],
+		args:         command[1:],
+	}, nil
+}
+
+// Start runs the process and keeps restarting it when it exits, until Stop
+// is called.
+func (p *Process) Start() error {
+	p.done = make(chan struct{})
+	if err := p.run(); err != nil {
+		return err
+	}
+	p.wg.Add(1)
+	go p.supervise()
+	return nil
+}
+
+// Stop closes the stdin of the process and waits for it to exit, killing it
+// if it does not in time.
+func (p *Process) Stop() {
+	if p.done == nil {
+		return
+	}
+	p.mu.Lock()
+	p.stopped = true
+	close(p.done)
+	if p.stdin != nil {
+		p.stdin.Close()
+	}
+	cmd := p.cmd
+	p.mu.Unlock()
+
+	exited := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		log.Printf("Process %s did not exit, killing it\n", p.name)
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// Write writes b to the stdin of the process.
+func (p *Process) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	stdin := p.stdin
+	p.mu.Unlock()
+	if stdin == nil {
+		return 0, fmt.Errorf("process %s is not running", p.name)
+	}
+	return stdin.Write(b)
+}
+
+// run starts the process and the readers of its output.
+func (p *Process) run() error {
+	cmd := exec.Command(p.name, p.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return errors.New("process stopped")
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Error starting process %s: %s", p.name, err)
+	}
+	p.cmd = cmd
+	p.stdin = stdin
+
+	readStdout, readStderr := p.ReadStdout, p.ReadStderr
+	if readStdout == nil {
+		readStdout = func(r io.Reader) { io.Copy(ioutil.Discard, r) }
+	}
+	if readStderr == nil {
+		readStderr = p.logStderr
+	}
+	p.readers.Add(2)
+	go func() {
+		defer p.readers.Done()
+		readStdout(stdout)
+	}()
+	go func() {
+		defer p.readers.Done()
+		readStderr(stderr)
+	}()
+	return nil
+}
+
+// supervise waits for the process to exit and restarts it.
+func (p *Process) supervise() {
+	defer p.wg.Done()
+	for {
+		// The pipes must be read to the end before waiting
+		p.readers.Wait()
+		p.mu.Lock()
+		cmd := p.cmd
+		p.mu.Unlock()
+		err := cmd.Wait()
+
+		p.mu.Lock()
+		p.stdin = nil
+		p.mu.Unlock()
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+		log.Printf("Process %s exited: %v, restarting it in %s\n",
+			p.name, err, p.RestartDelay)
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-time.After(p.RestartDelay):
+			}
+			err := p.run()
+			if err == nil {
+				break
+			}
+			log.Printf("%s, retrying in %s\n", err, p.RestartDelay)
+		}
+	}
+}
+
+func (p *Process) logStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Printf("Process %s: %s\n", p.name, scanner.Text())
+	}
+	// Drain what is left after a line too long to scan
+	io.Copy(ioutil.Discard, r)
+}
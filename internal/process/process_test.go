@@ -0,0 +1,69 @@
+package process
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessWrite(t *testing.T) {
+	p, err := New([]string{"cat"})
+	require.NoError(t, err)
+	lines := make(chan string, 10)
+	p.ReadStdout = func(r io.Reader) {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}
+	require.NoError(t, p.Start())
+
+	_, err = p.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	select {
+	case line := <-lines:
+		assert.Equal(t, "hello", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output")
+	}
+
+	p.Stop()
+	_, err = p.Write([]byte("hello\n"))
+	assert.Error(t, err)
+}
+
+func TestProcessRestart(t *testing.T) {
+	p, err := New([]string{"sh", "-c", "echo started"})
+	require.NoError(t, err)
+	p.RestartDelay = 10 * time.Millisecond
+	runs := make(chan bool, 100)
+	p.ReadStdout = func(r io.Reader) {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			runs <- true
+		}
+	}
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("process was not restarted")
+		}
+	}
+}
+
+func TestProcessNoCommand(t *testing.T) {
+	_, err := New(nil)
+	assert.Error(t, err)
+
+	p, err := New([]string{"/nonexistent/command"})
+	require.NoError(t, err)
+	assert.Error(t, p.Start())
+}
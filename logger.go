@@ -0,0 +1,18 @@
+package telegraf
+
+// Logger logs the messages of a plugin, scoped to the plugin and filtered by
+// its log level. Plugins with a field
+//
+//	Log telegraf.Logger `toml:"-"`
+//
+// are given their logger when the configuration is loaded.
+type Logger interface {
+	// Errorf logs an error the plugin could not recover from
+	Errorf(format string, args ...interface{})
+	// Warnf logs a problem the plugin recovered from
+	Warnf(format string, args ...interface{})
+	// Infof logs a notable event, like a listener being started
+	Infof(format string, args ...interface{})
+	// Debugf logs details which are only useful to debug the plugin
+	Debugf(format string, args ...interface{})
+}
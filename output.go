@@ -29,3 +29,18 @@ type ServiceOutput interface {
 	// Stop the "service" that will provide an Output
 	Stop()
 }
+
+// RejectedError is returned by Write when the output rejected metrics
+// permanently, like for a field type conflict, so that writing them again
+// would fail the same way. The rejected metrics are not retried.
+type RejectedError struct {
+	// Metrics rejected by the output, all the metrics of the write if nil.
+	// The other metrics were written.
+	Metrics []Metric
+	// Reason of the rejection
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "metrics rejected: " + e.Reason
+}
@@ -0,0 +1,103 @@
+package celery
+
+import (
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// amqpBroker talks to an AMQP broker, e.g. RabbitMQ, the same way as the
+// kombu amqp transport.
+type amqpBroker struct {
+	conn       *amqp.Connection
+	channel    *amqp.Channel
+	deliveries <-chan amqp.Delivery
+}
+
+func newAMQPBroker(u *url.URL, timeout time.Duration) (*amqpBroker, error) {
+	conn, err := amqp.DialConfig(u.String(), amqp.Config{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, timeout)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &amqpBroker{conn: conn}, nil
+}
+
+func (a *amqpBroker) queueLength(queue string) (int64, int64, error) {
+	// The broker closes the channel of the inspection of a missing queue
+	channel, err := a.conn.Channel()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer channel.Close()
+	q, err := channel.QueueInspect(queue)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(q.Messages), int64(q.Consumers), nil
+}
+
+func (a *amqpBroker) openMailbox(oid string) error {
+	channel, err := a.conn.Channel()
+	if err != nil {
+		return err
+	}
+	a.channel = channel
+
+	// The exchanges are declared as the kombu Mailbox does, the reply queue
+	// is deleted along with the channel
+	if err := channel.ExchangeDeclare(pidboxExchange, "fanout",
+		false, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := channel.ExchangeDeclare(replyExchange, "direct",
+		false, false, false, false, nil); err != nil {
+		return err
+	}
+	queue, err := channel.QueueDeclare(oid+"."+replyExchange,
+		false, true, true, false, nil)
+	if err != nil {
+		return err
+	}
+	if err := channel.QueueBind(queue.Name, oid, replyExchange,
+		false, nil); err != nil {
+		return err
+	}
+	a.deliveries, err = channel.Consume(queue.Name, "", true, true,
+		false, false, nil)
+	return err
+}
+
+func (a *amqpBroker) publish(body []byte, headers map[string]interface{}) error {
+	return a.channel.Publish(pidboxExchange, "", false, false, amqp.Publishing{
+		Headers:         amqp.Table(headers),
+		ContentType:     "application/json",
+		ContentEncoding: "utf-8",
+		DeliveryMode:    amqp.Transient,
+		Body:            body,
+	})
+}
+
+func (a *amqpBroker) receive(deadline time.Time) ([]byte, string, error) {
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+	select {
+	case d, ok := <-a.deliveries:
+		if !ok {
+			return nil, "", amqp.ErrClosed
+		}
+		ticket, _ := d.Headers["ticket"].(string)
+		return d.Body, ticket, nil
+	case <-timer.C:
+		return nil, "", nil
+	}
+}
+
+func (a *amqpBroker) close() error {
+	return a.conn.Close()
+}
@@ -0,0 +1,131 @@
+package celery
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Names of the exchanges of the "celery" mailbox, through which workers
+// receive the remote control commands and send their replies.
+const (
+	pidboxExchange = "celery.pidbox"
+	replyExchange  = "reply.celery.pidbox"
+)
+
+// broker is a connection to the broker of a Celery app.
+type broker interface {
+	// queueLength returns the number of messages waiting in queue, and the
+	// number of its consumers or -1 when the broker doesn't track them.
+	queueLength(queue string) (int64, int64, error)
+	// openMailbox declares the reply queue of the control commands sent
+	// with routing key oid.
+	openMailbox(oid string) error
+	// publish broadcasts the control command body to all workers.
+	publish(body []byte, headers map[string]interface{}) error
+	// receive returns the next reply to the control commands and the
+	// ticket it answers, or a nil body once deadline passed.
+	receive(deadline time.Time) ([]byte, string, error)
+	close() error
+}
+
+// newBroker connects to the broker at rawurl.
+func newBroker(rawurl string, timeout time.Duration) (broker, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse Celery broker url '%s': %s",
+			rawurl, err)
+	}
+	switch u.Scheme {
+	case "redis":
+		return newRedisBroker(u, timeout)
+	case "amqp", "amqps":
+		return newAMQPBroker(u, timeout)
+	default:
+		return nil, fmt.Errorf("Unsupported Celery broker url '%s', must "+
+			"start with redis://, amqp:// or amqps://", rawurl)
+	}
+}
+
+// inspect broadcasts the control commands to the workers, and returns the
+// replies received within timeout by command and worker name.
+func inspect(
+	b broker,
+	commands []string,
+	timeout time.Duration,
+) (map[string]map[string]json.RawMessage, error) {
+	oid := newUUID()
+	if err := b.openMailbox(oid); err != nil {
+		return nil, err
+	}
+
+	// All commands are sent at once and share the timeout, the replies are
+	// told apart by their ticket
+	deadline := time.Now().Add(timeout)
+	tickets := make(map[string]string)
+	for _, command := range commands {
+		ticket := newUUID()
+		body, err := json.Marshal(map[string]interface{}{
+			"method":      command,
+			"arguments":   map[string]interface{}{},
+			"destination": nil,
+			"pattern":     nil,
+			"matcher":     nil,
+			"ticket":      ticket,
+			"reply_to": map[string]string{
+				"exchange":    replyExchange,
+				"routing_key": oid,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		headers := map[string]interface{}{
+			"clock":   int64(1),
+			"expires": float64(deadline.UnixNano()) / 1e9,
+		}
+		if err := b.publish(body, headers); err != nil {
+			return nil, err
+		}
+		tickets[ticket] = command
+	}
+
+	replies := make(map[string]map[string]json.RawMessage)
+	for _, command := range commands {
+		replies[command] = make(map[string]json.RawMessage)
+	}
+	for {
+		body, ticket, err := b.receive(deadline)
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			return replies, nil
+		}
+		command, ok := tickets[ticket]
+		if !ok {
+			continue
+		}
+		// A reply maps the name of the worker to its result
+		var reply map[string]json.RawMessage
+		if err := json.Unmarshal(body, &reply); err != nil {
+			return nil, fmt.Errorf("Could not decode the Celery %s reply: %s",
+				command, err)
+		}
+		for worker, result := range reply {
+			replies[command][worker] = result
+		}
+	}
+}
+
+// newUUID returns a random version 4 UUID, as kombu uses for the mailbox
+// oids and tickets.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,264 @@
+package celery
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is a Redis server holding lists, with workers answering the
+// control commands published to the pidbox channel of database 0.
+type fakeRedis struct {
+	sync.Mutex
+	listener net.Listener
+	lists    map[string][]string
+	bindings map[string]bool
+	channels []string
+	// Replies of the workers by command
+	workers map[string]map[string]interface{}
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	r := &fakeRedis{
+		listener: l,
+		lists:    make(map[string][]string),
+		bindings: make(map[string]bool),
+		workers:  make(map[string]map[string]interface{}),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		r.Lock()
+		reply := r.handle(args)
+		r.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (r *fakeRedis) handle(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "SELECT":
+		return "+OK\r\n"
+	case "LLEN":
+		return fmt.Sprintf(":%d\r\n", len(r.lists[args[1]]))
+	case "SADD":
+		r.bindings[args[1]+"|"+args[2]] = true
+		return ":1\r\n"
+	case "SREM":
+		delete(r.bindings, args[1]+"|"+args[2])
+		return ":1\r\n"
+	case "DEL":
+		delete(r.lists, args[1])
+		return ":1\r\n"
+	case "PUBLISH":
+		r.channels = append(r.channels, args[1])
+		r.reply(args[2])
+		return ":1\r\n"
+	case "BRPOP":
+		// Nothing arrives later, an empty list times out right away
+		list := r.lists[args[1]]
+		if len(list) == 0 {
+			return "*-1\r\n"
+		}
+		message := list[len(list)-1]
+		r.lists[args[1]] = list[:len(list)-1]
+		return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+			len(args[1]), args[1], len(message), message)
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// reply answers a control command from every worker, through the reply
+// queue bound to the routing key of its reply_to.
+func (r *fakeRedis) reply(message string) {
+	var envelope struct {
+		Body string `json:"body"`
+	}
+	json.Unmarshal([]byte(message), &envelope)
+	body, _ := base64.StdEncoding.DecodeString(envelope.Body)
+	var command struct {
+		Method  string `json:"method"`
+		Ticket  string `json:"ticket"`
+		ReplyTo struct {
+			Exchange   string `json:"exchange"`
+			RoutingKey string `json:"routing_key"`
+		} `json:"reply_to"`
+	}
+	json.Unmarshal(body, &command)
+
+	queue := command.ReplyTo.RoutingKey + "." + command.ReplyTo.Exchange
+	binding := "_kombu.binding." + command.ReplyTo.Exchange + "|" +
+		command.ReplyTo.RoutingKey + redisSep + redisSep + queue
+	if !r.bindings[binding] {
+		return
+	}
+	for worker, result := range r.workers[command.Method] {
+		r.push(queue, map[string]interface{}{worker: result}, command.Ticket)
+	}
+	// Replies to the commands of other clients are ignored
+	r.push(queue, map[string]interface{}{"other@host": []int{}}, "other")
+}
+
+func (r *fakeRedis) push(queue string, reply interface{}, ticket string) {
+	body, _ := json.Marshal(reply)
+	message, _ := json.Marshal(map[string]interface{}{
+		"body":    base64.StdEncoding.EncodeToString(body),
+		"headers": map[string]string{"ticket": ticket},
+		"properties": map[string]string{
+			"body_encoding": "base64",
+		},
+	})
+	r.lists[queue] = append([]string{string(message)}, r.lists[queue]...)
+}
+
+func TestGatherRedis(t *testing.T) {
+	r := newFakeRedis(t)
+	defer r.listener.Close()
+	r.lists["celery"] = []string{"a", "b", "c"}
+	r.lists["celery"+redisSep+"9"] = []string{"d", "e"}
+	r.workers["active"] = map[string]interface{}{
+		"w1@host": []map[string]string{{"id": "1"}},
+		"w2@host": []map[string]string{},
+	}
+	r.workers["reserved"] = map[string]interface{}{
+		"w1@host": []map[string]string{{"id": "2"}, {"id": "3"}},
+	}
+	r.workers["stats"] = map[string]interface{}{
+		"w1@host": map[string]interface{}{
+			"total":  map[string]int{"app.a": 5, "app.b": 2},
+			"pool":   map[string]int{"max-concurrency": 4},
+			"uptime": 100,
+		},
+	}
+
+	c := &Celery{
+		Broker:         "redis://" + r.listener.Addr().String() + "/0",
+		Queues:         []string{"celery", "empty"},
+		Inspect:        true,
+		InspectTimeout: internal.Duration{Duration: time.Second},
+		Timeout:        internal.Duration{Duration: time.Second},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, c.Gather(&acc))
+
+	source := r.listener.Addr().String()
+	acc.AssertContainsTaggedFields(t, "celery_queues",
+		map[string]interface{}{"messages": int64(5)},
+		map[string]string{"source": source, "queue": "celery"})
+	acc.AssertContainsTaggedFields(t, "celery_queues",
+		map[string]interface{}{"messages": int64(0)},
+		map[string]string{"source": source, "queue": "empty"})
+	acc.AssertContainsTaggedFields(t, "celery_workers",
+		map[string]interface{}{
+			"active":      int64(1),
+			"reserved":    int64(2),
+			"processed":   int64(7),
+			"concurrency": int64(4),
+			"uptime":      int64(100),
+		},
+		map[string]string{"source": source, "worker": "w1@host"})
+	acc.AssertContainsTaggedFields(t, "celery_workers",
+		map[string]interface{}{"active": int64(0)},
+		map[string]string{"source": source, "worker": "w2@host"})
+	assert.Equal(t, 4, len(acc.Metrics))
+
+	r.Lock()
+	assert.Equal(t, []string{"/0.celery.pidbox", "/0.celery.pidbox",
+		"/0.celery.pidbox"}, r.channels)
+	// The reply queue is unbound and deleted once the gather is done
+	assert.Empty(t, r.bindings)
+	for name := range r.lists {
+		assert.False(t, strings.HasSuffix(name, replyExchange), name)
+	}
+	r.workers["stats"]["w1@host"].(map[string]interface{})["total"] =
+		map[string]int{"app.a": 15, "app.b": 2}
+	r.Unlock()
+
+	// The processed_rate is computed from the second gather on
+	c.lastGather = c.lastGather.Add(-10 * time.Second)
+	acc.Metrics = nil
+	require.NoError(t, c.Gather(&acc))
+	for _, m := range acc.Metrics {
+		if m.Measurement == "celery_workers" && m.Tags["worker"] == "w1@host" {
+			assert.InDelta(t, 1.0, m.Fields["processed_rate"], 0.01)
+			return
+		}
+	}
+	t.Fatal("no celery_workers point for w1@host")
+}
+
+func TestGatherRedisNoInspect(t *testing.T) {
+	r := newFakeRedis(t)
+	defer r.listener.Close()
+
+	c := &Celery{
+		Broker:  "redis://" + r.listener.Addr().String(),
+		Queues:  []string{"celery"},
+		Timeout: internal.Duration{Duration: time.Second},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, c.Gather(&acc))
+	assert.Equal(t, 1, len(acc.Metrics))
+	assert.Empty(t, r.channels)
+}
+
+func TestBrokerURL(t *testing.T) {
+	_, err := newBroker("sqs://localhost", time.Second)
+	assert.Error(t, err)
+	_, err = newBroker("redis://127.0.0.1:1", time.Second)
+	assert.Error(t, err)
+}
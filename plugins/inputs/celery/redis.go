@@ -0,0 +1,245 @@
+package celery
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Separator of the fields of the kombu binding keys and of the priority
+// queue names of the Redis transport.
+const redisSep = "\x06\x16"
+
+// Priority steps of the Redis transport, every step but 0 is stored in its
+// own list named after the queue.
+var redisPriorities = []int{0, 3, 6, 9}
+
+// redisBroker talks to the Redis transport of kombu, see
+// kombu/transport/redis.py.
+type redisBroker struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	db      string
+
+	binding    string
+	member     string
+	replyQueue string
+}
+
+func newRedisBroker(u *url.URL, timeout time.Duration) (*redisBroker, error) {
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = host + ":6379"
+	}
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &redisBroker{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: timeout,
+		db:      strings.TrimPrefix(u.Path, "/"),
+	}
+	if r.db == "" {
+		r.db = "0"
+	}
+	if u.User != nil {
+		args := []string{"AUTH"}
+		if password, ok := u.User.Password(); ok {
+			if name := u.User.Username(); name != "" {
+				args = append(args, name)
+			}
+			args = append(args, password)
+		} else {
+			args = append(args, u.User.Username())
+		}
+		if _, err := r.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if _, err := r.do("SELECT", r.db); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *redisBroker) queueLength(queue string) (int64, int64, error) {
+	var length int64
+	for _, priority := range redisPriorities {
+		name := queue
+		if priority > 0 {
+			name = queue + redisSep + strconv.Itoa(priority)
+		}
+		reply, err := r.do("LLEN", name)
+		if err != nil {
+			return 0, 0, err
+		}
+		n, ok := reply.(int64)
+		if !ok {
+			return 0, 0, fmt.Errorf("Unexpected LLEN reply %v", reply)
+		}
+		length += n
+	}
+	return length, -1, nil
+}
+
+func (r *redisBroker) openMailbox(oid string) error {
+	// The replies are routed by the workers to the queues bound to the
+	// reply exchange with the oid as routing key
+	r.binding = "_kombu.binding." + replyExchange
+	r.replyQueue = oid + "." + replyExchange
+	r.member = oid + redisSep + redisSep + r.replyQueue
+	_, err := r.do("SADD", r.binding, r.member)
+	return err
+}
+
+func (r *redisBroker) publish(body []byte, headers map[string]interface{}) error {
+	message, err := json.Marshal(map[string]interface{}{
+		"body":             base64.StdEncoding.EncodeToString(body),
+		"content-encoding": "utf-8",
+		"content-type":     "application/json",
+		"headers":          headers,
+		"properties": map[string]interface{}{
+			"body_encoding": "base64",
+			"delivery_info": map[string]string{
+				"exchange":    pidboxExchange,
+				"routing_key": "",
+			},
+			"delivery_mode": 2,
+			"delivery_tag":  newUUID(),
+			"priority":      0,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// Fanout exchanges are Redis channels prefixed with the database
+	_, err = r.do("PUBLISH", "/"+r.db+"."+pidboxExchange, string(message))
+	return err
+}
+
+func (r *redisBroker) receive(deadline time.Time) ([]byte, string, error) {
+	remaining := deadline.Sub(time.Now())
+	if remaining <= 0 {
+		return nil, "", nil
+	}
+	// BRPOP takes whole seconds before Redis 6
+	seconds := int(math.Ceil(remaining.Seconds()))
+	reply, err := r.doTimeout(time.Duration(seconds)*time.Second+r.timeout,
+		"BRPOP", r.replyQueue, strconv.Itoa(seconds))
+	if err != nil {
+		return nil, "", err
+	}
+	if reply == nil {
+		return nil, "", nil
+	}
+	// BRPOP replies with the name of the list and the popped message
+	popped, ok := reply.([]interface{})
+	if !ok || len(popped) != 2 {
+		return nil, "", fmt.Errorf("Unexpected BRPOP reply %v", reply)
+	}
+	message, _ := popped[1].(string)
+
+	var envelope struct {
+		Body       string                 `json:"body"`
+		Headers    map[string]interface{} `json:"headers"`
+		Properties struct {
+			BodyEncoding string `json:"body_encoding"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(message), &envelope); err != nil {
+		return nil, "", fmt.Errorf("Could not decode the Celery reply: %s", err)
+	}
+	body := []byte(envelope.Body)
+	if envelope.Properties.BodyEncoding == "base64" {
+		if body, err = base64.StdEncoding.DecodeString(envelope.Body); err != nil {
+			return nil, "", fmt.Errorf("Could not decode the Celery reply: %s", err)
+		}
+	}
+	ticket, _ := envelope.Headers["ticket"].(string)
+	return body, ticket, nil
+}
+
+func (r *redisBroker) close() error {
+	if r.replyQueue != "" {
+		r.do("SREM", r.binding, r.member)
+		r.do("DEL", r.replyQueue)
+	}
+	return r.conn.Close()
+}
+
+// do sends a command and returns its reply: a string, an int64, a slice
+// of replies, or nil.
+func (r *redisBroker) do(args ...string) (interface{}, error) {
+	return r.doTimeout(r.timeout, args...)
+}
+
+func (r *redisBroker) doTimeout(timeout time.Duration, args ...string) (interface{}, error) {
+	r.conn.SetDeadline(time.Now().Add(timeout))
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.conn, command); err != nil {
+		return nil, err
+	}
+	return r.readReply()
+}
+
+func (r *redisBroker) readReply() (interface{}, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("Empty Redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("Redis error: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = r.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	default:
+		return nil, fmt.Errorf("Unexpected Redis reply %q", line)
+	}
+}
@@ -0,0 +1,352 @@
+package ceph_mgr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// CephMgr reads the health, OSDs, placement groups and pools of a Ceph
+// cluster from the prometheus module of its active manager.
+type CephMgr struct {
+	URLs    []string `toml:"urls"`
+	Cluster string
+	Timeout internal.Duration
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	client *http.Client
+
+	mu sync.Mutex
+	// I/O counters of the pools at the last gather, by pool ID
+	previous map[string]ioCounters
+}
+
+// ioCounters are the read and write operations and bytes of a pool, at a
+// time.
+type ioCounters struct {
+	time   time.Time
+	values [4]float64
+}
+
+var sampleConfig = `
+  ## Urls of the prometheus module of the managers of the cluster, the
+  ## metrics are read from the active one
+  urls = ["http://localhost:9283/metrics"]
+
+  ## Name of the cluster, as the cluster tag
+  # cluster = "ceph"
+
+  ## Timeout of the requests
+  # timeout = "5s"
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+func (c *CephMgr) SampleConfig() string {
+	return sampleConfig
+}
+
+func (c *CephMgr) Description() string {
+	return "Read the health, OSDs, placement groups and pools of a Ceph cluster from its manager"
+}
+
+// Names of the health status values.
+var healthNames = []string{"HEALTH_OK", "HEALTH_WARN", "HEALTH_ERR"}
+
+// Cluster gauges, by the field they are reported as.
+var clusterGauges = map[string]string{
+	"ceph_cluster_total_bytes":          "total_bytes",
+	"ceph_cluster_total_used_bytes":     "used_bytes",
+	"ceph_cluster_total_used_raw_bytes": "used_raw_bytes",
+	"ceph_cluster_total_objects":        "objects",
+}
+
+// Pool gauges, by the field they are reported as.
+var poolGauges = map[string]string{
+	"ceph_pool_stored":       "stored_bytes",
+	"ceph_pool_bytes_used":   "used_bytes",
+	"ceph_pool_max_avail":    "max_avail_bytes",
+	"ceph_pool_objects":      "objects",
+	"ceph_pool_percent_used": "percent_used",
+}
+
+// Pool I/O counters, in the order of ioCounters, and the fields of their
+// counts and rates.
+var poolCounters = []struct {
+	family, field, rate string
+}{
+	{"ceph_pool_rd", "read_ops", "read_op_per_sec"},
+	{"ceph_pool_wr", "write_ops", "write_op_per_sec"},
+	{"ceph_pool_rd_bytes", "read_bytes", "read_bytes_sec"},
+	{"ceph_pool_wr_bytes", "write_bytes", "write_bytes_sec"},
+}
+
+func (c *CephMgr) Gather(acc telegraf.Accumulator) error {
+	if c.client == nil {
+		tlsCfg, err := internal.GetTLSConfig(
+			c.SSLCert, c.SSLKey, c.SSLCA, c.InsecureSkipVerify)
+		if err != nil {
+			return err
+		}
+		timeout := c.Timeout.Duration
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		c.client = &http.Client{
+			Transport: &http.Transport{
+				ResponseHeaderTimeout: timeout,
+				TLSClientConfig:       tlsCfg,
+			},
+			Timeout: timeout,
+		}
+	}
+
+	// The standby managers report no metrics, keep trying the next ones
+	// when one of them fails and return all errors as one giant error
+	var errorStrings []string
+	for _, u := range c.URLs {
+		families, err := c.request(u)
+		if err != nil {
+			errorStrings = append(errorStrings, err.Error())
+			continue
+		}
+		if _, ok := families["ceph_health_status"]; !ok {
+			continue
+		}
+		c.gatherFamilies(families, time.Now(), acc)
+		return nil
+	}
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return errors.New("no active manager")
+}
+
+func (c *CephMgr) request(u string) (map[string]*dto.MetricFamily, error) {
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP status %s", u, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading metrics from %s: %s", u, err)
+	}
+	return families, nil
+}
+
+// pool is a pool of the cluster and its fields.
+type pool struct {
+	name   string
+	fields map[string]interface{}
+	io     ioCounters
+	// I/O counters reported by the manager
+	ioCount int
+}
+
+func (c *CephMgr) gatherFamilies(families map[string]*dto.MetricFamily, now time.Time, acc telegraf.Accumulator) {
+	cluster := c.Cluster
+	if cluster == "" {
+		cluster = "ceph"
+	}
+	fields := make(map[string]interface{})
+	pools := make(map[string]*pool)
+	getPool := func(m *dto.Metric) *pool {
+		id := label(m, "pool_id")
+		if id == "" {
+			return nil
+		}
+		if pools[id] == nil {
+			pools[id] = &pool{fields: make(map[string]interface{}), io: ioCounters{time: now}}
+		}
+		return pools[id]
+	}
+
+	for name, family := range families {
+		switch {
+		case name == "ceph_health_status":
+			for _, m := range family.Metric {
+				status := int64(value(m))
+				fields["health_status"] = status
+				if status >= 0 && int(status) < len(healthNames) {
+					fields["health"] = healthNames[status]
+				}
+			}
+		case name == "ceph_osd_up" || name == "ceph_osd_in":
+			var n int64
+			for _, m := range family.Metric {
+				n += int64(value(m))
+			}
+			fields["osds"] = int64(len(family.Metric))
+			if name == "ceph_osd_up" {
+				fields["osds_up"] = n
+			} else {
+				fields["osds_in"] = n
+			}
+		case name == "ceph_mon_quorum_status":
+			var n int64
+			for _, m := range family.Metric {
+				n += int64(value(m))
+			}
+			fields["mons"] = int64(len(family.Metric))
+			fields["mons_quorum"] = n
+		case clusterGauges[name] != "":
+			for _, m := range family.Metric {
+				fields[clusterGauges[name]] = int64(value(m))
+			}
+		case name == "ceph_pool_metadata":
+			for _, m := range family.Metric {
+				if p := getPool(m); p != nil {
+					p.name = label(m, "name")
+				}
+			}
+		case poolGauges[name] != "":
+			for _, m := range family.Metric {
+				if p := getPool(m); p != nil {
+					if name == "ceph_pool_percent_used" {
+						p.fields[poolGauges[name]] = value(m)
+					} else {
+						p.fields[poolGauges[name]] = int64(value(m))
+					}
+				}
+			}
+		case strings.HasPrefix(name, "ceph_pg_") && family.GetType() == dto.MetricType_GAUGE:
+			// The states of the placement groups, of each pool since
+			// Nautilus and of the cluster before
+			field := "pgs_" + name[len("ceph_pg_"):]
+			if name == "ceph_pg_total" {
+				field = "pgs"
+			}
+			var n int64
+			for _, m := range family.Metric {
+				v := int64(value(m))
+				n += v
+				if p := getPool(m); p != nil {
+					p.fields[field] = v
+				}
+			}
+			fields[field] = n
+		}
+	}
+	for i, counter := range poolCounters {
+		family, ok := families[counter.family]
+		if !ok {
+			continue
+		}
+		for _, m := range family.Metric {
+			if p := getPool(m); p != nil {
+				p.io.values[i] = value(m)
+				p.fields[counter.field] = int64(value(m))
+				p.ioCount++
+			}
+		}
+	}
+
+	// The client I/O rates, since the last gather
+	c.mu.Lock()
+	previous := c.previous
+	c.previous = make(map[string]ioCounters)
+	for id, p := range pools {
+		if p.ioCount != len(poolCounters) {
+			continue
+		}
+		c.previous[id] = p.io
+		last, ok := previous[id]
+		elapsed := p.io.time.Sub(last.time).Seconds()
+		if !ok || elapsed <= 0 {
+			continue
+		}
+		for i, counter := range poolCounters {
+			// Reset when the pool was recreated or the manager restarted
+			if p.io.values[i] < last.values[i] {
+				continue
+			}
+			rate := (p.io.values[i] - last.values[i]) / elapsed
+			p.fields[counter.rate] = rate
+			sum, _ := fields[counter.rate].(float64)
+			fields[counter.rate] = sum + rate
+		}
+	}
+	c.mu.Unlock()
+
+	acc.AddFields("ceph_cluster", fields, map[string]string{"cluster": cluster}, now)
+
+	ids := make([]string, 0, len(pools))
+	for id := range pools {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := pools[id]
+		if len(p.fields) == 0 {
+			continue
+		}
+		tags := map[string]string{
+			"cluster": cluster,
+			"pool_id": id,
+		}
+		if p.name != "" {
+			tags["pool"] = p.name
+		}
+		acc.AddFields("ceph_pool", p.fields, tags, now)
+	}
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func value(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Untyped != nil:
+		return m.Untyped.GetValue()
+	}
+	return 0
+}
+
+func init() {
+	inputs.Add("ceph_mgr", func() telegraf.Input {
+		return &CephMgr{
+			Cluster: "ceph",
+			Timeout: internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package ceph_mgr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Metrics of the prometheus module of a Nautilus manager, with read and
+// write counters of %d and %d bytes for the rbd pool.
+const metricsFormat = `# HELP ceph_health_status Cluster health status
+# TYPE ceph_health_status untyped
+ceph_health_status 1.0
+# HELP ceph_mon_quorum_status Monitors in quorum
+# TYPE ceph_mon_quorum_status gauge
+ceph_mon_quorum_status{ceph_daemon="mon.a"} 1.0
+ceph_mon_quorum_status{ceph_daemon="mon.b"} 1.0
+ceph_mon_quorum_status{ceph_daemon="mon.c"} 0.0
+# HELP ceph_osd_up OSD status up
+# TYPE ceph_osd_up untyped
+ceph_osd_up{ceph_daemon="osd.0"} 1.0
+ceph_osd_up{ceph_daemon="osd.1"} 1.0
+ceph_osd_up{ceph_daemon="osd.2"} 0.0
+# HELP ceph_osd_in OSD status in
+# TYPE ceph_osd_in untyped
+ceph_osd_in{ceph_daemon="osd.0"} 1.0
+ceph_osd_in{ceph_daemon="osd.1"} 1.0
+ceph_osd_in{ceph_daemon="osd.2"} 1.0
+# HELP ceph_cluster_total_bytes DF total_bytes
+# TYPE ceph_cluster_total_bytes gauge
+ceph_cluster_total_bytes 3221225472000.0
+# HELP ceph_cluster_total_used_raw_bytes DF total_used_raw_bytes
+# TYPE ceph_cluster_total_used_raw_bytes gauge
+ceph_cluster_total_used_raw_bytes 1073741824000.0
+# HELP ceph_pool_metadata POOL Metadata
+# TYPE ceph_pool_metadata untyped
+ceph_pool_metadata{pool_id="1",name="rbd"} 1.0
+ceph_pool_metadata{pool_id="2",name="cephfs_data"} 1.0
+# HELP ceph_pool_stored DF pool stored
+# TYPE ceph_pool_stored gauge
+ceph_pool_stored{pool_id="1"} 357913941333.0
+ceph_pool_stored{pool_id="2"} 0.0
+# HELP ceph_pool_max_avail DF pool max_avail
+# TYPE ceph_pool_max_avail gauge
+ceph_pool_max_avail{pool_id="1"} 715827882666.0
+ceph_pool_max_avail{pool_id="2"} 715827882666.0
+# HELP ceph_pool_objects DF pool objects
+# TYPE ceph_pool_objects gauge
+ceph_pool_objects{pool_id="1"} 85432.0
+ceph_pool_objects{pool_id="2"} 0.0
+# HELP ceph_pool_percent_used DF pool percent_used
+# TYPE ceph_pool_percent_used gauge
+ceph_pool_percent_used{pool_id="1"} 0.3333
+ceph_pool_percent_used{pool_id="2"} 0.0
+# HELP ceph_pool_rd DF pool rd
+# TYPE ceph_pool_rd counter
+ceph_pool_rd{pool_id="1"} 1000.0
+ceph_pool_rd{pool_id="2"} 0.0
+# HELP ceph_pool_wr DF pool wr
+# TYPE ceph_pool_wr counter
+ceph_pool_wr{pool_id="1"} 2000.0
+ceph_pool_wr{pool_id="2"} 0.0
+# HELP ceph_pool_rd_bytes DF pool rd_bytes
+# TYPE ceph_pool_rd_bytes counter
+ceph_pool_rd_bytes{pool_id="1"} %d.0
+ceph_pool_rd_bytes{pool_id="2"} 0.0
+# HELP ceph_pool_wr_bytes DF pool wr_bytes
+# TYPE ceph_pool_wr_bytes counter
+ceph_pool_wr_bytes{pool_id="1"} %d.0
+ceph_pool_wr_bytes{pool_id="2"} 0.0
+# HELP ceph_pg_active PG active per pool
+# TYPE ceph_pg_active gauge
+ceph_pg_active{pool_id="1"} 128.0
+ceph_pg_active{pool_id="2"} 32.0
+# HELP ceph_pg_degraded PG degraded per pool
+# TYPE ceph_pg_degraded gauge
+ceph_pg_degraded{pool_id="1"} 12.0
+ceph_pg_degraded{pool_id="2"} 0.0
+# HELP ceph_pg_total PG Total Count per Pool
+# TYPE ceph_pg_total gauge
+ceph_pg_total{pool_id="1"} 128.0
+ceph_pg_total{pool_id="2"} 32.0
+`
+
+func TestCephMgr(t *testing.T) {
+	metrics := fmt.Sprintf(metricsFormat, 4096000, 8192000)
+	standby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The standby managers answer without metrics
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer standby.Close()
+	active := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/metrics", r.URL.Path)
+		fmt.Fprint(w, metrics)
+	}))
+	defer active.Close()
+
+	c := &CephMgr{
+		URLs:    []string{standby.URL + "/metrics", active.URL + "/metrics"},
+		Cluster: "prod",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, c.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "ceph_cluster",
+		map[string]interface{}{
+			"health_status":  int64(1),
+			"health":         "HEALTH_WARN",
+			"mons":           int64(3),
+			"mons_quorum":    int64(2),
+			"osds":           int64(3),
+			"osds_up":        int64(2),
+			"osds_in":        int64(3),
+			"total_bytes":    int64(3221225472000),
+			"used_raw_bytes": int64(1073741824000),
+			"pgs":            int64(160),
+			"pgs_active":     int64(160),
+			"pgs_degraded":   int64(12),
+		},
+		map[string]string{"cluster": "prod"})
+	acc.AssertContainsTaggedFields(t, "ceph_pool",
+		map[string]interface{}{
+			"stored_bytes":    int64(357913941333),
+			"max_avail_bytes": int64(715827882666),
+			"objects":         int64(85432),
+			"percent_used":    0.3333,
+			"read_ops":        int64(1000),
+			"write_ops":       int64(2000),
+			"read_bytes":      int64(4096000),
+			"write_bytes":     int64(8192000),
+			"pgs":             int64(128),
+			"pgs_active":      int64(128),
+			"pgs_degraded":    int64(12),
+		},
+		map[string]string{"cluster": "prod", "pool": "rbd", "pool_id": "1"})
+	assert.Equal(t, 3, len(acc.Metrics))
+
+	// The client I/O rates since the last gather, 10 seconds earlier
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(
+		strings.Replace(strings.Replace(fmt.Sprintf(metricsFormat, 4505600, 8192000),
+			`ceph_pool_rd{pool_id="1"} 1000.0`, `ceph_pool_rd{pool_id="1"} 1100.0`, 1),
+			`ceph_pool_wr{pool_id="1"} 2000.0`, `ceph_pool_wr{pool_id="1"} 2500.0`, 1)))
+	require.NoError(t, err)
+	acc.Metrics = nil
+	c.mu.Lock()
+	for id, counters := range c.previous {
+		counters.time = counters.time.Add(-10 * time.Second)
+		c.previous[id] = counters
+	}
+	c.mu.Unlock()
+	c.gatherFamilies(families, time.Now(), &acc)
+
+	for _, m := range acc.Metrics {
+		switch m.Tags["pool"] {
+		case "rbd":
+			assert.InDelta(t, 10.0, m.Fields["read_op_per_sec"], 0.1)
+			assert.InDelta(t, 50.0, m.Fields["write_op_per_sec"], 0.1)
+			assert.InDelta(t, 40960.0, m.Fields["read_bytes_sec"], 10)
+			assert.InDelta(t, 0.0, m.Fields["write_bytes_sec"], 0.1)
+		case "cephfs_data":
+			assert.Equal(t, 0.0, m.Fields["read_op_per_sec"])
+		default:
+			assert.Equal(t, "ceph_cluster", m.Measurement)
+			assert.InDelta(t, 10.0, m.Fields["read_op_per_sec"], 0.1)
+			assert.InDelta(t, 40960.0, m.Fields["read_bytes_sec"], 10)
+		}
+	}
+}
+
+func TestCephMgrNoActiveManager(t *testing.T) {
+	standby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer standby.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	c := &CephMgr{URLs: []string{standby.URL}}
+	var acc testutil.Accumulator
+	err := c.Gather(&acc)
+	require.Error(t, err)
+	assert.Equal(t, "no active manager", err.Error())
+
+	c = &CephMgr{URLs: []string{down.URL, standby.URL}}
+	err = c.Gather(&acc)
+	require.Error(t, err)
+	assert.Equal(t, down.URL+" returned HTTP status 503 Service Unavailable", err.Error())
+	assert.Empty(t, acc.Metrics)
+}
@@ -0,0 +1,274 @@
+package docker_events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+const sampleConfig = `
+  ## Docker Endpoint
+  ##   To use TCP, set endpoint = "tcp://[ip]:[port]"
+  ##   To use environment variables (ie, docker-machine), set endpoint = "ENV"
+  endpoint = "unix:///var/run/docker.sock"
+  ## Container events to report, see the docker events documentation for
+  ## the other events, e.g. "kill", "pause", "restart" or "destroy"
+  events = ["start", "stop", "die", "oom"]
+  ## Only report the events of these containers, report all if empty
+  container_names = []
+
+  ## Delay before reconnecting once the events stream broke. The events
+  ## missed in between are read on reconnection.
+  # reconnect_delay = "5s"
+`
+
+type DockerEvents struct {
+	Endpoint       string
+	Events         []string
+	ContainerNames []string
+	ReconnectDelay internal.Duration
+
+	client  *http.Client
+	baseURL string
+
+	acc    telegraf.Accumulator
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// Time of the last event read, the events stream resumes after it
+	last int64
+}
+
+// event is an event of the docker events stream, only container events
+// are requested.
+type event struct {
+	Action   string `json:"Action"`
+	Status   string `json:"status"`
+	ID       string `json:"id"`
+	From     string `json:"from"`
+	Time     int64  `json:"time"`
+	TimeNano int64  `json:"timeNano"`
+	Actor    struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+func NewDockerEvents() *DockerEvents {
+	return &DockerEvents{
+		Endpoint:       "unix:///var/run/docker.sock",
+		Events:         []string{"start", "stop", "die", "oom"},
+		ReconnectDelay: internal.Duration{Duration: 5 * time.Second},
+	}
+}
+
+func (d *DockerEvents) SampleConfig() string {
+	return sampleConfig
+}
+
+func (d *DockerEvents) Description() string {
+	return "Report the container lifecycle events of the docker events stream"
+}
+
+func (d *DockerEvents) Gather(acc telegraf.Accumulator) error {
+	return nil
+}
+
+func (d *DockerEvents) Start(acc telegraf.Accumulator) error {
+	client, baseURL, err := newClient(d.Endpoint)
+	if err != nil {
+		return fmt.Errorf("docker_events: %s", err)
+	}
+	d.client = client
+	d.baseURL = baseURL
+	d.acc = acc
+	if d.last == 0 {
+		d.last = time.Now().UnixNano()
+	}
+
+	// The docker daemon may not be running yet, the stream is connected
+	// and reconnected in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.wg.Add(1)
+	go d.run(ctx)
+	return nil
+}
+
+func (d *DockerEvents) Stop() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// newClient returns the client of the docker endpoint and the base url of
+// its requests.
+func newClient(endpoint string) (*http.Client, string, error) {
+	if endpoint == "ENV" {
+		endpoint = os.Getenv("DOCKER_HOST")
+	}
+	if endpoint == "" {
+		endpoint = "unix:///var/run/docker.sock"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid endpoint %q: %s", endpoint, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		transport := &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", path)
+			},
+		}
+		return &http.Client{Transport: transport}, "http://docker", nil
+	case "tcp", "http":
+		return &http.Client{}, "http://" + u.Host, nil
+	case "https":
+		return &http.Client{}, "https://" + u.Host, nil
+	default:
+		return nil, "", fmt.Errorf("invalid endpoint %q, must start with "+
+			"unix://, tcp://, http:// or https://", endpoint)
+	}
+}
+
+// run reads the events stream until ctx is cancelled, reconnecting after
+// ReconnectDelay whenever the stream breaks.
+func (d *DockerEvents) run(ctx context.Context) {
+	defer d.wg.Done()
+	for {
+		err := d.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("docker_events: %s, reconnecting in %s\n",
+			err, d.ReconnectDelay.Duration)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.ReconnectDelay.Duration):
+		}
+	}
+}
+
+// stream reads the container events since the last one read, until the
+// stream breaks.
+func (d *DockerEvents) stream(ctx context.Context) error {
+	filters, err := json.Marshal(map[string][]string{
+		"type":  {"container"},
+		"event": d.Events,
+	})
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("filters", string(filters))
+	query.Set("since", fmt.Sprintf("%d.%09d", d.last/1e9, d.last%1e9))
+
+	req, err := http.NewRequest("GET", d.baseURL+"/events?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error connecting to the events stream: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the events stream returned HTTP status %s",
+			resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var e event
+		if err := decoder.Decode(&e); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("the events stream was closed")
+			}
+			return fmt.Errorf("error reading the events stream: %s", err)
+		}
+		if e.TimeNano == 0 {
+			e.TimeNano = e.Time * 1e9
+		}
+		// The events of the time the stream resumes at are sent again
+		if e.TimeNano <= d.last {
+			continue
+		}
+		d.last = e.TimeNano
+		d.add(e)
+	}
+}
+
+// add reports e unless it is filtered out.
+func (d *DockerEvents) add(e event) {
+	// Daemons before API 1.22 only send the status, id, from and time
+	// fields
+	action := e.Action
+	if action == "" {
+		action = e.Status
+	}
+	id := e.Actor.ID
+	if id == "" {
+		id = e.ID
+	}
+	image := e.Actor.Attributes["image"]
+	if image == "" {
+		image = e.From
+	}
+	name := e.Actor.Attributes["name"]
+
+	if !contains(d.Events, action) {
+		return
+	}
+	if len(d.ContainerNames) > 0 && !contains(d.ContainerNames, name) {
+		return
+	}
+
+	tags := map[string]string{
+		"event":           action,
+		"container_image": image,
+	}
+	if name != "" {
+		tags["container_name"] = name
+	}
+	fields := map[string]interface{}{
+		"container_id": id,
+	}
+	if code, err := strconv.ParseInt(e.Actor.Attributes["exitCode"], 10, 64); err == nil {
+		fields["exit_code"] = code
+	}
+	if signal := e.Actor.Attributes["signal"]; signal != "" {
+		fields["signal"] = signal
+	}
+	d.acc.AddFields("docker_events", fields, tags, time.Unix(0, e.TimeNano))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	inputs.Add("docker_events", func() telegraf.Input {
+		return NewDockerEvents()
+	})
+}
@@ -0,0 +1,207 @@
+package docker_events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	startEvent = `{"status":"start","id":"4d3c","from":"nginx:1.9",` +
+		`"Type":"container","Action":"start","Actor":{"ID":"4d3c",` +
+		`"Attributes":{"image":"nginx:1.9","name":"web"}},` +
+		`"time":1461943101,"timeNano":1461943101000000001}`
+	dieEvent = `{"status":"die","id":"4d3c","from":"nginx:1.9",` +
+		`"Type":"container","Action":"die","Actor":{"ID":"4d3c",` +
+		`"Attributes":{"exitCode":"137","image":"nginx:1.9","name":"web"}},` +
+		`"time":1461943102,"timeNano":1461943102000000002}`
+	killEvent = `{"status":"kill","id":"4d3c","from":"nginx:1.9",` +
+		`"Type":"container","Action":"kill","Actor":{"ID":"4d3c",` +
+		`"Attributes":{"image":"nginx:1.9","name":"web","signal":"9"}},` +
+		`"time":1461943102,"timeNano":1461943102000000001}`
+	oldEvent   = `{"status":"oom","id":"9f2a","from":"redis","time":1461943103}`
+	otherEvent = `{"status":"start","id":"77aa","from":"busybox",` +
+		`"Type":"container","Action":"start","Actor":{"ID":"77aa",` +
+		`"Attributes":{"image":"busybox","name":"job"}},` +
+		`"time":1461943104,"timeNano":1461943104000000000}`
+)
+
+// eventsServer serves a batch of events on each connection to /events,
+// recording the query of every connection.
+type eventsServer struct {
+	sync.Mutex
+	batches [][]string
+	queries []map[string]string
+}
+
+func (s *eventsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/events" {
+		http.NotFound(w, r)
+		return
+	}
+	s.Lock()
+	s.queries = append(s.queries, map[string]string{
+		"filters": r.URL.Query().Get("filters"),
+		"since":   r.URL.Query().Get("since"),
+	})
+	var batch []string
+	if len(s.batches) > 0 {
+		batch, s.batches = s.batches[0], s.batches[1:]
+	}
+	s.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	for _, e := range batch {
+		fmt.Fprintln(w, e)
+	}
+	w.(http.Flusher).Flush()
+	// The last batch is kept open, the others break the stream
+	if len(batch) > 0 && s.remaining() == 0 {
+		<-r.Context().Done()
+	}
+}
+
+func (s *eventsServer) remaining() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.batches)
+}
+
+func waitMetrics(t *testing.T, acc *testutil.Accumulator, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		acc.Lock()
+		count := len(acc.Metrics)
+		acc.Unlock()
+		if count >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d metrics", n)
+}
+
+func TestDockerEvents(t *testing.T) {
+	server := &eventsServer{batches: [][]string{
+		{startEvent, killEvent},
+		// The stream resumes at the time of the last event read, which
+		// is sent again
+		{killEvent, dieEvent, oldEvent, otherEvent},
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	d := NewDockerEvents()
+	d.Endpoint = ts.URL
+	d.Events = []string{"start", "die", "kill", "oom"}
+	d.ReconnectDelay = internal.Duration{Duration: 10 * time.Millisecond}
+	d.last = 1461943100000000000
+
+	var acc testutil.Accumulator
+	require.NoError(t, d.Start(&acc))
+	waitMetrics(t, &acc, 5)
+	d.Stop()
+
+	acc.AssertContainsTaggedFields(t, "docker_events",
+		map[string]interface{}{"container_id": "4d3c"},
+		map[string]string{
+			"event":           "start",
+			"container_image": "nginx:1.9",
+			"container_name":  "web",
+		})
+	acc.AssertContainsTaggedFields(t, "docker_events",
+		map[string]interface{}{"container_id": "4d3c", "signal": "9"},
+		map[string]string{
+			"event":           "kill",
+			"container_image": "nginx:1.9",
+			"container_name":  "web",
+		})
+	acc.AssertContainsTaggedFields(t, "docker_events",
+		map[string]interface{}{"container_id": "4d3c", "exit_code": int64(137)},
+		map[string]string{
+			"event":           "die",
+			"container_image": "nginx:1.9",
+			"container_name":  "web",
+		})
+	// Events of daemons before API 1.22 have no container name
+	acc.AssertContainsTaggedFields(t, "docker_events",
+		map[string]interface{}{"container_id": "9f2a"},
+		map[string]string{
+			"event":           "oom",
+			"container_image": "redis",
+		})
+	assert.Equal(t, 5, len(acc.Metrics))
+	assert.Equal(t, time.Unix(0, 1461943101000000001), acc.Metrics[0].Time)
+
+	server.Lock()
+	defer server.Unlock()
+	require.True(t, len(server.queries) >= 2)
+	assert.Equal(t, "1461943100.000000000", server.queries[0]["since"])
+	assert.Equal(t, "1461943102.000000001", server.queries[1]["since"])
+	var filters map[string][]string
+	require.NoError(t, json.Unmarshal([]byte(server.queries[0]["filters"]), &filters))
+	assert.Equal(t, map[string][]string{
+		"type":  {"container"},
+		"event": {"start", "die", "kill", "oom"},
+	}, filters)
+}
+
+func TestDockerEventsContainerNames(t *testing.T) {
+	d := NewDockerEvents()
+	d.ContainerNames = []string{"web"}
+	var acc testutil.Accumulator
+	d.acc = &acc
+	for _, raw := range []string{startEvent, otherEvent, oldEvent} {
+		var e event
+		require.NoError(t, json.Unmarshal([]byte(raw), &e))
+		d.add(e)
+	}
+	// Events without a container name don't match container_names
+	require.Equal(t, 1, len(acc.Metrics))
+	assert.Equal(t, "web", acc.Metrics[0].Tags["container_name"])
+}
+
+func TestDockerEventsUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker_events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(&eventsServer{
+		batches: [][]string{{startEvent}},
+	})
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	d := NewDockerEvents()
+	d.Endpoint = "unix://" + path
+	d.last = 1461943100000000000
+
+	var acc testutil.Accumulator
+	require.NoError(t, d.Start(&acc))
+	waitMetrics(t, &acc, 1)
+	d.Stop()
+	assert.Equal(t, "web", acc.Metrics[0].Tags["container_name"])
+}
+
+func TestDockerEventsEndpoint(t *testing.T) {
+	d := NewDockerEvents()
+	d.Endpoint = "ftp://localhost"
+	assert.Error(t, d.Start(&testutil.Accumulator{}))
+}
@@ -0,0 +1,125 @@
+package execd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/process"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/plugins/parsers"
+)
+
+const sampleConfig = `
+  ## Program to run as daemon, followed by its arguments
+  command = ["/usr/bin/telegraf-smartctl", "-d", "/dev/sda"]
+
+  ## Define how the process is signaled on each collection interval.
+  ## Valid values are:
+  ##   "none"  : Do not signal anything.
+  ##             The process must output metrics by itself.
+  ##   "STDIN" : Send a newline on STDIN.
+  signal = "none"
+
+  ## Delay before the process is restarted after an unexpected termination
+  restart_delay = "10s"
+
+  ## Data format to consume.
+  ## Each data format has it's own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md
+  data_format = "influx"
+`
+
+// Maximum length of a line written by the process
+const maxLineSize = 1 << 20
+
+type Execd struct {
+	Command      []string
+	Signal       string
+	RestartDelay internal.Duration
+
+	process *process.Process
+	parser  parsers.Parser
+	acc     telegraf.Accumulator
+}
+
+func NewExecd() *Execd {
+	return &Execd{
+		Signal:       "none",
+		RestartDelay: internal.Duration{Duration: 10 * time.Second},
+	}
+}
+
+func (e *Execd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Run an external program as a daemon and read the metrics it writes to stdout"
+}
+
+func (e *Execd) SetParser(parser parsers.Parser) {
+	e.parser = parser
+}
+
+func (e *Execd) Start(acc telegraf.Accumulator) error {
+	if e.Signal != "none" && e.Signal != "STDIN" {
+		return fmt.Errorf("execd: invalid signal %q, must be none or STDIN",
+			e.Signal)
+	}
+	p, err := process.New(e.Command)
+	if err != nil {
+		return fmt.Errorf("execd: %s", err)
+	}
+	p.RestartDelay = e.RestartDelay.Duration
+	p.ReadStdout = e.readStdout
+
+	e.acc = acc
+	e.process = p
+	return p.Start()
+}
+
+func (e *Execd) Stop() {
+	e.process.Stop()
+}
+
+func (e *Execd) Gather(acc telegraf.Accumulator) error {
+	if e.Signal == "STDIN" {
+		if _, err := e.process.Write([]byte("\n")); err != nil {
+			return fmt.Errorf("execd: could not signal %s: %s",
+				e.Command[0], err)
+		}
+	}
+	return nil
+}
+
+// readStdout parses each line the process writes.
+func (e *Execd) readStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		metrics, err := e.parser.Parse(scanner.Bytes())
+		if err != nil {
+			log.Printf("execd: could not parse the output of %s: %s\n",
+				e.Command[0], err)
+		}
+		for _, m := range metrics {
+			e.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("execd: error reading the output of %s: %s\n",
+			e.Command[0], err)
+	}
+}
+
+func init() {
+	inputs.Add("execd", func() telegraf.Input {
+		return NewExecd()
+	})
+}
@@ -0,0 +1,68 @@
+package execd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+// waitFor polls the accumulator until it holds n metrics.
+func waitFor(t *testing.T, acc *testutil.Accumulator, n int) {
+	for i := 0; i < 500; i++ {
+		if acc.NFields() >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d metrics, got %d", n, acc.NFields())
+}
+
+func newExecd(t *testing.T, script string) *Execd {
+	e := NewExecd()
+	e.Command = []string{"sh", "-c", script}
+	e.RestartDelay = internal.Duration{Duration: 10 * time.Millisecond}
+	parser, err := parsers.NewInfluxParser()
+	require.NoError(t, err)
+	e.SetParser(parser)
+	return e
+}
+
+func TestSignalStdin(t *testing.T) {
+	e := newExecd(t, `while read line; do echo "counter,source=sh value=1i"; done`)
+	e.Signal = "STDIN"
+
+	var acc testutil.Accumulator
+	require.NoError(t, e.Start(&acc))
+	defer e.Stop()
+
+	require.NoError(t, e.Gather(&acc))
+	require.NoError(t, e.Gather(&acc))
+	waitFor(t, &acc, 2)
+	acc.AssertContainsTaggedFields(t, "counter",
+		map[string]interface{}{"value": int64(1)},
+		map[string]string{"source": "sh"})
+}
+
+func TestRestart(t *testing.T) {
+	// The process exits after each metric and gets restarted
+	e := newExecd(t, `echo "counter value=1i"`)
+
+	var acc testutil.Accumulator
+	require.NoError(t, e.Start(&acc))
+	defer e.Stop()
+
+	waitFor(t, &acc, 3)
+}
+
+func TestInvalidSignal(t *testing.T) {
+	e := newExecd(t, "true")
+	e.Signal = "SIGUSR1"
+
+	var acc testutil.Accumulator
+	require.Error(t, e.Start(&acc))
+}
@@ -22,7 +22,14 @@ type GithubWebhooks struct {
 	// Lock for the struct
 	sync.Mutex
 	// Events buffer to store events between Gather calls
-	events []Event
+	events []tracedEvent
+}
+
+// tracedEvent is an event with the span context of the traceparent header
+// of its request, if any.
+type tracedEvent struct {
+	Event
+	span telegraf.SpanContext
 }
 
 func NewGithubWebhooks() *GithubWebhooks {
@@ -46,9 +53,10 @@ func (gh *GithubWebhooks) Gather(acc telegraf.Accumulator) error {
 	defer gh.Unlock()
 	for _, event := range gh.events {
 		p := event.NewMetric()
-		acc.AddFields("github_webhooks", p.Fields(), p.Tags(), p.Time())
+		telegraf.AddFieldsWithSpan(acc, event.span, "github_webhooks",
+			p.Fields(), p.Tags(), p.Time())
 	}
-	gh.events = make([]Event, 0)
+	gh.events = make([]tracedEvent, 0)
 	return nil
 }
 
@@ -85,8 +93,10 @@ func (gh *GithubWebhooks) eventHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	// Requests relayed by a traced proxy carry the span of the delivery
+	span, _ := telegraf.ParseTraceparent(r.Header.Get("Traceparent"))
 	gh.Lock()
-	gh.events = append(gh.events, e)
+	gh.events = append(gh.events, tracedEvent{Event: e, span: span})
 	gh.Unlock()
 	w.WriteHeader(http.StatusOK)
 }
@@ -5,6 +5,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
 )
 
 func TestCommitCommentEvent(t *testing.T) {
@@ -235,3 +237,32 @@ func TestWatchEvent(t *testing.T) {
 		t.Errorf("POST commit_comment returned HTTP status code %v.\nExpected %v", w.Code, http.StatusOK)
 	}
 }
+
+func TestTraceparent(t *testing.T) {
+	gh := NewGithubWebhooks()
+	for _, traceparent := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "invalid"} {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(PushEventJSON()))
+		req.Header.Add("X-Github-Event", "push")
+		req.Header.Add("Traceparent", traceparent)
+		w := httptest.NewRecorder()
+		gh.eventHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST push returned HTTP status code %v.\nExpected %v", w.Code, http.StatusOK)
+		}
+	}
+
+	var acc testutil.Accumulator
+	if err := gh.Gather(&acc); err != nil {
+		t.Fatal(err)
+	}
+	if len(acc.Metrics) != 2 {
+		t.Fatalf("Gathered %d metrics, expected 2", len(acc.Metrics))
+	}
+	if acc.Metrics[0].Span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Span of the traced push was %v", acc.Metrics[0].Span)
+	}
+	if acc.Metrics[1].Span.IsValid() {
+		t.Errorf("Span of the push with an invalid traceparent was %v", acc.Metrics[1].Span)
+	}
+}
@@ -0,0 +1,289 @@
+package gunicorn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// Clock ticks per second of the times in /proc/<pid>/stat (USER_HZ), 100 on
+// every architecture supported by Linux.
+const clockTicks = 100
+
+// Gunicorn reports the workers of gunicorn masters, found as the child
+// processes of the master pids in /proc.
+type Gunicorn struct {
+	PidFiles []string `toml:"pid_files"`
+
+	procRoot string
+	now      func() time.Time
+}
+
+// process holds the fields of a /proc/<pid>/stat file read by the input.
+type process struct {
+	pid       int
+	ppid      int
+	state     byte
+	utime     uint64
+	stime     uint64
+	threads   int64
+	starttime uint64
+	vsize     int64
+	rss       int64
+}
+
+var sampleConfig = `
+  ## Pid files of the gunicorn masters to monitor, as written by
+  ## "gunicorn --pid". The workers of a master are its child processes.
+  pid_files = ["/run/gunicorn.pid"]
+`
+
+func (g *Gunicorn) SampleConfig() string {
+	return sampleConfig
+}
+
+func (g *Gunicorn) Description() string {
+	return "Read the worker stats of gunicorn masters from /proc"
+}
+
+func (g *Gunicorn) Gather(acc telegraf.Accumulator) error {
+	bootTime, err := g.bootTime()
+	if err != nil {
+		return err
+	}
+	children, err := g.children()
+	if err != nil {
+		return err
+	}
+
+	// Keep gathering the remaining masters when one of them fails and
+	// return all errors as one giant error
+	errorStrings := []string{}
+	for _, pidFile := range g.PidFiles {
+		if err := g.gatherMaster(acc, pidFile, bootTime, children); err != nil {
+			errorStrings = append(errorStrings, err.Error())
+		}
+	}
+
+	if len(errorStrings) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errorStrings, "\n"))
+}
+
+func (g *Gunicorn) gatherMaster(
+	acc telegraf.Accumulator,
+	pidFile string,
+	bootTime int64,
+	children map[int][]*process,
+) error {
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return fmt.Errorf("Could not read gunicorn pid file '%s': %s",
+			pidFile, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("Invalid pid in gunicorn pid file '%s': %s",
+			pidFile, err)
+	}
+	master, err := g.readProcess(strconv.Itoa(pid))
+	if err != nil {
+		return fmt.Errorf("gunicorn master %d of '%s' is not running: %s",
+			pid, pidFile, err)
+	}
+
+	source, err := os.Hostname()
+	if err != nil {
+		source = "localhost"
+	}
+	now := g.now()
+
+	// Workers are numbered from 1 by age, so that the worker_id tags stay
+	// the same as long as no worker is respawned
+	workers := children[pid]
+	sort.Sort(byAge(workers))
+
+	busy := 0
+	for i, w := range workers {
+		status := "idle"
+		if w.busy() {
+			status = "busy"
+			busy++
+		}
+		spawn := w.startTime(bootTime)
+		fields := map[string]interface{}{
+			"pid":        int64(w.pid),
+			"status":     status,
+			"rss":        w.rss,
+			"vsz":        w.vsize,
+			"threads":    w.threads,
+			"cpu_time":   float64(w.utime+w.stime) / clockTicks,
+			"last_spawn": spawn,
+			"uptime":     now.Unix() - spawn,
+		}
+		tags := map[string]string{
+			"source":    source,
+			"pid_file":  pidFile,
+			"worker_id": strconv.Itoa(i + 1),
+		}
+		acc.AddFields("gunicorn_workers", fields, tags, now)
+	}
+
+	fields := map[string]interface{}{
+		"pid":          int64(pid),
+		"workers":      int64(len(workers)),
+		"busy_workers": int64(busy),
+		"idle_workers": int64(len(workers) - busy),
+		"rss":          master.rss,
+		"uptime":       now.Unix() - master.startTime(bootTime),
+	}
+	if len(workers) > 0 {
+		fields["busy_ratio"] = float64(busy) / float64(len(workers))
+	}
+	tags := map[string]string{
+		"source":   source,
+		"pid_file": pidFile,
+	}
+	acc.AddFields("gunicorn_overview", fields, tags, now)
+	return nil
+}
+
+// bootTime returns the boot time of the host from the btime line of
+// /proc/stat, as a unix timestamp.
+func (g *Gunicorn) bootTime() (int64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(g.procRoot, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) == 2 && string(fields[0]) == "btime" {
+			return strconv.ParseInt(string(fields[1]), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("No btime in %s", filepath.Join(g.procRoot, "stat"))
+}
+
+// children returns the running processes by the pid of their parent.
+func (g *Gunicorn) children() (map[int][]*process, error) {
+	files, err := ioutil.ReadDir(g.procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]*process)
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		if _, err := strconv.Atoi(file.Name()); err != nil {
+			continue
+		}
+		// Processes exiting while /proc is read are skipped
+		p, err := g.readProcess(file.Name())
+		if err != nil {
+			continue
+		}
+		children[p.ppid] = append(children[p.ppid], p)
+	}
+	return children, nil
+}
+
+// readProcess parses the /proc/<pid>/stat file of pid.
+func (g *Gunicorn) readProcess(pid string) (*process, error) {
+	statFile := filepath.Join(g.procRoot, pid, "stat")
+	data, err := ioutil.ReadFile(statFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// The command name may contain spaces and parentheses, the fields
+	// start after its last closing parenthesis
+	i := bytes.LastIndex(data, []byte(")"))
+	if i == -1 || i+2 > len(data) {
+		return nil, fmt.Errorf("Invalid stat file %s", statFile)
+	}
+	stats := bytes.Fields(data[i+2:])
+	if len(stats) < 22 {
+		return nil, fmt.Errorf("Invalid stat file %s", statFile)
+	}
+
+	p := &process{state: stats[0][0]}
+	ints := []struct {
+		index int
+		value *int64
+	}{
+		{17, &p.threads},
+		{20, &p.vsize},
+		{21, &p.rss},
+	}
+	for _, f := range ints {
+		if *f.value, err = strconv.ParseInt(string(stats[f.index]), 10, 64); err != nil {
+			return nil, fmt.Errorf("Invalid stat file %s: %s", statFile, err)
+		}
+	}
+	uints := []struct {
+		index int
+		value *uint64
+	}{
+		{11, &p.utime},
+		{12, &p.stime},
+		{19, &p.starttime},
+	}
+	for _, f := range uints {
+		if *f.value, err = strconv.ParseUint(string(stats[f.index]), 10, 64); err != nil {
+			return nil, fmt.Errorf("Invalid stat file %s: %s", statFile, err)
+		}
+	}
+	if p.pid, err = strconv.Atoi(pid); err != nil {
+		return nil, err
+	}
+	if p.ppid, err = strconv.Atoi(string(stats[1])); err != nil {
+		return nil, fmt.Errorf("Invalid stat file %s: %s", statFile, err)
+	}
+	p.rss *= int64(os.Getpagesize())
+	return p, nil
+}
+
+// byAge sorts processes from the oldest to the youngest.
+type byAge []*process
+
+func (s byAge) Len() int      { return len(s) }
+func (s byAge) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byAge) Less(i, j int) bool {
+	if s[i].starttime != s[j].starttime {
+		return s[i].starttime < s[j].starttime
+	}
+	return s[i].pid < s[j].pid
+}
+
+// busy returns whether the process was running or waiting for I/O, rather
+// than sleeping, when /proc was read.
+func (p *process) busy() bool {
+	return p.state == 'R' || p.state == 'D'
+}
+
+// startTime returns when the process started, as a unix timestamp.
+func (p *process) startTime(bootTime int64) int64 {
+	return bootTime + int64(p.starttime/clockTicks)
+}
+
+func init() {
+	inputs.Add("gunicorn", func() telegraf.Input {
+		return &Gunicorn{
+			procRoot: "/proc",
+			now:      time.Now,
+		}
+	})
+}
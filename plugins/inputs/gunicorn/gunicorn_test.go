@@ -0,0 +1,146 @@
+package gunicorn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeProc writes a fake /proc/<pid>/stat file with the given parent, state,
+// cpu times, start time in clock ticks since boot, and rss in pages.
+func writeProc(t *testing.T, root string, pid, ppid int, state string,
+	utime, stime, start, rss int) {
+	dir := filepath.Join(root, fmt.Sprint(pid))
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	stat := fmt.Sprintf("%d (gunicorn: worker [app (1)]) %s %d %d %d 0 -1 "+
+		"4194624 100 0 0 0 %d %d 0 0 20 0 1 0 %d 204800000 %d "+
+		"18446744073709551615 0 0 0 0 0 0 0 16781312 0 0 0 17 0 0 0 0 0 0\n",
+		pid, state, ppid, pid, pid, utime, stime, start, rss)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "stat"),
+		[]byte(stat), 0644))
+}
+
+func TestGather(t *testing.T) {
+	root, err := ioutil.TempDir("", "gunicorn")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "stat"),
+		[]byte("cpu  1 2 3 4\nbtime 1500000000\nprocesses 42\n"), 0644))
+	writeProc(t, root, 100, 1, "S", 50, 10, 1000, 2000)
+	writeProc(t, root, 103, 100, "S", 300, 100, 5000, 8000)
+	writeProc(t, root, 101, 100, "R", 200, 50, 2000, 9000)
+	writeProc(t, root, 200, 1, "S", 0, 0, 1000, 10)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "self"), 0755))
+	pidFile := filepath.Join(root, "gunicorn.pid")
+	require.NoError(t, ioutil.WriteFile(pidFile, []byte("100\n"), 0644))
+
+	now := time.Unix(1500000100, 0)
+	g := &Gunicorn{
+		PidFiles: []string{pidFile},
+		procRoot: root,
+		now:      func() time.Time { return now },
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, g.Gather(&acc))
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	page := int64(os.Getpagesize())
+
+	// The oldest worker is worker 1
+	acc.AssertContainsTaggedFields(t, "gunicorn_workers",
+		map[string]interface{}{
+			"pid":        int64(101),
+			"status":     "busy",
+			"rss":        9000 * page,
+			"vsz":        int64(204800000),
+			"threads":    int64(1),
+			"cpu_time":   2.5,
+			"last_spawn": int64(1500000020),
+			"uptime":     int64(80),
+		},
+		map[string]string{
+			"source":    hostname,
+			"pid_file":  pidFile,
+			"worker_id": "1",
+		})
+	acc.AssertContainsTaggedFields(t, "gunicorn_workers",
+		map[string]interface{}{
+			"pid":        int64(103),
+			"status":     "idle",
+			"rss":        8000 * page,
+			"vsz":        int64(204800000),
+			"threads":    int64(1),
+			"cpu_time":   4.0,
+			"last_spawn": int64(1500000050),
+			"uptime":     int64(50),
+		},
+		map[string]string{
+			"source":    hostname,
+			"pid_file":  pidFile,
+			"worker_id": "2",
+		})
+	acc.AssertContainsTaggedFields(t, "gunicorn_overview",
+		map[string]interface{}{
+			"pid":          int64(100),
+			"workers":      int64(2),
+			"busy_workers": int64(1),
+			"idle_workers": int64(1),
+			"busy_ratio":   0.5,
+			"rss":          2000 * page,
+			"uptime":       int64(90),
+		},
+		map[string]string{
+			"source":   hostname,
+			"pid_file": pidFile,
+		})
+	assert.Equal(t, 3, len(acc.Metrics))
+}
+
+func TestGatherErrors(t *testing.T) {
+	root, err := ioutil.TempDir("", "gunicorn")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "stat"),
+		[]byte("btime 1500000000\n"), 0644))
+	writeProc(t, root, 100, 1, "S", 0, 0, 1000, 10)
+	stopped := filepath.Join(root, "stopped.pid")
+	require.NoError(t, ioutil.WriteFile(stopped, []byte("300"), 0644))
+	running := filepath.Join(root, "running.pid")
+	require.NoError(t, ioutil.WriteFile(running, []byte("100"), 0644))
+
+	g := &Gunicorn{
+		PidFiles: []string{filepath.Join(root, "missing.pid"), stopped, running},
+		procRoot: root,
+		now:      func() time.Time { return time.Unix(1500000100, 0) },
+	}
+	var acc testutil.Accumulator
+	err = g.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing.pid")
+	assert.Contains(t, err.Error(), "gunicorn master 300")
+
+	// The running master is still gathered, without workers
+	acc.AssertContainsTaggedFields(t, "gunicorn_overview",
+		map[string]interface{}{
+			"pid":          int64(100),
+			"workers":      int64(0),
+			"busy_workers": int64(0),
+			"idle_workers": int64(0),
+			"rss":          10 * int64(os.Getpagesize()),
+			"uptime":       int64(90),
+		},
+		map[string]string{
+			"source":   acc.Metrics[0].Tags["source"],
+			"pid_file": running,
+		})
+}
@@ -13,7 +13,7 @@ import (
 	"time"
 )
 
-//CSV format: https://cbonte.github.io/haproxy-dconv/configuration-1.5.html#9.1
+// CSV format: https://cbonte.github.io/haproxy-dconv/configuration-1.5.html#9.1
 const (
 	HF_PXNAME         = 0  // 0. pxname [LFBS]: proxy name
 	HF_SVNAME         = 1  // 1. svname [LFBS]: service name (FRONTEND for frontend, BACKEND for backend, any name for server/listener)
@@ -165,12 +165,14 @@ func (h *HttpJson) Gather(acc telegraf.Accumulator) error {
 
 // Gathers data from a particular server
 // Parameters:
-//     acc      : The telegraf Accumulator to use
-//     serverURL: endpoint to send request to
-//     service  : the service being queried
+//
+//	acc      : The telegraf Accumulator to use
+//	serverURL: endpoint to send request to
+//	service  : the service being queried
 //
 // Returns:
-//     error: Any error that may have occurred
+//
+//	error: Any error that may have occurred
 func (h *HttpJson) gatherServer(
 	acc telegraf.Accumulator,
 	serverURL string,
@@ -215,11 +217,13 @@ func (h *HttpJson) gatherServer(
 // Sends an HTTP request to the server using the HttpJson object's HTTPClient.
 // This request can be either a GET or a POST.
 // Parameters:
-//     serverURL: endpoint to send request to
+//
+//	serverURL: endpoint to send request to
 //
 // Returns:
-//     string: body of the response
-//     error : Any error that may have occurred
+//
+//	string: body of the response
+//	error : Any error that may have occurred
 func (h *HttpJson) sendRequest(serverURL string) (string, float64, error) {
 	// Prepare URL
 	requestURL, err := url.Parse(serverURL)
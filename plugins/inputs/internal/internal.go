@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"runtime"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+type Self struct {
+	CollectMemstats bool
+}
+
+func NewSelf() telegraf.Input {
+	return &Self{
+		CollectMemstats: true,
+	}
+}
+
+var sampleConfig = `
+  ## If true, collect telegraf memory stats.
+  # collect_memstats = true
+`
+
+func (s *Self) Description() string {
+	return "Collect statistics about itself"
+}
+
+func (s *Self) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *Self) Gather(acc telegraf.Accumulator) error {
+	if s.CollectMemstats {
+		m := &runtime.MemStats{}
+		runtime.ReadMemStats(m)
+		fields := map[string]interface{}{
+			"alloc_bytes":       m.Alloc,
+			"total_alloc_bytes": m.TotalAlloc,
+			"sys_bytes":         m.Sys,
+			"mallocs":           m.Mallocs,
+			"frees":             m.Frees,
+			"heap_alloc_bytes":  m.HeapAlloc,
+			"heap_sys_bytes":    m.HeapSys,
+			"heap_objects":      m.HeapObjects,
+			"num_gc":            m.NumGC,
+			"goroutines":        runtime.NumGoroutine(),
+		}
+		acc.AddFields("internal_memstats", fields, nil)
+	}
+
+	for _, m := range selfstat.Metrics() {
+		acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+	}
+	return nil
+}
+
+func init() {
+	inputs.Add("internal", NewSelf)
+}
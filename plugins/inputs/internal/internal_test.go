@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/influxdata/telegraf/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfPlugin(t *testing.T) {
+	s := NewSelf()
+	selfstat.Register("test", "count", map[string]string{"input": "test"}).Incr(3)
+
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+
+	assert.True(t, acc.HasMeasurement("internal_memstats"))
+	acc.AssertContainsTaggedFields(t, "internal_test",
+		map[string]interface{}{"count": int64(3)},
+		map[string]string{"input": "test"})
+}
+
+func TestNoMemstats(t *testing.T) {
+	s := &Self{}
+
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+
+	assert.False(t, acc.HasMeasurement("internal_memstats"))
+}
@@ -0,0 +1,379 @@
+package ipmi_lan
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// IpmiLan reads the sensors and the SEL of BMCs over RMCP+, IPMI v2.0 over
+// LAN, without ipmitool.
+type IpmiLan struct {
+	Servers []Server `toml:"server"`
+	Timeout internal.Duration
+
+	mu sync.Mutex
+	// SDR repositories read, by address
+	repositories map[string]*repository
+}
+
+// Server is a BMC and the credentials of its user.
+type Server struct {
+	Address   string
+	Username  string
+	Password  string
+	Privilege string
+	// BMC key, as hex, for the BMCs with two-key logins
+	Kg string `toml:"kg"`
+}
+
+// repository is the sensors of a SDR repository, as of its last addition
+// and erase.
+type repository struct {
+	addition, erase uint32
+	sensors         []*sensorRecord
+}
+
+var sampleConfig = `
+  ## Timeout of each request to the BMCs, retried twice
+  # timeout = "2s"
+
+  ## BMCs to read the sensors and the SEL of, the credentials can be secret
+  ## references: password = "@{vault:bmc1_password}"
+  ## The privilege level is "user" (default), "operator" or "administrator"
+  [[inputs.ipmi_lan.server]]
+    address = "192.168.1.1:623"
+    username = "USERID"
+    password = "PASSW0RD"
+    # privilege = "user"
+    # kg = ""
+`
+
+func (m *IpmiLan) SampleConfig() string {
+	return sampleConfig
+}
+
+func (m *IpmiLan) Description() string {
+	return "Read the sensors and the SEL of BMCs speaking IPMI v2.0 over LAN"
+}
+
+// Privilege levels.
+const (
+	privilegeUser          = 0x02
+	privilegeOperator      = 0x03
+	privilegeAdministrator = 0x04
+)
+
+func (m *IpmiLan) Gather(acc telegraf.Accumulator) error {
+	timeout := m.Timeout.Duration
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	// Keep gathering when one of them fails and return all errors as one
+	// giant error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errorStrings []string
+	for _, server := range m.Servers {
+		wg.Add(1)
+		go func(server Server) {
+			defer wg.Done()
+			if err := m.gatherServer(server, timeout, acc); err != nil {
+				mu.Lock()
+				errorStrings = append(errorStrings, server.Address+": "+err.Error())
+				mu.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+func (m *IpmiLan) gatherServer(server Server, timeout time.Duration, acc telegraf.Accumulator) error {
+	address := server.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "623")
+	}
+	host, _, _ := net.SplitHostPort(address)
+
+	var privilege byte
+	switch strings.ToLower(server.Privilege) {
+	case "", "user":
+		privilege = privilegeUser
+	case "operator":
+		privilege = privilegeOperator
+	case "administrator":
+		privilege = privilegeAdministrator
+	default:
+		return fmt.Errorf("invalid privilege %s", server.Privilege)
+	}
+	var kg []byte
+	if server.Kg != "" {
+		var err error
+		if kg, err = hex.DecodeString(server.Kg); err != nil || len(kg) > 20 {
+			return fmt.Errorf("invalid kg, expected up to 20 bytes as hex")
+		}
+		kg = append(kg, make([]byte, 20-len(kg))...)
+	}
+
+	s, err := openSession(address, server.Username, server.Password, kg, privilege, timeout)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	sensors, err := m.sensors(s, address)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, sensor := range sensors {
+		if err := gatherSensor(s, host, sensor, now, acc); err != nil {
+			return fmt.Errorf("sensor %s: %s", sensor.name, err)
+		}
+	}
+
+	return gatherSEL(s, host, acc)
+}
+
+// sensors returns the sensors of the SDR repository of the BMC, read again
+// only when it changed.
+func (m *IpmiLan) sensors(s *session, address string) ([]*sensorRecord, error) {
+	info, err := s.command(netFnStorage, cmdGetSDRRepositoryInfo, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Get SDR Repository Info: %s", err)
+	}
+	if len(info) < 13 {
+		return nil, errors.New("Get SDR Repository Info: truncated response")
+	}
+	addition := binary.LittleEndian.Uint32(info[5:])
+	erase := binary.LittleEndian.Uint32(info[9:])
+
+	m.mu.Lock()
+	repo, ok := m.repositories[address]
+	m.mu.Unlock()
+	if ok && repo.addition == addition && repo.erase == erase {
+		return repo.sensors, nil
+	}
+
+	repo = &repository{addition: addition, erase: erase}
+	if repo.sensors, err = readSDR(s); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	if m.repositories == nil {
+		m.repositories = make(map[string]*repository)
+	}
+	m.repositories[address] = repo
+	m.mu.Unlock()
+	return repo.sensors, nil
+}
+
+// Bytes of a record read by each Get SDR, a full record at once exceeds the
+// buffers of many BMCs
+const sdrChunk = 16
+
+// readSDR returns the sensors of the BMC in its SDR repository.
+func readSDR(s *session) ([]*sensorRecord, error) {
+	var sensors []*sensorRecord
+	reservation, err := reserveSDR(s)
+	if err != nil {
+		return nil, err
+	}
+	for id := uint16(0); id != 0xffff; {
+		var record []byte
+		var next uint16
+		// The reservation is lost when the repository changes
+		for try := 0; ; try++ {
+			record, next, err = readRecord(s, reservation, id)
+			if err != completionCode(completionReservationGone) || try == 2 {
+				break
+			}
+			if reservation, err = reserveSDR(s); err != nil {
+				return nil, err
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Get SDR %d: %s", id, err)
+		}
+		sensor, err := parseSensorRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("SDR %d: %s", id, err)
+		}
+		// The sensors of the other controllers are only reachable bridged
+		if sensor != nil && sensor.owner == bmcAddress {
+			sensors = append(sensors, sensor)
+		}
+		if next == id {
+			break
+		}
+		id = next
+	}
+	return sensors, nil
+}
+
+func reserveSDR(s *session) ([]byte, error) {
+	resp, err := s.command(netFnStorage, cmdReserveSDRRepository, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Reserve SDR Repository: %s", err)
+	}
+	if len(resp) < 2 {
+		return nil, errors.New("Reserve SDR Repository: truncated response")
+	}
+	return resp[:2], nil
+}
+
+// readRecord returns the SDR record id and the id of the next one.
+func readRecord(s *session, reservation []byte, id uint16) ([]byte, uint16, error) {
+	get := func(offset, length byte) ([]byte, uint16, error) {
+		req := []byte{reservation[0], reservation[1], byte(id), byte(id >> 8), offset, length}
+		resp, err := s.command(netFnStorage, cmdGetSDR, req)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(resp) < 2 {
+			return nil, 0, errors.New("truncated response")
+		}
+		return resp[2:], binary.LittleEndian.Uint16(resp), nil
+	}
+
+	header, next, err := get(0, 5)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(header) < 5 {
+		return nil, 0, errors.New("truncated record header")
+	}
+	record := append([]byte{}, header[:5]...)
+	length := int(header[4]) + 5
+	for len(record) < length {
+		n := length - len(record)
+		if n > sdrChunk {
+			n = sdrChunk
+		}
+		data, _, err := get(byte(len(record)), byte(n))
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data) == 0 {
+			return nil, 0, errors.New("empty record data")
+		}
+		record = append(record, data...)
+	}
+	return record, next, nil
+}
+
+func gatherSensor(s *session, host string, sensor *sensorRecord, now time.Time, acc telegraf.Accumulator) error {
+	reading, err := s.command(netFnSensor, cmdGetSensorReading, []byte{sensor.number})
+	if err != nil {
+		// Sensors of the SDR, such as those of empty slots, may be absent
+		if code, ok := err.(completionCode); ok && (code == 0xcb || code == 0xcd) {
+			return nil
+		}
+		return fmt.Errorf("Get Sensor Reading: %s", err)
+	}
+	if len(reading) < 2 {
+		return errors.New("Get Sensor Reading: truncated response")
+	}
+
+	tags := map[string]string{
+		"server": host,
+		"name":   transform(sensor.name),
+		"entity_id": strconv.Itoa(int(sensor.entityID)) + "." +
+			strconv.Itoa(int(sensor.instance)),
+	}
+	if sensor.unit != "" {
+		tags["unit"] = sensor.unit
+	}
+	fields := make(map[string]interface{})
+
+	// Reading or state unavailable, or scanning disabled
+	if reading[1]&0x20 != 0 || reading[1]&0x40 == 0 {
+		fields["status"] = 0
+		acc.AddFields("ipmi_sensor", fields, tags, now)
+		return nil
+	}
+
+	if !sensor.threshold() {
+		var state int
+		if len(reading) > 2 {
+			state = int(reading[2])
+		}
+		if len(reading) > 3 {
+			state |= int(reading[3]&0x7f) << 8
+		}
+		fields["status"] = 1
+		fields["state"] = state
+		acc.AddFields("ipmi_sensor", fields, tags, now)
+		return nil
+	}
+
+	fields["value"] = sensor.convert(reading[0])
+	fields["status"] = 1
+	if len(reading) > 2 && reading[2]&0x3f != 0 {
+		fields["status"] = 0
+	}
+	limits, err := s.command(netFnSensor, cmdGetSensorThresholds, []byte{sensor.number})
+	if err == nil && len(limits) >= 7 {
+		for i, name := range thresholds {
+			if limits[0]&(1<<uint(i)) != 0 {
+				fields[name] = sensor.convert(limits[i+1])
+			}
+		}
+	}
+	acc.AddFields("ipmi_sensor", fields, tags, now)
+	return nil
+}
+
+func gatherSEL(s *session, host string, acc telegraf.Accumulator) error {
+	info, err := s.command(netFnStorage, cmdGetSELInfo, nil)
+	if err != nil {
+		return fmt.Errorf("Get SEL Info: %s", err)
+	}
+	if len(info) < 14 {
+		return errors.New("Get SEL Info: truncated response")
+	}
+	fields := map[string]interface{}{
+		"entries":    int(binary.LittleEndian.Uint16(info[1:])),
+		"free_bytes": int(binary.LittleEndian.Uint16(info[3:])),
+		"overflow":   info[13]&0x80 != 0,
+	}
+	// 0xffffffff when never added nor erased
+	if t := binary.LittleEndian.Uint32(info[5:]); t != 0xffffffff {
+		fields["last_add_time"] = int64(t)
+	}
+	if t := binary.LittleEndian.Uint32(info[9:]); t != 0xffffffff {
+		fields["last_erase_time"] = int64(t)
+	}
+	acc.AddFields("ipmi_sel", fields, map[string]string{"server": host})
+	return nil
+}
+
+func transform(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.ToLower(s)
+	return strings.Replace(s, " ", "_", -1)
+}
+
+func init() {
+	inputs.Add("ipmi_lan", func() telegraf.Input {
+		return &IpmiLan{
+			Timeout: internal.Duration{Duration: 2 * time.Second},
+		}
+	})
+}
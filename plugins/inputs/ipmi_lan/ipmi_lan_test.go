@@ -0,0 +1,371 @@
+package ipmi_lan
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBMC answers the RMCP+ sessions of a user and the commands with
+// handlers.
+type fakeBMC struct {
+	conn     *net.UDPConn
+	username string
+	password string
+
+	mu       sync.Mutex
+	handlers map[[2]byte]func(data []byte) (byte, []byte)
+	// Commands received, by netFn and command
+	calls map[[2]byte]int
+
+	consoleID uint32
+	rm        []byte
+	role      byte
+	keys      *rakpKeys
+	seq       uint32
+}
+
+var (
+	bmcID   = uint32(0x0a0b0c0d)
+	bmcRc   = []byte("0123456789abcdef")
+	bmcGUID = []byte("fedcba9876543210")
+)
+
+func newFakeBMC(t *testing.T, username, password string) *fakeBMC {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	b := &fakeBMC{
+		conn:     conn,
+		username: username,
+		password: password,
+		handlers: make(map[[2]byte]func([]byte) (byte, []byte)),
+		calls:    make(map[[2]byte]int),
+	}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBMC) addr() string {
+	return b.conn.LocalAddr().String()
+}
+
+func (b *fakeBMC) handle(netFn, cmd byte, h func(data []byte) (byte, []byte)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[[2]byte{netFn, cmd}] = h
+}
+
+func (b *fakeBMC) count(netFn, cmd byte) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls[[2]byte{netFn, cmd}]
+}
+
+func (b *fakeBMC) serve() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var k1, k2 []byte
+		b.mu.Lock()
+		if b.keys != nil {
+			k1, k2 = b.keys.k1, b.keys.k2
+		}
+		b.mu.Unlock()
+		payloadType, _, payload, err := openPacket(k1, k2, buf[:n])
+		if err != nil {
+			continue
+		}
+		if reply, replyType := b.reply(payloadType&0x3f, payload); reply != nil {
+			b.mu.Lock()
+			var sessionID uint32
+			var k1, k2 []byte
+			if replyType == payloadIPMI {
+				b.seq++
+				sessionID, k1, k2 = b.consoleID, b.keys.k1, b.keys.k2
+			}
+			packet, _ := sealPacket(k1, k2, sessionID, b.seq, replyType, reply)
+			b.mu.Unlock()
+			b.conn.WriteToUDP(packet, addr)
+		}
+	}
+}
+
+func (b *fakeBMC) reply(payloadType byte, p []byte) ([]byte, byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch payloadType {
+	case payloadOpenRequest:
+		b.consoleID = binary.LittleEndian.Uint32(p[4:])
+		reply := make([]byte, 36)
+		reply[0] = p[0]
+		reply[2] = privilegeAdministrator
+		binary.LittleEndian.PutUint32(reply[4:], b.consoleID)
+		binary.LittleEndian.PutUint32(reply[8:], bmcID)
+		copy(reply[12:], p[8:32])
+		return reply, payloadOpenReply
+	case payloadRAKP1:
+		b.rm = append([]byte{}, p[8:24]...)
+		b.role = p[24]
+		username := string(p[28 : 28+int(p[27])])
+		reply := make([]byte, 60)
+		binary.LittleEndian.PutUint32(reply[4:], b.consoleID)
+		if username != b.username {
+			reply[1] = 0x0d
+			return reply[:8], payloadRAKP2
+		}
+		kuid := make([]byte, 20)
+		copy(kuid, b.password)
+		keys := newRAKPKeys(kuid, kuid, b.consoleID, bmcID, b.rm, bmcRc, bmcGUID, b.role, username)
+		copy(reply[8:], bmcRc)
+		copy(reply[24:], bmcGUID)
+		copy(reply[40:], keys.rakp2)
+		b.keys = keys
+		return reply, payloadRAKP2
+	case payloadRAKP3:
+		reply := make([]byte, 8+authCodeLength)
+		binary.LittleEndian.PutUint32(reply[4:], b.consoleID)
+		if string(p[8:28]) != string(b.keys.rakp3) {
+			reply[1] = 0x0f
+			b.keys = nil
+			return reply[:8], payloadRAKP4
+		}
+		copy(reply[8:], b.keys.rakp4)
+		return reply, payloadRAKP4
+	case payloadIPMI:
+		netFn, rqSeq, cmd := p[1]>>2, p[4]>>2, p[5]
+		key := [2]byte{netFn, cmd}
+		b.calls[key]++
+		code, data := byte(0xc1), []byte(nil)
+		if h, ok := b.handlers[key]; ok {
+			code, data = h(p[6 : len(p)-1])
+		}
+		reply := []byte{consoleAddress, (netFn + 1) << 2, 0, bmcAddress, rqSeq << 2, cmd, code}
+		reply[2] = checksum(reply[:2])
+		reply = append(reply, data...)
+		return append(reply, checksum(reply[3:])), payloadIPMI
+	}
+	return nil, 0
+}
+
+func fullRecord(id uint16, owner, number, readingType, units1, unit byte, m, b, rExp, bExp int, name string) []byte {
+	r := make([]byte, 48, 48+len(name))
+	binary.LittleEndian.PutUint16(r, id)
+	r[2], r[3], r[4] = 0x51, recordFullSensor, byte(48+len(name)-5)
+	r[5], r[7], r[8], r[9] = owner, number, 7, 1
+	r[13] = readingType
+	r[20], r[21] = units1, unit
+	r[24], r[25] = byte(m), byte(m>>8&0x03)<<6
+	r[26], r[27] = byte(b), byte(b>>8&0x03)<<6
+	r[29] = byte(rExp&0x0f)<<4 | byte(bExp&0x0f)
+	r[47] = 0xc0 | byte(len(name))
+	return append(r, name...)
+}
+
+func compactRecord(id uint16, number, readingType byte, name string) []byte {
+	r := make([]byte, 32, 32+len(name))
+	binary.LittleEndian.PutUint16(r, id)
+	r[2], r[3], r[4] = 0x51, recordCompactSensor, byte(32+len(name)-5)
+	r[5], r[7], r[8], r[9] = bmcAddress, number, 10, 1
+	r[13] = readingType
+	r[31] = 0xc0 | byte(len(name))
+	return append(r, name...)
+}
+
+// addSDR serves the records as the SDR repository.
+func (b *fakeBMC) addSDR(records [][]byte) {
+	b.handle(netFnStorage, cmdGetSDRRepositoryInfo, func([]byte) (byte, []byte) {
+		info := make([]byte, 14)
+		info[0] = 0x51
+		binary.LittleEndian.PutUint16(info[1:], uint16(len(records)))
+		binary.LittleEndian.PutUint32(info[5:], 1526000000)
+		return 0, info
+	})
+	reservation := uint16(0)
+	b.handle(netFnStorage, cmdReserveSDRRepository, func([]byte) (byte, []byte) {
+		reservation++
+		return 0, []byte{byte(reservation), byte(reservation >> 8)}
+	})
+	lost := false
+	b.handle(netFnStorage, cmdGetSDR, func(data []byte) (byte, []byte) {
+		res := binary.LittleEndian.Uint16(data)
+		id := binary.LittleEndian.Uint16(data[2:])
+		offset, length := int(data[4]), int(data[5])
+		// The first reservation is lost while reading the second record
+		if id == 1 && offset > 0 && !lost {
+			lost = true
+			return completionReservationGone, nil
+		}
+		if offset > 0 && res != reservation {
+			return completionReservationGone, nil
+		}
+		if int(id) >= len(records) {
+			return 0xcb, nil
+		}
+		next := id + 1
+		if int(next) == len(records) {
+			next = 0xffff
+		}
+		record := records[id]
+		end := offset + length
+		if end > len(record) {
+			end = len(record)
+		}
+		return 0, append([]byte{byte(next), byte(next >> 8)}, record[offset:end]...)
+	})
+}
+
+func TestIpmiLan(t *testing.T) {
+	b := newFakeBMC(t, "USERID", "PASSW0RD")
+	defer b.conn.Close()
+
+	b.addSDR([][]byte{
+		fullRecord(0, bmcAddress, 0x01, typeThreshold, 0x00, 1, 1, 0, 0, 0, "Ambient Temp"),
+		fullRecord(1, bmcAddress, 0x02, typeThreshold, 0x00, 4, 2, -1, -2, 0, "Planar 3.3V"),
+		compactRecord(2, 0x03, 0x6f, "PS 1 Status"),
+		// Owned by another controller
+		fullRecord(3, 0x2c, 0x04, typeThreshold, 0x00, 1, 1, 0, 0, 0, "Remote Temp"),
+		// Not present
+		fullRecord(4, bmcAddress, 0x05, typeThreshold, 0x00, 18, 1, 0, 0, 0, "Fan 4"),
+		// Management controller device locator
+		{5, 0, 0x51, 0x12, 3, 0, 0, 0},
+	})
+	b.handle(netFnSensor, cmdGetSensorReading, func(data []byte) (byte, []byte) {
+		switch data[0] {
+		case 0x01:
+			return 0, []byte{20, 0xc0, 0x00}
+		case 0x02:
+			// At or above the upper non critical threshold
+			return 0, []byte{165, 0xc0, 0x08}
+		case 0x03:
+			return 0, []byte{0, 0xc0, 0x01, 0x80}
+		}
+		return 0xcb, nil
+	})
+	b.handle(netFnSensor, cmdGetSensorThresholds, func(data []byte) (byte, []byte) {
+		switch data[0] {
+		case 0x01:
+			return 0, []byte{0x1b, 5, 2, 0, 40, 45, 0}
+		case 0x02:
+			return 0, []byte{0x3f, 150, 148, 145, 165, 170, 180}
+		}
+		return 0xcb, nil
+	})
+	b.handle(netFnStorage, cmdGetSELInfo, func([]byte) (byte, []byte) {
+		return 0, []byte{0x51, 12, 0, 0x00, 0x10, 0x80, 0xe9, 0xf4, 0x5a, 0xff, 0xff, 0xff, 0xff, 0x0f}
+	})
+	b.handle(netFnApp, cmdCloseSession, func([]byte) (byte, []byte) {
+		return 0, nil
+	})
+
+	m := &IpmiLan{
+		Servers: []Server{{Address: b.addr(), Username: "USERID", Password: "PASSW0RD"}},
+		Timeout: internal.Duration{Duration: time.Second},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, m.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "ipmi_sensor",
+		map[string]interface{}{
+			"value":              20.0,
+			"status":             1,
+			"lower_non_critical": 5.0,
+			"lower_critical":     2.0,
+			"upper_non_critical": 40.0,
+			"upper_critical":     45.0,
+		},
+		map[string]string{"server": "127.0.0.1", "name": "ambient_temp", "unit": "degrees_c", "entity_id": "7.1"})
+	acc.AssertContainsTaggedFields(t, "ipmi_sensor",
+		map[string]interface{}{
+			"value":                 3.29,
+			"status":                0,
+			"lower_non_critical":    2.99,
+			"lower_critical":        2.95,
+			"lower_non_recoverable": 2.89,
+			"upper_non_critical":    3.29,
+			"upper_critical":        3.39,
+			"upper_non_recoverable": 3.59,
+		},
+		map[string]string{"server": "127.0.0.1", "name": "planar_3.3v", "unit": "volts", "entity_id": "7.1"})
+	acc.AssertContainsTaggedFields(t, "ipmi_sensor",
+		map[string]interface{}{
+			"status": 1,
+			"state":  1,
+		},
+		map[string]string{"server": "127.0.0.1", "name": "ps_1_status", "entity_id": "10.1"})
+	acc.AssertContainsTaggedFields(t, "ipmi_sel",
+		map[string]interface{}{
+			"entries":       12,
+			"free_bytes":    4096,
+			"overflow":      false,
+			"last_add_time": int64(1526000000),
+		},
+		map[string]string{"server": "127.0.0.1"})
+	assert.Equal(t, 4, len(acc.Metrics))
+	assert.Equal(t, 1, b.count(netFnApp, cmdCloseSession))
+
+	// The SDR repository is read again only once changed
+	getSDR := b.count(netFnStorage, cmdGetSDR)
+	require.NoError(t, m.Gather(&acc))
+	assert.Equal(t, getSDR, b.count(netFnStorage, cmdGetSDR))
+	assert.Equal(t, 8, len(acc.Metrics))
+}
+
+func TestIpmiLanWrongPassword(t *testing.T) {
+	b := newFakeBMC(t, "USERID", "PASSW0RD")
+	defer b.conn.Close()
+
+	m := &IpmiLan{
+		Servers: []Server{
+			{Address: b.addr(), Username: "USERID", Password: "wrong"},
+			{Address: b.addr(), Username: "nobody", Password: "PASSW0RD"},
+		},
+		Timeout: internal.Duration{Duration: time.Second},
+	}
+	var acc testutil.Accumulator
+	err := m.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "wrong password")
+	assert.Contains(t, err.Error(), "unauthorized name")
+	assert.Empty(t, acc.Metrics)
+}
+
+func TestConvert(t *testing.T) {
+	// 2's complement readings
+	r := &sensorRecord{analog: true, format: 0x02, m: 1}
+	assert.Equal(t, -2.0, r.convert(0xfe))
+	// 1's complement readings
+	r.format = 0x01
+	assert.Equal(t, -1.0, r.convert(0xfe))
+	// 1/x
+	r = &sensorRecord{analog: true, m: 1, rExp: 1, linearization: 7}
+	assert.Equal(t, 0.05, r.convert(2))
+}
+
+func TestParseSensorRecord(t *testing.T) {
+	r, err := parseSensorRecord(fullRecord(0, bmcAddress, 0x01, typeThreshold, 0x80, 6, -3, 511, -4, 7, "Power"))
+	require.NoError(t, err)
+	assert.Equal(t, "Power", r.name)
+	assert.Equal(t, "watts", r.unit)
+	assert.True(t, r.threshold())
+	assert.Equal(t, byte(0x02), r.format)
+	assert.Equal(t, -3, r.m)
+	assert.Equal(t, 511, r.b)
+	assert.Equal(t, -4, r.rExp)
+	assert.Equal(t, 7, r.bExp)
+
+	r, err = parseSensorRecord([]byte{5, 0, 0x51, 0x12, 3, 0, 0, 0})
+	require.NoError(t, err)
+	assert.Nil(t, r)
+	_, err = parseSensorRecord(compactRecord(2, 0x03, 0x6f, "PS 1 Status")[:20])
+	assert.Error(t, err)
+}
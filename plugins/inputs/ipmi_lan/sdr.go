@@ -0,0 +1,197 @@
+package ipmi_lan
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SDR record types.
+const (
+	recordFullSensor    = 0x01
+	recordCompactSensor = 0x02
+)
+
+// Event/reading type code of the threshold sensors.
+const typeThreshold = 0x01
+
+// sensorRecord is a full or compact sensor record of the SDR repository,
+// IPMI v2.0 43.1 and 43.2.
+type sensorRecord struct {
+	owner    byte
+	lun      byte
+	number   byte
+	entityID byte
+	instance byte
+	// Event/reading type code
+	readingType byte
+	name        string
+	unit        string
+
+	// Conversion of the readings of the full records
+	analog        bool
+	format        byte
+	linearization byte
+	m, b          int
+	bExp, rExp    int
+}
+
+func (r *sensorRecord) threshold() bool {
+	return r.analog && r.readingType == typeThreshold
+}
+
+// parseSensorRecord returns the sensor of the SDR record, nil for the other
+// records.
+func parseSensorRecord(record []byte) (*sensorRecord, error) {
+	if len(record) < 5 {
+		return nil, errors.New("truncated SDR record")
+	}
+	recordType := record[3]
+	if recordType != recordFullSensor && recordType != recordCompactSensor {
+		return nil, nil
+	}
+	idOffset := 48
+	if recordType == recordCompactSensor {
+		idOffset = 32
+	}
+	if len(record) < idOffset {
+		return nil, errors.New("truncated sensor record")
+	}
+
+	r := &sensorRecord{
+		owner:       record[5],
+		lun:         record[6] & 0x03,
+		number:      record[7],
+		entityID:    record[8],
+		instance:    record[9] & 0x7f,
+		readingType: record[13],
+	}
+	idLength := int(record[idOffset-1] & 0x1f)
+	if len(record) < idOffset+idLength {
+		idLength = len(record) - idOffset
+	}
+	r.name = strings.TrimRight(string(record[idOffset:idOffset+idLength]), "\x00 ")
+
+	units1 := record[20]
+	r.unit = unitName(record[21])
+	if units1&0x01 != 0 {
+		r.unit = "percent"
+	}
+	if recordType == recordCompactSensor {
+		return r, nil
+	}
+
+	r.format = units1 >> 6
+	// No analog reading
+	r.analog = r.format != 0x03
+	r.linearization = record[23] & 0x7f
+	r.m = signExtend(int(record[24])|int(record[25]>>6)<<8, 10)
+	r.b = signExtend(int(record[26])|int(record[27]>>6)<<8, 10)
+	r.rExp = signExtend(int(record[29]>>4), 4)
+	r.bExp = signExtend(int(record[29]&0x0f), 4)
+	return r, nil
+}
+
+func signExtend(v int, bits uint) int {
+	if v&(1<<(bits-1)) != 0 {
+		return v - 1<<bits
+	}
+	return v
+}
+
+// convert returns the value of the raw reading, y = L[(Mx + B * 10^Bexp) *
+// 10^Rexp], IPMI v2.0 36.3.
+func (r *sensorRecord) convert(raw byte) float64 {
+	var x int
+	switch r.format {
+	case 0x01:
+		// 1's complement
+		x = int(int8(raw))
+		if x < 0 {
+			x++
+		}
+	case 0x02:
+		x = int(int8(raw))
+	default:
+		x = int(raw)
+	}
+
+	y := float64(r.m*x) + float64(r.b)*pow10(r.bExp)
+	// Divided rather than multiplied by the negative powers, for 329 *
+	// 10^-2 to be 3.29
+	if r.rExp < 0 {
+		y /= pow10(-r.rExp)
+	} else {
+		y *= pow10(r.rExp)
+	}
+
+	switch r.linearization {
+	case 1:
+		y = math.Log(y)
+	case 2:
+		y = math.Log10(y)
+	case 3:
+		y = math.Log2(y)
+	case 4:
+		y = math.Exp(y)
+	case 5:
+		y = math.Pow(10, y)
+	case 6:
+		y = math.Exp2(y)
+	case 7:
+		y = 1 / y
+	case 8:
+		y = y * y
+	case 9:
+		y = y * y * y
+	case 10:
+		y = math.Sqrt(y)
+	case 11:
+		y = math.Cbrt(y)
+	}
+	return y
+}
+
+func pow10(e int) float64 {
+	if e < 0 {
+		return 1 / math.Pow(10, float64(-e))
+	}
+	return math.Pow(10, float64(e))
+}
+
+// Sensor unit type codes, IPMI v2.0 43.17.
+var units = []string{
+	"", "degrees_c", "degrees_f", "degrees_k", "volts", "amps", "watts",
+	"joules", "coulombs", "va", "nits", "lumen", "lux", "candela", "kpa",
+	"psi", "newton", "cfm", "rpm", "hz", "microsecond", "millisecond",
+	"second", "minute", "hour", "day", "week", "mil", "inches", "feet",
+	"cu_in", "cu_feet", "mm", "cm", "m", "cu_cm", "cu_m", "liters",
+	"fluid_ounce", "radians", "steradians", "revolutions", "cycles",
+	"gravities", "ounce", "pound", "ft-lb", "oz-in", "gauss", "gilberts",
+	"henry", "millihenry", "farad", "microfarad", "ohms", "siemens", "mole",
+	"becquerel", "ppm", "reserved", "decibels", "dba", "dbc", "gray",
+	"sievert", "color_temp_deg_k", "bit", "kilobit", "megabit", "gigabit",
+	"byte", "kilobyte", "megabyte", "gigabyte", "word", "dword", "qword",
+	"line", "hit", "miss", "retry", "reset", "overrun_/_overflow",
+	"underrun", "collision", "packets", "messages", "characters", "error",
+	"correctable_error", "uncorrectable_error", "fatal_error", "grams",
+}
+
+func unitName(code byte) string {
+	if int(code) < len(units) {
+		return units[code]
+	}
+	return "unit_" + strconv.Itoa(int(code))
+}
+
+// Names of the thresholds, in the order of the Get Sensor Thresholds
+// response and of the threshold comparison status bits.
+var thresholds = []string{
+	"lower_non_critical",
+	"lower_critical",
+	"lower_non_recoverable",
+	"upper_non_critical",
+	"upper_critical",
+	"upper_non_recoverable",
+}
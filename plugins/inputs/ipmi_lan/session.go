@@ -0,0 +1,414 @@
+package ipmi_lan
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// RMCP+ payload types, IPMI v2.0 13.27.3.
+const (
+	payloadIPMI        = 0x00
+	payloadOpenRequest = 0x10
+	payloadOpenReply   = 0x11
+	payloadRAKP1       = 0x12
+	payloadRAKP2       = 0x13
+	payloadRAKP3       = 0x14
+	payloadRAKP4       = 0x15
+
+	payloadEncrypted     = 0x80
+	payloadAuthenticated = 0x40
+)
+
+// Network functions and commands.
+const (
+	netFnSensor  = 0x04
+	netFnApp     = 0x06
+	netFnStorage = 0x0a
+
+	cmdGetSensorThresholds    = 0x27
+	cmdGetSensorReading       = 0x2d
+	cmdSetSessionPrivilege    = 0x3b
+	cmdCloseSession           = 0x3c
+	cmdGetSDRRepositoryInfo   = 0x20
+	cmdReserveSDRRepository   = 0x22
+	cmdGetSDR                 = 0x23
+	cmdGetSELInfo             = 0x40
+	completionReservationGone = 0xc5
+)
+
+const (
+	bmcAddress     = 0x20
+	consoleAddress = 0x81
+	// Length of the HMAC-SHA1-96 integrity check values
+	authCodeLength = 12
+)
+
+var rmcpHeader = []byte{0x06, 0x00, 0xff, 0x07}
+
+// completionCode is the error of a command completed with a non zero code.
+type completionCode byte
+
+func (c completionCode) Error() string {
+	return fmt.Sprintf("completion code 0x%02x", byte(c))
+}
+
+// session is a RMCP+ session with a BMC, authenticated with RAKP-HMAC-SHA1,
+// its messages protected with HMAC-SHA1-96 and AES-CBC-128, cipher suite 3.
+type session struct {
+	conn    net.Conn
+	timeout time.Duration
+
+	consoleID uint32
+	bmcID     uint32
+	seq       uint32
+	rqSeq     byte
+	// Integrity and confidentiality keys, nil before the session is active
+	k1, k2 []byte
+}
+
+// openSession establishes a session as username with the BMC at address, at
+// privilege level.
+func openSession(address, username, password string, kg []byte, privilege byte, timeout time.Duration) (*session, error) {
+	if len(username) > 16 {
+		return nil, errors.New("user name longer than 16 characters")
+	}
+	if len(password) > 20 {
+		return nil, errors.New("password longer than 20 characters")
+	}
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{conn: conn, timeout: timeout}
+	if err := s.establish(username, password, kg, privilege); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The sessions start at the user privilege level
+	if privilege > privilegeUser {
+		if _, err := s.command(netFnApp, cmdSetSessionPrivilege, []byte{privilege}); err != nil {
+			s.close()
+			return nil, fmt.Errorf("Set Session Privilege Level: %s", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *session) establish(username, password string, kg []byte, privilege byte) error {
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	s.consoleID = binary.LittleEndian.Uint32(id[:]) | 1
+
+	// Open Session Request, for cipher suite 3
+	req := make([]byte, 32)
+	req[1] = privilege
+	binary.LittleEndian.PutUint32(req[4:], s.consoleID)
+	copy(req[8:], []byte{0x00, 0, 0, 0x08, 0x01, 0, 0, 0})
+	copy(req[16:], []byte{0x01, 0, 0, 0x08, 0x01, 0, 0, 0})
+	copy(req[24:], []byte{0x02, 0, 0, 0x08, 0x01, 0, 0, 0})
+	resp, err := s.exchange(payloadOpenRequest, req, payloadOpenReply)
+	if err != nil {
+		return fmt.Errorf("Open Session: %s", err)
+	}
+	if len(resp) < 12 {
+		return errors.New("Open Session: truncated response")
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("Open Session: %s", rakpStatus(resp[1]))
+	}
+	s.bmcID = binary.LittleEndian.Uint32(resp[8:])
+
+	// RAKP Message 1, the user name looked up without the privilege level
+	rm := make([]byte, 16)
+	if _, err := rand.Read(rm); err != nil {
+		return err
+	}
+	role := 0x10 | privilege
+	rakp1 := make([]byte, 28, 28+len(username))
+	binary.LittleEndian.PutUint32(rakp1[4:], s.bmcID)
+	copy(rakp1[8:], rm)
+	rakp1[24] = role
+	rakp1[27] = byte(len(username))
+	rakp1 = append(rakp1, username...)
+	resp, err = s.exchange(payloadRAKP1, rakp1, payloadRAKP2)
+	if err != nil {
+		return fmt.Errorf("RAKP 1: %s", err)
+	}
+	if len(resp) >= 2 && resp[1] != 0 {
+		return fmt.Errorf("RAKP 2: %s", rakpStatus(resp[1]))
+	}
+	if len(resp) < 60 {
+		return errors.New("RAKP 2: truncated response")
+	}
+	rc, guid := resp[8:24], resp[24:40]
+
+	kuid := make([]byte, 20)
+	copy(kuid, password)
+	if kg == nil {
+		kg = kuid
+	}
+	keys := newRAKPKeys(kuid, kg, s.consoleID, s.bmcID, rm, rc, guid, role, username)
+	if !hmac.Equal(resp[40:60], keys.rakp2) {
+		return errors.New("RAKP 2: invalid key exchange authentication code, wrong password")
+	}
+
+	// RAKP Message 3
+	rakp3 := make([]byte, 8, 28)
+	binary.LittleEndian.PutUint32(rakp3[4:], s.bmcID)
+	rakp3 = append(rakp3, keys.rakp3...)
+	resp, err = s.exchange(payloadRAKP3, rakp3, payloadRAKP4)
+	if err != nil {
+		return fmt.Errorf("RAKP 3: %s", err)
+	}
+	if len(resp) >= 2 && resp[1] != 0 {
+		return fmt.Errorf("RAKP 4: %s", rakpStatus(resp[1]))
+	}
+	if len(resp) < 8+authCodeLength || !hmac.Equal(resp[8:8+authCodeLength], keys.rakp4) {
+		return errors.New("RAKP 4: invalid integrity check value")
+	}
+
+	s.k1, s.k2 = keys.k1, keys.k2
+	return nil
+}
+
+// rakpKeys are the authentication codes of the RAKP messages and the keys
+// of the session, IPMI v2.0 13.31 and 13.32.
+type rakpKeys struct {
+	rakp2, rakp3, rakp4 []byte
+	k1, k2              []byte
+}
+
+func newRAKPKeys(kuid, kg []byte, consoleID, bmcID uint32, rm, rc, guid []byte, role byte, username string) *rakpKeys {
+	var sidm, sidc [4]byte
+	binary.LittleEndian.PutUint32(sidm[:], consoleID)
+	binary.LittleEndian.PutUint32(sidc[:], bmcID)
+	user := append([]byte{role, byte(len(username))}, username...)
+
+	k := &rakpKeys{}
+	k.rakp2 = hmacSHA1(kuid, sidm[:], sidc[:], rm, rc, guid, user)
+	k.rakp3 = hmacSHA1(kuid, rc, sidm[:], user)
+	sik := hmacSHA1(kg, rm, rc, user)
+	k.rakp4 = hmacSHA1(sik, rm, sidc[:], guid)[:authCodeLength]
+	k.k1 = hmacSHA1(sik, bytes.Repeat([]byte{0x01}, 20))
+	k.k2 = hmacSHA1(sik, bytes.Repeat([]byte{0x02}, 20))
+	return k
+}
+
+func hmacSHA1(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func rakpStatus(code byte) string {
+	switch code {
+	case 0x01:
+		return "insufficient resources to create a session"
+	case 0x02:
+		return "invalid session ID"
+	case 0x0d:
+		return "unauthorized name"
+	case 0x09:
+		return "invalid role"
+	case 0x12:
+		return "unauthorized role or privilege level requested"
+	case 0x0f:
+		return "invalid integrity check value"
+	case 0x11:
+		return "no cipher suite match with proposed security algorithms"
+	}
+	return fmt.Sprintf("status code 0x%02x", code)
+}
+
+// exchange sends the payload and returns the first payload of type
+// expected received, resending the payload on timeouts.
+func (s *session) exchange(payloadType byte, payload []byte, expected byte) ([]byte, error) {
+	return s.roundTrip(payloadType, payload, func(t byte, p []byte) bool {
+		return t == expected
+	})
+}
+
+func (s *session) roundTrip(payloadType byte, payload []byte, match func(byte, []byte) bool) ([]byte, error) {
+	buf := make([]byte, 1024)
+	for try := 0; try < 3; try++ {
+		sessionID := uint32(0)
+		if s.k1 != nil {
+			s.seq++
+			sessionID = s.bmcID
+		}
+		packet, err := sealPacket(s.k1, s.k2, sessionID, s.seq, payloadType, payload)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.conn.Write(packet); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(s.timeout)
+		s.conn.SetReadDeadline(deadline)
+		for {
+			n, err := s.conn.Read(buf)
+			if err != nil {
+				if e, ok := err.(net.Error); ok && e.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			t, id, p, err := openPacket(s.k1, s.k2, buf[:n])
+			// Ignore the late or not authenticated replies
+			if err != nil || (s.k1 != nil && id != s.consoleID) {
+				continue
+			}
+			if match(t&0x3f, p) {
+				return p, nil
+			}
+		}
+	}
+	return nil, errors.New("timeout")
+}
+
+// command sends the IPMI request and returns the data of the response.
+func (s *session) command(netFn, cmd byte, data []byte) ([]byte, error) {
+	s.rqSeq = (s.rqSeq + 1) & 0x3f
+	rqSeq := s.rqSeq
+	resp, err := s.roundTrip(payloadIPMI, ipmiRequest(netFn, cmd, rqSeq, data), func(t byte, p []byte) bool {
+		return t == payloadIPMI && len(p) >= 8 && p[4]>>2 == rqSeq && p[5] == cmd
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp[6] != 0 {
+		return nil, completionCode(resp[6])
+	}
+	// Without the trailing checksum
+	return resp[7 : len(resp)-1], nil
+}
+
+func (s *session) close() error {
+	var id [4]byte
+	binary.LittleEndian.PutUint32(id[:], s.bmcID)
+	_, err := s.command(netFnApp, cmdCloseSession, id[:])
+	s.conn.Close()
+	return err
+}
+
+// ipmiRequest returns the IPMI LAN message of the command for the BMC.
+func ipmiRequest(netFn, cmd, rqSeq byte, data []byte) []byte {
+	msg := []byte{bmcAddress, netFn << 2, 0, consoleAddress, rqSeq << 2, cmd}
+	msg[2] = checksum(msg[:2])
+	msg = append(msg, data...)
+	return append(msg, checksum(msg[3:]))
+}
+
+func checksum(b []byte) byte {
+	var c byte
+	for _, v := range b {
+		c += v
+	}
+	return -c
+}
+
+// sealPacket returns the RMCP packet of the payload, authenticated with k1
+// and encrypted with k2 once the session is active.
+func sealPacket(k1, k2 []byte, sessionID, seq uint32, payloadType byte, payload []byte) ([]byte, error) {
+	if k1 != nil {
+		payloadType |= payloadEncrypted | payloadAuthenticated
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(k2[:16])
+		if err != nil {
+			return nil, err
+		}
+		// Padded with 1, 2, 3... followed by the pad length
+		plain := append([]byte{}, payload...)
+		pad := aes.BlockSize - (len(plain)+1)%aes.BlockSize
+		if pad == aes.BlockSize {
+			pad = 0
+		}
+		for i := 1; i <= pad; i++ {
+			plain = append(plain, byte(i))
+		}
+		plain = append(plain, byte(pad))
+		encrypted := make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+		payload = append(iv, encrypted...)
+	}
+
+	packet := append([]byte{}, rmcpHeader...)
+	packet = append(packet, 0x06, payloadType, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(packet[6:], sessionID)
+	binary.LittleEndian.PutUint32(packet[10:], seq)
+	binary.LittleEndian.PutUint16(packet[14:], uint16(len(payload)))
+	packet = append(packet, payload...)
+
+	if k1 != nil {
+		// The integrity pad aligns the authenticated part on 4 bytes
+		pad := (4 - (len(packet)-len(rmcpHeader)+2)%4) % 4
+		for i := 0; i < pad; i++ {
+			packet = append(packet, 0xff)
+		}
+		packet = append(packet, byte(pad), 0x07)
+		packet = append(packet, hmacSHA1(k1, packet[len(rmcpHeader):])[:authCodeLength]...)
+	}
+	return packet, nil
+}
+
+// openPacket returns the payload type, the session ID and the payload of the
+// RMCP packet, verified with k1 and decrypted with k2.
+func openPacket(k1, k2 []byte, b []byte) (byte, uint32, []byte, error) {
+	if len(b) < 16 || !bytes.Equal(b[:4], rmcpHeader) || b[4] != 0x06 {
+		return 0, 0, nil, errors.New("not a RMCP+ packet")
+	}
+	payloadType := b[5]
+	sessionID := binary.LittleEndian.Uint32(b[6:])
+	length := int(binary.LittleEndian.Uint16(b[14:]))
+	if len(b) < 16+length {
+		return 0, 0, nil, errors.New("truncated packet")
+	}
+	payload := b[16 : 16+length]
+
+	if payloadType&payloadAuthenticated != 0 {
+		if k1 == nil || len(b) < 16+length+2+authCodeLength {
+			return 0, 0, nil, errors.New("unexpected authenticated packet")
+		}
+		end := len(b) - authCodeLength
+		if !hmac.Equal(hmacSHA1(k1, b[4:end])[:authCodeLength], b[end:]) {
+			return 0, 0, nil, errors.New("invalid integrity check value")
+		}
+	} else if k1 != nil && payloadType&0x3f == payloadIPMI {
+		return 0, 0, nil, errors.New("unauthenticated packet")
+	}
+
+	if payloadType&payloadEncrypted != 0 {
+		if k2 == nil || len(payload) < 2*aes.BlockSize || len(payload)%aes.BlockSize != 0 {
+			return 0, 0, nil, errors.New("invalid encrypted payload")
+		}
+		block, err := aes.NewCipher(k2[:16])
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		plain := make([]byte, len(payload)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, payload[:aes.BlockSize]).CryptBlocks(plain, payload[aes.BlockSize:])
+		pad := int(plain[len(plain)-1])
+		if pad >= len(plain) {
+			return 0, 0, nil, errors.New("invalid confidentiality pad")
+		}
+		payload = plain[:len(plain)-1-pad]
+	}
+	return payloadType, sessionID, payload, nil
+}
@@ -0,0 +1,363 @@
+package jolokia_bulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// JolokiaBulk reads the attributes of the mbeans matching patterns in a
+// single bulk request to each Jolokia agent.
+type JolokiaBulk struct {
+	URLs     []string `toml:"urls"`
+	Username string
+	Password string
+	Timeout  internal.Duration
+
+	Metrics []Metric `toml:"metric"`
+
+	client *http.Client
+}
+
+// Metric is a measurement read from the mbeans matching Mbean.
+type Metric struct {
+	Name       string
+	Mbean      string
+	Attributes []string
+	// Keys of the ObjectName reported as tags, the others are part of the
+	// field names
+	TagKeys []string `toml:"tag_keys"`
+}
+
+var sampleConfig = `
+  ## Urls of the Jolokia agents, all the metrics are read in one request to
+  ## each of them
+  urls = ["http://localhost:8080/jolokia"]
+  # username = ""
+  # password = ""
+
+  ## Timeout of the requests
+  # timeout = "5s"
+
+  ## The mbean can be a pattern, with * and ? wildcards, matching many
+  ## mbeans. The keys of their ObjectName listed in tag_keys are reported as
+  ## tags. The composite and tabular attributes are flattened into fields
+  ## named after their keys. All the attributes are read if none is given.
+  [[inputs.jolokia_bulk.metric]]
+    name = "java_memory"
+    mbean = "java.lang:type=Memory"
+    attributes = ["HeapMemoryUsage", "NonHeapMemoryUsage"]
+
+  [[inputs.jolokia_bulk.metric]]
+    name = "java_garbage_collector"
+    mbean = "java.lang:type=GarbageCollector,*"
+    attributes = ["CollectionTime", "CollectionCount"]
+    tag_keys = ["name"]
+`
+
+func (j *JolokiaBulk) SampleConfig() string {
+	return sampleConfig
+}
+
+func (j *JolokiaBulk) Description() string {
+	return "Read JMX metrics of mbean patterns through bulk Jolokia requests"
+}
+
+// request is a read request of a Jolokia bulk request.
+type request struct {
+	Type      string                 `json:"type"`
+	Mbean     string                 `json:"mbean"`
+	Attribute []string               `json:"attribute,omitempty"`
+	Config    map[string]interface{} `json:"config,omitempty"`
+}
+
+// response is the response to a request, in the order of the requests.
+type response struct {
+	Status int
+	Error  string
+	Value  interface{}
+}
+
+func isPattern(mbean string) bool {
+	return strings.ContainsAny(mbean, "*?")
+}
+
+func (j *JolokiaBulk) Gather(acc telegraf.Accumulator) error {
+	if j.client == nil {
+		timeout := j.Timeout.Duration
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		j.client = &http.Client{
+			Transport: &http.Transport{ResponseHeaderTimeout: timeout},
+			Timeout:   timeout,
+		}
+	}
+
+	requests := make([]request, len(j.Metrics))
+	for i, m := range j.Metrics {
+		requests[i] = request{Type: "read", Mbean: m.Mbean, Attribute: m.Attributes}
+		if isPattern(m.Mbean) {
+			// Otherwise an attribute of a single matching mbean failing to
+			// be read fails the whole request
+			requests[i].Config = map[string]interface{}{"ignoreErrors": true}
+		}
+	}
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+
+	// Keep asking the other agents when one of them fails and return all
+	// errors as one giant error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errorStrings []string
+	for _, u := range j.URLs {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			if err := j.gatherAgent(u, body, acc); err != nil {
+				mu.Lock()
+				errorStrings = append(errorStrings, err.Error())
+				mu.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+// gatherAgent posts the bulk request body to the agent at u.
+func (j *JolokiaBulk) gatherAgent(u string, body []byte, acc telegraf.Accumulator) error {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if j.Username != "" || j.Password != "" {
+		req.SetBasicAuth(j.Username, j.Password)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Response from url \"%s\" has status code %d (%s), expected %d (%s)",
+			u,
+			resp.StatusCode,
+			http.StatusText(resp.StatusCode),
+			http.StatusOK,
+			http.StatusText(http.StatusOK))
+	}
+
+	var responses []response
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return fmt.Errorf("Unable to decode the response from \"%s\": %s", u, err)
+	}
+	if len(responses) != len(j.Metrics) {
+		return fmt.Errorf("Got %d responses from \"%s\" to %d requests",
+			len(responses), u, len(j.Metrics))
+	}
+	now := time.Now()
+
+	var errorStrings []string
+	for i, m := range j.Metrics {
+		r := responses[i]
+		if r.Status != http.StatusOK {
+			// A pattern may match no mbean, until the application registers
+			// them
+			if r.Status == http.StatusNotFound && isPattern(m.Mbean) {
+				continue
+			}
+			errorStrings = append(errorStrings,
+				fmt.Sprintf("%s: %s: %s", u, m.Mbean, r.Error))
+			continue
+		}
+
+		values := make(map[string]interface{})
+		switch {
+		case isPattern(m.Mbean):
+			// The attributes of each matching mbean, by ObjectName
+			matches, _ := r.Value.(map[string]interface{})
+			for name, attrs := range matches {
+				values[name] = attrs
+			}
+		case len(m.Attributes) == 1:
+			values[m.Mbean] = map[string]interface{}{m.Attributes[0]: r.Value}
+		default:
+			values[m.Mbean] = r.Value
+		}
+		// The mbeans with the same tags are reported as one metric
+		points := make(map[string]*point)
+		for name, attrs := range values {
+			attrs, ok := attrs.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tags, prefix := m.tags(name)
+			tags["jolokia_agent_url"] = u
+			id := tagsID(tags)
+			p, ok := points[id]
+			if !ok {
+				p = &point{tags: tags, fields: make(map[string]interface{})}
+				points[id] = p
+			}
+			for attr, v := range attrs {
+				flatten(p.fields, prefix+attr, v)
+			}
+		}
+		for _, p := range points {
+			if len(p.fields) > 0 {
+				acc.AddFields(m.Name, p.fields, p.tags, now)
+			}
+		}
+	}
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+type point struct {
+	tags   map[string]string
+	fields map[string]interface{}
+}
+
+func tagsID(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var id bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&id, "%s=%s,", k, tags[k])
+	}
+	return id.String()
+}
+
+// tags returns the tags of the ObjectName name, and the prefix of the field
+// names made of its other keys not fixed by the mbean of m.
+func (m *Metric) tags(name string) (map[string]string, string) {
+	tags := make(map[string]string)
+	props := parseProperties(name)
+	fixed := parseProperties(m.Mbean)
+
+	var keys []string
+	for key, value := range props {
+		if containsString(m.TagKeys, key) {
+			tags[key] = value
+		} else if v, ok := fixed[key]; !ok || isPattern(v) {
+			keys = append(keys, key)
+		}
+	}
+	// The keys matched by the pattern but not reported as tags keep the
+	// fields of the matching mbeans apart
+	sort.Strings(keys)
+	var prefix string
+	for _, key := range keys {
+		prefix += key + "_" + props[key] + "_"
+	}
+	return tags, prefix
+}
+
+// parseProperties returns the key properties of the ObjectName name, the
+// values unquoted.
+func parseProperties(name string) map[string]string {
+	props := make(map[string]string)
+	i := strings.Index(name, ":")
+	if i < 0 {
+		return props
+	}
+	for _, prop := range splitProperties(name[i+1:]) {
+		kv := strings.SplitN(prop, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := kv[1]
+		if strings.HasPrefix(value, `"`) {
+			if v, err := strconv.Unquote(value); err == nil {
+				value = v
+			}
+		}
+		props[kv[0]] = value
+	}
+	return props
+}
+
+// splitProperties splits the key properties of an ObjectName on the commas
+// out of quoted values.
+func splitProperties(s string) []string {
+	var props []string
+	var quoted bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				props = append(props, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(props, s[start:])
+}
+
+// flatten adds v to fields, the composite and tabular values as one field
+// per key, named after the path to it.
+func flatten(fields map[string]interface{}, name string, v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, v := range t {
+			flatten(fields, name+"_"+k, v)
+		}
+	case []interface{}:
+		for i, v := range t {
+			flatten(fields, name+"_"+strconv.Itoa(i), v)
+		}
+	case float64, bool, string:
+		fields[name] = t
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	inputs.Add("jolokia_bulk", func() telegraf.Input {
+		return &JolokiaBulk{
+			Timeout: internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package jolokia_bulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bulkResponse = `
+[
+  {
+    "request": {"mbean": "java.lang:type=Memory", "attribute": ["HeapMemoryUsage", "Verbose"], "type": "read"},
+    "value": {
+      "HeapMemoryUsage": {"init": 67108864, "committed": 456130560, "max": 477626368, "used": 203288528},
+      "Verbose": false
+    },
+    "timestamp": 1446129191,
+    "status": 200
+  },
+  {
+    "request": {"mbean": "java.lang:type=GarbageCollector,*", "attribute": ["CollectionCount", "LastGcInfo"], "type": "read"},
+    "value": {
+      "java.lang:name=G1 Young Generation,type=GarbageCollector": {
+        "CollectionCount": 12,
+        "LastGcInfo": {
+          "duration": 5,
+          "memoryUsageAfterGc": {
+            "G1 Eden Space": {"committed": 27262976, "used": 0}
+          }
+        }
+      },
+      "java.lang:name=G1 Old Generation,type=GarbageCollector": {
+        "CollectionCount": 0,
+        "LastGcInfo": null
+      }
+    },
+    "timestamp": 1446129191,
+    "status": 200
+  },
+  {
+    "request": {"mbean": "kafka.server:type=BrokerTopicMetrics,*", "type": "read"},
+    "value": {
+      "kafka.server:name=MessagesInPerSec,topic=orders,type=BrokerTopicMetrics": {"Count": 42},
+      "kafka.server:name=BytesInPerSec,topic=orders,type=BrokerTopicMetrics": {"Count": 4200},
+      "kafka.server:name=MessagesInPerSec,topic=\"my,topic\",type=BrokerTopicMetrics": {"Count": 7}
+    },
+    "timestamp": 1446129191,
+    "status": 200
+  },
+  {
+    "request": {"mbean": "java.lang:type=Threading", "attribute": ["ThreadCount"], "type": "read"},
+    "value": 34,
+    "timestamp": 1446129191,
+    "status": 200
+  },
+  {
+    "request": {"mbean": "com.example:type=Missing", "type": "read"},
+    "error_type": "javax.management.InstanceNotFoundException",
+    "error": "javax.management.InstanceNotFoundException : com.example:type=Missing",
+    "status": 404
+  },
+  {
+    "request": {"mbean": "com.example:type=Cache,*", "type": "read"},
+    "error_type": "javax.management.InstanceNotFoundException",
+    "error": "javax.management.InstanceNotFoundException : com.example:type=Cache,*",
+    "status": 404
+  }
+]`
+
+var metrics = []Metric{
+	{Name: "java_memory", Mbean: "java.lang:type=Memory", Attributes: []string{"HeapMemoryUsage", "Verbose"}},
+	{Name: "java_garbage_collector", Mbean: "java.lang:type=GarbageCollector,*",
+		Attributes: []string{"CollectionCount", "LastGcInfo"}, TagKeys: []string{"name"}},
+	{Name: "kafka_topic", Mbean: "kafka.server:type=BrokerTopicMetrics,*", TagKeys: []string{"topic"}},
+	{Name: "java_threading", Mbean: "java.lang:type=Threading", Attributes: []string{"ThreadCount"}},
+	{Name: "missing", Mbean: "com.example:type=Missing"},
+	{Name: "cache", Mbean: "com.example:type=Cache,*"},
+}
+
+func TestJolokiaBulk(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "POST", r.Method)
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "monitor", user)
+		assert.Equal(t, "secret", password)
+
+		var body []request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, len(metrics), len(body))
+		assert.Equal(t, request{Type: "read", Mbean: "java.lang:type=Memory",
+			Attribute: []string{"HeapMemoryUsage", "Verbose"}}, body[0])
+		assert.Equal(t, true, body[1].Config["ignoreErrors"])
+		assert.Nil(t, body[3].Config)
+
+		fmt.Fprintln(w, bulkResponse)
+	}))
+	defer ts.Close()
+
+	j := &JolokiaBulk{
+		URLs:     []string{ts.URL},
+		Username: "monitor",
+		Password: "secret",
+		Metrics:  metrics,
+	}
+	var acc testutil.Accumulator
+	err := j.Gather(&acc)
+	require.Error(t, err)
+	// Only the mbean, a pattern may match nothing
+	assert.Contains(t, err.Error(), "com.example:type=Missing: javax.management.InstanceNotFoundException")
+	assert.NotContains(t, err.Error(), "type=Cache")
+	assert.Equal(t, 1, requests)
+
+	acc.AssertContainsTaggedFields(t, "java_memory",
+		map[string]interface{}{
+			"HeapMemoryUsage_init":      67108864.0,
+			"HeapMemoryUsage_committed": 456130560.0,
+			"HeapMemoryUsage_max":       477626368.0,
+			"HeapMemoryUsage_used":      203288528.0,
+			"Verbose":                   false,
+		},
+		map[string]string{"jolokia_agent_url": ts.URL})
+	acc.AssertContainsTaggedFields(t, "java_garbage_collector",
+		map[string]interface{}{
+			"CollectionCount":     12.0,
+			"LastGcInfo_duration": 5.0,
+			"LastGcInfo_memoryUsageAfterGc_G1 Eden Space_committed": 27262976.0,
+			"LastGcInfo_memoryUsageAfterGc_G1 Eden Space_used":      0.0,
+		},
+		map[string]string{"jolokia_agent_url": ts.URL, "name": "G1 Young Generation"})
+	acc.AssertContainsTaggedFields(t, "java_garbage_collector",
+		map[string]interface{}{"CollectionCount": 0.0},
+		map[string]string{"jolokia_agent_url": ts.URL, "name": "G1 Old Generation"})
+	// The keys matched by the pattern and not tags are part of the fields
+	// and the mbeans with the same tags one metric
+	acc.AssertContainsTaggedFields(t, "kafka_topic",
+		map[string]interface{}{
+			"name_MessagesInPerSec_Count": 42.0,
+			"name_BytesInPerSec_Count":    4200.0,
+		},
+		map[string]string{"jolokia_agent_url": ts.URL, "topic": "orders"})
+	acc.AssertContainsTaggedFields(t, "kafka_topic",
+		map[string]interface{}{"name_MessagesInPerSec_Count": 7.0},
+		map[string]string{"jolokia_agent_url": ts.URL, "topic": "my,topic"})
+	acc.AssertContainsTaggedFields(t, "java_threading",
+		map[string]interface{}{"ThreadCount": 34.0},
+		map[string]string{"jolokia_agent_url": ts.URL})
+	assert.Equal(t, 6, len(acc.Metrics))
+}
+
+func TestJolokiaBulkAgentDown(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	j := &JolokiaBulk{
+		URLs:    []string{ts.URL, "http://127.0.0.1:1/jolokia"},
+		Metrics: metrics[:1],
+	}
+	var acc testutil.Accumulator
+	err := j.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status code 403")
+	assert.Contains(t, err.Error(), "127.0.0.1:1")
+	assert.Empty(t, acc.Metrics)
+}
+
+func TestParseProperties(t *testing.T) {
+	assert.Equal(t,
+		map[string]string{"type": "Cache", "name": `a "quoted", name`, "scope": "x"},
+		parseProperties(`com.example:type=Cache,name="a \"quoted\", name",scope=x`))
+	assert.Empty(t, parseProperties("not an ObjectName"))
+}
@@ -0,0 +1,168 @@
+package kafka_consumer_lag
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// KafkaConsumerLag reports the lag of the consumer groups of a Kafka
+// cluster, the log end offset minus the committed offset of each partition.
+type KafkaConsumerLag struct {
+	Brokers        []string
+	ConsumerGroups []string `toml:"consumer_groups"`
+	Topics         []string
+	Timeout        internal.Duration
+
+	connect func(brokers []string, timeout time.Duration) (cluster, error)
+	cluster cluster
+}
+
+// cluster is the part of the Kafka protocol the plugin uses.
+type cluster interface {
+	// groups returns the consumer groups known by the brokers.
+	groups() ([]string, error)
+	// partitions returns the partitions of each topic.
+	partitions() (map[string][]int32, error)
+	// endOffsets returns the offset of the next message of the partitions.
+	endOffsets(partitions map[string][]int32) (map[string]map[int32]int64, error)
+	// committedOffsets returns the offsets committed by group for the
+	// partitions, -1 for those it never committed.
+	committedOffsets(group string, partitions map[string][]int32) (map[string]map[int32]int64, error)
+	close() error
+}
+
+var sampleConfig = `
+  ## Brokers of the cluster, the others are discovered from them
+  brokers = ["localhost:9092"]
+
+  ## Consumer groups to report, all of them if empty
+  # consumer_groups = []
+
+  ## Topics to report, all the topics but the internal ones if empty
+  # topics = []
+
+  ## Timeout of the connections and requests to the brokers
+  # timeout = "5s"
+`
+
+func (k *KafkaConsumerLag) SampleConfig() string {
+	return sampleConfig
+}
+
+func (k *KafkaConsumerLag) Description() string {
+	return "Read the lag of the consumer groups of a Kafka cluster per partition"
+}
+
+func (k *KafkaConsumerLag) Gather(acc telegraf.Accumulator) error {
+	if k.cluster == nil {
+		timeout := k.Timeout.Duration
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		c, err := k.connect(k.Brokers, timeout)
+		if err != nil {
+			return err
+		}
+		k.cluster = c
+	}
+	err := k.gather(acc)
+	if err != nil {
+		// Reconnect at the next gather, the brokers may have changed
+		k.cluster.close()
+		k.cluster = nil
+	}
+	return err
+}
+
+func (k *KafkaConsumerLag) gather(acc telegraf.Accumulator) error {
+	groups := k.ConsumerGroups
+	if len(groups) == 0 {
+		var err error
+		if groups, err = k.cluster.groups(); err != nil {
+			return err
+		}
+	}
+
+	partitions, err := k.cluster.partitions()
+	if err != nil {
+		return err
+	}
+	if len(k.Topics) > 0 {
+		wanted := make(map[string][]int32)
+		for _, topic := range k.Topics {
+			if p, ok := partitions[topic]; ok {
+				wanted[topic] = p
+			}
+		}
+		partitions = wanted
+	} else {
+		for topic := range partitions {
+			// __consumer_offsets and the other internal topics
+			if strings.HasPrefix(topic, "__") {
+				delete(partitions, topic)
+			}
+		}
+	}
+
+	// The end offsets are read first, a consumer can't commit an offset
+	// beyond them and the lag stays positive
+	ends, err := k.cluster.endOffsets(partitions)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	// Keep looking when one of them fails and return all errors as one
+	// giant error
+	var errorStrings []string
+	for _, group := range groups {
+		committed, err := k.cluster.committedOffsets(group, partitions)
+		if err != nil {
+			errorStrings = append(errorStrings, group+": "+err.Error())
+			continue
+		}
+		for topic, offsets := range committed {
+			for partition, offset := range offsets {
+				end, ok := ends[topic][partition]
+				if offset < 0 || !ok {
+					continue
+				}
+				lag := end - offset
+				if lag < 0 {
+					lag = 0
+				}
+				tags := map[string]string{
+					"group":     group,
+					"topic":     topic,
+					"partition": strconv.Itoa(int(partition)),
+				}
+				fields := map[string]interface{}{
+					"lag":              lag,
+					"committed_offset": offset,
+					"log_end_offset":   end,
+				}
+				acc.AddFields("kafka_consumer_lag", fields, tags, now)
+			}
+		}
+	}
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+func init() {
+	inputs.Add("kafka_consumer_lag", func() telegraf.Input {
+		return &KafkaConsumerLag{
+			Timeout: internal.Duration{Duration: 5 * time.Second},
+			connect: connectSarama,
+		}
+	})
+}
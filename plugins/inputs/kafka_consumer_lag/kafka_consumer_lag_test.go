@@ -0,0 +1,150 @@
+package kafka_consumer_lag
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCluster is a cluster with fixed offsets.
+type fakeCluster struct {
+	groupList []string
+	topics    map[string][]int32
+	ends      map[string]map[int32]int64
+	committed map[string]map[string]map[int32]int64
+	closed    bool
+}
+
+func (f *fakeCluster) groups() ([]string, error) {
+	return f.groupList, nil
+}
+
+func (f *fakeCluster) partitions() (map[string][]int32, error) {
+	partitions := make(map[string][]int32)
+	for topic, p := range f.topics {
+		partitions[topic] = p
+	}
+	return partitions, nil
+}
+
+func (f *fakeCluster) endOffsets(partitions map[string][]int32) (map[string]map[int32]int64, error) {
+	ends := make(map[string]map[int32]int64)
+	for topic := range partitions {
+		ends[topic] = f.ends[topic]
+	}
+	return ends, nil
+}
+
+func (f *fakeCluster) committedOffsets(group string, partitions map[string][]int32) (map[string]map[int32]int64, error) {
+	offsets, ok := f.committed[group]
+	if !ok {
+		return nil, errors.New("NOT_COORDINATOR_FOR_GROUP")
+	}
+	committed := make(map[string]map[int32]int64)
+	for topic, ps := range partitions {
+		committed[topic] = make(map[int32]int64)
+		for _, p := range ps {
+			if o, ok := offsets[topic][p]; ok {
+				committed[topic][p] = o
+			} else {
+				committed[topic][p] = -1
+			}
+		}
+	}
+	return committed, nil
+}
+
+func (f *fakeCluster) close() error {
+	f.closed = true
+	return nil
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		groupList: []string{"billing", "audit"},
+		topics: map[string][]int32{
+			"orders":             {0, 1},
+			"payments":           {0},
+			"__consumer_offsets": {0},
+		},
+		ends: map[string]map[int32]int64{
+			"orders":             {0: 1500, 1: 700},
+			"payments":           {0: 42},
+			"__consumer_offsets": {0: 9000},
+		},
+		committed: map[string]map[string]map[int32]int64{
+			"billing": {
+				"orders":             {0: 1200, 1: 700},
+				"__consumer_offsets": {0: 10},
+			},
+			"audit": {
+				// Committed after the end offsets were read
+				"payments": {0: 50},
+			},
+		},
+	}
+}
+
+func TestKafkaConsumerLag(t *testing.T) {
+	f := newFakeCluster()
+	k := &KafkaConsumerLag{
+		Brokers: []string{"kafka-1:9092"},
+		connect: func(brokers []string, timeout time.Duration) (cluster, error) {
+			assert.Equal(t, []string{"kafka-1:9092"}, brokers)
+			assert.Equal(t, 5*time.Second, timeout)
+			return f, nil
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, k.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "kafka_consumer_lag",
+		map[string]interface{}{
+			"lag":              int64(300),
+			"committed_offset": int64(1200),
+			"log_end_offset":   int64(1500),
+		},
+		map[string]string{"group": "billing", "topic": "orders", "partition": "0"})
+	acc.AssertContainsTaggedFields(t, "kafka_consumer_lag",
+		map[string]interface{}{
+			"lag":              int64(0),
+			"committed_offset": int64(700),
+			"log_end_offset":   int64(700),
+		},
+		map[string]string{"group": "billing", "topic": "orders", "partition": "1"})
+	acc.AssertContainsTaggedFields(t, "kafka_consumer_lag",
+		map[string]interface{}{
+			"lag":              int64(0),
+			"committed_offset": int64(50),
+			"log_end_offset":   int64(42),
+		},
+		map[string]string{"group": "audit", "topic": "payments", "partition": "0"})
+	// Neither the internal topics nor the partitions without commits
+	assert.Equal(t, 3, len(acc.Metrics))
+}
+
+func TestKafkaConsumerLagFilters(t *testing.T) {
+	f := newFakeCluster()
+	k := &KafkaConsumerLag{
+		ConsumerGroups: []string{"billing", "gone"},
+		Topics:         []string{"orders", "missing"},
+		cluster:        f,
+	}
+	var acc testutil.Accumulator
+	err := k.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gone: NOT_COORDINATOR_FOR_GROUP")
+	assert.Equal(t, 2, len(acc.Metrics))
+	for _, m := range acc.Metrics {
+		assert.Equal(t, "billing", m.Tags["group"])
+		assert.Equal(t, "orders", m.Tags["topic"])
+	}
+
+	// The connection is closed on errors, to reconnect at the next gather
+	assert.True(t, f.closed)
+	assert.Nil(t, k.cluster)
+}
@@ -0,0 +1,167 @@
+package kafka_consumer_lag
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// saramaCluster is a cluster reached through a sarama client.
+type saramaCluster struct {
+	client sarama.Client
+}
+
+func connectSarama(brokers []string, timeout time.Duration) (cluster, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "telegraf"
+	config.Net.DialTimeout = timeout
+	config.Net.ReadTimeout = timeout
+	config.Net.WriteTimeout = timeout
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to the kafka brokers %v: %s", brokers, err)
+	}
+	return &saramaCluster{client: client}, nil
+}
+
+// broker returns b, connected.
+func (s *saramaCluster) broker(b *sarama.Broker) (*sarama.Broker, error) {
+	if ok, _ := b.Connected(); ok {
+		return b, nil
+	}
+	if err := b.Open(s.client.Config()); err != nil && err != sarama.ErrAlreadyConnected {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *saramaCluster) groups() ([]string, error) {
+	// Each broker only lists the groups it coordinates
+	var groups []string
+	for _, b := range s.client.Brokers() {
+		b, err := s.broker(b)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := b.ListGroups(&sarama.ListGroupsRequest{})
+		if err != nil {
+			return nil, fmt.Errorf("broker %s: ListGroups: %s", b.Addr(), err)
+		}
+		if resp.Err != sarama.ErrNoError {
+			return nil, fmt.Errorf("broker %s: ListGroups: %s", b.Addr(), resp.Err)
+		}
+		for group, protocolType := range resp.Groups {
+			// The groups only committing offsets have no protocol type
+			if protocolType == "consumer" || protocolType == "" {
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups, nil
+}
+
+func (s *saramaCluster) partitions() (map[string][]int32, error) {
+	if err := s.client.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+	topics, err := s.client.Topics()
+	if err != nil {
+		return nil, err
+	}
+	partitions := make(map[string][]int32)
+	for _, topic := range topics {
+		p, err := s.client.Partitions(topic)
+		if err != nil {
+			return nil, err
+		}
+		partitions[topic] = p
+	}
+	return partitions, nil
+}
+
+func (s *saramaCluster) endOffsets(partitions map[string][]int32) (map[string]map[int32]int64, error) {
+	// One request to the leader of each partition
+	requests := make(map[*sarama.Broker]*sarama.OffsetRequest)
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			leader, err := s.client.Leader(topic, p)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%d: %s", topic, p, err)
+			}
+			req, ok := requests[leader]
+			if !ok {
+				req = &sarama.OffsetRequest{}
+				requests[leader] = req
+			}
+			req.AddBlock(topic, p, sarama.OffsetNewest, 1)
+		}
+	}
+
+	ends := make(map[string]map[int32]int64)
+	for leader, req := range requests {
+		b, err := s.broker(leader)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := b.GetAvailableOffsets(req)
+		if err != nil {
+			return nil, fmt.Errorf("broker %s: Offsets: %s", b.Addr(), err)
+		}
+		for topic, ps := range partitions {
+			for _, p := range ps {
+				block := resp.GetBlock(topic, p)
+				if block == nil || block.Err != sarama.ErrNoError || len(block.Offsets) == 0 {
+					continue
+				}
+				if ends[topic] == nil {
+					ends[topic] = make(map[int32]int64)
+				}
+				ends[topic][p] = block.Offsets[0]
+			}
+		}
+	}
+	return ends, nil
+}
+
+func (s *saramaCluster) committedOffsets(group string, partitions map[string][]int32) (map[string]map[int32]int64, error) {
+	coordinator, err := s.client.Coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+	coordinator, err = s.broker(coordinator)
+	if err != nil {
+		return nil, err
+	}
+
+	// Version 1 reads the offsets committed to Kafka, not to Zookeeper
+	req := &sarama.OffsetFetchRequest{ConsumerGroup: group, Version: 1}
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			req.AddPartition(topic, p)
+		}
+	}
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		return nil, fmt.Errorf("broker %s: OffsetFetch: %s", coordinator.Addr(), err)
+	}
+
+	committed := make(map[string]map[int32]int64)
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			block := resp.GetBlock(topic, p)
+			if block == nil || block.Err != sarama.ErrNoError {
+				continue
+			}
+			if committed[topic] == nil {
+				committed[topic] = make(map[int32]int64)
+			}
+			committed[topic][p] = block.Offset
+		}
+	}
+	return committed, nil
+}
+
+func (s *saramaCluster) close() error {
+	return s.client.Close()
+}
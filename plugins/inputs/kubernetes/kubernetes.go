@@ -0,0 +1,330 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// Port of the authenticated API of the kubelet.
+const kubeletPort = "10250"
+
+// Kubernetes reads the resource usage of the node, pods and containers
+// from the summary API of a kubelet.
+type Kubernetes struct {
+	// Kubelet, defaults to the kubelet of the node of the agent pod
+	URL string `toml:"url"`
+
+	// Bearer token file path, defaults to the pod service account token
+	BearerToken string `toml:"bearer_token"`
+	// Path to CA file, defaults to the pod service account CA
+	TLSCA string `toml:"tls_ca"`
+	// Use TLS but skip chain & host verification
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
+
+	ResponseTimeout internal.Duration `toml:"response_timeout"`
+
+	client *http.Client
+}
+
+var sampleConfig = `
+  ## URL of the kubelet, e.g. "https://10.0.0.1:10250". When empty, the
+  ## kubelet of the node the agent runs on is used, found through the NODE_IP
+  ## or NODE_NAME environment variable set from the downward API, and the
+  ## pod service account token and CA authenticate the requests.
+  # url = ""
+
+  ## Bearer token file path
+  # bearer_token = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+  ## Optional TLS Config
+  # tls_ca = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+  ## Use TLS but skip chain & host verification, for kubelets serving
+  ## self-signed certificates
+  # insecure_skip_verify = false
+
+  ## HTTP response timeout
+  # response_timeout = "5s"
+`
+
+func (k *Kubernetes) SampleConfig() string {
+	return sampleConfig
+}
+
+func (k *Kubernetes) Description() string {
+	return "Read the node, pod and container metrics of the kubelet summary API"
+}
+
+// summary is the document of the /stats/summary endpoint of the kubelet.
+type summary struct {
+	Node struct {
+		NodeName string        `json:"nodeName"`
+		CPU      *cpuStats     `json:"cpu"`
+		Memory   *memoryStats  `json:"memory"`
+		Network  *networkStats `json:"network"`
+		Fs       *fsStats      `json:"fs"`
+		Runtime  struct {
+			ImageFs *fsStats `json:"imageFs"`
+		} `json:"runtime"`
+	} `json:"node"`
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name   string       `json:"name"`
+			CPU    *cpuStats    `json:"cpu"`
+			Memory *memoryStats `json:"memory"`
+			Rootfs *fsStats     `json:"rootfs"`
+			Logs   *fsStats     `json:"logs"`
+		} `json:"containers"`
+		Network *networkStats `json:"network"`
+		Volumes []struct {
+			Name string `json:"name"`
+			fsStats
+		} `json:"volume"`
+		EphemeralStorage *fsStats `json:"ephemeral-storage"`
+	} `json:"pods"`
+}
+
+type cpuStats struct {
+	UsageNanoCores       *uint64 `json:"usageNanoCores"`
+	UsageCoreNanoSeconds *uint64 `json:"usageCoreNanoSeconds"`
+}
+
+type memoryStats struct {
+	AvailableBytes  *uint64 `json:"availableBytes"`
+	UsageBytes      *uint64 `json:"usageBytes"`
+	WorkingSetBytes *uint64 `json:"workingSetBytes"`
+	RSSBytes        *uint64 `json:"rssBytes"`
+	PageFaults      *uint64 `json:"pageFaults"`
+	MajorPageFaults *uint64 `json:"majorPageFaults"`
+}
+
+type networkStats struct {
+	RxBytes  *uint64 `json:"rxBytes"`
+	RxErrors *uint64 `json:"rxErrors"`
+	TxBytes  *uint64 `json:"txBytes"`
+	TxErrors *uint64 `json:"txErrors"`
+}
+
+type fsStats struct {
+	AvailableBytes *uint64 `json:"availableBytes"`
+	CapacityBytes  *uint64 `json:"capacityBytes"`
+	UsedBytes      *uint64 `json:"usedBytes"`
+}
+
+// addFields adds the non nil values to fields, prefixed with prefix.
+func addFields(fields map[string]interface{}, prefix string, values map[string]*uint64) {
+	for name, v := range values {
+		if v != nil {
+			fields[prefix+name] = *v
+		}
+	}
+}
+
+func (c *cpuStats) add(fields map[string]interface{}, prefix string) {
+	if c == nil {
+		return
+	}
+	addFields(fields, prefix, map[string]*uint64{
+		"usage_nanocores":        c.UsageNanoCores,
+		"usage_core_nanoseconds": c.UsageCoreNanoSeconds,
+	})
+}
+
+func (m *memoryStats) add(fields map[string]interface{}, prefix string) {
+	if m == nil {
+		return
+	}
+	addFields(fields, prefix, map[string]*uint64{
+		"available_bytes":   m.AvailableBytes,
+		"usage_bytes":       m.UsageBytes,
+		"working_set_bytes": m.WorkingSetBytes,
+		"rss_bytes":         m.RSSBytes,
+		"page_faults":       m.PageFaults,
+		"major_page_faults": m.MajorPageFaults,
+	})
+}
+
+func (n *networkStats) add(fields map[string]interface{}, prefix string) {
+	if n == nil {
+		return
+	}
+	addFields(fields, prefix, map[string]*uint64{
+		"rx_bytes":  n.RxBytes,
+		"rx_errors": n.RxErrors,
+		"tx_bytes":  n.TxBytes,
+		"tx_errors": n.TxErrors,
+	})
+}
+
+func (f *fsStats) add(fields map[string]interface{}, prefix string) {
+	if f == nil {
+		return
+	}
+	addFields(fields, prefix, map[string]*uint64{
+		"available_bytes": f.AvailableBytes,
+		"capacity_bytes":  f.CapacityBytes,
+		"used_bytes":      f.UsedBytes,
+	})
+}
+
+func (k *Kubernetes) Gather(acc telegraf.Accumulator) error {
+	inCluster := k.URL == ""
+	if k.client == nil {
+		ca := k.TLSCA
+		if ca == "" && inCluster {
+			ca = serviceAccountDir + "ca.crt"
+		}
+		tlsCfg, err := internal.GetTLSConfig("", "", ca, k.InsecureSkipVerify)
+		if err != nil {
+			return err
+		}
+		timeout := k.ResponseTimeout.Duration
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		k.client = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsCfg},
+			Timeout:   timeout,
+		}
+	}
+
+	kubelet, err := k.kubeletURL()
+	if err != nil {
+		return err
+	}
+	addr := kubelet + "/stats/summary"
+	req, err := http.NewRequest("GET", addr, nil)
+	if err != nil {
+		return err
+	}
+
+	token := k.BearerToken
+	if token == "" && inCluster {
+		token = serviceAccountDir + "token"
+	}
+	if token != "" {
+		t, err := ioutil.ReadFile(token)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization",
+			"Bearer "+strings.TrimSpace(string(t)))
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making HTTP request to %s: %s", addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP status %s", addr, resp.Status)
+	}
+
+	var s summary
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return fmt.Errorf("Could not decode the kubelet summary: %s", err)
+	}
+	k.addSummary(acc, &s, time.Now())
+	return nil
+}
+
+// kubeletURL returns the url of the kubelet to read.
+func (k *Kubernetes) kubeletURL() (string, error) {
+	if k.URL != "" {
+		return strings.TrimSuffix(k.URL, "/"), nil
+	}
+	// The downward API exposes the node of a pod through the status.hostIP
+	// and spec.nodeName fields
+	for _, env := range []string{"NODE_IP", "NODE_NAME"} {
+		if node := os.Getenv(env); node != "" {
+			return "https://" + net.JoinHostPort(node, kubeletPort), nil
+		}
+	}
+	return "", fmt.Errorf("kubernetes url is not set and neither NODE_IP " +
+		"nor NODE_NAME is set from the downward API")
+}
+
+func (k *Kubernetes) addSummary(acc telegraf.Accumulator, s *summary, now time.Time) {
+	node := s.Node.NodeName
+
+	fields := make(map[string]interface{})
+	s.Node.CPU.add(fields, "cpu_")
+	s.Node.Memory.add(fields, "memory_")
+	s.Node.Network.add(fields, "network_")
+	s.Node.Fs.add(fields, "fs_")
+	s.Node.Runtime.ImageFs.add(fields, "runtime_image_fs_")
+	if len(fields) > 0 {
+		acc.AddFields("kubernetes_node", fields,
+			map[string]string{"node_name": node}, now)
+	}
+
+	for _, pod := range s.Pods {
+		podTags := func() map[string]string {
+			return map[string]string{
+				"node_name": node,
+				"namespace": pod.PodRef.Namespace,
+				"pod_name":  pod.PodRef.Name,
+			}
+		}
+
+		for _, c := range pod.Containers {
+			fields := make(map[string]interface{})
+			c.CPU.add(fields, "cpu_")
+			c.Memory.add(fields, "memory_")
+			c.Rootfs.add(fields, "rootfs_")
+			c.Logs.add(fields, "logsfs_")
+			if len(fields) == 0 {
+				continue
+			}
+			tags := podTags()
+			tags["container_name"] = c.Name
+			acc.AddFields("kubernetes_pod_container", fields, tags, now)
+		}
+
+		fields := make(map[string]interface{})
+		pod.Network.add(fields, "")
+		if len(fields) > 0 {
+			acc.AddFields("kubernetes_pod_network", fields, podTags(), now)
+		}
+
+		fields = make(map[string]interface{})
+		pod.EphemeralStorage.add(fields, "ephemeral_storage_")
+		if len(fields) > 0 {
+			acc.AddFields("kubernetes_pod", fields, podTags(), now)
+		}
+
+		for _, v := range pod.Volumes {
+			fields := make(map[string]interface{})
+			v.fsStats.add(fields, "")
+			if len(fields) == 0 {
+				continue
+			}
+			tags := podTags()
+			tags["volume_name"] = v.Name
+			acc.AddFields("kubernetes_pod_volume", fields, tags, now)
+		}
+	}
+}
+
+func init() {
+	inputs.Add("kubernetes", func() telegraf.Input {
+		return &Kubernetes{
+			ResponseTimeout: internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleSummary = `{
+  "node": {
+    "nodeName": "node-1",
+    "cpu": {"time": "2018-01-16T10:00:00Z", "usageNanoCores": 560000000, "usageCoreNanoSeconds": 900000000000},
+    "memory": {
+      "time": "2018-01-16T10:00:00Z", "availableBytes": 4000000000,
+      "usageBytes": 3000000000, "workingSetBytes": 2000000000,
+      "rssBytes": 1000000000, "pageFaults": 1000, "majorPageFaults": 10
+    },
+    "network": {"time": "2018-01-16T10:00:00Z", "rxBytes": 5000, "rxErrors": 0, "txBytes": 6000, "txErrors": 1},
+    "fs": {"availableBytes": 80000000000, "capacityBytes": 100000000000, "usedBytes": 20000000000},
+    "runtime": {
+      "imageFs": {"availableBytes": 80000000000, "capacityBytes": 100000000000, "usedBytes": 5000000000}
+    }
+  },
+  "pods": [
+    {
+      "podRef": {"name": "api-1", "namespace": "prod", "uid": "b0d4"},
+      "containers": [
+        {
+          "name": "api",
+          "cpu": {"usageNanoCores": 120000000, "usageCoreNanoSeconds": 30000000000},
+          "memory": {"usageBytes": 200000000, "workingSetBytes": 150000000, "rssBytes": 100000000},
+          "rootfs": {"availableBytes": 80000000000, "capacityBytes": 100000000000, "usedBytes": 40000},
+          "logs": {"availableBytes": 80000000000, "capacityBytes": 100000000000, "usedBytes": 20000}
+        },
+        {"name": "starting"}
+      ],
+      "network": {"rxBytes": 1000, "rxErrors": 0, "txBytes": 2000, "txErrors": 0},
+      "volume": [
+        {"name": "data", "availableBytes": 900, "capacityBytes": 1000, "usedBytes": 100}
+      ],
+      "ephemeral-storage": {"availableBytes": 80000000000, "capacityBytes": 100000000000, "usedBytes": 60000}
+    }
+  ]
+}`
+
+func TestKubernetesGeneratesMetrics(t *testing.T) {
+	token, err := ioutil.TempFile("", "token")
+	require.NoError(t, err)
+	defer os.Remove(token.Name())
+	fmt.Fprintln(token, "secret")
+	token.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats/summary" ||
+			r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprintln(w, sampleSummary)
+	}))
+	defer ts.Close()
+
+	k := &Kubernetes{
+		URL:         ts.URL + "/",
+		BearerToken: token.Name(),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, k.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "kubernetes_node",
+		map[string]interface{}{
+			"cpu_usage_nanocores":              uint64(560000000),
+			"cpu_usage_core_nanoseconds":       uint64(900000000000),
+			"memory_available_bytes":           uint64(4000000000),
+			"memory_usage_bytes":               uint64(3000000000),
+			"memory_working_set_bytes":         uint64(2000000000),
+			"memory_rss_bytes":                 uint64(1000000000),
+			"memory_page_faults":               uint64(1000),
+			"memory_major_page_faults":         uint64(10),
+			"network_rx_bytes":                 uint64(5000),
+			"network_rx_errors":                uint64(0),
+			"network_tx_bytes":                 uint64(6000),
+			"network_tx_errors":                uint64(1),
+			"fs_available_bytes":               uint64(80000000000),
+			"fs_capacity_bytes":                uint64(100000000000),
+			"fs_used_bytes":                    uint64(20000000000),
+			"runtime_image_fs_available_bytes": uint64(80000000000),
+			"runtime_image_fs_capacity_bytes":  uint64(100000000000),
+			"runtime_image_fs_used_bytes":      uint64(5000000000),
+		},
+		map[string]string{"node_name": "node-1"})
+
+	podTags := map[string]string{
+		"node_name": "node-1",
+		"namespace": "prod",
+		"pod_name":  "api-1",
+	}
+	// Missing stats are not reported as zero
+	acc.AssertContainsTaggedFields(t, "kubernetes_pod_container",
+		map[string]interface{}{
+			"cpu_usage_nanocores":        uint64(120000000),
+			"cpu_usage_core_nanoseconds": uint64(30000000000),
+			"memory_usage_bytes":         uint64(200000000),
+			"memory_working_set_bytes":   uint64(150000000),
+			"memory_rss_bytes":           uint64(100000000),
+			"rootfs_available_bytes":     uint64(80000000000),
+			"rootfs_capacity_bytes":      uint64(100000000000),
+			"rootfs_used_bytes":          uint64(40000),
+			"logsfs_available_bytes":     uint64(80000000000),
+			"logsfs_capacity_bytes":      uint64(100000000000),
+			"logsfs_used_bytes":          uint64(20000),
+		},
+		map[string]string{
+			"node_name":      "node-1",
+			"namespace":      "prod",
+			"pod_name":       "api-1",
+			"container_name": "api",
+		})
+	acc.AssertContainsTaggedFields(t, "kubernetes_pod_network",
+		map[string]interface{}{
+			"rx_bytes":  uint64(1000),
+			"rx_errors": uint64(0),
+			"tx_bytes":  uint64(2000),
+			"tx_errors": uint64(0),
+		}, podTags)
+	acc.AssertContainsTaggedFields(t, "kubernetes_pod",
+		map[string]interface{}{
+			"ephemeral_storage_available_bytes": uint64(80000000000),
+			"ephemeral_storage_capacity_bytes":  uint64(100000000000),
+			"ephemeral_storage_used_bytes":      uint64(60000),
+		}, podTags)
+	acc.AssertContainsTaggedFields(t, "kubernetes_pod_volume",
+		map[string]interface{}{
+			"available_bytes": uint64(900),
+			"capacity_bytes":  uint64(1000),
+			"used_bytes":      uint64(100),
+		},
+		map[string]string{
+			"node_name":   "node-1",
+			"namespace":   "prod",
+			"pod_name":    "api-1",
+			"volume_name": "data",
+		})
+	// The container without stats yet is skipped
+	assert.Equal(t, 5, len(acc.Metrics))
+
+	k = &Kubernetes{URL: ts.URL}
+	assert.Error(t, k.Gather(&acc))
+}
+
+func TestKubeletURL(t *testing.T) {
+	defer os.Setenv("NODE_IP", os.Getenv("NODE_IP"))
+	defer os.Setenv("NODE_NAME", os.Getenv("NODE_NAME"))
+	os.Setenv("NODE_IP", "")
+	os.Setenv("NODE_NAME", "")
+
+	k := &Kubernetes{}
+	_, err := k.kubeletURL()
+	assert.Error(t, err)
+
+	os.Setenv("NODE_NAME", "node-1")
+	u, err := k.kubeletURL()
+	require.NoError(t, err)
+	assert.Equal(t, "https://node-1:10250", u)
+
+	// The node IP doesn't depend on the resolution of the node name
+	os.Setenv("NODE_IP", "10.0.0.1")
+	u, err = k.kubeletURL()
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:10250", u)
+}
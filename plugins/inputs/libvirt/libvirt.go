@@ -0,0 +1,299 @@
+package libvirt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// Libvirt reports the statistics of the domains of libvirtd, from virsh
+// domstats.
+type Libvirt struct {
+	URIs    []string `toml:"uris"`
+	Domains []string
+	Path    string
+	UseSudo bool `toml:"use_sudo"`
+	Timeout internal.Duration
+
+	run func(timeout time.Duration, command string, args ...string) ([]byte, error)
+}
+
+var sampleConfig = `
+  ## Connection URIs of libvirtd, as for virsh -c
+  uris = ["qemu:///system"]
+
+  ## Names of the domains to report, all of them if empty
+  # domains = []
+
+  ## Path of virsh, looked up in PATH if empty
+  # path = ""
+  ## Run virsh with sudo, which must not ask for a password, when the agent
+  ## can't connect to libvirtd
+  # use_sudo = false
+
+  ## Timeout of virsh
+  # timeout = "5s"
+`
+
+func (l *Libvirt) SampleConfig() string {
+	return sampleConfig
+}
+
+func (l *Libvirt) Description() string {
+	return "Read the vCPU, memory, block device and network statistics of libvirt domains"
+}
+
+// The groups of statistics read from virsh domstats.
+var statGroups = []string{"--state", "--cpu-total", "--balloon", "--vcpu", "--interface", "--block"}
+
+func (l *Libvirt) Gather(acc telegraf.Accumulator) error {
+	uris := l.URIs
+	if len(uris) == 0 {
+		uris = []string{"qemu:///system"}
+	}
+
+	// Keep gathering the other connections when one of them fails and return
+	// all errors as one giant error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errorStrings []string
+	for _, uri := range uris {
+		wg.Add(1)
+		go func(uri string) {
+			defer wg.Done()
+			if err := l.gatherURI(uri, acc); err != nil {
+				mu.Lock()
+				errorStrings = append(errorStrings, err.Error())
+				mu.Unlock()
+			}
+		}(uri)
+	}
+	wg.Wait()
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+func (l *Libvirt) gatherURI(uri string, acc telegraf.Accumulator) error {
+	// domstats doesn't report the UUIDs
+	out, err := l.virsh(uri, "list", "--all", "--uuid", "--name")
+	if err != nil {
+		return err
+	}
+	uuids := parseList(out)
+
+	args := append([]string{"domstats", "--raw"}, statGroups...)
+	out, err = l.virsh(uri, append(args, l.Domains...)...)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, d := range parseDomstats(out) {
+		tags := map[string]string{
+			"uri":    uri,
+			"domain": d.name,
+		}
+		if uuid := uuids[d.name]; uuid != "" {
+			tags["uuid"] = uuid
+		}
+		d.gather(tags, now, acc)
+	}
+	return nil
+}
+
+// virsh runs virsh connected to uri with args and returns its output.
+func (l *Libvirt) virsh(uri string, args ...string) ([]byte, error) {
+	timeout := l.Timeout.Duration
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	path := l.Path
+	if path == "" {
+		var err error
+		if path, err = exec.LookPath("virsh"); err != nil {
+			return nil, err
+		}
+	}
+	args = append([]string{"-c", uri, "-q"}, args...)
+	if l.UseSudo {
+		args = append([]string{"-n", path}, args...)
+		path = "sudo"
+	}
+	return l.run(timeout, path, args...)
+}
+
+// parseList returns the UUIDs of the domains by name, from the output of
+// virsh list --uuid --name.
+func parseList(out []byte) map[string]string {
+	uuids := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// The names may have spaces
+		line = strings.TrimSpace(line)
+		uuids[strings.TrimSpace(line[len(fields[0]):])] = fields[0]
+	}
+	return uuids
+}
+
+// domain is a domain and its statistics, by name, as "block.0.rd.bytes".
+type domain struct {
+	name  string
+	stats map[string]string
+}
+
+// parseDomstats returns the domains of the output of virsh domstats:
+//
+//	Domain: 'vm1'
+//	  state.state=1
+//	  cpu.time=2846474576
+func parseDomstats(out []byte) []*domain {
+	var domains []*domain
+	var d *domain
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Domain: ") {
+			d = &domain{
+				name:  strings.Trim(line[len("Domain: "):], "'"),
+				stats: make(map[string]string),
+			}
+			domains = append(domains, d)
+			continue
+		}
+		i := strings.Index(line, "=")
+		if d == nil || i < 0 {
+			continue
+		}
+		d.stats[line[:i]] = line[i+1:]
+	}
+	return domains
+}
+
+// device is a vCPU, block device or interface of a domain.
+type device struct {
+	name   string
+	fields map[string]interface{}
+}
+
+func (d *domain) gather(tags map[string]string, now time.Time, acc telegraf.Accumulator) {
+	fields := make(map[string]interface{})
+	// The vCPUs, block devices and interfaces, by group and index
+	devices := map[string]map[string]*device{
+		"vcpu":  make(map[string]*device),
+		"block": make(map[string]*device),
+		"net":   make(map[string]*device),
+	}
+
+	for key, s := range d.stats {
+		parts := strings.Split(key, ".")
+		if len(parts) < 2 {
+			continue
+		}
+		group := devices[parts[0]]
+		if group != nil && len(parts) > 2 {
+			dev := group[parts[1]]
+			if dev == nil {
+				dev = &device{name: parts[1], fields: make(map[string]interface{})}
+				group[parts[1]] = dev
+			}
+			field := strings.Join(parts[2:], "_")
+			if field == "name" {
+				dev.name = s
+			} else if v, ok := parseValue(s); ok {
+				dev.fields[field] = v
+			}
+			continue
+		}
+
+		var field string
+		switch {
+		case key == "state.state":
+			field = "state"
+		case key == "state.reason":
+			field = "state_reason"
+		case parts[0] == "cpu" || parts[0] == "balloon" || parts[0] == "vcpu":
+			field = strings.Replace(strings.Join(parts, "_"), "-", "_", -1)
+		default:
+			// The counts of the block devices and interfaces
+			continue
+		}
+		if v, ok := parseValue(s); ok {
+			fields[field] = v
+		}
+	}
+	acc.AddFields("libvirt_domain", fields, tags, now)
+
+	measurements := []struct {
+		group, measurement, tag string
+	}{
+		{"vcpu", "libvirt_vcpu", "vcpu"},
+		{"block", "libvirt_block", "disk"},
+		{"net", "libvirt_interface", "interface"},
+	}
+	for _, m := range measurements {
+		for _, dev := range devices[m.group] {
+			if len(dev.fields) == 0 {
+				continue
+			}
+			devTags := map[string]string{m.tag: dev.name}
+			for k, v := range tags {
+				devTags[k] = v
+			}
+			acc.AddFields(m.measurement, dev.fields, devTags, now)
+		}
+	}
+}
+
+// parseValue returns the integer or float value of s, false when it is not
+// a number, as "yes" for vcpu.0.halted.
+func parseValue(s string) (interface{}, bool) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, true
+	}
+	if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return int64(v), true
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, true
+	}
+	return nil, false
+}
+
+// run runs command with args and returns its output.
+func run(timeout time.Duration, command string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("run %s %s: %s (%s)", command,
+			strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+func init() {
+	inputs.Add("libvirt", func() telegraf.Input {
+		return &Libvirt{
+			URIs:    []string{"qemu:///system"},
+			Timeout: internal.Duration{Duration: 5 * time.Second},
+			run:     run,
+		}
+	})
+}
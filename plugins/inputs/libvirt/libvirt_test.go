@@ -0,0 +1,225 @@
+package libvirt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const list = `8f6f0dc8-8b1e-4e4f-9f2b-6d0a3b2c1e01 web1
+f2a9c3d4-1b2c-4d5e-8f90-a1b2c3d4e5f6 build server
+`
+
+const domstats = `Domain: 'web1'
+  state.state=1
+  state.reason=1
+  cpu.time=2846474576231
+  cpu.user=1920000000000
+  cpu.system=710000000000
+  balloon.current=4194304
+  balloon.maximum=4194304
+  balloon.swap_in=0
+  balloon.swap_out=0
+  balloon.major_fault=312
+  balloon.minor_fault=5123456
+  balloon.unused=2811904
+  balloon.available=4033024
+  balloon.usable=3119104
+  balloon.last-update=1552200000
+  balloon.rss=4312160
+  vcpu.current=2
+  vcpu.maximum=2
+  vcpu.0.state=1
+  vcpu.0.time=1380000000000
+  vcpu.0.wait=0
+  vcpu.0.halted=no
+  vcpu.1.state=1
+  vcpu.1.time=1290000000000
+  vcpu.1.wait=0
+  vcpu.1.halted=yes
+  net.count=1
+  net.0.name=vnet0
+  net.0.rx.bytes=918273645
+  net.0.rx.pkts=812345
+  net.0.rx.errs=0
+  net.0.rx.drop=3
+  net.0.tx.bytes=123456789
+  net.0.tx.pkts=234567
+  net.0.tx.errs=0
+  net.0.tx.drop=0
+  block.count=1
+  block.0.name=vda
+  block.0.path=/var/lib/libvirt/images/web1.qcow2
+  block.0.rd.reqs=23456
+  block.0.rd.bytes=734003200
+  block.0.rd.times=9876543210
+  block.0.wr.reqs=65432
+  block.0.wr.bytes=2147483648
+  block.0.wr.times=87654321098
+  block.0.fl.reqs=1234
+  block.0.fl.times=456789012
+  block.0.allocation=5368709120
+  block.0.capacity=21474836480
+  block.0.physical=5368709120
+
+Domain: 'build server'
+  state.state=5
+  state.reason=1
+
+`
+
+func fakeRun(t *testing.T, calls *[]string) func(time.Duration, string, ...string) ([]byte, error) {
+	return func(timeout time.Duration, command string, args ...string) ([]byte, error) {
+		*calls = append(*calls, command+" "+strings.Join(args, " "))
+		switch args[3] {
+		case "list":
+			return []byte(list), nil
+		case "domstats":
+			return []byte(domstats), nil
+		}
+		t.Fatalf("unexpected command %s %v", command, args)
+		return nil, nil
+	}
+}
+
+func TestGather(t *testing.T) {
+	var calls []string
+	l := &Libvirt{
+		URIs: []string{"qemu:///system"},
+		Path: "/usr/bin/virsh",
+		run:  fakeRun(t, &calls),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, l.Gather(&acc))
+	assert.Equal(t, []string{
+		"/usr/bin/virsh -c qemu:///system -q list --all --uuid --name",
+		"/usr/bin/virsh -c qemu:///system -q domstats --raw --state --cpu-total --balloon --vcpu --interface --block",
+	}, calls)
+
+	tags := map[string]string{
+		"uri":    "qemu:///system",
+		"domain": "web1",
+		"uuid":   "8f6f0dc8-8b1e-4e4f-9f2b-6d0a3b2c1e01",
+	}
+	acc.AssertContainsTaggedFields(t, "libvirt_domain", map[string]interface{}{
+		"state":               int64(1),
+		"state_reason":        int64(1),
+		"cpu_time":            int64(2846474576231),
+		"cpu_user":            int64(1920000000000),
+		"cpu_system":          int64(710000000000),
+		"balloon_current":     int64(4194304),
+		"balloon_maximum":     int64(4194304),
+		"balloon_swap_in":     int64(0),
+		"balloon_swap_out":    int64(0),
+		"balloon_major_fault": int64(312),
+		"balloon_minor_fault": int64(5123456),
+		"balloon_unused":      int64(2811904),
+		"balloon_available":   int64(4033024),
+		"balloon_usable":      int64(3119104),
+		"balloon_last_update": int64(1552200000),
+		"balloon_rss":         int64(4312160),
+		"vcpu_current":        int64(2),
+		"vcpu_maximum":        int64(2),
+	}, tags)
+
+	vcpuTags := map[string]string{"vcpu": "1"}
+	for k, v := range tags {
+		vcpuTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "libvirt_vcpu", map[string]interface{}{
+		"state": int64(1),
+		"time":  int64(1290000000000),
+		"wait":  int64(0),
+	}, vcpuTags)
+
+	blockTags := map[string]string{"disk": "vda"}
+	for k, v := range tags {
+		blockTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "libvirt_block", map[string]interface{}{
+		"rd_reqs":    int64(23456),
+		"rd_bytes":   int64(734003200),
+		"rd_times":   int64(9876543210),
+		"wr_reqs":    int64(65432),
+		"wr_bytes":   int64(2147483648),
+		"wr_times":   int64(87654321098),
+		"fl_reqs":    int64(1234),
+		"fl_times":   int64(456789012),
+		"allocation": int64(5368709120),
+		"capacity":   int64(21474836480),
+		"physical":   int64(5368709120),
+	}, blockTags)
+
+	netTags := map[string]string{"interface": "vnet0"}
+	for k, v := range tags {
+		netTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "libvirt_interface", map[string]interface{}{
+		"rx_bytes": int64(918273645),
+		"rx_pkts":  int64(812345),
+		"rx_errs":  int64(0),
+		"rx_drop":  int64(3),
+		"tx_bytes": int64(123456789),
+		"tx_pkts":  int64(234567),
+		"tx_errs":  int64(0),
+		"tx_drop":  int64(0),
+	}, netTags)
+
+	acc.AssertContainsTaggedFields(t, "libvirt_domain", map[string]interface{}{
+		"state":        int64(5),
+		"state_reason": int64(1),
+	}, map[string]string{
+		"uri":    "qemu:///system",
+		"domain": "build server",
+		"uuid":   "f2a9c3d4-1b2c-4d5e-8f90-a1b2c3d4e5f6",
+	})
+	assert.Equal(t, 6, len(acc.Metrics))
+}
+
+func TestGatherDomainsSudo(t *testing.T) {
+	var calls []string
+	l := &Libvirt{
+		URIs:    []string{"qemu+ssh://kvm1/system"},
+		Domains: []string{"web1"},
+		Path:    "/usr/bin/virsh",
+		UseSudo: true,
+		run: func(timeout time.Duration, command string, args ...string) ([]byte, error) {
+			calls = append(calls, command+" "+strings.Join(args, " "))
+			return nil, nil
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, l.Gather(&acc))
+	assert.Equal(t, []string{
+		"sudo -n /usr/bin/virsh -c qemu+ssh://kvm1/system -q list --all --uuid --name",
+		"sudo -n /usr/bin/virsh -c qemu+ssh://kvm1/system -q domstats --raw --state --cpu-total --balloon --vcpu --interface --block web1",
+	}, calls)
+}
+
+func TestGatherError(t *testing.T) {
+	l := &Libvirt{
+		URIs: []string{"qemu:///system", "qemu+ssh://kvm1/system"},
+		Path: "/usr/bin/virsh",
+		run: func(timeout time.Duration, command string, args ...string) ([]byte, error) {
+			if args[1] == "qemu+ssh://kvm1/system" {
+				return nil, errors.New("run /usr/bin/virsh: failed to connect to the hypervisor")
+			}
+			switch args[3] {
+			case "list":
+				return []byte(list), nil
+			default:
+				return []byte(domstats), nil
+			}
+		},
+	}
+	var acc testutil.Accumulator
+	err := l.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to the hypervisor")
+	assert.Equal(t, 6, len(acc.Metrics))
+}
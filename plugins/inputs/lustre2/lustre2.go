@@ -4,7 +4,6 @@ Lustre 2.x telegraf plugin
 Lustre (http://lustre.org/) is an open-source, parallel file system
 for HPC environments. It stores statistics about its activity in
 /proc
-
 */
 package lustre2
 
@@ -39,9 +38,12 @@ var sampleConfig = `
   # mds_procfiles = ["/proc/fs/lustre/mdt/*/md_stats"]
 `
 
-/* The wanted fields would be a []string if not for the
+/*
+	The wanted fields would be a []string if not for the
+
 lines that start with read_bytes/write_bytes and contain
-   both the byte count and the function call count
+
+	both the byte count and the function call count
 */
 type mapping struct {
 	inProc   string // What to look for at the start of a line in /proc/fs/lustre/*
@@ -0,0 +1,288 @@
+package nginx_vts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+type NginxVTS struct {
+	Urls            []string
+	ResponseTimeout internal.Duration `toml:"response_timeout"`
+
+	client *http.Client
+}
+
+var sampleConfig = `
+  ## An array of nginx-module-vts status URIs, serving the JSON format, to
+  ## gather stats.
+  urls = ["http://localhost/status/format/json"]
+
+  ## HTTP response timeout
+  # response_timeout = "5s"
+`
+
+func (n *NginxVTS) SampleConfig() string {
+	return sampleConfig
+}
+
+func (n *NginxVTS) Description() string {
+	return "Read Nginx virtual host traffic status (nginx-module-vts)"
+}
+
+func (n *NginxVTS) Gather(acc telegraf.Accumulator) error {
+	if n.client == nil {
+		timeout := n.ResponseTimeout.Duration
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		n.client = &http.Client{
+			Transport: &http.Transport{ResponseHeaderTimeout: timeout},
+			Timeout:   timeout,
+		}
+	}
+
+	// Keep polling the remaining urls when one of them fails and return
+	// all errors as one giant error
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(n.Urls))
+	for _, u := range n.Urls {
+		addr, err := url.Parse(u)
+		if err != nil {
+			errChan <- fmt.Errorf("Unable to parse address '%s': %s", u, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(addr *url.URL) {
+			defer wg.Done()
+			if err := n.gatherURL(addr, acc); err != nil {
+				errChan <- err
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	errorStrings := []string{}
+	for len(errChan) > 0 {
+		errorStrings = append(errorStrings, (<-errChan).Error())
+	}
+	if len(errorStrings) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errorStrings, "\n"))
+}
+
+// status is the JSON document of the vts status endpoint.
+type status struct {
+	Connections struct {
+		Active   uint64 `json:"active"`
+		Reading  uint64 `json:"reading"`
+		Writing  uint64 `json:"writing"`
+		Waiting  uint64 `json:"waiting"`
+		Accepted uint64 `json:"accepted"`
+		Handled  uint64 `json:"handled"`
+		Requests uint64 `json:"requests"`
+	} `json:"connections"`
+	ServerZones   map[string]zone            `json:"serverZones"`
+	FilterZones   map[string]map[string]zone `json:"filterZones"`
+	UpstreamZones map[string][]upstream      `json:"upstreamZones"`
+	CacheZones    map[string]cacheZone       `json:"cacheZones"`
+}
+
+type zone struct {
+	RequestCounter uint64    `json:"requestCounter"`
+	InBytes        uint64    `json:"inBytes"`
+	OutBytes       uint64    `json:"outBytes"`
+	RequestMsec    uint64    `json:"requestMsec"`
+	Responses      responses `json:"responses"`
+}
+
+type upstream struct {
+	Server         string    `json:"server"`
+	RequestCounter uint64    `json:"requestCounter"`
+	InBytes        uint64    `json:"inBytes"`
+	OutBytes       uint64    `json:"outBytes"`
+	RequestMsec    uint64    `json:"requestMsec"`
+	ResponseMsec   uint64    `json:"responseMsec"`
+	Responses      responses `json:"responses"`
+	Weight         uint64    `json:"weight"`
+	MaxFails       uint64    `json:"maxFails"`
+	FailTimeout    uint64    `json:"failTimeout"`
+	Backup         bool      `json:"backup"`
+	Down           bool      `json:"down"`
+}
+
+type cacheZone struct {
+	MaxSize   uint64    `json:"maxSize"`
+	UsedSize  uint64    `json:"usedSize"`
+	InBytes   uint64    `json:"inBytes"`
+	OutBytes  uint64    `json:"outBytes"`
+	Responses responses `json:"responses"`
+}
+
+type responses struct {
+	OneXX       uint64 `json:"1xx"`
+	TwoXX       uint64 `json:"2xx"`
+	ThreeXX     uint64 `json:"3xx"`
+	FourXX      uint64 `json:"4xx"`
+	FiveXX      uint64 `json:"5xx"`
+	Miss        uint64 `json:"miss"`
+	Bypass      uint64 `json:"bypass"`
+	Expired     uint64 `json:"expired"`
+	Stale       uint64 `json:"stale"`
+	Updating    uint64 `json:"updating"`
+	Revalidated uint64 `json:"revalidated"`
+	Hit         uint64 `json:"hit"`
+	Scarce      uint64 `json:"scarce"`
+}
+
+// addCodes adds the response code counters to fields.
+func (r responses) addCodes(fields map[string]interface{}) {
+	fields["1xx"] = r.OneXX
+	fields["2xx"] = r.TwoXX
+	fields["3xx"] = r.ThreeXX
+	fields["4xx"] = r.FourXX
+	fields["5xx"] = r.FiveXX
+}
+
+// addCache adds the cache status counters to fields, with prefix.
+func (r responses) addCache(prefix string, fields map[string]interface{}) {
+	fields[prefix+"miss"] = r.Miss
+	fields[prefix+"bypass"] = r.Bypass
+	fields[prefix+"expired"] = r.Expired
+	fields[prefix+"stale"] = r.Stale
+	fields[prefix+"updating"] = r.Updating
+	fields[prefix+"revalidated"] = r.Revalidated
+	fields[prefix+"hit"] = r.Hit
+	fields[prefix+"scarce"] = r.Scarce
+}
+
+// fields returns the fields of a server or filter zone.
+func (z zone) fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"requests":     z.RequestCounter,
+		"in_bytes":     z.InBytes,
+		"out_bytes":    z.OutBytes,
+		"request_time": z.RequestMsec,
+	}
+	z.Responses.addCodes(fields)
+	z.Responses.addCache("cache_", fields)
+	return fields
+}
+
+func (n *NginxVTS) gatherURL(addr *url.URL, acc telegraf.Accumulator) error {
+	resp, err := n.client.Get(addr.String())
+	if err != nil {
+		return fmt.Errorf("error making HTTP request to %s: %s", addr.String(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP status %s", addr.String(), resp.Status)
+	}
+
+	var s status
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return fmt.Errorf("error decoding the vts status of %s: %s",
+			addr.String(), err)
+	}
+	now := time.Now()
+
+	tags := getTags(addr)
+	acc.AddFields("nginx_vts_connections", map[string]interface{}{
+		"active":   s.Connections.Active,
+		"reading":  s.Connections.Reading,
+		"writing":  s.Connections.Writing,
+		"waiting":  s.Connections.Waiting,
+		"accepted": s.Connections.Accepted,
+		"handled":  s.Connections.Handled,
+		"requests": s.Connections.Requests,
+	}, tags, now)
+
+	for name, z := range s.ServerZones {
+		zoneTags := getTags(addr)
+		zoneTags["zone"] = name
+		acc.AddFields("nginx_vts_server", z.fields(), zoneTags, now)
+	}
+
+	for key, filters := range s.FilterZones {
+		for name, z := range filters {
+			filterTags := getTags(addr)
+			filterTags["filter_key"] = key
+			filterTags["filter_name"] = name
+			acc.AddFields("nginx_vts_filter", z.fields(), filterTags, now)
+		}
+	}
+
+	for name, peers := range s.UpstreamZones {
+		for _, u := range peers {
+			fields := map[string]interface{}{
+				"requests":      u.RequestCounter,
+				"in_bytes":      u.InBytes,
+				"out_bytes":     u.OutBytes,
+				"request_time":  u.RequestMsec,
+				"response_time": u.ResponseMsec,
+				"weight":        u.Weight,
+				"max_fails":     u.MaxFails,
+				"fail_timeout":  u.FailTimeout,
+				"backup":        u.Backup,
+				"down":          u.Down,
+			}
+			u.Responses.addCodes(fields)
+			upstreamTags := getTags(addr)
+			upstreamTags["upstream"] = name
+			upstreamTags["upstream_address"] = u.Server
+			acc.AddFields("nginx_vts_upstream", fields, upstreamTags, now)
+		}
+	}
+
+	for name, c := range s.CacheZones {
+		fields := map[string]interface{}{
+			"max_size":  c.MaxSize,
+			"used_size": c.UsedSize,
+			"in_bytes":  c.InBytes,
+			"out_bytes": c.OutBytes,
+		}
+		c.Responses.addCache("", fields)
+		cacheTags := getTags(addr)
+		cacheTags["zone"] = name
+		acc.AddFields("nginx_vts_cache", fields, cacheTags, now)
+	}
+
+	return nil
+}
+
+// Get tag(s) for the nginx_vts plugin
+func getTags(addr *url.URL) map[string]string {
+	h := addr.Host
+	host, port, err := net.SplitHostPort(h)
+	if err != nil {
+		host = addr.Host
+		if addr.Scheme == "http" {
+			port = "80"
+		} else if addr.Scheme == "https" {
+			port = "443"
+		} else {
+			port = ""
+		}
+	}
+	return map[string]string{"server": host, "port": port}
+}
+
+func init() {
+	inputs.Add("nginx_vts", func() telegraf.Input {
+		return &NginxVTS{
+			ResponseTimeout: internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package nginx_vts
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleStatus = `{
+  "hostName": "web-1",
+  "nginxVersion": "1.13.12",
+  "loadMsec": 1517929819154,
+  "nowMsec": 1517929875158,
+  "connections": {
+    "active": 2, "reading": 0, "writing": 1, "waiting": 1,
+    "accepted": 1023, "handled": 1023, "requests": 4512
+  },
+  "sharedZones": {
+    "name": "ngx_http_vhost_traffic_status",
+    "maxSize": 1048575, "usedSize": 18405, "usedNode": 4
+  },
+  "serverZones": {
+    "example.com": {
+      "requestCounter": 4500, "inBytes": 1600000, "outBytes": 9500000,
+      "responses": {
+        "1xx": 0, "2xx": 4200, "3xx": 120, "4xx": 170, "5xx": 10,
+        "miss": 30, "bypass": 1, "expired": 2, "stale": 0, "updating": 0,
+        "revalidated": 0, "hit": 400, "scarce": 0
+      },
+      "requestMsec": 12
+    }
+  },
+  "filterZones": {
+    "country": {
+      "FR": {
+        "requestCounter": 30, "inBytes": 3000, "outBytes": 50000,
+        "responses": {"1xx": 0, "2xx": 30, "3xx": 0, "4xx": 0, "5xx": 0},
+        "requestMsec": 8
+      }
+    }
+  },
+  "upstreamZones": {
+    "backend": [
+      {
+        "server": "10.0.0.1:8080",
+        "requestCounter": 4000, "inBytes": 1500000, "outBytes": 9000000,
+        "responses": {"1xx": 0, "2xx": 3900, "3xx": 20, "4xx": 70, "5xx": 10},
+        "requestMsec": 15, "responseMsec": 14,
+        "weight": 1, "maxFails": 1, "failTimeout": 10,
+        "backup": false, "down": false
+      },
+      {
+        "server": "10.0.0.2:8080",
+        "requestCounter": 0, "inBytes": 0, "outBytes": 0,
+        "responses": {"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0},
+        "requestMsec": 0, "responseMsec": 0,
+        "weight": 1, "maxFails": 1, "failTimeout": 10,
+        "backup": true, "down": true
+      }
+    ]
+  },
+  "cacheZones": {
+    "static": {
+      "maxSize": 104857600, "usedSize": 2097152,
+      "inBytes": 100000, "outBytes": 4000000,
+      "responses": {
+        "miss": 30, "bypass": 1, "expired": 2, "stale": 0, "updating": 0,
+        "revalidated": 0, "hit": 400, "scarce": 0
+      }
+    }
+  }
+}`
+
+func TestNginxVTSGeneratesMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/format/json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, sampleStatus)
+	}))
+	defer ts.Close()
+
+	n := &NginxVTS{
+		Urls: []string{ts.URL + "/status/format/json"},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(addr.Host)
+	require.NoError(t, err)
+	tags := func(extra ...string) map[string]string {
+		tags := map[string]string{"server": host, "port": port}
+		for i := 0; i < len(extra); i += 2 {
+			tags[extra[i]] = extra[i+1]
+		}
+		return tags
+	}
+
+	acc.AssertContainsTaggedFields(t, "nginx_vts_connections",
+		map[string]interface{}{
+			"active":   uint64(2),
+			"reading":  uint64(0),
+			"writing":  uint64(1),
+			"waiting":  uint64(1),
+			"accepted": uint64(1023),
+			"handled":  uint64(1023),
+			"requests": uint64(4512),
+		}, tags())
+	acc.AssertContainsTaggedFields(t, "nginx_vts_server",
+		map[string]interface{}{
+			"requests":          uint64(4500),
+			"in_bytes":          uint64(1600000),
+			"out_bytes":         uint64(9500000),
+			"request_time":      uint64(12),
+			"1xx":               uint64(0),
+			"2xx":               uint64(4200),
+			"3xx":               uint64(120),
+			"4xx":               uint64(170),
+			"5xx":               uint64(10),
+			"cache_miss":        uint64(30),
+			"cache_bypass":      uint64(1),
+			"cache_expired":     uint64(2),
+			"cache_stale":       uint64(0),
+			"cache_updating":    uint64(0),
+			"cache_revalidated": uint64(0),
+			"cache_hit":         uint64(400),
+			"cache_scarce":      uint64(0),
+		}, tags("zone", "example.com"))
+	acc.AssertContainsTaggedFields(t, "nginx_vts_upstream",
+		map[string]interface{}{
+			"requests":      uint64(4000),
+			"in_bytes":      uint64(1500000),
+			"out_bytes":     uint64(9000000),
+			"request_time":  uint64(15),
+			"response_time": uint64(14),
+			"weight":        uint64(1),
+			"max_fails":     uint64(1),
+			"fail_timeout":  uint64(10),
+			"backup":        false,
+			"down":          false,
+			"1xx":           uint64(0),
+			"2xx":           uint64(3900),
+			"3xx":           uint64(20),
+			"4xx":           uint64(70),
+			"5xx":           uint64(10),
+		}, tags("upstream", "backend", "upstream_address", "10.0.0.1:8080"))
+	acc.AssertContainsTaggedFields(t, "nginx_vts_cache",
+		map[string]interface{}{
+			"max_size":    uint64(104857600),
+			"used_size":   uint64(2097152),
+			"in_bytes":    uint64(100000),
+			"out_bytes":   uint64(4000000),
+			"miss":        uint64(30),
+			"bypass":      uint64(1),
+			"expired":     uint64(2),
+			"stale":       uint64(0),
+			"updating":    uint64(0),
+			"revalidated": uint64(0),
+			"hit":         uint64(400),
+			"scarce":      uint64(0),
+		}, tags("zone", "static"))
+	assert.True(t, acc.HasMeasurement("nginx_vts_filter"))
+	// One point per upstream server
+	assert.Equal(t, 6, len(acc.Metrics))
+}
+
+func TestNginxVTSErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/html" {
+			fmt.Fprintln(w, "<html></html>")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	n := &NginxVTS{
+		Urls: []string{ts.URL + "/missing", ts.URL + "/html"},
+	}
+	var acc testutil.Accumulator
+	err := n.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+	assert.Contains(t, err.Error(), "error decoding")
+	assert.Empty(t, acc.Metrics)
+}
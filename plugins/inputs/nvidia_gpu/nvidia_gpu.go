@@ -0,0 +1,334 @@
+package nvidia_gpu
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// NvidiaGPU reports the utilization, memory, temperature, power and ECC
+// errors of the NVIDIA GPUs, and the memory of their processes, from NVML or
+// from nvidia-smi.
+type NvidiaGPU struct {
+	BinPath string `toml:"bin_path"`
+	Timeout internal.Duration
+
+	// nvml returns the GPUs read with NVML, nil when built without it
+	nvml func() ([]*gpu, error)
+	smi  func(timeout time.Duration, binPath string) ([]byte, error)
+}
+
+var sampleConfig = `
+  ## Path of nvidia-smi, looked up in PATH if empty, used when the agent is
+  ## built without NVML or NVML can't be loaded
+  # bin_path = "/usr/bin/nvidia-smi"
+
+  ## Timeout of nvidia-smi
+  # timeout = "5s"
+`
+
+func (n *NvidiaGPU) SampleConfig() string {
+	return sampleConfig
+}
+
+func (n *NvidiaGPU) Description() string {
+	return "Read the utilization, memory, temperature, power and ECC errors of NVIDIA GPUs"
+}
+
+// gpu is a GPU, its fields and its processes.
+type gpu struct {
+	index     int
+	uuid      string
+	name      string
+	fields    map[string]interface{}
+	processes []process
+}
+
+// process is a process using a GPU.
+type process struct {
+	pid  int
+	name string
+	// MiB
+	usedMemory int64
+}
+
+func (n *NvidiaGPU) Gather(acc telegraf.Accumulator) error {
+	gpus, err := n.gpus()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, g := range gpus {
+		tags := map[string]string{
+			"index": strconv.Itoa(g.index),
+			"uuid":  g.uuid,
+			"name":  g.name,
+		}
+		acc.AddFields("nvidia_gpu", g.fields, tags, now)
+		for _, p := range g.processes {
+			processTags := map[string]string{
+				"pid":          strconv.Itoa(p.pid),
+				"process_name": p.name,
+			}
+			for k, v := range tags {
+				processTags[k] = v
+			}
+			acc.AddFields("nvidia_gpu_process", map[string]interface{}{
+				"used_memory": p.usedMemory,
+			}, processTags, now)
+		}
+	}
+	return nil
+}
+
+// gpus returns the GPUs read with NVML, or with nvidia-smi when NVML is not
+// available.
+func (n *NvidiaGPU) gpus() ([]*gpu, error) {
+	var nvmlErr error
+	if n.nvml != nil {
+		gpus, err := n.nvml()
+		if err == nil {
+			return gpus, nil
+		}
+		nvmlErr = err
+	}
+
+	timeout := n.Timeout.Duration
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	binPath := n.BinPath
+	if binPath == "" {
+		var err error
+		if binPath, err = exec.LookPath("nvidia-smi"); err != nil {
+			if nvmlErr != nil {
+				return nil, fmt.Errorf("%s, and nvidia-smi: %s", nvmlErr, err)
+			}
+			return nil, err
+		}
+	}
+	out, err := n.smi(timeout, binPath)
+	if err != nil {
+		if nvmlErr != nil {
+			return nil, fmt.Errorf("%s, and %s", nvmlErr, err)
+		}
+		return nil, err
+	}
+	return parseSMI(out)
+}
+
+// smiLog holds the elements of the XML output of nvidia-smi -q -x used by
+// the plugin.
+type smiLog struct {
+	GPUs []struct {
+		ProductName      string `xml:"product_name"`
+		UUID             string `xml:"uuid"`
+		FanSpeed         string `xml:"fan_speed"`
+		PerformanceState string `xml:"performance_state"`
+		Memory           struct {
+			Total string `xml:"total"`
+			Used  string `xml:"used"`
+			Free  string `xml:"free"`
+		} `xml:"fb_memory_usage"`
+		Utilization struct {
+			GPU    string `xml:"gpu_util"`
+			Memory string `xml:"memory_util"`
+		} `xml:"utilization"`
+		ECCMode struct {
+			Current string `xml:"current_ecc"`
+		} `xml:"ecc_mode"`
+		ECCErrors struct {
+			Volatile  smiECC `xml:"volatile"`
+			Aggregate smiECC `xml:"aggregate"`
+		} `xml:"ecc_errors"`
+		Temperature struct {
+			GPU string `xml:"gpu_temp"`
+		} `xml:"temperature"`
+		// gpu_power_readings since the R525 drivers
+		PowerReadings    smiPower `xml:"power_readings"`
+		GPUPowerReadings smiPower `xml:"gpu_power_readings"`
+		Clocks           struct {
+			Graphics string `xml:"graphics_clock"`
+			SM       string `xml:"sm_clock"`
+			Memory   string `xml:"mem_clock"`
+		} `xml:"clocks"`
+		Processes []struct {
+			PID        string `xml:"pid"`
+			Name       string `xml:"process_name"`
+			UsedMemory string `xml:"used_memory"`
+		} `xml:"processes>process_info"`
+	} `xml:"gpu"`
+}
+
+// smiECC are ECC error counters, by bits before the R510 drivers, by memory
+// since.
+type smiECC struct {
+	SingleBit struct {
+		Total string `xml:"total"`
+	} `xml:"single_bit"`
+	DoubleBit struct {
+		Total string `xml:"total"`
+	} `xml:"double_bit"`
+	SRAMCorrectable   string `xml:"sram_correctable"`
+	SRAMUncorrectable string `xml:"sram_uncorrectable"`
+	DRAMCorrectable   string `xml:"dram_correctable"`
+	DRAMUncorrectable string `xml:"dram_uncorrectable"`
+}
+
+func (e smiECC) counts() (int64, int64, bool) {
+	corrected, ok1 := parseInt(e.SingleBit.Total)
+	uncorrected, ok2 := parseInt(e.DoubleBit.Total)
+	if ok1 && ok2 {
+		return corrected, uncorrected, true
+	}
+	var ok bool
+	for _, s := range []string{e.SRAMCorrectable, e.DRAMCorrectable} {
+		if v, valid := parseInt(s); valid {
+			corrected += v
+			ok = true
+		}
+	}
+	for _, s := range []string{e.SRAMUncorrectable, e.DRAMUncorrectable} {
+		if v, valid := parseInt(s); valid {
+			uncorrected += v
+			ok = true
+		}
+	}
+	return corrected, uncorrected, ok
+}
+
+type smiPower struct {
+	PowerDraw         string `xml:"power_draw"`
+	InstantPowerDraw  string `xml:"instant_power_draw"`
+	PowerLimit        string `xml:"power_limit"`
+	CurrentPowerLimit string `xml:"current_power_limit"`
+}
+
+// parseSMI returns the GPUs of the output of nvidia-smi -q -x, indexed in
+// its order, the order of nvidia-smi -i.
+func parseSMI(out []byte) ([]*gpu, error) {
+	var log smiLog
+	if err := xml.Unmarshal(out, &log); err != nil {
+		return nil, fmt.Errorf("parse nvidia-smi output: %s", err)
+	}
+
+	var gpus []*gpu
+	for i, g := range log.GPUs {
+		fields := make(map[string]interface{})
+		ints := map[string]string{
+			"utilization_gpu":    g.Utilization.GPU,
+			"utilization_memory": g.Utilization.Memory,
+			"memory_total":       g.Memory.Total,
+			"memory_used":        g.Memory.Used,
+			"memory_free":        g.Memory.Free,
+			"temperature_gpu":    g.Temperature.GPU,
+			"fan_speed":          g.FanSpeed,
+			"clocks_graphics":    g.Clocks.Graphics,
+			"clocks_sm":          g.Clocks.SM,
+			"clocks_memory":      g.Clocks.Memory,
+			"pstate":             strings.TrimPrefix(g.PerformanceState, "P"),
+		}
+		for field, s := range ints {
+			if v, ok := parseInt(s); ok {
+				fields[field] = v
+			}
+		}
+		for _, power := range []smiPower{g.PowerReadings, g.GPUPowerReadings} {
+			for _, s := range []string{power.PowerDraw, power.InstantPowerDraw} {
+				if v, ok := parseFloat(s); ok {
+					fields["power_draw"] = v
+				}
+			}
+			for _, s := range []string{power.PowerLimit, power.CurrentPowerLimit} {
+				if v, ok := parseFloat(s); ok {
+					fields["power_limit"] = v
+				}
+			}
+		}
+		if g.ECCMode.Current == "Enabled" {
+			if corrected, uncorrected, ok := g.ECCErrors.Volatile.counts(); ok {
+				fields["ecc_errors_corrected_volatile"] = corrected
+				fields["ecc_errors_uncorrected_volatile"] = uncorrected
+			}
+			if corrected, uncorrected, ok := g.ECCErrors.Aggregate.counts(); ok {
+				fields["ecc_errors_corrected_aggregate"] = corrected
+				fields["ecc_errors_uncorrected_aggregate"] = uncorrected
+			}
+		}
+
+		device := &gpu{
+			index:  i,
+			uuid:   g.UUID,
+			name:   g.ProductName,
+			fields: fields,
+		}
+		for _, p := range g.Processes {
+			pid, err := strconv.Atoi(p.PID)
+			if err != nil {
+				continue
+			}
+			usedMemory, _ := parseInt(p.UsedMemory)
+			device.processes = append(device.processes, process{
+				pid:        pid,
+				name:       p.Name,
+				usedMemory: usedMemory,
+			})
+		}
+		gpus = append(gpus, device)
+	}
+	return gpus, nil
+}
+
+// parseInt returns the value of s without its unit, as "15109 MiB", false
+// when it has none, as "N/A" or "[Not Supported]".
+func parseInt(s string) (int64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(fields[0], 10, 64)
+	return v, err == nil
+}
+
+func parseFloat(s string) (float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	return v, err == nil
+}
+
+// smi runs nvidia-smi and returns its XML output.
+func smi(timeout time.Duration, binPath string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binPath, "-q", "-x")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("run %s -q -x: %s (%s)", binPath,
+			strings.TrimSpace(stderr.String()+stdout.String()), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+func init() {
+	inputs.Add("nvidia_gpu", func() telegraf.Input {
+		return &NvidiaGPU{
+			Timeout: internal.Duration{Duration: 5 * time.Second},
+			nvml:    readNVML,
+			smi:     smi,
+		}
+	})
+}
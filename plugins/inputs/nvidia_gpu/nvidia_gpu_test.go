@@ -0,0 +1,169 @@
+package nvidia_gpu
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeSMI(t *testing.T) func(time.Duration, string) ([]byte, error) {
+	return func(timeout time.Duration, binPath string) ([]byte, error) {
+		assert.Equal(t, "/usr/bin/nvidia-smi", binPath)
+		return ioutil.ReadFile("testdata/nvidia-smi.xml")
+	}
+}
+
+func TestGatherSMI(t *testing.T) {
+	n := &NvidiaGPU{
+		BinPath: "/usr/bin/nvidia-smi",
+		smi:     fakeSMI(t),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+
+	v100 := map[string]string{
+		"index": "0",
+		"uuid":  "GPU-8cf8ce1c-5cd3-0c68-2fd1-2bdb0b0e5a72",
+		"name":  "Tesla V100-SXM2-16GB",
+	}
+	acc.AssertContainsTaggedFields(t, "nvidia_gpu", map[string]interface{}{
+		"utilization_gpu":                  int64(87),
+		"utilization_memory":               int64(41),
+		"memory_total":                     int64(16130),
+		"memory_used":                      int64(15109),
+		"memory_free":                      int64(1021),
+		"temperature_gpu":                  int64(62),
+		"clocks_graphics":                  int64(1530),
+		"clocks_sm":                        int64(1530),
+		"clocks_memory":                    int64(877),
+		"pstate":                           int64(0),
+		"power_draw":                       243.52,
+		"power_limit":                      300.0,
+		"ecc_errors_corrected_volatile":    int64(2),
+		"ecc_errors_uncorrected_volatile":  int64(0),
+		"ecc_errors_corrected_aggregate":   int64(14),
+		"ecc_errors_uncorrected_aggregate": int64(1),
+	}, v100)
+	acc.AssertContainsTaggedFields(t, "nvidia_gpu_process", map[string]interface{}{
+		"used_memory": int64(15098),
+	}, map[string]string{
+		"index":        "0",
+		"uuid":         "GPU-8cf8ce1c-5cd3-0c68-2fd1-2bdb0b0e5a72",
+		"name":         "Tesla V100-SXM2-16GB",
+		"pid":          "21705",
+		"process_name": "/usr/bin/python3",
+	})
+
+	acc.AssertContainsTaggedFields(t, "nvidia_gpu", map[string]interface{}{
+		"utilization_gpu":                  int64(0),
+		"utilization_memory":               int64(0),
+		"memory_total":                     int64(40960),
+		"memory_used":                      int64(4),
+		"memory_free":                      int64(40956),
+		"temperature_gpu":                  int64(31),
+		"clocks_graphics":                  int64(210),
+		"clocks_sm":                        int64(210),
+		"clocks_memory":                    int64(1215),
+		"pstate":                           int64(8),
+		"power_draw":                       34.87,
+		"power_limit":                      250.0,
+		"ecc_errors_corrected_volatile":    int64(3),
+		"ecc_errors_uncorrected_volatile":  int64(0),
+		"ecc_errors_corrected_aggregate":   int64(6),
+		"ecc_errors_uncorrected_aggregate": int64(2),
+	}, map[string]string{
+		"index": "1",
+		"uuid":  "GPU-3e1d8b0f-9d3e-7e1a-5c4b-0a9e6f2d1c88",
+		"name":  "NVIDIA A100-PCIE-40GB",
+	})
+	assert.Equal(t, 3, len(acc.Metrics))
+}
+
+func TestGatherNVML(t *testing.T) {
+	n := &NvidiaGPU{
+		nvml: func() ([]*gpu, error) {
+			return []*gpu{{
+				index:     0,
+				uuid:      "GPU-8cf8ce1c-5cd3-0c68-2fd1-2bdb0b0e5a72",
+				name:      "Tesla V100-SXM2-16GB",
+				fields:    map[string]interface{}{"utilization_gpu": int64(87)},
+				processes: []process{{pid: 21705, name: "python3", usedMemory: 15098}},
+			}}, nil
+		},
+		smi: func(time.Duration, string) ([]byte, error) {
+			t.Fatal("nvidia-smi run with NVML")
+			return nil, nil
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	acc.AssertContainsTaggedFields(t, "nvidia_gpu", map[string]interface{}{
+		"utilization_gpu": int64(87),
+	}, map[string]string{
+		"index": "0",
+		"uuid":  "GPU-8cf8ce1c-5cd3-0c68-2fd1-2bdb0b0e5a72",
+		"name":  "Tesla V100-SXM2-16GB",
+	})
+	assert.Equal(t, 2, len(acc.Metrics))
+}
+
+func TestGatherNVMLFallback(t *testing.T) {
+	n := &NvidiaGPU{
+		BinPath: "/usr/bin/nvidia-smi",
+		nvml: func() ([]*gpu, error) {
+			return nil, errors.New("NVML: libnvidia-ml.so.1 not found")
+		},
+		smi: fakeSMI(t),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	assert.Equal(t, 3, len(acc.Metrics))
+
+	n.smi = func(time.Duration, string) ([]byte, error) {
+		return nil, errors.New("run /usr/bin/nvidia-smi -q -x: exit status 9")
+	}
+	err := n.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "libnvidia-ml.so.1 not found")
+	assert.Contains(t, err.Error(), "exit status 9")
+}
+
+func TestParseSMIWithoutECC(t *testing.T) {
+	gpus, err := parseSMI([]byte(`<nvidia_smi_log>
+	<gpu id="00000000:01:00.0">
+		<product_name>GeForce GTX 1080</product_name>
+		<uuid>GPU-1b2c3d4e-0000-1111-2222-333344445555</uuid>
+		<fan_speed>27 %</fan_speed>
+		<performance_state>P2</performance_state>
+		<ecc_mode>
+			<current_ecc>N/A</current_ecc>
+		</ecc_mode>
+		<ecc_errors>
+			<volatile>
+				<single_bit>
+					<total>N/A</total>
+				</single_bit>
+			</volatile>
+		</ecc_errors>
+		<power_readings>
+			<power_draw>N/A</power_draw>
+			<power_limit>180.00 W</power_limit>
+		</power_readings>
+	</gpu>
+</nvidia_smi_log>`))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(gpus))
+	assert.Equal(t, map[string]interface{}{
+		"fan_speed":   int64(27),
+		"pstate":      int64(2),
+		"power_limit": 180.0,
+	}, gpus[0].fields)
+
+	_, err = parseSMI([]byte("Failed to initialize NVML: Driver/library version mismatch"))
+	assert.Error(t, err)
+}
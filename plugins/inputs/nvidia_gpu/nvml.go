@@ -0,0 +1,365 @@
+//go:build linux && cgo && nvml
+// +build linux,cgo,nvml
+
+package nvidia_gpu
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+
+// The types of nvml.h used, NVML is loaded at run time for the agent to
+// start without the driver.
+typedef void *nvmlDevice_t;
+typedef struct {
+	unsigned int gpu;
+	unsigned int memory;
+} nvmlUtilization_t;
+typedef struct {
+	unsigned long long total;
+	unsigned long long free;
+	unsigned long long used;
+} nvmlMemory_t;
+typedef struct {
+	unsigned int pid;
+	unsigned long long usedGpuMemory;
+} nvmlProcessInfo_v1_t;
+
+static void *nvml;
+
+static int nvml_open(void) {
+	nvml = dlopen("libnvidia-ml.so.1", RTLD_LAZY | RTLD_GLOBAL);
+	return nvml != NULL;
+}
+
+static void *nvml_sym(const char *name) {
+	return dlsym(nvml, name);
+}
+
+static int call(void *f) {
+	return ((int (*)(void))f)();
+}
+
+static int call_p(void *f, void *a) {
+	return ((int (*)(void *))f)(a);
+}
+
+static int call_u_p(void *f, unsigned int a, void *b) {
+	return ((int (*)(unsigned int, void *))f)(a, b);
+}
+
+static int call_d_p(void *f, nvmlDevice_t d, void *a) {
+	return ((int (*)(nvmlDevice_t, void *))f)(d, a);
+}
+
+static int call_d_p_u(void *f, nvmlDevice_t d, void *a, unsigned int b) {
+	return ((int (*)(nvmlDevice_t, void *, unsigned int))f)(d, a, b);
+}
+
+static int call_d_i_p(void *f, nvmlDevice_t d, int a, void *b) {
+	return ((int (*)(nvmlDevice_t, int, void *))f)(d, a, b);
+}
+
+static int call_d_i_i_p(void *f, nvmlDevice_t d, int a, int b, void *c) {
+	return ((int (*)(nvmlDevice_t, int, int, void *))f)(d, a, b, c);
+}
+
+static int call_d_p_p(void *f, nvmlDevice_t d, void *a, void *b) {
+	return ((int (*)(nvmlDevice_t, void *, void *))f)(d, a, b);
+}
+
+static int call_u_p_u(void *f, unsigned int a, void *b, unsigned int c) {
+	return ((int (*)(unsigned int, void *, unsigned int))f)(a, b, c);
+}
+
+static const char *call_error(void *f, int r) {
+	return ((const char *(*)(int))f)(r);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// Return codes of NVML.
+const (
+	nvmlSuccess         = 0
+	nvmlNotSupported    = 3
+	nvmlInsufficentSize = 7
+)
+
+// Clocks, temperature sensors and ECC counters of nvml.h.
+const (
+	nvmlClockGraphics = 0
+	nvmlClockSM       = 1
+	nvmlClockMem      = 2
+
+	nvmlTemperatureGPU = 0
+
+	nvmlMemoryErrorCorrected   = 0
+	nvmlMemoryErrorUncorrected = 1
+	nvmlVolatileECC            = 0
+	nvmlAggregateECC           = 1
+)
+
+var (
+	nvmlOnce    sync.Once
+	nvmlInitErr error
+
+	nvmlMu   sync.Mutex
+	nvmlSyms = make(map[string]unsafe.Pointer)
+)
+
+// nvmlFunc returns the function name of NVML.
+func nvmlFunc(name string) (unsafe.Pointer, error) {
+	nvmlMu.Lock()
+	defer nvmlMu.Unlock()
+	if f, ok := nvmlSyms[name]; ok {
+		return f, nil
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	f := C.nvml_sym(cname)
+	if f == nil {
+		return nil, fmt.Errorf("NVML has no %s", name)
+	}
+	nvmlSyms[name] = f
+	return f, nil
+}
+
+// nvmlError returns the error of the return code r of function name, nil on
+// success.
+func nvmlError(name string, r C.int) error {
+	if r == nvmlSuccess {
+		return nil
+	}
+	if f, err := nvmlFunc("nvmlErrorString"); err == nil {
+		return fmt.Errorf("%s: %s", name, C.GoString(C.call_error(f, r)))
+	}
+	return fmt.Errorf("%s: error %d", name, int(r))
+}
+
+// readNVML returns the GPUs read with NVML.
+func readNVML() ([]*gpu, error) {
+	nvmlOnce.Do(func() {
+		if C.nvml_open() == 0 {
+			nvmlInitErr = errors.New("NVML: libnvidia-ml.so.1 not found")
+			return
+		}
+		f, err := nvmlFunc("nvmlInit_v2")
+		if err != nil {
+			nvmlInitErr = err
+			return
+		}
+		nvmlInitErr = nvmlError("nvmlInit_v2", C.call(f))
+	})
+	if nvmlInitErr != nil {
+		return nil, nvmlInitErr
+	}
+
+	var count C.uint
+	if err := nvmlCall("nvmlDeviceGetCount_v2", func(f unsafe.Pointer) C.int {
+		return C.call_p(f, unsafe.Pointer(&count))
+	}); err != nil {
+		return nil, err
+	}
+	var gpus []*gpu
+	for i := 0; i < int(count); i++ {
+		g, err := readNVMLDevice(i)
+		if err != nil {
+			return nil, err
+		}
+		gpus = append(gpus, g)
+	}
+	return gpus, nil
+}
+
+// nvmlCall calls the function name of NVML with call.
+func nvmlCall(name string, call func(f unsafe.Pointer) C.int) error {
+	f, err := nvmlFunc(name)
+	if err != nil {
+		return err
+	}
+	return nvmlError(name, call(f))
+}
+
+// nvmlOptional calls the function name of NVML with call, and returns
+// whether it succeeded. The unsupported functions, as the fan speed of the
+// passively cooled GPUs, are no error.
+func nvmlOptional(name string, call func(f unsafe.Pointer) C.int) (bool, error) {
+	f, err := nvmlFunc(name)
+	if err != nil {
+		return false, nil
+	}
+	r := call(f)
+	if r == nvmlNotSupported {
+		return false, nil
+	}
+	return r == nvmlSuccess, nvmlError(name, r)
+}
+
+func readNVMLDevice(index int) (*gpu, error) {
+	var device C.nvmlDevice_t
+	if err := nvmlCall("nvmlDeviceGetHandleByIndex_v2", func(f unsafe.Pointer) C.int {
+		return C.call_u_p(f, C.uint(index), unsafe.Pointer(&device))
+	}); err != nil {
+		return nil, err
+	}
+
+	g := &gpu{index: index, fields: make(map[string]interface{})}
+	str := func(name string, length int) (string, error) {
+		buf := make([]byte, length)
+		err := nvmlCall(name, func(f unsafe.Pointer) C.int {
+			return C.call_d_p_u(f, device, unsafe.Pointer(&buf[0]), C.uint(length))
+		})
+		return C.GoString((*C.char)(unsafe.Pointer(&buf[0]))), err
+	}
+	var err error
+	if g.uuid, err = str("nvmlDeviceGetUUID", 80); err != nil {
+		return nil, err
+	}
+	if g.name, err = str("nvmlDeviceGetName", 96); err != nil {
+		return nil, err
+	}
+
+	// The fields, unless the GPU doesn't support them
+	var utilization C.nvmlUtilization_t
+	if ok, err := nvmlOptional("nvmlDeviceGetUtilizationRates", func(f unsafe.Pointer) C.int {
+		return C.call_d_p(f, device, unsafe.Pointer(&utilization))
+	}); err != nil {
+		return nil, err
+	} else if ok {
+		g.fields["utilization_gpu"] = int64(utilization.gpu)
+		g.fields["utilization_memory"] = int64(utilization.memory)
+	}
+	var memory C.nvmlMemory_t
+	if ok, err := nvmlOptional("nvmlDeviceGetMemoryInfo", func(f unsafe.Pointer) C.int {
+		return C.call_d_p(f, device, unsafe.Pointer(&memory))
+	}); err != nil {
+		return nil, err
+	} else if ok {
+		g.fields["memory_total"] = int64(memory.total >> 20)
+		g.fields["memory_used"] = int64(memory.used >> 20)
+		g.fields["memory_free"] = int64(memory.free >> 20)
+	}
+
+	uints := []struct {
+		name, field string
+		call        func(f unsafe.Pointer, v *C.uint) C.int
+	}{
+		{"nvmlDeviceGetTemperature", "temperature_gpu", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_i_p(f, device, nvmlTemperatureGPU, unsafe.Pointer(v))
+		}},
+		{"nvmlDeviceGetFanSpeed", "fan_speed", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_p(f, device, unsafe.Pointer(v))
+		}},
+		{"nvmlDeviceGetClockInfo", "clocks_graphics", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_i_p(f, device, nvmlClockGraphics, unsafe.Pointer(v))
+		}},
+		{"nvmlDeviceGetClockInfo", "clocks_sm", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_i_p(f, device, nvmlClockSM, unsafe.Pointer(v))
+		}},
+		{"nvmlDeviceGetClockInfo", "clocks_memory", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_i_p(f, device, nvmlClockMem, unsafe.Pointer(v))
+		}},
+		{"nvmlDeviceGetPerformanceState", "pstate", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_p(f, device, unsafe.Pointer(v))
+		}},
+		// Milliwatts
+		{"nvmlDeviceGetPowerUsage", "power_draw", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_p(f, device, unsafe.Pointer(v))
+		}},
+		{"nvmlDeviceGetEnforcedPowerLimit", "power_limit", func(f unsafe.Pointer, v *C.uint) C.int {
+			return C.call_d_p(f, device, unsafe.Pointer(v))
+		}},
+	}
+	for _, u := range uints {
+		var v C.uint
+		ok, err := nvmlOptional(u.name, func(f unsafe.Pointer) C.int {
+			return u.call(f, &v)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if u.field == "power_draw" || u.field == "power_limit" {
+			g.fields[u.field] = float64(v) / 1000
+		} else {
+			g.fields[u.field] = int64(v)
+		}
+	}
+
+	eccs := []struct {
+		field              string
+		errorType, counter int
+	}{
+		{"ecc_errors_corrected_volatile", nvmlMemoryErrorCorrected, nvmlVolatileECC},
+		{"ecc_errors_uncorrected_volatile", nvmlMemoryErrorUncorrected, nvmlVolatileECC},
+		{"ecc_errors_corrected_aggregate", nvmlMemoryErrorCorrected, nvmlAggregateECC},
+		{"ecc_errors_uncorrected_aggregate", nvmlMemoryErrorUncorrected, nvmlAggregateECC},
+	}
+	for _, e := range eccs {
+		var v C.ulonglong
+		// Not supported when ECC is disabled
+		ok, err := nvmlOptional("nvmlDeviceGetTotalEccErrors", func(f unsafe.Pointer) C.int {
+			return C.call_d_i_i_p(f, device, C.int(e.errorType), C.int(e.counter), unsafe.Pointer(&v))
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			g.fields[e.field] = int64(v)
+		}
+	}
+
+	if g.processes, err = readNVMLProcesses(device); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func readNVMLProcesses(device C.nvmlDevice_t) ([]process, error) {
+	var infos []C.nvmlProcessInfo_v1_t
+	for size := 16; ; size *= 2 {
+		count := C.uint(size)
+		infos = make([]C.nvmlProcessInfo_v1_t, size)
+		f, err := nvmlFunc("nvmlDeviceGetComputeRunningProcesses")
+		if err != nil {
+			return nil, nil
+		}
+		r := C.call_d_p_p(f, device, unsafe.Pointer(&count), unsafe.Pointer(&infos[0]))
+		if r == nvmlInsufficentSize && size < 4096 {
+			continue
+		}
+		if r == nvmlNotSupported {
+			return nil, nil
+		}
+		if err := nvmlError("nvmlDeviceGetComputeRunningProcesses", r); err != nil {
+			return nil, err
+		}
+		infos = infos[:count]
+		break
+	}
+
+	var processes []process
+	for _, info := range infos {
+		p := process{
+			pid:        int(info.pid),
+			usedMemory: int64(info.usedGpuMemory >> 20),
+		}
+		buf := make([]byte, 256)
+		// The process may have exited since
+		if f, err := nvmlFunc("nvmlSystemGetProcessName"); err == nil &&
+			C.call_u_p_u(f, info.pid, unsafe.Pointer(&buf[0]), C.uint(len(buf))) == nvmlSuccess {
+			p.name = C.GoString((*C.char)(unsafe.Pointer(&buf[0])))
+		}
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux || !cgo || !nvml
+// +build !linux !cgo !nvml
+
+package nvidia_gpu
+
+// Built without NVML, the GPUs are read with nvidia-smi.
+var readNVML func() ([]*gpu, error)
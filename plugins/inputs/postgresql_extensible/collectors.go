@@ -0,0 +1,116 @@
+package postgresql_extensible
+
+// collectors are the built in queries, by collector name. A collector has
+// one query per measurement and server version, the one of the latest
+// version the server supports is run.
+var collectors = map[string][]gatherQuery{
+	"replication": {
+		{
+			measurement: "postgresql_replication",
+			version:     902,
+			tags:        "application_name,client_addr,state,sync_state",
+			sql: `SELECT application_name, coalesce(client_addr::text, 'local') AS client_addr, state, sync_state,
+  pg_xlog_location_diff(CASE WHEN pg_is_in_recovery() THEN pg_last_xlog_receive_location() ELSE pg_current_xlog_location() END, sent_location)::bigint AS sent_lag_bytes,
+  pg_xlog_location_diff(CASE WHEN pg_is_in_recovery() THEN pg_last_xlog_receive_location() ELSE pg_current_xlog_location() END, replay_location)::bigint AS replay_lag_bytes
+FROM pg_stat_replication`,
+		},
+		{
+			measurement: "postgresql_replication",
+			version:     1000,
+			tags:        "application_name,client_addr,state,sync_state",
+			sql: `SELECT application_name, coalesce(client_addr::text, 'local') AS client_addr, state, sync_state,
+  pg_wal_lsn_diff(CASE WHEN pg_is_in_recovery() THEN pg_last_wal_receive_lsn() ELSE pg_current_wal_lsn() END, sent_lsn)::bigint AS sent_lag_bytes,
+  pg_wal_lsn_diff(CASE WHEN pg_is_in_recovery() THEN pg_last_wal_receive_lsn() ELSE pg_current_wal_lsn() END, replay_lsn)::bigint AS replay_lag_bytes,
+  coalesce(extract(epoch FROM write_lag), 0)::float8 AS write_lag_seconds,
+  coalesce(extract(epoch FROM flush_lag), 0)::float8 AS flush_lag_seconds,
+  coalesce(extract(epoch FROM replay_lag), 0)::float8 AS replay_lag_seconds
+FROM pg_stat_replication`,
+		},
+		// The lag of the replay of a standby, no replay is pending when it
+		// replayed all it received
+		{
+			measurement: "postgresql_standby",
+			version:     902,
+			sql: `SELECT coalesce(pg_xlog_location_diff(pg_last_xlog_receive_location(), pg_last_xlog_replay_location()), 0)::bigint AS replay_lag_bytes,
+  CASE WHEN pg_last_xlog_receive_location() = pg_last_xlog_replay_location() THEN 0
+    ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0) END::float8 AS replay_lag_seconds
+WHERE pg_is_in_recovery()`,
+		},
+		{
+			measurement: "postgresql_standby",
+			version:     1000,
+			sql: `SELECT coalesce(pg_wal_lsn_diff(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn()), 0)::bigint AS replay_lag_bytes,
+  CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+    ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0) END::float8 AS replay_lag_seconds
+WHERE pg_is_in_recovery()`,
+		},
+	},
+	// The bloat is estimated from the size the rows would take in packed
+	// pages, with their average width in the planner statistics: tuple
+	// header and item pointer of 28 bytes, 24 bytes page header, fillfactor
+	// ignored
+	"bloat": {
+		{
+			measurement: "postgresql_bloat",
+			version:     901,
+			perDatabase: true,
+			tags:        "schemaname,relname",
+			sql: `WITH widths AS (
+  SELECT schemaname, tablename, sum((1 - null_frac) * avg_width) AS datawidth
+  FROM pg_stats GROUP BY schemaname, tablename
+), tables AS (
+  SELECT n.nspname AS schemaname, c.relname, c.relpages::bigint AS relpages,
+    current_setting('block_size')::bigint AS bs,
+    ceil(c.reltuples * (ceil((24 + w.datawidth) / 8) * 8 + 4) / (current_setting('block_size')::bigint - 24)) AS est_pages
+  FROM pg_class c
+  JOIN pg_namespace n ON n.oid = c.relnamespace
+  JOIN widths w ON w.schemaname = n.nspname AND w.tablename = c.relname
+  WHERE c.relkind = 'r' AND c.relpages > 0 AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+)
+SELECT current_database() AS datname, schemaname, relname,
+  relpages * bs AS table_bytes,
+  greatest(relpages - est_pages, 0)::bigint * bs AS bloat_bytes,
+  greatest(relpages - est_pages, 0)::float8 / relpages AS bloat_ratio
+FROM tables`,
+		},
+	},
+	// The wait of the locks not granted is counted since the start of the
+	// query of their backend
+	"locks": {
+		{
+			measurement: "postgresql_locks",
+			version:     902,
+			withdbname:  true,
+			tags:        "locktype,mode",
+			sql: `SELECT * FROM (SELECT coalesce(d.datname, a.datname) AS datname, l.locktype, l.mode,
+  count(*) AS locks,
+  sum(CASE WHEN l.granted THEN 0 ELSE 1 END) AS waiting,
+  coalesce(max(CASE WHEN l.granted THEN NULL ELSE extract(epoch FROM now() - a.query_start) END), 0)::float8 AS max_wait_seconds
+FROM pg_locks l
+LEFT JOIN pg_database d ON d.oid = l.database
+LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+GROUP BY 1, l.locktype, l.mode) AS locks WHERE datname`,
+		},
+	},
+}
+
+// latestQueries returns the query of the latest version supported by the
+// server version of each measurement of queries.
+func latestQueries(queries []gatherQuery, version int) []gatherQuery {
+	var latest []gatherQuery
+	index := make(map[string]int)
+	for _, q := range queries {
+		if q.version > version {
+			continue
+		}
+		if i, ok := index[q.measurement]; ok {
+			if q.version > latest[i].version {
+				latest[i] = q
+			}
+			continue
+		}
+		index[q.measurement] = len(latest)
+		latest = append(latest, q)
+	}
+	return latest
+}
@@ -3,9 +3,11 @@ package postgresql_extensible
 import (
 	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/plugins/inputs"
@@ -21,18 +23,43 @@ type Postgresql struct {
 	AdditionalTags   []string
 	sanitizedAddress string
 	Query            []struct {
-		Sqlquery   string
-		Version    int
-		Withdbname bool
-		Tagvalue   string
+		Sqlquery    string
+		Version     int
+		Withdbname  bool
+		Tagvalue    string
+		Measurement string
+		Perdatabase bool
 	}
+	Collectors []string
+
+	// Connections opened to each database, kept between the gathers
+	MaxOpenConnections int `toml:"max_open_connections"`
+
+	driver string
+	// mu guards the pools, a gather abandoned by the watchdog may still use
+	// them while the instance is closed
+	mu     sync.Mutex
+	pools  map[string]*sql.DB
+	closed bool
 }
 
 type query []struct {
-	Sqlquery   string
-	Version    int
-	Withdbname bool
-	Tagvalue   string
+	Sqlquery    string
+	Version     int
+	Withdbname  bool
+	Tagvalue    string
+	Measurement string
+	Perdatabase bool
+}
+
+// gatherQuery is a query run by the plugin, from the config or built in.
+type gatherQuery struct {
+	sql         string
+	version     int
+	withdbname  bool
+	tags        string
+	measurement string
+	perDatabase bool
 }
 
 var ignoredColumns = map[string]bool{"datid": true, "datname": true, "stats_reset": true}
@@ -83,6 +110,21 @@ var sampleConfig = `
     version=901
     withdbname=false
     tagvalue=""
+  ## The measurement of the query rows, defaults to "postgresql"
+  #  measurement="postgresql"
+  ## Run the query in each database of the databases field, or all the
+  ## databases when it is empty, instead of the database of the address
+  #  perdatabase=false
+  #
+  ## Built in collectors to run: "replication" for the replication lag of the
+  ## standbys on the primary and on the standby itself, "bloat" for the
+  ## estimated bloat of the tables of each database and "locks" for the
+  ## granted and waiting locks
+  # collectors = ["replication", "bloat", "locks"]
+  #
+  ## Maximum number of connections opened to each database, they are kept
+  ## open between the collections
+  # max_open_connections = 1
 `
 
 func (p *Postgresql) SampleConfig() string {
@@ -100,86 +142,234 @@ func (p *Postgresql) IgnoredColumns() map[string]bool {
 var localhost = "host=localhost sslmode=disable"
 
 func (p *Postgresql) Gather(acc telegraf.Accumulator) error {
-
-	var sql_query string
-	var query_addon string
 	var db_version int
-	var query string
-	var tag_value string
 
 	if p.Address == "" || p.Address == "localhost" {
 		p.Address = localhost
 	}
 
-	db, err := sql.Open("postgres", p.Address)
+	db, err := p.database("")
 	if err != nil {
 		return err
 	}
 
-	defer db.Close()
-
-	// Retreiving the database version
+	// Retreiving the database version, e.g. 906 for 9.6 and 1000 for 10.0
 
-	query = `select substring(setting from 1 for 3) as version from pg_settings where name='server_version_num'`
-	err = db.QueryRow(query).Scan(&db_version)
+	err = db.QueryRow(`select setting::integer / 100 as version from pg_settings where name='server_version_num'`).Scan(&db_version)
 	if err != nil {
 		return err
 	}
+
+	queries := make([]gatherQuery, 0, len(p.Query))
+	for _, q := range p.Query {
+		queries = append(queries, gatherQuery{
+			sql:         q.Sqlquery,
+			version:     q.Version,
+			withdbname:  q.Withdbname,
+			tags:        q.Tagvalue,
+			measurement: q.Measurement,
+			perDatabase: q.Perdatabase,
+		})
+	}
+	for _, name := range p.Collectors {
+		builtin, ok := collectors[name]
+		if !ok {
+			return fmt.Errorf("unknown postgresql_extensible collector %q", name)
+		}
+		queries = append(queries, latestQueries(builtin, db_version)...)
+	}
+
 	// We loop in order to process each query
 	// Query is not run if Database version does not match the query version.
 
-	for i := range p.Query {
-		sql_query = p.Query[i].Sqlquery
-		tag_value = p.Query[i].Tagvalue
-
-		if p.Query[i].Withdbname {
-			if len(p.Databases) != 0 {
-				query_addon = fmt.Sprintf(` IN ('%s')`,
-					strings.Join(p.Databases, "','"))
-			} else {
-				query_addon = " is not null"
+	var databases []string
+	for _, q := range queries {
+		if q.version > db_version {
+			continue
+		}
+		if !q.perDatabase {
+			if err := p.runQuery(db, "", q, acc); err != nil {
+				return err
 			}
-		} else {
-			query_addon = ""
+			continue
 		}
-		sql_query += query_addon
 
-		if p.Query[i].Version <= db_version {
-			rows, err := db.Query(sql_query)
+		if databases == nil {
+			databases, err = p.listDatabases(db)
 			if err != nil {
 				return err
 			}
-
-			defer rows.Close()
-
-			// grab the column information from the result
-			p.OrderedColumns, err = rows.Columns()
+		}
+		for _, name := range databases {
+			dbConn, err := p.database(name)
 			if err != nil {
 				return err
-			} else {
-				for _, v := range p.OrderedColumns {
-					p.AllColumns = append(p.AllColumns, v)
-				}
-			}
-			p.AdditionalTags = nil
-			if tag_value != "" {
-				tag_list := strings.Split(tag_value, ",")
-				for t := range tag_list {
-					p.AdditionalTags = append(p.AdditionalTags, tag_list[t])
-				}
 			}
-
-			for rows.Next() {
-				err = p.accRow(rows, acc)
-				if err != nil {
-					return err
-				}
+			if err := p.runQuery(dbConn, name, q, acc); err != nil {
+				return fmt.Errorf("database %s: %s", name, err)
 			}
 		}
 	}
 	return nil
 }
 
+// runQuery runs q on db and adds a metric for each row, tagged with the
+// database name when the rows have no datname column.
+func (p *Postgresql) runQuery(db *sql.DB, name string, q gatherQuery, acc telegraf.Accumulator) error {
+	var query_addon string
+
+	if q.withdbname {
+		if len(p.Databases) != 0 {
+			query_addon = fmt.Sprintf(` IN ('%s')`,
+				strings.Join(p.Databases, "','"))
+		} else {
+			query_addon = " is not null"
+		}
+	}
+
+	rows, err := db.Query(q.sql + query_addon)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// grab the column information from the result
+	p.OrderedColumns, err = rows.Columns()
+	if err != nil {
+		return err
+	}
+	p.AllColumns = append(p.AllColumns, p.OrderedColumns...)
+
+	p.AdditionalTags = nil
+	if q.tags != "" {
+		p.AdditionalTags = strings.Split(q.tags, ",")
+	}
+
+	measurement := q.measurement
+	if measurement == "" {
+		measurement = "postgresql"
+	}
+	for rows.Next() {
+		err = p.accRow(measurement, name, rows, acc)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// listDatabases returns the databases the per database queries are run in,
+// and closes the connections to the databases that no longer exist.
+func (p *Postgresql) listDatabases(db *sql.DB) ([]string, error) {
+	if len(p.Databases) != 0 {
+		return p.Databases, nil
+	}
+
+	rows, err := db.Query(`SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	databases := []string{}
+	exists := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		databases = append(databases, name)
+		exists[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, pool := range p.pools {
+		if name != "" && !exists[name] {
+			pool.Close()
+			delete(p.pools, name)
+		}
+	}
+	return databases, nil
+}
+
+// Close closes the connections to the databases, the instance doesn't
+// gather anymore.
+func (p *Postgresql) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for name, pool := range p.pools {
+		if e := pool.Close(); e != nil {
+			err = e
+		}
+		delete(p.pools, name)
+	}
+	p.closed = true
+	return err
+}
+
+// database returns the connection pool of the database name, or of the
+// database of the address if name is empty.
+func (p *Postgresql) database(name string) (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, errors.New("postgresql_extensible: the input is closed")
+	}
+	if db, ok := p.pools[name]; ok {
+		return db, nil
+	}
+
+	address := p.Address
+	if name != "" {
+		var err error
+		address, err = databaseAddress(p.Address, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	driver := p.driver
+	if driver == "" {
+		driver = "postgres"
+	}
+	db, err := sql.Open(driver, address)
+	if err != nil {
+		return nil, err
+	}
+	max := p.MaxOpenConnections
+	if max <= 0 {
+		max = 1
+	}
+	db.SetMaxOpenConns(max)
+	db.SetMaxIdleConns(max)
+
+	if p.pools == nil {
+		p.pools = make(map[string]*sql.DB)
+	}
+	p.pools[name] = db
+	return db, nil
+}
+
+// databaseAddress returns address with its dbname replaced by name.
+func databaseAddress(address, name string) (string, error) {
+	if strings.HasPrefix(address, "postgres://") || strings.HasPrefix(address, "postgresql://") {
+		var err error
+		address, err = pq.ParseURL(address)
+		if err != nil {
+			return "", err
+		}
+	}
+	// The last value of a key wins in the connection strings
+	name = strings.Replace(name, `\`, `\\`, -1)
+	name = strings.Replace(name, `'`, `\'`, -1)
+	return address + " dbname='" + name + "'", nil
+}
+
 type scanner interface {
 	Scan(dest ...interface{}) error
 }
@@ -201,7 +391,7 @@ func (p *Postgresql) SanitizedAddress() (_ string, err error) {
 	return p.sanitizedAddress, err
 }
 
-func (p *Postgresql) accRow(row scanner, acc telegraf.Accumulator) error {
+func (p *Postgresql) accRow(measurement string, database string, row scanner, acc telegraf.Accumulator) error {
 	var columnVars []interface{}
 	var dbname bytes.Buffer
 
@@ -223,12 +413,14 @@ func (p *Postgresql) accRow(row scanner, acc telegraf.Accumulator) error {
 	if err != nil {
 		return err
 	}
-	if columnMap["datname"] != nil {
+	if columnMap["datname"] != nil && *columnMap["datname"] != nil {
 		// extract the database name from the column map
 		dbnameChars := (*columnMap["datname"]).([]uint8)
 		for i := 0; i < len(dbnameChars); i++ {
 			dbname.WriteString(string(dbnameChars[i]))
 		}
+	} else if database != "" {
+		dbname.WriteString(database)
 	} else {
 		dbname.WriteString("postgres")
 	}
@@ -267,7 +459,7 @@ func (p *Postgresql) accRow(row scanner, acc telegraf.Accumulator) error {
 			}
 		}
 	}
-	acc.AddFields("postgresql", fields, tags)
+	acc.AddFields(measurement, fields, tags)
 	return nil
 }
 
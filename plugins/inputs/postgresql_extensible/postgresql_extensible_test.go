@@ -1,7 +1,13 @@
 package postgresql_extensible
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/influxdata/telegraf/testutil"
@@ -96,3 +102,219 @@ func TestPostgresqlIgnoresUnwantedColumns(t *testing.T) {
 		assert.False(t, acc.HasMeasurement(col))
 	}
 }
+
+// fakeDriver is a database/sql driver answering the queries with handler.
+type fakeDriver struct {
+	mu      sync.Mutex
+	dsns    []string
+	closed  int
+	handler func(dsn, query string) ([]string, [][]driver.Value, error)
+}
+
+var fake = &fakeDriver{}
+
+func init() {
+	sql.Register("postgresql_extensible_fake", fake)
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dsns = append(d.dsns, dsn)
+	return &fakeConn{dsn: dsn}, nil
+}
+
+type fakeConn struct {
+	dsn string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{dsn: c.dsn, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.closed++
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	dsn, query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec is not supported")
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	columns, rows, err := fake.handler(s.dsn, s.query)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// dsnValues returns the values of the keys of a connection string, the last
+// value of a key winning.
+func dsnValues(dsn string) map[string]string {
+	values := make(map[string]string)
+	for _, kv := range strings.Fields(dsn) {
+		if i := strings.Index(kv, "="); i > 0 {
+			values[kv[:i]] = strings.Trim(kv[i+1:], "'")
+		}
+	}
+	return values
+}
+
+// dsnDatabase returns the last dbname of a connection string.
+func dsnDatabase(dsn string) string {
+	return dsnValues(dsn)["dbname"]
+}
+
+func TestPostgresqlCollectors(t *testing.T) {
+	var queries []string
+	fake.dsns, fake.closed = nil, 0
+	fake.handler = func(dsn, query string) ([]string, [][]driver.Value, error) {
+		queries = append(queries, query)
+		switch {
+		case strings.Contains(query, "server_version_num"):
+			return []string{"version"}, [][]driver.Value{{int64(906)}}, nil
+		case strings.Contains(query, "FROM pg_database WHERE"):
+			return []string{"datname"}, [][]driver.Value{{[]byte("app")}, {[]byte("billing")}}, nil
+		case strings.Contains(query, "pg_stat_replication"):
+			return []string{"application_name", "client_addr", "state",
+					"sync_state", "sent_lag_bytes", "replay_lag_bytes"},
+				[][]driver.Value{{[]byte("replica-1"), []byte("10.0.0.2"),
+					[]byte("streaming"), []byte("async"), int64(0), int64(4096)}}, nil
+		case strings.Contains(query, "pg_last_xact_replay_timestamp"):
+			// Not a standby
+			return []string{"replay_lag_bytes", "replay_lag_seconds"}, nil, nil
+		case strings.Contains(query, "pg_stats"):
+			return []string{"datname", "schemaname", "relname",
+					"table_bytes", "bloat_bytes", "bloat_ratio"},
+				[][]driver.Value{{[]byte(dsnDatabase(dsn)), []byte("public"), []byte("events"), int64(81920), int64(16384), 0.2}}, nil
+		case strings.Contains(query, "pg_locks"):
+			return []string{"datname", "locktype", "mode", "locks", "waiting", "max_wait_seconds"},
+				[][]driver.Value{{[]byte("app"), []byte("relation"),
+					[]byte("AccessExclusiveLock"), int64(3), int64(2), 1.5}}, nil
+		case strings.Contains(query, "FROM jobs"):
+			return []string{"queued"}, [][]driver.Value{{int64(7)}}, nil
+		}
+		return nil, nil, fmt.Errorf("unexpected query %s", query)
+	}
+
+	p := &Postgresql{
+		Address: "postgres://telegraf@localhost/postgres?sslmode=disable",
+		Query: query{
+			{Sqlquery: "SELECT count(*) AS queued FROM jobs",
+				Version:     901,
+				Measurement: "postgresql_jobs",
+				Perdatabase: true},
+			{Sqlquery: "SELECT count(*) AS queued FROM jobs_v2",
+				Version: 1000},
+		},
+		Collectors: []string{"replication", "bloat", "locks"},
+		driver:     "postgresql_extensible_fake",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, p.Gather(&acc))
+
+	// The server tag is the address converted to a sanitized connection
+	// string, whose keys pq may order or quote differently
+	require.NotEmpty(t, acc.Metrics)
+	server := acc.Metrics[0].Tags["server"]
+	values := map[string]string{"host": "localhost", "dbname": "postgres",
+		"sslmode": "disable", "user": "telegraf"}
+	assert.Equal(t, values, dsnValues(server))
+	for _, db := range []string{"app", "billing"} {
+		acc.AssertContainsTaggedFields(t, "postgresql_jobs",
+			map[string]interface{}{"queued": int64(7)},
+			map[string]string{"server": server, "db": db})
+	}
+	acc.AssertContainsTaggedFields(t, "postgresql_replication",
+		map[string]interface{}{"sent_lag_bytes": int64(0), "replay_lag_bytes": int64(4096)},
+		map[string]string{"server": server, "db": "postgres",
+			"application_name": "replica-1", "client_addr": "10.0.0.2",
+			"state": "streaming", "sync_state": "async"})
+	for _, db := range []string{"app", "billing"} {
+		acc.AssertContainsTaggedFields(t, "postgresql_bloat",
+			map[string]interface{}{"table_bytes": int64(81920),
+				"bloat_bytes": int64(16384), "bloat_ratio": 0.2},
+			map[string]string{"server": server, "db": db,
+				"schemaname": "public", "relname": "events"})
+	}
+	acc.AssertContainsTaggedFields(t, "postgresql_locks",
+		map[string]interface{}{"locks": int64(3), "waiting": int64(2),
+			"max_wait_seconds": 1.5},
+		map[string]string{"server": server, "db": "app",
+			"locktype": "relation", "mode": "AccessExclusiveLock"})
+	assert.Equal(t, 6, len(acc.Metrics))
+
+	// The 9.x queries of the collectors are run, and the query above the
+	// server version is not
+	for _, q := range queries {
+		assert.NotContains(t, q, "jobs_v2")
+		assert.NotContains(t, q, "pg_wal_lsn_diff")
+	}
+	assert.Contains(t, queries, collectors["locks"][0].sql+" is not null")
+
+	// The connections to each database are kept between the gathers
+	require.NoError(t, p.Gather(&acc))
+	require.Len(t, fake.dsns, 3)
+	assert.Equal(t, p.Address, fake.dsns[0])
+	for i, db := range []string{"app", "billing"} {
+		values["dbname"] = db
+		assert.Equal(t, values, dsnValues(fake.dsns[i+1]))
+	}
+
+	p.Collectors = []string{"vacuum"}
+	assert.Error(t, p.Gather(&acc))
+
+	// Closing the discarded instance closes its connections
+	require.NoError(t, p.Close())
+	assert.Equal(t, 3, fake.closed)
+	assert.Empty(t, p.pools)
+	assert.Error(t, p.Gather(&acc))
+}
+
+func TestLatestQueries(t *testing.T) {
+	queries := latestQueries(collectors["replication"], 1000)
+	require.Len(t, queries, 2)
+	assert.Equal(t, "postgresql_replication", queries[0].measurement)
+	assert.Equal(t, 1000, queries[0].version)
+	assert.Equal(t, "postgresql_standby", queries[1].measurement)
+	assert.Equal(t, 1000, queries[1].version)
+
+	assert.Empty(t, latestQueries(collectors["replication"], 901))
+}
+
+func TestDatabaseAddress(t *testing.T) {
+	address, err := databaseAddress("host=localhost dbname=postgres", `it's`)
+	require.NoError(t, err)
+	assert.Equal(t, `host=localhost dbname=postgres dbname='it\'s'`, address)
+}
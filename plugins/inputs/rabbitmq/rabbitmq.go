@@ -2,6 +2,7 @@ package rabbitmq
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,6 +10,8 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/plugins/inputs"
+
+	"github.com/prometheus/common/expfmt"
 )
 
 const DefaultUsername = "guest"
@@ -23,6 +26,9 @@ type RabbitMQ struct {
 	Nodes    []string
 	Queues   []string
 
+	// rabbitmq_prometheus endpoint, for the Raft metrics of quorum queues
+	PrometheusURL string `toml:"prometheus_url"`
+
 	Client *http.Client
 }
 
@@ -79,6 +85,43 @@ type Queue struct {
 	Vhost               string
 	Durable             bool
 	AutoDelete          bool `json:"auto_delete"`
+	// classic, quorum or stream, empty before RabbitMQ 3.8
+	Type string
+	// Raft members of quorum queues and streams
+	Leader  string
+	Members []string
+	Online  []string
+}
+
+// queueRef names the stream of a stream publisher or consumer.
+type queueRef struct {
+	Name  string
+	Vhost string
+}
+
+type StreamPublisher struct {
+	Queue     queueRef
+	Published int64
+	Confirmed int64
+	Errored   int64
+}
+
+type StreamConsumer struct {
+	Queue     queueRef
+	Consumed  int64
+	Offset    int64
+	OffsetLag int64 `json:"offset_lag"`
+}
+
+// raftMetrics are the ra_metrics of the rabbitmq_prometheus plugin, by the
+// field they are reported as.
+var raftMetrics = map[string]string{
+	"rabbitmq_detailed_raft_term_total":                   "raft_term",
+	"rabbitmq_detailed_raft_log_commit_index":             "raft_commit_index",
+	"rabbitmq_detailed_raft_log_last_applied_index":       "raft_last_applied_index",
+	"rabbitmq_detailed_raft_log_last_written_index":       "raft_last_written_index",
+	"rabbitmq_detailed_raft_log_snapshot_index":           "raft_snapshot_index",
+	"rabbitmq_detailed_raft_entry_commit_latency_seconds": "commit_latency_seconds",
 }
 
 type Node struct {
@@ -110,6 +153,11 @@ var sampleConfig = `
   ## A list of nodes to pull metrics about. If not specified, metrics for
   ## all nodes are gathered.
   # nodes = ["rabbit@node1", "rabbit@node2"]
+
+  ## Endpoint of the rabbitmq_prometheus plugin, RabbitMQ 3.10 and later,
+  ## to read the Raft term, indexes and commit latency of the quorum queues.
+  ## The quorum queues and streams are reported without them if not set.
+  # prometheus_url = "http://localhost:15692"
 `
 
 func (r *RabbitMQ) SampleConfig() string {
@@ -172,11 +220,19 @@ func (r *RabbitMQ) requestJSON(u string, target interface{}) error {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+
 	json.NewDecoder(resp.Body).Decode(target)
 
 	return nil
 }
 
+// errNotFound is returned by requestJSON for the endpoints of the plugins
+// not enabled.
+var errNotFound = errors.New("rabbitmq: endpoint not found")
+
 func gatherOverview(r *RabbitMQ, acc telegraf.Accumulator, errChan chan error) {
 	overview := &OverviewResponse{}
 
@@ -259,10 +315,17 @@ func gatherQueues(r *RabbitMQ, acc telegraf.Accumulator, errChan chan error) {
 		return
 	}
 
+	var quorumQueues, streams []Queue
 	for _, queue := range queues {
 		if !r.shouldGatherQueue(queue) {
 			continue
 		}
+		switch queue.Type {
+		case "quorum":
+			quorumQueues = append(quorumQueues, queue)
+		case "stream":
+			streams = append(streams, queue)
+		}
 		tags := map[string]string{
 			"url":         r.URL,
 			"queue":       queue.Name,
@@ -303,9 +366,174 @@ func gatherQueues(r *RabbitMQ, acc telegraf.Accumulator, errChan chan error) {
 		)
 	}
 
+	if len(quorumQueues) > 0 {
+		if err := gatherQuorumQueues(r, quorumQueues, acc); err != nil {
+			errChan <- err
+			return
+		}
+	}
+	if len(streams) > 0 {
+		if err := gatherStreams(r, streams, acc); err != nil {
+			errChan <- err
+			return
+		}
+	}
+
 	errChan <- nil
 }
 
+// raftFields returns the fields and tags common to quorum queues and
+// streams, replicated with Raft.
+func raftFields(r *RabbitMQ, queue Queue) (map[string]interface{}, map[string]string) {
+	tags := map[string]string{
+		"url":   r.URL,
+		"queue": queue.Name,
+		"vhost": queue.Vhost,
+	}
+	fields := map[string]interface{}{
+		"leader":          queue.Leader,
+		"members":         int64(len(queue.Members)),
+		"members_online":  int64(len(queue.Online)),
+		"members_offline": int64(len(queue.Members) - len(queue.Online)),
+		"memory":          queue.Memory,
+		"messages":        queue.Messages,
+		"consumers":       queue.Consumers,
+	}
+	return fields, tags
+}
+
+func gatherQuorumQueues(r *RabbitMQ, queues []Queue, acc telegraf.Accumulator) error {
+	var raft map[queueRef]map[string]interface{}
+	if r.PrometheusURL != "" {
+		var err error
+		if raft, err = r.requestRaftMetrics(); err != nil {
+			return err
+		}
+	}
+
+	for _, queue := range queues {
+		fields, tags := raftFields(r, queue)
+		fields["messages_ready"] = queue.MessagesReady
+		fields["messages_unack"] = queue.MessagesUnacknowledged
+		for k, v := range raft[queueRef{Name: queue.Name, Vhost: queue.Vhost}] {
+			fields[k] = v
+		}
+		acc.AddFields("rabbitmq_quorum_queue", fields, tags)
+	}
+	return nil
+}
+
+// requestRaftMetrics returns the ra_metrics of each queue from the detailed
+// endpoint of the rabbitmq_prometheus plugin.
+func (r *RabbitMQ) requestRaftMetrics() (map[queueRef]map[string]interface{}, error) {
+	u := fmt.Sprintf("%s/metrics/detailed?family=ra_metrics", r.PrometheusURL)
+	resp, err := r.Client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP status %s", u, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading Raft metrics from %s: %s", u, err)
+	}
+
+	metrics := make(map[queueRef]map[string]interface{})
+	for name, family := range families {
+		field, ok := raftMetrics[name]
+		if !ok {
+			continue
+		}
+		for _, m := range family.Metric {
+			var ref queueRef
+			for _, label := range m.Label {
+				switch label.GetName() {
+				case "queue":
+					ref.Name = label.GetValue()
+				case "vhost":
+					ref.Vhost = label.GetValue()
+				}
+			}
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.Gauge.GetValue()
+			case m.Counter != nil:
+				value = m.Counter.GetValue()
+			case m.Untyped != nil:
+				value = m.Untyped.GetValue()
+			default:
+				continue
+			}
+			if metrics[ref] == nil {
+				metrics[ref] = make(map[string]interface{})
+			}
+			if field == "commit_latency_seconds" {
+				metrics[ref][field] = value
+			} else {
+				metrics[ref][field] = int64(value)
+			}
+		}
+	}
+	return metrics, nil
+}
+
+func gatherStreams(r *RabbitMQ, streams []Queue, acc telegraf.Accumulator) error {
+	// The publishers and consumers are listed by the
+	// rabbitmq_stream_management plugin
+	publishers := make([]StreamPublisher, 0)
+	err := r.requestJSON("/api/stream/publishers", &publishers)
+	if err != nil && err != errNotFound {
+		return err
+	}
+	consumers := make([]StreamConsumer, 0)
+	err = r.requestJSON("/api/stream/consumers", &consumers)
+	if err != nil && err != errNotFound {
+		return err
+	}
+
+	for _, stream := range streams {
+		ref := queueRef{Name: stream.Name, Vhost: stream.Vhost}
+		fields, tags := raftFields(r, stream)
+
+		var count, published, confirmed, errored int64
+		for _, p := range publishers {
+			if p.Queue == ref {
+				count++
+				published += p.Published
+				confirmed += p.Confirmed
+				errored += p.Errored
+			}
+		}
+		fields["publishers"] = count
+		fields["published"] = published
+		fields["confirmed"] = confirmed
+		fields["publish_errors"] = errored
+
+		var consumed, maxLag int64
+		count = 0
+		for _, c := range consumers {
+			if c.Queue == ref {
+				count++
+				consumed += c.Consumed
+				if c.OffsetLag > maxLag {
+					maxLag = c.OffsetLag
+				}
+			}
+		}
+		fields["stream_consumers"] = count
+		fields["consumed"] = consumed
+		fields["offset_lag_max"] = maxLag
+
+		acc.AddFields("rabbitmq_stream", fields, tags)
+	}
+	return nil
+}
+
 func (r *RabbitMQ) shouldGatherNode(node Node) bool {
 	if len(r.Nodes) == 0 {
 		return true
@@ -442,3 +442,183 @@ func TestRabbitMQGeneratesMetrics(t *testing.T) {
 
 	assert.True(t, acc.HasMeasurement("rabbitmq_queue"))
 }
+
+const sampleRaftQueuesResponse = `
+[
+  {
+    "name": "orders",
+    "vhost": "/",
+    "type": "quorum",
+    "node": "rabbit@node1",
+    "leader": "rabbit@node1",
+    "members": ["rabbit@node1", "rabbit@node2", "rabbit@node3"],
+    "online": ["rabbit@node1", "rabbit@node2"],
+    "memory": 143752,
+    "messages": 12,
+    "messages_ready": 10,
+    "messages_unacknowledged": 2,
+    "consumers": 1,
+    "durable": true
+  },
+  {
+    "name": "events",
+    "vhost": "/",
+    "type": "stream",
+    "node": "rabbit@node2",
+    "leader": "rabbit@node2",
+    "members": ["rabbit@node1", "rabbit@node2", "rabbit@node3"],
+    "online": ["rabbit@node1", "rabbit@node2", "rabbit@node3"],
+    "memory": 38560,
+    "messages": 5000,
+    "consumers": 2,
+    "durable": true
+  },
+  {
+    "name": "classic",
+    "vhost": "/",
+    "type": "classic",
+    "node": "rabbit@node1",
+    "memory": 21960,
+    "durable": false
+  }
+]
+`
+
+const sampleStreamPublishersResponse = `
+[
+  {"queue": {"name": "events", "vhost": "/"}, "published": 5000, "confirmed": 4990, "errored": 3},
+  {"queue": {"name": "events", "vhost": "/"}, "published": 100, "confirmed": 100, "errored": 0},
+  {"queue": {"name": "events", "vhost": "other"}, "published": 7, "confirmed": 7, "errored": 0}
+]
+`
+
+const sampleStreamConsumersResponse = `
+[
+  {"queue": {"name": "events", "vhost": "/"}, "consumed": 4000, "offset": 4000, "offset_lag": 1100},
+  {"queue": {"name": "events", "vhost": "/"}, "consumed": 5090, "offset": 5090, "offset_lag": 10}
+]
+`
+
+const sampleRaftMetrics = `# TYPE rabbitmq_detailed_raft_term_total counter
+rabbitmq_detailed_raft_term_total{vhost="/",queue="orders"} 4
+# TYPE rabbitmq_detailed_raft_log_snapshot_index gauge
+rabbitmq_detailed_raft_log_snapshot_index{vhost="/",queue="orders"} 0
+# TYPE rabbitmq_detailed_raft_log_last_applied_index gauge
+rabbitmq_detailed_raft_log_last_applied_index{vhost="/",queue="orders"} 1042
+# TYPE rabbitmq_detailed_raft_log_commit_index gauge
+rabbitmq_detailed_raft_log_commit_index{vhost="/",queue="orders"} 1043
+# TYPE rabbitmq_detailed_raft_log_last_written_index gauge
+rabbitmq_detailed_raft_log_last_written_index{vhost="/",queue="orders"} 1043
+# TYPE rabbitmq_detailed_raft_entry_commit_latency_seconds gauge
+rabbitmq_detailed_raft_entry_commit_latency_seconds{vhost="/",queue="orders"} 0.004
+`
+
+func TestRabbitMQQuorumQueuesAndStreams(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rsp string
+
+		switch r.URL.Path {
+		case "/api/overview":
+			rsp = sampleOverviewResponse
+		case "/api/nodes":
+			rsp = sampleNodesResponse
+		case "/api/queues":
+			rsp = sampleRaftQueuesResponse
+		case "/api/stream/publishers":
+			rsp = sampleStreamPublishersResponse
+		case "/api/stream/consumers":
+			rsp = sampleStreamConsumersResponse
+		case "/metrics/detailed":
+			assert.Equal(t, "ra_metrics", r.URL.Query().Get("family"))
+			rsp = sampleRaftMetrics
+		default:
+			panic("Cannot handle request")
+		}
+
+		fmt.Fprintln(w, rsp)
+	}))
+	defer ts.Close()
+
+	r := &RabbitMQ{
+		URL:           ts.URL,
+		PrometheusURL: ts.URL,
+	}
+
+	var acc testutil.Accumulator
+
+	err := r.Gather(&acc)
+	require.NoError(t, err)
+
+	acc.AssertContainsTaggedFields(t, "rabbitmq_quorum_queue",
+		map[string]interface{}{
+			"leader":                  "rabbit@node1",
+			"members":                 int64(3),
+			"members_online":          int64(2),
+			"members_offline":         int64(1),
+			"memory":                  int64(143752),
+			"messages":                int64(12),
+			"messages_ready":          int64(10),
+			"messages_unack":          int64(2),
+			"consumers":               int64(1),
+			"raft_term":               int64(4),
+			"raft_commit_index":       int64(1043),
+			"raft_last_applied_index": int64(1042),
+			"raft_last_written_index": int64(1043),
+			"raft_snapshot_index":     int64(0),
+			"commit_latency_seconds":  0.004,
+		},
+		map[string]string{"url": ts.URL, "queue": "orders", "vhost": "/"})
+
+	acc.AssertContainsTaggedFields(t, "rabbitmq_stream",
+		map[string]interface{}{
+			"leader":           "rabbit@node2",
+			"members":          int64(3),
+			"members_online":   int64(3),
+			"members_offline":  int64(0),
+			"memory":           int64(38560),
+			"messages":         int64(5000),
+			"consumers":        int64(2),
+			"publishers":       int64(2),
+			"published":        int64(5100),
+			"confirmed":        int64(5090),
+			"publish_errors":   int64(3),
+			"stream_consumers": int64(2),
+			"consumed":         int64(9090),
+			"offset_lag_max":   int64(1100),
+		},
+		map[string]string{"url": ts.URL, "queue": "events", "vhost": "/"})
+}
+
+func TestRabbitMQStreamsWithoutStreamManagement(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rsp string
+
+		switch r.URL.Path {
+		case "/api/overview":
+			rsp = sampleOverviewResponse
+		case "/api/nodes":
+			rsp = sampleNodesResponse
+		case "/api/queues":
+			rsp = sampleRaftQueuesResponse
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintln(w, rsp)
+	}))
+	defer ts.Close()
+
+	r := &RabbitMQ{
+		URL: ts.URL,
+	}
+
+	var acc testutil.Accumulator
+
+	err := r.Gather(&acc)
+	require.NoError(t, err)
+
+	assert.True(t, acc.HasMeasurement("rabbitmq_quorum_queue"))
+	assert.False(t, acc.HasIntField("rabbitmq_quorum_queue", "raft_term"))
+	assert.True(t, acc.HasIntField("rabbitmq_stream", "publishers"))
+}
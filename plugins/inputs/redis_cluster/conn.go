@@ -0,0 +1,109 @@
+package redis_cluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// conn is a connection to a node of the cluster.
+type conn struct {
+	c       net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+// dial connects to the node at addr, authenticating with password if it is
+// not empty.
+func dial(addr, password string, timeout time.Duration) (*conn, error) {
+	c, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to redis node '%s': %s", addr, err)
+	}
+	r := &conn{c: c, reader: bufio.NewReader(c), timeout: timeout}
+	if password != "" {
+		if _, err := r.do("AUTH", password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *conn) close() error {
+	return r.c.Close()
+}
+
+// doString sends a command with a bulk string reply.
+func (r *conn) doString(args ...string) (string, error) {
+	reply, err := r.do(args...)
+	if err != nil {
+		return "", err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("Unexpected %s reply %v", args[0], reply)
+	}
+	return s, nil
+}
+
+// do sends a command and returns its reply: a string, an int64, a slice
+// of replies, or nil.
+func (r *conn) do(args ...string) (interface{}, error) {
+	r.c.SetDeadline(time.Now().Add(r.timeout))
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.c, command); err != nil {
+		return nil, err
+	}
+	return r.readReply()
+}
+
+func (r *conn) readReply() (interface{}, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis protocol error")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = r.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, errors.New("redis protocol error")
+}
@@ -0,0 +1,222 @@
+package redis_cluster
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode is a Redis server answering the commands with replies.
+type fakeNode struct {
+	l       net.Listener
+	replies map[string]string
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	n := &fakeNode{l: l, replies: make(map[string]string)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(c)
+		}
+	}()
+	return n
+}
+
+func (n *fakeNode) addr() string {
+	return n.l.Addr().String()
+}
+
+func (n *fakeNode) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.Join(args, " "))
+		reply, ok := n.replies[command]
+		if !ok {
+			fmt.Fprintf(c, "-ERR unknown command '%s'\r\n", command)
+			continue
+		}
+		if strings.HasPrefix(reply, "+") || strings.HasPrefix(reply, "-") {
+			fmt.Fprintf(c, "%s\r\n", reply)
+		} else {
+			fmt.Fprintf(c, "$%d\r\n%s\r\n", len(reply), reply)
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimRight(arg, "\r\n")
+	}
+	return args, nil
+}
+
+const clusterInfo = "cluster_state:ok\r\ncluster_slots_assigned:16384\r\n" +
+	"cluster_slots_ok:16384\r\ncluster_slots_pfail:0\r\ncluster_slots_fail:0\r\n" +
+	"cluster_known_nodes:4\r\ncluster_size:2\r\ncluster_current_epoch:6\r\n"
+
+func TestRedisCluster(t *testing.T) {
+	master1, master2, slave := newFakeNode(t), newFakeNode(t), newFakeNode(t)
+	defer master1.l.Close()
+	defer master2.l.Close()
+	defer slave.l.Close()
+
+	_, masterPort, _ := net.SplitHostPort(master1.addr())
+	nodes := strings.Join([]string{
+		// Before the cluster is configured, the node doesn't know its ip
+		fmt.Sprintf("07c3 :%s@17000 myself,master - 0 0 1 connected 0-8191 [8191->-67ed]", masterPort),
+		fmt.Sprintf("67ed %s@17001,redis-2 master - 0 1526000000000 2 connected 8192-16382 16383 [8191-<-07c3]", master2.addr()),
+		fmt.Sprintf("292f %s@17002 slave 07c3 0 1526000000000 1 connected", slave.addr()),
+		"e7d1 10.0.0.9:7003@17003 slave,fail 67ed 1526000000000 1526000000000 2 disconnected",
+		"",
+	}, "\n")
+	for _, n := range []*fakeNode{master1, master2, slave} {
+		n.replies["AUTH SECRET"] = "+OK"
+		n.replies["INFO MEMORY"] = "# Memory\r\nused_memory:1003936\r\nmem_fragmentation_ratio:0.81\r\nmem_allocator:jemalloc-4.0.3\r\n"
+	}
+	master1.replies["CLUSTER NODES"] = nodes
+	master1.replies["CLUSTER INFO"] = clusterInfo
+	slave.replies["INFO MEMORY"] = "-LOADING Redis is loading the dataset in memory"
+
+	r := &RedisCluster{
+		Servers: []string{
+			// The first seed is down
+			"tcp://:secret@127.0.0.1:1",
+			"tcp://:secret@" + master1.addr(),
+		},
+		InfoSections: []string{"memory"},
+	}
+	var acc testutil.Accumulator
+	err := r.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "LOADING")
+	assert.NotContains(t, err.Error(), "127.0.0.1:1")
+
+	acc.AssertContainsTaggedFields(t, "redis_cluster",
+		map[string]interface{}{
+			"state":            "ok",
+			"slots_assigned":   int64(16384),
+			"slots_ok":         int64(16384),
+			"slots_pfail":      int64(0),
+			"slots_fail":       int64(0),
+			"known_nodes":      int64(4),
+			"size":             int64(2),
+			"current_epoch":    int64(6),
+			"masters":          int64(2),
+			"slaves":           int64(2),
+			"slots_migrating":  int64(1),
+			"slots_importing":  int64(1),
+			"slots_unassigned": int64(0),
+		},
+		map[string]string{"server": "127.0.0.1", "port": masterPort})
+
+	acc.AssertContainsTaggedFields(t, "redis_cluster_node",
+		map[string]interface{}{
+			"slots":                   int64(8192),
+			"slots_migrating":         int64(1),
+			"slots_importing":         int64(0),
+			"config_epoch":            int64(1),
+			"link_connected":          true,
+			"pfail":                   false,
+			"fail":                    false,
+			"used_memory":             int64(1003936),
+			"mem_fragmentation_ratio": 0.81,
+		},
+		map[string]string{"server": "127.0.0.1", "port": masterPort,
+			"node_id": "07c3", "role": "master", "shard": "07c3"})
+	_, port, _ := net.SplitHostPort(master2.addr())
+	acc.AssertContainsTaggedFields(t, "redis_cluster_node",
+		map[string]interface{}{
+			"slots":                   int64(8192),
+			"slots_migrating":         int64(0),
+			"slots_importing":         int64(1),
+			"config_epoch":            int64(2),
+			"link_connected":          true,
+			"pfail":                   false,
+			"fail":                    false,
+			"used_memory":             int64(1003936),
+			"mem_fragmentation_ratio": 0.81,
+		},
+		map[string]string{"server": "127.0.0.1", "port": port,
+			"node_id": "67ed", "role": "master", "shard": "67ed"})
+	// The topology of the nodes is reported even without their INFO
+	_, port, _ = net.SplitHostPort(slave.addr())
+	acc.AssertContainsTaggedFields(t, "redis_cluster_node",
+		map[string]interface{}{
+			"slots":           int64(0),
+			"slots_migrating": int64(0),
+			"slots_importing": int64(0),
+			"config_epoch":    int64(1),
+			"link_connected":  true,
+			"pfail":           false,
+			"fail":            false,
+		},
+		map[string]string{"server": "127.0.0.1", "port": port,
+			"node_id": "292f", "role": "slave", "shard": "07c3"})
+	acc.AssertContainsTaggedFields(t, "redis_cluster_node",
+		map[string]interface{}{
+			"slots":           int64(0),
+			"slots_migrating": int64(0),
+			"slots_importing": int64(0),
+			"config_epoch":    int64(2),
+			"link_connected":  false,
+			"pfail":           false,
+			"fail":            true,
+		},
+		map[string]string{"server": "10.0.0.9", "port": "7003",
+			"node_id": "e7d1", "role": "slave", "shard": "67ed"})
+	assert.Equal(t, 5, len(acc.Metrics))
+}
+
+func TestRedisClusterNoSeed(t *testing.T) {
+	n := newFakeNode(t)
+	defer n.l.Close()
+	// Not a cluster node
+	n.replies["CLUSTER NODES"] = "-ERR This instance has cluster support disabled"
+
+	r := &RedisCluster{Servers: []string{n.addr()}}
+	var acc testutil.Accumulator
+	err := r.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cluster support disabled")
+	assert.Empty(t, acc.Metrics)
+}
+
+func TestSlotCount(t *testing.T) {
+	assert.Equal(t, int64(1), slotCount("42"))
+	assert.Equal(t, int64(5461), slotCount("0-5460"))
+	assert.Equal(t, int64(0), slotCount("bogus"))
+}
@@ -1,3 +1,4 @@
+//go:build !linux || !sensors
 // +build !linux !sensors
 
 package sensors
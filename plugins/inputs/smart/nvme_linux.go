@@ -0,0 +1,101 @@
+//go:build linux
+// +build linux
+
+package smart
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"unsafe"
+)
+
+// NVME_IOCTL_ADMIN_CMD of linux/nvme_ioctl.h, _IOWR('N', 0x41, struct
+// nvme_admin_cmd)
+const nvmeIoctlAdminCmd = 0xc0484e41
+
+// Admin commands.
+const (
+	nvmeGetLogPage = 0x02
+	nvmeIdentify   = 0x06
+)
+
+// nvmeAdminCmd is struct nvme_admin_cmd of linux/nvme_ioctl.h.
+type nvmeAdminCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+// readNVMe returns the identify controller data structure and the SMART /
+// health information log page of the NVMe controller device.
+func readNVMe(device string) ([]byte, []byte, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	identify := make([]byte, nvmeIdentifyLength)
+	// Controller data structure, CNS 1
+	if err := nvmeAdmin(f, nvmeIdentify, 0, 1, identify); err != nil {
+		return nil, nil, err
+	}
+	log := make([]byte, nvmeHealthLength)
+	// Log page 2 of the controller, in dwords minus one
+	cdw10 := uint32(len(log)/4-1)<<16 | 0x02
+	if err := nvmeAdmin(f, nvmeGetLogPage, 0xffffffff, cdw10, log); err != nil {
+		return nil, nil, err
+	}
+	return identify, log, nil
+}
+
+func nvmeAdmin(f *os.File, opcode uint8, nsid, cdw10 uint32, data []byte) error {
+	cmd := nvmeAdminCmd{
+		opcode:    opcode,
+		nsid:      nsid,
+		addr:      uint64(uintptr(unsafe.Pointer(&data[0]))),
+		dataLen:   uint32(len(data)),
+		cdw10:     cdw10,
+		timeoutMs: 5000,
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(),
+		nvmeIoctlAdminCmd, uintptr(unsafe.Pointer(&cmd)))
+	if errno != 0 {
+		return os.NewSyscallError("NVME_IOCTL_ADMIN_CMD", errno)
+	}
+	return nil
+}
+
+// Controller devices, without the namespace devices as /dev/nvme0n1
+var nvmeController = regexp.MustCompile(`^nvme[0-9]+$`)
+
+func nvmeDevices() ([]string, error) {
+	paths, err := filepath.Glob("/dev/nvme*")
+	if err != nil {
+		return nil, err
+	}
+	var devices []string
+	for _, path := range paths {
+		if nvmeController.MatchString(filepath.Base(path)) {
+			devices = append(devices, path)
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package smart
+
+import "errors"
+
+func readNVMe(device string) ([]byte, []byte, error) {
+	return nil, nil, errors.New("the ioctl method is only supported on linux")
+}
+
+func nvmeDevices() ([]string, error) {
+	return nil, errors.New("the ioctl method is only supported on linux")
+}
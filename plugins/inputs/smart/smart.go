@@ -0,0 +1,476 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// Smart reports the health of the drives, from the JSON output of smartctl
+// or from the NVMe health log read directly.
+type Smart struct {
+	Method     string
+	Path       string
+	UseSudo    bool `toml:"use_sudo"`
+	Nocheck    string
+	Devices    []string
+	Excludes   []string
+	Attributes bool
+	Timeout    internal.Duration
+
+	run func(timeout time.Duration, command string, args ...string) ([]byte, error)
+	// readNVMe returns the identify controller and the SMART / health log
+	// pages of the NVMe controller device
+	readNVMe func(device string) ([]byte, []byte, error)
+	// nvmeDevices returns the NVMe controller devices
+	nvmeDevices func() ([]string, error)
+}
+
+var sampleConfig = `
+  ## Method reading the drives: "smartctl" runs smartctl, 7.0 or later for
+  ## its JSON output, "ioctl" reads the health log of the NVMe drives with
+  ## the NVMe admin commands, on linux
+  # method = "smartctl"
+
+  ## Path of smartctl, looked up in PATH if empty
+  # path = ""
+  ## Run smartctl with sudo, which must not ask for a password
+  # use_sudo = false
+  ## Do not wake up the drives in this power mode or lower, "never" to
+  ## always read them
+  # nocheck = "standby"
+
+  ## Drives to read, as smartctl --scan reports them, all the drives found
+  ## by smartctl --scan, or all the NVMe controllers for ioctl, if empty
+  # devices = ["/dev/sda -d sat", "/dev/nvme0"]
+  ## Drives not to read
+  # excludes = ["/dev/sdb"]
+
+  ## Report every ATA SMART attribute as smart_attribute, and not only the
+  ## main ones in smart_device
+  # attributes = false
+
+  ## Timeout of each smartctl command
+  # timeout = "30s"
+`
+
+func (s *Smart) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *Smart) Description() string {
+	return "Read the SMART attributes and the NVMe health log of drives"
+}
+
+// nvmeHealth is the SMART / health information log of a NVMe controller,
+// NVMe 1.3 5.14.1.2, as smartctl reports it.
+type nvmeHealth struct {
+	CriticalWarning         uint64 `json:"critical_warning"`
+	Temperature             uint64 `json:"temperature"`
+	AvailableSpare          uint64 `json:"available_spare"`
+	AvailableSpareThreshold uint64 `json:"available_spare_threshold"`
+	PercentageUsed          uint64 `json:"percentage_used"`
+	DataUnitsRead           uint64 `json:"data_units_read"`
+	DataUnitsWritten        uint64 `json:"data_units_written"`
+	HostReads               uint64 `json:"host_reads"`
+	HostWrites              uint64 `json:"host_writes"`
+	ControllerBusyTime      uint64 `json:"controller_busy_time"`
+	PowerCycles             uint64 `json:"power_cycles"`
+	PowerOnHours            uint64 `json:"power_on_hours"`
+	UnsafeShutdowns         uint64 `json:"unsafe_shutdowns"`
+	MediaErrors             uint64 `json:"media_errors"`
+	ErrorLogEntries         uint64 `json:"num_err_log_entries"`
+}
+
+// attribute is an ATA SMART attribute.
+type attribute struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Value      int    `json:"value"`
+	Worst      int    `json:"worst"`
+	Thresh     int    `json:"thresh"`
+	WhenFailed string `json:"when_failed"`
+	Raw        struct {
+		Value int64 `json:"value"`
+	} `json:"raw"`
+}
+
+// smartctlOutput holds the members of the JSON output of smartctl used by
+// the plugin.
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String string `json:"string"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	Devices []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"devices"`
+	Device struct {
+		Name     string `json:"name"`
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime *struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	PowerCycleCount *int64 `json:"power_cycle_count"`
+	ATAAttributes   *struct {
+		Table []attribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *nvmeHealth `json:"nvme_smart_health_information_log"`
+}
+
+// Raw values of the ATA attributes reported in smart_device, by attribute ID.
+var ataFields = map[int]string{
+	5:   "reallocated_sectors",
+	196: "reallocation_events",
+	197: "pending_sectors",
+	198: "offline_uncorrectable",
+	199: "udma_crc_errors",
+}
+
+func (s *Smart) Gather(acc telegraf.Accumulator) error {
+	method := s.Method
+	if method == "" {
+		method = "smartctl"
+	}
+	var gather func(device string, acc telegraf.Accumulator) error
+	var devices []string
+	var err error
+	switch method {
+	case "smartctl":
+		gather = s.gatherSmartctl
+		devices, err = s.smartctlDevices()
+	case "ioctl":
+		gather = s.gatherNVMe
+		devices = s.Devices
+		if len(devices) == 0 {
+			devices, err = s.nvmeDevices()
+		}
+	default:
+		return fmt.Errorf("invalid method %s", s.Method)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep gathering when one of them fails and return all errors as one
+	// giant error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errorStrings []string
+	for _, device := range devices {
+		if s.excluded(device) {
+			continue
+		}
+		wg.Add(1)
+		go func(device string) {
+			defer wg.Done()
+			if err := gather(device, acc); err != nil {
+				mu.Lock()
+				errorStrings = append(errorStrings, device+": "+err.Error())
+				mu.Unlock()
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+func (s *Smart) excluded(device string) bool {
+	name := strings.Fields(device)[0]
+	for _, exclude := range s.Excludes {
+		if exclude == device || exclude == name {
+			return true
+		}
+	}
+	return false
+}
+
+// smartctl runs smartctl with args and returns its JSON output, parsed.
+func (s *Smart) smartctl(args ...string) (*smartctlOutput, error) {
+	timeout := s.Timeout.Duration
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	path := s.Path
+	if path == "" {
+		var err error
+		if path, err = exec.LookPath("smartctl"); err != nil {
+			return nil, err
+		}
+	}
+	args = append([]string{"--json"}, args...)
+	if s.UseSudo {
+		args = append([]string{"-n", path}, args...)
+		path = "sudo"
+	}
+
+	// The exit status of smartctl is a bit mask also reporting the health of
+	// the drive, the output is read whatever it is
+	stdout, err := s.run(timeout, path, args...)
+	out := &smartctlOutput{}
+	if jsonErr := json.Unmarshal(stdout, out); jsonErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("parse smartctl output: %s", jsonErr)
+	}
+	// The command line or the device could not be read
+	if out.Smartctl.ExitStatus&0x03 != 0 {
+		var messages []string
+		for _, m := range out.Smartctl.Messages {
+			messages = append(messages, m.String)
+		}
+		return nil, fmt.Errorf("smartctl exit status %d: %s",
+			out.Smartctl.ExitStatus, strings.Join(messages, ", "))
+	}
+	return out, nil
+}
+
+func (s *Smart) smartctlDevices() ([]string, error) {
+	if len(s.Devices) > 0 {
+		return s.Devices, nil
+	}
+	out, err := s.smartctl("--scan")
+	if err != nil {
+		return nil, err
+	}
+	var devices []string
+	for _, device := range out.Devices {
+		devices = append(devices, device.Name+" -d "+device.Type)
+	}
+	return devices, nil
+}
+
+func (s *Smart) gatherSmartctl(device string, acc telegraf.Accumulator) error {
+	args := []string{"--info", "--health", "--attributes"}
+	nocheck := s.Nocheck
+	if nocheck == "" {
+		nocheck = "standby"
+	}
+	if nocheck != "never" {
+		// Skipping the drive is no error
+		nocheck += ",0"
+	}
+	args = append(args, "--nocheck="+nocheck)
+	fields := strings.Fields(device)
+	out, err := s.smartctl(append(args, append(fields[1:], fields[0])...)...)
+	if err != nil {
+		return err
+	}
+	// Skipped because of its power mode
+	if out.SmartStatus == nil && out.Temperature == nil &&
+		out.ATAAttributes == nil && out.NVMeHealth == nil {
+		return nil
+	}
+
+	tags := map[string]string{
+		"device": strings.TrimPrefix(fields[0], "/dev/"),
+		"type":   strings.ToLower(out.Device.Protocol),
+	}
+	if out.ModelName != "" {
+		tags["model"] = out.ModelName
+	}
+	if out.SerialNumber != "" {
+		tags["serial_no"] = out.SerialNumber
+	}
+
+	var values map[string]interface{}
+	if out.NVMeHealth != nil {
+		values = nvmeFields(out.NVMeHealth)
+	} else {
+		values = make(map[string]interface{})
+	}
+	if out.SmartStatus != nil {
+		values["health_ok"] = out.SmartStatus.Passed
+	}
+	if out.Temperature != nil {
+		values["temp_c"] = out.Temperature.Current
+	}
+	if out.PowerOnTime != nil {
+		values["power_on_hours"] = out.PowerOnTime.Hours
+	}
+	if out.PowerCycleCount != nil {
+		values["power_cycle_count"] = *out.PowerCycleCount
+	}
+
+	now := time.Now()
+	if out.ATAAttributes != nil {
+		for _, a := range out.ATAAttributes.Table {
+			if field, ok := ataFields[a.ID]; ok {
+				values[field] = a.Raw.Value
+			}
+			if !s.Attributes {
+				continue
+			}
+			attributeTags := map[string]string{
+				"id":   strconv.Itoa(a.ID),
+				"name": a.Name,
+			}
+			for k, v := range tags {
+				attributeTags[k] = v
+			}
+			acc.AddFields("smart_attribute", map[string]interface{}{
+				"value":     a.Value,
+				"worst":     a.Worst,
+				"threshold": a.Thresh,
+				"raw_value": a.Raw.Value,
+				"failing":   a.WhenFailed == "now",
+			}, attributeTags, now)
+		}
+	}
+	acc.AddFields("smart_device", values, tags, now)
+	return nil
+}
+
+func (s *Smart) gatherNVMe(device string, acc telegraf.Accumulator) error {
+	identify, log, err := s.readNVMe(device)
+	if err != nil {
+		return err
+	}
+	model, serial, err := parseNVMeIdentify(identify)
+	if err != nil {
+		return err
+	}
+	health, err := parseNVMeHealth(log)
+	if err != nil {
+		return err
+	}
+
+	values := nvmeFields(health)
+	values["health_ok"] = health.CriticalWarning == 0
+	values["power_on_hours"] = int64(health.PowerOnHours)
+	values["power_cycle_count"] = int64(health.PowerCycles)
+	// Kelvin
+	values["temp_c"] = int64(health.Temperature) - 273
+	tags := map[string]string{
+		"device":    strings.TrimPrefix(device, "/dev/"),
+		"type":      "nvme",
+		"model":     model,
+		"serial_no": serial,
+	}
+	acc.AddFields("smart_device", values, tags)
+	return nil
+}
+
+// nvmeFields returns the fields of the NVMe health log.
+func nvmeFields(h *nvmeHealth) map[string]interface{} {
+	return map[string]interface{}{
+		"critical_warning":          int64(h.CriticalWarning),
+		"available_spare":           int64(h.AvailableSpare),
+		"available_spare_threshold": int64(h.AvailableSpareThreshold),
+		"percentage_used":           int64(h.PercentageUsed),
+		"data_units_read":           h.DataUnitsRead,
+		"data_units_written":        h.DataUnitsWritten,
+		"host_reads":                h.HostReads,
+		"host_writes":               h.HostWrites,
+		"controller_busy_time":      h.ControllerBusyTime,
+		"unsafe_shutdowns":          h.UnsafeShutdowns,
+		"media_errors":              h.MediaErrors,
+		"error_log_entries":         h.ErrorLogEntries,
+	}
+}
+
+// Lengths of the identify controller data structure and of the SMART /
+// health information log page.
+const (
+	nvmeIdentifyLength = 4096
+	nvmeHealthLength   = 512
+)
+
+// parseNVMeIdentify returns the model and the serial number of the identify
+// controller data structure, NVMe 1.3 5.15.
+func parseNVMeIdentify(b []byte) (string, string, error) {
+	if len(b) < 64 {
+		return "", "", errors.New("truncated identify controller data")
+	}
+	serial := strings.TrimSpace(string(bytes.TrimRight(b[4:24], "\x00")))
+	model := strings.TrimSpace(string(bytes.TrimRight(b[24:64], "\x00")))
+	return model, serial, nil
+}
+
+// parseNVMeHealth returns the SMART / health information log page, keeping
+// the low 64 bits of its 128 bits counters.
+func parseNVMeHealth(b []byte) (*nvmeHealth, error) {
+	if len(b) < 192 {
+		return nil, errors.New("truncated SMART / health information log")
+	}
+	counter := func(offset int) uint64 {
+		var v uint64
+		for i := 7; i >= 0; i-- {
+			v = v<<8 | uint64(b[offset+i])
+		}
+		return v
+	}
+	return &nvmeHealth{
+		CriticalWarning:         uint64(b[0]),
+		Temperature:             uint64(b[1]) | uint64(b[2])<<8,
+		AvailableSpare:          uint64(b[3]),
+		AvailableSpareThreshold: uint64(b[4]),
+		PercentageUsed:          uint64(b[5]),
+		DataUnitsRead:           counter(32),
+		DataUnitsWritten:        counter(48),
+		HostReads:               counter(64),
+		HostWrites:              counter(80),
+		ControllerBusyTime:      counter(96),
+		PowerCycles:             counter(112),
+		PowerOnHours:            counter(128),
+		UnsafeShutdowns:         counter(144),
+		MediaErrors:             counter(160),
+		ErrorLogEntries:         counter(176),
+	}, nil
+}
+
+// run runs command with args and returns its output, also when it fails.
+func run(timeout time.Duration, command string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("run %s %s: %s (%s)", command,
+			strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+func init() {
+	inputs.Add("smart", func() telegraf.Input {
+		return &Smart{
+			Method:      "smartctl",
+			Nocheck:     "standby",
+			Timeout:     internal.Duration{Duration: 30 * time.Second},
+			run:         run,
+			readNVMe:    readNVMe,
+			nvmeDevices: nvmeDevices,
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package smart
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scan = `{
+  "json_format_version": [1, 0],
+  "smartctl": {"version": [7, 0], "exit_status": 0},
+  "devices": [
+    {"name": "/dev/sda", "info_name": "/dev/sda [SAT]", "type": "sat", "protocol": "ATA"},
+    {"name": "/dev/sdb", "info_name": "/dev/sdb [SAT]", "type": "sat", "protocol": "ATA"},
+    {"name": "/dev/nvme0", "info_name": "/dev/nvme0", "type": "nvme", "protocol": "NVMe"}
+  ]
+}`
+
+const sda = `{
+  "smartctl": {"version": [7, 0], "exit_status": 0},
+  "device": {"name": "/dev/sda", "type": "sat", "protocol": "ATA"},
+  "model_name": "ST4000DM004-2CV104",
+  "serial_number": "ZFN0XXXX",
+  "smart_status": {"passed": true},
+  "ata_smart_attributes": {
+    "revision": 10,
+    "table": [
+      {"id": 1, "name": "Raw_Read_Error_Rate", "value": 83, "worst": 64, "thresh": 6, "when_failed": "", "raw": {"value": 211712320, "string": "211712320"}},
+      {"id": 5, "name": "Reallocated_Sector_Ct", "value": 100, "worst": 100, "thresh": 10, "when_failed": "", "raw": {"value": 8, "string": "8"}},
+      {"id": 197, "name": "Current_Pending_Sector", "value": 100, "worst": 100, "thresh": 0, "when_failed": "", "raw": {"value": 0, "string": "0"}},
+      {"id": 198, "name": "Offline_Uncorrectable", "value": 100, "worst": 100, "thresh": 0, "when_failed": "", "raw": {"value": 0, "string": "0"}}
+    ]
+  },
+  "power_on_time": {"hours": 18250},
+  "power_cycle_count": 37,
+  "temperature": {"current": 31}
+}`
+
+const sdbStandby = `{
+  "smartctl": {"version": [7, 0], "messages": [{"string": "Device is in STANDBY mode, exit(0)", "severity": "information"}], "exit_status": 0},
+  "device": {"name": "/dev/sdb", "type": "sat", "protocol": "ATA"}
+}`
+
+const nvme0 = `{
+  "smartctl": {"version": [7, 0], "exit_status": 4},
+  "device": {"name": "/dev/nvme0", "type": "nvme", "protocol": "NVMe"},
+  "model_name": "Samsung SSD 970 EVO 500GB",
+  "serial_number": "S466NX0KXXXXXXX",
+  "smart_status": {"passed": false},
+  "nvme_smart_health_information_log": {
+    "critical_warning": 4,
+    "temperature": 38,
+    "available_spare": 100,
+    "available_spare_threshold": 10,
+    "percentage_used": 3,
+    "data_units_read": 25316415,
+    "data_units_written": 31963120,
+    "host_reads": 378749147,
+    "host_writes": 745658045,
+    "controller_busy_time": 1869,
+    "power_cycles": 166,
+    "power_on_hours": 5102,
+    "unsafe_shutdowns": 32,
+    "media_errors": 2,
+    "num_err_log_entries": 211
+  },
+  "temperature": {"current": 38},
+  "power_cycle_count": 166,
+  "power_on_time": {"hours": 5102}
+}`
+
+func fakeSmartctl(calls *[]string) func(time.Duration, string, ...string) ([]byte, error) {
+	var mu sync.Mutex
+	return func(timeout time.Duration, command string, args ...string) ([]byte, error) {
+		mu.Lock()
+		*calls = append(*calls, command+" "+strings.Join(args, " "))
+		mu.Unlock()
+		switch args[len(args)-1] {
+		case "--scan":
+			return []byte(scan), nil
+		case "/dev/sda":
+			return []byte(sda), nil
+		case "/dev/sdb":
+			return []byte(sdbStandby), nil
+		case "/dev/nvme0":
+			// Failing drives make smartctl exit with a non zero status
+			return []byte(nvme0), errors.New("exit status 4")
+		}
+		return []byte(`{"smartctl": {"exit_status": 2, "messages": [{"string": "No such device"}]}}`),
+			errors.New("exit status 2")
+	}
+}
+
+func TestSmartctl(t *testing.T) {
+	var calls []string
+	s := &Smart{
+		Path:       "/usr/sbin/smartctl",
+		Attributes: true,
+		run:        fakeSmartctl(&calls),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "smart_device",
+		map[string]interface{}{
+			"health_ok":             true,
+			"temp_c":                int64(31),
+			"power_on_hours":        int64(18250),
+			"power_cycle_count":     int64(37),
+			"reallocated_sectors":   int64(8),
+			"pending_sectors":       int64(0),
+			"offline_uncorrectable": int64(0),
+		},
+		map[string]string{"device": "sda", "type": "ata", "model": "ST4000DM004-2CV104", "serial_no": "ZFN0XXXX"})
+	acc.AssertContainsTaggedFields(t, "smart_attribute",
+		map[string]interface{}{
+			"value":     83,
+			"worst":     64,
+			"threshold": 6,
+			"raw_value": int64(211712320),
+			"failing":   false,
+		},
+		map[string]string{"device": "sda", "type": "ata", "model": "ST4000DM004-2CV104", "serial_no": "ZFN0XXXX",
+			"id": "1", "name": "Raw_Read_Error_Rate"})
+	acc.AssertContainsTaggedFields(t, "smart_device",
+		map[string]interface{}{
+			"health_ok":                 false,
+			"temp_c":                    int64(38),
+			"power_on_hours":            int64(5102),
+			"power_cycle_count":         int64(166),
+			"critical_warning":          int64(4),
+			"available_spare":           int64(100),
+			"available_spare_threshold": int64(10),
+			"percentage_used":           int64(3),
+			"data_units_read":           uint64(25316415),
+			"data_units_written":        uint64(31963120),
+			"host_reads":                uint64(378749147),
+			"host_writes":               uint64(745658045),
+			"controller_busy_time":      uint64(1869),
+			"unsafe_shutdowns":          uint64(32),
+			"media_errors":              uint64(2),
+			"error_log_entries":         uint64(211),
+		},
+		map[string]string{"device": "nvme0", "type": "nvme", "model": "Samsung SSD 970 EVO 500GB", "serial_no": "S466NX0KXXXXXXX"})
+	// sdb is in standby
+	assert.Equal(t, 6, len(acc.Metrics))
+
+	assert.Equal(t, "/usr/sbin/smartctl --json --scan", calls[0])
+	assert.Contains(t, calls, "/usr/sbin/smartctl --json --info --health --attributes --nocheck=standby,0 -d sat /dev/sda")
+}
+
+func TestSmartctlDevices(t *testing.T) {
+	var calls []string
+	s := &Smart{
+		Path:     "smartctl",
+		UseSudo:  true,
+		Nocheck:  "never",
+		Devices:  []string{"/dev/sda -d sat", "/dev/sdb", "/dev/sdc"},
+		Excludes: []string{"/dev/sdb"},
+		run:      fakeSmartctl(&calls),
+	}
+	var acc testutil.Accumulator
+	err := s.Gather(&acc)
+	require.Error(t, err)
+	assert.Equal(t, "/dev/sdc: smartctl exit status 2: No such device", err.Error())
+
+	assert.Equal(t, 1, len(acc.Metrics))
+	assert.Contains(t, calls, "sudo -n smartctl --json --info --health --attributes --nocheck=never -d sat /dev/sda")
+	assert.Equal(t, 2, len(calls))
+}
+
+func TestNVMeIoctl(t *testing.T) {
+	identify := make([]byte, nvmeIdentifyLength)
+	copy(identify[4:], "S466NX0KXXXXXXX     ")
+	copy(identify[24:], "Samsung SSD 970 EVO 500GB               ")
+	log := make([]byte, nvmeHealthLength)
+	// 311 K
+	log[1], log[2] = 0x37, 0x01
+	log[3], log[4], log[5] = 100, 10, 3
+	// The high 64 bits of the counters are dropped
+	log[32], log[33], log[34], log[40] = 0x3f, 0x4c, 0x82, 1
+	log[112] = 166
+	log[128], log[129] = 0xee, 0x13
+	log[160] = 2
+
+	s := &Smart{
+		Method: "ioctl",
+		nvmeDevices: func() ([]string, error) {
+			return []string{"/dev/nvme0"}, nil
+		},
+		readNVMe: func(device string) ([]byte, []byte, error) {
+			return identify, log, nil
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+	acc.AssertContainsTaggedFields(t, "smart_device",
+		map[string]interface{}{
+			"health_ok":                 true,
+			"temp_c":                    int64(38),
+			"power_on_hours":            int64(5102),
+			"power_cycle_count":         int64(166),
+			"critical_warning":          int64(0),
+			"available_spare":           int64(100),
+			"available_spare_threshold": int64(10),
+			"percentage_used":           int64(3),
+			"data_units_read":           uint64(0x824c3f),
+			"data_units_written":        uint64(0),
+			"host_reads":                uint64(0),
+			"host_writes":               uint64(0),
+			"controller_busy_time":      uint64(0),
+			"unsafe_shutdowns":          uint64(0),
+			"media_errors":              uint64(2),
+			"error_log_entries":         uint64(0),
+		},
+		map[string]string{"device": "nvme0", "type": "nvme", "model": "Samsung SSD 970 EVO 500GB", "serial_no": "S466NX0KXXXXXXX"})
+
+	_, err := parseNVMeHealth(log[:100])
+	assert.Error(t, err)
+}
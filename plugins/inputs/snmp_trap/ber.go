@@ -0,0 +1,245 @@
+package snmp_trap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags of the SNMP messages.
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+
+	tagIPAddress = 0x40
+	tagCounter32 = 0x41
+	tagGauge32   = 0x42
+	tagTimeTicks = 0x43
+	tagOpaque    = 0x44
+	tagCounter64 = 0x46
+	tagUinteger  = 0x47
+
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+
+	pduResponse = 0xa2
+	pduTrapV1   = 0xa4
+	pduInform   = 0xa6
+	pduTrapV2   = 0xa7
+	pduReport   = 0xa8
+)
+
+var errTruncated = errors.New("truncated BER element")
+
+// tlv is a BER element, its value at off in the decoded message.
+type tlv struct {
+	tag   byte
+	value []byte
+	off   int
+}
+
+// decoder reads the BER elements of b between pos and end.
+type decoder struct {
+	b   []byte
+	pos int
+	end int
+}
+
+func newDecoder(b []byte) *decoder {
+	return &decoder{b: b, end: len(b)}
+}
+
+func (d *decoder) more() bool {
+	return d.pos < d.end
+}
+
+// next returns the next element.
+func (d *decoder) next() (tlv, error) {
+	if d.end-d.pos < 2 {
+		return tlv{}, errTruncated
+	}
+	tag := d.b[d.pos]
+	length := int(d.b[d.pos+1])
+	pos := d.pos + 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || d.end-pos < n {
+			return tlv{}, fmt.Errorf("invalid BER length of element 0x%02x", tag)
+		}
+		length = 0
+		for _, c := range d.b[pos : pos+n] {
+			length = length<<8 | int(c)
+		}
+		pos += n
+	}
+	if length < 0 || d.end-pos < length {
+		return tlv{}, errTruncated
+	}
+	d.pos = pos + length
+	return tlv{tag: tag, value: d.b[pos:d.pos], off: pos}, nil
+}
+
+// expect returns the next element, which must have tag.
+func (d *decoder) expect(tag byte) (tlv, error) {
+	t, err := d.next()
+	if err != nil {
+		return t, err
+	}
+	if t.tag != tag {
+		return t, fmt.Errorf("got BER element 0x%02x, expected 0x%02x", t.tag, tag)
+	}
+	return t, nil
+}
+
+// children returns a decoder of the elements in t.
+func (d *decoder) children(t tlv) *decoder {
+	return &decoder{b: d.b, pos: t.off, end: t.off + len(t.value)}
+}
+
+func (d *decoder) integer() (int64, error) {
+	t, err := d.expect(tagInteger)
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(t.value)
+}
+
+func (d *decoder) octetString() ([]byte, error) {
+	t, err := d.expect(tagOctetString)
+	return t.value, err
+}
+
+func parseInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, fmt.Errorf("invalid BER integer of %d bytes", len(b))
+	}
+	// Sign extended
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+func parseUint(b []byte) (uint64, error) {
+	if len(b) == 0 || len(b) > 9 || (len(b) == 9 && b[0] != 0) {
+		return 0, fmt.Errorf("invalid BER unsigned integer of %d bytes", len(b))
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// parseOID returns the dotted notation of the OID, with a leading dot.
+func parseOID(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", errors.New("empty OID")
+	}
+	var ids []uint64
+	var v uint64
+	for i, c := range b {
+		v = v<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return "", errors.New("truncated OID")
+			}
+			continue
+		}
+		if len(ids) == 0 {
+			// The first two ids are encoded as one
+			if v < 80 {
+				ids = append(ids, v/40, v%40)
+			} else {
+				ids = append(ids, 2, v-80)
+			}
+		} else {
+			ids = append(ids, v)
+		}
+		v = 0
+	}
+	var s []byte
+	for _, id := range ids {
+		s = append(s, '.')
+		s = strconv.AppendUint(s, id, 10)
+	}
+	return string(s), nil
+}
+
+// encode returns the BER element of tag with the concatenated values.
+func encode(tag byte, values ...[]byte) []byte {
+	var length int
+	for _, v := range values {
+		length += len(v)
+	}
+	b := []byte{tag}
+	switch {
+	case length < 0x80:
+		b = append(b, byte(length))
+	case length <= 0xff:
+		b = append(b, 0x81, byte(length))
+	case length <= 0xffff:
+		b = append(b, 0x82, byte(length>>8), byte(length))
+	default:
+		b = append(b, 0x84, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	}
+	for _, v := range values {
+		b = append(b, v...)
+	}
+	return b
+}
+
+func encodeInt(tag byte, v int64) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; ; v >>= 8 {
+		// Stop once the remaining bytes are only the sign extension
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+		b = append([]byte{byte(v)}, b...)
+	}
+	return encode(tag, b)
+}
+
+func encodeUint(tag byte, v uint64) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return encode(tag, b)
+}
+
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	ids := make([]uint64, len(parts))
+	for i, p := range parts {
+		id, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		ids[i] = id
+	}
+	ids = append([]uint64{ids[0]*40 + ids[1]}, ids[2:]...)
+
+	var b []byte
+	for _, id := range ids {
+		sub := []byte{byte(id & 0x7f)}
+		for id >>= 7; id > 0; id >>= 7 {
+			sub = append([]byte{byte(id&0x7f) | 0x80}, sub...)
+		}
+		b = append(b, sub...)
+	}
+	return encode(tagOID, b), nil
+}
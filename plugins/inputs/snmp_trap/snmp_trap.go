@@ -0,0 +1,704 @@
+package snmp_trap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// SnmpTrap listens for SNMP v2c and v3 traps and informs.
+type SnmpTrap struct {
+	ServiceAddress    string `toml:"service_address"`
+	SnmptranslateFile string `toml:"snmptranslate_file"`
+	Communities       []string
+	EngineID          string `toml:"engine_id"`
+	Users             []User `toml:"user"`
+
+	wg   sync.WaitGroup
+	acc  telegraf.Accumulator
+	conn *net.UDPConn
+
+	// Names of the OIDs, by OID
+	names map[string]string
+	users map[string]*usmUser
+
+	engineID    []byte
+	engineBoots int64
+	started     time.Time
+	salt        uint64
+	// Reports sent for the unknown engine IDs
+	unknownEngineIDs int64
+}
+
+// User is a SNMPv3 user the traps and informs are accepted from.
+type User struct {
+	Name         string
+	AuthProtocol string `toml:"auth_protocol"`
+	AuthPassword string `toml:"auth_password"`
+	PrivProtocol string `toml:"priv_protocol"`
+	PrivPassword string `toml:"priv_password"`
+}
+
+var sampleConfig = `
+  ## Address and port to listen for the traps and informs on
+  service_address = ":162"
+
+  ## Use 'oids.txt' file to translate oids to names
+  ## To generate 'oids.txt' you need to run:
+  ##   snmptranslate -m all -Tz -On | sed -e 's/"//g' > /tmp/oids.txt
+  ## Or if you have an other MIB folder with custom MIBs
+  ##   snmptranslate -M /mycustommibfolder -Tz -On -m all | sed -e 's/"//g' > oids.txt
+  # snmptranslate_file = "/tmp/oids.txt"
+
+  ## SNMP v2c communities accepted, all of them if empty
+  # communities = ["public"]
+
+  ## Engine ID of the listener, as hex, the SNMP v3 informs are sent to.
+  ## Generated at each start if not set.
+  # engine_id = "800000000574656c6567726166"
+
+  ## SNMP v3 users, their traps and informs must be at the security level
+  ## configured:
+  ##   auth_protocol: "MD5" or "SHA", no authentication if not set
+  ##   priv_protocol: "DES" or "AES", no privacy if not set
+  # [[inputs.snmp_trap.user]]
+  #   name = "monitor"
+  #   auth_protocol = "SHA"
+  #   auth_password = "authpassword"
+  #   priv_protocol = "AES"
+  #   priv_password = "privpassword"
+`
+
+func (s *SnmpTrap) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *SnmpTrap) Description() string {
+	return "Receive SNMP v2c and v3 traps and informs"
+}
+
+// All the work is done in the Start() function, so this is just a dummy
+// function.
+func (s *SnmpTrap) Gather(_ telegraf.Accumulator) error {
+	return nil
+}
+
+// Well known OIDs
+const (
+	sysUpTimeOID  = ".1.3.6.1.2.1.1.3.0"
+	snmpTrapOID   = ".1.3.6.1.6.3.1.1.4.1.0"
+	unknownEngine = ".1.3.6.1.6.3.15.1.1.4.0"
+)
+
+// msgFlags of SNMP v3
+const (
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+)
+
+func (s *SnmpTrap) Start(acc telegraf.Accumulator) error {
+	s.acc = acc
+	s.started = time.Now()
+	// Increasing across the restarts, for the engines sending informs to
+	// keep accepting the responses of a fixed engine ID
+	s.engineBoots = s.started.Unix() & 0x7fffffff
+
+	if s.SnmptranslateFile != "" {
+		data, err := ioutil.ReadFile(s.SnmptranslateFile)
+		if err != nil {
+			return fmt.Errorf("Reading SNMPtranslate file error: %s", err)
+		}
+		s.names = parseNames(data)
+	}
+
+	s.users = make(map[string]*usmUser)
+	for _, u := range s.Users {
+		user, err := newUSMUser(u)
+		if err != nil {
+			return err
+		}
+		s.users[u.Name] = user
+	}
+
+	if s.EngineID != "" {
+		id, err := hex.DecodeString(s.EngineID)
+		if err != nil || len(id) < 5 || len(id) > 32 {
+			return fmt.Errorf("Invalid engine_id %s, expected 5 to 32 bytes as hex", s.EngineID)
+		}
+		s.engineID = id
+	} else {
+		// Enterprise 0, 8 random octets
+		s.engineID = make([]byte, 13)
+		copy(s.engineID, []byte{0x80, 0, 0, 0, 0x05})
+		if _, err := rand.Read(s.engineID[5:]); err != nil {
+			return err
+		}
+	}
+	var salt [8]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return err
+	}
+	s.salt = binary.BigEndian.Uint64(salt[:])
+
+	address, err := net.ResolveUDPAddr("udp", s.ServiceAddress)
+	if err != nil {
+		return err
+	}
+	s.conn, err = net.ListenUDP("udp", address)
+	if err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+	go s.listen()
+
+	log.Printf("Started the snmp_trap service on %s\n", s.conn.LocalAddr())
+	return nil
+}
+
+func (s *SnmpTrap) Stop() {
+	s.conn.Close()
+	s.wg.Wait()
+	log.Println("Stopped the snmp_trap service on ", s.ServiceAddress)
+}
+
+func (s *SnmpTrap) listen() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if strings.Contains(err.Error(), "closed network") {
+				return
+			}
+			log.Printf("ERROR READ: %s\n", err.Error())
+			continue
+		}
+		if err := s.handle(buf[:n], addr); err != nil {
+			log.Printf("ERROR snmp_trap: message from %s: %s\n", addr, err)
+		}
+	}
+}
+
+// parseNames returns the names of the OIDs of the output of snmptranslate
+// -Tz -On.
+func parseNames(data []byte) map[string]string {
+	names := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 2 {
+			names["."+strings.TrimPrefix(f[1], ".")] = f[0]
+		}
+	}
+	return names
+}
+
+// lookup returns the name of oid, the name of its longest known prefix with
+// the rest of the OID as suffix, or oid if unknown.
+func (s *SnmpTrap) lookup(oid string) string {
+	for prefix := oid; prefix != ""; {
+		if name, ok := s.names[prefix]; ok {
+			return name + oid[len(prefix):]
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return oid
+}
+
+type varbind struct {
+	oid string
+	// nil for the null values and the exceptions
+	value interface{}
+}
+
+type pdu struct {
+	tag       byte
+	requestID int64
+	varbinds  []varbind
+	// Encoded variable bindings, returned in the responses to informs
+	raw []byte
+}
+
+func parsePDU(d *decoder) (*pdu, error) {
+	t, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	p := &pdu{tag: t.tag}
+	switch t.tag {
+	case pduTrapV2, pduInform:
+	case pduTrapV1:
+		return nil, errors.New("SNMP v1 traps are not supported")
+	default:
+		return nil, fmt.Errorf("unexpected PDU 0x%02x", t.tag)
+	}
+
+	c := d.children(t)
+	if p.requestID, err = c.integer(); err != nil {
+		return nil, err
+	}
+	// error-status and error-index
+	for i := 0; i < 2; i++ {
+		if _, err := c.integer(); err != nil {
+			return nil, err
+		}
+	}
+	list, err := c.expect(tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	p.raw = encode(tagSequence, list.value)
+
+	vbs := c.children(list)
+	for vbs.more() {
+		vb, err := vbs.expect(tagSequence)
+		if err != nil {
+			return nil, err
+		}
+		v := vbs.children(vb)
+		name, err := v.expect(tagOID)
+		if err != nil {
+			return nil, err
+		}
+		oid, err := parseOID(name.value)
+		if err != nil {
+			return nil, err
+		}
+		value, err := v.next()
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", oid, err)
+		}
+		p.varbinds = append(p.varbinds, varbind{oid: oid, value: parsed})
+	}
+	return p, nil
+}
+
+func parseValue(t tlv) (interface{}, error) {
+	switch t.tag {
+	case tagInteger:
+		return parseInt(t.value)
+	case tagOctetString:
+		if isText(t.value) {
+			return string(t.value), nil
+		}
+		return hex.EncodeToString(t.value), nil
+	case tagOID:
+		return parseOID(t.value)
+	case tagIPAddress:
+		if len(t.value) != 4 {
+			return nil, fmt.Errorf("invalid IpAddress of %d bytes", len(t.value))
+		}
+		return net.IP(t.value).String(), nil
+	case tagCounter32, tagGauge32, tagTimeTicks, tagUinteger:
+		v, err := parseUint(t.value)
+		return int64(v), err
+	case tagCounter64:
+		return parseUint(t.value)
+	case tagOpaque:
+		return hex.EncodeToString(t.value), nil
+	case tagNull, tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported value type 0x%02x", t.tag)
+}
+
+// isText tells if b is printable text rather than binary, such as a MAC
+// address.
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SnmpTrap) handle(packet []byte, addr *net.UDPAddr) error {
+	d := newDecoder(packet)
+	msg, err := d.expect(tagSequence)
+	if err != nil {
+		return err
+	}
+	m := d.children(msg)
+	version, err := m.integer()
+	if err != nil {
+		return err
+	}
+
+	switch version {
+	case 1:
+		community, err := m.octetString()
+		if err != nil {
+			return err
+		}
+		if len(s.Communities) > 0 && !containsString(s.Communities, string(community)) {
+			return fmt.Errorf("unknown community %q", community)
+		}
+		p, err := parsePDU(m)
+		if err != nil {
+			return err
+		}
+		if p.tag == pduInform {
+			resp := encode(tagSequence,
+				encodeInt(tagInteger, version),
+				encode(tagOctetString, community),
+				responsePDU(p))
+			if _, err := s.conn.WriteToUDP(resp, addr); err != nil {
+				return err
+			}
+		}
+		return s.addTrap(p, "2c", addr)
+	case 3:
+		return s.handleV3(packet, m, addr)
+	case 0:
+		return errors.New("SNMP v1 traps are not supported")
+	}
+	return fmt.Errorf("unsupported SNMP version %d", version)
+}
+
+// securityParameters are the USM security parameters of a SNMP v3 message.
+type securityParameters struct {
+	engineID   []byte
+	boots      int64
+	time       int64
+	userName   []byte
+	auth       tlv
+	privParams []byte
+}
+
+func parseSecurityParameters(m *decoder) (*securityParameters, error) {
+	t, err := m.expect(tagOctetString)
+	if err != nil {
+		return nil, err
+	}
+	d := m.children(t)
+	seq, err := d.expect(tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	d = d.children(seq)
+	sp := &securityParameters{}
+	if sp.engineID, err = d.octetString(); err != nil {
+		return nil, err
+	}
+	if sp.boots, err = d.integer(); err != nil {
+		return nil, err
+	}
+	if sp.time, err = d.integer(); err != nil {
+		return nil, err
+	}
+	if sp.userName, err = d.octetString(); err != nil {
+		return nil, err
+	}
+	if sp.auth, err = d.expect(tagOctetString); err != nil {
+		return nil, err
+	}
+	if sp.privParams, err = d.octetString(); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+func (s *SnmpTrap) handleV3(packet []byte, m *decoder, addr *net.UDPAddr) error {
+	global, err := m.expect(tagSequence)
+	if err != nil {
+		return err
+	}
+	g := m.children(global)
+	msgID, err := g.integer()
+	if err != nil {
+		return err
+	}
+	if _, err := g.integer(); err != nil {
+		return err
+	}
+	flags, err := g.octetString()
+	if err != nil {
+		return err
+	}
+	if len(flags) != 1 {
+		return fmt.Errorf("invalid msgFlags of %d bytes", len(flags))
+	}
+	model, err := g.integer()
+	if err != nil {
+		return err
+	}
+	if model != 3 {
+		return fmt.Errorf("unsupported security model %d", model)
+	}
+	sp, err := parseSecurityParameters(m)
+	if err != nil {
+		return err
+	}
+	data, err := m.next()
+	if err != nil {
+		return err
+	}
+
+	// The senders of informs discover the engine ID of the receiver first
+	if len(sp.engineID) == 0 {
+		if flags[0]&flagReportable == 0 {
+			return errors.New("message without engine ID")
+		}
+		return s.reportUnknownEngineID(msgID, sp.userName, data, addr)
+	}
+
+	user, ok := s.users[string(sp.userName)]
+	if !ok {
+		return fmt.Errorf("unknown user %q", sp.userName)
+	}
+	auth, priv := flags[0]&flagAuth != 0, flags[0]&flagPriv != 0
+	if auth != (user.hash != nil) || priv != (user.priv != "") {
+		return fmt.Errorf("security level of the message not the one of user %s", user.name)
+	}
+
+	// The time window is not checked, the engine IDs of the senders of
+	// traps and their boots and times are not tracked
+	var privKey []byte
+	if auth {
+		var authKey []byte
+		authKey, privKey = user.keys(sp.engineID)
+		if len(sp.auth.value) != authParamsLength {
+			return errors.New("authentication failure")
+		}
+		zeroed := make([]byte, len(packet))
+		copy(zeroed, packet)
+		copy(zeroed[sp.auth.off:sp.auth.off+authParamsLength], make([]byte, authParamsLength))
+		if !hmac.Equal(authParams(user.hash, authKey, zeroed), sp.auth.value) {
+			return errors.New("authentication failure")
+		}
+	}
+
+	scoped := m.children(data)
+	if priv {
+		if data.tag != tagOctetString {
+			return errors.New("unencrypted message with privacy")
+		}
+		plain, err := decrypt(user.priv, privKey, sp.boots, sp.time, sp.privParams, data.value)
+		if err != nil {
+			return err
+		}
+		scoped = newDecoder(plain)
+		seq, err := scoped.expect(tagSequence)
+		if err != nil {
+			return fmt.Errorf("decryption failure: %s", err)
+		}
+		scoped = scoped.children(seq)
+	} else if data.tag != tagSequence {
+		return fmt.Errorf("got scoped PDU 0x%02x, expected 0x%02x", data.tag, tagSequence)
+	}
+	contextEngineID, err := scoped.octetString()
+	if err != nil {
+		return err
+	}
+	contextName, err := scoped.octetString()
+	if err != nil {
+		return err
+	}
+	p, err := parsePDU(scoped)
+	if err != nil {
+		return err
+	}
+
+	if p.tag == pduInform {
+		// The receiver of informs is the authoritative engine
+		if !bytes.Equal(sp.engineID, s.engineID) {
+			return s.reportUnknownEngineID(msgID, sp.userName, data, addr)
+		}
+		resp, err := s.v3Message(msgID, flags[0]&^flagReportable, user, sp.userName,
+			encode(tagSequence,
+				encode(tagOctetString, contextEngineID),
+				encode(tagOctetString, contextName),
+				responsePDU(p)))
+		if err != nil {
+			return err
+		}
+		if _, err := s.conn.WriteToUDP(resp, addr); err != nil {
+			return err
+		}
+	}
+	return s.addTrap(p, "3", addr)
+}
+
+// reportUnknownEngineID answers the discovery of the engine ID, the
+// request id of the unencrypted data echoed.
+func (s *SnmpTrap) reportUnknownEngineID(msgID int64, userName []byte, data tlv, addr *net.UDPAddr) error {
+	var requestID int64
+	if data.tag == tagSequence {
+		d := newDecoder(data.value)
+		d.octetString()
+		d.octetString()
+		if t, err := d.next(); err == nil {
+			requestID, _ = d.children(t).integer()
+		}
+	}
+	s.unknownEngineIDs++
+
+	oid, _ := encodeOID(unknownEngine)
+	report := encode(pduReport,
+		encodeInt(tagInteger, requestID),
+		encodeInt(tagInteger, 0),
+		encodeInt(tagInteger, 0),
+		encode(tagSequence, encode(tagSequence, oid, encodeUint(tagCounter32, uint64(s.unknownEngineIDs)))))
+	resp, err := s.v3Message(msgID, 0, nil, userName,
+		encode(tagSequence,
+			encode(tagOctetString, s.engineID),
+			encode(tagOctetString),
+			report))
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.WriteToUDP(resp, addr)
+	return err
+}
+
+func responsePDU(p *pdu) []byte {
+	return encode(pduResponse,
+		encodeInt(tagInteger, p.requestID),
+		encodeInt(tagInteger, 0),
+		encodeInt(tagInteger, 0),
+		p.raw)
+}
+
+// v3Message returns a message of the listener, the authoritative engine.
+func (s *SnmpTrap) v3Message(msgID int64, flags byte, user *usmUser, userName, scopedPDU []byte) ([]byte, error) {
+	s.salt++
+	var salt [8]byte
+	binary.BigEndian.PutUint64(salt[:], s.salt)
+	return buildV3Message(msgID, flags, user, userName, s.engineID,
+		s.engineBoots, int64(time.Since(s.started)/time.Second), salt[:], scopedPDU)
+}
+
+// buildV3Message returns the SNMP v3 message of scopedPDU, authenticated and
+// encrypted with the keys of user localized for the authoritative engine as
+// requested by flags.
+func buildV3Message(msgID int64, flags byte, user *usmUser, userName, engineID []byte,
+	boots, engineTime int64, salt, scopedPDU []byte) ([]byte, error) {
+	var authKey, privKey []byte
+	if flags&flagAuth != 0 {
+		authKey, privKey = user.keys(engineID)
+	}
+	data := scopedPDU
+	var privParams, auth []byte
+	if flags&flagPriv != 0 {
+		encrypted, err := encrypt(user.priv, privKey, boots, engineTime, salt, scopedPDU)
+		if err != nil {
+			return nil, err
+		}
+		data = encode(tagOctetString, encrypted)
+		privParams = salt
+	}
+	if flags&flagAuth != 0 {
+		auth = make([]byte, authParamsLength)
+	}
+
+	msg := encode(tagSequence,
+		encodeInt(tagInteger, 3),
+		encode(tagSequence,
+			encodeInt(tagInteger, msgID),
+			encodeInt(tagInteger, 65507),
+			encode(tagOctetString, []byte{flags}),
+			encodeInt(tagInteger, 3)),
+		encode(tagOctetString, encode(tagSequence,
+			encode(tagOctetString, engineID),
+			encodeInt(tagInteger, boots),
+			encodeInt(tagInteger, engineTime),
+			encode(tagOctetString, userName),
+			encode(tagOctetString, auth),
+			encode(tagOctetString, privParams))),
+		data)
+
+	if flags&flagAuth != 0 {
+		d := newDecoder(msg)
+		seq, _ := d.next()
+		m := d.children(seq)
+		m.next()
+		m.next()
+		sp, err := parseSecurityParameters(m)
+		if err != nil {
+			return nil, err
+		}
+		copy(msg[sp.auth.off:], authParams(user.hash, authKey, msg))
+	}
+	return msg, nil
+}
+
+// addTrap reports p, the snmpTrapOID.0 of the notification as tags and the
+// other variable bindings as fields.
+func (s *SnmpTrap) addTrap(p *pdu, version string, addr *net.UDPAddr) error {
+	tags := map[string]string{
+		"source":  addr.IP.String(),
+		"version": version,
+	}
+	if p.tag == pduInform {
+		tags["pdu"] = "inform"
+	} else {
+		tags["pdu"] = "trap"
+	}
+	fields := make(map[string]interface{})
+	for _, vb := range p.varbinds {
+		switch {
+		case vb.oid == snmpTrapOID:
+			oid, ok := vb.value.(string)
+			if !ok {
+				return errors.New("snmpTrapOID.0 is not an OID")
+			}
+			tags["oid"] = oid
+			tags["name"] = s.lookup(oid)
+		case vb.value == nil:
+		case vb.oid == sysUpTimeOID:
+			fields["sys_uptime"] = vb.value
+		default:
+			fields[s.lookup(vb.oid)] = vb.value
+		}
+	}
+	if _, ok := tags["oid"]; !ok {
+		return errors.New("notification without snmpTrapOID.0")
+	}
+	s.acc.AddFields("snmp_trap", fields, tags, time.Now())
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	inputs.Add("snmp_trap", func() telegraf.Input {
+		return &SnmpTrap{
+			ServiceAddress: ":162",
+		}
+	})
+}
@@ -0,0 +1,325 @@
+package snmp_trap
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustOID(t *testing.T, oid string) []byte {
+	b, err := encodeOID(oid)
+	require.NoError(t, err)
+	return b
+}
+
+// linkDown returns the variable bindings of a linkDown notification.
+func linkDown(t *testing.T) []byte {
+	return encode(tagSequence,
+		encode(tagSequence, mustOID(t, sysUpTimeOID), encodeUint(tagTimeTicks, 123456)),
+		encode(tagSequence, mustOID(t, snmpTrapOID), mustOID(t, ".1.3.6.1.6.3.1.1.5.3")),
+		encode(tagSequence, mustOID(t, ".1.3.6.1.2.1.2.2.1.1.2"), encodeInt(tagInteger, 2)),
+		encode(tagSequence, mustOID(t, ".1.3.6.1.2.1.2.2.1.2.2"), encode(tagOctetString, []byte("eth1"))),
+		encode(tagSequence, mustOID(t, ".1.3.6.1.2.1.2.2.1.6.2"), encode(tagOctetString, []byte{0, 0x1b, 0x21, 0x3c, 0x9d, 0xf8})),
+		encode(tagSequence, mustOID(t, ".1.3.6.1.4.1.9.9.1"), encodeUint(tagCounter64, 1<<40)),
+		encode(tagSequence, mustOID(t, ".1.3.6.1.4.1.9.9.2"), encode(tagNoSuchObject)))
+}
+
+func notification(tag byte, requestID int64, varbinds []byte) []byte {
+	return encode(tag,
+		encodeInt(tagInteger, requestID),
+		encodeInt(tagInteger, 0),
+		encodeInt(tagInteger, 0),
+		varbinds)
+}
+
+var linkDownFields = map[string]interface{}{
+	"sys_uptime":         int64(123456),
+	"ifIndex.2":          int64(2),
+	"ifDescr.2":          "eth1",
+	"ifPhysAddress.2":    "001b213c9df8",
+	".1.3.6.1.4.1.9.9.1": uint64(1 << 40),
+}
+
+func newTestSnmpTrap(t *testing.T, users ...User) (*SnmpTrap, *testutil.Accumulator, *net.UDPConn) {
+	log.SetOutput(ioutil.Discard)
+	s := &SnmpTrap{
+		ServiceAddress:    "127.0.0.1:0",
+		SnmptranslateFile: "testdata/oids.txt",
+		Communities:       []string{"public"},
+		Users:             users,
+	}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Start(acc))
+
+	conn, err := net.DialUDP("udp", nil, s.conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	return s, acc, conn
+}
+
+func waitMetrics(acc *testutil.Accumulator, n int) {
+	for i := 0; i < 200; i++ {
+		acc.Lock()
+		got := len(acc.Metrics)
+		acc.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func readReply(t *testing.T, conn *net.UDPConn) []byte {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func TestSnmpTrapV2c(t *testing.T) {
+	s, acc, conn := newTestSnmpTrap(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	// The trap of an unknown community is dropped
+	for _, community := range []string{"private", "public"} {
+		_, err := conn.Write(encode(tagSequence,
+			encodeInt(tagInteger, 1),
+			encode(tagOctetString, []byte(community)),
+			notification(pduTrapV2, 7, linkDown(t))))
+		require.NoError(t, err)
+	}
+	waitMetrics(acc, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	require.Equal(t, 1, len(acc.Metrics))
+	acc.AssertContainsTaggedFields(t, "snmp_trap", linkDownFields,
+		map[string]string{
+			"source":  "127.0.0.1",
+			"version": "2c",
+			"pdu":     "trap",
+			"oid":     ".1.3.6.1.6.3.1.1.5.3",
+			"name":    "linkDown",
+		})
+}
+
+func TestSnmpTrapV2cInform(t *testing.T) {
+	s, acc, conn := newTestSnmpTrap(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	_, err := conn.Write(encode(tagSequence,
+		encodeInt(tagInteger, 1),
+		encode(tagOctetString, []byte("public")),
+		notification(pduInform, 42, linkDown(t))))
+	require.NoError(t, err)
+
+	// The inform is acknowledged with its variable bindings
+	assert.Equal(t, encode(tagSequence,
+		encodeInt(tagInteger, 1),
+		encode(tagOctetString, []byte("public")),
+		notification(pduResponse, 42, linkDown(t))), readReply(t, conn))
+
+	waitMetrics(acc, 1)
+	require.Equal(t, 1, len(acc.Metrics))
+	assert.Equal(t, "inform", acc.Metrics[0].Tags["pdu"])
+}
+
+var v3User = User{
+	Name:         "monitor",
+	AuthProtocol: "SHA",
+	AuthPassword: "authpassword",
+	PrivProtocol: "AES",
+	PrivPassword: "privpassword",
+}
+
+func scopedPDU(engineID []byte, p []byte) []byte {
+	return encode(tagSequence,
+		encode(tagOctetString, engineID),
+		encode(tagOctetString),
+		p)
+}
+
+func TestSnmpTrapV3(t *testing.T) {
+	s, acc, conn := newTestSnmpTrap(t, v3User)
+	defer s.Stop()
+	defer conn.Close()
+
+	// The sender of a trap is the authoritative engine
+	agentEngineID, _ := hex.DecodeString("80001f88804a6f331c5b3a8f57")
+	user, err := newUSMUser(v3User)
+	require.NoError(t, err)
+	msg, err := buildV3Message(1, flagAuth|flagPriv, user, []byte("monitor"), agentEngineID,
+		3, 86400, []byte("saltsalt"), scopedPDU(agentEngineID, notification(pduTrapV2, 7, linkDown(t))))
+	require.NoError(t, err)
+
+	// Tampered, the authentication fails
+	tampered := append([]byte{}, msg...)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = conn.Write(tampered)
+	require.NoError(t, err)
+
+	// Not at the security level of the user
+	wrongLevel, err := buildV3Message(2, flagAuth, user, []byte("monitor"), agentEngineID,
+		3, 86400, nil, scopedPDU(agentEngineID, notification(pduTrapV2, 8, linkDown(t))))
+	require.NoError(t, err)
+	_, err = conn.Write(wrongLevel)
+	require.NoError(t, err)
+
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+	waitMetrics(acc, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	require.Equal(t, 1, len(acc.Metrics))
+	acc.AssertContainsTaggedFields(t, "snmp_trap", linkDownFields,
+		map[string]string{
+			"source":  "127.0.0.1",
+			"version": "3",
+			"pdu":     "trap",
+			"oid":     ".1.3.6.1.6.3.1.1.5.3",
+			"name":    "linkDown",
+		})
+}
+
+func TestSnmpTrapV3Inform(t *testing.T) {
+	desUser := User{
+		Name:         "informer",
+		AuthProtocol: "MD5",
+		AuthPassword: "authpassword",
+		PrivProtocol: "DES",
+		PrivPassword: "privpassword",
+	}
+	s, acc, conn := newTestSnmpTrap(t, desUser)
+	defer s.Stop()
+	defer conn.Close()
+
+	// Discovery of the engine ID of the listener
+	_, err := conn.Write(encode(tagSequence,
+		encodeInt(tagInteger, 3),
+		encode(tagSequence,
+			encodeInt(tagInteger, 100),
+			encodeInt(tagInteger, 65507),
+			encode(tagOctetString, []byte{flagReportable}),
+			encodeInt(tagInteger, 3)),
+		encode(tagOctetString, encode(tagSequence,
+			encode(tagOctetString),
+			encodeInt(tagInteger, 0),
+			encodeInt(tagInteger, 0),
+			encode(tagOctetString),
+			encode(tagOctetString),
+			encode(tagOctetString))),
+		scopedPDU(nil, notification(pduInform, 9, encode(tagSequence)))))
+	require.NoError(t, err)
+
+	report := readReply(t, conn)
+	d := newDecoder(report)
+	seq, err := d.expect(tagSequence)
+	require.NoError(t, err)
+	m := d.children(seq)
+	m.next()
+	m.next()
+	sp, err := parseSecurityParameters(m)
+	require.NoError(t, err)
+	assert.Equal(t, s.engineID, sp.engineID)
+	assert.Equal(t, s.engineBoots, sp.boots)
+	data, err := m.expect(tagSequence)
+	require.NoError(t, err)
+	sc := m.children(data)
+	sc.octetString()
+	sc.octetString()
+	r, err := sc.next()
+	require.NoError(t, err)
+	assert.Equal(t, byte(pduReport), r.tag)
+	rc := sc.children(r)
+	requestID, err := rc.integer()
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), requestID)
+
+	// The inform, with the keys localized for the listener
+	user, err := newUSMUser(desUser)
+	require.NoError(t, err)
+	msg, err := buildV3Message(101, flagAuth|flagPriv|flagReportable, user, []byte("informer"), sp.engineID,
+		sp.boots, sp.time, []byte("saltsalt"), scopedPDU(sp.engineID, notification(pduInform, 10, linkDown(t))))
+	require.NoError(t, err)
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+
+	resp := readReply(t, conn)
+	d = newDecoder(resp)
+	seq, err = d.expect(tagSequence)
+	require.NoError(t, err)
+	m = d.children(seq)
+	m.next()
+	global, err := m.expect(tagSequence)
+	require.NoError(t, err)
+	g := m.children(global)
+	msgID, _ := g.integer()
+	assert.Equal(t, int64(101), msgID)
+	g.integer()
+	flags, _ := g.octetString()
+	assert.Equal(t, []byte{flagAuth | flagPriv}, flags)
+	sp, err = parseSecurityParameters(m)
+	require.NoError(t, err)
+
+	// Authenticated and encrypted by the listener
+	authKey, privKey := user.keys(sp.engineID)
+	zeroed := append([]byte{}, resp...)
+	copy(zeroed[sp.auth.off:], make([]byte, authParamsLength))
+	assert.Equal(t, authParams(user.hash, authKey, zeroed), sp.auth.value)
+	encrypted, err := m.octetString()
+	require.NoError(t, err)
+	plain, err := decrypt("DES", privKey, sp.boots, sp.time, sp.privParams, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, scopedPDU(s.engineID, notification(pduResponse, 10, linkDown(t))),
+		plain[:len(scopedPDU(s.engineID, notification(pduResponse, 10, linkDown(t))))])
+
+	waitMetrics(acc, 1)
+	require.Equal(t, 1, len(acc.Metrics))
+	assert.Equal(t, "inform", acc.Metrics[0].Tags["pdu"])
+	assert.Equal(t, "linkDown", acc.Metrics[0].Tags["name"])
+}
+
+// Test vectors of RFC 3414 A.3
+func TestLocalizeKey(t *testing.T) {
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	assert.Equal(t, "526f5eed9fcce26f8964c2930787d82b",
+		hex.EncodeToString(localizeKey(md5.New, passwordToKey(md5.New, "maplesyrup"), engineID)))
+	assert.Equal(t, "6695febc9288e36282235fc7151f128497b38f3f",
+		hex.EncodeToString(localizeKey(sha1.New, passwordToKey(sha1.New, "maplesyrup"), engineID)))
+}
+
+func TestOID(t *testing.T) {
+	for _, oid := range []string{".1.3.6.1.6.3.1.1.5.3", ".2.999.3", ".1.3.6.1.4.1.2021.4294967295"} {
+		b, err := encodeOID(oid)
+		require.NoError(t, err)
+		d := newDecoder(b)
+		v, err := d.expect(tagOID)
+		require.NoError(t, err)
+		parsed, err := parseOID(v.value)
+		require.NoError(t, err)
+		assert.Equal(t, oid, parsed)
+	}
+	for _, v := range []int64{0, 127, 128, -1, -129, 1 << 40} {
+		d := newDecoder(encodeInt(tagInteger, v))
+		parsed, err := d.integer()
+		require.NoError(t, err)
+		assert.Equal(t, v, parsed)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s := &SnmpTrap{names: parseNames([]byte("ifDescr\t\t\t1.3.6.1.2.1.2.2.1.2\n"))}
+	assert.Equal(t, "ifDescr.2", s.lookup(".1.3.6.1.2.1.2.2.1.2.2"))
+	assert.Equal(t, "ifDescr", s.lookup(".1.3.6.1.2.1.2.2.1.2"))
+	assert.Equal(t, ".1.3.6.1.2.1.2.2.1.3.2", s.lookup(".1.3.6.1.2.1.2.2.1.3.2"))
+}
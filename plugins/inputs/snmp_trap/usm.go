@@ -0,0 +1,184 @@
+package snmp_trap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Length of the HMAC-MD5-96 and HMAC-SHA-96 authentication parameters.
+const authParamsLength = 12
+
+// usmUser is a user of the User-based Security Model, RFC 3414.
+type usmUser struct {
+	name string
+	// nil without authentication
+	hash func() hash.Hash
+	// "", "DES" or "AES"
+	priv string
+
+	authKu []byte
+	privKu []byte
+	// Keys localized for the engines, by engine ID
+	localized map[string][2][]byte
+}
+
+func newUSMUser(u User) (*usmUser, error) {
+	user := &usmUser{name: u.Name, localized: make(map[string][2][]byte)}
+	switch strings.ToUpper(u.AuthProtocol) {
+	case "":
+		if u.PrivProtocol != "" {
+			return nil, fmt.Errorf("user %s: privacy requires authentication", u.Name)
+		}
+		return user, nil
+	case "MD5":
+		user.hash = md5.New
+	case "SHA":
+		user.hash = sha1.New
+	default:
+		return nil, fmt.Errorf("user %s: unsupported auth_protocol %s", u.Name, u.AuthProtocol)
+	}
+	if len(u.AuthPassword) < 8 {
+		return nil, fmt.Errorf("user %s: auth_password must be at least 8 characters", u.Name)
+	}
+	user.authKu = passwordToKey(user.hash, u.AuthPassword)
+
+	switch strings.ToUpper(u.PrivProtocol) {
+	case "":
+		return user, nil
+	case "DES", "AES":
+		user.priv = strings.ToUpper(u.PrivProtocol)
+	default:
+		return nil, fmt.Errorf("user %s: unsupported priv_protocol %s", u.Name, u.PrivProtocol)
+	}
+	if len(u.PrivPassword) < 8 {
+		return nil, fmt.Errorf("user %s: priv_password must be at least 8 characters", u.Name)
+	}
+	user.privKu = passwordToKey(user.hash, u.PrivPassword)
+	return user, nil
+}
+
+// keys returns the authentication and privacy keys of u localized for the
+// engine.
+func (u *usmUser) keys(engineID []byte) ([]byte, []byte) {
+	k, ok := u.localized[string(engineID)]
+	if !ok {
+		k[0] = localizeKey(u.hash, u.authKu, engineID)
+		if u.privKu != nil {
+			k[1] = localizeKey(u.hash, u.privKu, engineID)
+		}
+		u.localized[string(engineID)] = k
+	}
+	return k[0], k[1]
+}
+
+// passwordToKey returns the key of password, the hash of a megabyte of the
+// repeated password, RFC 3414 A.2.
+func passwordToKey(h func() hash.Hash, password string) []byte {
+	d := h()
+	buf := make([]byte, 64)
+	p := []byte(password)
+	var j int
+	for i := 0; i < 1048576; i += len(buf) {
+		for k := range buf {
+			buf[k] = p[j%len(p)]
+			j++
+		}
+		d.Write(buf)
+	}
+	return d.Sum(nil)
+}
+
+func localizeKey(h func() hash.Hash, ku, engineID []byte) []byte {
+	d := h()
+	d.Write(ku)
+	d.Write(engineID)
+	d.Write(ku)
+	return d.Sum(nil)
+}
+
+// authParams returns the authentication parameters of msg, serialized with
+// zeros as authentication parameters.
+func authParams(h func() hash.Hash, key, msg []byte) []byte {
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	return mac.Sum(nil)[:authParamsLength]
+}
+
+func decrypt(priv string, key []byte, boots, time int64, salt, data []byte) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, fmt.Errorf("invalid privacy parameters of %d bytes", len(salt))
+	}
+	out := make([]byte, len(data))
+	switch priv {
+	case "DES":
+		if len(data)%des.BlockSize != 0 {
+			return nil, errors.New("encrypted data not a multiple of the DES block size")
+		}
+		block, err := des.NewCipher(key[:8])
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCBCDecrypter(block, desIV(key, salt)).CryptBlocks(out, data)
+	case "AES":
+		block, err := aes.NewCipher(key[:16])
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCFBDecrypter(block, aesIV(boots, time, salt)).XORKeyStream(out, data)
+	}
+	return out, nil
+}
+
+func encrypt(priv string, key []byte, boots, time int64, salt, data []byte) ([]byte, error) {
+	switch priv {
+	case "DES":
+		// The padding is ignored after the BER element
+		if n := len(data) % des.BlockSize; n != 0 {
+			data = append(data, make([]byte, des.BlockSize-n)...)
+		}
+		block, err := des.NewCipher(key[:8])
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCEncrypter(block, desIV(key, salt)).CryptBlocks(out, data)
+		return out, nil
+	case "AES":
+		block, err := aes.NewCipher(key[:16])
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		cipher.NewCFBEncrypter(block, aesIV(boots, time, salt)).XORKeyStream(out, data)
+		return out, nil
+	}
+	return data, nil
+}
+
+// desIV is the pre-IV, the second half of the DES key, xored with the salt,
+// RFC 3414 8.1.1.1.
+func desIV(key, salt []byte) []byte {
+	iv := make([]byte, des.BlockSize)
+	for i := range iv {
+		iv[i] = key[8+i] ^ salt[i]
+	}
+	return iv
+}
+
+// aesIV is the engine boots and time followed by the salt, RFC 3826 3.1.2.1.
+func aesIV(boots, time int64, salt []byte) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(time))
+	copy(iv[8:], salt)
+	return iv
+}
@@ -0,0 +1,181 @@
+package systemd_units
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// SystemdUnits reports the state and resource accounting of systemd units,
+// queried through systemctl, which talks to systemd over D-Bus.
+type SystemdUnits struct {
+	UnitType string `toml:"unit_type"`
+	Units    []string
+	Timeout  internal.Duration
+
+	systemctl func(timeout time.Duration, args ...string) (string, error)
+}
+
+// Properties of the units read from systemctl show.
+var properties = []string{
+	"Id", "LoadState", "ActiveState", "SubState",
+	"NRestarts", "MemoryCurrent", "CPUUsageNSec", "TasksCurrent",
+}
+
+// Codes of the active_code field, as the ActiveState enum of systemd.
+var activeCodes = map[string]int64{
+	"active":       0,
+	"reloading":    1,
+	"inactive":     2,
+	"failed":       3,
+	"activating":   4,
+	"deactivating": 5,
+}
+
+// Integer properties reported as fields, unless systemd has no value.
+var counters = map[string]string{
+	"NRestarts":     "restarts",
+	"MemoryCurrent": "memory_current",
+	"CPUUsageNSec":  "cpu_usage_nsec",
+	"TasksCurrent":  "tasks_current",
+}
+
+var sampleConfig = `
+  ## Type of the units to report: "service", "socket", "timer", "mount", ...
+  # unit_type = "service"
+  ## Glob patterns of the names of the units to report, all the loaded units
+  ## of unit_type if empty
+  # units = ["nginx.service", "uwsgi@*.service"]
+
+  ## Timeout of the systemctl commands
+  # timeout = "5s"
+`
+
+func (s *SystemdUnits) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *SystemdUnits) Description() string {
+	return "Read the state, restarts and resource accounting of systemd units"
+}
+
+func (s *SystemdUnits) Gather(acc telegraf.Accumulator) error {
+	timeout := s.Timeout.Duration
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	unitType := s.UnitType
+	if unitType == "" {
+		unitType = "service"
+	}
+
+	args := []string{"list-units", "--all", "--plain", "--no-legend",
+		"--no-pager", "--type=" + unitType}
+	out, err := s.systemctl(timeout, append(args, s.Units...)...)
+	if err != nil {
+		return err
+	}
+	var units []string
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			units = append(units, fields[0])
+		}
+	}
+	if len(units) == 0 {
+		return nil
+	}
+
+	args = []string{"show", "--no-pager",
+		"--property=" + strings.Join(properties, ",")}
+	out, err = s.systemctl(timeout, append(args, units...)...)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, unit := range parseShow(out) {
+		if unit["Id"] == "" {
+			continue
+		}
+		tags := map[string]string{
+			"name":   unit["Id"],
+			"load":   unit["LoadState"],
+			"active": unit["ActiveState"],
+			"sub":    unit["SubState"],
+		}
+		code, ok := activeCodes[unit["ActiveState"]]
+		if !ok {
+			code = -1
+		}
+		fields := map[string]interface{}{
+			"active_code": code,
+		}
+		for property, field := range counters {
+			// Unset values are "[not set]" or the maximum uint64
+			v, err := strconv.ParseUint(unit[property], 10, 64)
+			if err == nil && v != ^uint64(0) {
+				fields[field] = v
+			}
+		}
+		acc.AddFields("systemd_units", fields, tags, now)
+	}
+	return nil
+}
+
+// parseShow splits the output of systemctl show into the properties of
+// each unit.
+func parseShow(out string) []map[string]string {
+	var units []map[string]string
+	unit := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(unit) > 0 {
+				units = append(units, unit)
+				unit = make(map[string]string)
+			}
+			continue
+		}
+		if i := strings.Index(line, "="); i > 0 {
+			unit[line[:i]] = line[i+1:]
+		}
+	}
+	if len(unit) > 0 {
+		units = append(units, unit)
+	}
+	return units
+}
+
+// systemctl runs systemctl with args and returns its output.
+func systemctl(timeout time.Duration, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "systemctl", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("run systemctl %s: %s (%s)",
+			strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.String(), nil
+}
+
+func init() {
+	inputs.Add("systemd_units", func() telegraf.Input {
+		return &SystemdUnits{
+			UnitType:  "service",
+			Timeout:   internal.Duration{Duration: 5 * time.Second},
+			systemctl: systemctl,
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package systemd_units
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const listUnits = `nginx.service          loaded active   running A high performance web server
+uwsgi@api.service      loaded failed   failed  uWSGI api
+old.service            not-found inactive dead old.service
+`
+
+const showUnits = `Id=nginx.service
+LoadState=loaded
+ActiveState=active
+SubState=running
+NRestarts=2
+MemoryCurrent=12922880
+CPUUsageNSec=185000000
+TasksCurrent=3
+
+Id=uwsgi@api.service
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+NRestarts=5
+MemoryCurrent=[not set]
+CPUUsageNSec=18446744073709551615
+TasksCurrent=18446744073709551615
+
+Id=old.service
+LoadState=not-found
+ActiveState=inactive
+SubState=dead
+NRestarts=0
+MemoryCurrent=[not set]
+CPUUsageNSec=[not set]
+TasksCurrent=[not set]
+`
+
+func TestSystemdUnits(t *testing.T) {
+	var calls [][]string
+	s := &SystemdUnits{
+		Units: []string{"nginx*", "uwsgi@*", "old.service"},
+		systemctl: func(timeout time.Duration, args ...string) (string, error) {
+			calls = append(calls, args)
+			if args[0] == "list-units" {
+				return listUnits, nil
+			}
+			return showUnits, nil
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "systemd_units",
+		map[string]interface{}{
+			"active_code":    int64(0),
+			"restarts":       uint64(2),
+			"memory_current": uint64(12922880),
+			"cpu_usage_nsec": uint64(185000000),
+			"tasks_current":  uint64(3),
+		},
+		map[string]string{
+			"name":   "nginx.service",
+			"load":   "loaded",
+			"active": "active",
+			"sub":    "running",
+		})
+	// Unset accounting values are not reported
+	acc.AssertContainsTaggedFields(t, "systemd_units",
+		map[string]interface{}{
+			"active_code": int64(3),
+			"restarts":    uint64(5),
+		},
+		map[string]string{
+			"name":   "uwsgi@api.service",
+			"load":   "loaded",
+			"active": "failed",
+			"sub":    "failed",
+		})
+	acc.AssertContainsTaggedFields(t, "systemd_units",
+		map[string]interface{}{
+			"active_code": int64(2),
+			"restarts":    uint64(0),
+		},
+		map[string]string{
+			"name":   "old.service",
+			"load":   "not-found",
+			"active": "inactive",
+			"sub":    "dead",
+		})
+	assert.Equal(t, 3, len(acc.Metrics))
+
+	require.Len(t, calls, 2)
+	assert.Equal(t, "--type=service nginx* uwsgi@* old.service",
+		strings.Join(calls[0][5:], " "))
+	assert.Equal(t, []string{"nginx.service", "uwsgi@api.service",
+		"old.service"}, calls[1][3:])
+}
+
+func TestSystemdUnitsNoUnits(t *testing.T) {
+	s := &SystemdUnits{
+		UnitType: "timer",
+		systemctl: func(timeout time.Duration, args ...string) (string, error) {
+			if args[0] != "list-units" || args[5] != "--type=timer" {
+				t.Fatalf("unexpected systemctl %v", args)
+			}
+			return "", nil
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+	assert.Empty(t, acc.Metrics)
+}
+
+func TestSystemdUnitsError(t *testing.T) {
+	s := &SystemdUnits{
+		systemctl: func(timeout time.Duration, args ...string) (string, error) {
+			return "", errors.New("Failed to connect to bus")
+		},
+	}
+	var acc testutil.Accumulator
+	assert.Error(t, s.Gather(&acc))
+}
@@ -0,0 +1,166 @@
+//go:build linux
+// +build linux
+
+package tcp_stats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Constants of linux/sock_diag.h, linux/inet_diag.h and linux/tcp.h
+const (
+	netlinkInetDiag  = 4
+	sockDiagByFamily = 20
+	inetDiagInfo     = 2
+
+	tcpEstablished = 1
+	tcpSynSent     = 2
+	tcpListen      = 10
+
+	// Sizes of struct inet_diag_req_v2 and struct inet_diag_msg
+	diagReqLen = 56
+	diagMsgLen = 72
+)
+
+// nativeEndian is the byte order of the netlink messages.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	var i uint16 = 1
+	if (*[2]byte)(unsafe.Pointer(&i))[0] == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// tcpConn is a TCP socket reported by the inet_diag netlink interface.
+type tcpConn struct {
+	state      uint8
+	retrans    uint8
+	localPort  uint16
+	remote     net.IP
+	remotePort uint16
+	// info is nil when the kernel doesn't report the tcp_info of the socket
+	info *tcpInfo
+}
+
+// tcpInfo holds the fields of struct tcp_info used by the plugin.
+type tcpInfo struct {
+	lost         uint32
+	rtt          uint32
+	totalRetrans uint32
+}
+
+// dumpConnections returns the established, connecting and listening TCP
+// sockets of family, syscall.AF_INET or syscall.AF_INET6.
+func dumpConnections(family uint8, timeout time.Duration) ([]tcpConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, netlinkInetDiag)
+	if err != nil {
+		return nil, fmt.Errorf("open sock_diag netlink socket: %s", err)
+	}
+	defer syscall.Close(fd)
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET,
+		syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+
+	req := make([]byte, syscall.NLMSG_HDRLEN+diagReqLen)
+	nativeEndian.PutUint32(req[0:], uint32(len(req)))
+	nativeEndian.PutUint16(req[4:], sockDiagByFamily)
+	nativeEndian.PutUint16(req[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	nativeEndian.PutUint32(req[8:], 1)
+	r := req[syscall.NLMSG_HDRLEN:]
+	r[0] = family
+	r[1] = syscall.IPPROTO_TCP
+	r[2] = 1 << (inetDiagInfo - 1)
+	nativeEndian.PutUint32(r[4:],
+		1<<tcpEstablished|1<<tcpSynSent|1<<tcpListen)
+	if err := syscall.Sendto(fd, req, 0,
+		&syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("send sock_diag request: %s", err)
+	}
+
+	var conns []tcpConn
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("receive sock_diag reply: %s", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return conns, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					errno := int32(nativeEndian.Uint32(m.Data))
+					return nil, fmt.Errorf("sock_diag: %s",
+						syscall.Errno(-errno))
+				}
+				return nil, fmt.Errorf("sock_diag: truncated error")
+			case sockDiagByFamily:
+				if c, ok := parseDiagMsg(m.Data); ok {
+					conns = append(conns, c)
+				}
+			}
+		}
+	}
+}
+
+// parseDiagMsg parses a struct inet_diag_msg and its attributes.
+func parseDiagMsg(b []byte) (tcpConn, bool) {
+	if len(b) < diagMsgLen {
+		return tcpConn{}, false
+	}
+	c := tcpConn{
+		state:   b[1],
+		retrans: b[3],
+		// The ports and addresses of struct inet_diag_sockid are in
+		// network byte order
+		localPort:  binary.BigEndian.Uint16(b[4:]),
+		remotePort: binary.BigEndian.Uint16(b[6:]),
+	}
+	switch b[0] {
+	case syscall.AF_INET:
+		c.remote = net.IP(append([]byte(nil), b[24:28]...))
+	case syscall.AF_INET6:
+		c.remote = net.IP(append([]byte(nil), b[24:40]...))
+	default:
+		return tcpConn{}, false
+	}
+
+	attrs := b[diagMsgLen:]
+	for len(attrs) >= syscall.SizeofRtAttr {
+		l := int(nativeEndian.Uint16(attrs[0:]))
+		typ := nativeEndian.Uint16(attrs[2:])
+		if l < syscall.SizeofRtAttr || l > len(attrs) {
+			break
+		}
+		data := attrs[syscall.SizeofRtAttr:l]
+		// struct tcp_info grew with the kernel versions, total_retrans is
+		// in all of them since 2.6
+		if typ == inetDiagInfo && len(data) >= 104 {
+			c.info = &tcpInfo{
+				lost:         nativeEndian.Uint32(data[32:]),
+				rtt:          nativeEndian.Uint32(data[68:]),
+				totalRetrans: nativeEndian.Uint32(data[100:]),
+			}
+		}
+		l = (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if l > len(attrs) {
+			break
+		}
+		attrs = attrs[l:]
+	}
+	return c, true
+}
@@ -0,0 +1,219 @@
+//go:build linux
+// +build linux
+
+package tcp_stats
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// TCPStats reports the kernel TCP counters and the RTT and retransmits of
+// the open connections, per destination.
+type TCPStats struct {
+	Ports       []int
+	Percentiles []int
+
+	procRoot string
+	dump     func(family uint8, timeout time.Duration) ([]tcpConn, error)
+}
+
+// Counters of /proc/net/snmp and /proc/net/netstat, by the field they are
+// reported as.
+var snmpCounters = map[string]string{
+	"Tcp:ActiveOpens":          "active_opens",
+	"Tcp:PassiveOpens":         "passive_opens",
+	"Tcp:AttemptFails":         "attempt_fails",
+	"Tcp:EstabResets":          "estab_resets",
+	"Tcp:CurrEstab":            "curr_estab",
+	"Tcp:OutSegs":              "out_segs",
+	"Tcp:RetransSegs":          "retrans_segs",
+	"Tcp:InErrs":               "in_errs",
+	"Tcp:OutRsts":              "out_rsts",
+	"TcpExt:TCPTimeouts":       "timeouts",
+	"TcpExt:TCPSynRetrans":     "syn_retrans",
+	"TcpExt:TCPLostRetransmit": "lost_retransmit",
+}
+
+var sampleConfig = `
+  ## Destination ports of the connections to report, all of them if empty
+  # ports = [5432, 6379]
+
+  ## Percentiles of the RTT of the connections to each destination
+  # percentiles = [50, 90, 99]
+`
+
+func (t *TCPStats) SampleConfig() string {
+	return sampleConfig
+}
+
+func (t *TCPStats) Description() string {
+	return "Read the TCP retransmits, RTT and connection failures, per destination"
+}
+
+// destination accumulates the connections to an address and port.
+type destination struct {
+	established  int64
+	synSent      int64
+	synRetrans   int64
+	totalRetrans int64
+	lost         int64
+	rtts         []int
+}
+
+func (t *TCPStats) Gather(acc telegraf.Accumulator) error {
+	now := time.Now()
+	fields := make(map[string]interface{})
+	for _, file := range []string{"snmp", "netstat"} {
+		path := filepath.Join(t.procRoot, "net", file)
+		if err := readCounters(path, fields); err != nil {
+			return err
+		}
+	}
+	acc.AddFields("tcp_stats", fields, map[string]string{}, now)
+
+	var conns []tcpConn
+	for _, family := range []uint8{syscall.AF_INET, syscall.AF_INET6} {
+		c, err := t.dump(family, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, c...)
+	}
+
+	// Connections to the ports the host listens on are accepted ones, the
+	// destinations are the peers of the outgoing connections only
+	listening := make(map[uint16]bool)
+	for _, c := range conns {
+		if c.state == tcpListen {
+			listening[c.localPort] = true
+		}
+	}
+	ports := make(map[uint16]bool)
+	for _, p := range t.Ports {
+		ports[uint16(p)] = true
+	}
+
+	dests := make(map[string]*destination)
+	for _, c := range conns {
+		if c.state == tcpListen || listening[c.localPort] {
+			continue
+		}
+		if len(ports) > 0 && !ports[c.remotePort] {
+			continue
+		}
+		key := net.JoinHostPort(c.remote.String(), strconv.Itoa(int(c.remotePort)))
+		d, ok := dests[key]
+		if !ok {
+			d = &destination{}
+			dests[key] = d
+		}
+		switch c.state {
+		case tcpSynSent:
+			d.synSent++
+			d.synRetrans += int64(c.retrans)
+		case tcpEstablished:
+			d.established++
+			if c.info != nil {
+				d.totalRetrans += int64(c.info.totalRetrans)
+				d.lost += int64(c.info.lost)
+				d.rtts = append(d.rtts, int(c.info.rtt))
+			}
+		}
+	}
+
+	percentiles := t.Percentiles
+	if percentiles == nil {
+		percentiles = []int{50, 90, 99}
+	}
+	for key, d := range dests {
+		host, port, _ := net.SplitHostPort(key)
+		fields := map[string]interface{}{
+			"established":     d.established,
+			"syn_sent":        d.synSent,
+			"syn_retransmits": d.synRetrans,
+			"retransmits":     d.totalRetrans,
+			"lost":            d.lost,
+		}
+		if len(d.rtts) > 0 {
+			sort.Ints(d.rtts)
+			for _, p := range percentiles {
+				fields[fmt.Sprintf("rtt_p%d_us", p)] = int64(percentile(d.rtts, p))
+			}
+			fields["rtt_max_us"] = int64(d.rtts[len(d.rtts)-1])
+		}
+		tags := map[string]string{
+			"remote_address": host,
+			"remote_port":    port,
+		}
+		acc.AddFields("tcp_stats_destination", fields, tags, now)
+	}
+	return nil
+}
+
+// percentile returns the nearest rank p percentile of the sorted values.
+func percentile(sorted []int, p int) int {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// readCounters reads the snmpCounters of a /proc/net/snmp formatted file,
+// made of pairs of header and value lines.
+func readCounters(path string, fields map[string]interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		header := strings.Fields(scanner.Text())
+		if !scanner.Scan() {
+			break
+		}
+		values := strings.Fields(scanner.Text())
+		if len(header) == 0 || len(header) != len(values) ||
+			header[0] != values[0] {
+			return fmt.Errorf("malformed %s", path)
+		}
+		for i := 1; i < len(header); i++ {
+			field, ok := snmpCounters[header[0]+header[i]]
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseInt(values[i], 10, 64)
+			if err != nil {
+				return fmt.Errorf("malformed %s: %s", path, err)
+			}
+			fields[field] = v
+		}
+	}
+	return scanner.Err()
+}
+
+func init() {
+	inputs.Add("tcp_stats", func() telegraf.Input {
+		return &TCPStats{
+			Percentiles: []int{50, 90, 99},
+			procRoot:    "/proc",
+			dump:        dumpConnections,
+		}
+	})
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+package tcp_stats
+
+import (
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+type TCPStats struct {
+}
+
+func (t *TCPStats) Description() string {
+	return "Read the TCP retransmits, RTT and connection failures, per destination"
+}
+
+func (t *TCPStats) SampleConfig() string { return "" }
+
+func (t *TCPStats) Gather(acc telegraf.Accumulator) error {
+	return nil
+}
+
+func init() {
+	inputs.Add("tcp_stats", func() telegraf.Input {
+		return &TCPStats{}
+	})
+}
@@ -0,0 +1,185 @@
+//go:build linux
+// +build linux
+
+package tcp_stats
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const snmpFile = `Ip: Forwarding DefaultTTL InReceives
+Ip: 1 64 5000
+Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors
+Tcp: 1 200 120000 -1 1981 1897 14 119 6 54006 55735 5 0 119 0
+`
+
+const netstatFile = `TcpExt: SyncookiesSent TCPTimeouts TCPLostRetransmit TCPSynRetrans
+TcpExt: 0 7 2 5
+IpExt: InNoRoutes
+IpExt: 0
+`
+
+func makeProc(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tcp_stats")
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "net"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "net", "snmp"),
+		[]byte(snmpFile), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "net", "netstat"),
+		[]byte(netstatFile), 0644))
+	return dir
+}
+
+func TestGather(t *testing.T) {
+	dir := makeProc(t)
+	defer os.RemoveAll(dir)
+
+	db := net.ParseIP("10.0.0.5").To4()
+	conns := map[uint8][]tcpConn{
+		syscall.AF_INET: {
+			{state: tcpListen, localPort: 8080},
+			// Accepted connection
+			{state: tcpEstablished, localPort: 8080, remote: net.ParseIP("10.0.0.9").To4(),
+				remotePort: 51000, info: &tcpInfo{rtt: 100}},
+			{state: tcpEstablished, localPort: 40001, remote: db, remotePort: 5432,
+				info: &tcpInfo{rtt: 300, totalRetrans: 2, lost: 1}},
+			{state: tcpEstablished, localPort: 40002, remote: db, remotePort: 5432,
+				info: &tcpInfo{rtt: 100}},
+			{state: tcpEstablished, localPort: 40003, remote: db, remotePort: 5432,
+				info: &tcpInfo{rtt: 200, totalRetrans: 1}},
+			{state: tcpSynSent, localPort: 40004, remote: db, remotePort: 5432, retrans: 3},
+			{state: tcpEstablished, localPort: 40005, remote: db, remotePort: 22,
+				info: &tcpInfo{rtt: 50}},
+		},
+		syscall.AF_INET6: {
+			{state: tcpSynSent, localPort: 40006, remote: net.ParseIP("fd00::1"),
+				remotePort: 5432, retrans: 1},
+		},
+	}
+	s := &TCPStats{
+		Ports:       []int{5432},
+		Percentiles: []int{50, 90},
+		procRoot:    dir,
+		dump: func(family uint8, timeout time.Duration) ([]tcpConn, error) {
+			return conns[family], nil
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, s.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "tcp_stats",
+		map[string]interface{}{
+			"active_opens":    int64(1981),
+			"passive_opens":   int64(1897),
+			"attempt_fails":   int64(14),
+			"estab_resets":    int64(119),
+			"curr_estab":      int64(6),
+			"out_segs":        int64(55735),
+			"retrans_segs":    int64(5),
+			"in_errs":         int64(0),
+			"out_rsts":        int64(119),
+			"timeouts":        int64(7),
+			"syn_retrans":     int64(5),
+			"lost_retransmit": int64(2),
+		},
+		map[string]string{})
+	acc.AssertContainsTaggedFields(t, "tcp_stats_destination",
+		map[string]interface{}{
+			"established":     int64(3),
+			"syn_sent":        int64(1),
+			"syn_retransmits": int64(3),
+			"retransmits":     int64(3),
+			"lost":            int64(1),
+			"rtt_p50_us":      int64(200),
+			"rtt_p90_us":      int64(300),
+			"rtt_max_us":      int64(300),
+		},
+		map[string]string{"remote_address": "10.0.0.5", "remote_port": "5432"})
+	// The RTT of a destination without established connections is unknown
+	acc.AssertContainsTaggedFields(t, "tcp_stats_destination",
+		map[string]interface{}{
+			"established":     int64(0),
+			"syn_sent":        int64(1),
+			"syn_retransmits": int64(1),
+			"retransmits":     int64(0),
+			"lost":            int64(0),
+		},
+		map[string]string{"remote_address": "fd00::1", "remote_port": "5432"})
+	assert.Equal(t, 3, len(acc.Metrics))
+}
+
+func TestGatherMissingProc(t *testing.T) {
+	s := &TCPStats{procRoot: "/nonexistent"}
+	var acc testutil.Accumulator
+	assert.Error(t, s.Gather(&acc))
+}
+
+func TestParseDiagMsg(t *testing.T) {
+	b := make([]byte, diagMsgLen+syscall.SizeofRtAttr+104)
+	b[0] = syscall.AF_INET6
+	b[1] = tcpEstablished
+	b[3] = 4
+	binary.BigEndian.PutUint16(b[4:], 40001)
+	binary.BigEndian.PutUint16(b[6:], 443)
+	copy(b[24:], net.ParseIP("2001:db8::1"))
+	attr := b[diagMsgLen:]
+	nativeEndian.PutUint16(attr[0:], uint16(syscall.SizeofRtAttr+104))
+	nativeEndian.PutUint16(attr[2:], inetDiagInfo)
+	info := attr[syscall.SizeofRtAttr:]
+	nativeEndian.PutUint32(info[32:], 2)
+	nativeEndian.PutUint32(info[68:], 1500)
+	nativeEndian.PutUint32(info[100:], 9)
+
+	c, ok := parseDiagMsg(b)
+	require.True(t, ok)
+	assert.Equal(t, uint8(tcpEstablished), c.state)
+	assert.Equal(t, uint8(4), c.retrans)
+	assert.Equal(t, uint16(40001), c.localPort)
+	assert.Equal(t, uint16(443), c.remotePort)
+	assert.Equal(t, "2001:db8::1", c.remote.String())
+	assert.Equal(t, &tcpInfo{lost: 2, rtt: 1500, totalRetrans: 9}, c.info)
+
+	_, ok = parseDiagMsg(b[:diagMsgLen-1])
+	assert.False(t, ok)
+}
+
+func TestDumpConnections(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	c, err := net.Dial("tcp4", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	conns, err := dumpConnections(syscall.AF_INET, time.Second)
+	if err != nil {
+		t.Skipf("sock_diag is not available: %s", err)
+	}
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	var listening, established bool
+	for _, conn := range conns {
+		if conn.state == tcpListen && conn.localPort == port {
+			listening = true
+		}
+		if conn.state == tcpEstablished && conn.remotePort == port &&
+			conn.remote.Equal(net.ParseIP("127.0.0.1")) {
+			established = conn.info != nil
+		}
+	}
+	assert.True(t, listening)
+	assert.True(t, established)
+}
@@ -0,0 +1,174 @@
+package uwsgi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// Kubernetes discovers the stats servers of the pods matching a label
+// selector through the Kubernetes API.
+type Kubernetes struct {
+	// API server, defaults to the in-cluster service
+	APIURL string `toml:"api_url"`
+	// Namespace of the pods, all namespaces if empty
+	Namespace     string `toml:"namespace"`
+	LabelSelector string `toml:"label_selector"`
+	// Name of the container port of the stats server
+	PortName string `toml:"port_name"`
+	// Scheme of the discovered urls: "tcp", "http" or "https"
+	Scheme string `toml:"scheme"`
+
+	// Bearer token file path, defaults to the pod service account token
+	BearerToken string `toml:"bearer_token"`
+	// Path to CA file, defaults to the pod service account CA
+	TLSCA string `toml:"tls_ca"`
+	// Use TLS but skip chain & host verification
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
+
+	client *http.Client
+}
+
+// podList is the part of the Kubernetes PodList used for discovery.
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []struct {
+				Ports []struct {
+					Name          string `json:"name"`
+					ContainerPort int    `json:"containerPort"`
+				} `json:"ports"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// servers lists the running pods and returns the stats server of each one
+// exposing the named port, tagged with the pod name and namespace.
+func (k *Kubernetes) servers(timeout time.Duration) ([]Server, error) {
+	if k.client == nil {
+		ca := k.TLSCA
+		if ca == "" && k.APIURL == "" {
+			ca = serviceAccountDir + "ca.crt"
+		}
+		tlsCfg, err := internal.GetTLSConfig("", "", ca, k.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		k.client = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsCfg},
+			Timeout:   timeout,
+		}
+	}
+
+	addr, err := k.podsURL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token := k.BearerToken
+	if token == "" && k.APIURL == "" {
+		token = serviceAccountDir + "token"
+	}
+	if token != "" {
+		t, err := ioutil.ReadFile(token)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization",
+			"Bearer "+strings.TrimSpace(string(t)))
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list Kubernetes pods: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP status %s", addr, resp.Status)
+	}
+
+	var pods podList
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("Could not decode Kubernetes pods: %s", err)
+	}
+
+	scheme := k.Scheme
+	if scheme == "" {
+		scheme = "tcp"
+	}
+
+	var servers []Server
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != "Running" || pod.Status.PodIP == "" {
+			continue
+		}
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name != k.PortName {
+					continue
+				}
+				u := scheme + "://" + net.JoinHostPort(pod.Status.PodIP,
+					strconv.Itoa(p.ContainerPort))
+				if scheme == "http" || scheme == "https" {
+					u += "/"
+				}
+				servers = append(servers, Server{
+					URL: u,
+					Tags: map[string]string{
+						"pod":       pod.Metadata.Name,
+						"namespace": pod.Metadata.Namespace,
+					},
+				})
+			}
+		}
+	}
+	return servers, nil
+}
+
+// podsURL returns the url listing the pods to discover.
+func (k *Kubernetes) podsURL() (string, error) {
+	api := k.APIURL
+	if api == "" {
+		host := os.Getenv("KUBERNETES_SERVICE_HOST")
+		port := os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return "", fmt.Errorf("kubernetes api_url is not set and " +
+				"the agent does not run in a Kubernetes pod")
+		}
+		api = "https://" + net.JoinHostPort(host, port)
+	}
+
+	path := "/api/v1/pods"
+	if k.Namespace != "" {
+		path = "/api/v1/namespaces/" + url.QueryEscape(k.Namespace) + "/pods"
+	}
+	addr := strings.TrimSuffix(api, "/") + path
+	if k.LabelSelector != "" {
+		addr += "?labelSelector=" + url.QueryEscape(k.LabelSelector)
+	}
+	return addr, nil
+}
@@ -0,0 +1,81 @@
+package uwsgi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const podsResponse = `
+{
+  "kind": "PodList",
+  "items": [
+    {
+      "metadata": {"name": "api-1", "namespace": "prod"},
+      "spec": {"containers": [{"ports": [
+        {"name": "http", "containerPort": 8080},
+        {"name": "uwsgi-stats", "containerPort": %d}
+      ]}]},
+      "status": {"phase": "Running", "podIP": "127.0.0.1"}
+    },
+    {
+      "metadata": {"name": "api-2", "namespace": "prod"},
+      "spec": {"containers": [{"ports": [
+        {"name": "uwsgi-stats", "containerPort": 1717}
+      ]}]},
+      "status": {"phase": "Pending"}
+    }
+  ]
+}`
+
+func TestKubernetesDiscovery(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go serveRaw(l)
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/namespaces/prod/pods", r.URL.Path)
+		require.Equal(t, "app=api", r.URL.Query().Get("labelSelector"))
+		fmt.Fprintf(w, podsResponse, p)
+	}))
+	defer api.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		Kubernetes: &Kubernetes{
+			APIURL:        api.URL,
+			Namespace:     "prod",
+			LabelSelector: "app=api",
+			PortName:      "uwsgi-stats",
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	assertStats(t, &acc, map[string]string{
+		"source":    "127.0.0.1",
+		"pod":       "api-1",
+		"namespace": "prod",
+	})
+}
+
+func TestKubernetesOutsideCluster(t *testing.T) {
+	plugin := &Uwsgi{Kubernetes: &Kubernetes{PortName: "uwsgi-stats"}}
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Gather(&acc))
+}
@@ -0,0 +1,365 @@
+package uwsgi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// maxDatagramSize is the largest stats document accepted over UDP.
+const maxDatagramSize = 65535
+
+// Start starts accepting pushed stats documents when listen is set.
+func (u *Uwsgi) Start(acc telegraf.Accumulator) error {
+	if u.Listen == "" {
+		return nil
+	}
+	if err := u.validate(); err != nil {
+		return err
+	}
+
+	network, address := listenAddress(u.Listen)
+	u.done = make(chan struct{})
+	u.conns = make(map[net.Conn]struct{})
+
+	switch network {
+	case "tcp":
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return fmt.Errorf("Could not listen on '%s': %s", u.Listen, err)
+		}
+		u.startTCP(acc, l)
+	case "udp":
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return fmt.Errorf("Could not listen on '%s': %s", u.Listen, err)
+		}
+		u.startUDP(acc, conn)
+	case "systemd":
+		f, err := systemdSocket(address)
+		if err != nil {
+			return fmt.Errorf("Could not listen on '%s': %s", u.Listen, err)
+		}
+		// Both calls duplicate the descriptor, f stays open for the next
+		// start of the listener.
+		if l, err := net.FileListener(f); err == nil {
+			u.startTCP(acc, l)
+		} else if conn, err := net.FilePacketConn(f); err == nil {
+			u.startUDP(acc, conn)
+		} else {
+			return fmt.Errorf("Could not listen on '%s': %s", u.Listen, err)
+		}
+	default:
+		return fmt.Errorf("Unsupported listen scheme '%s' in '%s'",
+			network, u.Listen)
+	}
+
+	u.Log.Infof("Started uWSGI stats listener on %s", u.Listen)
+	return nil
+}
+
+// Stop closes the listener and all open connections.
+func (u *Uwsgi) Stop() {
+	if u.done == nil {
+		return
+	}
+	close(u.done)
+	if u.listener != nil {
+		u.listener.Close()
+	}
+	if u.packetConn != nil {
+		u.packetConn.Close()
+	}
+
+	u.connsMu.Lock()
+	for conn := range u.conns {
+		conn.Close()
+	}
+	u.connsMu.Unlock()
+
+	u.wg.Wait()
+	u.Log.Infof("Stopped uWSGI stats listener on %s", u.Listen)
+}
+
+// Pause stops reading pushed stats documents until Resume, so that the
+// pushers are held back by TCP flow control, or their datagrams dropped by
+// the kernel, while the agent is short of memory.
+func (u *Uwsgi) Pause() {
+	u.pauseMu.Lock()
+	defer u.pauseMu.Unlock()
+	if u.resumed == nil {
+		u.resumed = make(chan struct{})
+		u.Log.Warnf("Pausing the uWSGI stats listener on %s", u.Listen)
+	}
+}
+
+// Resume reads the pushed stats documents again.
+func (u *Uwsgi) Resume() {
+	u.pauseMu.Lock()
+	defer u.pauseMu.Unlock()
+	if u.resumed != nil {
+		close(u.resumed)
+		u.resumed = nil
+		u.Log.Infof("Resuming the uWSGI stats listener on %s", u.Listen)
+	}
+}
+
+// waitResumed blocks while the listener is paused, it returns false if the
+// listener was stopped meanwhile.
+func (u *Uwsgi) waitResumed() bool {
+	u.pauseMu.Lock()
+	resumed := u.resumed
+	u.pauseMu.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-u.done:
+		return false
+	}
+}
+
+func (u *Uwsgi) startTCP(acc telegraf.Accumulator, l net.Listener) {
+	u.listener = l
+	u.wg.Add(1)
+	go u.tcpListen(acc)
+}
+
+func (u *Uwsgi) startUDP(acc telegraf.Accumulator, conn net.PacketConn) {
+	u.packetConn = conn
+	u.wg.Add(1)
+	go u.udpListen(acc)
+}
+
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation.
+var listenFdsStart = 3
+
+// systemdFiles are the sockets passed by systemd by descriptor. They are
+// never closed, the listeners started again after a Stop or a reload of the
+// agent use the same descriptors.
+var (
+	systemdFilesMu sync.Mutex
+	systemdFiles   = map[int]*os.File{}
+)
+
+// systemdSocket returns the socket passed by systemd with the given
+// FileDescriptorName, or the first one if name is empty.
+func systemdSocket(name string) (*os.File, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		if name == "" || (i < len(names) && names[i] == name) {
+			fd := listenFdsStart + i
+			systemdFilesMu.Lock()
+			defer systemdFilesMu.Unlock()
+			f, ok := systemdFiles[fd]
+			if !ok {
+				f = os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+				systemdFiles[fd] = f
+			}
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("no socket named '%s' passed by systemd", name)
+}
+
+// listenAddress splits listen into its network and address; a bare address
+// listens on TCP.
+func listenAddress(listen string) (string, string) {
+	if i := strings.Index(listen, "://"); i >= 0 {
+		return listen[:i], listen[i+3:]
+	}
+	return "tcp", listen
+}
+
+func (u *Uwsgi) tcpListen(acc telegraf.Accumulator) {
+	defer u.wg.Done()
+
+	for {
+		if !u.waitResumed() {
+			return
+		}
+		conn, err := u.listener.Accept()
+		if err != nil {
+			select {
+			case <-u.done:
+			default:
+				u.Log.Errorf("uWSGI stats listener: %s", err)
+			}
+			return
+		}
+
+		u.connsMu.Lock()
+		u.conns[conn] = struct{}{}
+		u.connsMu.Unlock()
+
+		u.wg.Add(1)
+		go u.handleConn(acc, conn)
+	}
+}
+
+// handleConn reads the stats documents pushed over one TCP connection
+// until the pusher closes it.
+func (u *Uwsgi) handleConn(acc telegraf.Accumulator, conn net.Conn) {
+	addr := conn.RemoteAddr()
+	defer func() {
+		u.connsMu.Lock()
+		delete(u.conns, conn)
+		u.connsMu.Unlock()
+		conn.Close()
+		// The next connection of the pusher comes from another port
+		u.forgetServer(addr.Network() + "://" + addr.String())
+		u.wg.Done()
+	}()
+
+	source := remoteHost(conn.RemoteAddr())
+	r := &pushReader{conn: conn, timeout: u.Timeout.Duration}
+	dec := json.NewDecoder(r)
+	for {
+		if !u.waitResumed() {
+			return
+		}
+		// The deadline and max_body_size apply to each document, the
+		// connection may stay idle between two pushes.
+		r.next(u.MaxBodySize, dec.Buffered())
+		var data json.RawMessage
+		if err := dec.Decode(&data); err != nil {
+			if err != io.EOF {
+				select {
+				case <-u.done:
+				default:
+					u.Log.Errorf("Could not read stats pushed by '%s': %s",
+						source, err)
+				}
+			}
+			return
+		}
+		u.handlePush(acc, conn.RemoteAddr(), data)
+	}
+}
+
+// pushReader reads the documents pushed over a TCP connection, failing a
+// document exceeding its byte budget and setting the read deadline once
+// the document started arriving.
+type pushReader struct {
+	conn    net.Conn
+	timeout time.Duration
+	// Bytes left for the current document, unlimited if negative
+	left  int64
+	armed bool
+}
+
+// next starts a new document of at most max bytes, unlimited if not
+// positive. The buffered start of the document is read already.
+func (r *pushReader) next(max int64, buffered io.Reader) {
+	r.left = -1
+	if max > 0 {
+		r.left = max
+	}
+	r.armed = false
+	r.conn.SetReadDeadline(time.Time{})
+	if b, ok := buffered.(interface{ Len() int }); ok && b.Len() > 0 {
+		r.arm()
+	}
+}
+
+func (r *pushReader) arm() {
+	if !r.armed && r.timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	}
+	r.armed = true
+}
+
+func (r *pushReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, errPushTooLarge
+	}
+	if r.left > 0 && int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.conn.Read(p)
+	if n > 0 {
+		r.arm()
+		if r.left > 0 {
+			r.left -= int64(n)
+		}
+	}
+	return n, err
+}
+
+// errPushTooLarge fails pushed documents exceeding max_body_size.
+var errPushTooLarge = errors.New("document exceeds max_body_size")
+
+func (u *Uwsgi) udpListen(acc telegraf.Accumulator) {
+	defer u.wg.Done()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		if !u.waitResumed() {
+			return
+		}
+		n, addr, err := u.packetConn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-u.done:
+			default:
+				u.Log.Errorf("uWSGI stats listener: %s", err)
+			}
+			return
+		}
+		if u.MaxBodySize > 0 && int64(n) > u.MaxBodySize {
+			u.Log.Errorf("Could not read stats pushed by '%s': %s",
+				remoteHost(addr), errPushTooLarge)
+			continue
+		}
+		u.handlePush(acc, addr, buf[:n])
+	}
+}
+
+// handlePush emits the metrics of one pushed stats document, tagged with
+// the host that sent it. The worker stats are told apart by the full
+// address of the pusher, as several servers of a host push from their own
+// port.
+func (u *Uwsgi) handlePush(
+	acc telegraf.Accumulator,
+	addr net.Addr,
+	data []byte,
+) {
+	source := remoteHost(addr)
+	s := &StatsServer{
+		Url:    addr.Network() + "://" + addr.String(),
+		Source: source,
+	}
+	if err := u.parseStats(acc, data, s); err != nil {
+		u.Log.Errorf("Could not decode stats pushed by '%s': %s",
+			source, err)
+	}
+}
+
+// remoteHost returns the host of addr without the (ephemeral) port.
+func remoteHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,246 @@
+package uwsgi
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// waitFor polls the accumulator until it holds the measurement.
+func waitFor(t *testing.T, acc *testutil.Accumulator, measurement string) {
+	for i := 0; i < 200; i++ {
+		if acc.HasMeasurement(measurement) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %s received", measurement)
+}
+
+func TestListenTCP(t *testing.T) {
+	plugin := NewUwsgi()
+	plugin.Listen = "127.0.0.1:0"
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	conn, err := net.Dial("tcp", plugin.listener.Addr().String())
+	require.NoError(t, err)
+	fmt.Fprint(conn, statsResponse)
+	conn.Close()
+
+	waitFor(t, &acc, "uwsgi_spoolers")
+	assertStats(t, &acc, map[string]string{"source": "127.0.0.1"})
+}
+
+func TestListenUDP(t *testing.T) {
+	plugin := NewUwsgi()
+	plugin.Listen = "udp://127.0.0.1:0"
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	conn, err := net.Dial("udp", plugin.packetConn.LocalAddr().String())
+	require.NoError(t, err)
+	fmt.Fprint(conn, statsResponse)
+	conn.Close()
+
+	waitFor(t, &acc, "uwsgi_spoolers")
+	assertStats(t, &acc, map[string]string{"source": "127.0.0.1"})
+}
+
+func TestListenPushers(t *testing.T) {
+	plugin := NewUwsgi()
+	plugin.Listen = "127.0.0.1:0"
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	// Two servers of the same host keep their own worker stats
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", plugin.listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		fmt.Fprint(conn, statsResponse)
+	}
+	for i := 0; i < 200; i++ {
+		plugin.Lock()
+		n := len(plugin.lastWorkers)
+		plugin.Unlock()
+		if n == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the workers of the pushers were not told apart")
+}
+
+func TestListenIdleConnection(t *testing.T) {
+	plugin := NewUwsgi()
+	plugin.Listen = "127.0.0.1:0"
+	plugin.Timeout.Duration = 50 * time.Millisecond
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	// The timeout does not close a connection waiting for the next push
+	conn, err := net.Dial("tcp", plugin.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, statsResponse)
+	waitFor(t, &acc, "uwsgi_spoolers")
+	acc.Lock()
+	acc.Metrics = nil
+	acc.Unlock()
+
+	time.Sleep(150 * time.Millisecond)
+	fmt.Fprint(conn, statsResponse)
+	waitFor(t, &acc, "uwsgi_spoolers")
+}
+
+func TestListenMaxBodySize(t *testing.T) {
+	plugin := NewUwsgi()
+	plugin.Listen = "127.0.0.1:0"
+	plugin.MaxBodySize = 100
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	conn, err := net.Dial("tcp", plugin.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, statsResponse)
+
+	// The connection is closed without emitting the document
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	if ne, ok := err.(net.Error); ok {
+		require.False(t, ne.Timeout())
+	}
+	require.False(t, acc.HasMeasurement("uwsgi_overview"))
+
+	udp := NewUwsgi()
+	udp.Listen = "udp://127.0.0.1:0"
+	udp.MaxBodySize = 100
+	require.NoError(t, udp.Start(&acc))
+	defer udp.Stop()
+
+	pusher, err := net.Dial("udp", udp.packetConn.LocalAddr().String())
+	require.NoError(t, err)
+	defer pusher.Close()
+	fmt.Fprint(pusher, statsResponse)
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, acc.HasMeasurement("uwsgi_overview"))
+}
+
+func TestListenPaused(t *testing.T) {
+	plugin := NewUwsgi()
+	plugin.Listen = "127.0.0.1:0"
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	// The documents sent while paused are read once resumed
+	plugin.Pause()
+	conn, err := net.Dial("tcp", plugin.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, statsResponse)
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, acc.HasMeasurement("uwsgi_spoolers"))
+
+	plugin.Resume()
+	waitFor(t, &acc, "uwsgi_spoolers")
+}
+
+func TestListenUnsupportedScheme(t *testing.T) {
+	plugin := NewUwsgi()
+	plugin.Listen = "unix:///tmp/uwsgi.sock"
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Start(&acc))
+}
+
+func TestListenSystemd(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+
+	// Pretend f was passed by systemd as its only socket
+	defer func(start int) { listenFdsStart = start }(listenFdsStart)
+	listenFdsStart = int(f.Fd())
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("LISTEN_FDNAMES", "uwsgi-stats")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	plugin := NewUwsgi()
+	plugin.Listen = "systemd://uwsgi-stats"
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	fmt.Fprint(conn, statsResponse)
+	conn.Close()
+
+	waitFor(t, &acc, "uwsgi_spoolers")
+	assertStats(t, &acc, map[string]string{"source": "127.0.0.1"})
+
+	other := NewUwsgi()
+	other.Listen = "systemd://other"
+	require.Error(t, other.Start(&acc))
+}
+
+func TestListenSystemdRestart(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer f.Close()
+
+	defer func(start int) { listenFdsStart = start }(listenFdsStart)
+	listenFdsStart = int(f.Fd())
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	plugin := NewUwsgi()
+	plugin.Listen = "systemd://"
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	plugin.Stop()
+
+	// The socket passed by systemd is still open once the listener stopped
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	fmt.Fprint(conn, statsResponse)
+	conn.Close()
+
+	waitFor(t, &acc, "uwsgi_spoolers")
+}
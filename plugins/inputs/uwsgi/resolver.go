@@ -0,0 +1,115 @@
+package uwsgi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// resolver resolves the hosts of stats servers, honouring pinned addresses
+// and caching lookups between gathers.
+type resolver struct {
+	pinned map[string]string
+	ttl    time.Duration
+
+	// lookupHost is net.Resolver.LookupHost of the configured resolver
+	lookupHost func(host string) ([]string, error)
+
+	sync.Mutex
+	cache map[string]cachedHost
+}
+
+type cachedHost struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newResolver returns a resolver using dnsServer ("host:port") instead of
+// the system resolver if set.
+func newResolver(
+	pinned map[string]string,
+	ttl time.Duration,
+	dnsServer string,
+) *resolver {
+	r := net.DefaultResolver
+	if dnsServer != "" {
+		if _, _, err := net.SplitHostPort(dnsServer); err != nil {
+			dnsServer = net.JoinHostPort(dnsServer, "53")
+		}
+		r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+
+	return &resolver{
+		pinned: pinned,
+		ttl:    ttl,
+		lookupHost: func(host string) ([]string, error) {
+			return r.LookupHost(context.Background(), host)
+		},
+		cache: make(map[string]cachedHost),
+	}
+}
+
+// lookup returns the addresses of host. A failed lookup falls back to the
+// last cached addresses, even when they have expired.
+func (r *resolver) lookup(host string) ([]string, error) {
+	if ip, ok := r.pinned[host]; ok {
+		return []string{ip}, nil
+	}
+
+	r.Lock()
+	cached, ok := r.cache[host]
+	r.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := r.lookupHost(host)
+	if err != nil {
+		if ok {
+			return cached.addrs, nil
+		}
+		return nil, err
+	}
+
+	if r.ttl > 0 {
+		r.Lock()
+		r.cache[host] = cachedHost{addrs: addrs, expires: time.Now().Add(r.ttl)}
+		r.Unlock()
+	}
+	return addrs, nil
+}
+
+// dial connects to address, trying the resolved addresses of its host in
+// turn.
+func (r *resolver) dial(
+	network string,
+	address string,
+	timeout time.Duration,
+) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return net.DialTimeout(network, address, timeout)
+	}
+
+	addrs, err := r.lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	err = errors.New("no addresses for " + host)
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = net.DialTimeout(network, net.JoinHostPort(addr, port), timeout)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
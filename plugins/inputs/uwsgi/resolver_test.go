@@ -0,0 +1,67 @@
+package uwsgi
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePinned(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go serveRaw(l)
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{"tcp://stats.example.invalid:" + port},
+		Resolve:       map[string]string{"stats.example.invalid": "127.0.0.1"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	assertStats(t, &acc, map[string]string{"source": "stats.example.invalid"})
+}
+
+func TestResolverCache(t *testing.T) {
+	var lookups int
+	var fail bool
+	r := newResolver(nil, time.Hour, "")
+	r.lookupHost = func(host string) ([]string, error) {
+		lookups++
+		if fail {
+			return nil, errors.New("resolver down")
+		}
+		return []string{"10.0.0.1"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		addrs, err := r.lookup("stats.example.org")
+		require.NoError(t, err)
+		require.Equal(t, []string{"10.0.0.1"}, addrs)
+	}
+	require.Equal(t, 1, lookups)
+
+	// Expired entries are looked up again, but kept while lookups fail
+	r.cache["stats.example.org"] = cachedHost{
+		addrs:   []string{"10.0.0.1"},
+		expires: time.Now().Add(-time.Second),
+	}
+	fail = true
+	addrs, err := r.lookup("stats.example.org")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1"}, addrs)
+	require.Equal(t, 2, lookups)
+
+	_, err = r.lookup("other.example.org")
+	require.Error(t, err)
+}
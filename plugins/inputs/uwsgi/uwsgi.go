@@ -0,0 +1,1695 @@
+package uwsgi
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/logger"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+var timeNow = time.Now
+
+type Uwsgi struct {
+	URLs                  []string          `toml:"urls"`
+	Servers               []Server          `toml:"servers"`
+	Timeout               internal.Duration `toml:"timeout"`
+	ResponseHeaderTimeout internal.Duration `toml:"response_header_timeout"`
+	MaxConcurrency        int               `toml:"max_concurrency"`
+
+	// Retries of a stats server that could not be read, waiting
+	// retry_interval before the first one and twice as long before each
+	// following one
+	MaxRetries    int               `toml:"max_retries"`
+	RetryInterval internal.Duration `toml:"retry_interval"`
+
+	// Address to accept pushed stats documents on, e.g. ":7771" or
+	// "udp://:7771"
+	Listen string `toml:"listen"`
+
+	// HTTP Basic Auth credentials and extra request headers
+	Username string            `toml:"username"`
+	Password string            `toml:"password"`
+	Headers  map[string]string `toml:"headers"`
+
+	// Path to CA file
+	TLSCA string `toml:"tls_ca"`
+	// Path to host cert file
+	TLSCert string `toml:"tls_cert"`
+	// Path to cert key file
+	TLSKey string `toml:"tls_key"`
+	// Use TLS but skip chain & host verification
+	InsecureSkipVerify bool
+
+	// Gather the per-worker measurements, false skips uwsgi_workers,
+	// uwsgi_apps and uwsgi_cores whatever gather_workers, gather_apps and
+	// gather_cores are
+	Workers bool `toml:"workers"`
+
+	GatherWorkers bool `toml:"gather_workers"`
+	GatherApps    bool `toml:"gather_apps"`
+	GatherCores   bool `toml:"gather_cores"`
+	GatherLegions bool `toml:"gather_legions"`
+
+	// Emit the uwsgi_gather measurement about every stats server poll
+	GatherDiagnostics bool `toml:"gather_diagnostics"`
+
+	// Connection reuse of the HTTP client
+	MaxIdleConns     int               `toml:"max_idle_conns"`
+	IdleConnTimeout  internal.Duration `toml:"idle_conn_timeout"`
+	DisableKeepalive bool              `toml:"disable_keepalive"`
+
+	// Proxy for http:// and https:// stats servers
+	HTTPProxyURL string `toml:"http_proxy_url"`
+
+	// Host name resolution: addresses pinned per host name, a DNS server
+	// used instead of the system resolver and how long lookups are cached
+	Resolve     map[string]string `toml:"resolve"`
+	DNSServer   string            `toml:"dns_server"`
+	DNSCacheTTL internal.Duration `toml:"dns_cache_ttl"`
+
+	// Force a content encoding instead of the Content-Encoding header
+	ContentEncoding string `toml:"content_encoding"`
+
+	// Largest stats document read from a stats server, in bytes
+	MaxBodySize int64 `toml:"max_body_size"`
+
+	// Poll the stats servers of the pods found through the Kubernetes API
+	Kubernetes *Kubernetes `toml:"kubernetes"`
+
+	// Poll the stats servers of the vassals reported by an emperor
+	DiscoverVassals bool   `toml:"discover_vassals"`
+	VassalStatsURL  string `toml:"vassal_stats_url"`
+
+	// Glob patterns of fields to keep or drop on all uwsgi measurements
+	FieldInclude []string `toml:"field_include"`
+	FieldExclude []string `toml:"field_exclude"`
+
+	// Stats layout: "auto", "1" for uWSGI 1.x or "2"
+	Version string `toml:"version"`
+
+	// "strict" drops undecodable stats, "tolerant" emits what was decoded
+	ParseMode string `toml:"parse_mode"`
+
+	// Include the port in the source tag and keep the legacy url tag
+	SourcePort bool `toml:"source_port"`
+	URLTag     bool `toml:"url_tag"`
+
+	// Upper bounds of the avg_rt histogram buckets, e.g. "10ms"
+	ResponseTimeBuckets []string `toml:"response_time_buckets"`
+
+	// How the worker status is reported: "field", "tag" or "numeric"
+	WorkerStatus string `toml:"worker_status"`
+
+	// Also emit the per-interval increase of the worker counters
+	DeltaFields bool `toml:"delta_fields"`
+
+	// Tag the points of single-app workers with the app_id and mountpoint
+	WorkerAppTags bool `toml:"worker_app_tags"`
+
+	// Prefix of all measurement names, "uwsgi_" if empty
+	MeasurementPrefix string `toml:"measurement_prefix"`
+
+	Log telegraf.Logger `toml:"-"`
+
+	client   *http.Client
+	resolver *resolver
+	// shard returns whether a stats server url is gathered by this agent,
+	// all urls if nil
+	shard func(string) bool
+
+	// Last seen stats of the workers of every stats server by url, to
+	// compare with between gathers. polled are the urls of the servers
+	// polled by the last complete gather, gathered the ones polled by the
+	// current gather.
+	sync.Mutex
+	lastWorkers map[string]map[int]*Worker
+	polled      map[string]bool
+	gathered    map[string]bool
+
+	// State of the pushed stats listener
+	listener   net.Listener
+	packetConn net.PacketConn
+	connsMu    sync.Mutex
+	conns      map[net.Conn]struct{}
+	wg         sync.WaitGroup
+	done       chan struct{}
+	// closed on Resume, nil unless the listener is paused
+	pauseMu sync.Mutex
+	resumed chan struct{}
+}
+
+// Server is a stats server url with extra tags for its metrics.
+type Server struct {
+	URL  string            `toml:"url"`
+	Tags map[string]string `toml:"tags"`
+}
+
+var sampleConfig = `
+  ## List with urls of uWSGI Stats servers. Supported schemes are
+  ## http://, tcp://, unix:// (the raw stats socket, e.g. --stats /tmp/stats.sock)
+  ## and file:// (a stats document dumped to disk, e.g. file:///var/run/uwsgi/stats.json)
+  ## Numeric ranges such as "tcp://10.0.0.{1..20}:1717" (or "{01..20}" to keep
+  ## leading zeros) and, for unix:// and file:// urls, glob patterns such as
+  ## "unix:///run/uwsgi/*.sock" are expanded at every gather.
+  urls = ["tcp://127.0.0.1:1717", "unix:///tmp/stats.sock", "http://127.0.0.1:1717/"]
+
+  ## Also accept stats documents pushed by uWSGI servers that cannot be
+  ## polled, e.g. behind a firewall: "tcp://:7771" reads one or more JSON
+  ## documents per connection, "udp://:7771" one document per datagram.
+  ## A bare ":7771" listens on TCP. "systemd://" uses the socket passed by
+  ## systemd socket activation (or "systemd://<FileDescriptorName>"), so
+  ## pushed stats are not lost while the agent restarts.
+  # listen = ":7771"
+
+  ## Overall timeout for connecting to and reading from a stats server, and
+  ## for reading a document pushed over TCP once it started arriving.
+  # timeout = "4s"
+  ## Time to wait for the response headers of http:// stats servers.
+  # response_header_timeout = "3s"
+
+  ## Maximum number of stats servers polled in parallel (0 polls all at once)
+  # max_concurrency = 10
+  ## Upper bound for the whole collection; requests still in flight are
+  ## cancelled and reported as an error for this interval. Defaults to the
+  ## gather_timeout of the agent, or else the interval.
+  # gather_timeout = "10s"
+
+  ## Retry a stats server that cannot be reached (e.g. while its workers
+  ## respawn) up to max_retries times within the same gather, waiting
+  ## retry_interval before the first retry and doubling it for each one.
+  # max_retries = 0
+  # retry_interval = "100ms"
+
+  ## Optional HTTP Basic Auth credentials for http:// stats servers
+  # username = "telegraf"
+  # password = "secret"
+
+  ## Connection reuse for http:// and https:// stats servers: number of idle
+  ## connections kept per stats server (0 uses the Go default), how long they
+  ## are kept, or disable keep-alive altogether for NAT or connection-limited
+  ## proxies.
+  # max_idle_conns = 0
+  # idle_conn_timeout = "90s"
+  # disable_keepalive = false
+
+  ## Proxy used for http:// and https:// stats servers, either an HTTP or a
+  ## SOCKS5 proxy. Defaults to the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment.
+  # http_proxy_url = "http://jump.example.org:3128"
+  # http_proxy_url = "socks5://127.0.0.1:1080"
+
+  ## Host name resolution of tcp:// and http(s):// stats servers: query
+  ## another DNS server than the system resolver and cache lookups between
+  ## gathers. Cached addresses are still used, even past dns_cache_ttl,
+  ## while lookups fail. Host names can also be pinned to fixed addresses
+  ## in inputs.uwsgi.resolve below.
+  # dns_server = "10.0.0.2:53"
+  # dns_cache_ttl = "5m"
+
+  ## Compressed (gzip, deflate) responses are negotiated and decoded based
+  ## on their Content-Encoding header; set content_encoding to "gzip",
+  ## "deflate" or "identity" to override it for misconfigured proxies.
+  # content_encoding = "auto"
+
+  ## Stop reading stats documents larger than this many bytes (after
+  ## decompression), e.g. from a url pointing at the wrong endpoint. The
+  ## stats server is then reported in uwsgi_gather with body_too_large = 1
+  ## and an error. Larger pushed documents are dropped, closing their TCP
+  ## connection. 0 reads documents of any size.
+  # max_body_size = 33554432
+
+  ## Optional TLS Config for https:// stats servers
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Gather the per-worker measurements, false skips uwsgi_workers,
+  ## uwsgi_apps and uwsgi_cores for hosts running hundreds of workers, which
+  ## only need the listen queue and load of uwsgi_overview and uwsgi_sockets.
+  # workers = true
+  ## Gather per-worker (uwsgi_workers) and per-app (uwsgi_apps) metrics
+  # gather_workers = true
+  # gather_apps = true
+  ## Gather per-core metrics (uwsgi_cores) of async/threaded workers
+  # gather_cores = false
+  ## Gather legion membership and arbiter data (uwsgi_legions)
+  # gather_legions = false
+  ## Emit uwsgi_gather with the duration, HTTP status code and response size
+  ## of every stats server poll
+  # gather_diagnostics = false
+
+  ## When polling an emperor stats server, also poll the stats server of
+  ## every vassal it reports. "{vassal}" in vassal_stats_url is replaced by
+  ## the vassal config name without its extension (api.ini -> api), and the
+  ## vassal metrics get a "vassal" tag.
+  # discover_vassals = false
+  # vassal_stats_url = "unix:///run/uwsgi/{vassal}.stats.sock"
+
+  ## Only emit the fields matching one of these glob patterns, or drop the
+  ## ones that match, on all uwsgi measurements.
+  # field_include = []
+  # field_exclude = ["signals", "last_spawn"]
+
+  ## How to report the worker status:
+  ##   "field"   - string field "status" (default)
+  ##   "tag"     - "status" tag on uwsgi_workers
+  ##   "numeric" - integer field "status_code" (idle=0, busy=1, cheap=2,
+  ##               pause=3, sig=4, unknown=-1)
+  # worker_status = "field"
+
+  ## Also emit requests_delta, harakiri_delta and respawn_delta on
+  ## uwsgi_workers: the increase of the cumulative counters since the
+  ## previous gather, for outputs that cannot compute derivatives.
+  # delta_fields = false
+
+  ## Tag uwsgi_workers with the app_id and mountpoint of the app served by
+  ## the worker, for workers that serve exactly one app.
+  # worker_app_tags = false
+
+  ## Prefix of the measurement names, e.g. "app_" to emit app_overview,
+  ## app_workers, ... instead of uwsgi_overview, uwsgi_workers, ...
+  # measurement_prefix = "uwsgi_"
+
+  ## Layout of the stats documents: "1" for uWSGI 1.x stats servers, "2" for
+  ## current ones, or "auto" to detect 1.x servers by their missing version.
+  # version = "auto"
+
+  ## How to handle stats documents that fail to decode:
+  ##   "strict"   - report the error and drop the sample (default)
+  ##   "tolerant" - report the error but still emit the fields that could be
+  ##                decoded, with parse_errors = 1 in uwsgi_overview; malformed
+  ##                documents, e.g. truncated ones, are dropped as in strict
+  # parse_mode = "strict"
+
+  ## Count the workers whose avg_rt is below each of these bounds, emitted
+  ## as avg_rt_lt_<bound> fields of uwsgi_overview.
+  # response_time_buckets = ["10ms", "100ms", "1s"]
+
+  ## Every point is tagged with the "source" host of its stats server
+  ## (the local hostname for unix:// sockets and file:// documents). Set source_port = false to
+  ## drop the port from it, and url_tag = true to also keep the full url
+  ## in a "url" tag as in earlier versions of this plugin.
+  # source_port = true
+  # url_tag = false
+
+  ## HTTP Header parameters (all values must be strings)
+  # [inputs.uwsgi.headers]
+  #   Authorization = "Bearer my-token"
+
+  ## Addresses pinned per host name, bypassing DNS
+  # [inputs.uwsgi.resolve]
+  #   "stats.example.org" = "10.0.0.5"
+
+  ## Stats servers can also be listed one by one, each with its own tags
+  # [[inputs.uwsgi.servers]]
+  #   url = "tcp://10.0.0.1:1717"
+  #   [inputs.uwsgi.servers.tags]
+  #     service = "api"
+  #     env = "prod"
+
+  ## Also poll the stats servers of the running Kubernetes pods matching
+  ## label_selector, on their container port named port_name. Pods are
+  ## listed again at every gather and their metrics are tagged with "pod"
+  ## and "namespace". Inside a pod the API server, token and CA of its
+  ## service account are used by default.
+  # [inputs.uwsgi.kubernetes]
+  #   api_url = "https://kubernetes.default.svc"
+  #   namespace = "default"
+  #   label_selector = "app=api"
+  #   port_name = "uwsgi-stats"
+  #   ## "tcp" for --stats, "http" for --stats-http
+  #   scheme = "tcp"
+  #   bearer_token = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+  #   tls_ca = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+  #   insecure_skip_verify = false
+`
+
+func (u *Uwsgi) SampleConfig() string {
+	return sampleConfig
+}
+
+func (u *Uwsgi) Description() string {
+	return "Read uWSGI metrics."
+}
+
+func (u *Uwsgi) Gather(acc telegraf.Accumulator) error {
+	return u.GatherContext(context.Background(), acc)
+}
+
+// GatherContext polls the stats servers, cancelling the requests still in
+// flight once ctx is done.
+func (u *Uwsgi) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+
+	if u.resolver == nil && (len(u.Resolve) > 0 || u.DNSServer != "" ||
+		u.DNSCacheTTL.Duration > 0) {
+		u.resolver = newResolver(u.Resolve, u.DNSCacheTTL.Duration, u.DNSServer)
+	}
+
+	if u.client == nil {
+		client, err := u.createHTTPClient()
+		if err != nil {
+			return err
+		}
+		u.client = client
+	}
+
+	servers := u.servers()
+
+	// Pods are listed anew at every gather to follow pod churn
+	var discoverErr error
+	if u.Kubernetes != nil {
+		pods, err := u.Kubernetes.servers(u.Timeout.Duration)
+		if err != nil {
+			discoverErr = err
+		}
+		servers = append(servers, pods...)
+	}
+	if u.shard != nil {
+		owned := servers[:0]
+		for _, server := range servers {
+			if u.shard(server.URL) {
+				owned = append(owned, server)
+			}
+		}
+		servers = owned
+	}
+
+	u.Lock()
+	u.gathered = make(map[string]bool)
+	u.Unlock()
+
+	concurrency := u.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = len(servers)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	// Keep polling the remaining urls when one of them fails and return
+	// all errors as one giant error
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(servers)+2)
+	if discoverErr != nil {
+		errChan <- discoverErr
+	}
+	for _, server := range servers {
+		n, err := url.Parse(server.URL)
+		if err != nil {
+			errChan <- fmt.Errorf(
+				"Could not parse uWSGI Stats Server url '%s': %s",
+				server.URL, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(n *url.URL, tags map[string]string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := u.gatherURL(ctx, acc, n, tags); err != nil {
+				errChan <- err
+			}
+		}(n, server.Tags)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		u.forgetServers()
+	case <-ctx.Done():
+		// The requests in flight are cancelled along with ctx, their
+		// goroutines return without waiting for the stats servers.
+		errChan <- fmt.Errorf("uWSGI gather did not complete: %s", ctx.Err())
+	}
+
+	errorStrings := []string{}
+	for len(errChan) > 0 {
+		errorStrings = append(errorStrings, (<-errChan).Error())
+	}
+
+	if len(errorStrings) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errorStrings, "\n"))
+}
+
+// validate checks the options shared by polling and listening.
+func (u *Uwsgi) validate() error {
+	switch u.ParseMode {
+	case "", "strict", "tolerant":
+	default:
+		return fmt.Errorf("Invalid parse_mode '%s', must be one of "+
+			"\"strict\" or \"tolerant\"", u.ParseMode)
+	}
+
+	switch u.Version {
+	case "", "auto", "1", "2":
+	default:
+		return fmt.Errorf("Invalid version '%s', must be one of "+
+			"\"auto\", \"1\" or \"2\"", u.Version)
+	}
+
+	switch u.WorkerStatus {
+	case "", "field", "tag", "numeric":
+	default:
+		return fmt.Errorf("Invalid worker_status '%s', must be one of "+
+			"\"field\", \"tag\" or \"numeric\"", u.WorkerStatus)
+	}
+
+	for _, b := range u.ResponseTimeBuckets {
+		if _, err := time.ParseDuration(b); err != nil {
+			return fmt.Errorf("Invalid response_time_buckets entry '%s': %s",
+				b, err)
+		}
+	}
+	return nil
+}
+
+func (u *Uwsgi) createHTTPClient() (*http.Client, error) {
+	tlsCfg, err := internal.GetTLSConfig(
+		u.TLSCert, u.TLSKey, u.TLSCA, u.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if u.HTTPProxyURL != "" {
+		proxyURL, err := url.Parse(u.HTTPProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse http_proxy_url '%s': %s",
+				u.HTTPProxyURL, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tr := &http.Transport{
+		Proxy:                 proxy,
+		ResponseHeaderTimeout: u.ResponseHeaderTimeout.Duration,
+		TLSClientConfig:       tlsCfg,
+		MaxIdleConns:          u.MaxIdleConns,
+		MaxIdleConnsPerHost:   u.MaxIdleConns,
+		IdleConnTimeout:       u.IdleConnTimeout.Duration,
+		DisableKeepAlives:     u.DisableKeepalive,
+	}
+	if u.resolver != nil {
+		tr.Dial = u.dial
+	}
+
+	return &http.Client{
+		Transport: tr,
+		Timeout:   u.Timeout.Duration,
+	}, nil
+}
+
+// dial connects to a stats server, through the resolver if one is set up.
+func (u *Uwsgi) dial(network, address string) (net.Conn, error) {
+	if u.resolver != nil {
+		return u.resolver.dial(network, address, u.Timeout.Duration)
+	}
+	return net.DialTimeout(network, address, u.Timeout.Duration)
+}
+
+// servers returns the stats servers from both urls and servers, with their
+// ranges and globs expanded.
+func (u *Uwsgi) servers() []Server {
+	servers := make([]Server, 0, len(u.URLs)+len(u.Servers))
+	for _, s := range u.URLs {
+		for _, e := range expandURL(s) {
+			servers = append(servers, Server{URL: e})
+		}
+	}
+	for _, s := range u.Servers {
+		for _, e := range expandURL(s.URL) {
+			servers = append(servers, Server{URL: e, Tags: s.Tags})
+		}
+	}
+	return servers
+}
+
+var rangeRe = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+// expandURL expands the numeric ranges ("{1..20}") of a url and, for
+// unix:// and file:// urls, the glob patterns of its path.
+func expandURL(rawurl string) []string {
+	if loc := rangeRe.FindStringSubmatchIndex(rawurl); loc != nil {
+		from, to := rawurl[loc[2]:loc[3]], rawurl[loc[4]:loc[5]]
+		start, _ := strconv.Atoi(from)
+		end, _ := strconv.Atoi(to)
+		// {01..20} keeps the leading zeros
+		format := "%d"
+		if len(from) > 1 && from[0] == '0' {
+			format = "%0" + strconv.Itoa(len(from)) + "d"
+		}
+
+		var urls []string
+		for i := start; i <= end; i++ {
+			expanded := rawurl[:loc[0]] + fmt.Sprintf(format, i) + rawurl[loc[1]:]
+			urls = append(urls, expandURL(expanded)...)
+		}
+		return urls
+	}
+
+	for _, prefix := range []string{"unix://", "file://"} {
+		if !strings.HasPrefix(rawurl, prefix) ||
+			!strings.ContainsAny(rawurl, "*?[") {
+			continue
+		}
+		matches, err := filepath.Glob(strings.TrimPrefix(rawurl, prefix))
+		if err != nil {
+			// Fail on the url itself rather than dropping it
+			return []string{rawurl}
+		}
+		urls := make([]string, 0, len(matches))
+		for _, m := range matches {
+			urls = append(urls, prefix+m)
+		}
+		return urls
+	}
+
+	return []string{rawurl}
+}
+
+func (u *Uwsgi) gatherURL(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+	addr *url.URL,
+	tags map[string]string,
+) error {
+	return u.gatherServer(ctx, acc, addr, tags, "")
+}
+
+// gatherServer polls one stats server; vassal is the name of the emperor
+// vassal it was discovered from, if any.
+func (u *Uwsgi) gatherServer(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+	addr *url.URL,
+	tags map[string]string,
+	vassal string,
+) error {
+	s := &StatsServer{
+		Url:    addr.String(),
+		Source: u.source(addr),
+		Tags:   tags,
+		Vassal: vassal,
+	}
+	u.Lock()
+	if u.gathered == nil {
+		u.gathered = make(map[string]bool)
+	}
+	u.gathered[s.Url] = true
+	u.Unlock()
+
+	var d gatherDiagnostics
+	var err error
+	start := time.Now()
+	interval := u.RetryInterval.Duration
+	for retries := 0; ; retries++ {
+		d = gatherDiagnostics{retries: retries}
+		err = u.fetchStats(ctx, acc, addr, s, &d)
+		// Only retry while nothing was received, a document that was read
+		// but not decoded will not get any better.
+		if err == nil || d.received || retries >= u.MaxRetries {
+			break
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		interval *= 2
+	}
+	if u.GatherDiagnostics || d.bodyTooLarge {
+		u.gatherDiagnostics(acc, s, &d, time.Since(start), err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if vassal == "" && u.DiscoverVassals && s.Vassals != nil {
+		return u.gatherVassals(ctx, acc, s)
+	}
+	return nil
+}
+
+// gatherDiagnostics describes how reading a stats server went.
+type gatherDiagnostics struct {
+	statusCode   int
+	responseSize int64
+	bodyTooLarge bool
+	received     bool
+	retries      int
+}
+
+// countingReader counts the bytes read into responseSize.
+type countingReader struct {
+	r io.Reader
+	d *gatherDiagnostics
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.d.responseSize += int64(n)
+	return n, err
+}
+
+// fetchStats reads and decodes the stats document of a stats server and
+// adds its metrics.
+func (u *Uwsgi) fetchStats(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+	addr *url.URL,
+	s *StatsServer,
+	d *gatherDiagnostics,
+) error {
+	var r io.ReadCloser
+	var encoding string
+	switch addr.Scheme {
+	case "tcp", "unix":
+		address := addr.Host
+		if addr.Scheme == "unix" {
+			address = addr.Path
+		}
+		conn, err := u.dial(addr.Scheme, address)
+		if err != nil {
+			return fmt.Errorf("Could not connect to uWSGI Stats Server '%s': %s",
+				addr.String(), err)
+		}
+		// The stats server writes the JSON document and closes the
+		// connection, so a deadline is enough to bound the read.
+		if u.Timeout.Duration > 0 {
+			conn.SetDeadline(time.Now().Add(u.Timeout.Duration))
+		}
+		// Closing the connection once ctx is done interrupts the read
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-stop:
+			}
+		}()
+		r = conn
+	case "file":
+		// Written by the file stats pusher or a --stats dump shared with
+		// the host, e.g. from a chroot.
+		f, err := os.Open(addr.Path)
+		if err != nil {
+			return fmt.Errorf("Could not read uWSGI stats file '%s': %s",
+				addr.Path, err)
+		}
+		r = f
+	case "http", "https":
+		req, err := http.NewRequest("GET", addr.String(), nil)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		if u.Username != "" || u.Password != "" {
+			req.SetBasicAuth(u.Username, u.Password)
+		}
+		// Setting Accept-Encoding ourselves disables the transparent gzip
+		// handling of the transport, the body is decoded below instead.
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		for k, v := range u.Headers {
+			if strings.ToLower(k) == "host" {
+				req.Host = v
+			} else {
+				req.Header.Set(k, v)
+			}
+		}
+
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("Could not get uWSGI Stats Server '%s': %s",
+				addr.String(), err)
+		}
+		d.statusCode = resp.StatusCode
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("%s returned HTTP status %s",
+				addr.String(), resp.Status)
+		}
+		r = resp.Body
+		encoding = resp.Header.Get("Content-Encoding")
+	default:
+		return fmt.Errorf("Unsupported uWSGI Stats Server scheme '%s' in '%s'",
+			addr.Scheme, addr.String())
+	}
+	defer r.Close()
+
+	if u.ContentEncoding != "" && u.ContentEncoding != "auto" {
+		encoding = u.ContentEncoding
+	}
+	body, err := decodeContent(&countingReader{r: r, d: d}, encoding)
+	if err != nil {
+		return fmt.Errorf("Could not read stats of uWSGI Stats Server '%s': %s",
+			addr.String(), err)
+	}
+
+	if u.MaxBodySize > 0 {
+		body = io.LimitReader(body, u.MaxBodySize+1)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("Could not read stats of uWSGI Stats Server '%s': %s",
+			addr.String(), err)
+	}
+	d.received = true
+	if u.MaxBodySize > 0 && int64(len(data)) > u.MaxBodySize {
+		d.bodyTooLarge = true
+		return fmt.Errorf("Stats of uWSGI Stats Server '%s' exceed "+
+			"max_body_size of %d bytes", addr.String(), u.MaxBodySize)
+	}
+
+	if err := u.parseStats(acc, data, s); err != nil {
+		return fmt.Errorf("Could not decode stats of uWSGI Stats Server '%s': %s",
+			addr.String(), err)
+	}
+
+	return nil
+}
+
+// parseStats decodes a stats document into s and emits its metrics.
+func (u *Uwsgi) parseStats(
+	acc telegraf.Accumulator,
+	data []byte,
+	s *StatsServer,
+) error {
+	if err := u.decodeStats(data, s); err != nil {
+		if u.ParseMode != "tolerant" || !partiallyDecoded(err) {
+			return err
+		}
+		// Emit whatever could be decoded and report the failure both as a
+		// field and as the gather error.
+		s.ParseErrors = 1
+		u.gatherStats(acc, s)
+		return err
+	}
+
+	u.gatherStats(acc, s)
+	return nil
+}
+
+func (u *Uwsgi) gatherDiagnostics(
+	acc telegraf.Accumulator,
+	s *StatsServer,
+	d *gatherDiagnostics,
+	duration time.Duration,
+	err error,
+) {
+	success := 1
+	if err != nil {
+		success = 0
+	}
+	bodyTooLarge := 0
+	if d.bodyTooLarge {
+		bodyTooLarge = 1
+	}
+
+	fields := map[string]interface{}{
+		"gather_time":    duration.Seconds(),
+		"status_code":    d.statusCode,
+		"response_size":  d.responseSize,
+		"success":        success,
+		"body_too_large": bodyTooLarge,
+		"retries":        d.retries,
+	}
+
+	u.addFields(acc, "gather", fields, u.serverTags(s))
+}
+
+// legacyKeys maps the keys of the uWSGI 1.x stats layout to the current
+// ones, per object of the document.
+var legacyKeys = map[string]map[string]string{
+	"server": {
+		"listen_queue_len": "listen_queue",
+	},
+	"worker": {
+		"harakiri": "harakiri_count",
+		"respawns": "respawn_count",
+	},
+	"app": {
+		"mount_point": "mountpoint",
+	},
+}
+
+// decodeStats decodes a stats document into s, mapping the legacy 1.x
+// layout when configured or detected.
+func (u *Uwsgi) decodeStats(data []byte, s *StatsServer) error {
+	legacy := u.Version == "1"
+	if u.Version == "" || u.Version == "auto" {
+		// 1.x stats servers do not report their version
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return err
+		}
+		_, ok := probe["version"]
+		legacy = !ok
+	}
+
+	if !legacy {
+		return json.Unmarshal(data, s)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	renameKeys(doc, legacyKeys["server"])
+	if workers, ok := doc["workers"].([]interface{}); ok {
+		for _, w := range workers {
+			worker, ok := w.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			renameKeys(worker, legacyKeys["worker"])
+			if apps, ok := worker["apps"].([]interface{}); ok {
+				for _, a := range apps {
+					if app, ok := a.(map[string]interface{}); ok {
+						renameKeys(app, legacyKeys["app"])
+					}
+				}
+			}
+		}
+	}
+	if _, ok := doc["version"]; !ok {
+		doc["version"] = "1"
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, s)
+}
+
+// partiallyDecoded returns whether a stats document failing to decode
+// with err was still decoded apart from the mistyped field. Malformed
+// documents, like truncated ones, and documents which are no JSON object
+// are not decoded at all.
+func partiallyDecoded(err error) bool {
+	typeErr, ok := err.(*json.UnmarshalTypeError)
+	return ok && typeErr.Field != ""
+}
+
+// renameKeys renames the keys of obj according to names, keeping the
+// current key when both are present.
+func renameKeys(obj map[string]interface{}, names map[string]string) {
+	for old, name := range names {
+		v, ok := obj[old]
+		if !ok {
+			continue
+		}
+		delete(obj, old)
+		if _, ok := obj[name]; !ok {
+			obj[name] = v
+		}
+	}
+}
+
+// decodeContent wraps r to decompress a body sent with the given
+// Content-Encoding.
+func decodeContent(r io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding '%s'", encoding)
+	}
+}
+
+// gatherVassals polls the stats servers of the vassals reported by an
+// emperor, as addressed by vassal_stats_url.
+func (u *Uwsgi) gatherVassals(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+	s *StatsServer,
+) error {
+	if u.VassalStatsURL == "" {
+		return fmt.Errorf("discover_vassals requires vassal_stats_url to be set")
+	}
+
+	concurrency := u.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = len(s.Vassals)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(s.Vassals))
+	for _, v := range s.Vassals {
+		name := strings.TrimSuffix(v.Id, filepath.Ext(v.Id))
+		raw := strings.Replace(u.VassalStatsURL, "{vassal}", name, -1)
+		addr, err := url.Parse(raw)
+		if err != nil {
+			errChan <- fmt.Errorf(
+				"Could not parse stats url '%s' of vassal '%s': %s",
+				raw, v.Id, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(addr *url.URL, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := u.gatherServer(ctx, acc, addr, s.Tags, name); err != nil {
+				errChan <- err
+			}
+		}(addr, name)
+	}
+	wg.Wait()
+	close(errChan)
+
+	errorStrings := []string{}
+	for err := range errChan {
+		errorStrings = append(errorStrings, err.Error())
+	}
+	if len(errorStrings) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errorStrings, "\n"))
+}
+
+// gatherStats adds the metrics of a decoded stats document.
+func (u *Uwsgi) gatherStats(acc telegraf.Accumulator, s *StatsServer) {
+	// The emperor reports its vassals instead of workers.
+	if s.Emperor != nil || s.Vassals != nil {
+		u.gatherEmperor(acc, s)
+		return
+	}
+
+	u.gatherStatServer(acc, s)
+	u.gatherSockets(acc, s)
+	if u.Workers && u.GatherWorkers {
+		u.gatherWorkers(acc, s)
+	}
+	if u.Workers && u.GatherApps {
+		u.gatherApps(acc, s)
+	}
+	if u.Workers && u.GatherCores {
+		u.gatherCores(acc, s)
+	}
+	u.gatherCaches(acc, s)
+	u.gatherSpoolers(acc, s)
+	if u.GatherLegions {
+		u.gatherLegions(acc, s)
+	}
+}
+
+// addFields drops the fields filtered by field_include and field_exclude
+// before adding the point to the accumulator. measurement is the name
+// without the measurement prefix, e.g. "overview".
+func (u *Uwsgi) addFields(
+	acc telegraf.Accumulator,
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+) {
+	if len(u.FieldInclude) > 0 || len(u.FieldExclude) > 0 {
+		for k := range fields {
+			if !u.fieldAllowed(k) {
+				delete(fields, k)
+			}
+		}
+	}
+	prefix := u.MeasurementPrefix
+	if prefix == "" {
+		prefix = "uwsgi_"
+	}
+	acc.AddFields(prefix+measurement, fields, tags)
+}
+
+func (u *Uwsgi) fieldAllowed(field string) bool {
+	if len(u.FieldInclude) > 0 {
+		included := false
+		for _, pat := range u.FieldInclude {
+			if internal.Glob(pat, field) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, pat := range u.FieldExclude {
+		if internal.Glob(pat, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// source returns the value of the source tag for a stats server url.
+func (u *Uwsgi) source(addr *url.URL) string {
+	if addr.Scheme == "unix" || addr.Scheme == "file" {
+		host, err := os.Hostname()
+		if err != nil {
+			return "localhost"
+		}
+		return host
+	}
+
+	if u.SourcePort {
+		return addr.Host
+	}
+	host, _, err := net.SplitHostPort(addr.Host)
+	if err != nil {
+		return addr.Host
+	}
+	return host
+}
+
+// serverTags returns a new tag set identifying the stats server.
+func (u *Uwsgi) serverTags(s *StatsServer) map[string]string {
+	tags := map[string]string{"source": s.Source}
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	if u.URLTag {
+		tags["url"] = s.Url
+	}
+	if s.Vassal != "" {
+		tags["vassal"] = s.Vassal
+	}
+	return tags
+}
+
+func (u *Uwsgi) gatherStatServer(acc telegraf.Accumulator, s *StatsServer) {
+	fields := map[string]interface{}{
+		"listen_queue":        s.ListenQueue,
+		"listen_queue_errors": s.ListenQueueErrors,
+		"signal_queue":        s.SignalQueue,
+		"load":                s.Load,
+		"pid":                 s.Pid,
+	}
+
+	// Derived worker utilization, so it need not be rebuilt from the
+	// per-worker statuses at query time.
+	var busy, idle int
+	for _, w := range s.Workers {
+		switch w.Status {
+		case "busy":
+			busy++
+		case "idle":
+			idle++
+		}
+	}
+	if u.ParseMode == "tolerant" {
+		fields["parse_errors"] = s.ParseErrors
+	}
+	fields["busy_workers"] = busy
+	fields["idle_workers"] = idle
+	if len(s.Workers) > 0 {
+		fields["busy_ratio"] = float64(busy) / float64(len(s.Workers))
+	} else {
+		fields["busy_ratio"] = float64(0)
+	}
+
+	// Cumulative avg_rt histogram across the workers, avg_rt being in
+	// microseconds.
+	for _, b := range u.ResponseTimeBuckets {
+		bound, _ := time.ParseDuration(b)
+		count := 0
+		for _, w := range s.Workers {
+			if time.Duration(w.AvgRt)*time.Microsecond < bound {
+				count++
+			}
+		}
+		fields["avg_rt_lt_"+b] = count
+	}
+
+	tags := u.serverTags(s)
+	tags["version"] = s.Version
+
+	u.addFields(acc, "overview", fields, tags)
+}
+
+func (u *Uwsgi) gatherEmperor(acc telegraf.Accumulator, s *StatsServer) {
+	fields := map[string]interface{}{
+		"pid":            s.Pid,
+		"emperor_tyrant": s.EmperorTyrant,
+		"throttle_level": s.ThrottleLevel,
+		"vassals":        len(s.Vassals),
+		"blacklisted":    len(s.Blacklist),
+	}
+
+	tags := u.serverTags(s)
+	tags["version"] = s.Version
+
+	u.addFields(acc, "emperor", fields, tags)
+
+	for _, v := range s.Vassals {
+		fields := map[string]interface{}{
+			"pid":            v.Pid,
+			"born":           v.Born,
+			"last_mod":       v.LastMod,
+			"last_heartbeat": v.LastHeartbeat,
+			"loyal":          v.Loyal,
+			"ready":          v.Ready,
+			"accepting":      v.Accepting,
+			"cursed":         v.Cursed,
+			"zerg":           v.Zerg,
+			"respawns":       v.Respawns,
+		}
+
+		tags := u.serverTags(s)
+		tags["vassal"] = v.Id
+
+		u.addFields(acc, "vassals", fields, tags)
+	}
+}
+
+func (u *Uwsgi) gatherSockets(acc telegraf.Accumulator, s *StatsServer) {
+	for _, so := range s.Sockets {
+		fields := map[string]interface{}{
+			"queue":       so.Queue,
+			"max_queue":   so.MaxQueue,
+			"shared":      so.Shared,
+			"can_offload": so.CanOffload,
+		}
+
+		tags := u.serverTags(s)
+		tags["name"] = so.Name
+		tags["proto"] = so.Proto
+
+		u.addFields(acc, "sockets", fields, tags)
+	}
+}
+
+func (u *Uwsgi) gatherWorkers(acc telegraf.Accumulator, s *StatsServer) {
+	last := u.swapWorkers(s)
+	for _, w := range s.Workers {
+		fields := map[string]interface{}{
+			"pid":            w.Pid,
+			"accepting":      w.Accepting,
+			"requests":       w.Requests,
+			"exceptions":     w.Exceptions,
+			"harakiri_count": w.HarakiriCount,
+			"signals":        w.Signals,
+			"rss":            w.Rss,
+			"vsz":            w.Vsz,
+			"running_time":   w.RunningTime,
+			"last_spawn":     w.LastSpawn,
+			"respawn_count":  w.RespawnCount,
+			"tx":             w.Tx,
+			"avg_rt":         w.AvgRt,
+		}
+
+		fields["uptime"] = timeNow().Unix() - int64(w.LastSpawn)
+		respawned := 0
+		prev := last[w.WorkerId]
+		if prev != nil && w.RespawnCount > prev.RespawnCount {
+			respawned = 1
+		}
+		fields["respawned"] = respawned
+
+		// Deltas need a previous sample, so the first gather of a worker
+		// has none.
+		if u.DeltaFields && prev != nil {
+			fields["requests_delta"] = counterDelta(w.Requests, prev.Requests)
+			fields["harakiri_delta"] = counterDelta(w.HarakiriCount, prev.HarakiriCount)
+			fields["respawn_delta"] = counterDelta(w.RespawnCount, prev.RespawnCount)
+		}
+
+		tags := u.serverTags(s)
+		tags["worker_id"] = strconv.Itoa(w.WorkerId)
+		if u.WorkerAppTags && len(w.Apps) == 1 {
+			tags["app_id"] = strconv.Itoa(w.Apps[0].AppId)
+			if w.Apps[0].MountPoint != "" {
+				tags["mountpoint"] = w.Apps[0].MountPoint
+			}
+		}
+
+		switch u.WorkerStatus {
+		case "tag":
+			tags["status"] = w.Status
+		case "numeric":
+			fields["status_code"] = workerStatusCode(w.Status)
+		default:
+			fields["status"] = w.Status
+		}
+
+		u.addFields(acc, "workers", fields, tags)
+
+		if prev != nil && w.HarakiriCount > prev.HarakiriCount {
+			u.gatherHarakiri(acc, s, w, prev)
+		}
+	}
+}
+
+// gatherHarakiri emits an event for a worker killed by harakiri since the
+// previous gather. pid is the one of the killed worker, which has usually
+// been respawned with a new pid already.
+func (u *Uwsgi) gatherHarakiri(
+	acc telegraf.Accumulator,
+	s *StatsServer,
+	w *Worker,
+	prev *Worker,
+) {
+	fields := map[string]interface{}{
+		"pid":   prev.Pid,
+		"count": w.HarakiriCount - prev.HarakiriCount,
+	}
+
+	tags := u.serverTags(s)
+	tags["event"] = "harakiri"
+	tags["worker_id"] = strconv.Itoa(w.WorkerId)
+
+	u.addFields(acc, "events", fields, tags)
+}
+
+// swapWorkers records the stats of the workers of s and returns the ones
+// seen by the previous gather by worker id. The workers which are gone are
+// forgotten.
+func (u *Uwsgi) swapWorkers(s *StatsServer) map[int]*Worker {
+	workers := make(map[int]*Worker, len(s.Workers))
+	for _, w := range s.Workers {
+		workers[w.WorkerId] = w
+	}
+
+	u.Lock()
+	defer u.Unlock()
+	if u.lastWorkers == nil {
+		u.lastWorkers = make(map[string]map[int]*Worker)
+	}
+	prev := u.lastWorkers[s.Url]
+	u.lastWorkers[s.Url] = workers
+	return prev
+}
+
+// forgetServers forgets the workers of the stats servers polled before but
+// not by the gather which just completed, e.g. pods which are gone. The
+// servers pushing their stats are forgotten by forgetServer.
+func (u *Uwsgi) forgetServers() {
+	u.Lock()
+	defer u.Unlock()
+	for url := range u.polled {
+		if !u.gathered[url] {
+			delete(u.lastWorkers, url)
+		}
+	}
+	u.polled = u.gathered
+	u.gathered = make(map[string]bool)
+}
+
+// forgetServer forgets the workers of the stats server at url.
+func (u *Uwsgi) forgetServer(url string) {
+	u.Lock()
+	delete(u.lastWorkers, url)
+	u.Unlock()
+}
+
+// SetShard restricts the gathers to the stats servers of the shard of the
+// agent, after the ranges and globs of the urls are expanded and the pods
+// are discovered, so that the agents split the servers evenly.
+func (u *Uwsgi) SetShard(owns func(target string) bool) {
+	u.shard = owns
+}
+
+// GetState returns the stats of the workers seen by the last gather, which
+// are the baselines of the delta fields and harakiri events.
+func (u *Uwsgi) GetState() interface{} {
+	u.Lock()
+	defer u.Unlock()
+	state := make(map[string]*Worker)
+	for url, workers := range u.lastWorkers {
+		for id, w := range workers {
+			state[url+"#"+strconv.Itoa(id)] = w
+		}
+	}
+	return state
+}
+
+// SetState restores the worker stats returned by GetState. The restored
+// servers are forgotten unless the next gather polls them.
+func (u *Uwsgi) SetState(state interface{}) error {
+	workers, ok := state.(map[string]*Worker)
+	if !ok {
+		return fmt.Errorf("unexpected uwsgi state %T", state)
+	}
+	lastWorkers := make(map[string]map[int]*Worker)
+	polled := make(map[string]bool)
+	for key, w := range workers {
+		i := strings.LastIndex(key, "#")
+		if i < 0 {
+			continue
+		}
+		url := key[:i]
+		if lastWorkers[url] == nil {
+			lastWorkers[url] = make(map[int]*Worker)
+		}
+		lastWorkers[url][w.WorkerId] = w
+		polled[url] = true
+	}
+	u.Lock()
+	u.lastWorkers = lastWorkers
+	u.polled = polled
+	u.Unlock()
+	return nil
+}
+
+// counterDelta returns the increase of a counter since its previous value;
+// a counter that went down was reset, so all of it is new.
+func counterDelta(cur, prev int) int {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// workerStatusCodes maps the uWSGI worker states to numeric values.
+var workerStatusCodes = map[string]int{
+	"idle":  0,
+	"busy":  1,
+	"cheap": 2,
+	"pause": 3,
+	"sig":   4,
+}
+
+func workerStatusCode(status string) int {
+	if code, ok := workerStatusCodes[status]; ok {
+		return code
+	}
+	return -1
+}
+
+func (u *Uwsgi) gatherApps(acc telegraf.Accumulator, s *StatsServer) {
+	for _, w := range s.Workers {
+		for _, a := range w.Apps {
+			fields := map[string]interface{}{
+				"modifier1":    a.Modifier1,
+				"requests":     a.Requests,
+				"startup_time": a.StartupTime,
+				"exceptions":   a.Exceptions,
+			}
+
+			tags := u.serverTags(s)
+			tags["worker_id"] = strconv.Itoa(w.WorkerId)
+			tags["app_id"] = strconv.Itoa(a.AppId)
+			tags["mountpoint"] = a.MountPoint
+
+			u.addFields(acc, "apps", fields, tags)
+		}
+	}
+}
+
+func (u *Uwsgi) gatherCores(acc telegraf.Accumulator, s *StatsServer) {
+	for _, w := range s.Workers {
+		for _, c := range w.Cores {
+			fields := map[string]interface{}{
+				"requests":           c.Requests,
+				"static_requests":    c.StaticRequests,
+				"routed_requests":    c.RoutedRequests,
+				"offloaded_requests": c.OffloadedRequests,
+				"write_errors":       c.WriteErrors,
+				"read_errors":        c.ReadErrors,
+				"in_request":         c.InRequest,
+			}
+
+			tags := u.serverTags(s)
+			tags["worker_id"] = strconv.Itoa(w.WorkerId)
+			tags["core_id"] = strconv.Itoa(c.CoreId)
+
+			u.addFields(acc, "cores", fields, tags)
+		}
+	}
+}
+
+func (u *Uwsgi) gatherCaches(acc telegraf.Accumulator, s *StatsServer) {
+	for _, c := range s.Caches {
+		fields := map[string]interface{}{
+			"items":     c.Items,
+			"max_items": c.MaxItems,
+			"hits":      c.Hits,
+			"misses":    c.Misses,
+			"full":      c.Full,
+		}
+
+		tags := u.serverTags(s)
+		tags["name"] = c.Name
+
+		u.addFields(acc, "caches", fields, tags)
+	}
+}
+
+func (u *Uwsgi) gatherSpoolers(acc telegraf.Accumulator, s *StatsServer) {
+	for _, sp := range s.Spoolers {
+		fields := map[string]interface{}{
+			"pid":      sp.Pid,
+			"tasks":    sp.Tasks,
+			"respawns": sp.Respawns,
+			"running":  sp.Running,
+		}
+
+		tags := u.serverTags(s)
+		tags["dir"] = sp.Dir
+
+		u.addFields(acc, "spoolers", fields, tags)
+	}
+}
+
+func (u *Uwsgi) gatherLegions(acc telegraf.Accumulator, s *StatsServer) {
+	for _, l := range s.Legions {
+		fields := map[string]interface{}{
+			"valor":         l.Valor,
+			"checksum":      l.Checksum,
+			"quorum":        l.Quorum,
+			"i_am_the_lord": l.IAmTheLord,
+			"lord_valor":    l.LordValor,
+			"members":       len(l.Nodes),
+		}
+
+		tags := u.serverTags(s)
+		tags["legion"] = l.Legion
+
+		u.addFields(acc, "legions", fields, tags)
+	}
+}
+
+// StatsServer defines the stats server structure.
+type StatsServer struct {
+	// Tags
+	Url     string            `json:"-"`
+	Source  string            `json:"-"`
+	Vassal  string            `json:"-"`
+	Tags    map[string]string `json:"-"`
+	Version string            `json:"version"`
+
+	// Fields
+	ParseErrors       int `json:"-"`
+	ListenQueue       int `json:"listen_queue"`
+	ListenQueueErrors int `json:"listen_queue_errors"`
+	SignalQueue       int `json:"signal_queue"`
+	Load              int `json:"load"`
+	Pid               int `json:"pid"`
+
+	Sockets  []*Socket  `json:"sockets"`
+	Workers  []*Worker  `json:"workers"`
+	Caches   []*Cache   `json:"caches"`
+	Spoolers []*Spooler `json:"spoolers"`
+	Legions  []*Legion  `json:"legions"`
+
+	// Emperor
+	Emperor       []string       `json:"emperor"`
+	EmperorTyrant int            `json:"emperor_tyrant"`
+	ThrottleLevel int            `json:"throttle_level"`
+	Vassals       []*Vassal      `json:"vassals"`
+	Blacklist     []*Blacklisted `json:"blacklist"`
+}
+
+// Vassal defines the metric structure of a vassal managed by the emperor.
+type Vassal struct {
+	// Tags
+	Id string `json:"id"`
+
+	// Fields
+	Pid           int `json:"pid"`
+	Born          int `json:"born"`
+	LastMod       int `json:"last_mod"`
+	LastHeartbeat int `json:"last_heartbeat"`
+	Loyal         int `json:"loyal"`
+	Ready         int `json:"ready"`
+	Accepting     int `json:"accepting"`
+	Cursed        int `json:"cursed"`
+	Zerg          int `json:"zerg"`
+	Respawns      int `json:"respawns"`
+}
+
+// Blacklisted defines a vassal the emperor is throttling.
+type Blacklisted struct {
+	Id            string `json:"id"`
+	ThrottleLevel int    `json:"throttle_level"`
+	Attempt       int    `json:"attempt"`
+}
+
+// Socket defines the listening socket metric structure.
+type Socket struct {
+	// Tags
+	Name  string `json:"name"`
+	Proto string `json:"proto"`
+
+	// Fields
+	Queue      int `json:"queue"`
+	MaxQueue   int `json:"max_queue"`
+	Shared     int `json:"shared"`
+	CanOffload int `json:"can_offload"`
+}
+
+// Cache defines the cache2 metric structure.
+type Cache struct {
+	// Tags
+	Name string `json:"name"`
+
+	// Fields
+	Items    int `json:"items"`
+	MaxItems int `json:"max_items"`
+	Hits     int `json:"hits"`
+	Misses   int `json:"miss"`
+	Full     int `json:"full"`
+}
+
+// Spooler defines the spooler metric structure.
+type Spooler struct {
+	// Tags
+	Dir string `json:"dir"`
+
+	// Fields
+	Pid      int `json:"pid"`
+	Tasks    int `json:"tasks"`
+	Respawns int `json:"respawns"`
+	Running  int `json:"running"`
+}
+
+// Legion defines the legion metric structure.
+type Legion struct {
+	// Tags
+	Legion string `json:"legion"`
+
+	// Fields
+	Valor      int           `json:"valor"`
+	Checksum   int           `json:"checksum"`
+	Quorum     int           `json:"quorum"`
+	IAmTheLord int           `json:"i_am_the_lord"`
+	LordValor  int           `json:"lord_valor"`
+	Nodes      []*LegionNode `json:"nodes"`
+}
+
+// LegionNode defines a member of a legion.
+type LegionNode struct {
+	Name     string `json:"name"`
+	Valor    int    `json:"valor"`
+	Checksum int    `json:"checksum"`
+	LastSeen int    `json:"last_seen"`
+}
+
+// Worker defines the worker metric structure.
+type Worker struct {
+	// Tags
+	WorkerId int `json:"id"`
+
+	// Fields
+	Pid           int    `json:"pid"`
+	Accepting     int    `json:"accepting"`
+	Requests      int    `json:"requests"`
+	Exceptions    int    `json:"exceptions"`
+	HarakiriCount int    `json:"harakiri_count"`
+	Signals       int    `json:"signals"`
+	Status        string `json:"status"`
+	Rss           int    `json:"rss"`
+	Vsz           int    `json:"vsz"`
+	RunningTime   int    `json:"running_time"`
+	LastSpawn     int    `json:"last_spawn"`
+	RespawnCount  int    `json:"respawn_count"`
+	Tx            int    `json:"tx"`
+	AvgRt         int    `json:"avg_rt"`
+
+	Apps  []*App  `json:"apps"`
+	Cores []*Core `json:"cores"`
+}
+
+// App defines the app metric structure.
+type App struct {
+	// Tags
+	AppId      int    `json:"id"`
+	MountPoint string `json:"mountpoint"`
+
+	// Fields
+	Modifier1   int `json:"modifier1"`
+	Requests    int `json:"requests"`
+	StartupTime int `json:"startup_time"`
+	Exceptions  int `json:"exceptions"`
+}
+
+// Core defines the core metric structure.
+type Core struct {
+	// Tags
+	CoreId int `json:"id"`
+
+	// Fields
+	Requests          int `json:"requests"`
+	StaticRequests    int `json:"static_requests"`
+	RoutedRequests    int `json:"routed_requests"`
+	OffloadedRequests int `json:"offloaded_requests"`
+	WriteErrors       int `json:"write_errors"`
+	ReadErrors        int `json:"read_errors"`
+	InRequest         int `json:"in_request"`
+}
+
+func NewUwsgi() *Uwsgi {
+	return &Uwsgi{
+		Timeout:               internal.Duration{Duration: 4 * time.Second},
+		ResponseHeaderTimeout: internal.Duration{Duration: 3 * time.Second},
+		MaxConcurrency:        10,
+		IdleConnTimeout:       internal.Duration{Duration: 90 * time.Second},
+		MaxBodySize:           32 * 1024 * 1024,
+		RetryInterval:         internal.Duration{Duration: 100 * time.Millisecond},
+		SourcePort:            true,
+		Workers:               true,
+		GatherWorkers:         true,
+		GatherApps:            true,
+		Log:                   logger.New("inputs.uwsgi", logger.LevelUnset),
+	}
+}
+
+func init() {
+	inputs.Add("uwsgi", func() telegraf.Input {
+		return NewUwsgi()
+	})
+}
@@ -0,0 +1,1452 @@
+package uwsgi
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const statsResponse = `{
+  "version":"2.0.12",
+  "listen_queue":0,
+  "listen_queue_errors":0,
+  "signal_queue":0,
+  "load":0,
+  "pid":28372,
+  "uid":1000,
+  "gid":1000,
+  "cwd":"/opt/uwsgi",
+  "sockets":[
+    {
+      "name":"127.0.0.1:3031",
+      "proto":"uwsgi",
+      "queue":4,
+      "max_queue":100,
+      "shared":0,
+      "can_offload":0
+    }
+  ],
+  "workers":[
+    {
+      "id":1,
+      "pid":28375,
+      "accepting":1,
+      "requests":0,
+      "delta_requests":0,
+      "exceptions":0,
+      "harakiri_count":0,
+      "signals":0,
+      "signal_queue":0,
+      "status":"idle",
+      "rss":0,
+      "vsz":0,
+      "running_time":0,
+      "last_spawn":1459942782,
+      "respawn_count":1,
+      "tx":0,
+      "avg_rt":0,
+      "apps":[
+        {
+          "id":0,
+          "modifier1":0,
+          "mountpoint":"/api",
+          "startup_time":1,
+          "requests":12,
+          "exceptions":2,
+          "chdir":""
+        }
+      ],
+      "cores":[
+        {
+          "id":0,
+          "requests":12,
+          "static_requests":3,
+          "routed_requests":1,
+          "offloaded_requests":0,
+          "write_errors":0,
+          "read_errors":0,
+          "in_request":1,
+          "vars":[]
+        }
+      ]
+    }
+  ],
+  "caches":[
+    {
+      "name":"sessions",
+      "hash":"djb33x",
+      "hashsize":65536,
+      "keysize":2048,
+      "max_items":100,
+      "blocks":100,
+      "blocksize":65536,
+      "items":7,
+      "hits":42,
+      "miss":5,
+      "full":0,
+      "last_modified_at":0
+    }
+  ],
+  "spoolers":[
+    {
+      "dir":"/var/spool/uwsgi",
+      "pid":28380,
+      "tasks":3,
+      "respawns":0,
+      "running":1
+    }
+  ],
+  "legions":[
+    {
+      "legion":"cluster",
+      "addr":"192.168.0.1:4242",
+      "uuid":"3b3ffa13-7b40-4ed2-a0d4-0a6b4e3f4c57",
+      "valor":100,
+      "checksum":31337,
+      "quorum":2,
+      "i_am_the_lord":1,
+      "lord_valor":100,
+      "lord_uuid":"3b3ffa13-7b40-4ed2-a0d4-0a6b4e3f4c57",
+      "lords":[],
+      "nodes":[
+        {"name":"192.168.0.1:4242","valor":100,"checksum":31337,"uuid":"3b3ffa13-7b40-4ed2-a0d4-0a6b4e3f4c57","last_seen":1459942782},
+        {"name":"192.168.0.2:4242","valor":90,"checksum":31337,"uuid":"f0c7e1c2-0c1a-4c5b-9a7e-3c2b4f0e9a11","last_seen":1459942782}
+      ]
+    }
+  ]
+}`
+
+const emperorResponse = `{
+  "version":"2.0.12",
+  "pid":1200,
+  "uid":0,
+  "gid":0,
+  "cwd":"/",
+  "emperor":["/etc/uwsgi/vassals"],
+  "emperor_tyrant":0,
+  "throttle_level":0,
+  "vassals":[
+    {
+      "id":"api.ini",
+      "pid":1210,
+      "born":1459942700,
+      "last_mod":1459942600,
+      "last_heartbeat":1459942780,
+      "loyal":1459942705,
+      "ready":1,
+      "accepting":1,
+      "last_loyal":1459942705,
+      "last_ready":1459942705,
+      "last_accepting":1459942705,
+      "first_run":1459942700,
+      "last_run":1459942700,
+      "cursed":0,
+      "zerg":0,
+      "on_demand":"",
+      "uid":1000,
+      "gid":1000,
+      "monitor":"dir:///etc/uwsgi/vassals",
+      "respawns":2
+    }
+  ],
+  "blacklist":[
+    {"id":"broken.ini","throttle_level":3,"attempt":2,"first_attempt":1459942700,"last_attempt":1459942770}
+  ]
+}`
+
+// serveRaw emulates the raw uWSGI stats socket: write the document, then
+// close the connection.
+func serveRaw(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		fmt.Fprint(conn, statsResponse)
+		conn.Close()
+	}
+}
+
+func init() {
+	// Pin the clock one minute after the last_spawn of the sample worker
+	timeNow = func() time.Time { return time.Unix(1459942842, 0) }
+}
+
+// withTags returns a copy of the server tags extended by extra.
+func withTags(server map[string]string, extra map[string]string) map[string]string {
+	tags := map[string]string{}
+	for k, v := range server {
+		tags[k] = v
+	}
+	for k, v := range extra {
+		tags[k] = v
+	}
+	return tags
+}
+
+func hostOf(t *testing.T, u string) string {
+	addr, err := url.Parse(u)
+	require.NoError(t, err)
+	host, _, err := net.SplitHostPort(addr.Host)
+	require.NoError(t, err)
+	return host
+}
+
+func assertStats(t *testing.T, acc *testutil.Accumulator, server map[string]string) {
+	overview := map[string]interface{}{
+		"listen_queue":        0,
+		"listen_queue_errors": 0,
+		"signal_queue":        0,
+		"load":                0,
+		"pid":                 28372,
+		"busy_workers":        0,
+		"idle_workers":        1,
+		"busy_ratio":          float64(0),
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_overview", overview,
+		withTags(server, map[string]string{"version": "2.0.12"}))
+
+	sockets := map[string]interface{}{
+		"queue":       4,
+		"max_queue":   100,
+		"shared":      0,
+		"can_offload": 0,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_sockets", sockets,
+		withTags(server, map[string]string{"name": "127.0.0.1:3031", "proto": "uwsgi"}))
+
+	workers := map[string]interface{}{
+		"pid":            28375,
+		"accepting":      1,
+		"requests":       0,
+		"exceptions":     0,
+		"harakiri_count": 0,
+		"signals":        0,
+		"status":         "idle",
+		"rss":            0,
+		"vsz":            0,
+		"running_time":   0,
+		"last_spawn":     1459942782,
+		"respawn_count":  1,
+		"tx":             0,
+		"avg_rt":         0,
+		"uptime":         int64(60),
+		"respawned":      0,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_workers", workers,
+		withTags(server, map[string]string{"worker_id": "1"}))
+
+	apps := map[string]interface{}{
+		"modifier1":    0,
+		"requests":     12,
+		"startup_time": 1,
+		"exceptions":   2,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_apps", apps,
+		withTags(server, map[string]string{
+			"worker_id":  "1",
+			"app_id":     "0",
+			"mountpoint": "/api",
+		}))
+
+	caches := map[string]interface{}{
+		"items":     7,
+		"max_items": 100,
+		"hits":      42,
+		"misses":    5,
+		"full":      0,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_caches", caches,
+		withTags(server, map[string]string{"name": "sessions"}))
+
+	spoolers := map[string]interface{}{
+		"pid":      28380,
+		"tasks":    3,
+		"respawns": 0,
+		"running":  1,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_spoolers", spoolers,
+		withTags(server, map[string]string{"dir": "/var/spool/uwsgi"}))
+}
+
+func TestBasic(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	assertStats(t, &acc, map[string]string{"source": hostOf(t, ts.URL)})
+}
+
+func TestTCPSocket(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go serveRaw(l)
+
+	u := "tcp://" + l.Addr().String()
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{u},
+		SourcePort:    true,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	assertStats(t, &acc, map[string]string{"source": l.Addr().String()})
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uwsgi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "stats.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer l.Close()
+	go serveRaw(l)
+
+	u := "unix://" + sock
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{u},
+		URLTag:        true,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assertStats(t, &acc, map[string]string{"source": hostname, "url": u})
+}
+
+func TestStatsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uwsgi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "stats.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(statsResponse), 0644))
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{"file://" + file},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assertStats(t, &acc, map[string]string{"source": hostname})
+
+	plugin.URLs = []string{"file://" + filepath.Join(dir, "missing.json")}
+	require.Error(t, plugin.Gather(&acc))
+}
+
+func TestUnsupportedScheme(t *testing.T) {
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{"udp://127.0.0.1:1717"},
+	}
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Gather(&acc))
+}
+
+func TestTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// Accept but never answer, so only the read deadline ends the gather.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{"tcp://" + l.Addr().String()},
+		Timeout:       internal.Duration{Duration: 100 * time.Millisecond},
+	}
+
+	var acc testutil.Accumulator
+	start := time.Now()
+	require.Error(t, plugin.Gather(&acc))
+	require.True(t, time.Since(start) < 2*time.Second)
+	require.False(t, acc.HasMeasurement("uwsgi_overview"))
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+	}
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Gather(&acc))
+
+	plugin = &Uwsgi{
+		Workers:            true,
+		GatherWorkers:      true,
+		GatherApps:         true,
+		URLs:               []string{ts.URL + "/"},
+		InsecureSkipVerify: true,
+	}
+
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	assertStats(t, &acc, map[string]string{"source": hostOf(t, ts.URL)})
+}
+
+func TestContinueOnError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs: []string{
+			ts.URL + "/down",
+			"udp://127.0.0.1:1717",
+			ts.URL + "/",
+		},
+	}
+
+	var acc testutil.Accumulator
+	err := plugin.Gather(&acc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/down")
+	require.Contains(t, err.Error(), "udp://127.0.0.1:1717")
+
+	assertStats(t, &acc, map[string]string{"source": hostOf(t, ts.URL)})
+}
+
+func TestGatherCores(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.False(t, acc.HasMeasurement("uwsgi_cores"))
+
+	plugin.GatherCores = true
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+
+	fields := map[string]interface{}{
+		"requests":           12,
+		"static_requests":    3,
+		"routed_requests":    1,
+		"offloaded_requests": 0,
+		"write_errors":       0,
+		"read_errors":        0,
+		"in_request":         1,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_cores", fields,
+		map[string]string{"source": hostOf(t, ts.URL), "worker_id": "1", "core_id": "0"})
+}
+
+func TestGatherLegions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.False(t, acc.HasMeasurement("uwsgi_legions"))
+
+	plugin.GatherLegions = true
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+
+	fields := map[string]interface{}{
+		"valor":         100,
+		"checksum":      31337,
+		"quorum":        2,
+		"i_am_the_lord": 1,
+		"lord_valor":    100,
+		"members":       2,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_legions", fields,
+		map[string]string{"source": hostOf(t, ts.URL), "legion": "cluster"})
+}
+
+func TestBasicAuthAndHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "telegraf" || pass != "secret" ||
+			r.Header.Get("X-Stats-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+	}
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Gather(&acc))
+
+	plugin = &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+		Username:      "telegraf",
+		Password:      "secret",
+		Headers:       map[string]string{"X-Stats-Token": "token"},
+	}
+
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	assertStats(t, &acc, map[string]string{"source": hostOf(t, ts.URL)})
+}
+
+func TestWorkerStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+		WorkerStatus:  "tag",
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	m, ok := acc.Get("uwsgi_workers")
+	require.True(t, ok)
+	require.Equal(t, "idle", m.Tags["status"])
+	require.NotContains(t, m.Fields, "status")
+
+	plugin.WorkerStatus = "numeric"
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	m, ok = acc.Get("uwsgi_workers")
+	require.True(t, ok)
+	require.Equal(t, 0, m.Fields["status_code"])
+	require.NotContains(t, m.Tags, "status")
+
+	plugin.WorkerStatus = "bogus"
+	require.Error(t, plugin.Gather(&acc))
+}
+
+func TestWorkerStatusCode(t *testing.T) {
+	require.Equal(t, 1, workerStatusCode("busy"))
+	require.Equal(t, 2, workerStatusCode("cheap"))
+	require.Equal(t, -1, workerStatusCode("unknown"))
+}
+
+func TestGatherConcurrently(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:        true,
+		GatherWorkers:  true,
+		GatherApps:     true,
+		URLs:           []string{ts.URL + "/a", ts.URL + "/b", ts.URL + "/c"},
+		MaxConcurrency: 3,
+		URLTag:         true,
+	}
+
+	var acc testutil.Accumulator
+	start := time.Now()
+	require.NoError(t, plugin.Gather(&acc))
+	require.True(t, time.Since(start) < 500*time.Millisecond)
+
+	for _, u := range plugin.URLs {
+		assertStats(t, &acc,
+			map[string]string{"source": hostOf(t, ts.URL), "url": u})
+	}
+}
+
+func TestShard(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs: []string{ts.URL + "/{1..3}"},
+	}
+	plugin.SetShard(func(target string) bool {
+		return target != ts.URL+"/2"
+	})
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	sort.Strings(requested)
+	require.Equal(t, []string{"/1", "/3"}, requested)
+
+	// A nil shard gathers all urls again
+	plugin.SetShard(nil)
+	requested = nil
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, requested, 3)
+}
+
+func TestGatherContext(t *testing.T) {
+	cancelled := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+		URLs:          []string{ts.URL + "/"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var acc testutil.Accumulator
+	err := plugin.GatherContext(ctx, &acc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "did not complete")
+
+	// The request in flight is cancelled instead of abandoned
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request was not cancelled")
+	}
+}
+
+func TestGatherContextSocket(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	// Accept but never answer, only cancelling ctx ends the read.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	plugin := &Uwsgi{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		var acc testutil.Accumulator
+		errC <- plugin.fetchStats(ctx, &acc,
+			&url.URL{Scheme: "tcp", Host: l.Addr().String()},
+			&StatsServer{}, &gatherDiagnostics{})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errC:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read was not interrupted")
+	}
+}
+
+func TestUtilization(t *testing.T) {
+	var acc testutil.Accumulator
+	plugin := &Uwsgi{}
+	plugin.gatherStatServer(&acc, &StatsServer{
+		Source: "127.0.0.1",
+		Workers: []*Worker{
+			{Status: "busy"},
+			{Status: "busy"},
+			{Status: "idle"},
+			{Status: "cheap"},
+		},
+	})
+
+	m, ok := acc.Get("uwsgi_overview")
+	require.True(t, ok)
+	require.Equal(t, 2, m.Fields["busy_workers"])
+	require.Equal(t, 1, m.Fields["idle_workers"])
+	require.Equal(t, 0.5, m.Fields["busy_ratio"])
+}
+
+func TestGatherSelection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs:         []string{ts.URL + "/"},
+		Workers:      true,
+		GatherApps:   true,
+		FieldInclude: []string{"listen_queue*", "requests", "mountpoint"},
+		FieldExclude: []string{"listen_queue_errors"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.False(t, acc.HasMeasurement("uwsgi_workers"))
+	require.True(t, acc.HasMeasurement("uwsgi_apps"))
+
+	m, ok := acc.Get("uwsgi_overview")
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{"listen_queue": 0}, m.Fields)
+
+	// Points left without any field are not emitted at all
+	require.False(t, acc.HasMeasurement("uwsgi_caches"))
+}
+
+func TestEmperor(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, emperorResponse)
+	}))
+	defer ts.Close()
+
+	plugin := NewUwsgi()
+	plugin.URLs = []string{ts.URL + "/"}
+	plugin.SourcePort = false
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.False(t, acc.HasMeasurement("uwsgi_overview"))
+
+	server := map[string]string{"source": hostOf(t, ts.URL)}
+	emperor := map[string]interface{}{
+		"pid":            1200,
+		"emperor_tyrant": 0,
+		"throttle_level": 0,
+		"vassals":        1,
+		"blacklisted":    1,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_emperor", emperor,
+		withTags(server, map[string]string{"version": "2.0.12"}))
+
+	vassals := map[string]interface{}{
+		"pid":            1210,
+		"born":           1459942700,
+		"last_mod":       1459942600,
+		"last_heartbeat": 1459942780,
+		"loyal":          1459942705,
+		"ready":          1,
+		"accepting":      1,
+		"cursed":         0,
+		"zerg":           0,
+		"respawns":       2,
+	}
+	acc.AssertContainsTaggedFields(t, "uwsgi_vassals", vassals,
+		withTags(server, map[string]string{"vassal": "api.ini"}))
+}
+
+func TestDiscoverVassals(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/emperor":
+			fmt.Fprint(w, emperorResponse)
+		case "/vassal/api":
+			fmt.Fprint(w, statsResponse)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	plugin := NewUwsgi()
+	plugin.URLs = []string{ts.URL + "/emperor"}
+	plugin.SourcePort = false
+	plugin.DiscoverVassals = true
+	plugin.VassalStatsURL = ts.URL + "/vassal/{vassal}"
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	server := map[string]string{"source": hostOf(t, ts.URL)}
+	require.True(t, acc.HasMeasurement("uwsgi_emperor"))
+	assertStats(t, &acc, withTags(server, map[string]string{"vassal": "api"}))
+}
+
+func TestParseMode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// "load" is not a number, so decoding fails with a type error
+		fmt.Fprint(w, `{"version":"2.0.12","listen_queue":3,"load":"high","pid":1}`)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs: []string{ts.URL + "/"},
+	}
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Gather(&acc))
+	require.False(t, acc.HasMeasurement("uwsgi_overview"))
+
+	plugin.ParseMode = "tolerant"
+	require.Error(t, plugin.Gather(&acc))
+	m, ok := acc.Get("uwsgi_overview")
+	require.True(t, ok)
+	require.Equal(t, 3, m.Fields["listen_queue"])
+	require.Equal(t, 1, m.Fields["parse_errors"])
+
+	plugin.ParseMode = "bogus"
+	require.Error(t, plugin.Gather(&acc))
+
+	for _, body := range []string{
+		// Truncated document
+		statsResponse[:len(statsResponse)/2],
+		"<html>Bad Gateway</html>",
+		`["not", "an", "object"]`,
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+
+		plugin := &Uwsgi{
+			URLs:      []string{ts.URL + "/"},
+			ParseMode: "tolerant",
+		}
+
+		// Nothing was decoded, so only the error is reported
+		var acc testutil.Accumulator
+		require.Error(t, plugin.Gather(&acc))
+		require.Equal(t, 0, len(acc.Metrics), body)
+		ts.Close()
+	}
+}
+
+func TestContentEncoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			fmt.Fprint(w, statsResponse)
+			return
+		}
+		// The unlabelled endpoint emulates a proxy dropping the header
+		if r.URL.Path != "/unlabelled" {
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, statsResponse)
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs:          []string{ts.URL + "/"},
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	assertStats(t, &acc, map[string]string{"source": hostOf(t, ts.URL)})
+
+	plugin.URLs = []string{ts.URL + "/unlabelled"}
+	acc = testutil.Accumulator{}
+	require.Error(t, plugin.Gather(&acc))
+
+	plugin.ContentEncoding = "gzip"
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	assertStats(t, &acc, map[string]string{"source": hostOf(t, ts.URL)})
+}
+
+func TestServerTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		Servers: []Server{
+			{URL: ts.URL + "/", Tags: map[string]string{"service": "api", "env": "prod"}},
+		},
+		Workers:       true,
+		GatherWorkers: true,
+		GatherApps:    true,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	assertStats(t, &acc, map[string]string{
+		"source":  hostOf(t, ts.URL),
+		"service": "api",
+		"env":     "prod",
+	})
+}
+
+func TestHTTPProxy(t *testing.T) {
+	// The proxy answers absolute-form requests itself, as a forward proxy
+	// in front of the real stats server would.
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer proxy.Close()
+
+	plugin := &Uwsgi{
+		URLs:         []string{"http://uwsgi.invalid:1717/"},
+		HTTPProxyURL: proxy.URL,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Equal(t, "http://uwsgi.invalid:1717/", <-proxied)
+	require.True(t, acc.HasMeasurement("uwsgi_overview"))
+
+	plugin = &Uwsgi{
+		URLs:         []string{"http://uwsgi.invalid:1717/"},
+		HTTPProxyURL: "://bad",
+	}
+	require.Error(t, plugin.Gather(&acc))
+}
+
+func TestRespawned(t *testing.T) {
+	plugin := &Uwsgi{}
+	s := &StatsServer{Url: "tcp://127.0.0.1:1717"}
+
+	for i, count := range []int{1, 1, 2} {
+		s.Workers = []*Worker{{WorkerId: 1, RespawnCount: count}}
+		var acc testutil.Accumulator
+		plugin.gatherWorkers(&acc, s)
+
+		m, ok := acc.Get("uwsgi_workers")
+		require.True(t, ok)
+		if i == 2 {
+			require.Equal(t, 1, m.Fields["respawned"])
+		} else {
+			require.Equal(t, 0, m.Fields["respawned"])
+		}
+	}
+}
+
+func TestResponseTimeBuckets(t *testing.T) {
+	var acc testutil.Accumulator
+	plugin := &Uwsgi{
+		ResponseTimeBuckets: []string{"10ms", "100ms", "1s"},
+	}
+	plugin.gatherStatServer(&acc, &StatsServer{
+		Source: "127.0.0.1",
+		Workers: []*Worker{
+			{AvgRt: 5000},
+			{AvgRt: 50000},
+			{AvgRt: 70000},
+			{AvgRt: 2000000},
+		},
+	})
+
+	m, ok := acc.Get("uwsgi_overview")
+	require.True(t, ok)
+	require.Equal(t, 1, m.Fields["avg_rt_lt_10ms"])
+	require.Equal(t, 3, m.Fields["avg_rt_lt_100ms"])
+	require.Equal(t, 3, m.Fields["avg_rt_lt_1s"])
+
+	plugin.ResponseTimeBuckets = []string{"fast"}
+	require.Error(t, plugin.Gather(&acc))
+}
+
+func TestWorkersDisabled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := NewUwsgi()
+	plugin.URLs = []string{ts.URL + "/"}
+	plugin.Workers = false
+	plugin.GatherCores = true
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	m, ok := acc.Get("uwsgi_overview")
+	require.True(t, ok)
+	require.Equal(t, 1, m.Fields["idle_workers"])
+	require.True(t, acc.HasMeasurement("uwsgi_sockets"))
+	for _, measurement := range []string{"uwsgi_workers", "uwsgi_apps", "uwsgi_cores"} {
+		require.False(t, acc.HasMeasurement(measurement), measurement)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	var conns int
+	var mu sync.Mutex
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	plugin := NewUwsgi()
+	plugin.URLs = []string{ts.URL + "/"}
+
+	var acc testutil.Accumulator
+	for i := 0; i < 3; i++ {
+		require.NoError(t, plugin.Gather(&acc))
+	}
+	mu.Lock()
+	require.Equal(t, 1, conns)
+	mu.Unlock()
+
+	plugin = NewUwsgi()
+	plugin.URLs = []string{ts.URL + "/"}
+	plugin.DisableKeepalive = true
+	for i := 0; i < 3; i++ {
+		require.NoError(t, plugin.Gather(&acc))
+	}
+	mu.Lock()
+	require.Equal(t, 4, conns)
+	mu.Unlock()
+}
+
+func TestGatherDiagnostics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs:              []string{ts.URL + "/", ts.URL + "/down"},
+		URLTag:            true,
+		GatherDiagnostics: true,
+	}
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Gather(&acc))
+	require.True(t, acc.HasMeasurement("uwsgi_gather"))
+
+	for _, m := range acc.Metrics {
+		if m.Measurement != "uwsgi_gather" {
+			continue
+		}
+		require.Contains(t, m.Fields, "gather_time")
+		switch m.Tags["url"] {
+		case ts.URL + "/":
+			require.Equal(t, 200, m.Fields["status_code"])
+			require.Equal(t, int64(len(statsResponse)), m.Fields["response_size"])
+			require.Equal(t, 1, m.Fields["success"])
+		case ts.URL + "/down":
+			require.Equal(t, 503, m.Fields["status_code"])
+			require.Equal(t, 0, m.Fields["success"])
+		default:
+			t.Fatalf("unexpected url tag %s", m.Tags["url"])
+		}
+	}
+}
+
+const legacyResponse = `{
+  "listen_queue_len":2,
+  "load":1,
+  "pid":28372,
+  "workers":[
+    {
+      "id":1,
+      "pid":28375,
+      "requests":10,
+      "exceptions":0,
+      "harakiri":1,
+      "status":"busy",
+      "rss":0,
+      "running_time":0,
+      "last_spawn":1459942782,
+      "respawns":3,
+      "tx":0,
+      "avg_rt":20,
+      "apps":[{"id":0,"mount_point":"/legacy","requests":10,"exceptions":0}]
+    }
+  ]
+}`
+
+func TestLegacySchema(t *testing.T) {
+	for _, version := range []string{"", "1"} {
+		var acc testutil.Accumulator
+		plugin := &Uwsgi{Workers: true, GatherWorkers: true, GatherApps: true,
+			Version: version}
+		s := &StatsServer{Source: "127.0.0.1"}
+		require.NoError(t, plugin.decodeStats([]byte(legacyResponse), s))
+		plugin.gatherStats(&acc, s)
+
+		m, ok := acc.Get("uwsgi_overview")
+		require.True(t, ok)
+		require.Equal(t, 2, m.Fields["listen_queue"])
+		require.Equal(t, "1", m.Tags["version"])
+
+		m, ok = acc.Get("uwsgi_workers")
+		require.True(t, ok)
+		require.Equal(t, 1, m.Fields["harakiri_count"])
+		require.Equal(t, 3, m.Fields["respawn_count"])
+		require.Equal(t, 20, m.Fields["avg_rt"])
+
+		m, ok = acc.Get("uwsgi_apps")
+		require.True(t, ok)
+		require.Equal(t, "/legacy", m.Tags["mountpoint"])
+	}
+
+	// Current documents are left untouched
+	plugin := &Uwsgi{Version: "auto"}
+	s := &StatsServer{}
+	require.NoError(t, plugin.decodeStats([]byte(statsResponse), s))
+	require.Equal(t, "2.0.12", s.Version)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs:        []string{ts.URL + "/"},
+		MaxBodySize: 64,
+	}
+
+	var acc testutil.Accumulator
+	require.Error(t, plugin.Gather(&acc))
+	require.False(t, acc.HasMeasurement("uwsgi_overview"))
+
+	m, ok := acc.Get("uwsgi_gather")
+	require.True(t, ok)
+	require.Equal(t, 1, m.Fields["body_too_large"])
+	require.Equal(t, 0, m.Fields["success"])
+
+	acc = testutil.Accumulator{}
+	plugin.MaxBodySize = int64(len(statsResponse))
+	require.NoError(t, plugin.Gather(&acc))
+	require.True(t, acc.HasMeasurement("uwsgi_overview"))
+	require.False(t, acc.HasMeasurement("uwsgi_gather"))
+}
+
+func TestDeltaFields(t *testing.T) {
+	plugin := &Uwsgi{DeltaFields: true}
+	s := &StatsServer{Url: "tcp://127.0.0.1:1717"}
+
+	samples := []*Worker{
+		{WorkerId: 1, Requests: 10, HarakiriCount: 0, RespawnCount: 1},
+		{WorkerId: 1, Requests: 25, HarakiriCount: 1, RespawnCount: 2},
+		{WorkerId: 1, Requests: 4, HarakiriCount: 1, RespawnCount: 2},
+	}
+	for i, w := range samples {
+		s.Workers = []*Worker{w}
+		var acc testutil.Accumulator
+		plugin.gatherWorkers(&acc, s)
+
+		m, ok := acc.Get("uwsgi_workers")
+		require.True(t, ok)
+		switch i {
+		case 0:
+			require.NotContains(t, m.Fields, "requests_delta")
+		case 1:
+			require.Equal(t, 15, m.Fields["requests_delta"])
+			require.Equal(t, 1, m.Fields["harakiri_delta"])
+			require.Equal(t, 1, m.Fields["respawn_delta"])
+		case 2:
+			// requests went down: the counter was reset
+			require.Equal(t, 4, m.Fields["requests_delta"])
+			require.Equal(t, 0, m.Fields["harakiri_delta"])
+			require.Equal(t, 0, m.Fields["respawn_delta"])
+		}
+	}
+}
+
+func TestDeltaFieldsState(t *testing.T) {
+	plugin := &Uwsgi{DeltaFields: true}
+	s := &StatsServer{Url: "tcp://127.0.0.1:1717"}
+	s.Workers = []*Worker{{WorkerId: 1, Requests: 10}}
+	plugin.gatherWorkers(&testutil.Accumulator{}, s)
+
+	// The baselines survive a restart of the agent
+	data, err := json.Marshal(plugin.GetState())
+	require.NoError(t, err)
+	var state map[string]*Worker
+	require.NoError(t, json.Unmarshal(data, &state))
+	restarted := &Uwsgi{DeltaFields: true}
+	require.NoError(t, restarted.SetState(state))
+
+	s.Workers = []*Worker{{WorkerId: 1, Requests: 25}}
+	var acc testutil.Accumulator
+	restarted.gatherWorkers(&acc, s)
+	m, ok := acc.Get("uwsgi_workers")
+	require.True(t, ok)
+	require.Equal(t, 15, m.Fields["requests_delta"])
+}
+
+func TestForgetWorkers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs:          []string{ts.URL + "/a", ts.URL + "/b"},
+		Workers:       true,
+		GatherWorkers: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, plugin.lastWorkers, 2)
+
+	// The workers of a server which is not polled anymore are forgotten
+	plugin.URLs = []string{ts.URL + "/a"}
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, plugin.lastWorkers, 1)
+	require.Contains(t, plugin.lastWorkers, ts.URL+"/a")
+
+	// And so are the workers which are gone
+	s := &StatsServer{Url: ts.URL + "/a"}
+	s.Workers = []*Worker{{WorkerId: 7}}
+	plugin.gatherWorkers(&acc, s)
+	require.Len(t, plugin.lastWorkers[ts.URL+"/a"], 1)
+	require.Contains(t, plugin.lastWorkers[ts.URL+"/a"], 7)
+}
+
+func TestWorkerAppTags(t *testing.T) {
+	plugin := &Uwsgi{WorkerAppTags: true}
+	s := &StatsServer{
+		Url:    "tcp://127.0.0.1:1717",
+		Source: "127.0.0.1:1717",
+		Workers: []*Worker{
+			{WorkerId: 1, Apps: []*App{{AppId: 0, MountPoint: "/api"}}},
+			{WorkerId: 2, Apps: []*App{{AppId: 0}, {AppId: 1}}},
+		},
+	}
+
+	var acc testutil.Accumulator
+	plugin.gatherWorkers(&acc, s)
+
+	for _, m := range acc.Metrics {
+		switch m.Tags["worker_id"] {
+		case "1":
+			require.Equal(t, "0", m.Tags["app_id"])
+			require.Equal(t, "/api", m.Tags["mountpoint"])
+		case "2":
+			require.NotContains(t, m.Tags, "app_id")
+			require.NotContains(t, m.Tags, "mountpoint")
+		}
+	}
+}
+
+func TestMeasurementPrefix(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs:              []string{ts.URL + "/"},
+		Workers:           true,
+		GatherWorkers:     true,
+		MeasurementPrefix: "app_",
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	require.True(t, acc.HasMeasurement("app_overview"))
+	require.True(t, acc.HasMeasurement("app_workers"))
+	require.False(t, acc.HasMeasurement("uwsgi_overview"))
+}
+
+func TestRetries(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, statsResponse)
+	}))
+	defer ts.Close()
+
+	plugin := &Uwsgi{
+		URLs:              []string{ts.URL + "/"},
+		MaxRetries:        2,
+		RetryInterval:     internal.Duration{Duration: time.Millisecond},
+		GatherDiagnostics: true,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Equal(t, 3, requests)
+	require.True(t, acc.HasMeasurement("uwsgi_overview"))
+	m, ok := acc.Get("uwsgi_gather")
+	require.True(t, ok)
+	require.Equal(t, 2, m.Fields["retries"])
+
+	// Give up after max_retries
+	requests = 0
+	plugin.MaxRetries = 1
+	require.Error(t, plugin.Gather(&acc))
+	require.Equal(t, 2, requests)
+}
+
+func TestExpandURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uwsgi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"api.sock", "web.sock", "stats.json"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	tests := []struct {
+		url      string
+		expected []string
+	}{
+		{"tcp://127.0.0.1:1717", []string{"tcp://127.0.0.1:1717"}},
+		{"tcp://10.0.0.{1..3}:1717", []string{
+			"tcp://10.0.0.1:1717", "tcp://10.0.0.2:1717", "tcp://10.0.0.3:1717"}},
+		{"http://web{08..10}:{1717..1718}/", []string{
+			"http://web08:1717/", "http://web08:1718/",
+			"http://web09:1717/", "http://web09:1718/",
+			"http://web10:1717/", "http://web10:1718/"}},
+		{"unix://" + dir + "/*.sock", []string{
+			"unix://" + dir + "/api.sock", "unix://" + dir + "/web.sock"}},
+		{"file://" + dir + "/*.json", []string{"file://" + dir + "/stats.json"}},
+		{"unix://" + dir + "/*.missing", []string{}},
+		// only socket and file paths are globbed
+		{"http://127.0.0.1:1717/*", []string{"http://127.0.0.1:1717/*"}},
+	}
+	for _, test := range tests {
+		urls := expandURL(test.url)
+		if urls == nil {
+			urls = []string{}
+		}
+		require.Equal(t, test.expected, urls, test.url)
+	}
+}
+
+func TestHarakiriEvents(t *testing.T) {
+	plugin := &Uwsgi{}
+	s := &StatsServer{Url: "tcp://127.0.0.1:1717", Source: "127.0.0.1:1717"}
+
+	samples := []*Worker{
+		{WorkerId: 1, Pid: 100, HarakiriCount: 0},
+		{WorkerId: 1, Pid: 101, HarakiriCount: 1},
+		{WorkerId: 1, Pid: 101, HarakiriCount: 1},
+	}
+	for i, w := range samples {
+		s.Workers = []*Worker{w}
+		var acc testutil.Accumulator
+		plugin.gatherWorkers(&acc, s)
+
+		if i != 1 {
+			require.False(t, acc.HasMeasurement("uwsgi_events"))
+			continue
+		}
+		acc.AssertContainsTaggedFields(t, "uwsgi_events",
+			map[string]interface{}{"pid": 100, "count": 1},
+			map[string]string{
+				"source":    "127.0.0.1:1717",
+				"event":     "harakiri",
+				"worker_id": "1",
+			})
+	}
+}
@@ -0,0 +1,390 @@
+package vsphere
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
+)
+
+// client is a session on the web services API of a vCenter, SOAP over
+// HTTPS, limited to the calls read by the plugin: there is no vSphere
+// library in the dependencies of the agent.
+type client struct {
+	url     string
+	http    *http.Client
+	content serviceContent
+	// Performance counters by name, as "cpu.usage.average", and by key
+	counters     map[string]*perfCounter
+	countersByID map[int32]*perfCounter
+
+	mu sync.Mutex
+	// The session timed out or was closed by the vCenter
+	expired bool
+}
+
+// mor is a managed object reference, as <obj type="HostSystem">host-10</obj>.
+type mor struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type serviceContent struct {
+	RootFolder        mor `xml:"rootFolder"`
+	PropertyCollector mor `xml:"propertyCollector"`
+	ViewManager       mor `xml:"viewManager"`
+	SessionManager    mor `xml:"sessionManager"`
+	PerfManager       mor `xml:"perfManager"`
+}
+
+type perfCounter struct {
+	Key      int32 `xml:"key"`
+	NameInfo struct {
+		Key string `xml:"key"`
+	} `xml:"nameInfo"`
+	GroupInfo struct {
+		Key string `xml:"key"`
+	} `xml:"groupInfo"`
+	UnitInfo struct {
+		Key string `xml:"key"`
+	} `xml:"unitInfo"`
+	RollupType string `xml:"rollupType"`
+}
+
+func (c *perfCounter) name() string {
+	return c.GroupInfo.Key + "." + c.NameInfo.Key + "." + c.RollupType
+}
+
+// The requests, their elements in the order of the WSDL of the API.
+
+type retrieveServiceContent struct {
+	XMLName xml.Name `xml:"urn:vim25 RetrieveServiceContent"`
+	This    mor      `xml:"_this"`
+}
+
+type login struct {
+	XMLName  xml.Name `xml:"urn:vim25 Login"`
+	This     mor      `xml:"_this"`
+	UserName string   `xml:"userName"`
+	Password string   `xml:"password"`
+}
+
+type createContainerView struct {
+	XMLName   xml.Name `xml:"urn:vim25 CreateContainerView"`
+	This      mor      `xml:"_this"`
+	Container mor      `xml:"container"`
+	Type      []string `xml:"type"`
+	Recursive bool     `xml:"recursive"`
+}
+
+type destroyView struct {
+	XMLName xml.Name `xml:"urn:vim25 DestroyView"`
+	This    mor      `xml:"_this"`
+}
+
+type retrievePropertiesEx struct {
+	XMLName xml.Name             `xml:"urn:vim25 RetrievePropertiesEx"`
+	This    mor                  `xml:"_this"`
+	SpecSet []propertyFilterSpec `xml:"specSet"`
+	Options struct{}             `xml:"options"`
+}
+
+type continueRetrievePropertiesEx struct {
+	XMLName xml.Name `xml:"urn:vim25 ContinueRetrievePropertiesEx"`
+	This    mor      `xml:"_this"`
+	Token   string   `xml:"token"`
+}
+
+type propertyFilterSpec struct {
+	PropSet   []propertySpec `xml:"propSet"`
+	ObjectSet []objectSpec   `xml:"objectSet"`
+}
+
+type propertySpec struct {
+	Type    string   `xml:"type"`
+	PathSet []string `xml:"pathSet"`
+}
+
+type objectSpec struct {
+	Obj       mor             `xml:"obj"`
+	Skip      bool            `xml:"skip"`
+	SelectSet []traversalSpec `xml:"selectSet"`
+}
+
+type traversalSpec struct {
+	XSIType string `xml:"xsi:type,attr"`
+	Name    string `xml:"name"`
+	Type    string `xml:"type"`
+	Path    string `xml:"path"`
+	Skip    bool   `xml:"skip"`
+}
+
+type queryPerf struct {
+	XMLName   xml.Name        `xml:"urn:vim25 QueryPerf"`
+	This      mor             `xml:"_this"`
+	QuerySpec []perfQuerySpec `xml:"querySpec"`
+}
+
+type perfQuerySpec struct {
+	Entity     mor            `xml:"entity"`
+	StartTime  *time.Time     `xml:"startTime,omitempty"`
+	MaxSample  int32          `xml:"maxSample,omitempty"`
+	MetricID   []perfMetricID `xml:"metricId"`
+	IntervalID int32          `xml:"intervalId"`
+}
+
+type perfMetricID struct {
+	CounterID int32  `xml:"counterId"`
+	Instance  string `xml:"instance"`
+}
+
+// The responses.
+
+type objectContent struct {
+	Obj     mor `xml:"obj"`
+	PropSet []struct {
+		Name string `xml:"name"`
+		Val  struct {
+			Text  string `xml:",chardata"`
+			Inner []byte `xml:",innerxml"`
+		} `xml:"val"`
+	} `xml:"propSet"`
+}
+
+// property returns the value of the property name of o.
+func (o *objectContent) property(name string) string {
+	for _, p := range o.PropSet {
+		if p.Name == name {
+			return p.Val.Text
+		}
+	}
+	return ""
+}
+
+type retrieveResult struct {
+	Returnval struct {
+		Token   string          `xml:"token"`
+		Objects []objectContent `xml:"objects"`
+	} `xml:"returnval"`
+}
+
+type perfEntityMetric struct {
+	Entity     mor `xml:"entity"`
+	SampleInfo []struct {
+		Timestamp time.Time `xml:"timestamp"`
+	} `xml:"sampleInfo"`
+	Value []struct {
+		ID    perfMetricID `xml:"id"`
+		Value []int64      `xml:"value"`
+	} `xml:"value"`
+}
+
+type queryPerfResponse struct {
+	Returnval []perfEntityMetric `xml:"returnval"`
+}
+
+// newClient logs in the vCenter of the SDK url u, as
+// https://vcenter.local/sdk, and reads its performance counters.
+func newClient(u, username, password string, tlsCfg *tls.Config, timeout time.Duration) (*client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		url: u,
+		http: &http.Client{
+			Transport: &http.Transport{
+				ResponseHeaderTimeout: timeout,
+				TLSClientConfig:       tlsCfg,
+			},
+			// The session is the vmware_soap_session cookie
+			Jar:     jar,
+			Timeout: timeout,
+		},
+	}
+
+	var content struct {
+		Returnval serviceContent `xml:"returnval"`
+	}
+	if err := c.call(&retrieveServiceContent{
+		This: mor{Type: "ServiceInstance", Value: "ServiceInstance"},
+	}, &content); err != nil {
+		return nil, err
+	}
+	c.content = content.Returnval
+	if err := c.call(&login{
+		This:     c.content.SessionManager,
+		UserName: username,
+		Password: password,
+	}, &struct{}{}); err != nil {
+		return nil, err
+	}
+
+	objects, err := c.retrieve(propertyFilterSpec{
+		PropSet:   []propertySpec{{Type: "PerformanceManager", PathSet: []string{"perfCounter"}}},
+		ObjectSet: []objectSpec{{Obj: c.content.PerfManager}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.counters = make(map[string]*perfCounter)
+	c.countersByID = make(map[int32]*perfCounter)
+	for _, o := range objects {
+		for _, p := range o.PropSet {
+			var val struct {
+				Counters []*perfCounter `xml:"PerfCounterInfo"`
+			}
+			// The value is the list of the counters, wrapped to be one
+			// element
+			inner := append(append([]byte("<val>"), p.Val.Inner...), "</val>"...)
+			if err := xml.Unmarshal(inner, &val); err != nil {
+				return nil, fmt.Errorf("parse performance counters of %s: %s", u, err)
+			}
+			for _, counter := range val.Counters {
+				c.countersByID[counter.Key] = counter
+				if _, ok := c.counters[counter.name()]; !ok {
+					c.counters[counter.name()] = counter
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// retrieve returns the objects of spec, from all the pages of the result.
+func (c *client) retrieve(spec propertyFilterSpec) ([]objectContent, error) {
+	var result retrieveResult
+	if err := c.call(&retrievePropertiesEx{
+		This:    c.content.PropertyCollector,
+		SpecSet: []propertyFilterSpec{spec},
+	}, &result); err != nil {
+		return nil, err
+	}
+	objects := result.Returnval.Objects
+	for token := result.Returnval.Token; token != ""; token = result.Returnval.Token {
+		result = retrieveResult{}
+		if err := c.call(&continueRetrievePropertiesEx{
+			This:  c.content.PropertyCollector,
+			Token: token,
+		}, &result); err != nil {
+			return nil, err
+		}
+		objects = append(objects, result.Returnval.Objects...)
+	}
+	return objects, nil
+}
+
+// inventory returns the properties paths of the objects of the types of
+// paths, below the root folder.
+func (c *client) inventory(paths map[string][]string) ([]objectContent, error) {
+	view := createContainerView{
+		This:      c.content.ViewManager,
+		Container: c.content.RootFolder,
+		Recursive: true,
+	}
+	spec := propertyFilterSpec{}
+	for objectType, pathSet := range paths {
+		view.Type = append(view.Type, objectType)
+		spec.PropSet = append(spec.PropSet, propertySpec{Type: objectType, PathSet: pathSet})
+	}
+	var created struct {
+		Returnval mor `xml:"returnval"`
+	}
+	if err := c.call(&view, &created); err != nil {
+		return nil, err
+	}
+	defer c.call(&destroyView{This: created.Returnval}, &struct{}{})
+
+	spec.ObjectSet = []objectSpec{{
+		Obj:  created.Returnval,
+		Skip: true,
+		SelectSet: []traversalSpec{{
+			XSIType: "TraversalSpec",
+			Name:    "view",
+			Type:    "ContainerView",
+			Path:    "view",
+		}},
+	}}
+	return c.retrieve(spec)
+}
+
+// queryPerf returns the samples of specs.
+func (c *client) queryPerf(specs []perfQuerySpec) ([]perfEntityMetric, error) {
+	var result queryPerfResponse
+	if err := c.call(&queryPerf{
+		This:      c.content.PerfManager,
+		QuerySpec: specs,
+	}, &result); err != nil {
+		return nil, err
+	}
+	return result.Returnval, nil
+}
+
+// call sends the request req and parses the response in resp.
+func (c *client) call(req, resp interface{}) error {
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"` +
+		` xmlns:xsd="http://www.w3.org/2001/XMLSchema"` +
+		` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><soapenv:Body>`)
+	buf.Write(body)
+	buf.WriteString(`</soapenv:Body></soapenv:Envelope>`)
+
+	httpReq, err := http.NewRequest("POST", c.url, &buf)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	httpReq.Header.Set("SOAPAction", "urn:vim25/6.0")
+	r, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	var envelope struct {
+		Body struct {
+			Fault *struct {
+				String string `xml:"faultstring"`
+				Detail struct {
+					Inner string `xml:",innerxml"`
+				} `xml:"detail"`
+			} `xml:"Fault"`
+			Inner []byte `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		if r.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned HTTP status %s", c.url, r.Status)
+		}
+		return fmt.Errorf("parse response of %s: %s", c.url, err)
+	}
+	if fault := envelope.Body.Fault; fault != nil {
+		if strings.Contains(fault.Detail.Inner, "NotAuthenticated") {
+			c.mu.Lock()
+			c.expired = true
+			c.mu.Unlock()
+		}
+		return fmt.Errorf("%s: %s", c.url, fault.String)
+	}
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP status %s", c.url, r.Status)
+	}
+	return xml.Unmarshal(envelope.Body.Inner, resp)
+}
+
+// isExpired returns whether the session of c is no longer authenticated.
+func (c *client) isExpired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expired
+}
@@ -0,0 +1,524 @@
+package vsphere
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+// VSphere reads the performance counters of the VMs, hosts, datastores and
+// clusters of vCenters, in batches of queries run concurrently.
+type VSphere struct {
+	Vcenters []string
+	Username string
+	Password string
+
+	VMMetrics        []string `toml:"vm_metrics"`
+	HostMetrics      []string `toml:"host_metrics"`
+	DatastoreMetrics []string `toml:"datastore_metrics"`
+	ClusterMetrics   []string `toml:"cluster_metrics"`
+	Instances        bool
+
+	MaxQueryObjects         int `toml:"max_query_objects"`
+	MaxQueryMetrics         int `toml:"max_query_metrics"`
+	Concurrency             int
+	ObjectDiscoveryInterval internal.Duration `toml:"object_discovery_interval"`
+	Timeout                 internal.Duration
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	mu sync.Mutex
+	// The sessions and the objects of the vCenters, by URL
+	vcenters map[string]*vcenter
+}
+
+var sampleConfig = `
+  ## SDK URLs of the vCenters
+  vcenters = ["https://vcenter.local/sdk"]
+  username = "user@vsphere.local"
+  password = "secret"
+
+  ## Performance counters read, as group.name.rollup, of the VMs, hosts,
+  ## datastores and clusters, none of these objects if empty
+  vm_metrics = [
+    "cpu.usage.average",
+    "cpu.ready.summation",
+    "mem.usage.average",
+    "mem.active.average",
+    "mem.swapped.average",
+    "net.bytesRx.average",
+    "net.bytesTx.average",
+    "disk.read.average",
+    "disk.write.average",
+    "sys.uptime.latest",
+  ]
+  host_metrics = [
+    "cpu.usage.average",
+    "cpu.ready.summation",
+    "mem.usage.average",
+    "mem.consumed.average",
+    "net.bytesRx.average",
+    "net.bytesTx.average",
+    "disk.read.average",
+    "disk.write.average",
+    "sys.uptime.latest",
+  ]
+  datastore_metrics = [
+    "disk.capacity.latest",
+    "disk.used.latest",
+    "disk.provisioned.latest",
+  ]
+  cluster_metrics = [
+    "cpu.usage.average",
+    "mem.usage.average",
+    "clusterServices.effectivecpu.average",
+    "clusterServices.effectivemem.average",
+  ]
+  ## Also report the counters of the instances, as the CPUs, disks and
+  ## interfaces, and not only their aggregates
+  # instances = false
+
+  ## Objects queried in one request, and counters of all these objects,
+  ## limited by vpxd.stats.maxQueryMetrics on the vCenter
+  # max_query_objects = 256
+  # max_query_metrics = 256
+  ## Requests run at the same time on a vCenter
+  # concurrency = 4
+  ## Interval of the discovery of the objects of the vCenters
+  # object_discovery_interval = "300s"
+
+  ## Timeout of the requests
+  # timeout = "60s"
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+func (v *VSphere) SampleConfig() string {
+	return sampleConfig
+}
+
+func (v *VSphere) Description() string {
+	return "Read the performance counters of the VMs, hosts, datastores and clusters of vCenters"
+}
+
+// kind is a type of object read by the plugin.
+type kind struct {
+	name       string
+	objectType string
+	// Properties read at the discovery
+	paths []string
+	// Tag of the name of the objects
+	nameTag string
+	// The datastores and clusters only have the historical statistics, the
+	// VMs and hosts have the realtime ones of the hosts
+	realtime bool
+}
+
+var kinds = []*kind{
+	{"vm", "VirtualMachine", []string{"name", "runtime.host", "runtime.powerState"}, "vmname", true},
+	{"host", "HostSystem", []string{"name", "parent"}, "esxhostname", true},
+	{"datastore", "Datastore", []string{"name"}, "dsname", false},
+	{"cluster", "ClusterComputeResource", []string{"name"}, "clustername", false},
+}
+
+// Intervals of the statistics, in seconds.
+const (
+	realtimeInterval   = 20
+	historicalInterval = 300
+)
+
+func (v *VSphere) metrics(k *kind) []string {
+	switch k.name {
+	case "vm":
+		return v.VMMetrics
+	case "host":
+		return v.HostMetrics
+	case "datastore":
+		return v.DatastoreMetrics
+	default:
+		return v.ClusterMetrics
+	}
+}
+
+// vcenter is a session on a vCenter and the objects it has.
+type vcenter struct {
+	client *client
+	// Host of the URL, as the vcenter tag
+	host string
+
+	discovered time.Time
+	objects    map[*kind]map[string]*object
+}
+
+// object is a VM, host, datastore or cluster, by its managed object ID.
+type object struct {
+	moid string
+	tags map[string]string
+}
+
+func (v *VSphere) Gather(acc telegraf.Accumulator) error {
+	// Keep gathering the other vCenters when one of them fails and return
+	// all errors as one giant error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errorStrings []string
+	for _, u := range v.Vcenters {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			if err := v.gatherVcenter(u, acc); err != nil {
+				mu.Lock()
+				errorStrings = append(errorStrings, err.Error())
+				mu.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+func (v *VSphere) gatherVcenter(u string, acc telegraf.Accumulator) error {
+	vc, err := v.vcenter(u)
+	if err != nil {
+		return err
+	}
+	err = v.discover(vc)
+	if err == nil {
+		err = v.collect(vc, acc)
+	}
+	// Log in again at the next gather
+	if vc.client.isExpired() {
+		v.mu.Lock()
+		delete(v.vcenters, u)
+		v.mu.Unlock()
+	}
+	return err
+}
+
+// vcenter returns the vCenter of the URL u, logged in.
+func (v *VSphere) vcenter(u string) (*vcenter, error) {
+	v.mu.Lock()
+	vc := v.vcenters[u]
+	v.mu.Unlock()
+	if vc != nil {
+		return vc, nil
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := internal.GetTLSConfig(
+		v.SSLCert, v.SSLKey, v.SSLCA, v.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	timeout := v.Timeout.Duration
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	c, err := newClient(u, v.Username, v.Password, tlsCfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+	vc = &vcenter{client: c, host: parsed.Host}
+
+	v.mu.Lock()
+	if v.vcenters == nil {
+		v.vcenters = make(map[string]*vcenter)
+	}
+	v.vcenters[u] = vc
+	v.mu.Unlock()
+	return vc, nil
+}
+
+// discover reads the objects of vc, unless they were read less than the
+// discovery interval ago.
+func (v *VSphere) discover(vc *vcenter) error {
+	interval := v.ObjectDiscoveryInterval.Duration
+	if vc.objects != nil && time.Since(vc.discovered) < interval {
+		return nil
+	}
+
+	// All the kinds for the names of the hosts and clusters of the tags
+	paths := make(map[string][]string)
+	for _, k := range kinds {
+		paths[k.objectType] = k.paths
+	}
+	contents, err := vc.client.inventory(paths)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]string)
+	for _, c := range contents {
+		names[c.Obj.Value] = c.property("name")
+	}
+	clusters := make(map[string]string)
+	for _, c := range contents {
+		// The parent of the hosts outside of a cluster is a ComputeResource
+		if c.Obj.Type == "HostSystem" {
+			if cluster, ok := names[c.property("parent")]; ok {
+				clusters[c.Obj.Value] = cluster
+			}
+		}
+	}
+
+	objects := make(map[*kind]map[string]*object)
+	for _, k := range kinds {
+		objects[k] = make(map[string]*object)
+	}
+	for _, c := range contents {
+		for _, k := range kinds {
+			if c.Obj.Type != k.objectType {
+				continue
+			}
+			tags := map[string]string{
+				"vcenter": vc.host,
+				"moid":    c.Obj.Value,
+				k.nameTag: c.property("name"),
+			}
+			switch k.name {
+			case "vm":
+				// The VMs powered off have no realtime statistics
+				if c.property("runtime.powerState") != "poweredOn" {
+					continue
+				}
+				host := c.property("runtime.host")
+				tags["esxhostname"] = names[host]
+				if cluster, ok := clusters[host]; ok {
+					tags["clustername"] = cluster
+				}
+			case "host":
+				if cluster, ok := clusters[c.Obj.Value]; ok {
+					tags["clustername"] = cluster
+				}
+			}
+			objects[k][c.Obj.Value] = &object{moid: c.Obj.Value, tags: tags}
+		}
+	}
+	vc.objects = objects
+	vc.discovered = time.Now()
+	return nil
+}
+
+// collect queries the performance counters of the objects of vc, in batches
+// run concurrently.
+func (v *VSphere) collect(vc *vcenter, acc telegraf.Accumulator) error {
+	instance := ""
+	if v.Instances {
+		instance = "*"
+	}
+	maxObjects := v.MaxQueryObjects
+	if maxObjects <= 0 {
+		maxObjects = 256
+	}
+	maxMetrics := v.MaxQueryMetrics
+	if maxMetrics <= 0 {
+		maxMetrics = 256
+	}
+	concurrency := v.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errorStrings []string
+	addError := func(err error) {
+		mu.Lock()
+		errorStrings = append(errorStrings, err.Error())
+		mu.Unlock()
+	}
+	sem := make(chan struct{}, concurrency)
+
+	for _, k := range kinds {
+		var ids []perfMetricID
+		var unknown []string
+		for _, name := range v.metrics(k) {
+			counter, ok := vc.client.counters[name]
+			if !ok {
+				unknown = append(unknown, name)
+				continue
+			}
+			ids = append(ids, perfMetricID{CounterID: counter.Key, Instance: instance})
+		}
+		if len(unknown) > 0 {
+			addError(fmt.Errorf("%s has no %s counters %s", vc.client.url, k.name,
+				strings.Join(unknown, ", ")))
+		}
+		if len(ids) == 0 || len(vc.objects[k]) == 0 {
+			continue
+		}
+
+		// The objects of a query, for its counters not to go over the limit
+		batchSize := maxMetrics / len(ids)
+		if batchSize > maxObjects {
+			batchSize = maxObjects
+		}
+		if batchSize < 1 {
+			batchSize = 1
+		}
+		spec := perfQuerySpec{MetricID: ids}
+		if k.realtime {
+			spec.IntervalID = realtimeInterval
+			spec.MaxSample = 1
+		} else {
+			// The historical statistics are rolled up late, the last sample
+			// of the hour is reported
+			start := time.Now().Add(-time.Hour)
+			spec.StartTime = &start
+			spec.IntervalID = historicalInterval
+		}
+
+		var batch []perfQuerySpec
+		flush := func(k *kind, batch []perfQuerySpec) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				metrics, err := vc.client.queryPerf(batch)
+				if err != nil {
+					addError(err)
+					return
+				}
+				for i := range metrics {
+					gatherEntity(vc, k, &metrics[i], acc)
+				}
+			}()
+		}
+		for _, o := range vc.objects[k] {
+			s := spec
+			s.Entity = mor{Type: k.objectType, Value: o.moid}
+			batch = append(batch, s)
+			if len(batch) == batchSize {
+				flush(k, batch)
+				batch = nil
+			}
+		}
+		if len(batch) > 0 {
+			flush(k, batch)
+		}
+	}
+	wg.Wait()
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+// gatherEntity adds the last samples of the counters of an object, one
+// metric by counter group and instance.
+func gatherEntity(vc *vcenter, k *kind, m *perfEntityMetric, acc telegraf.Accumulator) {
+	o, ok := vc.objects[k][m.Entity.Value]
+	if !ok || len(m.SampleInfo) == 0 {
+		return
+	}
+	last := len(m.SampleInfo) - 1
+	timestamp := m.SampleInfo[last].Timestamp
+
+	type key struct {
+		group, instance string
+	}
+	metrics := make(map[key]map[string]interface{})
+	for _, series := range m.Value {
+		counter, ok := vc.client.countersByID[series.ID.CounterID]
+		// -1 when the object has no sample
+		if !ok || len(series.Value) <= last || series.Value[last] < 0 {
+			continue
+		}
+		mk := key{counter.GroupInfo.Key, series.ID.Instance}
+		if metrics[mk] == nil {
+			metrics[mk] = make(map[string]interface{})
+		}
+		field := counter.NameInfo.Key + "_" + counter.RollupType
+		if counter.UnitInfo.Key == "percent" {
+			// Hundredths of percent
+			metrics[mk][field] = float64(series.Value[last]) / 100
+		} else {
+			metrics[mk][field] = series.Value[last]
+		}
+	}
+
+	for mk, fields := range metrics {
+		tags := make(map[string]string)
+		for k, v := range o.tags {
+			tags[k] = v
+		}
+		if mk.instance != "" {
+			tags["instance"] = mk.instance
+		}
+		acc.AddFields("vsphere_"+k.name+"_"+mk.group, fields, tags, timestamp)
+	}
+}
+
+func init() {
+	inputs.Add("vsphere", func() telegraf.Input {
+		return &VSphere{
+			VMMetrics: []string{
+				"cpu.usage.average",
+				"cpu.ready.summation",
+				"mem.usage.average",
+				"mem.active.average",
+				"mem.swapped.average",
+				"net.bytesRx.average",
+				"net.bytesTx.average",
+				"disk.read.average",
+				"disk.write.average",
+				"sys.uptime.latest",
+			},
+			HostMetrics: []string{
+				"cpu.usage.average",
+				"cpu.ready.summation",
+				"mem.usage.average",
+				"mem.consumed.average",
+				"net.bytesRx.average",
+				"net.bytesTx.average",
+				"disk.read.average",
+				"disk.write.average",
+				"sys.uptime.latest",
+			},
+			DatastoreMetrics: []string{
+				"disk.capacity.latest",
+				"disk.used.latest",
+				"disk.provisioned.latest",
+			},
+			ClusterMetrics: []string{
+				"cpu.usage.average",
+				"mem.usage.average",
+				"clusterServices.effectivecpu.average",
+				"clusterServices.effectivemem.average",
+			},
+			MaxQueryObjects:         256,
+			MaxQueryMetrics:         256,
+			Concurrency:             4,
+			ObjectDiscoveryInterval: internal.Duration{Duration: 300 * time.Second},
+			Timeout:                 internal.Duration{Duration: 60 * time.Second},
+		}
+	})
+}
@@ -0,0 +1,388 @@
+package vsphere
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const envelope = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body>%s</soapenv:Body>
+</soapenv:Envelope>`
+
+const serviceContentResponse = `<RetrieveServiceContentResponse xmlns="urn:vim25"><returnval>
+<rootFolder type="Folder">group-d1</rootFolder>
+<propertyCollector type="PropertyCollector">propertyCollector</propertyCollector>
+<viewManager type="ViewManager">ViewManager</viewManager>
+<about><fullName>VMware vCenter Server 6.7.0</fullName></about>
+<sessionManager type="SessionManager">SessionManager</sessionManager>
+<perfManager type="PerformanceManager">PerfMgr</perfManager>
+</returnval></RetrieveServiceContentResponse>`
+
+const counterInfo = `<PerfCounterInfo><key>%d</key><nameInfo><label>%s</label><summary>%s</summary><key>%s</key></nameInfo><groupInfo><label>%s</label><summary>%s</summary><key>%s</key></groupInfo><unitInfo><label>%s</label><summary>%s</summary><key>%s</key></unitInfo><rollupType>%s</rollupType><statsType>rate</statsType><level>1</level></PerfCounterInfo>`
+
+var counters = []struct {
+	key                       int32
+	group, name, unit, rollup string
+}{
+	{2, "cpu", "usage", "percent", "average"},
+	{12, "cpu", "ready", "millisecond", "summation"},
+	{24, "mem", "usage", "percent", "average"},
+	{143, "net", "bytesRx", "kiloBytesPerSecond", "average"},
+	{281, "disk", "capacity", "kiloBytes", "latest"},
+	{282, "disk", "used", "kiloBytes", "latest"},
+}
+
+func countersResponse() string {
+	var infos []string
+	for _, c := range counters {
+		infos = append(infos, fmt.Sprintf(counterInfo, c.key, c.name, c.name, c.name,
+			c.group, c.group, c.group, c.unit, c.unit, c.unit, c.rollup))
+	}
+	return `<RetrievePropertiesExResponse xmlns="urn:vim25"><returnval><objects>
+<obj type="PerformanceManager">PerfMgr</obj>
+<propSet><name>perfCounter</name><val xsi:type="ArrayOfPerfCounterInfo">` +
+		strings.Join(infos, "") + `</val></propSet>
+</objects></returnval></RetrievePropertiesExResponse>`
+}
+
+const objectXML = `<objects><obj type="%s">%s</obj>%s</objects>`
+
+const propertyXML = `<propSet><name>%s</name><val xsi:type="xsd:string">%s</val></propSet>`
+
+// The inventory, in two pages: a cluster of a host with two VMs, one
+// powered off, a host outside of a cluster with a VM, and a datastore.
+func inventoryResponse(page int) string {
+	objects := [][]string{{
+		fmt.Sprintf(objectXML, "ClusterComputeResource", "domain-c7", fmt.Sprintf(propertyXML, "name", "prod")),
+		fmt.Sprintf(objectXML, "HostSystem", "host-10",
+			fmt.Sprintf(propertyXML, "name", "esx1.local")+fmt.Sprintf(propertyXML, "parent", "domain-c7")),
+		fmt.Sprintf(objectXML, "VirtualMachine", "vm-42",
+			fmt.Sprintf(propertyXML, "name", "web1")+fmt.Sprintf(propertyXML, "runtime.host", "host-10")+
+				fmt.Sprintf(propertyXML, "runtime.powerState", "poweredOn")),
+	}, {
+		fmt.Sprintf(objectXML, "VirtualMachine", "vm-43",
+			fmt.Sprintf(propertyXML, "name", "old")+fmt.Sprintf(propertyXML, "runtime.host", "host-10")+
+				fmt.Sprintf(propertyXML, "runtime.powerState", "poweredOff")),
+		fmt.Sprintf(objectXML, "HostSystem", "host-20",
+			fmt.Sprintf(propertyXML, "name", "esx2.local")+fmt.Sprintf(propertyXML, "parent", "domain-s19")),
+		fmt.Sprintf(objectXML, "VirtualMachine", "vm-50",
+			fmt.Sprintf(propertyXML, "name", "db1")+fmt.Sprintf(propertyXML, "runtime.host", "host-20")+
+				fmt.Sprintf(propertyXML, "runtime.powerState", "poweredOn")),
+		fmt.Sprintf(objectXML, "Datastore", "datastore-11", fmt.Sprintf(propertyXML, "name", "ds1")),
+	}}
+	if page == 0 {
+		return `<RetrievePropertiesExResponse xmlns="urn:vim25"><returnval><token>1</token>` +
+			strings.Join(objects[0], "") + `</returnval></RetrievePropertiesExResponse>`
+	}
+	return `<ContinueRetrievePropertiesExResponse xmlns="urn:vim25"><returnval>` +
+		strings.Join(objects[1], "") + `</returnval></ContinueRetrievePropertiesExResponse>`
+}
+
+// Samples of the counters, -1 for no sample.
+var samples = map[int32]int64{2: 1234, 12: 40, 24: 5120, 143: -1, 281: 1048576000, 282: 524288000}
+
+func fault(name, message string) string {
+	return fmt.Sprintf(`<soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>%s</faultstring><detail><%sFault xmlns="urn:vim25" xsi:type="%s"></%sFault></detail></soapenv:Fault>`,
+		message, name, name, name)
+}
+
+// fakeVcenter is a fake vCenter.
+type fakeVcenter struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	logins   int
+	sessions map[string]bool
+	// Entities of the QueryPerf requests, and their intervals
+	queries   [][]string
+	intervals map[string]int32
+}
+
+func (f *fakeVcenter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(f.t, err)
+	req := string(body)
+	assert.Equal(f.t, "urn:vim25/6.0", r.Header.Get("SOAPAction"))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	respond := func(s string) {
+		if strings.Contains(s, "soapenv:Fault") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprintf(w, envelope, s)
+	}
+
+	switch {
+	case strings.Contains(req, "<RetrieveServiceContent "):
+		respond(serviceContentResponse)
+		return
+	case strings.Contains(req, "<Login "):
+		if !strings.Contains(req, "<userName>user@vsphere.local</userName><password>secret</password>") {
+			respond(fault("InvalidLogin", "Cannot complete login due to an incorrect user name or password."))
+			return
+		}
+		f.logins++
+		session := fmt.Sprintf("session%d", f.logins)
+		f.sessions[session] = true
+		http.SetCookie(w, &http.Cookie{Name: "vmware_soap_session", Value: session})
+		respond(`<LoginResponse xmlns="urn:vim25"><returnval><key>` + session + `</key></returnval></LoginResponse>`)
+		return
+	}
+	if cookie, err := r.Cookie("vmware_soap_session"); err != nil || !f.sessions[cookie.Value] {
+		respond(fault("NotAuthenticated", "The session is not authenticated."))
+		return
+	}
+
+	switch {
+	case strings.Contains(req, "<RetrievePropertiesEx ") && strings.Contains(req, "<pathSet>perfCounter</pathSet>"):
+		respond(countersResponse())
+	case strings.Contains(req, "<CreateContainerView "):
+		for _, objectType := range []string{"VirtualMachine", "HostSystem", "Datastore", "ClusterComputeResource"} {
+			assert.Contains(f.t, req, "<type>"+objectType+"</type>")
+		}
+		respond(`<CreateContainerViewResponse xmlns="urn:vim25"><returnval type="ContainerView">session[52c6]52f0</returnval></CreateContainerViewResponse>`)
+	case strings.Contains(req, "<RetrievePropertiesEx "):
+		assert.Contains(f.t, req, `<obj type="ContainerView">session[52c6]52f0</obj><skip>true</skip><selectSet xsi:type="TraversalSpec"><name>view</name><type>ContainerView</type><path>view</path>`)
+		respond(inventoryResponse(0))
+	case strings.Contains(req, "<ContinueRetrievePropertiesEx "):
+		assert.Contains(f.t, req, "<token>1</token>")
+		respond(inventoryResponse(1))
+	case strings.Contains(req, "<DestroyView "):
+		respond(`<DestroyViewResponse xmlns="urn:vim25"></DestroyViewResponse>`)
+	case strings.Contains(req, "<QueryPerf "):
+		respond(f.queryPerf(body))
+	default:
+		f.t.Errorf("unexpected request %s", req)
+	}
+}
+
+func (f *fakeVcenter) queryPerf(body []byte) string {
+	var req struct {
+		Body struct {
+			QueryPerf struct {
+				QuerySpec []perfQuerySpec `xml:"querySpec"`
+			} `xml:"QueryPerf"`
+		} `xml:"Body"`
+	}
+	require.NoError(f.t, xml.Unmarshal(body, &req))
+
+	var entities []string
+	var response []string
+	for _, spec := range req.Body.QueryPerf.QuerySpec {
+		entities = append(entities, spec.Entity.Value)
+		f.intervals[spec.Entity.Value] = spec.IntervalID
+		var values []string
+		for _, id := range spec.MetricID {
+			values = append(values, fmt.Sprintf(`<value xsi:type="PerfMetricIntSeries"><id><counterId>%d</counterId><instance></instance></id><value>%d</value></value>`,
+				id.CounterID, samples[id.CounterID]))
+			if id.Instance == "*" && id.CounterID == 2 {
+				values = append(values, fmt.Sprintf(`<value xsi:type="PerfMetricIntSeries"><id><counterId>%d</counterId><instance>0</instance></id><value>%d</value></value>`,
+					id.CounterID, 2345))
+			}
+		}
+		response = append(response, fmt.Sprintf(`<returnval xsi:type="PerfEntityMetric"><entity type="%s">%s</entity><sampleInfo><timestamp>2019-03-10T06:40:00Z</timestamp><interval>%d</interval></sampleInfo>%s</returnval>`,
+			spec.Entity.Type, spec.Entity.Value, spec.IntervalID, strings.Join(values, "")))
+	}
+	f.queries = append(f.queries, entities)
+	return `<QueryPerfResponse xmlns="urn:vim25">` + strings.Join(response, "") + `</QueryPerfResponse>`
+}
+
+func newFakeVcenter(t *testing.T) (*fakeVcenter, *httptest.Server) {
+	f := &fakeVcenter{
+		t:         t,
+		sessions:  make(map[string]bool),
+		intervals: make(map[string]int32),
+	}
+	return f, httptest.NewServer(f)
+}
+
+func newVSphere(u string) *VSphere {
+	return &VSphere{
+		Vcenters:                []string{u + "/sdk"},
+		Username:                "user@vsphere.local",
+		Password:                "secret",
+		VMMetrics:               []string{"cpu.usage.average", "cpu.ready.summation", "mem.usage.average", "net.bytesRx.average"},
+		HostMetrics:             []string{"cpu.usage.average", "mem.usage.average"},
+		DatastoreMetrics:        []string{"disk.capacity.latest", "disk.used.latest"},
+		ClusterMetrics:          []string{"cpu.usage.average"},
+		MaxQueryObjects:         256,
+		MaxQueryMetrics:         256,
+		Concurrency:             2,
+		ObjectDiscoveryInterval: internal.Duration{Duration: 300 * time.Second},
+	}
+}
+
+func TestGather(t *testing.T) {
+	f, ts := newFakeVcenter(t)
+	defer ts.Close()
+	v := newVSphere(ts.URL)
+	vcenter := strings.TrimPrefix(ts.URL, "http://")
+
+	var acc testutil.Accumulator
+	require.NoError(t, v.Gather(&acc))
+	timestamp := time.Date(2019, 3, 10, 6, 40, 0, 0, time.UTC)
+
+	web1 := map[string]string{
+		"vcenter":     vcenter,
+		"moid":        "vm-42",
+		"vmname":      "web1",
+		"esxhostname": "esx1.local",
+		"clustername": "prod",
+	}
+	acc.AssertContainsTaggedFields(t, "vsphere_vm_cpu", map[string]interface{}{
+		"usage_average":   12.34,
+		"ready_summation": int64(40),
+	}, web1)
+	acc.AssertContainsTaggedFields(t, "vsphere_vm_mem", map[string]interface{}{
+		"usage_average": 51.2,
+	}, web1)
+	acc.AssertContainsTaggedFields(t, "vsphere_vm_cpu", map[string]interface{}{
+		"usage_average":   12.34,
+		"ready_summation": int64(40),
+	}, map[string]string{
+		"vcenter":     vcenter,
+		"moid":        "vm-50",
+		"vmname":      "db1",
+		"esxhostname": "esx2.local",
+	})
+	acc.AssertContainsTaggedFields(t, "vsphere_host_cpu", map[string]interface{}{
+		"usage_average": 12.34,
+	}, map[string]string{
+		"vcenter":     vcenter,
+		"moid":        "host-10",
+		"esxhostname": "esx1.local",
+		"clustername": "prod",
+	})
+	acc.AssertContainsTaggedFields(t, "vsphere_host_mem", map[string]interface{}{
+		"usage_average": 51.2,
+	}, map[string]string{
+		"vcenter":     vcenter,
+		"moid":        "host-20",
+		"esxhostname": "esx2.local",
+	})
+	acc.AssertContainsTaggedFields(t, "vsphere_datastore_disk", map[string]interface{}{
+		"capacity_latest": int64(1048576000),
+		"used_latest":     int64(524288000),
+	}, map[string]string{
+		"vcenter": vcenter,
+		"moid":    "datastore-11",
+		"dsname":  "ds1",
+	})
+	acc.AssertContainsTaggedFields(t, "vsphere_cluster_cpu", map[string]interface{}{
+		"usage_average": 12.34,
+	}, map[string]string{
+		"vcenter":     vcenter,
+		"moid":        "domain-c7",
+		"clustername": "prod",
+	})
+	// The VM powered off is not read, nor net.bytesRx without sample
+	assert.Equal(t, 10, len(acc.Metrics))
+	for _, m := range acc.Metrics {
+		assert.Equal(t, timestamp, m.Time)
+		assert.NotEqual(t, "vm-43", m.Tags["moid"])
+	}
+	assert.Equal(t, map[string]int32{
+		"vm-42":        20,
+		"vm-50":        20,
+		"host-10":      20,
+		"host-20":      20,
+		"datastore-11": 300,
+		"domain-c7":    300,
+	}, f.intervals)
+
+	// The session and the objects are kept
+	f.queries = nil
+	require.NoError(t, v.Gather(&acc))
+	assert.Equal(t, 1, f.logins)
+	assert.Equal(t, 4, len(f.queries))
+}
+
+func TestGatherBatches(t *testing.T) {
+	f, ts := newFakeVcenter(t)
+	defer ts.Close()
+	v := newVSphere(ts.URL)
+	v.DatastoreMetrics = nil
+	v.ClusterMetrics = nil
+	v.HostMetrics = nil
+	// 2 VMs of 4 counters
+	v.MaxQueryMetrics = 4
+
+	var acc testutil.Accumulator
+	require.NoError(t, v.Gather(&acc))
+	require.Equal(t, 2, len(f.queries))
+	for _, entities := range f.queries {
+		assert.Equal(t, 1, len(entities))
+	}
+	assert.Equal(t, 4, len(acc.Metrics))
+}
+
+func TestGatherInstances(t *testing.T) {
+	_, ts := newFakeVcenter(t)
+	defer ts.Close()
+	v := newVSphere(ts.URL)
+	v.Instances = true
+
+	var acc testutil.Accumulator
+	require.NoError(t, v.Gather(&acc))
+	acc.AssertContainsTaggedFields(t, "vsphere_host_cpu", map[string]interface{}{
+		"usage_average": 23.45,
+	}, map[string]string{
+		"vcenter":     strings.TrimPrefix(ts.URL, "http://"),
+		"moid":        "host-20",
+		"esxhostname": "esx2.local",
+		"instance":    "0",
+	})
+}
+
+func TestGatherExpiredSession(t *testing.T) {
+	f, ts := newFakeVcenter(t)
+	defer ts.Close()
+	v := newVSphere(ts.URL)
+
+	var acc testutil.Accumulator
+	require.NoError(t, v.Gather(&acc))
+
+	f.mu.Lock()
+	f.sessions = make(map[string]bool)
+	f.mu.Unlock()
+	err := v.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "The session is not authenticated.")
+
+	require.NoError(t, v.Gather(&acc))
+	assert.Equal(t, 2, f.logins)
+}
+
+func TestGatherErrors(t *testing.T) {
+	_, ts := newFakeVcenter(t)
+	defer ts.Close()
+	v := newVSphere(ts.URL)
+	v.Password = "wrong"
+
+	var acc testutil.Accumulator
+	err := v.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "incorrect user name or password")
+
+	v.Password = "secret"
+	v.HostMetrics = append(v.HostMetrics, "cpu.nonexistent.average")
+	err = v.Gather(&acc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has no host counters cpu.nonexistent.average")
+	// The other counters are still read
+	assert.Equal(t, 10, len(acc.Metrics))
+}
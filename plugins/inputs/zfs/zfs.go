@@ -1,10 +1,16 @@
 package zfs
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
@@ -12,9 +18,16 @@ import (
 )
 
 type Zfs struct {
-	KstatPath    string
-	KstatMetrics []string
-	PoolMetrics  bool
+	KstatPath      string
+	KstatMetrics   []string
+	PoolMetrics    bool
+	DatasetMetrics bool
+
+	// sysctl returns the sysctl tree of name, nil where the kstats are files
+	sysctl func(name string) (string, error)
+	// run returns the output of the zpool and zfs commands, nil to not
+	// report what they do
+	run func(command string, args ...string) (string, error)
 }
 
 type poolInfo struct {
@@ -31,8 +44,14 @@ var sampleConfig = `
   ## If not specified, then default is:
   kstatMetrics = ["arcstats", "zfetchstats", "vdev_cache_stats"]
 
-  ## By default, don't gather zpool stats
+  ## By default, don't gather zpool stats: the health, capacity,
+  ## fragmentation and scrub or resilver state of the pools, from the zpool
+  ## command, and their I/O stats on Linux
   poolMetrics = false
+
+  ## By default, don't gather the used and available space of the datasets,
+  ## from the zfs command
+  datasetMetrics = false
 `
 
 func (z *Zfs) SampleConfig() string {
@@ -40,7 +59,7 @@ func (z *Zfs) SampleConfig() string {
 }
 
 func (z *Zfs) Description() string {
-	return "Read metrics of ZFS from arcstats, zfetchstats and vdev_cache_stats"
+	return "Read metrics of ZFS from arcstats, zfetchstats and vdev_cache_stats, and of its pools and datasets"
 }
 
 func getPools(kstatPath string) []poolInfo {
@@ -69,13 +88,17 @@ func getTags(pools []poolInfo) map[string]string {
 	return map[string]string{"pools": poolNames}
 }
 
-func gatherPoolStats(pool poolInfo, acc telegraf.Accumulator) error {
+func gatherPoolStats(pool poolInfo, fields map[string]interface{}, acc telegraf.Accumulator) error {
 	lines, err := internal.ReadLines(pool.ioFilename)
 	if err != nil {
 		return err
 	}
 
 	if len(lines) != 3 {
+		// No I/O stats, only the fields of zpool
+		if len(fields) > 0 {
+			acc.AddFields("zfs_pool", fields, map[string]string{"pool": pool.name})
+		}
 		return err
 	}
 
@@ -89,7 +112,9 @@ func gatherPoolStats(pool poolInfo, acc telegraf.Accumulator) error {
 	}
 
 	tag := map[string]string{"pool": pool.name}
-	fields := make(map[string]interface{})
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
 	for i := 0; i < keyCount; i++ {
 		value, err := strconv.ParseInt(values[i], 10, 64)
 		if err != nil {
@@ -116,41 +141,307 @@ func (z *Zfs) Gather(acc telegraf.Accumulator) error {
 	pools := getPools(kstatPath)
 	tags := getTags(pools)
 
+	// Keep gathering the kstats when the zpool or zfs commands fail and
+	// return their errors as one
+	var errorStrings []string
 	if z.PoolMetrics {
+		poolFields := make(map[string]map[string]interface{})
+		if z.run != nil {
+			if zpools, err := z.zpoolFields(); err != nil {
+				errorStrings = append(errorStrings, err.Error())
+			} else {
+				poolFields = zpools
+			}
+			// FreeBSD has no kstats of the pools
+			if z.sysctl != nil {
+				tags = getTags(zpoolNames(poolFields))
+			}
+		}
 		for _, pool := range pools {
-			err := gatherPoolStats(pool, acc)
+			err := gatherPoolStats(pool, poolFields[pool.name], acc)
 			if err != nil {
 				return err
 			}
+			delete(poolFields, pool.name)
+		}
+		// The pools without kstats
+		for name, fields := range poolFields {
+			acc.AddFields("zfs_pool", fields, map[string]string{"pool": name})
+		}
+	}
+
+	if z.DatasetMetrics && z.run != nil {
+		if err := z.gatherDatasets(acc); err != nil {
+			errorStrings = append(errorStrings, err.Error())
 		}
 	}
 
 	fields := make(map[string]interface{})
 	for _, metric := range kstatMetrics {
-		lines, err := internal.ReadLines(kstatPath + "/" + metric)
+		values, err := z.kstat(kstatPath, metric)
 		if err != nil {
 			return err
 		}
-		for i, line := range lines {
-			if i == 0 || i == 1 {
+		for key, value := range values {
+			fields[metric+"_"+key] = value
+		}
+	}
+	for _, kind := range []string{"", "demand_data_", "demand_metadata_",
+		"prefetch_data_", "prefetch_metadata_", "l2_"} {
+		hits, ok := fields["arcstats_"+kind+"hits"].(int64)
+		misses, _ := fields["arcstats_"+kind+"misses"].(int64)
+		if ok && hits+misses > 0 {
+			fields["arcstats_"+kind+"hit_ratio"] = float64(hits) / float64(hits+misses)
+		}
+	}
+	acc.AddFields("zfs", fields, tags)
+
+	if len(errorStrings) > 0 {
+		return errors.New(strings.Join(errorStrings, "\n"))
+	}
+	return nil
+}
+
+// kstat returns the values of a kstat, from the sysctl tree on FreeBSD and
+// from its file under kstatPath otherwise.
+func (z *Zfs) kstat(kstatPath, metric string) (map[string]int64, error) {
+	values := make(map[string]int64)
+	if z.sysctl != nil {
+		prefix := "kstat.zfs.misc." + metric + "."
+		out, err := z.sysctl(strings.TrimSuffix(prefix, "."))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.SplitN(line, ": ", 2)
+			if len(fields) != 2 || !strings.HasPrefix(fields[0], prefix) {
 				continue
 			}
-			if len(line) < 1 {
-				continue
+			value, _ := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+			values[strings.TrimPrefix(fields[0], prefix)] = value
+		}
+		return values, nil
+	}
+
+	lines, err := internal.ReadLines(kstatPath + "/" + metric)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		if i == 0 || i == 1 {
+			continue
+		}
+		if len(line) < 1 {
+			continue
+		}
+		rawData := strings.Split(line, " ")
+		rawValue := rawData[len(rawData)-1]
+		value, _ := strconv.ParseInt(rawValue, 10, 64)
+		values[rawData[0]] = value
+	}
+	return values, nil
+}
+
+// Properties of zpool list, in the order of their fields.
+var zpoolProperties = []string{"name", "health", "size", "allocated", "free",
+	"fragmentation", "capacity", "dedupratio"}
+
+// zpoolFields returns the fields of zpool list and zpool status, by pool.
+func (z *Zfs) zpoolFields() (map[string]map[string]interface{}, error) {
+	out, err := z.run("zpool", "list", "-Hp", "-o", strings.Join(zpoolProperties, ","))
+	if err != nil {
+		return nil, err
+	}
+	pools := make(map[string]map[string]interface{})
+	for _, line := range strings.Split(out, "\n") {
+		values := strings.Split(line, "\t")
+		if len(values) != len(zpoolProperties) {
+			continue
+		}
+		fields := map[string]interface{}{
+			"health": values[1],
+		}
+		for i, property := range zpoolProperties[2:] {
+			// - when the pool has no value, as an unavailable pool
+			value := strings.TrimRight(values[i+2], "%x")
+			if property == "dedupratio" {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					fields[property] = v
+				}
+			} else if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				fields[property] = v
 			}
-			rawData := strings.Split(line, " ")
-			key := metric + "_" + rawData[0]
-			rawValue := rawData[len(rawData)-1]
-			value, _ := strconv.ParseInt(rawValue, 10, 64)
-			fields[key] = value
 		}
+		pools[values[0]] = fields
+	}
+
+	for name, fields := range pools {
+		out, err := z.run("zpool", "status", name)
+		if err != nil {
+			return nil, err
+		}
+		parseZpoolStatus(out, fields)
+	}
+	return pools, nil
+}
+
+func zpoolNames(pools map[string]map[string]interface{}) []poolInfo {
+	var names []string
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var infos []poolInfo
+	for _, name := range names {
+		infos = append(infos, poolInfo{name: name})
+	}
+	return infos
+}
+
+var (
+	scanFinished   = regexp.MustCompile(`^(scrub repaired|resilvered) (\S+) in .* with (\d+) errors on (.+)$`)
+	scanInProgress = regexp.MustCompile(`^(scrub|resilver) in progress since (.+?)$`)
+	scanPercent    = regexp.MustCompile(`([\d.]+)% done`)
+	scanCanceled   = regexp.MustCompile(`^scrub canceled on (.+)$`)
+	scanPaused     = regexp.MustCompile(`^scrub paused since (.+)$`)
+	dataErrors     = regexp.MustCompile(`^(\d+) data errors`)
+)
+
+// Layout of the times of zpool status
+const zpoolTime = "Mon Jan _2 15:04:05 2006"
+
+// parseZpoolStatus adds the scan and data errors fields of the output of
+// zpool status of a pool.
+func parseZpoolStatus(out string, fields map[string]interface{}) {
+	var scan []string
+	inScan := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "scan:"):
+			inScan = true
+			scan = append(scan, strings.TrimSpace(strings.TrimPrefix(line, "scan:")))
+		case strings.HasPrefix(line, "errors:"):
+			line = strings.TrimSpace(strings.TrimPrefix(line, "errors:"))
+			if m := dataErrors.FindStringSubmatch(line); m != nil {
+				fields["data_errors"], _ = strconv.ParseInt(m[1], 10, 64)
+			} else if line == "No known data errors" {
+				fields["data_errors"] = int64(0)
+			}
+		case strings.Contains(line, ":") && !strings.Contains(line, " "):
+			// The next section, as config:
+			inScan = false
+		case inScan && line != "":
+			scan = append(scan, line)
+		}
+	}
+	if len(scan) == 0 {
+		return
+	}
+
+	parseTime := func(field, value string) {
+		if t, err := time.ParseInLocation(zpoolTime, value, time.Local); err == nil {
+			fields[field] = t.Unix()
+		}
+	}
+	if m := scanFinished.FindStringSubmatch(scan[0]); m != nil {
+		fields["scan"] = "scrub_finished"
+		if m[1] == "resilvered" {
+			fields["scan"] = "resilver_finished"
+		}
+		if repaired, err := parseSize(m[2]); err == nil {
+			fields["scan_repaired"] = repaired
+		}
+		fields["scan_errors"], _ = strconv.ParseInt(m[3], 10, 64)
+		parseTime("scan_end_time", m[4])
+	} else if m := scanInProgress.FindStringSubmatch(scan[0]); m != nil {
+		fields["scan"] = m[1] + "_in_progress"
+		parseTime("scan_start_time", m[2])
+		for _, line := range scan[1:] {
+			if m := scanPercent.FindStringSubmatch(line); m != nil {
+				fields["scan_percent"], _ = strconv.ParseFloat(m[1], 64)
+			}
+		}
+	} else if m := scanCanceled.FindStringSubmatch(scan[0]); m != nil {
+		fields["scan"] = "scrub_canceled"
+		parseTime("scan_end_time", m[1])
+	} else if m := scanPaused.FindStringSubmatch(scan[0]); m != nil {
+		fields["scan"] = "scrub_paused"
+	} else if scan[0] == "none requested" {
+		fields["scan"] = "none"
+	}
+}
+
+// parseSize returns the bytes of a size of zpool status, as 1.50M.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(s, "B")
+	multiplier := float64(1)
+	if i := strings.IndexAny(s, "KMGTPE"); i >= 0 && i == len(s)-1 {
+		multiplier = float64(int64(1) << (10 * uint(strings.IndexByte("KMGTPE", s[i])+1)))
+		s = s[:i]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v * multiplier), nil
+}
+
+// Properties of zfs list, in the order of their fields, by the field they
+// are reported as.
+var datasetProperties = [][2]string{
+	{"used", "used"},
+	{"avail", "available"},
+	{"refer", "referenced"},
+	{"usedbysnapshots", "used_by_snapshots"},
+}
+
+func (z *Zfs) gatherDatasets(acc telegraf.Accumulator) error {
+	properties := []string{"name"}
+	for _, p := range datasetProperties {
+		properties = append(properties, p[0])
+	}
+	out, err := z.run("zfs", "list", "-Hp", "-t", "filesystem,volume",
+		"-o", strings.Join(properties, ","))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, line := range strings.Split(out, "\n") {
+		values := strings.Split(line, "\t")
+		if len(values) != len(properties) {
+			continue
+		}
+		fields := make(map[string]interface{})
+		for i, p := range datasetProperties {
+			if v, err := strconv.ParseInt(values[i+1], 10, 64); err == nil {
+				fields[p[1]] = v
+			}
+		}
+		tags := map[string]string{
+			"dataset": values[0],
+			"pool":    strings.SplitN(values[0], "/", 2)[0],
+		}
+		acc.AddFields("zfs_dataset", fields, tags, now)
 	}
-	acc.AddFields("zfs", fields, tags)
 	return nil
 }
 
+// run returns the output of command.
+func run(command string, args ...string) (string, error) {
+	out, err := exec.Command(command, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("run %s %s: %s", command, strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
 func init() {
 	inputs.Add("zfs", func() telegraf.Input {
-		return &Zfs{}
+		return &Zfs{
+			sysctl: sysctl,
+			run:    run,
+		}
 	})
 }
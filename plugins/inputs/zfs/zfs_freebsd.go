@@ -0,0 +1,18 @@
+//go:build freebsd
+// +build freebsd
+
+package zfs
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// sysctl returns the sysctl tree of name, as name: value lines.
+func sysctl(name string) (string, error) {
+	out, err := exec.Command("sysctl", "-q", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("run sysctl -q %s: %s", name, err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,7 @@
+//go:build !freebsd
+// +build !freebsd
+
+package zfs
+
+// The kstats are files outside of FreeBSD.
+var sysctl func(name string) (string, error)
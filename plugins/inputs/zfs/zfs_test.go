@@ -1,11 +1,15 @@
 package zfs
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -235,92 +239,98 @@ func TestZfsGeneratesMetrics(t *testing.T) {
 
 func getKstatMetricsArcOnly() map[string]interface{} {
 	return map[string]interface{}{
-		"arcstats_hits":                     int64(5968846374),
-		"arcstats_misses":                   int64(1659178751),
-		"arcstats_demand_data_hits":         int64(4860247322),
-		"arcstats_demand_data_misses":       int64(501499535),
-		"arcstats_demand_metadata_hits":     int64(708608325),
-		"arcstats_demand_metadata_misses":   int64(156591375),
-		"arcstats_prefetch_data_hits":       int64(367047144),
-		"arcstats_prefetch_data_misses":     int64(974529898),
-		"arcstats_prefetch_metadata_hits":   int64(32943583),
-		"arcstats_prefetch_metadata_misses": int64(26557943),
-		"arcstats_mru_hits":                 int64(301176811),
-		"arcstats_mru_ghost_hits":           int64(47066067),
-		"arcstats_mfu_hits":                 int64(5520612438),
-		"arcstats_mfu_ghost_hits":           int64(45784009),
-		"arcstats_deleted":                  int64(1718937704),
-		"arcstats_recycle_miss":             int64(481222994),
-		"arcstats_mutex_miss":               int64(20575623),
-		"arcstats_evict_skip":               int64(14655903906543),
-		"arcstats_evict_l2_cached":          int64(145310202998272),
-		"arcstats_evict_l2_eligible":        int64(16345402777088),
-		"arcstats_evict_l2_ineligible":      int64(7437226893312),
-		"arcstats_hash_elements":            int64(36617980),
-		"arcstats_hash_elements_max":        int64(36618318),
-		"arcstats_hash_collisions":          int64(554145157),
-		"arcstats_hash_chains":              int64(4187651),
-		"arcstats_hash_chain_max":           int64(26),
-		"arcstats_p":                        int64(13963222064),
-		"arcstats_c":                        int64(16381258376),
-		"arcstats_c_min":                    int64(4194304),
-		"arcstats_c_max":                    int64(16884125696),
-		"arcstats_size":                     int64(16319887096),
-		"arcstats_hdr_size":                 int64(42567864),
-		"arcstats_data_size":                int64(60066304),
-		"arcstats_meta_size":                int64(1701534208),
-		"arcstats_other_size":               int64(1661543168),
-		"arcstats_anon_size":                int64(94720),
-		"arcstats_anon_evict_data":          int64(0),
-		"arcstats_anon_evict_metadata":      int64(0),
-		"arcstats_mru_size":                 int64(973099008),
-		"arcstats_mru_evict_data":           int64(9175040),
-		"arcstats_mru_evict_metadata":       int64(32768),
-		"arcstats_mru_ghost_size":           int64(32768),
-		"arcstats_mru_ghost_evict_data":     int64(0),
-		"arcstats_mru_ghost_evict_metadata": int64(32768),
-		"arcstats_mfu_size":                 int64(788406784),
-		"arcstats_mfu_evict_data":           int64(50881024),
-		"arcstats_mfu_evict_metadata":       int64(81920),
-		"arcstats_mfu_ghost_size":           int64(0),
-		"arcstats_mfu_ghost_evict_data":     int64(0),
-		"arcstats_mfu_ghost_evict_metadata": int64(0),
-		"arcstats_l2_hits":                  int64(573868618),
-		"arcstats_l2_misses":                int64(1085309718),
-		"arcstats_l2_feeds":                 int64(12182087),
-		"arcstats_l2_rw_clash":              int64(9610),
-		"arcstats_l2_read_bytes":            int64(32695938336768),
-		"arcstats_l2_write_bytes":           int64(2826774778880),
-		"arcstats_l2_writes_sent":           int64(4267687),
-		"arcstats_l2_writes_done":           int64(4267687),
-		"arcstats_l2_writes_error":          int64(0),
-		"arcstats_l2_writes_hdr_miss":       int64(164),
-		"arcstats_l2_evict_lock_retry":      int64(5),
-		"arcstats_l2_evict_reading":         int64(0),
-		"arcstats_l2_free_on_write":         int64(1606914),
-		"arcstats_l2_cdata_free_on_write":   int64(1775),
-		"arcstats_l2_abort_lowmem":          int64(83462),
-		"arcstats_l2_cksum_bad":             int64(393860640),
-		"arcstats_l2_io_error":              int64(53881460),
-		"arcstats_l2_size":                  int64(2471466648576),
-		"arcstats_l2_asize":                 int64(2461690072064),
-		"arcstats_l2_hdr_size":              int64(12854175552),
-		"arcstats_l2_compress_successes":    int64(12184849),
-		"arcstats_l2_compress_zeros":        int64(0),
-		"arcstats_l2_compress_failures":     int64(0),
-		"arcstats_memory_throttle_count":    int64(0),
-		"arcstats_duplicate_buffers":        int64(0),
-		"arcstats_duplicate_buffers_size":   int64(0),
-		"arcstats_duplicate_reads":          int64(0),
-		"arcstats_memory_direct_count":      int64(5159942),
-		"arcstats_memory_indirect_count":    int64(3034640),
-		"arcstats_arc_no_grow":              int64(0),
-		"arcstats_arc_tempreserve":          int64(0),
-		"arcstats_arc_loaned_bytes":         int64(0),
-		"arcstats_arc_prune":                int64(114554259559),
-		"arcstats_arc_meta_used":            int64(16259820792),
-		"arcstats_arc_meta_limit":           int64(12663094272),
-		"arcstats_arc_meta_max":             int64(18327165696),
+		"arcstats_hit_ratio":                   float64(5968846374) / float64(5968846374+1659178751),
+		"arcstats_hits":                        int64(5968846374),
+		"arcstats_misses":                      int64(1659178751),
+		"arcstats_demand_data_hit_ratio":       float64(4860247322) / float64(4860247322+501499535),
+		"arcstats_demand_data_hits":            int64(4860247322),
+		"arcstats_demand_data_misses":          int64(501499535),
+		"arcstats_demand_metadata_hit_ratio":   float64(708608325) / float64(708608325+156591375),
+		"arcstats_demand_metadata_hits":        int64(708608325),
+		"arcstats_demand_metadata_misses":      int64(156591375),
+		"arcstats_prefetch_data_hit_ratio":     float64(367047144) / float64(367047144+974529898),
+		"arcstats_prefetch_data_hits":          int64(367047144),
+		"arcstats_prefetch_data_misses":        int64(974529898),
+		"arcstats_prefetch_metadata_hit_ratio": float64(32943583) / float64(32943583+26557943),
+		"arcstats_prefetch_metadata_hits":      int64(32943583),
+		"arcstats_prefetch_metadata_misses":    int64(26557943),
+		"arcstats_mru_hits":                    int64(301176811),
+		"arcstats_mru_ghost_hits":              int64(47066067),
+		"arcstats_mfu_hits":                    int64(5520612438),
+		"arcstats_mfu_ghost_hits":              int64(45784009),
+		"arcstats_deleted":                     int64(1718937704),
+		"arcstats_recycle_miss":                int64(481222994),
+		"arcstats_mutex_miss":                  int64(20575623),
+		"arcstats_evict_skip":                  int64(14655903906543),
+		"arcstats_evict_l2_cached":             int64(145310202998272),
+		"arcstats_evict_l2_eligible":           int64(16345402777088),
+		"arcstats_evict_l2_ineligible":         int64(7437226893312),
+		"arcstats_hash_elements":               int64(36617980),
+		"arcstats_hash_elements_max":           int64(36618318),
+		"arcstats_hash_collisions":             int64(554145157),
+		"arcstats_hash_chains":                 int64(4187651),
+		"arcstats_hash_chain_max":              int64(26),
+		"arcstats_p":                           int64(13963222064),
+		"arcstats_c":                           int64(16381258376),
+		"arcstats_c_min":                       int64(4194304),
+		"arcstats_c_max":                       int64(16884125696),
+		"arcstats_size":                        int64(16319887096),
+		"arcstats_hdr_size":                    int64(42567864),
+		"arcstats_data_size":                   int64(60066304),
+		"arcstats_meta_size":                   int64(1701534208),
+		"arcstats_other_size":                  int64(1661543168),
+		"arcstats_anon_size":                   int64(94720),
+		"arcstats_anon_evict_data":             int64(0),
+		"arcstats_anon_evict_metadata":         int64(0),
+		"arcstats_mru_size":                    int64(973099008),
+		"arcstats_mru_evict_data":              int64(9175040),
+		"arcstats_mru_evict_metadata":          int64(32768),
+		"arcstats_mru_ghost_size":              int64(32768),
+		"arcstats_mru_ghost_evict_data":        int64(0),
+		"arcstats_mru_ghost_evict_metadata":    int64(32768),
+		"arcstats_mfu_size":                    int64(788406784),
+		"arcstats_mfu_evict_data":              int64(50881024),
+		"arcstats_mfu_evict_metadata":          int64(81920),
+		"arcstats_mfu_ghost_size":              int64(0),
+		"arcstats_mfu_ghost_evict_data":        int64(0),
+		"arcstats_mfu_ghost_evict_metadata":    int64(0),
+		"arcstats_l2_hit_ratio":                float64(573868618) / float64(573868618+1085309718),
+		"arcstats_l2_hits":                     int64(573868618),
+		"arcstats_l2_misses":                   int64(1085309718),
+		"arcstats_l2_feeds":                    int64(12182087),
+		"arcstats_l2_rw_clash":                 int64(9610),
+		"arcstats_l2_read_bytes":               int64(32695938336768),
+		"arcstats_l2_write_bytes":              int64(2826774778880),
+		"arcstats_l2_writes_sent":              int64(4267687),
+		"arcstats_l2_writes_done":              int64(4267687),
+		"arcstats_l2_writes_error":             int64(0),
+		"arcstats_l2_writes_hdr_miss":          int64(164),
+		"arcstats_l2_evict_lock_retry":         int64(5),
+		"arcstats_l2_evict_reading":            int64(0),
+		"arcstats_l2_free_on_write":            int64(1606914),
+		"arcstats_l2_cdata_free_on_write":      int64(1775),
+		"arcstats_l2_abort_lowmem":             int64(83462),
+		"arcstats_l2_cksum_bad":                int64(393860640),
+		"arcstats_l2_io_error":                 int64(53881460),
+		"arcstats_l2_size":                     int64(2471466648576),
+		"arcstats_l2_asize":                    int64(2461690072064),
+		"arcstats_l2_hdr_size":                 int64(12854175552),
+		"arcstats_l2_compress_successes":       int64(12184849),
+		"arcstats_l2_compress_zeros":           int64(0),
+		"arcstats_l2_compress_failures":        int64(0),
+		"arcstats_memory_throttle_count":       int64(0),
+		"arcstats_duplicate_buffers":           int64(0),
+		"arcstats_duplicate_buffers_size":      int64(0),
+		"arcstats_duplicate_reads":             int64(0),
+		"arcstats_memory_direct_count":         int64(5159942),
+		"arcstats_memory_indirect_count":       int64(3034640),
+		"arcstats_arc_no_grow":                 int64(0),
+		"arcstats_arc_tempreserve":             int64(0),
+		"arcstats_arc_loaned_bytes":            int64(0),
+		"arcstats_arc_prune":                   int64(114554259559),
+		"arcstats_arc_meta_used":               int64(16259820792),
+		"arcstats_arc_meta_limit":              int64(12663094272),
+		"arcstats_arc_meta_max":                int64(18327165696),
 	}
 }
 
@@ -364,3 +374,220 @@ func getPoolMetrics() map[string]interface{} {
 		"rcnt":     int64(0),
 	}
 }
+
+const zpoolList = "HOME\tONLINE\t1998694907904\t1039042158592\t959652749312\t12%\t51%\t1.00x\n" +
+	"STORAGE\tDEGRADED\t3985729650688\t3587156885504\t398572765184\t45\t90\t1.21\n" +
+	"OFFLINE\tUNAVAIL\t-\t-\t-\t-\t-\t-\n"
+
+const zpoolStatusHome = `  pool: HOME
+ state: ONLINE
+  scan: scrub repaired 1.50M in 0 days 01:02:03 with 0 errors on Sun Mar 10 01:26:04 2019
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	HOME        ONLINE       0     0     0
+	  mirror-0  ONLINE       0     0     0
+	    sda     ONLINE       0     0     0
+	    sdb     ONLINE       0     0     0
+
+errors: No known data errors
+`
+
+const zpoolStatusStorage = `  pool: STORAGE
+ state: DEGRADED
+status: One or more devices could not be used because the label is missing or
+	invalid.  Sufficient replicas exist for the pool to continue
+	functioning in a degraded state.
+action: Replace the device using 'zpool replace'.
+   see: http://zfsonlinux.org/msg/ZFS-8000-4J
+  scan: resilver in progress since Mon Mar  4 10:00:00 2019
+	1.23T scanned at 1.50G/s, 500G issued at 600M/s, 2.00T total
+	120G resilvered, 24.50% done, 0 days 00:40:12 to go
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	STORAGE       DEGRADED     0     0     0
+	  raidz1-0    DEGRADED     0     0     0
+	    sdc       ONLINE       0     0     0
+	    sdd       UNAVAIL      0     0     0
+
+errors: 3 data errors, use '-v' for a list
+`
+
+const zpoolStatusOffline = `  pool: OFFLINE
+ state: UNAVAIL
+  scan: none requested
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	OFFLINE     UNAVAIL      0     0     0
+
+errors: No known data errors
+`
+
+const zfsList = "HOME\t1039042158592\t896260825088\t98304\t0\n" +
+	"HOME/users\t524288000\t896260825088\t419430400\t104857600\n" +
+	"STORAGE/vm-100-disk-0\t34359738368\t398572765184\t12884901888\t0\n"
+
+func fakeRun(calls *[]string) func(string, ...string) (string, error) {
+	return func(command string, args ...string) (string, error) {
+		call := command + " " + strings.Join(args, " ")
+		*calls = append(*calls, call)
+		switch call {
+		case "zpool list -Hp -o name,health,size,allocated,free,fragmentation,capacity,dedupratio":
+			return zpoolList, nil
+		case "zpool status HOME":
+			return zpoolStatusHome, nil
+		case "zpool status STORAGE":
+			return zpoolStatusStorage, nil
+		case "zpool status OFFLINE":
+			return zpoolStatusOffline, nil
+		case "zfs list -Hp -t filesystem,volume -o name,used,avail,refer,usedbysnapshots":
+			return zfsList, nil
+		}
+		return "", errors.New("unexpected command " + call)
+	}
+}
+
+func TestZfsZpoolMetrics(t *testing.T) {
+	err := os.MkdirAll(testKstatPath+"/HOME", 0755)
+	require.NoError(t, err)
+	defer os.RemoveAll(os.TempDir() + "/telegraf")
+
+	err = ioutil.WriteFile(testKstatPath+"/HOME/io", []byte(pool_ioContents), 0644)
+	require.NoError(t, err)
+
+	// Without I/O stats, as with ZFS on Linux 0.8
+	err = os.MkdirAll(testKstatPath+"/STORAGE", 0755)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(testKstatPath+"/STORAGE/io", []byte(""), 0644)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(testKstatPath+"/arcstats", []byte(arcstatsContents), 0644)
+	require.NoError(t, err)
+
+	var calls []string
+	z := &Zfs{
+		KstatPath:      testKstatPath,
+		KstatMetrics:   []string{"arcstats"},
+		PoolMetrics:    true,
+		DatasetMetrics: true,
+		run:            fakeRun(&calls),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, z.Gather(&acc))
+
+	end, err := time.ParseInLocation(zpoolTime, "Sun Mar 10 01:26:04 2019", time.Local)
+	require.NoError(t, err)
+	start, err := time.ParseInLocation(zpoolTime, "Mon Mar  4 10:00:00 2019", time.Local)
+	require.NoError(t, err)
+
+	home := getPoolMetrics()
+	home["health"] = "ONLINE"
+	home["size"] = int64(1998694907904)
+	home["allocated"] = int64(1039042158592)
+	home["free"] = int64(959652749312)
+	home["fragmentation"] = int64(12)
+	home["capacity"] = int64(51)
+	home["dedupratio"] = 1.0
+	home["scan"] = "scrub_finished"
+	home["scan_repaired"] = int64(1572864)
+	home["scan_errors"] = int64(0)
+	home["scan_end_time"] = end.Unix()
+	home["data_errors"] = int64(0)
+	acc.AssertContainsTaggedFields(t, "zfs_pool", home, map[string]string{"pool": "HOME"})
+	acc.AssertContainsTaggedFields(t, "zfs_pool",
+		map[string]interface{}{
+			"health":          "DEGRADED",
+			"size":            int64(3985729650688),
+			"allocated":       int64(3587156885504),
+			"free":            int64(398572765184),
+			"fragmentation":   int64(45),
+			"capacity":        int64(90),
+			"dedupratio":      1.21,
+			"scan":            "resilver_in_progress",
+			"scan_start_time": start.Unix(),
+			"scan_percent":    24.5,
+			"data_errors":     int64(3),
+		},
+		map[string]string{"pool": "STORAGE"})
+	acc.AssertContainsTaggedFields(t, "zfs_pool",
+		map[string]interface{}{
+			"health":      "UNAVAIL",
+			"scan":        "none",
+			"data_errors": int64(0),
+		},
+		map[string]string{"pool": "OFFLINE"})
+
+	acc.AssertContainsTaggedFields(t, "zfs_dataset",
+		map[string]interface{}{
+			"used":              int64(524288000),
+			"available":         int64(896260825088),
+			"referenced":        int64(419430400),
+			"used_by_snapshots": int64(104857600),
+		},
+		map[string]string{"dataset": "HOME/users", "pool": "HOME"})
+	acc.AssertContainsTaggedFields(t, "zfs_dataset",
+		map[string]interface{}{
+			"used":              int64(34359738368),
+			"available":         int64(398572765184),
+			"referenced":        int64(12884901888),
+			"used_by_snapshots": int64(0),
+		},
+		map[string]string{"dataset": "STORAGE/vm-100-disk-0", "pool": "STORAGE"})
+	assert.Equal(t, 7, len(acc.Metrics))
+}
+
+const sysctlArcstats = `kstat.zfs.misc.arcstats.hits: 5968846374
+kstat.zfs.misc.arcstats.misses: 1659178751
+kstat.zfs.misc.arcstats.size: 17168022512
+`
+
+func TestZfsFreeBSD(t *testing.T) {
+	var calls []string
+	z := &Zfs{
+		KstatMetrics: []string{"arcstats"},
+		PoolMetrics:  true,
+		sysctl: func(name string) (string, error) {
+			if name != "kstat.zfs.misc.arcstats" {
+				return "", errors.New("unknown oid " + name)
+			}
+			return sysctlArcstats, nil
+		},
+		run: fakeRun(&calls),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, z.Gather(&acc))
+
+	acc.AssertContainsTaggedFields(t, "zfs",
+		map[string]interface{}{
+			"arcstats_hits":      int64(5968846374),
+			"arcstats_misses":    int64(1659178751),
+			"arcstats_size":      int64(17168022512),
+			"arcstats_hit_ratio": float64(5968846374) / float64(5968846374+1659178751),
+		},
+		map[string]string{"pools": "HOME::OFFLINE::STORAGE"})
+	assert.True(t, acc.HasMeasurement("zfs_pool"))
+	assert.False(t, acc.HasMeasurement("zfs_dataset"))
+}
+
+func TestZfsZpoolFailure(t *testing.T) {
+	z := &Zfs{
+		KstatMetrics:   []string{"arcstats"},
+		PoolMetrics:    true,
+		DatasetMetrics: true,
+		sysctl: func(name string) (string, error) {
+			return sysctlArcstats, nil
+		},
+		run: func(command string, args ...string) (string, error) {
+			return "", errors.New("run " + command + ": exec: not found")
+		},
+	}
+	var acc testutil.Accumulator
+	err := z.Gather(&acc)
+	require.Error(t, err)
+	assert.Equal(t, "run zpool: exec: not found\nrun zfs: exec: not found", err.Error())
+	// The kstats are still reported
+	assert.True(t, acc.HasMeasurement("zfs"))
+	assert.Equal(t, 1, len(acc.Metrics))
+}
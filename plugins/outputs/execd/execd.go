@@ -0,0 +1,114 @@
+package execd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/process"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/plugins/serializers"
+)
+
+const sampleConfig = `
+  ## Program to run as daemon, followed by its arguments
+  command = ["/usr/bin/my-telegraf-output", "--some-flag", "value"]
+
+  ## Delay before the process is restarted after an unexpected termination
+  restart_delay = "10s"
+
+  ## Data format to export.
+  ## Each data format has it's own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  data_format = "influx"
+`
+
+type Execd struct {
+	Command      []string
+	RestartDelay internal.Duration
+
+	process    *process.Process
+	serializer serializers.Serializer
+}
+
+func NewExecd() *Execd {
+	return &Execd{
+		RestartDelay: internal.Duration{Duration: 10 * time.Second},
+	}
+}
+
+func (e *Execd) SetSerializer(serializer serializers.Serializer) {
+	e.serializer = serializer
+}
+
+func (e *Execd) Connect() error {
+	p, err := process.New(e.Command)
+	if err != nil {
+		return fmt.Errorf("execd: %s", err)
+	}
+	p.RestartDelay = e.RestartDelay.Duration
+	p.ReadStdout = e.logStdout
+
+	e.process = p
+	return p.Start()
+}
+
+func (e *Execd) Close() error {
+	if e.process != nil {
+		e.process.Stop()
+	}
+	return nil
+}
+
+func (e *Execd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Run an external program as a daemon and write metrics to its stdin"
+}
+
+func (e *Execd) Write(metrics []telegraf.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		values, err := e.serializer.Serialize(metric)
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			buf.WriteString(value)
+			buf.WriteByte('\n')
+		}
+	}
+
+	// The metrics are kept by the agent for the next flush if the process
+	// is down
+	if _, err := e.process.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("execd: FAILED to write to %s: %s", e.Command[0], err)
+	}
+	return nil
+}
+
+// logStdout logs what the process writes to stdout.
+func (e *Execd) logStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Printf("execd: %s: %s\n", e.Command[0], scanner.Text())
+	}
+}
+
+func init() {
+	outputs.Add("execd", func() telegraf.Output {
+		return NewExecd()
+	})
+}
@@ -0,0 +1,43 @@
+package execd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/serializers"
+	"github.com/influxdata/telegraf/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	e := NewExecd()
+	e.Command = []string{"sh", "-c", "cat > " + out}
+	e.RestartDelay = internal.Duration{Duration: 10 * time.Millisecond}
+	serializer, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	e.SetSerializer(serializer)
+
+	require.NoError(t, e.Connect())
+	m := testutil.TestMetric(1, "test")
+	require.NoError(t, e.Write([]telegraf.Metric{m}))
+
+	// Closing stdin lets the process exit once it wrote everything
+	require.NoError(t, e.Close())
+	data, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, m.String()+"\n", string(data))
+
+	assert.Error(t, e.Write([]telegraf.Metric{m}))
+}
@@ -185,6 +185,10 @@ func (i *InfluxDB) Write(metrics []telegraf.Metric) error {
 	p := rand.Perm(len(i.conns))
 	for _, n := range p {
 		if e := i.conns[n].Write(bp); e != nil {
+			// The points themselves are wrong, every server rejects them
+			if isRejection(e) {
+				return &telegraf.RejectedError{Reason: e.Error()}
+			}
 			log.Println("ERROR: " + e.Error())
 		} else {
 			err = nil
@@ -200,6 +204,14 @@ func (i *InfluxDB) Write(metrics []telegraf.Metric) error {
 	return err
 }
 
+// isRejection returns whether the write error is caused by the points, like
+// a field type conflict, rather than by the server.
+func isRejection(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "field type conflict") ||
+		strings.Contains(msg, "unable to parse")
+}
+
 func init() {
 	outputs.Add("influxdb", func() telegraf.Output {
 		return &InfluxDB{
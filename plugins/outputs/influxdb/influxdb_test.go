@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/testutil"
 
 	"github.com/stretchr/testify/require"
@@ -39,3 +40,22 @@ func TestHTTPInflux(t *testing.T) {
 	err = i.Write(testutil.MockMetrics())
 	require.NoError(t, err)
 }
+
+func TestHTTPInfluxFieldTypeConflict(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, `{"error":"field type conflict: input field \"value\" `+
+			`on measurement \"test1\" is type float64, already exists as type integer"}`)
+	}))
+	defer ts.Close()
+
+	i := InfluxDB{
+		URLs: []string{ts.URL},
+	}
+
+	err := i.Connect()
+	require.NoError(t, err)
+	err = i.Write(testutil.MockMetrics())
+	require.IsType(t, &telegraf.RejectedError{}, err)
+}
@@ -0,0 +1,43 @@
+package env
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/secretstores"
+)
+
+// Env reads secrets from environment variables.
+type Env struct {
+	Prefix string
+}
+
+var sampleConfig = `
+  ## Prefix of the variables, @{env:password} reads $TELEGRAF_PASSWORD
+  ## with the prefix "TELEGRAF_"
+  # prefix = ""
+`
+
+func (e *Env) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Env) Description() string {
+	return "Read secrets from environment variables"
+}
+
+func (e *Env) Get(key string) (string, error) {
+	value, ok := os.LookupEnv(e.Prefix + key)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set",
+			e.Prefix+key)
+	}
+	return value, nil
+}
+
+func init() {
+	secretstores.Add("env", func() telegraf.SecretStore {
+		return &Env{}
+	})
+}
@@ -0,0 +1,149 @@
+package file
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/secretstores"
+)
+
+// File reads secrets from a JSON object of strings encrypted with
+// AES-256-GCM. The file holds the base64 encoded nonce followed by the
+// ciphertext, the key file the hex encoded 32 bytes key.
+type File struct {
+	Path    string
+	KeyFile string
+
+	secrets map[string]string
+}
+
+var sampleConfig = `
+  ## Encrypted secrets, create it with
+  ##   telegraf -encrypt-secrets /etc/telegraf/secrets.key \
+  ##     < secrets.json > /etc/telegraf/secrets.enc
+  path = "/etc/telegraf/secrets.enc"
+  ## Hex encoded 32 bytes key, create it with "openssl rand -hex 32"
+  key_file = "/etc/telegraf/secrets.key"
+`
+
+func (f *File) SampleConfig() string {
+	return sampleConfig
+}
+
+func (f *File) Description() string {
+	return "Read secrets from an encrypted file"
+}
+
+func (f *File) Get(key string) (string, error) {
+	if f.secrets == nil {
+		secrets, err := f.load()
+		if err != nil {
+			return "", err
+		}
+		f.secrets = secrets
+	}
+
+	value, ok := f.secrets[key]
+	if !ok {
+		return "", fmt.Errorf("no secret %s in %s", key, f.Path)
+	}
+	return value, nil
+}
+
+func (f *File) load() (map[string]string, error) {
+	key, err := ReadKey(f.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := Decrypt(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %s, %s", f.Path, err)
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("could not decode %s, %s", f.Path, err)
+	}
+	return secrets, nil
+}
+
+// ReadKey reads the hex encoded key in path.
+func ReadKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode key %s, %s", path, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key %s has %d bytes, expected 32",
+			path, len(key))
+	}
+	return key, nil
+}
+
+// Encrypt encrypts plaintext with key in the format of the secrets file.
+func Encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(out, sealed)
+	return append(out, '\n'), nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt.
+func Decrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(
+		string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("data too short")
+	}
+
+	nonce := sealed[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, sealed[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func init() {
+	secretstores.Add("file", func() telegraf.SecretStore {
+		return &File{}
+	})
+}
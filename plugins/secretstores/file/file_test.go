@@ -0,0 +1,47 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f\n"
+
+func TestGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "secrets.key")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(testKey), 0600))
+	key, err := ReadKey(keyFile)
+	require.NoError(t, err)
+
+	data, err := Encrypt(key, []byte(`{"password": "secret"}`))
+	require.NoError(t, err)
+	path := filepath.Join(dir, "secrets.enc")
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+
+	f := &File{Path: path, KeyFile: keyFile}
+	value, err := f.Get("password")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", value)
+
+	_, err = f.Get("missing")
+	assert.Error(t, err)
+}
+
+func TestWrongKey(t *testing.T) {
+	key := make([]byte, 32)
+	data, err := Encrypt(key, []byte(`{"password": "secret"}`))
+	require.NoError(t, err)
+
+	key[0] = 1
+	_, err = Decrypt(key, data)
+	assert.Error(t, err)
+}
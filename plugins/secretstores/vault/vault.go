@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/secretstores"
+)
+
+// Vault reads secrets from the fields of a secret of a HashiCorp Vault
+// key/value secrets engine, version 1 or 2.
+type Vault struct {
+	Address   string
+	Token     string
+	TokenFile string
+	// Path of the secret, ie "secret/telegraf" or "secret/data/telegraf"
+	Path    string
+	Timeout internal.Duration
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	secrets map[string]interface{}
+}
+
+var sampleConfig = `
+  ## Address of the Vault server
+  address = "https://vault.example.org:8200"
+  ## Token authenticating to Vault, or the file holding it
+  # token = "$VAULT_TOKEN"
+  # token_file = "/etc/telegraf/vault-token"
+  ## Path of the secret whose fields are read, ie "secret/data/telegraf"
+  ## for the version 2 key/value secrets engine mounted at secret/
+  path = "secret/telegraf"
+  ## Timeout of the request
+  # timeout = "5s"
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+func (v *Vault) SampleConfig() string {
+	return sampleConfig
+}
+
+func (v *Vault) Description() string {
+	return "Read secrets from HashiCorp Vault"
+}
+
+func (v *Vault) Get(key string) (string, error) {
+	if v.secrets == nil {
+		secrets, err := v.read()
+		if err != nil {
+			return "", err
+		}
+		v.secrets = secrets
+	}
+
+	value, ok := v.secrets[key]
+	if !ok {
+		return "", fmt.Errorf("no field %s in Vault secret %s", key, v.Path)
+	}
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %s of Vault secret %s is not a string",
+			key, v.Path)
+	}
+	return str, nil
+}
+
+// read returns the fields of the secret.
+func (v *Vault) read() (map[string]interface{}, error) {
+	token := v.Token
+	if v.TokenFile != "" {
+		t, err := ioutil.ReadFile(v.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(t))
+	}
+
+	tlsCfg, err := internal.GetTLSConfig(
+		v.SSLCert, v.SSLKey, v.SSLCA, v.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	timeout := v.Timeout.Duration
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsCfg},
+		Timeout:   timeout,
+	}
+
+	addr := strings.TrimSuffix(v.Address, "/") + "/v1/" +
+		strings.TrimPrefix(v.Path, "/")
+	req, err := http.NewRequest("GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Vault secret %s, %s", v.Path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP status %s", addr, resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("could not decode Vault secret %s, %s",
+			v.Path, err)
+	}
+
+	// Version 2 of the key/value engine nests the fields and adds metadata
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	return secret.Data, nil
+}
+
+func init() {
+	secretstores.Add("vault", func() telegraf.SecretStore {
+		return &Vault{}
+	})
+}
@@ -0,0 +1,58 @@
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func vaultServer(t *testing.T, path, response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		require.Equal(t, path, r.URL.Path)
+		fmt.Fprint(w, response)
+	}))
+}
+
+func TestGetKV1(t *testing.T) {
+	ts := vaultServer(t, "/v1/secret/telegraf",
+		`{"data": {"password": "secret", "port": 1717}}`)
+	defer ts.Close()
+
+	v := &Vault{Address: ts.URL, Token: "token", Path: "secret/telegraf"}
+	value, err := v.Get("password")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", value)
+
+	_, err = v.Get("port")
+	assert.Error(t, err)
+	_, err = v.Get("missing")
+	assert.Error(t, err)
+}
+
+func TestGetKV2(t *testing.T) {
+	ts := vaultServer(t, "/v1/secret/data/telegraf",
+		`{"data": {"data": {"password": "secret"}, "metadata": {"version": 3}}}`)
+	defer ts.Close()
+
+	v := &Vault{Address: ts.URL, Token: "token", Path: "secret/data/telegraf"}
+	value, err := v.Get("password")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", value)
+}
+
+func TestForbidden(t *testing.T) {
+	ts := vaultServer(t, "/v1/secret/telegraf", `{}`)
+	defer ts.Close()
+
+	v := &Vault{Address: ts.URL, Token: "wrong", Path: "secret/telegraf"}
+	_, err := v.Get("password")
+	assert.Error(t, err)
+}
@@ -0,0 +1,13 @@
+package telegraf
+
+type SecretStore interface {
+	// SampleConfig returns the default configuration of the SecretStore
+	SampleConfig() string
+
+	// Description returns a one-sentence description on the SecretStore
+	Description() string
+
+	// Get returns the secret stored under key. It is called while the
+	// configuration is loaded, for each @{store:key} reference.
+	Get(key string) (string, error)
+}
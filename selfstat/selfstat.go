@@ -0,0 +1,173 @@
+// Package selfstat keeps the statistics of the agent itself, like the
+// number of metrics each plugin gathered or wrote. They are reported by the
+// internal input.
+package selfstat
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Stat is a counter or gauge, safe for concurrent use.
+type Stat struct {
+	measurement string
+	field       string
+	tags        map[string]string
+	gauge       bool
+	v           int64
+}
+
+// Measurement returns the measurement name of the stat.
+func (s *Stat) Measurement() string {
+	return s.measurement
+}
+
+// Field returns the field name of the stat.
+func (s *Stat) Field() string {
+	return s.field
+}
+
+// Tags returns the tags of the stat.
+func (s *Stat) Tags() map[string]string {
+	return copyTags(s.tags)
+}
+
+// IsGauge returns true if the stat is a gauge, false for a counter.
+func (s *Stat) IsGauge() bool {
+	return s.gauge
+}
+
+// Incr adds v to the stat.
+func (s *Stat) Incr(v int64) {
+	atomic.AddInt64(&s.v, v)
+}
+
+// Set sets the stat to v.
+func (s *Stat) Set(v int64) {
+	atomic.StoreInt64(&s.v, v)
+}
+
+// Get returns the value of the stat.
+func (s *Stat) Get() int64 {
+	return atomic.LoadInt64(&s.v)
+}
+
+var (
+	mu    sync.Mutex
+	stats = make(map[string]*Stat)
+)
+
+// Register returns the counter of the field of the measurement "internal_"
+// + measurement with the tags, registering it if needed. Stats registered
+// twice are the same.
+func Register(measurement, field string, tags map[string]string) *Stat {
+	return register(measurement, field, tags, false)
+}
+
+// RegisterGauge is Register for a gauge.
+func RegisterGauge(measurement, field string, tags map[string]string) *Stat {
+	return register(measurement, field, tags, true)
+}
+
+func register(
+	measurement string,
+	field string,
+	tags map[string]string,
+	gauge bool,
+) *Stat {
+	k := key(measurement, tags) + " " + field
+
+	mu.Lock()
+	defer mu.Unlock()
+	if s, ok := stats[k]; ok {
+		return s
+	}
+	s := &Stat{
+		measurement: "internal_" + measurement,
+		field:       field,
+		tags:        copyTags(tags),
+		gauge:       gauge,
+	}
+	stats[k] = s
+	return s
+}
+
+// Stats returns the registered stats, sorted by measurement, tags and field.
+func Stats() []*Stat {
+	mu.Lock()
+	keys := make([]string, 0, len(stats))
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	all := make([]*Stat, len(keys))
+	for i, k := range keys {
+		all[i] = stats[k]
+	}
+	mu.Unlock()
+	return all
+}
+
+// Metrics returns the registered stats, the fields of the same
+// measurement and tags grouped in one metric.
+func Metrics() []telegraf.Metric {
+	type group struct {
+		measurement string
+		tags        map[string]string
+		fields      map[string]interface{}
+	}
+
+	mu.Lock()
+	groups := make(map[string]*group)
+	var keys []string
+	for _, s := range stats {
+		k := key(s.measurement, s.tags)
+		g, ok := groups[k]
+		if !ok {
+			g = &group{
+				measurement: s.measurement,
+				tags:        copyTags(s.tags),
+				fields:      make(map[string]interface{}),
+			}
+			groups[k] = g
+			keys = append(keys, k)
+		}
+		g.fields[s.field] = s.Get()
+	}
+	mu.Unlock()
+
+	sort.Strings(keys)
+	now := time.Now()
+	metrics := make([]telegraf.Metric, 0, len(keys))
+	for _, k := range keys {
+		g := groups[k]
+		m, err := telegraf.NewMetric(g.measurement, g.tags, g.fields, now)
+		if err == nil {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// key identifies a measurement with its tags.
+func key(measurement string, tags map[string]string) string {
+	parts := make([]string, 0, len(tags))
+	for k, v := range tags {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return measurement + "," + strings.Join(parts, ",")
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
+}
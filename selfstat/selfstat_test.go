@@ -0,0 +1,42 @@
+package selfstat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	s := Register("test", "count", map[string]string{"input": "cpu"})
+	s.Incr(2)
+	s.Incr(3)
+	assert.Equal(t, int64(5), s.Get())
+
+	// Registering again returns the same stat
+	same := Register("test", "count", map[string]string{"input": "cpu"})
+	assert.Equal(t, int64(5), same.Get())
+
+	Register("test", "gauge", map[string]string{"input": "cpu"}).Set(7)
+	Register("test", "count", map[string]string{"input": "mem"}).Incr(1)
+
+	var cpu, mem map[string]interface{}
+	for _, m := range Metrics() {
+		if m.Name() != "internal_test" {
+			continue
+		}
+		switch m.Tags()["input"] {
+		case "cpu":
+			cpu = m.Fields()
+		case "mem":
+			mem = m.Fields()
+		}
+	}
+	require.NotNil(t, cpu)
+	require.NotNil(t, mem)
+	assert.Equal(t, map[string]interface{}{
+		"count": int64(5),
+		"gauge": int64(7),
+	}, cpu)
+	assert.Equal(t, map[string]interface{}{"count": int64(1)}, mem)
+}
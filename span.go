@@ -0,0 +1,130 @@
+package telegraf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SpanContext identifies the trace span in which a metric was produced, as
+// propagated by the W3C traceparent header, so that a backend can correlate
+// the metric with its trace.
+type SpanContext struct {
+	// TraceID is 32 and SpanID 16 lowercase hex digits
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+// ParseTraceparent parses a W3C traceparent header, like
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(header string) (SpanContext, error) {
+	// Versions after 00 may append fields
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) || !isHex(parts[3], 2) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	sc := SpanContext{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Sampled: flags[0]&1 == 1,
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+	return sc, nil
+}
+
+// IsValid returns whether the trace and span IDs are well formed and not
+// zero.
+func (sc SpanContext) IsValid() bool {
+	return isHex(sc.TraceID, 32) && sc.TraceID != strings.Repeat("0", 32) &&
+		isHex(sc.SpanID, 16) && sc.SpanID != strings.Repeat("0", 16)
+}
+
+// Traceparent returns the traceparent header of the span context.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-" + flags
+}
+
+// isHex returns whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// TracedMetric is a Metric carrying the span context of its source.
+type TracedMetric interface {
+	Metric
+
+	SpanContext() SpanContext
+}
+
+type tracedMetric struct {
+	Metric
+	span SpanContext
+}
+
+func (m *tracedMetric) SpanContext() SpanContext {
+	return m.span
+}
+
+// WithSpanContext returns m carrying the span context sc.
+func WithSpanContext(m Metric, sc SpanContext) Metric {
+	if t, ok := m.(*tracedMetric); ok {
+		m = t.Metric
+	}
+	return &tracedMetric{Metric: m, span: sc}
+}
+
+// SpanContextOf returns the span context of m, if it carries one.
+func SpanContextOf(m Metric) (SpanContext, bool) {
+	if t, ok := m.(TracedMetric); ok {
+		return t.SpanContext(), true
+	}
+	return SpanContext{}, false
+}
+
+// SpanAccumulator is an Accumulator which can attach the span context of
+// the source of the metrics, like the traceparent header of a pushed
+// request, to the metrics.
+type SpanAccumulator interface {
+	Accumulator
+
+	AddFieldsWithSpan(span SpanContext,
+		measurement string,
+		fields map[string]interface{},
+		tags map[string]string,
+		t ...time.Time)
+}
+
+// AddFieldsWithSpan adds the fields to acc with the span context span if
+// acc is a SpanAccumulator, and without it otherwise.
+func AddFieldsWithSpan(
+	acc Accumulator,
+	span SpanContext,
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	if sa, ok := acc.(SpanAccumulator); ok && span.IsValid() {
+		sa.AddFieldsWithSpan(span, measurement, fields, tags, t...)
+		return
+	}
+	acc.AddFields(measurement, fields, tags, t...)
+}
@@ -0,0 +1,65 @@
+package telegraf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(header)
+	require.NoError(t, err)
+	assert.Equal(t, SpanContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+		Sampled: true,
+	}, sc)
+	assert.Equal(t, header, sc.Traceparent())
+
+	// Later versions may add fields
+	_, err = ParseTraceparent(
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.NoError(t, err)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	} {
+		_, err := ParseTraceparent(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestWithSpanContext(t *testing.T) {
+	m, err := NewMetric("cpu", nil, map[string]interface{}{"value": 1},
+		time.Unix(0, 0))
+	require.NoError(t, err)
+	_, ok := SpanContextOf(m)
+	assert.False(t, ok)
+
+	sc := SpanContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+	}
+	traced := WithSpanContext(m, sc)
+	got, ok := SpanContextOf(traced)
+	assert.True(t, ok)
+	assert.Equal(t, sc, got)
+	assert.Equal(t, m.String(), traced.String())
+
+	// The span context is replaced rather than wrapped again
+	sc.SpanID = "00f067aa0ba902b8"
+	retraced := WithSpanContext(traced, sc)
+	assert.Equal(t, m, retraced.(*tracedMetric).Metric)
+	got, _ = SpanContextOf(retraced)
+	assert.Equal(t, sc, got)
+}
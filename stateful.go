@@ -0,0 +1,14 @@
+package telegraf
+
+// StatefulPlugin is a plugin whose state is kept across restarts of the
+// agent, like the offsets of the files it reads.
+type StatefulPlugin interface {
+	// GetState returns the state of the plugin, stored as JSON when the
+	// agent stops
+	GetState() interface{}
+
+	// SetState restores the state stored when the agent last stopped,
+	// decoded into a value of the type returned by GetState. It is called
+	// before the plugin gathers or writes.
+	SetState(state interface{}) error
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,6 +18,8 @@ type Metric struct {
 	Tags        map[string]string
 	Fields      map[string]interface{}
 	Time        time.Time
+	// Span is the span context of the metric, if added with one
+	Span telegraf.SpanContext
 }
 
 func (p *Metric) String() string {
@@ -84,6 +87,22 @@ func (a *Accumulator) AddFields(
 	a.Metrics = append(a.Metrics, p)
 }
 
+// AddFieldsWithSpan adds a measurement point carrying a span context.
+func (a *Accumulator) AddFieldsWithSpan(
+	span telegraf.SpanContext,
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	timestamp ...time.Time,
+) {
+	a.AddFields(measurement, fields, tags, timestamp...)
+	a.Lock()
+	defer a.Unlock()
+	if len(fields) > 0 {
+		a.Metrics[len(a.Metrics)-1].Span = span
+	}
+}
+
 func (a *Accumulator) Debug() bool {
 	// stub for implementing Accumulator interface.
 	return a.debug